@@ -16,11 +16,16 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"os"
 
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 
 	"github.com/redpanda-data/connect/v4/internal/impl/kafka/enterprise"
+	"github.com/redpanda-data/connect/v4/internal/impl/wasm"
+	"github.com/redpanda-data/connect/v4/internal/secrets"
 
 	_ "github.com/redpanda-data/connect/v4/public/components/all"
 )
@@ -39,6 +44,23 @@ func redpandaTopLevelConfigField() *service.ConfigField {
 }
 
 func main() {
+	var wasmPlugins *wasm.Plugins
+	if dir := os.Getenv("CONNECT_WASM_PLUGINS_PATH"); dir != "" {
+		var err error
+		if wasmPlugins, err = wasm.RegisterPlugins(service.GlobalEnvironment(), bloblang.GlobalEnvironment(), dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to register WASM plugins: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Configs are interpolated from the environment of the process by the
+	// CLI, and therefore secrets referenced by environment variables are
+	// resolved into it ahead of parsing.
+	if err := secrets.ResolveEnv(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve secrets: %v\n", err)
+		os.Exit(1)
+	}
+
 	rpLogger := enterprise.NewTopicLogger()
 
 	service.RunCLI(
@@ -70,6 +92,7 @@ func main() {
 		}),
 		service.CLIOptOnLoggerInit(func(l *service.Logger) {
 			rpLogger.SetFallbackLogger(l)
+			wasmPlugins.SetLogger(l)
 		}),
 		service.CLIOptAddTeeLogger(slog.New(rpLogger)),
 		service.CLIOptOnConfigParse(func(fn *service.ParsedConfig) error {
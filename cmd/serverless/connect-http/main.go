@@ -0,0 +1,42 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/redpanda-data/connect/v4/internal/secrets"
+	"github.com/redpanda-data/connect/v4/internal/serverless"
+
+	// Import all plugins defined within the repo.
+	_ "github.com/redpanda-data/connect/v4/public/components/all"
+)
+
+func main() {
+	confYAML := serverless.ConfigFromEnv()
+	if secrets.HasReferences(confYAML) {
+		fmt.Fprintf(os.Stderr, "Initialisation error: %v\n", secrets.ErrConfigReferences)
+		os.Exit(1)
+	}
+
+	envLookup, err := secrets.EnvLookup(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Initialisation error: %v\n", err)
+		os.Exit(1)
+	}
+	serverless.RunHTTP(confYAML, serverless.OptEnvVarLookupFunc(envLookup))
+}
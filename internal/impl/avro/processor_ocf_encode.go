@@ -0,0 +1,196 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	ocfeFieldSchema      = "schema"
+	ocfeFieldSchemaPath  = "schema_path"
+	ocfeFieldCompression = "compression"
+	ocfeFieldRawJSON     = "raw_json"
+	ocfeFieldMetadata    = "metadata"
+)
+
+func avroOCFEncodeProcessorConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Parsing").
+		Summary("Encodes a batch of structured messages into a single https://avro.apache.org/docs/current/specification/#object-container-files[Avro Object Container File^].").
+		Description(`
+The resulting file contains a header with the schema, followed by a single data block containing all messages of the batch terminated by a sync marker. Files produced by this processor can be consumed with the `+"xref:components:scanners/avro.adoc[`avro` scanner]"+`.
+
+Messages are converted to Avro using the provided schema. By default the contents of each message are expected to be formatted as https://avro.apache.org/docs/current/specification/_print/#json-encoding[Avro JSON^], where union values are wrapped in an object naming their type. Set the field `+"`raw_json`"+` to `+"`true`"+` in order to instead encode documents that are formatted as standard JSON.`).
+		Version("4.31.0").
+		Field(service.NewStringField(ocfeFieldSchema).
+			Description("A full Avro schema to use.").
+			Default("")).
+		Field(service.NewStringField(ocfeFieldSchemaPath).
+			Description("The path of a schema document to apply. Use either this or the `schema` field.").
+			Default("").
+			Example("file://path/to/spec.avsc").
+			Example("http://localhost:8081/path/to/spec/versions/1")).
+		Field(service.NewStringEnumField(ocfeFieldCompression, goavro.CompressionNullLabel, goavro.CompressionDeflateLabel, goavro.CompressionSnappyLabel).
+			Description("The compression codec to apply to data blocks.").
+			Default(goavro.CompressionNullLabel)).
+		Field(service.NewBoolField(ocfeFieldRawJSON).
+			Description("Whether messages are formatted as normal JSON (\"json that meets the expectations of regular internet json\") rather than https://avro.apache.org/docs/current/specification/_print/#json-encoding[Avro JSON^].").
+			Advanced().
+			Default(false)).
+		Field(service.NewStringMapField(ocfeFieldMetadata).
+			Description("Optional key/value pairs to add to the file header metadata. Keys prefixed with `avro.` are reserved and cannot be used.").
+			Advanced().
+			Default(map[string]any{})).
+		Example("Writing Avro Files to AWS S3",
+			"In this example we use the batching mechanism of an `aws_s3` output to collect a batch of messages in memory, which is then converted into an Avro OCF file and uploaded.",
+			`
+output:
+  aws_s3:
+    bucket: TODO
+    path: 'stuff/${! timestamp_unix() }-${! uuid_v4() }.avro'
+    batching:
+      count: 1000
+      period: 10s
+      processors:
+        - avro_ocf_encode:
+            schema_path: file://path/to/spec.avsc
+            compression: snappy
+            raw_json: true
+`)
+}
+
+func init() {
+	err := service.RegisterBatchProcessor(
+		"avro_ocf_encode", avroOCFEncodeProcessorConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+			return newAvroOCFEncodeProcessorFromConfig(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type avroOCFEncodeProcessor struct {
+	codec       *goavro.Codec
+	compression string
+	metadata    map[string][]byte
+}
+
+func newAvroOCFEncodeProcessorFromConfig(conf *service.ParsedConfig) (*avroOCFEncodeProcessor, error) {
+	schema, err := conf.FieldString(ocfeFieldSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaPath, err := conf.FieldString(ocfeFieldSchemaPath)
+	if err != nil {
+		return nil, err
+	}
+	if schemaPath != "" {
+		if !(strings.HasPrefix(schemaPath, "file://") || strings.HasPrefix(schemaPath, "http://")) {
+			return nil, errors.New("invalid schema_path provided, must start with file:// or http://")
+		}
+		if schema, err = loadSchema(schemaPath); err != nil {
+			return nil, fmt.Errorf("failed to load Avro schema definition: %v", err)
+		}
+	}
+	if schema == "" {
+		return nil, errors.New("a schema must be specified with either the `schema` or `schema_path` fields")
+	}
+
+	rawJSON, err := conf.FieldBool(ocfeFieldRawJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &avroOCFEncodeProcessor{
+		metadata: map[string][]byte{},
+	}
+	if rawJSON {
+		p.codec, err = goavro.NewCodecForStandardJSONFull(schema)
+	} else {
+		p.codec, err = goavro.NewCodec(schema)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %v", err)
+	}
+
+	if p.compression, err = conf.FieldString(ocfeFieldCompression); err != nil {
+		return nil, err
+	}
+
+	metadata, err := conf.FieldStringMap(ocfeFieldMetadata)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range metadata {
+		if strings.HasPrefix(k, "avro.") {
+			return nil, fmt.Errorf("metadata key %v uses the reserved avro. prefix", k)
+		}
+		p.metadata[k] = []byte(v)
+	}
+	return p, nil
+}
+
+func (p *avroOCFEncodeProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	datums := make([]any, len(batch))
+	for i, m := range batch {
+		mBytes, err := m.AsBytes()
+		if err != nil {
+			return nil, err
+		}
+		if datums[i], _, err = p.codec.NativeFromTextual(mBytes); err != nil {
+			return nil, fmt.Errorf("failed to convert message %v to Avro: %w", i, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	wtr, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:               &buf,
+		Codec:           p.codec,
+		CompressionName: p.compression,
+		MetaData:        p.metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCF writer: %w", err)
+	}
+	if err := wtr.Append(datums); err != nil {
+		return nil, fmt.Errorf("failed to write OCF block: %w", err)
+	}
+
+	outMsg := batch[0]
+	outMsg.SetBytes(buf.Bytes())
+	return []service.MessageBatch{{outMsg}}, nil
+}
+
+func (p *avroOCFEncodeProcessor) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const ocfTestSchema = `{
+  "type": "record",
+  "name": "thing",
+  "fields": [
+    { "name": "id", "type": "long" },
+    { "name": "name", "type": [ "null", "string" ] }
+  ]
+}`
+
+func TestAvroOCFEncodeScannerRoundTrip(t *testing.T) {
+	for _, compression := range []string{"null", "deflate", "snappy"} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			conf, err := avroOCFEncodeProcessorConfig().ParseYAML(fmt.Sprintf(`
+compression: %v
+raw_json: true
+metadata:
+  owner: test
+schema: '%v'
+`, compression, ocfTestSchema), nil)
+			require.NoError(t, err)
+
+			proc, err := newAvroOCFEncodeProcessorFromConfig(conf)
+			require.NoError(t, err)
+
+			batches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+				service.NewMessage([]byte(`{"id":1,"name":"foo"}`)),
+				service.NewMessage([]byte(`{"id":2,"name":null}`)),
+				service.NewMessage([]byte(`{"id":3,"name":"bar"}`)),
+			})
+			require.NoError(t, err)
+			require.Len(t, batches, 1)
+			require.Len(t, batches[0], 1)
+
+			fileBytes, err := batches[0][0].AsBytes()
+			require.NoError(t, err)
+
+			ocfRdr, err := goavro.NewOCFReader(bytes.NewReader(fileBytes))
+			require.NoError(t, err)
+			assert.Equal(t, compression, string(ocfRdr.MetaData()["avro.codec"]))
+			assert.Equal(t, "test", string(ocfRdr.MetaData()["owner"]))
+
+			sConf, err := avroScannerSpec().ParseYAML(`raw_json: true`, nil)
+			require.NoError(t, err)
+
+			creator, err := avroScannerFromParsed(sConf)
+			require.NoError(t, err)
+
+			scanner, err := creator.Create(io.NopCloser(bytes.NewReader(fileBytes)), func(context.Context, error) error {
+				return nil
+			}, &service.ScannerSourceDetails{})
+			require.NoError(t, err)
+
+			var results []string
+			for {
+				b, _, err := scanner.NextBatch(context.Background())
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				for _, m := range b {
+					mBytes, err := m.AsBytes()
+					require.NoError(t, err)
+					results = append(results, string(mBytes))
+				}
+			}
+			require.NoError(t, scanner.Close(context.Background()))
+
+			expected := []string{
+				`{"id":1,"name":"foo"}`,
+				`{"id":2,"name":null}`,
+				`{"id":3,"name":"bar"}`,
+			}
+			require.Len(t, results, len(expected))
+			for i, exp := range expected {
+				assert.JSONEq(t, exp, results[i])
+			}
+		})
+	}
+}
+
+func TestAvroOCFEncodeErrors(t *testing.T) {
+	conf, err := avroOCFEncodeProcessorConfig().ParseYAML(fmt.Sprintf(`
+schema: '%v'
+`, ocfTestSchema), nil)
+	require.NoError(t, err)
+
+	proc, err := newAvroOCFEncodeProcessorFromConfig(conf)
+	require.NoError(t, err)
+
+	_, err = proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"nope","name":null}`)),
+	})
+	require.Error(t, err)
+
+	conf, err = avroOCFEncodeProcessorConfig().ParseYAML(`
+metadata:
+  avro.schema: nope
+schema: '{"type":"string"}'
+`, nil)
+	require.NoError(t, err)
+
+	_, err = newAvroOCFEncodeProcessorFromConfig(conf)
+	require.Error(t, err)
+}
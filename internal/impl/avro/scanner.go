@@ -115,6 +115,13 @@ func (c *avroScanner) NextBatch(ctx context.Context) (service.MessageBatch, erro
 		return nil, io.EOF
 	}
 
+	if !c.ocf.Scan() {
+		if err := c.ocf.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
 	datum, err := c.ocf.Read()
 	if err != nil {
 		return nil, err
@@ -99,6 +99,12 @@ foo_created_at = "2018-12-18T11:57:32"
 
 Custom functions can also still be used with this codec.
 
+== Batch Mode
+
+When the field `+"`mode`"+` is set to `+"`batch`"+` the program is executed once for each batch, and each message of the batch is fed into the program as a single record, regardless of any line breaks within the message, which makes it possible to aggregate messages within `+"`END`"+` blocks. With the `+"`text`"+` codec the record is the contents of the message, and with the `+"`none`"+` codec the record is empty. The `+"`json`"+` codec is not supported in batch mode, and metadata is not initialized as variables, instead use the function `+"`metadata_get`"+`.
+
+Functions that access or mutate messages target the message of the record currently being processed, the first message of the batch within `+"`BEGIN`"+` blocks, and the last message of the batch within `+"`END`"+` blocks. Records are separated with the ASCII record separator character (`+"`\\x1e`"+`), and therefore the variable `+"`RS`"+` must not be changed in batch mode.
+
 == AWK functions
 
 `+"=== `json_get`"+`
@@ -302,6 +308,27 @@ successful. It will emit an error otherwise.
 			Description("A <<codecs,codec>> defines how messages should be inserted into the AWK program as variables. The codec does not change which <<awk-functions,custom Redpanda Connect functions>> are available. The `text` codec is the closest to a typical AWK use case.")).
 		Field(service.NewStringField("program").
 			Description("An AWK program to execute")).
+		Field(service.NewStringAnnotatedEnumField("mode", map[string]string{
+			"message": "The program is executed once for each message.",
+			"batch":   "The program is executed once for each batch, with each message of the batch fed into the program as a record.",
+		}).
+			Description("Whether the program is executed for each message or for each <<batch-mode,batch>>.").
+			Default("message").
+			Version("4.31.0")).
+		Field(service.NewStringAnnotatedEnumField("output_mode", map[string]string{
+			"replace": "The output of the program replaces the contents of the message, or of the first message of the batch in batch mode, and all other messages of the batch are dropped. If nothing is printed the messages remain unchanged.",
+			"split":   "Each line printed by the program becomes a separate message, which is a copy of the message being processed when the line was printed. If nothing is printed then the messages are dropped.",
+		}).
+			Description("How the output of the program is converted into messages.").
+			Default("replace").
+			Version("4.31.0")).
+		Field(service.NewStringAnnotatedEnumField("output_codec", map[string]string{
+			"text": "The output is set as the raw contents of messages.",
+			"json": "The output is parsed as a JSON document, which becomes the structured contents of messages.",
+		}).
+			Description("How the output of the program is interpreted. The `json` codec makes it possible to write documents with `create_json_object` and `create_json_array` instead of mutating them with the `json_set` family of functions.").
+			Default("text").
+			Version("4.31.0")).
 		Example("JSON Mapping and Arithmetic", `
 Because AWK is a full programming language it's much easier to map documents and perform arithmetic with it than with other Redpanda Connect processors. For example, if we were expecting documents of the form:
 
@@ -344,6 +371,39 @@ pipeline:
           else
             map_unknown(type);
         }
+`).
+		Example("Aggregating Batches", `
+With batch mode and the `+"`split`"+` output mode it's possible to aggregate the messages of a batch GROUP BY-style. For example, given a batch of documents of the form:
+
+`+"```json"+`
+{"user":"alice","amount":5}
+{"user":"bob","amount":3}
+{"user":"alice","amount":10}
+`+"```"+`
+
+We can sum the amounts of each user, resulting in a message for each user:
+
+`+"```json"+`
+{"total":"15","user":"alice"}
+{"total":"3","user":"bob"}
+`+"```"+`
+
+With the following config:`, `
+pipeline:
+  processors:
+  - awk:
+      codec: none
+      mode: batch
+      output_mode: split
+      output_codec: json
+      program: |
+        {
+          totals[json_get("user")] += json_get("amount")
+        }
+        END {
+          for (user in totals)
+            print create_json_object("user", user, "total", totals[user])
+        }
 `).
 		Example("Stuff With Arrays", `
 It's possible to iterate JSON arrays by appending an index value to the path, this can be used to do things like removing duplicates from arrays. For example, given the following input document:
@@ -382,7 +442,10 @@ pipeline:
 func init() {
 	varInvalidRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]`)
 
-	err := service.RegisterProcessor("awk", awkSpec(), newAWKProcFromConfig)
+	err := service.RegisterBatchProcessor("awk", awkSpec(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+			return newAWKProcFromConfig(conf, mgr)
+		})
 	if err != nil {
 		panic(err)
 	}
@@ -391,18 +454,39 @@ func init() {
 //------------------------------------------------------------------------------
 
 type awkProc struct {
-	codec     string
-	program   *parser.Program
-	log       *service.Logger
-	functions map[string]any
+	codec       string
+	batchMode   bool
+	splitOutput bool
+	jsonOutput  bool
+	program     *parser.Program
+	log         *service.Logger
+	functions   map[string]any
 }
 
-func newAWKProcFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+func newAWKProcFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*awkProc, error) {
 	codec, err := conf.FieldString("codec")
 	if err != nil {
 		return nil, err
 	}
 
+	mode, err := conf.FieldString("mode")
+	if err != nil {
+		return nil, err
+	}
+	if mode == "batch" && codec == "json" {
+		return nil, errors.New("the json codec is not supported in batch mode")
+	}
+
+	outputMode, err := conf.FieldString("output_mode")
+	if err != nil {
+		return nil, err
+	}
+
+	outputCodec, err := conf.FieldString("output_codec")
+	if err != nil {
+		return nil, err
+	}
+
 	programStr, err := conf.FieldString("program")
 	if err != nil {
 		return nil, err
@@ -444,10 +528,13 @@ func newAWKProcFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (s
 		}
 	}
 	a := &awkProc{
-		codec:     codec,
-		program:   program,
-		log:       mgr.Logger(),
-		functions: functionOverrides,
+		codec:       codec,
+		batchMode:   mode == "batch",
+		splitOutput: outputMode == "split",
+		jsonOutput:  outputCodec == "json",
+		program:     program,
+		log:         mgr.Logger(),
+		functions:   functionOverrides,
 	}
 	return a, nil
 }
@@ -636,28 +723,162 @@ func flattenForAWK(path string, data any) map[string]string {
 
 //------------------------------------------------------------------------------
 
-// ProcessMessage applies the processor to a message, either creating >0
-// resulting messages or a response to be sent back to the message source.
+// awkRecordSep separates the records of messages fed into the program in batch
+// mode.
+const awkRecordSep = '\x1e'
+
+// awkCursor tracks the message targeted by functions during an execution of the
+// program.
+type awkCursor struct {
+	batch service.MessageBatch
+	index int
+}
+
+func (c *awkCursor) msg() *service.Message {
+	if c.index < 0 {
+		return c.batch[0]
+	}
+	return c.batch[c.index]
+}
+
+// batchRecordReader feeds each message of a batch into the program as a
+// record. Each call of Read returns at most one record, and as the program
+// doesn't read beyond a complete record before processing it the cursor is
+// moved once the end of a record has been read.
+type batchRecordReader struct {
+	c       *awkCursor
+	text    bool
+	next    int
+	pending []byte
+}
+
+func (r *batchRecordReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		if r.next >= len(r.c.batch) {
+			return 0, io.EOF
+		}
+		var record []byte
+		if r.text {
+			msgBytes, err := r.c.batch[r.next].AsBytes()
+			if err != nil {
+				return 0, err
+			}
+			record = append(record, msgBytes...)
+		}
+		r.pending = append(record, awkRecordSep)
+		r.next++
+	}
+	n := copy(p, r.pending)
+	if r.pending = r.pending[n:]; len(r.pending) == 0 {
+		r.c.index = r.next - 1
+	}
+	return n, nil
+}
+
+type awkLine struct {
+	start, end int
+	msg        *service.Message
+}
+
+// awkOutput collects the output of the program along with the message that
+// was targeted when each line was printed.
+type awkOutput struct {
+	c     *awkCursor
+	buf   bytes.Buffer
+	lines []awkLine
+	start int
+}
+
+func (o *awkOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			_, _ = o.buf.Write(p)
+			break
+		}
+		_, _ = o.buf.Write(p[:i+1])
+		o.lines = append(o.lines, awkLine{start: o.start, end: o.buf.Len() - 1, msg: o.c.msg()})
+		o.start = o.buf.Len()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (a *awkProc) setOutput(msg *service.Message, output []byte) error {
+	if !a.jsonOutput {
+		msg.SetBytes(output)
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(output))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("failed to parse output as JSON: %w", err)
+	}
+	msg.SetStructuredMut(v)
+	return nil
+}
+
+// Process applies the processor to a message, either creating >0 resulting
+// messages or a response to be sent back to the message source.
 func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
-	var mutableJSONPart any
+	return a.run(service.MessageBatch{msg}, false)
+}
+
+func (a *awkProc) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	var res service.MessageBatch
+	if a.batchMode {
+		var err error
+		if res, err = a.run(batch, true); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, msg := range batch {
+			msgRes, err := a.Process(ctx, msg)
+			if err != nil {
+				msg.SetError(err)
+				msgRes = service.MessageBatch{msg}
+			}
+			res = append(res, msgRes...)
+		}
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return []service.MessageBatch{res}, nil
+}
+
+// run executes the program, where the batch has exactly one message unless in
+// batch mode.
+func (a *awkProc) run(batch service.MessageBatch, batchMode bool) (service.MessageBatch, error) {
+	mutableJSONParts := map[*service.Message]any{}
+	cursor := &awkCursor{batch: batch, index: -1}
 
 	customFuncs := make(map[string]any, len(a.functions))
 	for k, v := range a.functions {
 		customFuncs[k] = v
 	}
 
-	var outBuf, errBuf bytes.Buffer
+	var errBuf bytes.Buffer
+	outBuf := &awkOutput{c: cursor}
 
 	// Function overrides
 	customFuncs["metadata_get"] = func(k string) string {
-		v, _ := msg.MetaGet(k)
+		v, _ := cursor.msg().MetaGet(k)
 		return v
 	}
 	customFuncs["metadata_set"] = func(k, v string) {
-		msg.MetaSetMut(k, v)
+		cursor.msg().MetaSetMut(k, v)
 	}
 	customFuncs["json_get"] = func(path string) (string, error) {
-		jsonPart, err := msg.AsStructured()
+		jsonPart, err := cursor.msg().AsStructured()
 		if err != nil {
 			return "", fmt.Errorf("failed to parse message into json: %v", err)
 		}
@@ -673,10 +894,11 @@ func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.Me
 	}
 	getJSON := func() (*gabs.Container, error) {
 		var err error
-		jsonPart := mutableJSONPart
+		msg := cursor.msg()
+		jsonPart := mutableJSONParts[msg]
 		if jsonPart == nil {
 			if jsonPart, err = msg.AsStructuredMut(); err == nil {
-				mutableJSONPart = jsonPart
+				mutableJSONParts[msg] = jsonPart
 			}
 		}
 		if err != nil {
@@ -691,7 +913,7 @@ func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.Me
 			return 0, err
 		}
 		_, _ = gPart.SetP(v, path)
-		msg.SetStructuredMut(gPart.Data())
+		cursor.msg().SetStructuredMut(gPart.Data())
 		return 0, nil
 	}
 	customFuncs["json_set"] = func(path, v string) (int, error) {
@@ -712,7 +934,7 @@ func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.Me
 			return 0, err
 		}
 		_ = gPart.ArrayAppendP(v, path)
-		msg.SetStructuredMut(gPart.Data())
+		cursor.msg().SetStructuredMut(gPart.Data())
 		return 0, nil
 	}
 	customFuncs["json_append"] = func(path, v string) (int, error) {
@@ -733,7 +955,7 @@ func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.Me
 			return 0, err
 		}
 		_ = gObj.DeleteP(path)
-		msg.SetStructuredMut(gObj.Data())
+		cursor.msg().SetStructuredMut(gObj.Data())
 		return 0, nil
 	}
 	customFuncs["json_length"] = func(path string) (int, error) {
@@ -780,12 +1002,16 @@ func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.Me
 	}
 
 	config := &interp.Config{
-		Output: &outBuf,
+		Output: outBuf,
 		Error:  &errBuf,
 		Funcs:  customFuncs,
 	}
 
-	if a.codec == "json" {
+	msg := batch[0]
+	if batchMode {
+		config.Stdin = &batchRecordReader{c: cursor, text: a.codec == "text"}
+		config.Vars = append(config.Vars, "RS", string(awkRecordSep))
+	} else if a.codec == "json" {
 		jsonPart, err := msg.AsStructured()
 		if err != nil {
 			a.log.Errorf("Failed to parse part into json: %v\n", err)
@@ -807,7 +1033,7 @@ func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.Me
 		config.Stdin = bytes.NewReader([]byte(" "))
 	}
 
-	if a.codec != "none" {
+	if a.codec != "none" && !batchMode {
 		_ = msg.MetaWalk(func(k, v string) error {
 			config.Vars = append(config.Vars, varInvalidRegexp.ReplaceAllString(k, "_"), v)
 			return nil
@@ -832,19 +1058,37 @@ func (a *awkProc) Process(ctx context.Context, msg *service.Message) (service.Me
 		return nil, errors.New(string(errMsg))
 	}
 
-	resMsgBytes, err := io.ReadAll(&outBuf)
-	if err != nil {
-		a.log.Errorf("Read output error: %v\n", err)
-		return nil, err
-	}
-	if len(resMsgBytes) > 0 {
-		// Remove trailing line break
-		if resMsgBytes[len(resMsgBytes)-1] == '\n' {
-			resMsgBytes = resMsgBytes[:len(resMsgBytes)-1]
+	if a.splitOutput {
+		if outBuf.start < outBuf.buf.Len() {
+			outBuf.lines = append(outBuf.lines, awkLine{start: outBuf.start, end: outBuf.buf.Len(), msg: cursor.msg()})
+		}
+
+		res := make(service.MessageBatch, 0, len(outBuf.lines))
+		for _, l := range outBuf.lines {
+			lineBytes := make([]byte, l.end-l.start)
+			copy(lineBytes, outBuf.buf.Bytes()[l.start:l.end])
+
+			newMsg := l.msg.Copy()
+			if err := a.setOutput(newMsg, lineBytes); err != nil {
+				return nil, err
+			}
+			res = append(res, newMsg)
 		}
-		msg.SetBytes(resMsgBytes)
+		return res, nil
 	}
 
+	resMsgBytes := outBuf.buf.Bytes()
+	if len(resMsgBytes) == 0 {
+		return batch, nil
+	}
+
+	// Remove trailing line break
+	if resMsgBytes[len(resMsgBytes)-1] == '\n' {
+		resMsgBytes = resMsgBytes[:len(resMsgBytes)-1]
+	}
+	if err := a.setOutput(msg, resMsgBytes); err != nil {
+		return nil, err
+	}
 	return service.MessageBatch{msg}, nil
 }
 
@@ -595,3 +595,136 @@ program: %v
 		assert.Equal(t, string(mBytes), test.output)
 	}
 }
+
+func testAwkBatch(t *testing.T, confStr string, inputs ...string) service.MessageBatch {
+	t.Helper()
+
+	pConf, err := awkSpec().ParseYAML(confStr, nil)
+	require.NoError(t, err)
+
+	a, err := newAWKProcFromConfig(pConf, service.MockResources())
+	require.NoError(t, err)
+
+	var batch service.MessageBatch
+	for i, in := range inputs {
+		msg := service.NewMessage([]byte(in))
+		msg.MetaSetMut("index", strconv.Itoa(i))
+		batch = append(batch, msg)
+	}
+
+	batches, err := a.ProcessBatch(context.Background(), batch)
+	require.NoError(t, err)
+	if len(batches) == 0 {
+		return nil
+	}
+	require.Len(t, batches, 1)
+	return batches[0]
+}
+
+func batchContents(t *testing.T, batch service.MessageBatch) (contents, indexes []string) {
+	t.Helper()
+	for _, m := range batch {
+		require.NoError(t, m.GetError())
+		mBytes, err := m.AsBytes()
+		require.NoError(t, err)
+		contents = append(contents, string(mBytes))
+		index, _ := m.MetaGet("index")
+		indexes = append(indexes, index)
+	}
+	return
+}
+
+func TestAWKBatchMode(t *testing.T) {
+	res := testAwkBatch(t, `
+codec: text
+mode: batch
+program: |
+  { total += $2; count++ }
+  END { print count " records, total " total }
+`, "a 1", "b\n2", "c 3")
+
+	contents, indexes := batchContents(t, res)
+	assert.Equal(t, []string{"3 records, total 6"}, contents)
+	assert.Equal(t, []string{"0"}, indexes)
+
+	// Functions target the message of the current record.
+	res = testAwkBatch(t, `
+codec: none
+mode: batch
+program: |
+  BEGIN { metadata_set("first", "yes") }
+  { json_set("seen", metadata_get("index")) }
+  END { metadata_set("last", "yes") }
+`, `{"id":1}`, `{"id":2}`, `{"id":3}`)
+
+	contents, _ = batchContents(t, res)
+	assert.Equal(t, []string{`{"id":1,"seen":"0"}`, `{"id":2,"seen":"1"}`, `{"id":3,"seen":"2"}`}, contents)
+
+	v, _ := res[0].MetaGet("first")
+	assert.Equal(t, "yes", v)
+	v, _ = res[2].MetaGet("last")
+	assert.Equal(t, "yes", v)
+}
+
+func TestAWKSplitOutput(t *testing.T) {
+	res := testAwkBatch(t, `
+codec: text
+output_mode: split
+program: '{ for (i = 1; i <= NF; i++) print $i }'
+`, "a b", "", "c")
+
+	contents, indexes := batchContents(t, res)
+	assert.Equal(t, []string{"a", "b", "c"}, contents)
+	assert.Equal(t, []string{"0", "0", "2"}, indexes)
+
+	res = testAwkBatch(t, `
+codec: none
+mode: batch
+output_mode: split
+output_codec: json
+program: |
+  { totals[json_get("user")] += json_get("amount") }
+  END {
+    print create_json_object("user", "alice", "total", totals["alice"])
+    printf create_json_object("user", "bob", "total", totals["bob"])
+  }
+`, `{"user":"alice","amount":5}`, `{"user":"bob","amount":3}`, `{"user":"alice","amount":10}`)
+
+	contents, indexes = batchContents(t, res)
+	assert.Equal(t, []string{`{"total":"15","user":"alice"}`, `{"total":"3","user":"bob"}`}, contents)
+	assert.Equal(t, []string{"2", "2"}, indexes)
+
+	v, err := res[0].AsStructured()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"total": "15", "user": "alice"}, v)
+}
+
+func TestAWKOutputErrors(t *testing.T) {
+	pConf, err := awkSpec().ParseYAML(`
+codec: json
+mode: batch
+program: '{ print }'
+`, nil)
+	require.NoError(t, err)
+
+	_, err = newAWKProcFromConfig(pConf, service.MockResources())
+	require.Error(t, err)
+
+	pConf, err = awkSpec().ParseYAML(`
+codec: text
+output_codec: json
+program: '{ print "not json" }'
+`, nil)
+	require.NoError(t, err)
+
+	a, err := newAWKProcFromConfig(pConf, service.MockResources())
+	require.NoError(t, err)
+
+	batches, err := a.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("foo")),
+	})
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+	assert.ErrorContains(t, batches[0][0].GetError(), "failed to parse output as JSON")
+}
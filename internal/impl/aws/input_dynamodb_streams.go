@@ -0,0 +1,802 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gofrs/uuid"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/aws/config"
+)
+
+const (
+	// DynamoDB Streams Input Fields
+	ddbsiFieldTable           = "table"
+	ddbsiFieldCheckpointTable = "checkpoint_table"
+	ddbsiFieldCheckpointLimit = "checkpoint_limit"
+	ddbsiFieldCommitPeriod    = "commit_period"
+	ddbsiFieldLeasePeriod     = "lease_period"
+	ddbsiFieldRebalancePeriod = "rebalance_period"
+	ddbsiFieldStartFromOldest = "start_from_oldest"
+	ddbsiFieldBatching        = "batching"
+)
+
+type ddbsiConfig struct {
+	Table           string
+	CheckpointTable kiddbConfig
+	CheckpointLimit int
+	CommitPeriod    string
+	LeasePeriod     string
+	RebalancePeriod string
+	StartFromOldest bool
+}
+
+func dynamoDBStreamsInputConfigFromParsed(pConf *service.ParsedConfig) (conf ddbsiConfig, err error) {
+	if conf.Table, err = pConf.FieldString(ddbsiFieldTable); err != nil {
+		return
+	}
+	if conf.CheckpointTable, err = kinesisInputDynamoDBConfigFromParsed(pConf.Namespace(ddbsiFieldCheckpointTable)); err != nil {
+		return
+	}
+	if conf.CheckpointLimit, err = pConf.FieldInt(ddbsiFieldCheckpointLimit); err != nil {
+		return
+	}
+	if conf.CommitPeriod, err = pConf.FieldString(ddbsiFieldCommitPeriod); err != nil {
+		return
+	}
+	if conf.LeasePeriod, err = pConf.FieldString(ddbsiFieldLeasePeriod); err != nil {
+		return
+	}
+	if conf.RebalancePeriod, err = pConf.FieldString(ddbsiFieldRebalancePeriod); err != nil {
+		return
+	}
+	if conf.StartFromOldest, err = pConf.FieldBool(ddbsiFieldStartFromOldest); err != nil {
+		return
+	}
+	return
+}
+
+func dynamoDBStreamsInputSpec() *service.ConfigSpec {
+	spec := service.NewConfigSpec().
+		Beta().
+		Version("4.31.0").
+		Categories("Services", "AWS").
+		Summary("Consumes change data capture (CDC) records from the stream of a DynamoDB table.").
+		Description(`
+Consumes the item level changes of a DynamoDB table by reading its stream. Shards of the stream are automatically balanced across other instances of this input, and the lineage of shards is followed so that the records of a parent shard are always consumed before those of its children, which preserves the order of changes made to each item.
+
+The latest record sequence consumed from each shard is stored within a DynamoDB table with the same <<table-schema,schema>> as the `+"`aws_kinesis`"+` input, which allows consumption to resume at the correct sequence during restarts. Redpanda Connect will not store a consumed sequence unless it is acknowledged at the output level, which ensures at-least-once delivery guarantees.
+
+Shards that have been fully consumed are kept within the checkpoint table until they are trimmed from the stream, which happens 24 hours after they are closed.
+
+== Message format
+
+Each record is emitted as a message containing a JSON object with the fields `+"`keys`"+`, `+"`new_image`"+` and `+"`old_image`"+`. The images are only present when the stream view type of the table includes them, and the type of the change is available in the metadata field `+"`dynamodb_event_name`"+`, which is one of `+"`INSERT`"+`, `+"`MODIFY`"+` or `+"`REMOVE`"+`.
+
+Attribute values are converted into plain JSON: numbers are converted into integers when possible, floats when that doesn't lose precision and strings otherwise, sets and lists are converted into arrays, maps are converted into objects and binary values are converted into base64 encoded strings.
+
+== Table schema
+
+It's possible to configure Redpanda Connect to create the DynamoDB table required for checkpointing if it does not already exist. However, if you wish to create this yourself (recommended) then create a table with a string HASH key `+"`StreamID`"+` and a string RANGE key `+"`ShardID`"+`.
+
+== Metadata
+
+This input adds the following metadata fields to each message:
+
+`+"```text"+`
+- dynamodb_table
+- dynamodb_shard
+- dynamodb_event_id
+- dynamodb_event_name
+- dynamodb_sequence_number
+- dynamodb_approximate_creation_time
+- dynamodb_user_identity_principal
+`+"```"+`
+
+The field `+"`dynamodb_user_identity_principal`"+` is only set for records of items deleted by the time to live (TTL) process of the table, in which case it is `+"`dynamodb.amazonaws.com`"+`.
+
+You can access these metadata fields using xref:configuration:interpolation.adoc#bloblang-queries[function interpolation].
+
+== Batching
+
+Use the `+"`batching`"+` fields to configure an optional xref:configuration:batching.adoc#batch-policy[batching policy]. Each shard will be batched separately in order to ensure that acknowledgements aren't contaminated.
+`).Fields(
+		service.NewStringField(ddbsiFieldTable).
+			Description("The table to consume changes from, which must have a stream enabled. Either the name of the table or the full ARN of a specific stream can be provided.").
+			Examples("foo", "arn:aws:dynamodb:us-east-1:111122223333:table/foo/stream/2024-01-01T00:00:00.000"),
+		service.NewObjectField(ddbsiFieldCheckpointTable, kinesisInputDynamoDBFields()...).
+			Description("Determines the table used for storing and accessing the latest consumed sequence for shards, and for coordinating balanced consumers of the stream. The same table can be shared with `aws_kinesis` inputs."),
+		service.NewIntField(ddbsiFieldCheckpointLimit).
+			Description("The maximum gap between the in flight sequence versus the latest acknowledged sequence at a given time. Increasing this limit enables parallel processing and batching at the output level to work on individual shards. Any given sequence will not be committed unless all messages under that offset are delivered in order to preserve at least once delivery guarantees.").
+			Default(1024),
+		service.NewAutoRetryNacksToggleField(),
+		service.NewDurationField(ddbsiFieldCommitPeriod).
+			Description("The period of time between each update to the checkpoint table.").
+			Default("5s"),
+		service.NewDurationField(ddbsiFieldRebalancePeriod).
+			Description("The period of time between each attempt to rebalance shards across clients and to discover new shards.").
+			Default("30s").
+			Advanced(),
+		service.NewDurationField(ddbsiFieldLeasePeriod).
+			Description("The period of time after which a client that has failed to update a shard checkpoint is assumed to be inactive.").
+			Default("30s").
+			Advanced(),
+		service.NewBoolField(ddbsiFieldStartFromOldest).
+			Description("Whether to consume from the oldest record when no checkpoints exist yet for the stream. When `false` shards that are already closed are skipped and open shards are consumed from the latest record.").
+			Default(true),
+	).
+		Fields(config.SessionFields()...).
+		Field(service.NewBatchPolicyField(ddbsiFieldBatching))
+	return spec
+}
+
+func init() {
+	err := service.RegisterBatchInput("aws_dynamodb_streams", dynamoDBStreamsInputSpec(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+			r, err := newDynamoDBStreamsReaderFromParsed(conf, mgr)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacksBatchedToggled(conf, r)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+var awsDynamoDBStreamsDefaultLimit = int32(1000)
+
+type dynamoDBStreamsReader struct {
+	conf     ddbsiConfig
+	clientID string
+
+	sess    aws.Config
+	batcher service.BatchPolicy
+	log     *service.Logger
+	mgr     *service.Resources
+
+	boffPool sync.Pool
+
+	svc          *dynamodbstreams.Client
+	checkpointer *awsKinesisCheckpointer
+
+	streamARN string
+	tableName string
+
+	// Shards that should be consumed from the latest record when they have no
+	// checkpoint, which is only populated on the first run against a stream
+	// when start_from_oldest is false.
+	latestShards map[string]struct{}
+
+	commitPeriod    time.Duration
+	leasePeriod     time.Duration
+	rebalancePeriod time.Duration
+
+	cMut    sync.Mutex
+	msgChan chan asyncMessage
+
+	ctx  context.Context
+	done func()
+
+	closeOnce  sync.Once
+	closedChan chan struct{}
+}
+
+func newDynamoDBStreamsReaderFromParsed(pConf *service.ParsedConfig, mgr *service.Resources) (*dynamoDBStreamsReader, error) {
+	conf, err := dynamoDBStreamsInputConfigFromParsed(pConf)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := GetSession(context.TODO(), pConf)
+	if err != nil {
+		return nil, err
+	}
+	batcher, err := pConf.FieldBatchPolicy(ddbsiFieldBatching)
+	if err != nil {
+		return nil, err
+	}
+	return newDynamoDBStreamsReaderFromConfig(conf, batcher, sess, mgr)
+}
+
+func newDynamoDBStreamsReaderFromConfig(conf ddbsiConfig, batcher service.BatchPolicy, sess aws.Config, mgr *service.Resources) (*dynamoDBStreamsReader, error) {
+	if batcher.IsNoop() {
+		batcher.Count = 1
+	}
+	if conf.Table == "" {
+		return nil, errors.New("a table must be specified")
+	}
+
+	d := dynamoDBStreamsReader{
+		conf:         conf,
+		sess:         sess,
+		batcher:      batcher,
+		log:          mgr.Logger(),
+		mgr:          mgr,
+		latestShards: map[string]struct{}{},
+		closedChan:   make(chan struct{}),
+	}
+	d.ctx, d.done = context.WithCancel(context.Background())
+
+	u4, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	d.clientID = u4.String()
+
+	d.boffPool = sync.Pool{
+		New: func() any {
+			boff := backoff.NewExponentialBackOff()
+			boff.InitialInterval = time.Millisecond * 300
+			boff.MaxInterval = time.Second * 5
+			boff.MaxElapsedTime = 0
+			return boff
+		},
+	}
+
+	if d.commitPeriod, err = time.ParseDuration(d.conf.CommitPeriod); err != nil {
+		return nil, fmt.Errorf("failed to parse commit period string: %v", err)
+	}
+	if d.leasePeriod, err = time.ParseDuration(d.conf.LeasePeriod); err != nil {
+		return nil, fmt.Errorf("failed to parse lease period string: %v", err)
+	}
+	if d.rebalancePeriod, err = time.ParseDuration(d.conf.RebalancePeriod); err != nil {
+		return nil, fmt.Errorf("failed to parse rebalance period string: %v", err)
+	}
+	return &d, nil
+}
+
+//------------------------------------------------------------------------------
+
+// dynamoDBStreamsAttributeToAny converts a DynamoDB attribute value into a
+// plain value that can be serialised as JSON.
+func dynamoDBStreamsAttributeToAny(av types.AttributeValue) any {
+	switch t := av.(type) {
+	case *types.AttributeValueMemberS:
+		return t.Value
+	case *types.AttributeValueMemberN:
+		return dynamoDBStreamsNumberToAny(t.Value)
+	case *types.AttributeValueMemberB:
+		return t.Value
+	case *types.AttributeValueMemberBOOL:
+		return t.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	case *types.AttributeValueMemberSS:
+		lAny := make([]any, len(t.Value))
+		for i, v := range t.Value {
+			lAny[i] = v
+		}
+		return lAny
+	case *types.AttributeValueMemberNS:
+		lAny := make([]any, len(t.Value))
+		for i, v := range t.Value {
+			lAny[i] = dynamoDBStreamsNumberToAny(v)
+		}
+		return lAny
+	case *types.AttributeValueMemberBS:
+		lAny := make([]any, len(t.Value))
+		for i, v := range t.Value {
+			lAny[i] = v
+		}
+		return lAny
+	case *types.AttributeValueMemberL:
+		lAny := make([]any, len(t.Value))
+		for i, v := range t.Value {
+			lAny[i] = dynamoDBStreamsAttributeToAny(v)
+		}
+		return lAny
+	case *types.AttributeValueMemberM:
+		return dynamoDBStreamsAttributesToMap(t.Value)
+	}
+	return nil
+}
+
+// DynamoDB numbers have up to 38 digits of precision, numbers that can't be
+// represented exactly as an int64 or float64 are kept as strings.
+func dynamoDBStreamsNumberToAny(n string) any {
+	if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+		return i
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return n
+	}
+
+	// The shortest representation of the float must be the same decimal as
+	// the original number, otherwise digits were lost in the conversion.
+	exact, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return n
+	}
+	if rounded, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64)); !ok || rounded.Cmp(exact) != 0 {
+		return n
+	}
+	return f
+}
+
+func dynamoDBStreamsAttributesToMap(m map[string]types.AttributeValue) map[string]any {
+	mAny := make(map[string]any, len(m))
+	for k, v := range m {
+		mAny[k] = dynamoDBStreamsAttributeToAny(v)
+	}
+	return mAny
+}
+
+func dynamoDBStreamsRecordToMessage(tableName, shardID string, r types.Record) *service.Message {
+	body := map[string]any{}
+	msg := service.NewMessage(nil)
+	msg.MetaSetMut("dynamodb_table", tableName)
+	msg.MetaSetMut("dynamodb_shard", shardID)
+	if r.EventID != nil {
+		msg.MetaSetMut("dynamodb_event_id", *r.EventID)
+	}
+	msg.MetaSetMut("dynamodb_event_name", string(r.EventName))
+	if r.UserIdentity != nil && r.UserIdentity.PrincipalId != nil {
+		msg.MetaSetMut("dynamodb_user_identity_principal", *r.UserIdentity.PrincipalId)
+	}
+	if sr := r.Dynamodb; sr != nil {
+		if sr.SequenceNumber != nil {
+			msg.MetaSetMut("dynamodb_sequence_number", *sr.SequenceNumber)
+		}
+		if sr.ApproximateCreationDateTime != nil {
+			msg.MetaSetMut("dynamodb_approximate_creation_time", sr.ApproximateCreationDateTime.Format(time.RFC3339))
+		}
+		body["keys"] = dynamoDBStreamsAttributesToMap(sr.Keys)
+		if sr.NewImage != nil {
+			body["new_image"] = dynamoDBStreamsAttributesToMap(sr.NewImage)
+		}
+		if sr.OldImage != nil {
+			body["old_image"] = dynamoDBStreamsAttributesToMap(sr.OldImage)
+		}
+	}
+	msg.SetStructuredMut(body)
+	return msg
+}
+
+//------------------------------------------------------------------------------
+
+// dynamoDBStreamsReadyShards returns the shards of a stream that are ready to
+// be consumed, which are the shards that have not been fully consumed and
+// whose parent has either been fully consumed or is no longer part of the
+// stream.
+func dynamoDBStreamsReadyShards(shards []types.Shard, finished map[string]struct{}) []types.Shard {
+	listed := make(map[string]struct{}, len(shards))
+	for _, s := range shards {
+		listed[*s.ShardId] = struct{}{}
+	}
+
+	var ready []types.Shard
+	for _, s := range shards {
+		if _, done := finished[*s.ShardId]; done {
+			continue
+		}
+		if s.ParentShardId != nil {
+			_, parentListed := listed[*s.ParentShardId]
+			_, parentDone := finished[*s.ParentShardId]
+			if parentListed && !parentDone {
+				continue
+			}
+		}
+		ready = append(ready, s)
+	}
+	return ready
+}
+
+func isDynamoDBStreamsShardClosed(s types.Shard) bool {
+	return s.SequenceNumberRange != nil && s.SequenceNumberRange.EndingSequenceNumber != nil
+}
+
+func (d *dynamoDBStreamsReader) describeShards(ctx context.Context) ([]types.Shard, error) {
+	var shards []types.Shard
+	var startShardID *string
+	for {
+		res, err := d.svc.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             &d.streamARN,
+			ExclusiveStartShardId: startShardID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, res.StreamDescription.Shards...)
+		if startShardID = res.StreamDescription.LastEvaluatedShardId; startShardID == nil {
+			return shards, nil
+		}
+	}
+}
+
+// initLatest prepares the first run of a consumer group that begins at the
+// latest records of a stream by marking all closed shards as finished, and
+// noting the open shards that should be consumed from their latest record.
+func (d *dynamoDBStreamsReader) initLatest(ctx context.Context) error {
+	hasCheckpoints, err := d.checkpointer.HasCheckpoints(ctx, d.streamARN)
+	if err != nil || hasCheckpoints {
+		return err
+	}
+
+	shards, err := d.describeShards(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range shards {
+		if isDynamoDBStreamsShardClosed(s) {
+			if err := d.checkpointer.MarkFinished(ctx, d.streamARN, *s.ShardId); err != nil {
+				return err
+			}
+		} else {
+			d.latestShards[*s.ShardId] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (d *dynamoDBStreamsReader) getIter(shardID, sequence string) (string, error) {
+	iterType := types.ShardIteratorTypeTrimHorizon
+	if _, exists := d.latestShards[shardID]; exists {
+		iterType = types.ShardIteratorTypeLatest
+	}
+	var startingSequence *string
+	if sequence != "" {
+		iterType = types.ShardIteratorTypeAfterSequenceNumber
+		startingSequence = &sequence
+	}
+
+	res, err := d.svc.GetShardIterator(d.ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         &d.streamARN,
+		ShardId:           &shardID,
+		SequenceNumber:    startingSequence,
+		ShardIteratorType: iterType,
+	})
+	if err != nil {
+		return "", err
+	}
+	if res.ShardIterator == nil || *res.ShardIterator == "" {
+		return "", errors.New("failed to obtain shard iterator")
+	}
+	return *res.ShardIterator, nil
+}
+
+// The returned shard iterator will always be the input iterator when the error
+// parameter is not nil, and is empty when the end of a closed shard has been
+// reached.
+func (d *dynamoDBStreamsReader) getRecords(shardIter string) ([]types.Record, string, error) {
+	res, err := d.svc.GetRecords(d.ctx, &dynamodbstreams.GetRecordsInput{
+		Limit:         &awsDynamoDBStreamsDefaultLimit,
+		ShardIterator: &shardIter,
+	})
+	if err != nil {
+		return nil, shardIter, err
+	}
+
+	nextIter := ""
+	if res.NextShardIterator != nil {
+		nextIter = *res.NextShardIterator
+	}
+	return res.Records, nextIter, nil
+}
+
+func (d *dynamoDBStreamsReader) runConsumer(wg *sync.WaitGroup, shardID, startingSequence string) (initErr error) {
+	defer func() {
+		if initErr != nil {
+			wg.Done()
+			if _, err := d.checkpointer.Checkpoint(context.Background(), d.streamARN, shardID, startingSequence, true); err != nil {
+				d.log.Errorf("Failed to gracefully yield checkpoint: %v", err)
+			}
+		}
+	}()
+
+	var recordBatcher *awsKinesisRecordBatcher
+	if recordBatcher, initErr = newAWSKinesisRecordBatcher(d.batcher, d.mgr, d.conf.CheckpointLimit, d.streamARN, shardID, startingSequence); initErr != nil {
+		return initErr
+	}
+
+	var iter string
+	if iter, initErr = d.getIter(shardID, startingSequence); initErr != nil {
+		return initErr
+	}
+
+	consumer := &awsShardConsumer[types.Record]{
+		ctx:          d.ctx,
+		log:          d.log,
+		clientID:     d.clientID,
+		checkpointer: d.checkpointer,
+		boffPool:     &d.boffPool,
+		commitPeriod: d.commitPeriod,
+		msgChan:      d.msgChan,
+		streamType:   "DynamoDB",
+		streamID:     d.streamARN,
+		shardID:      shardID,
+		source: &dynamoDBStreamsShardSource{
+			d:       d,
+			shardID: shardID,
+			iter:    iter,
+		},
+		batcher: recordBatcher,
+		addRecord: func(r types.Record) bool {
+			var sequence string
+			if r.Dynamodb != nil && r.Dynamodb.SequenceNumber != nil {
+				sequence = *r.Dynamodb.SequenceNumber
+			}
+			return recordBatcher.AddMessage(dynamoDBStreamsRecordToMessage(d.tableName, shardID, r), sequence)
+		},
+		finish: func(ctx context.Context) error {
+			// Finished shards keep their checkpoint so that their children
+			// can be consumed once they're done.
+			_, err := d.checkpointer.Checkpoint(ctx, d.streamARN, shardID, shardEndSequence, true)
+			return err
+		},
+	}
+	consumer.run(wg)
+	return nil
+}
+
+// dynamoDBStreamsShardSource pulls records from a shard with GetRecords.
+type dynamoDBStreamsShardSource struct {
+	d       *dynamoDBStreamsReader
+	shardID string
+	iter    string
+}
+
+func (p *dynamoDBStreamsShardSource) Pull(ackedSequence string) ([]types.Record, bool, error) {
+	records, iter, err := p.d.getRecords(p.iter)
+	if err != nil {
+		var expiredErr *types.ExpiredIteratorException
+		var trimmedErr *types.TrimmedDataAccessException
+		switch {
+		case errors.As(err, &expiredErr):
+			p.d.log.Warn("Shard iterator expired, attempting to refresh")
+		case errors.As(err, &trimmedErr):
+			p.d.log.Warnf("Records of stream '%v' shard '%v' were trimmed before being consumed, resuming from the oldest record", p.d.streamARN, p.shardID)
+			ackedSequence = ""
+		default:
+			return nil, false, err
+		}
+		if iter, err = p.d.getIter(p.shardID, ackedSequence); err != nil {
+			return nil, false, fmt.Errorf("failed to refresh shard iterator: %w", err)
+		}
+	}
+	p.iter = iter
+
+	// The getRecords method returns the input iterator whenever it errors
+	// out, and therefore an empty iterator means the end of the shard.
+	return records, p.iter == "", nil
+}
+
+func (p *dynamoDBStreamsShardSource) WaitChan(boff backoff.BackOff) <-chan time.Time {
+	return time.After(boff.NextBackOff())
+}
+
+func (p *dynamoDBStreamsShardSource) Close() {}
+
+//------------------------------------------------------------------------------
+
+func (d *dynamoDBStreamsReader) claimAndRun(wg *sync.WaitGroup, shardID, fromClientID string) (bool, error) {
+	sequence, err := d.checkpointer.Claim(d.ctx, d.streamARN, shardID, fromClientID)
+	if err != nil {
+		return false, err
+	}
+	if sequence == shardEndSequence {
+		// The shard was finished by another client since we last looked, so
+		// release it again.
+		_, err = d.checkpointer.Checkpoint(d.ctx, d.streamARN, shardID, shardEndSequence, true)
+		return false, err
+	}
+	wg.Add(1)
+	if err = d.runConsumer(wg, shardID, sequence); err != nil {
+		return false, fmt.Errorf("failed to start consumer: %w", err)
+	}
+	return true, nil
+}
+
+func (d *dynamoDBStreamsReader) runBalancedShards() {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		d.closeOnce.Do(func() {
+			close(d.msgChan)
+			close(d.closedChan)
+		})
+	}()
+
+	if !d.conf.StartFromOldest {
+		for {
+			err := d.initLatest(d.ctx)
+			if err == nil {
+				break
+			}
+			if d.ctx.Err() != nil {
+				return
+			}
+			d.log.Errorf("Failed to initialise stream '%v' checkpoints: %v", d.streamARN, err)
+			select {
+			case <-time.After(time.Second):
+			case <-d.ctx.Done():
+				return
+			}
+		}
+	}
+
+	for {
+		shards, err := d.describeShards(d.ctx)
+
+		var finished map[string]struct{}
+		if err == nil {
+			finished, err = d.checkpointer.FinishedShards(d.ctx, d.streamARN)
+		}
+		var clientClaims map[string][]awsKinesisClientClaim
+		if err == nil {
+			clientClaims, err = d.checkpointer.AllClaims(d.ctx, d.streamARN)
+		}
+		if err != nil {
+			if d.ctx.Err() != nil {
+				return
+			}
+			d.log.Errorf("Failed to obtain stream '%v' shards or claims: %v", d.streamARN, err)
+		} else {
+			d.balanceShards(&wg, shards, finished, clientClaims)
+		}
+
+		select {
+		case <-time.After(d.rebalancePeriod):
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *dynamoDBStreamsReader) balanceShards(
+	wg *sync.WaitGroup,
+	shards []types.Shard,
+	finished map[string]struct{},
+	clientClaims map[string][]awsKinesisClientClaim,
+) {
+	// Checkpoints of finished shards are only needed until the shard is
+	// trimmed from the stream, at which point its children no longer depend
+	// on it.
+	listed := make(map[string]struct{}, len(shards))
+	for _, s := range shards {
+		listed[*s.ShardId] = struct{}{}
+	}
+	for shardID := range finished {
+		if _, exists := listed[shardID]; !exists {
+			if err := d.checkpointer.Delete(d.ctx, d.streamARN, shardID); err != nil {
+				d.log.Errorf("Failed to remove checkpoint for trimmed stream '%v' shard '%v': %v", d.streamARN, shardID, err)
+			}
+		}
+	}
+
+	ready := dynamoDBStreamsReadyShards(shards, finished)
+	unclaimedShards := make(map[string]string, len(ready))
+	for _, s := range ready {
+		unclaimedShards[*s.ShardId] = ""
+	}
+	for clientID, claims := range clientClaims {
+		for _, claim := range claims {
+			if _, isReady := unclaimedShards[claim.ShardID]; !isReady {
+				continue
+			}
+			if time.Since(claim.LeaseTimeout) > d.leasePeriod*2 {
+				unclaimedShards[claim.ShardID] = clientID
+			} else {
+				delete(unclaimedShards, claim.ShardID)
+			}
+		}
+	}
+
+	balanceShardClaims(d.ctx, d.log, d.clientID, d.streamARN, unclaimedShards, clientClaims, func(shardID, fromClientID string) (bool, error) {
+		return d.claimAndRun(wg, shardID, fromClientID)
+	})
+}
+
+// resolveStream obtains the ARN of the latest stream of the configured table,
+// or the table name of an explicitly configured stream ARN.
+func (d *dynamoDBStreamsReader) resolveStream(ctx context.Context) error {
+	if strings.HasPrefix(d.conf.Table, "arn:") {
+		d.streamARN = d.conf.Table
+
+		// arn:aws:dynamodb:region:account:table/name/stream/label
+		_, resource, _ := strings.Cut(d.streamARN, ":table/")
+		d.tableName, _, _ = strings.Cut(resource, "/")
+		return nil
+	}
+
+	d.tableName = d.conf.Table
+	res, err := dynamodb.NewFromConfig(d.sess).DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: &d.tableName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe table '%v': %w", d.tableName, err)
+	}
+	if res.Table.LatestStreamArn == nil {
+		return fmt.Errorf("table '%v' does not have a stream enabled", d.tableName)
+	}
+	d.streamARN = *res.Table.LatestStreamArn
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// Connect establishes a dynamoDBStreamsReader connection.
+func (d *dynamoDBStreamsReader) Connect(ctx context.Context) error {
+	d.cMut.Lock()
+	defer d.cMut.Unlock()
+	if d.msgChan != nil {
+		return nil
+	}
+
+	if err := d.resolveStream(ctx); err != nil {
+		return err
+	}
+
+	checkpointer, err := newAWSKinesisCheckpointer(d.sess, d.clientID, d.conf.CheckpointTable, d.leasePeriod, d.commitPeriod)
+	if err != nil {
+		return err
+	}
+
+	d.svc = dynamodbstreams.NewFromConfig(d.sess)
+	d.checkpointer = checkpointer
+	d.msgChan = make(chan asyncMessage)
+
+	go d.runBalancedShards()
+	return nil
+}
+
+// ReadBatch attempts to read a message from the DynamoDB stream.
+func (d *dynamoDBStreamsReader) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	d.cMut.Lock()
+	msgChan := d.msgChan
+	d.cMut.Unlock()
+
+	if msgChan == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	select {
+	case m, open := <-msgChan:
+		if !open {
+			return nil, nil, service.ErrNotConnected
+		}
+		return m.msg, m.ackFn, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// Close shuts down the DynamoDB Streams input and stops processing requests.
+func (d *dynamoDBStreamsReader) Close(ctx context.Context) error {
+	d.done()
+	select {
+	case <-d.closedChan:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
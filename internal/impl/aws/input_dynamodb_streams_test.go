@@ -0,0 +1,196 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamoDBStreamsAttributeConversion(t *testing.T) {
+	attrs := map[string]types.AttributeValue{
+		"s":     &types.AttributeValueMemberS{Value: "foo"},
+		"int":   &types.AttributeValueMemberN{Value: "42"},
+		"float": &types.AttributeValueMemberN{Value: "4.2"},
+		"huge":  &types.AttributeValueMemberN{Value: "123456789012345678901234567890"},
+		"max":   &types.AttributeValueMemberN{Value: "12345678901234567890123456789012345678"},
+		"tiny":  &types.AttributeValueMemberN{Value: "0.12345678901234567890123456789012345678"},
+		"exp":   &types.AttributeValueMemberN{Value: "1.5E+40"},
+		"b":     &types.AttributeValueMemberB{Value: []byte("bar")},
+		"bool":  &types.AttributeValueMemberBOOL{Value: true},
+		"null":  &types.AttributeValueMemberNULL{Value: true},
+		"ss":    &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"ns":    &types.AttributeValueMemberNS{Value: []string{"1", "2.5"}},
+		"bs":    &types.AttributeValueMemberBS{Value: [][]byte{[]byte("c")}},
+		"l": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "d"},
+			&types.AttributeValueMemberN{Value: "3"},
+		}},
+		"m": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"nested": &types.AttributeValueMemberBOOL{Value: false},
+		}},
+	}
+
+	assert.Equal(t, map[string]any{
+		"s":     "foo",
+		"int":   int64(42),
+		"float": 4.2,
+		"huge":  "123456789012345678901234567890",
+		"max":   "12345678901234567890123456789012345678",
+		"tiny":  "0.12345678901234567890123456789012345678",
+		"exp":   1.5e+40,
+		"b":     []byte("bar"),
+		"bool":  true,
+		"null":  nil,
+		"ss":    []any{"a", "b"},
+		"ns":    []any{int64(1), 2.5},
+		"bs":    []any{[]byte("c")},
+		"l":     []any{"d", int64(3)},
+		"m":     map[string]any{"nested": false},
+	}, dynamoDBStreamsAttributesToMap(attrs))
+}
+
+func TestDynamoDBStreamsRecordToMessage(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	msg := dynamoDBStreamsRecordToMessage("foo", "shard-1", types.Record{
+		EventID:   aws.String("event-1"),
+		EventName: types.OperationTypeModify,
+		Dynamodb: &types.StreamRecord{
+			ApproximateCreationDateTime: &created,
+			SequenceNumber:              aws.String("100"),
+			Keys: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: "a"},
+			},
+			NewImage: map[string]types.AttributeValue{
+				"id":    &types.AttributeValueMemberS{Value: "a"},
+				"count": &types.AttributeValueMemberN{Value: "2"},
+			},
+			OldImage: map[string]types.AttributeValue{
+				"id":    &types.AttributeValueMemberS{Value: "a"},
+				"count": &types.AttributeValueMemberN{Value: "1"},
+			},
+		},
+	})
+
+	mBytes, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "keys": {"id": "a"},
+  "new_image": {"id": "a", "count": 2},
+  "old_image": {"id": "a", "count": 1}
+}`, string(mBytes))
+
+	for k, exp := range map[string]string{
+		"dynamodb_table":                     "foo",
+		"dynamodb_shard":                     "shard-1",
+		"dynamodb_event_id":                  "event-1",
+		"dynamodb_event_name":                "MODIFY",
+		"dynamodb_sequence_number":           "100",
+		"dynamodb_approximate_creation_time": "2024-03-01T12:00:00Z",
+	} {
+		v, exists := msg.MetaGet(k)
+		assert.True(t, exists, k)
+		assert.Equal(t, exp, v, k)
+	}
+	_, exists := msg.MetaGet("dynamodb_user_identity_principal")
+	assert.False(t, exists)
+
+	msg = dynamoDBStreamsRecordToMessage("foo", "shard-1", types.Record{
+		EventName: types.OperationTypeRemove,
+		UserIdentity: &types.Identity{
+			PrincipalId: aws.String("dynamodb.amazonaws.com"),
+			Type:        aws.String("Service"),
+		},
+		Dynamodb: &types.StreamRecord{
+			SequenceNumber: aws.String("101"),
+			Keys: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: "a"},
+			},
+		},
+	})
+
+	mBytes, err = msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"keys":{"id":"a"}}`, string(mBytes))
+
+	v, _ := msg.MetaGet("dynamodb_user_identity_principal")
+	assert.Equal(t, "dynamodb.amazonaws.com", v)
+}
+
+func TestDynamoDBStreamsReadyShards(t *testing.T) {
+	shard := func(id, parent string) types.Shard {
+		s := types.Shard{ShardId: aws.String(id)}
+		if parent != "" {
+			s.ParentShardId = aws.String(parent)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		shards   []types.Shard
+		finished []string
+		ready    []string
+	}{
+		{
+			name:   "roots only",
+			shards: []types.Shard{shard("a", ""), shard("b", "")},
+			ready:  []string{"a", "b"},
+		},
+		{
+			name:   "child waits for parent",
+			shards: []types.Shard{shard("a", ""), shard("b", "a"), shard("c", "b")},
+			ready:  []string{"a"},
+		},
+		{
+			name:     "child of finished parent",
+			shards:   []types.Shard{shard("a", ""), shard("b", "a"), shard("c", "b")},
+			finished: []string{"a"},
+			ready:    []string{"b"},
+		},
+		{
+			name:   "parent trimmed",
+			shards: []types.Shard{shard("b", "a"), shard("c", "b")},
+			ready:  []string{"b"},
+		},
+		{
+			name:     "all finished",
+			shards:   []types.Shard{shard("a", ""), shard("b", "a")},
+			finished: []string{"a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			finished := map[string]struct{}{}
+			for _, id := range test.finished {
+				finished[id] = struct{}{}
+			}
+
+			var ready []string
+			for _, s := range dynamoDBStreamsReadyShards(test.shards, finished) {
+				ready = append(ready, *s.ShardId)
+			}
+			assert.Equal(t, test.ready, ready)
+		})
+	}
+}
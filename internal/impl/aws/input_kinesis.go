@@ -18,7 +18,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"strings"
 	"sync"
 	"time"
@@ -41,6 +40,11 @@ const (
 	kiddbFieldReadCapacityUnits  = "read_capacity_units"
 	kiddbFieldWriteCapacityUnits = "write_capacity_units"
 	kiddbFieldBillingMode        = "billing_mode"
+	kiddbFieldKCLCompatible      = "kcl_compatible"
+
+	// Kinesis Input Enhanced Fan-Out Fields
+	kiefoFieldEnabled      = "enabled"
+	kiefoFieldConsumerName = "consumer_name"
 
 	// Kinesis Input Fields
 	kiFieldDynamoDB        = "dynamodb"
@@ -51,8 +55,15 @@ const (
 	kiFieldRebalancePeriod = "rebalance_period"
 	kiFieldStartFromOldest = "start_from_oldest"
 	kiFieldBatching        = "batching"
+	kiFieldEnhancedFanOut  = "enhanced_fan_out"
+	kiFieldDeaggregate     = "deaggregate_records"
 )
 
+type kiefoConfig struct {
+	Enabled      bool
+	ConsumerName string
+}
+
 type kiConfig struct {
 	Streams         []string
 	DynamoDB        kiddbConfig
@@ -61,6 +72,8 @@ type kiConfig struct {
 	LeasePeriod     string
 	RebalancePeriod string
 	StartFromOldest bool
+	EnhancedFanOut  kiefoConfig
+	Deaggregate     bool
 }
 
 func kinesisInputConfigFromParsed(pConf *service.ParsedConfig) (conf kiConfig, err error) {
@@ -71,6 +84,9 @@ func kinesisInputConfigFromParsed(pConf *service.ParsedConfig) (conf kiConfig, e
 		if conf.DynamoDB, err = kinesisInputDynamoDBConfigFromParsed(pConf.Namespace(kiFieldDynamoDB)); err != nil {
 			return
 		}
+		if conf.DynamoDB.KCLCompatible, err = pConf.FieldBool(kiFieldDynamoDB, kiddbFieldKCLCompatible); err != nil {
+			return
+		}
 	}
 	if conf.CheckpointLimit, err = pConf.FieldInt(kiFieldCheckpointLimit); err != nil {
 		return
@@ -87,6 +103,15 @@ func kinesisInputConfigFromParsed(pConf *service.ParsedConfig) (conf kiConfig, e
 	if conf.StartFromOldest, err = pConf.FieldBool(kiFieldStartFromOldest); err != nil {
 		return
 	}
+	if conf.EnhancedFanOut.Enabled, err = pConf.FieldBool(kiFieldEnhancedFanOut, kiefoFieldEnabled); err != nil {
+		return
+	}
+	if conf.EnhancedFanOut.ConsumerName, err = pConf.FieldString(kiFieldEnhancedFanOut, kiefoFieldConsumerName); err != nil {
+		return
+	}
+	if conf.Deaggregate, err = pConf.FieldBool(kiFieldDeaggregate); err != nil {
+		return
+	}
 	return
 }
 
@@ -109,6 +134,20 @@ By default messages of a shard can be processed in parallel, up to a limit deter
 
 It's possible to configure Redpanda Connect to create the DynamoDB table required for coordination if it does not already exist. However, if you wish to create this yourself (recommended) then create a table with a string HASH key `+"`StreamID`"+` and a string RANGE key `+"`ShardID`"+`.
 
+=== KCL compatibility
+
+When the field `+"`dynamodb.kcl_compatible`"+` is set to `+"`true`"+` checkpoints are instead stored within a lease table of the Kinesis Client Library (KCL) v2, where the table name is the application name of the KCL application. This allows this input to take over the shards of a KCL application without reprocessing records, and vice versa. Only a single stream can be consumed when using a KCL lease table, as the multi stream mode of the KCL is not supported. KCL applications consider a lease lost when it hasn't been renewed within their failover time (10 seconds by default), and leases are renewed by this input with each checkpoint, therefore the `+"`commit_period`"+` should be set lower than the failover time of any KCL applications sharing the table.
+
+As with the KCL, the shards of a resharded stream are consumed in order of their lineage: a closed shard is consumed until its lease is checkpointed as `+"`SHARD_END`"+`, and a child shard is only consumed once its parent shards are finished, starting from its oldest record.
+
+== Enhanced fan-out
+
+By default records are polled from shards, where the read throughput of a shard (2MB/s) is shared with all other consumers of the stream. When `+"`enhanced_fan_out.enabled`"+` is set to `+"`true`"+` this input instead registers a stream consumer with the name `+"`enhanced_fan_out.consumer_name`"+`, or uses the existing consumer of that name, and records are pushed to it with a dedicated throughput for each shard. All instances of this input that share a checkpoint table should use the same consumer name. Registered consumers are not deregistered when this input shuts down.
+
+== Aggregated records
+
+Records aggregated with the Kinesis Producer Library (KPL) aggregation format, such as those produced by the KPL or the `+"`aws_kinesis`"+` output with `+"`aggregation.enabled`"+` set to `+"`true`"+`, can be consumed as individual messages by setting `+"`deaggregate_records`"+` to `+"`true`"+`. Each message of an aggregated record shares the sequence number of that record, with the metadata field `+"`kinesis_sub_sequence_number`"+` holding its position within the record. Batches are flushed part way through an aggregated record when the batching policy is met, and the position within the record is committed along with its sequence so that consumption resumes from the remaining messages of the record. Records that are not aggregated are consumed as they are.
+
 == Batching
 
 Use the `+"`batching`"+` fields to configure an optional xref:configuration:batching.adoc#batch-policy[batching policy]. Each stream shard will be batched separately in order to ensure that acknowledgements aren't contaminated.
@@ -116,26 +155,13 @@ Use the `+"`batching`"+` fields to configure an optional xref:configuration:batc
 		service.NewStringListField(kiFieldStreams).
 			Description("One or more Kinesis data streams to consume from. Streams can either be specified by their name or full ARN. Shards of a stream are automatically balanced across consumers by coordinating through the provided DynamoDB table. Multiple comma separated streams can be listed in a single element. Shards are automatically distributed across consumers of a stream by coordinating through the provided DynamoDB table. Alternatively, it's possible to specify an explicit shard to consume from with a colon after the stream name, e.g. `foo:0` would consume the shard `0` of the stream `foo`.").
 			Examples([]any{"foo", "arn:aws:kinesis:*:111122223333:stream/my-stream"}),
-		service.NewObjectField(kiFieldDynamoDB,
-			service.NewStringField(kiddbFieldTable).
-				Description("The name of the table to access.").
-				Default(""),
-			service.NewBoolField(kiddbFieldCreate).
-				Description("Whether, if the table does not exist, it should be created.").
-				Default(false),
-			service.NewStringEnumField(kiddbFieldBillingMode, "PROVISIONED", "PAY_PER_REQUEST").
-				Description("When creating the table determines the billing mode.").
-				Default("PAY_PER_REQUEST").
-				Advanced(),
-			service.NewIntField(kiddbFieldReadCapacityUnits).
-				Description("Set the provisioned read capacity when creating the table with a `billing_mode` of `PROVISIONED`.").
-				Default(0).
+		service.NewObjectField(kiFieldDynamoDB, append(kinesisInputDynamoDBFields(),
+			service.NewBoolField(kiddbFieldKCLCompatible).
+				Description("Whether the table is a lease table of the Kinesis Client Library (KCL) v2, which allows shards to be shared with KCL applications. Leases of the KCL do not include an expiry, and therefore a lease is considered expired once its counter has not changed for the `lease_period` since it was first observed by this input, and an expired lease is claimed after a further two lease periods. Taking over the shards of a stopped KCL application therefore takes roughly three times the `lease_period`, plus up to a `rebalance_period`.").
+				Version("4.31.0").
+				Default(false).
 				Advanced(),
-			service.NewIntField(kiddbFieldWriteCapacityUnits).
-				Description("Set the provisioned write capacity when creating the table with a `billing_mode` of `PROVISIONED`.").
-				Default(0).
-				Advanced(),
-		).
+		)...).
 			Description("Determines the table used for storing and accessing the latest consumed sequence for shards, and for coordinating balanced consumers of streams."),
 		service.NewIntField(kiFieldCheckpointLimit).
 			Description("The maximum gap between the in flight sequence versus the latest acknowledged sequence at a given time. Increasing this limit enables parallel processing and batching at the output level to work on individual shards. Any given sequence will not be committed unless all messages under that offset are delivered in order to preserve at least once delivery guarantees.").
@@ -155,6 +181,22 @@ Use the `+"`batching`"+` fields to configure an optional xref:configuration:batc
 		service.NewBoolField(kiFieldStartFromOldest).
 			Description("Whether to consume from the oldest message when a sequence does not yet exist for the stream.").
 			Default(true),
+		service.NewObjectField(kiFieldEnhancedFanOut,
+			service.NewBoolField(kiefoFieldEnabled).
+				Description("Whether to consume shards with enhanced fan-out, where records are pushed to a registered stream consumer with a dedicated throughput for each shard.").
+				Default(false),
+			service.NewStringField(kiefoFieldConsumerName).
+				Description("The name of the stream consumer to register, or use when it already exists.").
+				Default(""),
+		).
+			Description("Enhanced fan-out consumption of shards.").
+			Version("4.31.0").
+			Advanced(),
+		service.NewBoolField(kiFieldDeaggregate).
+			Description("Whether to split records aggregated with the Kinesis Producer Library (KPL) aggregation format into individual messages.").
+			Version("4.31.0").
+			Default(false).
+			Advanced(),
 	).
 		Fields(config.SessionFields()...).
 		Field(service.NewBatchPolicyField(kiFieldBatching))
@@ -188,6 +230,7 @@ type streamInfo struct {
 	explicitShards []string
 	id             string // Either a name or arn, extracted from config and used for balancing shards
 	arn            string
+	consumerARN    string
 }
 
 type kinesisReader struct {
@@ -202,7 +245,7 @@ type kinesisReader struct {
 	boffPool sync.Pool
 
 	svc          *kinesis.Client
-	checkpointer *awsKinesisCheckpointer
+	checkpointer kinesisCheckpointer
 
 	streams []*streamInfo
 
@@ -324,6 +367,13 @@ func newKinesisReaderFromConfig(conf kiConfig, batcher service.BatchPolicy, sess
 		})
 	}
 
+	if k.conf.DynamoDB.KCLCompatible && len(k.streams) > 1 {
+		return nil, errors.New("only a single stream can be consumed when using a KCL lease table")
+	}
+	if k.conf.EnhancedFanOut.Enabled && k.conf.EnhancedFanOut.ConsumerName == "" {
+		return nil, errors.New("a consumer name must be specified when enhanced fan-out is enabled")
+	}
+
 	if k.commitPeriod, err = time.ParseDuration(k.conf.CommitPeriod); err != nil {
 		return nil, fmt.Errorf("failed to parse commit period string: %v", err)
 	}
@@ -344,15 +394,18 @@ const (
 	ErrCodeKMSThrottlingException = "KMSThrottlingException"
 )
 
-func (k *kinesisReader) getIter(info streamInfo, shardID, sequence string) (string, error) {
+// getIter obtains an iterator for a shard that begins after a sequence, or at
+// the oldest or latest record of the shard when the sequence is empty.
+func (k *kinesisReader) getIter(info streamInfo, shardID, sequence string, fromOldest bool) (string, error) {
 	iterType := types.ShardIteratorTypeTrimHorizon
-	if !k.conf.StartFromOldest {
+	if !fromOldest {
 		iterType = types.ShardIteratorTypeLatest
 	}
 	var startingSequence *string
 	if sequence != "" {
-		iterType = types.ShardIteratorTypeAfterSequenceNumber
-		startingSequence = &sequence
+		var position string
+		iterType, position = kinesisIteratorPosition(sequence)
+		startingSequence = &position
 	}
 
 	res, err := k.svc.GetShardIterator(k.ctx, &kinesis.GetShardIteratorInput{
@@ -429,7 +482,7 @@ const (
 	awsKinesisConsumerClosing
 )
 
-func (k *kinesisReader) runConsumer(wg *sync.WaitGroup, info streamInfo, shardID, startingSequence string) (initErr error) {
+func (k *kinesisReader) runConsumer(wg *sync.WaitGroup, info streamInfo, shardID, startingSequence string, fromOldest bool) (initErr error) {
 	defer func() {
 		if initErr != nil {
 			wg.Done()
@@ -446,189 +499,30 @@ func (k *kinesisReader) runConsumer(wg *sync.WaitGroup, info streamInfo, shardID
 		return initErr
 	}
 
-	// Keeps track of retry attempts.
-	boff := k.boffPool.Get().(backoff.BackOff)
-
-	// Stores consumed records that have yet to be added to the batcher.
-	var pending []types.Record
-	var iter string
-	if iter, initErr = k.getIter(info, shardID, startingSequence); initErr != nil {
+	var source kinesisShardSource
+	if source, initErr = k.newShardSource(info, shardID, startingSequence, fromOldest); initErr != nil {
 		return initErr
 	}
 
-	// Keeps track of the latest state of the consumer.
-	state := awsKinesisConsumerConsuming
-	var pendingMsg asyncMessage
-
-	unblockedChan, blockedChan := make(chan time.Time), make(chan time.Time)
-	close(unblockedChan)
-
-	// Channels (and contexts) representing the four main actions of the
-	// consumer goroutine:
-	// 1. Timed batches, this might be nil when timed batches are disabled.
-	// 2. Record pulling, this might be unblocked (closed channel) when we run
-	//    out of pending records, or a timed channel when our last attempt
-	//    yielded zero records.
-	// 3. Message flush, this is the target of our current batched message, and
-	//    is nil when our current batched message is a zero value (we don't have
-	//    one prepared).
-	// 4. Next commit, is "done" when the next commit is due.
-	var nextTimedBatchChan <-chan time.Time
-	var nextPullChan <-chan time.Time = unblockedChan
-	var nextFlushChan chan<- asyncMessage
-	commitCtx, commitCtxClose := context.WithTimeout(k.ctx, k.commitPeriod)
-
-	go func() {
-		defer func() {
-			commitCtxClose()
-			recordBatcher.Close(context.Background(), state == awsKinesisConsumerFinished)
-			boff.Reset()
-			k.boffPool.Put(boff)
-
-			reason := ""
-			switch state {
-			case awsKinesisConsumerFinished:
-				reason = " because the shard is closed"
-				if err := k.checkpointer.Delete(k.ctx, info.id, shardID); err != nil {
-					k.log.Errorf("Failed to remove checkpoint for finished stream '%v' shard '%v': %v", info.id, shardID, err)
-				}
-			case awsKinesisConsumerYielding:
-				reason = " because the shard has been claimed by another client"
-				if err := k.checkpointer.Yield(k.ctx, info.id, shardID, recordBatcher.GetSequence()); err != nil {
-					k.log.Errorf("Failed to yield checkpoint for stolen stream '%v' shard '%v': %v", info.id, shardID, err)
-				}
-			case awsKinesisConsumerClosing:
-				reason = " because the pipeline is shutting down"
-				if _, err := k.checkpointer.Checkpoint(context.Background(), info.id, shardID, recordBatcher.GetSequence(), true); err != nil {
-					k.log.Errorf("Failed to store final checkpoint for stream '%v' shard '%v': %v", info.id, shardID, err)
-				}
-			}
-
-			wg.Done()
-			k.log.Debugf("Closing stream '%v' shard '%v' as client '%v'%v", info.id, shardID, k.checkpointer.clientID, reason)
-		}()
-
-		k.log.Debugf("Consuming stream '%v' shard '%v' as client '%v'", info.id, shardID, k.checkpointer.clientID)
-
-		// Switches our pull chan to unblocked only if it's currently blocked,
-		// as otherwise it's set to a timed channel that we do not want to
-		// disturb.
-		unblockPullChan := func() {
-			if nextPullChan == blockedChan {
-				nextPullChan = unblockedChan
-			}
-		}
-
-		for {
-			var err error
-			if state == awsKinesisConsumerConsuming && len(pending) == 0 && nextPullChan == unblockedChan {
-				if pending, iter, err = k.getRecords(info, shardID, iter); err != nil {
-					if !awsErrIsTimeout(err) {
-						nextPullChan = time.After(boff.NextBackOff())
-
-						var aerr *types.ExpiredIteratorException
-						if errors.As(err, &aerr) {
-							k.log.Warn("Shard iterator expired, attempting to refresh")
-							newIter, err := k.getIter(info, shardID, recordBatcher.GetSequence())
-							if err != nil {
-								k.log.Errorf("Failed to refresh shard iterator: %v", err)
-							} else {
-								iter = newIter
-							}
-						} else {
-							k.log.Errorf("Failed to pull Kinesis records: %v\n", err)
-						}
-					}
-				} else if len(pending) == 0 {
-					nextPullChan = time.After(boff.NextBackOff())
-				} else {
-					boff.Reset()
-					nextPullChan = blockedChan
-				}
-				// The getRecords method ensures that it returns the input
-				// iterator whenever it errors out. Therefore, regardless of the
-				// outcome of the call if iter is now empty we have definitely
-				// reached the end of the shard.
-				if iter == "" {
-					state = awsKinesisConsumerFinished
-				}
-			} else {
-				unblockPullChan()
-			}
-
-			if pendingMsg.msg == nil {
-				// If our consumer is finished and we've run out of pending
-				// records then we're done.
-				if len(pending) == 0 && state == awsKinesisConsumerFinished {
-					if pendingMsg, _ = recordBatcher.FlushMessage(k.ctx); pendingMsg.msg == nil {
-						return
-					}
-				} else if recordBatcher.HasPendingMessage() {
-					if pendingMsg, err = recordBatcher.FlushMessage(commitCtx); err != nil {
-						k.log.Errorf("Failed to dispatch message due to checkpoint error: %v\n", err)
-					}
-				} else if len(pending) > 0 {
-					var i int
-					var r types.Record
-					for i, r = range pending {
-						if recordBatcher.AddRecord(r) {
-							if pendingMsg, err = recordBatcher.FlushMessage(commitCtx); err != nil {
-								k.log.Errorf("Failed to dispatch message due to checkpoint error: %v\n", err)
-							}
-							break
-						}
-					}
-					if pending = pending[i+1:]; len(pending) == 0 {
-						unblockPullChan()
-					}
-				} else {
-					unblockPullChan()
-				}
-			}
-
-			if pendingMsg.msg != nil {
-				nextFlushChan = k.msgChan
-			} else {
-				nextFlushChan = nil
-			}
-
-			if nextTimedBatchChan == nil {
-				if tNext, exists := recordBatcher.UntilNext(); exists {
-					nextTimedBatchChan = time.After(tNext)
-				}
-			}
-
-			select {
-			case <-commitCtx.Done():
-				if k.ctx.Err() != nil {
-					// It could've been our parent context that closed, in which
-					// case we exit.
-					state = awsKinesisConsumerClosing
-					return
-				}
-
-				commitCtxClose()
-				commitCtx, commitCtxClose = context.WithTimeout(k.ctx, k.commitPeriod)
-
-				stillOwned, err := k.checkpointer.Checkpoint(k.ctx, info.id, shardID, recordBatcher.GetSequence(), false)
-				if err != nil {
-					k.log.Errorf("Failed to store checkpoint for Kinesis stream '%v' shard '%v': %v", info.id, shardID, err)
-				} else if !stillOwned {
-					state = awsKinesisConsumerYielding
-					return
-				}
-			case <-nextTimedBatchChan:
-				nextTimedBatchChan = nil
-			case nextFlushChan <- pendingMsg:
-				pendingMsg = asyncMessage{}
-			case <-nextPullChan:
-				nextPullChan = unblockedChan
-			case <-k.ctx.Done():
-				state = awsKinesisConsumerClosing
-				return
-			}
-		}
-	}()
+	consumer := &awsShardConsumer[types.Record]{
+		ctx:          k.ctx,
+		log:          k.log,
+		clientID:     k.clientID,
+		checkpointer: k.checkpointer,
+		boffPool:     &k.boffPool,
+		commitPeriod: k.commitPeriod,
+		msgChan:      k.msgChan,
+		streamType:   "Kinesis",
+		streamID:     info.id,
+		shardID:      shardID,
+		source:       source,
+		batcher:      recordBatcher,
+		addRecord:    recordBatcher.AddRecord,
+		finish: func(ctx context.Context) error {
+			return k.checkpointer.Delete(ctx, info.id, shardID)
+		},
+	}
+	consumer.run(wg)
 	return nil
 }
 
@@ -644,6 +538,60 @@ func isShardFinished(s types.Shard) bool {
 	return *s.SequenceNumberRange.EndingSequenceNumber != "null"
 }
 
+// kclReadyShards returns the shards that can be consumed according to the
+// checkpoints of a KCL lease table, mapped to whether the shard should be
+// consumed from its oldest record when it has no checkpoint.
+//
+// Closed shards are consumed until their lease is checkpointed as SHARD_END,
+// whereas closed shards without a lease are considered finished. Following
+// the KCL, the children of a shard are only consumed once the parent shard is
+// finished, and from their oldest record, so that records of a key are
+// consumed in order.
+func kclReadyShards(shards []types.Shard, checkpoints map[string]string) map[string]bool {
+	listed := make(map[string]types.Shard, len(shards))
+	for _, s := range shards {
+		listed[*s.ShardId] = s
+	}
+
+	isFinished := func(shardID string) bool {
+		s, isListed := listed[shardID]
+		if !isListed {
+			// The shard has been trimmed from the stream.
+			return true
+		}
+		checkpoint, hasLease := checkpoints[shardID]
+		if !hasLease {
+			return isShardFinished(s)
+		}
+		return checkpoint == kclCheckpointShardEnd
+	}
+
+	ready := map[string]bool{}
+	for _, s := range shards {
+		if isFinished(*s.ShardId) {
+			continue
+		}
+
+		isChild, parentsFinished := false, true
+		for _, parentID := range []*string{s.ParentShardId, s.AdjacentParentShardId} {
+			if parentID == nil {
+				continue
+			}
+			if _, isListed := listed[*parentID]; isListed {
+				isChild = true
+			}
+			if !isFinished(*parentID) {
+				parentsFinished = false
+			}
+		}
+		if !parentsFinished {
+			continue
+		}
+		ready[*s.ShardId] = isChild || checkpoints[*s.ShardId] == kclCheckpointTrimHorizon
+	}
+	return ready
+}
+
 func (k *kinesisReader) runBalancedShards() {
 	var wg sync.WaitGroup
 	defer func() {
@@ -661,8 +609,14 @@ func (k *kinesisReader) runBalancedShards() {
 			})
 
 			var clientClaims map[string][]awsKinesisClientClaim
+			var kclCheckpoints map[string]string
+			kclCheckpointer, isKCL := k.checkpointer.(*kclLeaseCheckpointer)
 			if err == nil {
-				clientClaims, err = k.checkpointer.AllClaims(k.ctx, info.id)
+				if isKCL {
+					clientClaims, kclCheckpoints, err = kclCheckpointer.claimsAndCheckpoints(k.ctx)
+				} else {
+					clientClaims, err = k.checkpointer.AllClaims(k.ctx, info.id)
+				}
 			}
 			if err != nil {
 				if k.ctx.Err() != nil {
@@ -672,15 +626,29 @@ func (k *kinesisReader) runBalancedShards() {
 				continue
 			}
 
-			totalShards := len(shardsRes.Shards)
-			unclaimedShards := make(map[string]string, totalShards)
-			for _, s := range shardsRes.Shards {
-				if !isShardFinished(s) {
-					unclaimedShards[*s.ShardId] = ""
+			// Maps shards that are ready to be consumed to whether they are
+			// consumed from their oldest record when they have no checkpoint.
+			var readyShards map[string]bool
+			if isKCL {
+				readyShards = kclReadyShards(shardsRes.Shards, kclCheckpoints)
+			} else {
+				readyShards = make(map[string]bool, len(shardsRes.Shards))
+				for _, s := range shardsRes.Shards {
+					if !isShardFinished(s) {
+						readyShards[*s.ShardId] = k.conf.StartFromOldest
+					}
 				}
 			}
+
+			unclaimedShards := make(map[string]string, len(readyShards))
+			for shardID := range readyShards {
+				unclaimedShards[shardID] = ""
+			}
 			for clientID, claims := range clientClaims {
 				for _, claim := range claims {
+					if _, isReady := readyShards[claim.ShardID]; isKCL && !isReady {
+						continue
+					}
 					if time.Since(claim.LeaseTimeout) > k.leasePeriod*2 {
 						unclaimedShards[claim.ShardID] = clientID
 					} else {
@@ -689,78 +657,24 @@ func (k *kinesisReader) runBalancedShards() {
 				}
 			}
 
-			// Have a go at grabbing any unclaimed shards
-			if len(unclaimedShards) > 0 {
-				for shardID, clientID := range unclaimedShards {
-					sequence, err := k.checkpointer.Claim(k.ctx, info.id, shardID, clientID)
-					if err != nil {
-						if k.ctx.Err() != nil {
-							return
-						}
-						if !errors.Is(err, ErrLeaseNotAcquired) {
-							k.log.Errorf("Failed to claim unclaimed shard '%v': %v", shardID, err)
-						}
-						continue
-					}
-					wg.Add(1)
-					if err = k.runConsumer(&wg, *info, shardID, sequence); err != nil {
-						k.log.Errorf("Failed to start consumer: %v\n", err)
-					}
+			balanceShardClaims(k.ctx, k.log, k.clientID, info.id, unclaimedShards, clientClaims, func(shardID, fromClientID string) (bool, error) {
+				sequence, err := k.checkpointer.Claim(k.ctx, info.id, shardID, fromClientID)
+				if err != nil {
+					return false, err
 				}
-
-				// If there are unclaimed shards then let's not resort to
-				// thievery just yet.
-				continue
-			}
-
-			// There were no unclaimed shards, let's look for a shard to steal.
-			selfClaims := len(clientClaims[k.clientID])
-			for clientID, claims := range clientClaims {
-				if clientID == k.clientID {
-					// Don't steal from ourself, we're not at that point yet.
-					continue
+				if sequence == shardEndSequence {
+					// The shard was finished by another client since we last
+					// looked, so release it again.
+					_, err = k.checkpointer.Checkpoint(k.ctx, info.id, shardID, shardEndSequence, true)
+					return false, err
 				}
-
-				// This is an extremely naive "algorithm", we simply randomly
-				// iterate all other clients with shards and if any have two
-				// more shards than we do then it's fair game. Using two here
-				// so that we don't play hot potatoes with an odd shard.
-				if len(claims) > (selfClaims + 1) {
-					randomShard := claims[(rand.Int() % len(claims))].ShardID
-					k.log.Debugf(
-						"Attempting to steal stream '%v' shard '%v' from client '%v' as client '%v'",
-						info.id, randomShard, clientID, k.clientID,
-					)
-
-					sequence, err := k.checkpointer.Claim(k.ctx, info.id, randomShard, clientID)
-					if err != nil {
-						if k.ctx.Err() != nil {
-							return
-						}
-						if !errors.Is(err, ErrLeaseNotAcquired) {
-							k.log.Errorf("Failed to steal shard '%v': %v", randomShard, err)
-						}
-						k.log.Debugf(
-							"Aborting theft of stream '%v' shard '%v' from client '%v' as client '%v'",
-							info.id, randomShard, clientID, k.clientID,
-						)
-						continue
-					}
-
-					k.log.Debugf(
-						"Successfully stole stream '%v' shard '%v' from client '%v' as client '%v'",
-						info.id, randomShard, clientID, k.clientID,
-					)
-					wg.Add(1)
-					if err = k.runConsumer(&wg, *info, randomShard, sequence); err != nil {
-						k.log.Errorf("Failed to start consumer: %v\n", err)
-					} else {
-						// If we successfully stole the shard then that's enough
-						// for now.
-						break
-					}
+				wg.Add(1)
+				if err = k.runConsumer(&wg, *info, shardID, sequence, readyShards[shardID] || k.conf.StartFromOldest); err != nil {
+					k.log.Errorf("Failed to start consumer: %v\n", err)
+					return false, nil
 				}
-			}
+				return true, nil
+			})
 		}
 
 		select {
@@ -793,7 +707,7 @@ func (k *kinesisReader) runExplicitShards() {
 				sequence, err := k.checkpointer.Claim(k.ctx, id, shardID, "")
 				if err == nil {
 					wg.Add(1)
-					err = k.runConsumer(&wg, info, shardID, sequence)
+					err = k.runConsumer(&wg, info, shardID, sequence, k.conf.StartFromOldest)
 				}
 				if err != nil {
 					if k.ctx.Err() != nil {
@@ -858,7 +772,14 @@ func (k *kinesisReader) Connect(ctx context.Context) error {
 	}
 
 	svc := kinesis.NewFromConfig(k.sess)
-	checkpointer, err := newAWSKinesisCheckpointer(k.sess, k.clientID, k.conf.DynamoDB, k.leasePeriod, k.commitPeriod)
+
+	var checkpointer kinesisCheckpointer
+	var err error
+	if k.conf.DynamoDB.KCLCompatible {
+		checkpointer, err = newKCLLeaseCheckpointer(k.sess, k.clientID, k.conf.DynamoDB, k.leasePeriod, k.conf.StartFromOldest)
+	} else {
+		checkpointer, err = newAWSKinesisCheckpointer(k.sess, k.clientID, k.conf.DynamoDB, k.leasePeriod, k.commitPeriod)
+	}
 	if err != nil {
 		return err
 	}
@@ -870,6 +791,13 @@ func (k *kinesisReader) Connect(ctx context.Context) error {
 	if err = k.waitUntilStreamsExists(ctx); err != nil {
 		return err
 	}
+	if k.conf.EnhancedFanOut.Enabled {
+		for _, info := range k.streams {
+			if err = k.registerStreamConsumer(ctx, info); err != nil {
+				return err
+			}
+		}
+	}
 
 	if len(k.streams[0].explicitShards) > 0 {
 		go k.runExplicitShards()
@@ -40,6 +40,32 @@ type kiddbConfig struct {
 	ReadCapacityUnits  int64
 	WriteCapacityUnits int64
 	BillingMode        string
+	KCLCompatible      bool
+}
+
+// kinesisInputDynamoDBFields returns the fields of the DynamoDB table used for
+// storing checkpoints and coordinating balanced consumers of shards.
+func kinesisInputDynamoDBFields() []*service.ConfigField {
+	return []*service.ConfigField{
+		service.NewStringField(kiddbFieldTable).
+			Description("The name of the table to access.").
+			Default(""),
+		service.NewBoolField(kiddbFieldCreate).
+			Description("Whether, if the table does not exist, it should be created.").
+			Default(false),
+		service.NewStringEnumField(kiddbFieldBillingMode, "PROVISIONED", "PAY_PER_REQUEST").
+			Description("When creating the table determines the billing mode.").
+			Default("PAY_PER_REQUEST").
+			Advanced(),
+		service.NewIntField(kiddbFieldReadCapacityUnits).
+			Description("Set the provisioned read capacity when creating the table with a `billing_mode` of `PROVISIONED`.").
+			Default(0).
+			Advanced(),
+		service.NewIntField(kiddbFieldWriteCapacityUnits).
+			Description("Set the provisioned write capacity when creating the table with a `billing_mode` of `PROVISIONED`.").
+			Default(0).
+			Advanced(),
+	}
 }
 
 func kinesisInputDynamoDBConfigFromParsed(pConf *service.ParsedConfig) (conf kiddbConfig, err error) {
@@ -61,6 +87,16 @@ func kinesisInputDynamoDBConfigFromParsed(pConf *service.ParsedConfig) (conf kid
 	return
 }
 
+// kinesisCheckpointer stores the latest consumed sequence of shards and
+// coordinates the leases of shards across clients.
+type kinesisCheckpointer interface {
+	AllClaims(ctx context.Context, streamID string) (map[string][]awsKinesisClientClaim, error)
+	Claim(ctx context.Context, streamID, shardID, fromClientID string) (string, error)
+	Checkpoint(ctx context.Context, streamID, shardID, sequenceNumber string, final bool) (bool, error)
+	Yield(ctx context.Context, streamID, shardID, sequenceNumber string) error
+	Delete(ctx context.Context, streamID, shardID string) error
+}
+
 // awsKinesisCheckpointer manages the shard checkpointing for a given client
 // identifier.
 type awsKinesisCheckpointer struct {
@@ -436,3 +472,86 @@ func (k *awsKinesisCheckpointer) Delete(ctx context.Context, streamID, shardID s
 	})
 	return err
 }
+
+// shardEndSequence is stored as the sequence number of a checkpoint once all
+// records of a closed shard have been consumed. Unlike deleting the checkpoint
+// this allows consumers that follow the lineage of shards to determine that
+// the children of a shard can be consumed.
+const shardEndSequence = "SHARD_END"
+
+// FinishedShards returns the IDs of all shards of a stream that have been
+// checkpointed as fully consumed.
+func (k *awsKinesisCheckpointer) FinishedShards(ctx context.Context, streamID string) (map[string]struct{}, error) {
+	finished := map[string]struct{}{}
+
+	paginator := dynamodb.NewQueryPaginator(k.svc, &dynamodb.QueryInput{
+		TableName:              aws.String(k.conf.Table),
+		KeyConditionExpression: aws.String("StreamID = :stream_id"),
+		FilterExpression:       aws.String("SequenceNumber = :shard_end"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":stream_id": &types.AttributeValueMemberS{
+				Value: streamID,
+			},
+			":shard_end": &types.AttributeValueMemberS{
+				Value: shardEndSequence,
+			},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range page.Items {
+			if s, ok := i["ShardID"].(*types.AttributeValueMemberS); ok {
+				finished[s.Value] = struct{}{}
+			}
+		}
+	}
+	return finished, nil
+}
+
+// HasCheckpoints returns whether any checkpoint exists for a stream.
+func (k *awsKinesisCheckpointer) HasCheckpoints(ctx context.Context, streamID string) (bool, error) {
+	res, err := k.svc.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(k.conf.Table),
+		KeyConditionExpression: aws.String("StreamID = :stream_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":stream_id": &types.AttributeValueMemberS{
+				Value: streamID,
+			},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(res.Items) > 0, nil
+}
+
+// MarkFinished checkpoints a shard as fully consumed without consuming it,
+// unless a checkpoint for the shard already exists.
+func (k *awsKinesisCheckpointer) MarkFinished(ctx context.Context, streamID, shardID string) error {
+	_, err := k.svc.PutItem(ctx, &dynamodb.PutItemInput{
+		ConditionExpression: aws.String("attribute_not_exists(ShardID)"),
+		TableName:           aws.String(k.conf.Table),
+		Item: map[string]types.AttributeValue{
+			"StreamID": &types.AttributeValueMemberS{
+				Value: streamID,
+			},
+			"ShardID": &types.AttributeValueMemberS{
+				Value: shardID,
+			},
+			"SequenceNumber": &types.AttributeValueMemberS{
+				Value: shardEndSequence,
+			},
+		},
+	})
+	if err != nil {
+		var aerr *types.ConditionalCheckFailedException
+		if errors.As(err, &aerr) {
+			return nil
+		}
+	}
+	return err
+}
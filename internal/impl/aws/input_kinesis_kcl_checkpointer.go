@@ -0,0 +1,433 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Checkpoint values of the KCL lease table that represent a position within a
+// shard rather than a sequence number.
+const (
+	kclCheckpointTrimHorizon = "TRIM_HORIZON"
+	kclCheckpointLatest      = "LATEST"
+	kclCheckpointAtTimestamp = "AT_TIMESTAMP"
+	kclCheckpointShardEnd    = "SHARD_END"
+)
+
+// kclLease is the subset of a KCL v2 lease that is relevant to balancing and
+// checkpointing shards.
+type kclLease struct {
+	Key         string
+	Owner       string
+	Counter     int64
+	Checkpoint  string
+	SubSequence int
+}
+
+func kclLeaseFromItem(item map[string]types.AttributeValue) (l kclLease, err error) {
+	if s, ok := item["leaseKey"].(*types.AttributeValueMemberS); ok {
+		l.Key = s.Value
+	} else {
+		return l, errors.New("lease key was not found in lease")
+	}
+	if s, ok := item["leaseOwner"].(*types.AttributeValueMemberS); ok {
+		l.Owner = s.Value
+	}
+	if n, ok := item["leaseCounter"].(*types.AttributeValueMemberN); ok {
+		if l.Counter, err = strconv.ParseInt(n.Value, 10, 64); err != nil {
+			return l, fmt.Errorf("failed to parse lease counter: %w", err)
+		}
+	}
+	if s, ok := item["checkpoint"].(*types.AttributeValueMemberS); ok {
+		l.Checkpoint = s.Value
+	}
+	if n, ok := item["checkpointSubSequenceNumber"].(*types.AttributeValueMemberN); ok {
+		if l.SubSequence, err = strconv.Atoi(n.Value); err != nil {
+			return l, fmt.Errorf("failed to parse checkpoint sub sequence number: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// sequence returns the sequence number to resume from, which is empty when the
+// checkpoint is a position that should be determined by the consumer.
+//
+// The KCL checkpoints the sub sequence number of the last user record consumed
+// from a record, which is zero for records that aren't aggregated, and resumes
+// by reading the record again and skipping the user records up to and
+// including the sub sequence number. The sequence therefore always includes the
+// sub sequence number so that the record is resumed in the same way.
+func (l kclLease) sequence() string {
+	switch l.Checkpoint {
+	case kclCheckpointTrimHorizon, kclCheckpointLatest, kclCheckpointAtTimestamp:
+		return ""
+	case kclCheckpointShardEnd:
+		return shardEndSequence
+	}
+	return kinesisSubSequence(l.Checkpoint, l.SubSequence)
+}
+
+// kclCheckpointValues returns the checkpoint and sub sequence number of the
+// lease for a sequence, where a sequence without a sub sequence number is of a
+// record that isn't aggregated.
+func kclCheckpointValues(sequenceNumber string) (checkpoint, subSequence types.AttributeValue) {
+	sequence, sub, _ := parseKinesisSubSequence(sequenceNumber)
+	return &types.AttributeValueMemberS{Value: sequence}, &types.AttributeValueMemberN{Value: strconv.Itoa(sub)}
+}
+
+type kclLeaseObservation struct {
+	counter int64
+	at      time.Time
+}
+
+// kclLeaseCheckpointer manages shard checkpoints within a lease table of the
+// Kinesis Client Library (KCL) v2, which allows consumers to take over shards
+// from KCL applications and vice versa.
+//
+// Leases of the KCL do not include a timeout, instead a lease is considered
+// expired when its counter has not been incremented for a period of time.
+// Therefore the lease timeout of a claim is derived from the last time the
+// counter of a lease was observed to change.
+type kclLeaseCheckpointer struct {
+	conf kiddbConfig
+
+	clientID        string
+	leaseDuration   time.Duration
+	initialPosition string
+	svc             *dynamodb.Client
+
+	obsMut       sync.Mutex
+	observations map[string]kclLeaseObservation
+}
+
+// newKCLLeaseCheckpointer creates a new checkpointer for a KCL lease table
+// from an AWS session and a configuration struct. The lease table only
+// supports a single stream, which is the single stream mode of the KCL.
+func newKCLLeaseCheckpointer(
+	aConf aws.Config,
+	clientID string,
+	conf kiddbConfig,
+	leaseDuration time.Duration,
+	startFromOldest bool,
+) (*kclLeaseCheckpointer, error) {
+	c := &kclLeaseCheckpointer{
+		conf:            conf,
+		clientID:        clientID,
+		leaseDuration:   leaseDuration,
+		initialPosition: kclCheckpointLatest,
+		svc:             dynamodb.NewFromConfig(aConf),
+		observations:    map[string]kclLeaseObservation{},
+	}
+	if startFromOldest {
+		c.initialPosition = kclCheckpointTrimHorizon
+	}
+
+	if err := c.ensureTableExists(context.TODO()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (k *kclLeaseCheckpointer) ensureTableExists(ctx context.Context) error {
+	_, err := k.svc.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(k.conf.Table),
+	})
+	{
+		var aerr *types.ResourceNotFoundException
+		if err == nil || !errors.As(err, &aerr) {
+			return err
+		}
+	}
+	if !k.conf.Create {
+		return fmt.Errorf("target table %v does not exist", k.conf.Table)
+	}
+
+	input := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("leaseKey"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		BillingMode: types.BillingMode(k.conf.BillingMode),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("leaseKey"), KeyType: types.KeyTypeHash},
+		},
+		TableName: aws.String(k.conf.Table),
+	}
+	if k.conf.BillingMode == "PROVISIONED" {
+		input.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits:  &k.conf.ReadCapacityUnits,
+			WriteCapacityUnits: &k.conf.WriteCapacityUnits,
+		}
+	}
+	if _, err = k.svc.CreateTable(ctx, input); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	return nil
+}
+
+func (k *kclLeaseCheckpointer) leaseKey(shardID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"leaseKey": &types.AttributeValueMemberS{
+			Value: shardID,
+		},
+	}
+}
+
+func (k *kclLeaseCheckpointer) getLease(ctx context.Context, shardID string) (*kclLease, error) {
+	res, err := k.svc.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(k.conf.Table),
+		Key:            k.leaseKey(shardID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Item == nil {
+		return nil, nil
+	}
+	l, err := kclLeaseFromItem(res.Item)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// observe records the counter of a lease and returns the time at which the
+// counter was last observed to change.
+func (k *kclLeaseCheckpointer) observe(l kclLease, now time.Time) time.Time {
+	k.obsMut.Lock()
+	defer k.obsMut.Unlock()
+
+	obs, exists := k.observations[l.Key]
+	if !exists || obs.counter != l.Counter {
+		obs = kclLeaseObservation{counter: l.Counter, at: now}
+		k.observations[l.Key] = obs
+	}
+	return obs.at
+}
+
+// AllClaims returns a map of client IDs to shards claimed by that client,
+// including the lease timeout of the claim.
+func (k *kclLeaseCheckpointer) AllClaims(ctx context.Context, streamID string) (map[string][]awsKinesisClientClaim, error) {
+	clientClaims, _, err := k.claimsAndCheckpoints(ctx)
+	return clientClaims, err
+}
+
+// claimsAndCheckpoints returns the claims of all clients, as AllClaims does,
+// along with the checkpoint of every lease, which is used to determine which
+// shards are ready to be consumed.
+func (k *kclLeaseCheckpointer) claimsAndCheckpoints(ctx context.Context) (map[string][]awsKinesisClientClaim, map[string]string, error) {
+	clientClaims := make(map[string][]awsKinesisClientClaim)
+	checkpoints := map[string]string{}
+	now := time.Now()
+
+	paginator := dynamodb.NewScanPaginator(k.svc, &dynamodb.ScanInput{
+		TableName:      aws.String(k.conf.Table),
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, i := range page.Items {
+			l, err := kclLeaseFromItem(i)
+			if err != nil {
+				return nil, nil, err
+			}
+			checkpoints[l.Key] = l.Checkpoint
+			if l.Owner == "" || l.Checkpoint == kclCheckpointShardEnd {
+				continue
+			}
+			clientClaims[l.Owner] = append(clientClaims[l.Owner], awsKinesisClientClaim{
+				ShardID:      l.Key,
+				LeaseTimeout: k.observe(l, now).Add(k.leaseDuration),
+			})
+		}
+	}
+	return clientClaims, checkpoints, nil
+}
+
+// Claim attempts to claim a shard. If fromClientID is specified the shard is
+// stolen from that particular client, and the operation fails if a different
+// client has it claimed.
+//
+// As with the default checkpointer a stolen shard is not consumed until a
+// grace period has passed, which allows the previous owner to checkpoint its
+// final sequence.
+func (k *kclLeaseCheckpointer) Claim(ctx context.Context, streamID, shardID, fromClientID string) (string, error) {
+	l, err := k.getLease(ctx, shardID)
+	if err != nil {
+		return "", err
+	}
+
+	if l == nil {
+		if fromClientID != "" {
+			return "", ErrLeaseNotAcquired
+		}
+		_, err := k.svc.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(k.conf.Table),
+			ConditionExpression: aws.String("attribute_not_exists(leaseKey)"),
+			Item: map[string]types.AttributeValue{
+				"leaseKey":                     &types.AttributeValueMemberS{Value: shardID},
+				"leaseOwner":                   &types.AttributeValueMemberS{Value: k.clientID},
+				"leaseCounter":                 &types.AttributeValueMemberN{Value: "1"},
+				"checkpoint":                   &types.AttributeValueMemberS{Value: k.initialPosition},
+				"checkpointSubSequenceNumber":  &types.AttributeValueMemberN{Value: "0"},
+				"ownerSwitchesSinceCheckpoint": &types.AttributeValueMemberN{Value: "0"},
+			},
+		})
+		if err != nil {
+			var aerr *types.ConditionalCheckFailedException
+			if errors.As(err, &aerr) {
+				return "", ErrLeaseNotAcquired
+			}
+			return "", err
+		}
+		return "", nil
+	}
+
+	if l.Owner != fromClientID {
+		return "", ErrLeaseNotAcquired
+	}
+
+	if _, err = k.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(k.conf.Table),
+		Key:                 k.leaseKey(shardID),
+		ConditionExpression: aws.String("leaseCounter = :counter"),
+		UpdateExpression:    aws.String("SET leaseOwner = :new_owner ADD leaseCounter :one, ownerSwitchesSinceCheckpoint :one"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":counter":   &types.AttributeValueMemberN{Value: strconv.FormatInt(l.Counter, 10)},
+			":new_owner": &types.AttributeValueMemberS{Value: k.clientID},
+			":one":       &types.AttributeValueMemberN{Value: "1"},
+		},
+	}); err != nil {
+		var aerr *types.ConditionalCheckFailedException
+		if errors.As(err, &aerr) {
+			return "", ErrLeaseNotAcquired
+		}
+		return "", err
+	}
+
+	if fromClientID != "" {
+		select {
+		case <-time.After(k.leaseDuration + time.Second):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if l, err = k.getLease(ctx, shardID); err != nil {
+			return "", err
+		}
+		if l == nil {
+			return "", nil
+		}
+	}
+	return l.sequence(), nil
+}
+
+// Checkpoint attempts to set a sequence number for a shard and renews the
+// lease by incrementing its counter. Returns a boolean indicating whether this
+// shard is still owned by the client.
+//
+// If final is true the lease owner is removed, indicating that this client is
+// finished with the shard.
+func (k *kclLeaseCheckpointer) Checkpoint(ctx context.Context, streamID, shardID, sequenceNumber string, final bool) (bool, error) {
+	values := map[string]types.AttributeValue{
+		":client_id": &types.AttributeValueMemberS{Value: k.clientID},
+		":one":       &types.AttributeValueMemberN{Value: "1"},
+	}
+
+	exp := ""
+	if sequenceNumber != "" {
+		exp = "SET checkpoint = :checkpoint, checkpointSubSequenceNumber = :sub_sequence, ownerSwitchesSinceCheckpoint = :zero "
+		values[":checkpoint"], values[":sub_sequence"] = kclCheckpointValues(sequenceNumber)
+		values[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+	}
+	exp += "ADD leaseCounter :one"
+	if final {
+		exp += " REMOVE leaseOwner"
+	}
+
+	if _, err := k.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(k.conf.Table),
+		Key:                       k.leaseKey(shardID),
+		ConditionExpression:       aws.String("leaseOwner = :client_id"),
+		UpdateExpression:          aws.String(exp),
+		ExpressionAttributeValues: values,
+	}); err != nil {
+		var aerr *types.ConditionalCheckFailedException
+		if errors.As(err, &aerr) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Yield updates the checkpoint of a lease and no other fields, which allows
+// the client that stole the shard to begin with the latest sequence.
+//
+// The checkpoint is only updated while the lease is owned by another client
+// that has yet to checkpoint since taking it, as otherwise the progress of the
+// new owner would be overwritten.
+func (k *kclLeaseCheckpointer) Yield(ctx context.Context, streamID, shardID, sequenceNumber string) error {
+	if sequenceNumber == "" {
+		return nil
+	}
+
+	values := map[string]types.AttributeValue{
+		":client_id": &types.AttributeValueMemberS{Value: k.clientID},
+		":zero":      &types.AttributeValueMemberN{Value: "0"},
+	}
+	values[":checkpoint"], values[":sub_sequence"] = kclCheckpointValues(sequenceNumber)
+
+	_, err := k.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(k.conf.Table),
+		Key:                       k.leaseKey(shardID),
+		ConditionExpression:       aws.String("attribute_exists(leaseOwner) AND leaseOwner <> :client_id AND ownerSwitchesSinceCheckpoint > :zero"),
+		UpdateExpression:          aws.String("SET checkpoint = :checkpoint, checkpointSubSequenceNumber = :sub_sequence"),
+		ExpressionAttributeValues: values,
+	})
+	var aerr *types.ConditionalCheckFailedException
+	if errors.As(err, &aerr) {
+		return nil
+	}
+	return err
+}
+
+// Delete marks the lease of a shard that has been emptied as ended rather than
+// deleting it, as KCL applications rely on the lease of a parent shard in
+// order to begin consuming its children.
+func (k *kclLeaseCheckpointer) Delete(ctx context.Context, streamID, shardID string) error {
+	_, err := k.svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(k.conf.Table),
+		Key:              k.leaseKey(shardID),
+		UpdateExpression: aws.String("SET checkpoint = :checkpoint ADD leaseCounter :one REMOVE leaseOwner"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":checkpoint": &types.AttributeValueMemberS{Value: kclCheckpointShardEnd},
+			":one":        &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	return err
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKCLLeaseFromItem(t *testing.T) {
+	l, err := kclLeaseFromItem(map[string]types.AttributeValue{
+		"leaseKey":                     &types.AttributeValueMemberS{Value: "shardId-000000000001"},
+		"leaseOwner":                   &types.AttributeValueMemberS{Value: "worker-1"},
+		"leaseCounter":                 &types.AttributeValueMemberN{Value: "42"},
+		"checkpoint":                   &types.AttributeValueMemberS{Value: "49590338271490256608559692538361571095921575989136588898"},
+		"checkpointSubSequenceNumber":  &types.AttributeValueMemberN{Value: "3"},
+		"ownerSwitchesSinceCheckpoint": &types.AttributeValueMemberN{Value: "0"},
+		"parentShardId":                &types.AttributeValueMemberSS{Value: []string{"shardId-000000000000"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, kclLease{
+		Key:         "shardId-000000000001",
+		Owner:       "worker-1",
+		Counter:     42,
+		Checkpoint:  "49590338271490256608559692538361571095921575989136588898",
+		SubSequence: 3,
+	}, l)
+	assert.Equal(t, "49590338271490256608559692538361571095921575989136588898:3", l.sequence())
+
+	_, err = kclLeaseFromItem(map[string]types.AttributeValue{
+		"leaseCounter": &types.AttributeValueMemberN{Value: "1"},
+	})
+	require.Error(t, err)
+
+	_, err = kclLeaseFromItem(map[string]types.AttributeValue{
+		"leaseKey":     &types.AttributeValueMemberS{Value: "shardId-000000000001"},
+		"leaseCounter": &types.AttributeValueMemberN{Value: "nope"},
+	})
+	require.Error(t, err)
+}
+
+func TestKCLLeaseSequence(t *testing.T) {
+	for checkpoint, exp := range map[string]string{
+		"TRIM_HORIZON": "",
+		"LATEST":       "",
+		"AT_TIMESTAMP": "",
+		"SHARD_END":    shardEndSequence,
+		"123":          "123:0",
+	} {
+		assert.Equal(t, exp, kclLease{Checkpoint: checkpoint}.sequence(), checkpoint)
+	}
+}
+
+func TestKCLCheckpointValues(t *testing.T) {
+	for sequence, exp := range map[string][2]string{
+		"123":   {"123", "0"},
+		"123:0": {"123", "0"},
+		"123:7": {"123", "7"},
+	} {
+		checkpoint, subSequence := kclCheckpointValues(sequence)
+		assert.Equal(t, &types.AttributeValueMemberS{Value: exp[0]}, checkpoint, sequence)
+		assert.Equal(t, &types.AttributeValueMemberN{Value: exp[1]}, subSequence, sequence)
+	}
+}
+
+func TestKCLLeaseObservations(t *testing.T) {
+	k := &kclLeaseCheckpointer{observations: map[string]kclLeaseObservation{}}
+
+	t0 := time.Unix(1000, 0)
+	lease := kclLease{Key: "foo", Owner: "worker-1", Counter: 1}
+
+	assert.Equal(t, t0, k.observe(lease, t0))
+
+	// An unchanged counter keeps the time of the first observation, which
+	// allows the lease to expire.
+	assert.Equal(t, t0, k.observe(lease, t0.Add(time.Minute)))
+
+	// A renewed lease resets the time of observation.
+	lease.Counter = 2
+	assert.Equal(t, t0.Add(time.Minute*2), k.observe(lease, t0.Add(time.Minute*2)))
+}
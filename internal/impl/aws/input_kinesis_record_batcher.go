@@ -17,6 +17,8 @@ package aws
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,10 +29,60 @@ import (
 	"github.com/redpanda-data/benthos/v4/public/service"
 )
 
+// The messages of an aggregated record are checkpointed with the sub sequence
+// number of the user record they were created from appended to the sequence of
+// the record, which allows a partially consumed aggregated record to be resumed
+// rather than consumed again in full. Such a sequence indicates that the user
+// records of the record up to and including the sub sequence were consumed.
+const kinesisSubSequenceSeparator = ":"
+
+func kinesisSubSequence(sequence string, subSequence int) string {
+	return sequence + kinesisSubSequenceSeparator + strconv.Itoa(subSequence)
+}
+
+// parseKinesisSubSequence returns the sequence and sub sequence of a
+// checkpointed sequence, and false when it does not have a sub sequence.
+func parseKinesisSubSequence(s string) (sequence string, subSequence int, ok bool) {
+	sequence, subStr, found := strings.Cut(s, kinesisSubSequenceSeparator)
+	if !found {
+		return s, 0, false
+	}
+	subSequence, err := strconv.Atoi(subStr)
+	if err != nil {
+		return s, 0, false
+	}
+	return sequence, subSequence, true
+}
+
+// kinesisIteratorPosition returns the type and sequence of the shard iterator
+// that resumes from a checkpointed sequence. Records are read from after the
+// sequence unless it has a sub sequence, in which case the record of the
+// sequence is read again in order to resume with its remaining user records.
+func kinesisIteratorPosition(s string) (types.ShardIteratorType, string) {
+	if sequence, _, ok := parseKinesisSubSequence(s); ok {
+		return types.ShardIteratorTypeAtSequenceNumber, sequence
+	}
+	return types.ShardIteratorTypeAfterSequenceNumber, s
+}
+
 type awsKinesisRecordBatcher struct {
 	streamID string
 	shardID  string
 
+	deaggregate bool
+
+	// The record, and its user records from the given index onwards, that
+	// remain to be added after a batch became ready part way through
+	// deaggregating it.
+	remainingRecord      types.Record
+	remainingUserRecords []kplRecord
+	remainingFrom        int
+
+	// The record that was partially consumed before the batcher was created,
+	// and the sub sequence of its last consumed user record.
+	resumeSequence    string
+	resumeSubSequence int
+
 	batchPolicy  *service.Batcher
 	checkpointer *checkpoint.Capped[string]
 
@@ -44,30 +96,125 @@ type awsKinesisRecordBatcher struct {
 }
 
 func (k *kinesisReader) newAWSKinesisRecordBatcher(info streamInfo, shardID, sequence string) (*awsKinesisRecordBatcher, error) {
-	batchPolicy, err := k.batcher.NewBatcher(k.mgr)
+	b, err := newAWSKinesisRecordBatcher(k.batcher, k.mgr, k.conf.CheckpointLimit, info.id, shardID, sequence)
+	if err != nil {
+		return nil, err
+	}
+	b.deaggregate = k.conf.Deaggregate
+	return b, nil
+}
+
+func newAWSKinesisRecordBatcher(
+	batcher service.BatchPolicy,
+	mgr *service.Resources,
+	checkpointLimit int,
+	streamID, shardID, sequence string,
+) (*awsKinesisRecordBatcher, error) {
+	batchPolicy, err := batcher.NewBatcher(mgr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize batch policy for shard consumer: %w", err)
 	}
 
-	return &awsKinesisRecordBatcher{
-		streamID:      info.id,
+	a := &awsKinesisRecordBatcher{
+		streamID:      streamID,
 		shardID:       shardID,
 		batchPolicy:   batchPolicy,
-		checkpointer:  checkpoint.NewCapped[string](int64(k.conf.CheckpointLimit)),
+		checkpointer:  checkpoint.NewCapped[string](int64(checkpointLimit)),
 		ackedSequence: sequence,
-	}, nil
+
+		batchedSequence: sequence,
+	}
+	if resumeSequence, subSequence, ok := parseKinesisSubSequence(sequence); ok {
+		a.resumeSequence, a.resumeSubSequence = resumeSequence, subSequence
+	}
+	return a, nil
 }
 
-func (a *awsKinesisRecordBatcher) AddRecord(r types.Record) bool {
-	p := service.NewMessage(r.Data)
+func (a *awsKinesisRecordBatcher) recordMessage(r types.Record, data []byte) *service.Message {
+	p := service.NewMessage(data)
 	p.MetaSetMut("kinesis_stream", a.streamID)
 	p.MetaSetMut("kinesis_shard", a.shardID)
 	if r.PartitionKey != nil {
 		p.MetaSetMut("kinesis_partition_key", *r.PartitionKey)
 	}
 	p.MetaSetMut("kinesis_sequence_number", *r.SequenceNumber)
+	return p
+}
+
+// AddRecord adds a record to the batch, returning true when a batch is ready to
+// be flushed. When a batch becomes ready part way through the user records of
+// an aggregated record the remaining user records are held until
+// AddRemainingUserRecords is called.
+func (a *awsKinesisRecordBatcher) AddRecord(r types.Record) bool {
+	// Only the first record read after resuming can be the partially consumed
+	// record.
+	resumeFrom := 0
+	if a.resumeSequence != "" {
+		if *r.SequenceNumber == a.resumeSequence {
+			resumeFrom = a.resumeSubSequence + 1
+		}
+		a.resumeSequence = ""
+	}
+
+	if !isKPLAggregated(r.Data) {
+		if resumeFrom > 0 {
+			return false
+		}
+		return a.AddMessage(a.recordMessage(r, r.Data), *r.SequenceNumber)
+	}
+
+	userRecords, err := kplDeaggregate(r.Data)
+	if err != nil {
+		p := a.recordMessage(r, r.Data)
+		p.SetError(err)
+		return a.AddMessage(p, *r.SequenceNumber)
+	}
+	if resumeFrom >= len(userRecords) {
+		return false
+	}
+
+	if !a.deaggregate {
+		// The record can't be partially consumed without deaggregating it, and
+		// therefore it is consumed again in full.
+		return a.AddMessage(a.recordMessage(r, r.Data), kinesisSubSequence(*r.SequenceNumber, len(userRecords)-1))
+	}
+	return a.addUserRecords(r, userRecords, resumeFrom)
+}
+
+// HasRemainingUserRecords returns true when the user records of an aggregated
+// record remain to be added.
+func (a *awsKinesisRecordBatcher) HasRemainingUserRecords() bool {
+	return a.remainingUserRecords != nil
+}
+
+// AddRemainingUserRecords adds the remaining user records of an aggregated
+// record, returning true when a batch is ready to be flushed.
+func (a *awsKinesisRecordBatcher) AddRemainingUserRecords() bool {
+	r, userRecords, from := a.remainingRecord, a.remainingUserRecords, a.remainingFrom
+	a.remainingRecord, a.remainingUserRecords = types.Record{}, nil
+	return a.addUserRecords(r, userRecords, from)
+}
+
+func (a *awsKinesisRecordBatcher) addUserRecords(r types.Record, userRecords []kplRecord, from int) bool {
+	for i := from; i < len(userRecords); i++ {
+		p := a.recordMessage(r, userRecords[i].Data)
+		p.MetaSetMut("kinesis_partition_key", userRecords[i].PartitionKey)
+		p.MetaSetMut("kinesis_sub_sequence_number", strconv.Itoa(i))
+
+		if a.AddMessage(p, kinesisSubSequence(*r.SequenceNumber, i)) {
+			if i+1 < len(userRecords) {
+				a.remainingRecord, a.remainingUserRecords, a.remainingFrom = r, userRecords, i+1
+			}
+			return true
+		}
+	}
+	return false
+}
 
-	a.batchedSequence = *r.SequenceNumber
+// AddMessage adds a message with the sequence number of the record it was
+// created from, returning true when a batch is ready to be flushed.
+func (a *awsKinesisRecordBatcher) AddMessage(p *service.Message, sequence string) bool {
+	a.batchedSequence = sequence
 	if a.flushedMessage != nil {
 		// Upstream shouldn't really be adding records if a prior flush was
 		// unsuccessful. However, we can still accommodate this by appending it
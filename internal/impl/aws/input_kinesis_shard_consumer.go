@@ -0,0 +1,330 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// awsShardSource provides the records of a shard to a consumer.
+type awsShardSource[R any] interface {
+	// Pull returns the next records of the shard, which is empty when no
+	// records are currently available. Finished is true once the end of a
+	// closed shard has been reached. The latest acknowledged sequence is
+	// provided in case the source needs to reposition itself.
+	Pull(ackedSequence string) (records []R, finished bool, err error)
+
+	// WaitChan returns a channel that fires when the source should be pulled
+	// again after a pull yielded no records.
+	WaitChan(boff backoff.BackOff) <-chan time.Time
+
+	// Close stops the source.
+	Close()
+}
+
+// awsShardConsumer consumes the records of a single shard of a Kinesis or
+// DynamoDB stream, and is shared by the aws_kinesis and aws_dynamodb_streams
+// inputs, which only differ in how records are obtained and converted into
+// messages.
+type awsShardConsumer[R any] struct {
+	ctx          context.Context
+	log          *service.Logger
+	clientID     string
+	checkpointer kinesisCheckpointer
+	boffPool     *sync.Pool
+	commitPeriod time.Duration
+	msgChan      chan<- asyncMessage
+
+	// The type of stream for log messages, e.g. Kinesis.
+	streamType string
+	streamID   string
+	shardID    string
+
+	source  awsShardSource[R]
+	batcher *awsKinesisRecordBatcher
+
+	// addRecord adds a record to the batcher, returning true when a batch is
+	// ready to be flushed.
+	addRecord func(r R) bool
+
+	// finish stores the checkpoint of a shard that has been fully consumed.
+	finish func(ctx context.Context) error
+}
+
+// run consumes the shard in the background until it is finished, claimed by
+// another client or the input is closed, at which point the final checkpoint
+// is stored and the wait group is marked as done.
+func (c *awsShardConsumer[R]) run(wg *sync.WaitGroup) {
+	// Keeps track of retry attempts.
+	boff := c.boffPool.Get().(backoff.BackOff)
+
+	// Stores consumed records that have yet to be added to the batcher.
+	var pending []R
+
+	// Keeps track of the latest state of the consumer.
+	state := awsKinesisConsumerConsuming
+	var pendingMsg asyncMessage
+
+	unblockedChan, blockedChan := make(chan time.Time), make(chan time.Time)
+	close(unblockedChan)
+
+	// Channels (and contexts) representing the four main actions of the
+	// consumer goroutine:
+	// 1. Timed batches, this might be nil when timed batches are disabled.
+	// 2. Record pulling, this might be unblocked (closed channel) when we run
+	//    out of pending records, or a timed channel when our last attempt
+	//    yielded zero records.
+	// 3. Message flush, this is the target of our current batched message, and
+	//    is nil when our current batched message is a zero value (we don't have
+	//    one prepared).
+	// 4. Next commit, is "done" when the next commit is due.
+	var nextTimedBatchChan <-chan time.Time
+	var nextPullChan <-chan time.Time = unblockedChan
+	var nextFlushChan chan<- asyncMessage
+	commitCtx, commitCtxClose := context.WithTimeout(c.ctx, c.commitPeriod)
+
+	go func() {
+		defer func() {
+			commitCtxClose()
+			c.source.Close()
+			c.batcher.Close(context.Background(), state == awsKinesisConsumerFinished)
+			boff.Reset()
+			c.boffPool.Put(boff)
+
+			reason := ""
+			switch state {
+			case awsKinesisConsumerFinished:
+				reason = " because the shard is closed"
+				if err := c.finish(c.ctx); err != nil {
+					c.log.Errorf("Failed to checkpoint finished stream '%v' shard '%v': %v", c.streamID, c.shardID, err)
+				}
+			case awsKinesisConsumerYielding:
+				reason = " because the shard has been claimed by another client"
+				if err := c.checkpointer.Yield(c.ctx, c.streamID, c.shardID, c.batcher.GetSequence()); err != nil {
+					c.log.Errorf("Failed to yield checkpoint for stolen stream '%v' shard '%v': %v", c.streamID, c.shardID, err)
+				}
+			case awsKinesisConsumerClosing:
+				reason = " because the pipeline is shutting down"
+				if _, err := c.checkpointer.Checkpoint(context.Background(), c.streamID, c.shardID, c.batcher.GetSequence(), true); err != nil {
+					c.log.Errorf("Failed to store final checkpoint for stream '%v' shard '%v': %v", c.streamID, c.shardID, err)
+				}
+			}
+
+			wg.Done()
+			c.log.Debugf("Closing stream '%v' shard '%v' as client '%v'%v", c.streamID, c.shardID, c.clientID, reason)
+		}()
+
+		c.log.Debugf("Consuming stream '%v' shard '%v' as client '%v'", c.streamID, c.shardID, c.clientID)
+
+		// Switches our pull chan to unblocked only if it's currently blocked,
+		// as otherwise it's set to a timed channel that we do not want to
+		// disturb.
+		unblockPullChan := func() {
+			if nextPullChan == blockedChan {
+				nextPullChan = unblockedChan
+			}
+		}
+
+		for {
+			var err error
+			if state == awsKinesisConsumerConsuming && len(pending) == 0 && nextPullChan == unblockedChan {
+				var finished bool
+				if pending, finished, err = c.source.Pull(c.batcher.GetSequence()); err != nil {
+					if !awsErrIsTimeout(err) {
+						nextPullChan = time.After(boff.NextBackOff())
+						c.log.Errorf("Failed to pull %v records: %v", c.streamType, err)
+					}
+				} else if len(pending) == 0 {
+					nextPullChan = c.source.WaitChan(boff)
+				} else {
+					boff.Reset()
+					nextPullChan = blockedChan
+				}
+				if finished {
+					state = awsKinesisConsumerFinished
+				}
+			} else {
+				unblockPullChan()
+			}
+
+			if pendingMsg.msg == nil {
+				// If our consumer is finished and we've run out of pending
+				// records then we're done.
+				if len(pending) == 0 && !c.batcher.HasRemainingUserRecords() && state == awsKinesisConsumerFinished {
+					if pendingMsg, _ = c.batcher.FlushMessage(c.ctx); pendingMsg.msg == nil {
+						return
+					}
+				} else if c.batcher.HasPendingMessage() {
+					if pendingMsg, err = c.batcher.FlushMessage(commitCtx); err != nil {
+						c.log.Errorf("Failed to dispatch message due to checkpoint error: %v", err)
+					}
+				} else if c.batcher.HasRemainingUserRecords() {
+					if c.batcher.AddRemainingUserRecords() {
+						if pendingMsg, err = c.batcher.FlushMessage(commitCtx); err != nil {
+							c.log.Errorf("Failed to dispatch message due to checkpoint error: %v", err)
+						}
+					}
+				} else if len(pending) > 0 {
+					var i int
+					var r R
+					for i, r = range pending {
+						if c.addRecord(r) {
+							if pendingMsg, err = c.batcher.FlushMessage(commitCtx); err != nil {
+								c.log.Errorf("Failed to dispatch message due to checkpoint error: %v", err)
+							}
+							break
+						}
+					}
+					if pending = pending[i+1:]; len(pending) == 0 {
+						unblockPullChan()
+					}
+				} else {
+					unblockPullChan()
+				}
+			}
+
+			if pendingMsg.msg != nil {
+				nextFlushChan = c.msgChan
+			} else {
+				nextFlushChan = nil
+			}
+
+			if nextTimedBatchChan == nil {
+				if tNext, exists := c.batcher.UntilNext(); exists {
+					nextTimedBatchChan = time.After(tNext)
+				}
+			}
+
+			select {
+			case <-commitCtx.Done():
+				if c.ctx.Err() != nil {
+					// It could've been our parent context that closed, in which
+					// case we exit.
+					state = awsKinesisConsumerClosing
+					return
+				}
+
+				commitCtxClose()
+				commitCtx, commitCtxClose = context.WithTimeout(c.ctx, c.commitPeriod)
+
+				stillOwned, err := c.checkpointer.Checkpoint(c.ctx, c.streamID, c.shardID, c.batcher.GetSequence(), false)
+				if err != nil {
+					c.log.Errorf("Failed to store checkpoint for %v stream '%v' shard '%v': %v", c.streamType, c.streamID, c.shardID, err)
+				} else if !stillOwned {
+					state = awsKinesisConsumerYielding
+					return
+				}
+			case <-nextTimedBatchChan:
+				nextTimedBatchChan = nil
+			case nextFlushChan <- pendingMsg:
+				pendingMsg = asyncMessage{}
+			case <-nextPullChan:
+				nextPullChan = unblockedChan
+			case <-c.ctx.Done():
+				state = awsKinesisConsumerClosing
+				return
+			}
+		}
+	}()
+}
+
+//------------------------------------------------------------------------------
+
+// balanceShardClaims attempts to claim the unclaimed shards of a stream, which
+// map to the client that last held the expired claim of the shard, or empty
+// when the shard was never claimed. When there are no unclaimed shards an
+// attempt is made to steal a shard from a client holding at least two shards
+// more than this one. The provided function claims a shard and starts
+// consuming it, returning false when the shard did not need consuming.
+func balanceShardClaims(
+	ctx context.Context,
+	log *service.Logger,
+	clientID, streamID string,
+	unclaimedShards map[string]string,
+	clientClaims map[string][]awsKinesisClientClaim,
+	claimAndRun func(shardID, fromClientID string) (bool, error),
+) {
+	// Have a go at grabbing any unclaimed shards
+	if len(unclaimedShards) > 0 {
+		for shardID, fromClientID := range unclaimedShards {
+			if _, err := claimAndRun(shardID, fromClientID); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !errors.Is(err, ErrLeaseNotAcquired) {
+					log.Errorf("Failed to claim unclaimed shard '%v': %v", shardID, err)
+				}
+			}
+		}
+
+		// If there are unclaimed shards then let's not resort to thievery
+		// just yet.
+		return
+	}
+
+	// There were no unclaimed shards, let's look for a shard to steal.
+	selfClaims := len(clientClaims[clientID])
+	for fromClientID, claims := range clientClaims {
+		if fromClientID == clientID {
+			// Don't steal from ourself, we're not at that point yet.
+			continue
+		}
+
+		// This is an extremely naive "algorithm", we simply randomly iterate
+		// all other clients with shards and if any have two more shards than
+		// we do then it's fair game. Using two here so that we don't play hot
+		// potatoes with an odd shard.
+		if len(claims) > (selfClaims + 1) {
+			randomShard := claims[(rand.Int() % len(claims))].ShardID
+			log.Debugf(
+				"Attempting to steal stream '%v' shard '%v' from client '%v' as client '%v'",
+				streamID, randomShard, fromClientID, clientID,
+			)
+
+			started, err := claimAndRun(randomShard, fromClientID)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !errors.Is(err, ErrLeaseNotAcquired) {
+					log.Errorf("Failed to steal shard '%v': %v", randomShard, err)
+				}
+				log.Debugf(
+					"Aborting theft of stream '%v' shard '%v' from client '%v' as client '%v'",
+					streamID, randomShard, fromClientID, clientID,
+				)
+				continue
+			}
+			if started {
+				log.Debugf(
+					"Successfully stole stream '%v' shard '%v' from client '%v' as client '%v'",
+					streamID, randomShard, fromClientID, clientID,
+				)
+
+				// If we successfully stole the shard then that's enough for
+				// now.
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// kinesisShardSource provides the records of a Kinesis shard to a consumer.
+type kinesisShardSource = awsShardSource[types.Record]
+
+func (k *kinesisReader) newShardSource(info streamInfo, shardID, startingSequence string, fromOldest bool) (kinesisShardSource, error) {
+	if info.consumerARN != "" {
+		return k.newFanOutShardSource(info, shardID, startingSequence, fromOldest), nil
+	}
+	iter, err := k.getIter(info, shardID, startingSequence, fromOldest)
+	if err != nil {
+		return nil, err
+	}
+	return &kinesisPollingShardSource{
+		k:          k,
+		info:       info,
+		shardID:    shardID,
+		fromOldest: fromOldest,
+		iter:       iter,
+	}, nil
+}
+
+//------------------------------------------------------------------------------
+
+// kinesisPollingShardSource pulls records from a shard with GetRecords.
+type kinesisPollingShardSource struct {
+	k          *kinesisReader
+	info       streamInfo
+	shardID    string
+	fromOldest bool
+	iter       string
+}
+
+func (p *kinesisPollingShardSource) Pull(ackedSequence string) ([]types.Record, bool, error) {
+	records, iter, err := p.k.getRecords(p.info, p.shardID, p.iter)
+	if err != nil {
+		var aerr *types.ExpiredIteratorException
+		if !errors.As(err, &aerr) {
+			return nil, false, err
+		}
+
+		p.k.log.Warn("Shard iterator expired, attempting to refresh")
+		if iter, err = p.k.getIter(p.info, p.shardID, ackedSequence, p.fromOldest); err != nil {
+			return nil, false, fmt.Errorf("failed to refresh shard iterator: %w", err)
+		}
+	}
+	p.iter = iter
+
+	// The getRecords method ensures that it returns the input iterator
+	// whenever it errors out. Therefore, if iter is now empty we have
+	// definitely reached the end of the shard.
+	return records, p.iter == "", nil
+}
+
+func (p *kinesisPollingShardSource) WaitChan(boff backoff.BackOff) <-chan time.Time {
+	return time.After(boff.NextBackOff())
+}
+
+func (p *kinesisPollingShardSource) Close() {}
+
+//------------------------------------------------------------------------------
+
+type kinesisFanOutEvent struct {
+	records  []types.Record
+	finished bool
+}
+
+// The number of subscription events that are buffered before the subscription
+// is no longer read from, applying back pressure until records are pulled.
+const kinesisFanOutBufferedEvents = 8
+
+type kinesisSubscribeFn func(ctx context.Context, position types.StartingPosition) (*kinesis.SubscribeToShardEventStream, error)
+
+// kinesisFanOutShardSource receives records pushed to a registered stream
+// consumer with SubscribeToShard. Subscriptions expire after five minutes, at
+// which point the shard is subscribed to again from the continuation sequence
+// of the last event.
+type kinesisFanOutShardSource struct {
+	subscribe kinesisSubscribeFn
+	log       *service.Logger
+	streamID  string
+	shardID   string
+
+	events chan kinesisFanOutEvent
+	ready  chan time.Time
+
+	ctx        context.Context
+	done       func()
+	closedChan chan struct{}
+}
+
+func (k *kinesisReader) newFanOutShardSource(info streamInfo, shardID, startingSequence string, fromOldest bool) *kinesisFanOutShardSource {
+	position := types.StartingPosition{Type: types.ShardIteratorTypeTrimHorizon}
+	if !fromOldest {
+		position.Type = types.ShardIteratorTypeLatest
+	}
+	if startingSequence != "" {
+		iterType, sequence := kinesisIteratorPosition(startingSequence)
+		position = types.StartingPosition{
+			Type:           iterType,
+			SequenceNumber: &sequence,
+		}
+	}
+
+	consumerARN := info.consumerARN
+	subscribe := func(ctx context.Context, position types.StartingPosition) (*kinesis.SubscribeToShardEventStream, error) {
+		res, err := k.svc.SubscribeToShard(ctx, &kinesis.SubscribeToShardInput{
+			ConsumerARN:      &consumerARN,
+			ShardId:          &shardID,
+			StartingPosition: &position,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res.GetStream(), nil
+	}
+	return startFanOutShardSource(k.ctx, k.log, subscribe, info.id, shardID, position)
+}
+
+func startFanOutShardSource(ctx context.Context, log *service.Logger, subscribe kinesisSubscribeFn, streamID, shardID string, position types.StartingPosition) *kinesisFanOutShardSource {
+	f := &kinesisFanOutShardSource{
+		subscribe:  subscribe,
+		log:        log,
+		streamID:   streamID,
+		shardID:    shardID,
+		events:     make(chan kinesisFanOutEvent, kinesisFanOutBufferedEvents),
+		ready:      make(chan time.Time, 1),
+		closedChan: make(chan struct{}),
+	}
+	f.ctx, f.done = context.WithCancel(ctx)
+
+	go f.loop(position)
+	return f
+}
+
+func (f *kinesisFanOutShardSource) loop(position types.StartingPosition) {
+	defer close(f.closedChan)
+
+	boff := backoff.NewExponentialBackOff()
+	boff.InitialInterval = time.Millisecond * 300
+	boff.MaxInterval = time.Second * 5
+	boff.MaxElapsedTime = 0
+
+	for {
+		stream, err := f.subscribe(f.ctx, position)
+		if err == nil {
+			var finished bool
+			finished, err = f.consume(stream, &position)
+			_ = stream.Close()
+			if finished {
+				return
+			}
+		}
+		if f.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			f.log.Errorf("Failed to subscribe to stream '%v' shard '%v': %v", f.streamID, f.shardID, err)
+			select {
+			case <-time.After(boff.NextBackOff()):
+			case <-f.ctx.Done():
+				return
+			}
+			continue
+		}
+		boff.Reset()
+	}
+}
+
+// consume reads the events of a subscription until it expires, and returns
+// true once the end of the shard has been reached or the source is closed.
+func (f *kinesisFanOutShardSource) consume(stream *kinesis.SubscribeToShardEventStream, position *types.StartingPosition) (bool, error) {
+	for {
+		var e types.SubscribeToShardEventStream
+		var open bool
+		select {
+		case e, open = <-stream.Events():
+			if !open {
+				return false, stream.Err()
+			}
+		case <-f.ctx.Done():
+			return true, nil
+		}
+
+		event, ok := e.(*types.SubscribeToShardEventStreamMemberSubscribeToShardEvent)
+		if !ok {
+			continue
+		}
+
+		// A missing continuation sequence indicates that the shard is closed
+		// and all of its records have been delivered.
+		finished := event.Value.ContinuationSequenceNumber == nil
+		if !finished {
+			*position = types.StartingPosition{
+				Type:           types.ShardIteratorTypeAfterSequenceNumber,
+				SequenceNumber: event.Value.ContinuationSequenceNumber,
+			}
+		}
+
+		if len(event.Value.Records) > 0 || finished {
+			// The consumer only waits for the ready signal after a pull
+			// yielded nothing, i.e. once the buffer is drained, and therefore
+			// the signal must be sent as soon as an event is buffered.
+			select {
+			case f.events <- kinesisFanOutEvent{records: event.Value.Records, finished: finished}:
+			case <-f.ctx.Done():
+				return true, nil
+			}
+			select {
+			case f.ready <- time.Now():
+			default:
+			}
+		}
+		if finished {
+			return true, nil
+		}
+	}
+}
+
+func (f *kinesisFanOutShardSource) Pull(string) ([]types.Record, bool, error) {
+	select {
+	case e := <-f.events:
+		return e.records, e.finished, nil
+	default:
+	}
+	return nil, false, nil
+}
+
+func (f *kinesisFanOutShardSource) WaitChan(backoff.BackOff) <-chan time.Time {
+	return f.ready
+}
+
+func (f *kinesisFanOutShardSource) Close() {
+	f.done()
+	<-f.closedChan
+}
+
+//------------------------------------------------------------------------------
+
+// registerStreamConsumer obtains the ARN of the enhanced fan-out consumer of a
+// stream, registering the consumer when it does not yet exist, and waits for
+// it to become active.
+func (k *kinesisReader) registerStreamConsumer(ctx context.Context, info *streamInfo) error {
+	name := k.conf.EnhancedFanOut.ConsumerName
+	for {
+		res, err := k.svc.DescribeStreamConsumer(ctx, &kinesis.DescribeStreamConsumerInput{
+			StreamARN:    &info.arn,
+			ConsumerName: &name,
+		})
+		if err != nil {
+			var nfErr *types.ResourceNotFoundException
+			if !errors.As(err, &nfErr) {
+				return fmt.Errorf("failed to describe stream '%v' consumer '%v': %w", info.id, name, err)
+			}
+
+			k.log.Infof("Registering stream '%v' consumer '%v'", info.id, name)
+			if _, err = k.svc.RegisterStreamConsumer(ctx, &kinesis.RegisterStreamConsumerInput{
+				StreamARN:    &info.arn,
+				ConsumerName: &name,
+			}); err != nil {
+				// Another client might have registered the consumer first.
+				var inUseErr *types.ResourceInUseException
+				if !errors.As(err, &inUseErr) {
+					return fmt.Errorf("failed to register stream '%v' consumer '%v': %w", info.id, name, err)
+				}
+			}
+		} else if res.ConsumerDescription.ConsumerStatus == types.ConsumerStatusActive {
+			info.consumerARN = *res.ConsumerDescription.ConsumerARN
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -15,10 +15,19 @@
 package aws
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/cenkalti/backoff/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
 )
 
 func TestStreamIDParser(t *testing.T) {
@@ -78,3 +87,242 @@ func TestStreamIDParser(t *testing.T) {
 		})
 	}
 }
+
+func TestKinesisReaderConfigValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		conf        kiConfig
+		errContains string
+	}{
+		{
+			name: "kcl single stream",
+			conf: kiConfig{
+				Streams:  []string{"foo"},
+				DynamoDB: kiddbConfig{KCLCompatible: true},
+			},
+		},
+		{
+			name: "kcl multiple streams",
+			conf: kiConfig{
+				Streams:  []string{"foo", "bar"},
+				DynamoDB: kiddbConfig{KCLCompatible: true},
+			},
+			errContains: "only a single stream",
+		},
+		{
+			name: "fan out with consumer name",
+			conf: kiConfig{
+				Streams:        []string{"foo"},
+				EnhancedFanOut: kiefoConfig{Enabled: true, ConsumerName: "bar"},
+			},
+		},
+		{
+			name: "fan out without consumer name",
+			conf: kiConfig{
+				Streams:        []string{"foo"},
+				EnhancedFanOut: kiefoConfig{Enabled: true},
+			},
+			errContains: "consumer name must be specified",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.conf.CommitPeriod = "5s"
+			test.conf.LeasePeriod = "30s"
+			test.conf.RebalancePeriod = "30s"
+
+			_, err := newKinesisReaderFromConfig(test.conf, service.BatchPolicy{}, aws.Config{}, service.MockResources())
+			if test.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+type fakeShardEventStream struct {
+	events    chan types.SubscribeToShardEventStream
+	closeOnce sync.Once
+}
+
+func (f *fakeShardEventStream) Events() <-chan types.SubscribeToShardEventStream {
+	return f.events
+}
+
+func (f *fakeShardEventStream) Close() error {
+	return nil
+}
+
+func (f *fakeShardEventStream) Err() error {
+	return nil
+}
+
+// expire closes the subscription in the same way as the five minute expiry.
+func (f *fakeShardEventStream) expire() {
+	f.closeOnce.Do(func() { close(f.events) })
+}
+
+func shardEvent(continuation *string, data ...string) types.SubscribeToShardEventStream {
+	event := &types.SubscribeToShardEventStreamMemberSubscribeToShardEvent{}
+	event.Value.ContinuationSequenceNumber = continuation
+	for _, d := range data {
+		event.Value.Records = append(event.Value.Records, types.Record{
+			Data:           []byte(d),
+			SequenceNumber: aws.String(d),
+		})
+	}
+	return event
+}
+
+func TestKinesisFanOutShardSource(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	subs := make(chan *fakeShardEventStream, 2)
+	var positions []types.StartingPosition
+	subscribe := func(ctx context.Context, position types.StartingPosition) (*kinesis.SubscribeToShardEventStream, error) {
+		positions = append(positions, position)
+		stream := &fakeShardEventStream{events: make(chan types.SubscribeToShardEventStream)}
+		subs <- stream
+		return kinesis.NewSubscribeToShardEventStream(func(s *kinesis.SubscribeToShardEventStream) {
+			s.Reader = stream
+		}), nil
+	}
+
+	source := startFanOutShardSource(ctx, service.MockResources().Logger(), subscribe, "foo", "bar", types.StartingPosition{
+		Type: types.ShardIteratorTypeTrimHorizon,
+	})
+	defer source.Close()
+
+	boff := backoff.NewConstantBackOff(time.Millisecond)
+
+	waitFor := func(data ...string) bool {
+		t.Helper()
+		select {
+		case <-source.WaitChan(boff):
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for records")
+		}
+		records, finished, err := source.Pull("")
+		require.NoError(t, err)
+		var actual []string
+		for _, r := range records {
+			actual = append(actual, string(r.Data))
+		}
+		assert.Equal(t, data, actual)
+		return finished
+	}
+
+	// Nothing is available until the subscription delivers an event.
+	records, finished, err := source.Pull("")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.False(t, finished)
+
+	stream := <-subs
+	stream.events <- shardEvent(aws.String("2"), "1", "2")
+	assert.False(t, waitFor("1", "2"))
+
+	// Events without records are not surfaced.
+	stream.events <- shardEvent(aws.String("2"))
+	stream.events <- shardEvent(aws.String("3"), "3")
+	assert.False(t, waitFor("3"))
+
+	// An expired subscription resumes from the last continuation sequence.
+	stream.expire()
+	stream = <-subs
+	stream.events <- shardEvent(nil, "4")
+	assert.True(t, waitFor("4"))
+
+	source.Close()
+	require.Len(t, positions, 2)
+	assert.Equal(t, types.ShardIteratorTypeTrimHorizon, positions[0].Type)
+	assert.Equal(t, types.ShardIteratorTypeAfterSequenceNumber, positions[1].Type)
+	assert.Equal(t, "3", aws.ToString(positions[1].SequenceNumber))
+}
+
+func TestKCLReadyShards(t *testing.T) {
+	closed := func(id string, parents ...string) types.Shard {
+		s := types.Shard{
+			ShardId: aws.String(id),
+			SequenceNumberRange: &types.SequenceNumberRange{
+				StartingSequenceNumber: aws.String("1"),
+				EndingSequenceNumber:   aws.String("2"),
+			},
+		}
+		if len(parents) > 0 {
+			s.ParentShardId = aws.String(parents[0])
+		}
+		if len(parents) > 1 {
+			s.AdjacentParentShardId = aws.String(parents[1])
+		}
+		return s
+	}
+	open := func(id string, parents ...string) types.Shard {
+		s := closed(id, parents...)
+		s.SequenceNumberRange.EndingSequenceNumber = nil
+		return s
+	}
+
+	for _, test := range []struct {
+		name        string
+		shards      []types.Shard
+		checkpoints map[string]string
+		exp         map[string]bool
+	}{
+		{
+			name:   "no lineage",
+			shards: []types.Shard{open("a"), open("b")},
+			checkpoints: map[string]string{
+				"a": "123",
+				"b": kclCheckpointTrimHorizon,
+			},
+			exp: map[string]bool{"a": false, "b": true},
+		},
+		{
+			name:        "closed parent with partial checkpoint",
+			shards:      []types.Shard{closed("parent"), open("child", "parent")},
+			checkpoints: map[string]string{"parent": "123"},
+			exp:         map[string]bool{"parent": false},
+		},
+		{
+			name:        "closed parent with initial checkpoint",
+			shards:      []types.Shard{closed("parent"), open("child", "parent")},
+			checkpoints: map[string]string{"parent": kclCheckpointTrimHorizon},
+			exp:         map[string]bool{"parent": true},
+		},
+		{
+			name:        "finished parent",
+			shards:      []types.Shard{closed("parent"), open("child", "parent")},
+			checkpoints: map[string]string{"parent": kclCheckpointShardEnd, "child": kclCheckpointLatest},
+			exp:         map[string]bool{"child": true},
+		},
+		{
+			name:   "closed parent without lease",
+			shards: []types.Shard{closed("parent"), open("child", "parent")},
+			exp:    map[string]bool{"child": true},
+		},
+		{
+			name:   "trimmed parent",
+			shards: []types.Shard{open("child", "parent")},
+			exp:    map[string]bool{"child": false},
+		},
+		{
+			name:   "merged parents",
+			shards: []types.Shard{closed("a"), closed("b"), open("child", "a", "b")},
+			checkpoints: map[string]string{
+				"a": kclCheckpointShardEnd,
+				"b": "123",
+			},
+			exp: map[string]bool{"b": false},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.exp, kclReadyShards(test.shards, test.checkpoints))
+		})
+	}
+}
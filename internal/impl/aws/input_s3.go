@@ -47,6 +47,7 @@ const (
 	s3iSQSFieldDelayPeriod     = "delay_period"
 	s3iSQSFieldMaxMessages     = "max_messages"
 	s3iSQSFieldWaitTimeSeconds = "wait_time_seconds"
+	s3iSQSFieldEventFormat     = "event_format"
 
 	// S3 Input Fields
 	s3iFieldBucket             = "bucket"
@@ -54,6 +55,12 @@ const (
 	s3iFieldForcePathStyleURLs = "force_path_style_urls"
 	s3iFieldDeleteObjects      = "delete_objects"
 	s3iFieldSQS                = "sqs"
+	s3iFieldInventory          = "inventory"
+)
+
+const (
+	s3iSQSEventFormatNotification = "s3_notification"
+	s3iSQSEventFormatEventBridge  = "eventbridge"
 )
 
 type s3iSQSConfig struct {
@@ -65,6 +72,7 @@ type s3iSQSConfig struct {
 	DelayPeriod     string
 	MaxMessages     int64
 	WaitTimeSeconds int64
+	EventFormat     string
 }
 
 func s3iSQSConfigFromParsed(pConf *service.ParsedConfig) (conf s3iSQSConfig, err error) {
@@ -92,6 +100,9 @@ func s3iSQSConfigFromParsed(pConf *service.ParsedConfig) (conf s3iSQSConfig, err
 	if conf.WaitTimeSeconds, err = int64Field(pConf, s3iSQSFieldWaitTimeSeconds); err != nil {
 		return
 	}
+	if conf.EventFormat, err = pConf.FieldString(s3iSQSFieldEventFormat); err != nil {
+		return
+	}
 	return
 }
 
@@ -101,6 +112,7 @@ type s3iConfig struct {
 	ForcePathStyleURLs bool
 	DeleteObjects      bool
 	SQS                s3iSQSConfig
+	Inventory          s3iInventoryConfig
 	CodecCtor          codec.DeprecatedFallbackCodec
 }
 
@@ -125,6 +137,11 @@ func s3iConfigFromParsed(pConf *service.ParsedConfig) (conf s3iConfig, err error
 			return
 		}
 	}
+	if pConf.Contains(s3iFieldInventory) {
+		if conf.Inventory, err = s3iInventoryConfigFromParsed(pConf.Namespace(s3iFieldInventory)); err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -142,8 +159,16 @@ Redpanda Connect is able to follow this pattern when you configure an `+"`sqs.ur
 
 If your notification events are being routed to SQS via an SNS topic then the events will be enveloped by SNS, in which case you also need to specify the field `+"`sqs.envelope_path`"+`, which in the case of SNS to SQS will usually be `+"`Message`"+`.
 
+If your bucket publishes events to Amazon EventBridge and a rule routes them to the SQS queue then set `+"`sqs.event_format`"+` to `+"`eventbridge`"+`, in which case the key and bucket of `+"`Object Created`"+` events are extracted from the event details and all other events are removed from the queue.
+
 When using SQS please make sure you have sensible values for `+"`sqs.max_messages`"+` and also the visibility timeout of the queue itself. When Redpanda Connect consumes an S3 object the SQS message that triggered it is not deleted until the S3 object has been sent onwards. This ensures at-least-once crash resiliency, but also means that if the S3 object takes longer to process than the visibility timeout of your queue then the same objects might be processed multiple times.
 
+== Enumerate objects from S3 Inventory
+
+Listing a bucket with billions of objects is slow, and for backfills it's often more efficient to enumerate objects from an https://docs.aws.amazon.com/AmazonS3/latest/userguide/storage-inventory.html[S3 Inventory^] report. When the field `+"`inventory.manifest`"+` is set to the location of a `+"`manifest.json`"+` file the CSV or Parquet files of the report are read in order to determine which objects to download. Delete markers and noncurrent versions are skipped, and the field `+"`prefix`"+` can be used in order to filter the keys of the report.
+
+Progress through the report can be checkpointed in a `+"xref:components:caches/about.adoc[cache]"+` by specifying `+"`inventory.checkpoint_cache`"+`, in which case a restarted input resumes from the last object that was processed along with all objects before it.
+
 == Download large files
 
 When downloading large files it's often necessary to process it in streamed parts in order to avoid loading the entire file in memory at a given time. In order to do this a `+"<<scanner, `scanner`>>"+` can be specified that determines how to break the input into smaller individual messages.
@@ -171,7 +196,7 @@ You can access these metadata fields using xref:configuration:interpolation.adoc
 				Description("The bucket to consume from. If the field `sqs.url` is specified this field is optional.").
 				Default(""),
 			service.NewStringField(s3iFieldPrefix).
-				Description("An optional path prefix, if set only objects with the prefix are consumed when walking a bucket.").
+				Description("An optional path prefix, if set only objects with the prefix are consumed when walking a bucket or reading an inventory report.").
 				Default(""),
 		).
 		Fields(config.SessionFields()...).
@@ -219,9 +244,17 @@ You can access these metadata fields using xref:configuration:interpolation.adoc
 					Description("Whether to set the wait time. Enabling this activates long-polling. Valid values: 0 to 20.").
 					Default(0).
 					Advanced(),
+				service.NewStringAnnotatedEnumField(s3iSQSFieldEventFormat, map[string]string{
+					s3iSQSEventFormatNotification: "S3 event notifications, where keys and buckets are extracted with the fields `key_path` and `bucket_path`.",
+					s3iSQSEventFormatEventBridge:  "S3 events delivered by an EventBridge rule, where `Object Created` events trigger downloads and all other events are deleted from the queue.",
+				}).
+					Description("The format of the events consumed from SQS.").
+					Version("4.31.0").
+					Default(s3iSQSEventFormatNotification),
 			).
 				Description("Consume SQS messages in order to trigger key downloads.").
 				Optional(),
+			s3iInventoryConfigField(),
 		)
 }
 
@@ -475,6 +508,10 @@ func (s *sqsTargetReader) parseObjectPaths(sqsMsg *string) ([]s3ObjectTarget, er
 		}
 	}
 
+	if s.conf.SQS.EventFormat == s3iSQSEventFormatEventBridge {
+		return s.parseEventBridgeObjectPaths(gObj)
+	}
+
 	var keys []string
 	var buckets []string
 
@@ -514,6 +551,29 @@ func (s *sqsTargetReader) parseObjectPaths(sqsMsg *string) ([]s3ObjectTarget, er
 	return objects, nil
 }
 
+// parseEventBridgeObjectPaths extracts the object of an EventBridge S3 event,
+// and returns zero objects for events other than object creations.
+func (s *sqsTargetReader) parseEventBridgeObjectPaths(gObj *gabs.Container) ([]s3ObjectTarget, error) {
+	if detailType, _ := gObj.S("detail-type").Data().(string); detailType != "Object Created" {
+		return nil, nil
+	}
+
+	// Unlike S3 event notifications the object keys of EventBridge events are
+	// not URL encoded.
+	key, _ := gObj.Path("detail.object.key").Data().(string)
+	if key == "" {
+		return nil, errors.New("required key was not found in EventBridge event")
+	}
+	bucket, _ := gObj.Path("detail.bucket.name").Data().(string)
+	if bucket == "" {
+		bucket = s.conf.Bucket
+	}
+	if bucket == "" {
+		return nil, errors.New("required bucket was not found in EventBridge event")
+	}
+	return []s3ObjectTarget{{key: key, bucket: bucket}}, nil
+}
+
 func (s *sqsTargetReader) readSQSEvents(ctx context.Context) ([]*s3ObjectTarget, error) {
 	var dudMessageHandles []sqstypes.ChangeMessageVisibilityBatchRequestEntry
 	addDudFn := func(m sqstypes.Message) {
@@ -524,6 +584,14 @@ func (s *sqsTargetReader) readSQSEvents(ctx context.Context) ([]*s3ObjectTarget,
 		})
 	}
 
+	var ignoredMessageHandles []sqstypes.DeleteMessageBatchRequestEntry
+	addIgnoredFn := func(m sqstypes.Message) {
+		ignoredMessageHandles = append(ignoredMessageHandles, sqstypes.DeleteMessageBatchRequestEntry{
+			Id:            m.MessageId,
+			ReceiptHandle: m.ReceiptHandle,
+		})
+	}
+
 	output, err := s.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
 		QueueUrl:            &s.conf.SQS.URL,
 		MaxNumberOfMessages: int32(s.conf.SQS.MaxMessages),
@@ -564,6 +632,11 @@ func (s *sqsTargetReader) readSQSEvents(ctx context.Context) ([]*s3ObjectTarget,
 			continue
 		}
 		if len(objects) == 0 {
+			if s.conf.SQS.EventFormat == s3iSQSEventFormatEventBridge {
+				addIgnoredFn(sqsMsg)
+				s.log.Trace("Ignoring EventBridge event other than an object creation")
+				continue
+			}
 			addDudFn(sqsMsg)
 			s.log.Debug("Extracted zero target keys from SQS message")
 			continue
@@ -622,6 +695,22 @@ func (s *sqsTargetReader) readSQSEvents(ctx context.Context) ([]*s3ObjectTarget,
 		_, _ = s.sqs.ChangeMessageVisibilityBatch(ctx, &input)
 	}
 
+	// Delete any SQS messages of events that we aren't interested in.
+	for len(ignoredMessageHandles) > 0 {
+		input := sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(s.conf.SQS.URL),
+			Entries:  ignoredMessageHandles,
+		}
+
+		// trim input entries to max size
+		if len(ignoredMessageHandles) > 10 {
+			input.Entries, ignoredMessageHandles = ignoredMessageHandles[:10], ignoredMessageHandles[10:]
+		} else {
+			ignoredMessageHandles = nil
+		}
+		_, _ = s.sqs.DeleteMessageBatch(ctx, &input)
+	}
+
 	return pendingObjects, nil
 }
 
@@ -662,6 +751,7 @@ type awsS3Reader struct {
 	object    *s3PendingObject
 
 	log *service.Logger
+	mgr *service.Resources
 }
 
 type s3PendingObject struct {
@@ -673,16 +763,23 @@ type s3PendingObject struct {
 
 // NewAmazonS3 creates a new Amazon S3 bucket reader.Type.
 func newAmazonS3Reader(conf s3iConfig, awsConf aws.Config, nm *service.Resources) (*awsS3Reader, error) {
-	if conf.Bucket == "" && conf.SQS.URL == "" {
-		return nil, errors.New("either a bucket or an sqs.url must be specified")
+	if conf.Bucket == "" && conf.SQS.URL == "" && conf.Inventory.Manifest == "" {
+		return nil, errors.New("either a bucket, an sqs.url or an inventory.manifest must be specified")
 	}
 	if conf.Prefix != "" && conf.SQS.URL != "" {
 		return nil, errors.New("cannot specify both a prefix and sqs.url")
 	}
+	if conf.Inventory.Manifest != "" && conf.SQS.URL != "" {
+		return nil, errors.New("cannot specify both an inventory.manifest and sqs.url")
+	}
+	if conf.Inventory.CheckpointCache != "" && !nm.HasCache(conf.Inventory.CheckpointCache) {
+		return nil, fmt.Errorf("cache resource '%v' was not found", conf.Inventory.CheckpointCache)
+	}
 	s := &awsS3Reader{
 		conf:              conf,
 		awsConf:           awsConf,
 		log:               nm.Logger(),
+		mgr:               nm,
 		objectScannerCtor: conf.CodecCtor,
 	}
 	if conf.SQS.DelayPeriod != "" {
@@ -698,6 +795,9 @@ func (a *awsS3Reader) getTargetReader(ctx context.Context) (s3ObjectTargetReader
 	if a.sqs != nil {
 		return newSQSTargetReader(a.conf, a.log, a.s3, a.sqs), nil
 	}
+	if a.conf.Inventory.Manifest != "" {
+		return newInventoryTargetReader(ctx, a.conf, a.log, a.mgr, a.s3)
+	}
 	return newStaticTargetReader(ctx, a.conf, a.log, a.s3)
 }
 
@@ -860,5 +960,10 @@ func (a *awsS3Reader) Close(ctx context.Context) (err error) {
 		err = a.object.scanner.Close(ctx)
 		a.object = nil
 	}
+	if a.keyReader != nil {
+		if kerr := a.keyReader.Close(ctx); kerr != nil && err == nil {
+			err = kerr
+		}
+	}
 	return
 }
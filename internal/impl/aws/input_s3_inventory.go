@@ -0,0 +1,645 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/checkpoint"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// S3 Input Inventory Fields
+	s3iInvFieldManifest         = "manifest"
+	s3iInvFieldCheckpointCache  = "checkpoint_cache"
+	s3iInvFieldCheckpointKey    = "checkpoint_key"
+	s3iInvFieldCheckpointPeriod = "checkpoint_period"
+)
+
+type s3iInventoryConfig struct {
+	Manifest         string
+	ManifestBucket   string
+	ManifestKey      string
+	CheckpointCache  string
+	CheckpointKey    string
+	CheckpointPeriod time.Duration
+}
+
+func s3iInventoryConfigFromParsed(pConf *service.ParsedConfig) (conf s3iInventoryConfig, err error) {
+	if conf.Manifest, err = pConf.FieldString(s3iInvFieldManifest); err != nil {
+		return
+	}
+	if conf.CheckpointCache, err = pConf.FieldString(s3iInvFieldCheckpointCache); err != nil {
+		return
+	}
+	if conf.CheckpointKey, err = pConf.FieldString(s3iInvFieldCheckpointKey); err != nil {
+		return
+	}
+	if conf.CheckpointPeriod, err = pConf.FieldDuration(s3iInvFieldCheckpointPeriod); err != nil {
+		return
+	}
+	if conf.Manifest == "" {
+		return
+	}
+
+	var u *url.URL
+	if u, err = url.Parse(conf.Manifest); err != nil {
+		err = fmt.Errorf("failed to parse inventory manifest URL: %w", err)
+		return
+	}
+	if u.Scheme != "s3" || u.Host == "" || strings.TrimPrefix(u.Path, "/") == "" {
+		err = fmt.Errorf("inventory manifest must be an S3 URL of the form s3://bucket/key, got: %v", conf.Manifest)
+		return
+	}
+	conf.ManifestBucket = u.Host
+	conf.ManifestKey = strings.TrimPrefix(u.Path, "/")
+	if conf.CheckpointKey == "" {
+		conf.CheckpointKey = conf.Manifest
+	}
+	return
+}
+
+func s3iInventoryConfigField() *service.ConfigField {
+	return service.NewObjectField(s3iFieldInventory,
+		service.NewStringField(s3iInvFieldManifest).
+			Description("The location of the `manifest.json` file of an S3 Inventory report to enumerate objects from, in the form `s3://bucket/key`.").
+			Example("s3://inventory-bucket/source-bucket/config-id/2024-03-01T01-00Z/manifest.json").
+			Default(""),
+		service.NewStringField(s3iInvFieldCheckpointCache).
+			Description("An optional xref:components:caches/about.adoc[cache resource] used to checkpoint progress through the inventory report, allowing a restarted input to resume where it left off.").
+			Default(""),
+		service.NewStringField(s3iInvFieldCheckpointKey).
+			Description("The key under which progress is checkpointed in the cache. Defaults to the manifest location when empty.").
+			Default("").
+			Advanced(),
+		service.NewDurationField(s3iInvFieldCheckpointPeriod).
+			Description("The period of time between each checkpoint of progress written to the cache.").
+			Default("5s").
+			Advanced(),
+	).
+		Description("Enumerate the objects to download from an S3 Inventory report rather than listing the bucket.").
+		Version("4.31.0").
+		Optional()
+}
+
+//------------------------------------------------------------------------------
+
+type s3InventoryManifest struct {
+	SourceBucket string `json:"sourceBucket"`
+	FileFormat   string `json:"fileFormat"`
+	FileSchema   string `json:"fileSchema"`
+	Files        []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+type s3InventoryRow struct {
+	bucket string
+	key    string
+
+	// Delete markers and noncurrent versions are enumerated by inventory
+	// reports of versioned buckets, but can't be downloaded by key.
+	skip bool
+}
+
+type s3InventoryRowReader interface {
+	Next() (s3InventoryRow, error)
+	Close() error
+}
+
+// s3InventoryColumn normalises the column names of CSV file schemas, which
+// are pascal case, and Parquet files, which are snake case.
+func s3InventoryColumn(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", ""))
+}
+
+//------------------------------------------------------------------------------
+
+type s3InventoryCSVReader struct {
+	body io.Closer
+	r    *csv.Reader
+
+	bucketIdx, keyIdx, isLatestIdx, isDeleteMarkerIdx int
+}
+
+func newS3InventoryCSVReader(fileSchema string, body io.ReadCloser, gzipped bool) (*s3InventoryCSVReader, error) {
+	c := &s3InventoryCSVReader{
+		body:              body,
+		bucketIdx:         -1,
+		keyIdx:            -1,
+		isLatestIdx:       -1,
+		isDeleteMarkerIdx: -1,
+	}
+	for i, name := range strings.Split(fileSchema, ",") {
+		switch s3InventoryColumn(name) {
+		case "bucket":
+			c.bucketIdx = i
+		case "key":
+			c.keyIdx = i
+		case "islatest":
+			c.isLatestIdx = i
+		case "isdeletemarker":
+			c.isDeleteMarkerIdx = i
+		}
+	}
+	if c.keyIdx < 0 {
+		return nil, fmt.Errorf("inventory file schema does not contain a key column: %v", fileSchema)
+	}
+
+	var r io.Reader = body
+	if gzipped {
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress inventory file: %w", err)
+		}
+		r = gr
+	}
+	c.r = csv.NewReader(r)
+	c.r.FieldsPerRecord = -1
+	c.r.ReuseRecord = true
+	return c, nil
+}
+
+func (c *s3InventoryCSVReader) Next() (row s3InventoryRow, err error) {
+	var record []string
+	if record, err = c.r.Read(); err != nil {
+		return
+	}
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	row.bucket = field(c.bucketIdx)
+	// Object keys within CSV inventory files are URL encoded.
+	if row.key, err = url.QueryUnescape(field(c.keyIdx)); err != nil {
+		err = fmt.Errorf("failed to parse key from inventory file: %w", err)
+		return
+	}
+	row.skip = field(c.isLatestIdx) == "false" || field(c.isDeleteMarkerIdx) == "true"
+	return
+}
+
+func (c *s3InventoryCSVReader) Close() error {
+	return c.body.Close()
+}
+
+//------------------------------------------------------------------------------
+
+const (
+	s3InventoryParquetReadRows = 1000
+
+	// Parquet files are read with ranged requests, and therefore larger
+	// buffers than those suitable for disk access reduce the number of
+	// requests made.
+	s3InventoryParquetReadBufferSize = 4 * 1024 * 1024
+)
+
+// s3ObjectReaderAt reads an S3 object with ranged GetObject requests, allowing
+// files to be read at random offsets without downloading them in full.
+type s3ObjectReaderAt struct {
+	ctx    context.Context
+	s3     *s3.Client
+	bucket string
+	key    string
+	size   int64
+}
+
+func (s *s3ObjectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), s.size)
+	if end <= off {
+		return 0, nil
+	}
+
+	obj, err := s.s3.GetObject(s.ctx, &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &s.key,
+		Range:  aws.String(fmt.Sprintf("bytes=%v-%v", off, end-1)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer obj.Body.Close()
+
+	n, err := io.ReadFull(obj.Body, p[:end-off])
+	if err == nil && end-off < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+type s3InventoryParquetReader struct {
+	pr      *parquet.Reader
+	rows    []parquet.Row
+	pending []parquet.Row
+
+	bucketCol, keyCol, isLatestCol, isDeleteMarkerCol int
+}
+
+func newS3InventoryParquetReader(r io.ReaderAt, size int64) (p *s3InventoryParquetReader, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parquet read panic: %v", r)
+		}
+	}()
+
+	f, err := parquet.OpenFile(r, size,
+		parquet.ReadBufferSize(s3InventoryParquetReadBufferSize),
+		parquet.SkipPageIndex(true),
+		parquet.SkipBloomFilters(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet inventory file: %w", err)
+	}
+
+	p = &s3InventoryParquetReader{
+		bucketCol:         -1,
+		keyCol:            -1,
+		isLatestCol:       -1,
+		isDeleteMarkerCol: -1,
+	}
+	for i, path := range f.Schema().Columns() {
+		if len(path) != 1 {
+			continue
+		}
+		switch s3InventoryColumn(path[0]) {
+		case "bucket":
+			p.bucketCol = i
+		case "key":
+			p.keyCol = i
+		case "islatest":
+			p.isLatestCol = i
+		case "isdeletemarker":
+			p.isDeleteMarkerCol = i
+		}
+	}
+	if p.keyCol < 0 {
+		return nil, errors.New("parquet inventory file does not contain a key column")
+	}
+
+	p.pr = parquet.NewReader(f)
+	p.rows = make([]parquet.Row, s3InventoryParquetReadRows)
+	return p, nil
+}
+
+func (p *s3InventoryParquetReader) readRows() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parquet read panic: %v", r)
+		}
+	}()
+
+	n, err := p.pr.ReadRows(p.rows)
+	p.pending = p.rows[:n]
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("failed to read parquet inventory rows: %w", err)
+	}
+	return err
+}
+
+func (p *s3InventoryParquetReader) Next() (s3InventoryRow, error) {
+	if len(p.pending) == 0 {
+		if err := p.readRows(); err != nil {
+			return s3InventoryRow{}, err
+		}
+	}
+
+	var bucket, key, isLatest, isDeleteMarker parquet.Value
+	for _, v := range p.pending[0] {
+		switch v.Column() {
+		case p.bucketCol:
+			bucket = v
+		case p.keyCol:
+			key = v
+		case p.isLatestCol:
+			isLatest = v
+		case p.isDeleteMarkerCol:
+			isDeleteMarker = v
+		}
+	}
+	p.pending = p.pending[1:]
+
+	var row s3InventoryRow
+	if !bucket.IsNull() {
+		row.bucket = string(bucket.ByteArray())
+	}
+	if !key.IsNull() {
+		row.key = string(key.ByteArray())
+	}
+	row.skip = (!isLatest.IsNull() && !isLatest.Boolean()) || (!isDeleteMarker.IsNull() && isDeleteMarker.Boolean())
+	return row, nil
+}
+
+func (p *s3InventoryParquetReader) Close() error {
+	return p.pr.Close()
+}
+
+//------------------------------------------------------------------------------
+
+// s3InventoryPosition describes progress through an inventory report as the
+// number of rows of a file that have been processed, where all prior files of
+// the manifest have been processed in full.
+type s3InventoryPosition struct {
+	File string `json:"file"`
+	Row  int64  `json:"row"`
+}
+
+type inventoryTargetReader struct {
+	conf s3iConfig
+	log  *service.Logger
+	mgr  *service.Resources
+	s3   *s3.Client
+
+	manifest s3InventoryManifest
+	fileIdx  int
+	row      int64
+	skipTo   int64
+	rows     s3InventoryRowReader
+
+	cpMut        sync.Mutex
+	checkpointer *checkpoint.Uncapped[s3InventoryPosition]
+	highest      *s3InventoryPosition
+	committed    *s3InventoryPosition
+	lastCommit   time.Time
+}
+
+func newInventoryTargetReader(
+	ctx context.Context,
+	conf s3iConfig,
+	log *service.Logger,
+	mgr *service.Resources,
+	s3Client *s3.Client,
+) (*inventoryTargetReader, error) {
+	i := &inventoryTargetReader{
+		conf:         conf,
+		log:          log,
+		mgr:          mgr,
+		s3:           s3Client,
+		checkpointer: checkpoint.NewUncapped[s3InventoryPosition](),
+		lastCommit:   time.Now(),
+	}
+
+	obj, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &conf.Inventory.ManifestBucket,
+		Key:    &conf.Inventory.ManifestKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download inventory manifest: %w", err)
+	}
+	err = json.NewDecoder(obj.Body).Decode(&i.manifest)
+	_ = obj.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory manifest: %w", err)
+	}
+
+	switch strings.ToLower(i.manifest.FileFormat) {
+	case "csv", "parquet":
+	default:
+		return nil, fmt.Errorf("inventory file format %v is not supported", i.manifest.FileFormat)
+	}
+
+	if conf.Inventory.CheckpointCache != "" {
+		var pos *s3InventoryPosition
+		if pos, err = i.readCheckpoint(ctx); err != nil {
+			return nil, err
+		}
+		if pos != nil {
+			i.resumeFrom(*pos)
+		}
+	}
+	return i, nil
+}
+
+func (i *inventoryTargetReader) readCheckpoint(ctx context.Context) (*s3InventoryPosition, error) {
+	var posBytes []byte
+	var cacheErr error
+	if err := i.mgr.AccessCache(ctx, i.conf.Inventory.CheckpointCache, func(c service.Cache) {
+		posBytes, cacheErr = c.Get(ctx, i.conf.Inventory.CheckpointKey)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to access checkpoint cache: %w", err)
+	}
+	if errors.Is(cacheErr, service.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if cacheErr != nil {
+		return nil, fmt.Errorf("failed to read inventory checkpoint: %w", cacheErr)
+	}
+
+	var pos s3InventoryPosition
+	if err := json.Unmarshal(posBytes, &pos); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory checkpoint: %w", err)
+	}
+	return &pos, nil
+}
+
+func (i *inventoryTargetReader) resumeFrom(pos s3InventoryPosition) {
+	for idx, f := range i.manifest.Files {
+		if f.Key == pos.File {
+			i.fileIdx = idx
+			i.skipTo = pos.Row
+			i.log.Infof("Resuming inventory report from row %v of file %v", pos.Row, pos.File)
+			return
+		}
+	}
+	i.log.Warnf("Inventory checkpoint file %v was not found in the manifest, consuming the report from the start", pos.File)
+}
+
+func (i *inventoryTargetReader) openFile(ctx context.Context) (s3InventoryRowReader, error) {
+	key := i.manifest.Files[i.fileIdx].Key
+
+	// Inventory files are stored in the same bucket as their manifest.
+	if strings.EqualFold(i.manifest.FileFormat, "parquet") {
+		head, err := i.s3.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: &i.conf.Inventory.ManifestBucket,
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inventory file %v: %w", key, err)
+		}
+		return newS3InventoryParquetReader(&s3ObjectReaderAt{
+			ctx:    ctx,
+			s3:     i.s3,
+			bucket: i.conf.Inventory.ManifestBucket,
+			key:    key,
+			size:   aws.ToInt64(head.ContentLength),
+		}, aws.ToInt64(head.ContentLength))
+	}
+
+	obj, err := i.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &i.conf.Inventory.ManifestBucket,
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download inventory file %v: %w", key, err)
+	}
+
+	rows, err := newS3InventoryCSVReader(i.manifest.FileSchema, obj.Body, strings.HasSuffix(key, ".gz"))
+	if err != nil {
+		_ = obj.Body.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (i *inventoryTargetReader) nextRow(ctx context.Context) (s3InventoryRow, s3InventoryPosition, error) {
+	for {
+		if i.rows == nil {
+			if i.fileIdx >= len(i.manifest.Files) {
+				return s3InventoryRow{}, s3InventoryPosition{}, io.EOF
+			}
+
+			var err error
+			if i.rows, err = i.openFile(ctx); err != nil {
+				return s3InventoryRow{}, s3InventoryPosition{}, err
+			}
+			i.row = 0
+		}
+
+		row, err := i.rows.Next()
+		if errors.Is(err, io.EOF) {
+			_ = i.rows.Close()
+			i.rows = nil
+			i.fileIdx++
+			i.skipTo = 0
+			continue
+		}
+		if err != nil {
+			return s3InventoryRow{}, s3InventoryPosition{}, err
+		}
+
+		i.row++
+		if i.row <= i.skipTo {
+			continue
+		}
+		return row, s3InventoryPosition{File: i.manifest.Files[i.fileIdx].Key, Row: i.row}, nil
+	}
+}
+
+func (i *inventoryTargetReader) Pop(ctx context.Context) (*s3ObjectTarget, error) {
+	for {
+		row, pos, err := i.nextRow(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var resolveFn func() *s3InventoryPosition
+		if i.conf.Inventory.CheckpointCache != "" {
+			i.cpMut.Lock()
+			resolveFn = i.checkpointer.Track(pos, 1)
+			i.cpMut.Unlock()
+		}
+
+		if row.skip || !strings.HasPrefix(row.key, i.conf.Prefix) {
+			if resolveFn != nil {
+				_ = i.resolve(ctx, resolveFn)
+			}
+			continue
+		}
+
+		bucket := row.bucket
+		if bucket == "" {
+			bucket = i.manifest.SourceBucket
+		}
+
+		var ackFn service.AckFunc
+		if resolveFn != nil {
+			ackFn = func(ctx context.Context, err error) error {
+				if err != nil {
+					return nil
+				}
+				return i.resolve(ctx, resolveFn)
+			}
+		}
+		ackFn = deleteS3ObjectAckFn(i.s3, bucket, row.key, i.conf.DeleteObjects, ackFn)
+		return newS3ObjectTarget(row.key, bucket, time.Time{}, ackFn), nil
+	}
+}
+
+func (i *inventoryTargetReader) resolve(ctx context.Context, resolveFn func() *s3InventoryPosition) error {
+	i.cpMut.Lock()
+	defer i.cpMut.Unlock()
+
+	if pos := resolveFn(); pos != nil {
+		i.highest = pos
+	}
+	if time.Since(i.lastCommit) < i.conf.Inventory.CheckpointPeriod {
+		return nil
+	}
+	return i.commit(ctx)
+}
+
+// commit writes the highest position reached to the cache. Must be called
+// with the checkpoint mutex held.
+func (i *inventoryTargetReader) commit(ctx context.Context) error {
+	if i.highest == nil || i.highest == i.committed {
+		return nil
+	}
+
+	posBytes, err := json.Marshal(i.highest)
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	if err := i.mgr.AccessCache(ctx, i.conf.Inventory.CheckpointCache, func(c service.Cache) {
+		setErr = c.Set(ctx, i.conf.Inventory.CheckpointKey, posBytes, nil)
+	}); err != nil {
+		return err
+	}
+	if setErr != nil {
+		return fmt.Errorf("failed to write inventory checkpoint: %w", setErr)
+	}
+
+	i.committed = i.highest
+	i.lastCommit = time.Now()
+	return nil
+}
+
+func (i *inventoryTargetReader) Close(ctx context.Context) error {
+	if i.rows != nil {
+		_ = i.rows.Close()
+		i.rows = nil
+	}
+	if i.conf.Inventory.CheckpointCache == "" {
+		return nil
+	}
+
+	i.cpMut.Lock()
+	defer i.cpMut.Unlock()
+	return i.commit(ctx)
+}
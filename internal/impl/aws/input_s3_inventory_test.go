@@ -0,0 +1,235 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func TestS3InventoryConfig(t *testing.T) {
+	spec := service.NewConfigSpec().Field(s3iInventoryConfigField())
+
+	pConf, err := spec.ParseYAML(`
+inventory:
+  manifest: s3://inventory/source/config/2024-03-01T01-00Z/manifest.json
+`, nil)
+	require.NoError(t, err)
+
+	conf, err := s3iInventoryConfigFromParsed(pConf.Namespace(s3iFieldInventory))
+	require.NoError(t, err)
+	assert.Equal(t, "inventory", conf.ManifestBucket)
+	assert.Equal(t, "source/config/2024-03-01T01-00Z/manifest.json", conf.ManifestKey)
+	assert.Equal(t, conf.Manifest, conf.CheckpointKey)
+
+	for _, manifest := range []string{
+		"inventory/manifest.json",
+		"https://inventory/manifest.json",
+		"s3://inventory",
+	} {
+		pConf, err := spec.ParseYAML(`
+inventory:
+  manifest: `+manifest+`
+`, nil)
+		require.NoError(t, err)
+
+		_, err = s3iInventoryConfigFromParsed(pConf.Namespace(s3iFieldInventory))
+		assert.Error(t, err, manifest)
+	}
+}
+
+func readS3InventoryRows(t testing.TB, rows s3InventoryRowReader) (res []s3InventoryRow) {
+	t.Helper()
+
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		res = append(res, row)
+	}
+	require.NoError(t, rows.Close())
+	return
+}
+
+func gzipBytes(t testing.TB, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestS3InventoryCSVReader(t *testing.T) {
+	data := gzipBytes(t, `"source","a.txt","v1","true","false","10"
+"source","b%2Fc+d.txt","v2","false","false","20"
+"source","e.txt","v3","true","true","0"
+"source","f.txt","v4","true","false","30"
+`)
+
+	rows, err := newS3InventoryCSVReader(
+		"Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size",
+		io.NopCloser(bytes.NewReader(data)), true,
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []s3InventoryRow{
+		{bucket: "source", key: "a.txt"},
+		{bucket: "source", key: "b/c d.txt", skip: true},
+		{bucket: "source", key: "e.txt", skip: true},
+		{bucket: "source", key: "f.txt"},
+	}, readS3InventoryRows(t, rows))
+
+	_, err = newS3InventoryCSVReader("Bucket, Size", io.NopCloser(bytes.NewReader(nil)), false)
+	require.Error(t, err)
+}
+
+type s3InventoryParquetRow struct {
+	Bucket         string `parquet:"bucket"`
+	Key            string `parquet:"key"`
+	IsLatest       *bool  `parquet:"is_latest,optional"`
+	IsDeleteMarker *bool  `parquet:"is_delete_marker,optional"`
+}
+
+func s3InventoryParquetFile(t testing.TB) []byte {
+	t.Helper()
+
+	yes, no := true, false
+
+	var buf bytes.Buffer
+	pw := parquet.NewGenericWriter[s3InventoryParquetRow](&buf)
+	_, err := pw.Write([]s3InventoryParquetRow{
+		{Bucket: "source", Key: "a.txt", IsLatest: &yes, IsDeleteMarker: &no},
+		{Bucket: "source", Key: "b/c d.txt", IsLatest: &no, IsDeleteMarker: &no},
+		{Bucket: "source", Key: "e.txt", IsLatest: &yes, IsDeleteMarker: &yes},
+		{Bucket: "source", Key: "f.txt"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, pw.Close())
+	return buf.Bytes()
+}
+
+var s3InventoryParquetRows = []s3InventoryRow{
+	{bucket: "source", key: "a.txt"},
+	{bucket: "source", key: "b/c d.txt", skip: true},
+	{bucket: "source", key: "e.txt", skip: true},
+	{bucket: "source", key: "f.txt"},
+}
+
+func TestS3InventoryParquetReader(t *testing.T) {
+	data := s3InventoryParquetFile(t)
+
+	rows, err := newS3InventoryParquetReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, s3InventoryParquetRows, readS3InventoryRows(t, rows))
+
+	_, err = newS3InventoryParquetReader(bytes.NewReader(data[:len(data)/2]), int64(len(data)/2))
+	require.Error(t, err)
+}
+
+func TestS3InventoryParquetReaderRanged(t *testing.T) {
+	data := s3InventoryParquetFile(t)
+
+	var ranged int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inventory/data/a.parquet" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			ranged++
+		}
+		http.ServeContent(w, r, "a.parquet", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	rows, err := newS3InventoryParquetReader(&s3ObjectReaderAt{
+		ctx:    context.Background(),
+		s3:     client,
+		bucket: "inventory",
+		key:    "data/a.parquet",
+		size:   int64(len(data)),
+	}, int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, s3InventoryParquetRows, readS3InventoryRows(t, rows))
+	assert.Positive(t, ranged)
+}
+
+func TestS3InventoryTargetReaderResume(t *testing.T) {
+	data := `"source","a.txt"
+"source","b.txt"
+"source","c.txt"
+"source","d.txt"
+`
+
+	reader := &inventoryTargetReader{
+		conf: s3iConfig{Prefix: ""},
+	}
+	reader.manifest.SourceBucket = "source"
+	reader.manifest.FileSchema = "Bucket, Key"
+	reader.manifest.Files = append(reader.manifest.Files, struct {
+		Key string `json:"key"`
+	}{Key: "files/first.csv"})
+
+	reader.resumeFrom(s3InventoryPosition{File: "files/first.csv", Row: 2})
+
+	var err error
+	reader.rows, err = newS3InventoryCSVReader(reader.manifest.FileSchema, io.NopCloser(bytes.NewReader([]byte(data))), false)
+	require.NoError(t, err)
+
+	var keys []string
+	var positions []s3InventoryPosition
+	for {
+		row, pos, err := reader.nextRow(context.Background())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		keys = append(keys, row.key)
+		positions = append(positions, pos)
+	}
+
+	assert.Equal(t, []string{"c.txt", "d.txt"}, keys)
+	assert.Equal(t, []s3InventoryPosition{
+		{File: "files/first.csv", Row: 3},
+		{File: "files/first.csv", Row: 4},
+	}, positions)
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3ParseObjectPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		conf      s3iSQSConfig
+		bucket    string
+		body      string
+		objects   []s3ObjectTarget
+		errString string
+	}{
+		{
+			name: "s3 notification",
+			conf: s3iSQSConfig{
+				KeyPath:     "Records.*.s3.object.key",
+				BucketPath:  "Records.*.s3.bucket.name",
+				EventFormat: s3iSQSEventFormatNotification,
+			},
+			body: `{"Records":[
+  {"s3":{"bucket":{"name":"foo"},"object":{"key":"a+b%2Fc.txt"}}},
+  {"s3":{"bucket":{"name":"bar"},"object":{"key":"d.txt"}}}
+]}`,
+			objects: []s3ObjectTarget{
+				{bucket: "foo", key: "a b/c.txt"},
+				{bucket: "bar", key: "d.txt"},
+			},
+		},
+		{
+			name: "sns enveloped notification",
+			conf: s3iSQSConfig{
+				EnvelopePath: "Message",
+				KeyPath:      "Records.*.s3.object.key",
+				BucketPath:   "Records.*.s3.bucket.name",
+				EventFormat:  s3iSQSEventFormatNotification,
+			},
+			body: `{"Message":"{\"Records\":[{\"s3\":{\"bucket\":{\"name\":\"foo\"},\"object\":{\"key\":\"a.txt\"}}}]}"}`,
+			objects: []s3ObjectTarget{
+				{bucket: "foo", key: "a.txt"},
+			},
+		},
+		{
+			name: "eventbridge object created",
+			conf: s3iSQSConfig{EventFormat: s3iSQSEventFormatEventBridge},
+			body: `{
+  "version": "0",
+  "detail-type": "Object Created",
+  "source": "aws.s3",
+  "detail": {
+    "bucket": {"name": "foo"},
+    "object": {"key": "a+b.txt", "size": 5},
+    "reason": "PutObject"
+  }
+}`,
+			objects: []s3ObjectTarget{
+				{bucket: "foo", key: "a+b.txt"},
+			},
+		},
+		{
+			name:   "eventbridge default bucket",
+			conf:   s3iSQSConfig{EventFormat: s3iSQSEventFormatEventBridge},
+			bucket: "bar",
+			body:   `{"detail-type":"Object Created","detail":{"object":{"key":"a.txt"}}}`,
+			objects: []s3ObjectTarget{
+				{bucket: "bar", key: "a.txt"},
+			},
+		},
+		{
+			name: "eventbridge object deleted",
+			conf: s3iSQSConfig{EventFormat: s3iSQSEventFormatEventBridge},
+			body: `{"detail-type":"Object Deleted","detail":{"bucket":{"name":"foo"},"object":{"key":"a.txt"}}}`,
+		},
+		{
+			name:      "eventbridge missing key",
+			conf:      s3iSQSConfig{EventFormat: s3iSQSEventFormatEventBridge},
+			body:      `{"detail-type":"Object Created","detail":{"bucket":{"name":"foo"}}}`,
+			errString: "required key was not found in EventBridge event",
+		},
+		{
+			name:      "eventbridge missing bucket",
+			conf:      s3iSQSConfig{EventFormat: s3iSQSEventFormatEventBridge},
+			body:      `{"detail-type":"Object Created","detail":{"object":{"key":"a.txt"}}}`,
+			errString: "required bucket was not found in EventBridge event",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			r := newSQSTargetReader(s3iConfig{Bucket: test.bucket, SQS: test.conf}, nil, nil, nil)
+
+			objects, err := r.parseObjectPaths(&test.body)
+			if test.errString != "" {
+				require.EqualError(t, err, test.errString)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.objects, objects)
+		})
+	}
+}
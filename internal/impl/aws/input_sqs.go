@@ -16,6 +16,7 @@ package aws
 
 import (
 	"context"
+	"encoding/json"
 	"strconv"
 	"sync"
 	"time"
@@ -39,16 +40,34 @@ const (
 	sqsiFieldDeleteMessage       = "delete_message"
 	sqsiFieldResetVisibility     = "reset_visibility"
 	sqsiFieldMaxNumberOfMessages = "max_number_of_messages"
+	sqsiFieldVisibilityHeartbeat = "visibility_heartbeat"
+
+	// SQS Input Visibility Heartbeat Fields
+	sqsihbFieldEnabled           = "enabled"
+	sqsihbFieldPeriod            = "period"
+	sqsihbFieldVisibilityTimeout = "visibility_timeout"
+	sqsihbFieldMaxExtension      = "max_extension"
 
 	sqsiAttributeNameVisibilityTimeout = "VisibilityTimeout"
+	sqsiAttributeNameRedrivePolicy     = "RedrivePolicy"
+
+	sqsiDefaultVisibilityTimeout = 30 * time.Second
 )
 
+type sqsiHeartbeatConfig struct {
+	Enabled           bool
+	Period            time.Duration
+	VisibilityTimeout time.Duration
+	MaxExtension      time.Duration
+}
+
 type sqsiConfig struct {
 	URL                 string
 	WaitTimeSeconds     int
 	DeleteMessage       bool
 	ResetVisibility     bool
 	MaxNumberOfMessages int
+	Heartbeat           sqsiHeartbeatConfig
 }
 
 func sqsiConfigFromParsed(pConf *service.ParsedConfig) (conf sqsiConfig, err error) {
@@ -67,6 +86,29 @@ func sqsiConfigFromParsed(pConf *service.ParsedConfig) (conf sqsiConfig, err err
 	if conf.MaxNumberOfMessages, err = pConf.FieldInt(sqsiFieldMaxNumberOfMessages); err != nil {
 		return
 	}
+	if conf.Heartbeat, err = sqsiHeartbeatConfigFromParsed(pConf.Namespace(sqsiFieldVisibilityHeartbeat)); err != nil {
+		return
+	}
+	return
+}
+
+func sqsiHeartbeatConfigFromParsed(pConf *service.ParsedConfig) (conf sqsiHeartbeatConfig, err error) {
+	if conf.Enabled, err = pConf.FieldBool(sqsihbFieldEnabled); err != nil {
+		return
+	}
+	if pConf.Contains(sqsihbFieldPeriod) {
+		if conf.Period, err = pConf.FieldDuration(sqsihbFieldPeriod); err != nil {
+			return
+		}
+	}
+	if pConf.Contains(sqsihbFieldVisibilityTimeout) {
+		if conf.VisibilityTimeout, err = pConf.FieldDuration(sqsihbFieldVisibilityTimeout); err != nil {
+			return
+		}
+	}
+	if conf.MaxExtension, err = pConf.FieldDuration(sqsihbFieldMaxExtension); err != nil {
+		return
+	}
 	return
 }
 
@@ -90,10 +132,19 @@ This input adds the following metadata fields to each message:
 - sqs_message_id
 - sqs_receipt_handle
 - sqs_approximate_receive_count
+- sqs_max_receive_count
 - All message attributes
 
+The field `+"`sqs_max_receive_count`"+` is only set when the queue has a redrive policy, and is the number of times a message can be received before it is moved to the dead-letter queue. Therefore a message that is on its final attempt before being moved can be detected with a mapping such as `+"`@sqs_approximate_receive_count.number() >= @sqs_max_receive_count.number()`"+`.
+
 You can access these metadata fields using
-xref:configuration:interpolation.adoc#bloblang-queries[function interpolation].`).
+xref:configuration:interpolation.adoc#bloblang-queries[function interpolation].
+
+== Visibility heartbeat
+
+Whilst a message is being processed its visibility timeout is periodically extended, which prevents it from being redelivered when processing takes longer than the visibility timeout of the queue. Extensions stop once the message is acknowledged, or once the message has been in flight for longer than the `+"`visibility_heartbeat.max_extension`"+`, after which the message becomes visible again once its current visibility timeout expires.
+
+Reading the visibility timeout and redrive policy of the queue requires the permission `+"`sqs:GetQueueAttributes`"+`, without which a visibility timeout of 30 seconds is assumed unless `+"`visibility_heartbeat.visibility_timeout`"+` is set. When the visibility timeout of the queue is zero messages are not extended unless `+"`visibility_heartbeat.visibility_timeout`"+` is set.`).
 		Fields(
 			service.NewURLField(sqsiFieldURL).
 				Description("The SQS URL to consume from."),
@@ -114,6 +165,23 @@ xref:configuration:interpolation.adoc#bloblang-queries[function interpolation].`
 				Description("Whether to set the wait time. Enabling this activates long-polling. Valid values: 0 to 20.").
 				Default(0).
 				Advanced(),
+			service.NewObjectField(sqsiFieldVisibilityHeartbeat,
+				service.NewBoolField(sqsihbFieldEnabled).
+					Description("Whether to periodically extend the visibility timeout of messages that are being processed.").
+					Default(true),
+				service.NewDurationField(sqsihbFieldPeriod).
+					Description("The period between each extension of the visibility timeout of in flight messages. Defaults to half of the visibility timeout, and must be less than the visibility timeout.").
+					Optional(),
+				service.NewDurationField(sqsihbFieldVisibilityTimeout).
+					Description("The visibility timeout to set with each extension. Defaults to the visibility timeout of the queue.").
+					Optional(),
+				service.NewDurationField(sqsihbFieldMaxExtension).
+					Description("The maximum period of time after a message is received during which its visibility timeout is extended. SQS does not allow a message to remain invisible for more than 12 hours after it was received.").
+					Default("12h"),
+			).
+				Description("Controls the periodic extension of the visibility timeout of in flight messages.").
+				Version("4.31.0").
+				Advanced(),
 		).
 		Fields(config.SessionFields()...)
 }
@@ -145,6 +213,7 @@ type sqsAPI interface {
 	DeleteMessageBatch(context.Context, *sqs.DeleteMessageBatchInput, ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
 	ChangeMessageVisibilityBatch(context.Context, *sqs.ChangeMessageVisibilityBatchInput, ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error)
 	SendMessageBatch(context.Context, *sqs.SendMessageBatchInput, ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	GetQueueAttributes(context.Context, *sqs.GetQueueAttributesInput, ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
 }
 
 type awsSQSReader struct {
@@ -153,6 +222,9 @@ type awsSQSReader struct {
 	aconf aws.Config
 	sqs   sqsAPI
 
+	visibilityTimeout time.Duration
+	maxReceiveCount   int
+
 	messagesChan     chan types.Message
 	ackMessagesChan  chan sqsMessageHandle
 	nackMessagesChan chan sqsMessageHandle
@@ -179,6 +251,7 @@ func (a *awsSQSReader) Connect(ctx context.Context) error {
 	if a.sqs == nil {
 		a.sqs = sqs.NewFromConfig(a.aconf)
 	}
+	a.readQueueAttributes(ctx)
 
 	ift := &sqsInFlightTracker{
 		handles: map[string]sqsInFlightHandle{},
@@ -195,10 +268,76 @@ func (a *awsSQSReader) Connect(ctx context.Context) error {
 	return nil
 }
 
+// readQueueAttributes obtains the visibility timeout and the max receive count
+// of the redrive policy of the queue. Failing to do so is not fatal as neither
+// are required in order to consume messages.
+func (a *awsSQSReader) readQueueAttributes(ctx context.Context) {
+	a.visibilityTimeout = sqsiDefaultVisibilityTimeout
+
+	res, err := a.sqs.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(a.conf.URL),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameVisibilityTimeout,
+			types.QueueAttributeNameRedrivePolicy,
+		},
+	})
+	if err != nil {
+		a.log.Warnf("Failed to read queue attributes, assuming a visibility timeout of %v: %v", sqsiDefaultVisibilityTimeout, err)
+	} else {
+		if timeoutStr, exists := res.Attributes[sqsiAttributeNameVisibilityTimeout]; exists {
+			if timeoutSeconds, err := strconv.Atoi(timeoutStr); err == nil {
+				a.visibilityTimeout = time.Duration(timeoutSeconds) * time.Second
+			}
+		}
+		if policyStr, exists := res.Attributes[sqsiAttributeNameRedrivePolicy]; exists {
+			a.maxReceiveCount = parseSQSMaxReceiveCount(policyStr)
+		}
+	}
+
+	if a.conf.Heartbeat.VisibilityTimeout > 0 {
+		a.visibilityTimeout = a.conf.Heartbeat.VisibilityTimeout
+	}
+	if a.conf.Heartbeat.Enabled && a.visibilityTimeout < time.Second {
+		a.log.Warnf("The visibility timeout of the queue is zero, the visibility heartbeat is disabled unless visibility_heartbeat.visibility_timeout is set")
+	}
+}
+
+// The max receive count of a redrive policy is documented as an integer but
+// has historically been returned as both a number and a string.
+func parseSQSMaxReceiveCount(policy string) int {
+	var p struct {
+		MaxReceiveCount json.Number `json:"maxReceiveCount"`
+	}
+	if err := json.Unmarshal([]byte(policy), &p); err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(p.MaxReceiveCount.String())
+	return n
+}
+
+// heartbeatEnabled returns whether the visibility timeout of in flight
+// messages should be extended, which isn't possible with a zero timeout as
+// extending by zero makes messages visible again immediately.
+func (a *awsSQSReader) heartbeatEnabled() bool {
+	return a.conf.Heartbeat.Enabled && a.visibilityTimeout >= time.Second
+}
+
+// heartbeatPeriod returns the period between extensions, which is always less
+// than the visibility timeout so that messages are extended before they become
+// visible again.
+func (a *awsSQSReader) heartbeatPeriod() time.Duration {
+	if period := a.conf.Heartbeat.Period; period > 0 {
+		if period < a.visibilityTimeout {
+			return period
+		}
+		a.log.Warnf("The visibility heartbeat period %v is not less than the visibility timeout %v, using a period of %v instead", period, a.visibilityTimeout, a.visibilityTimeout/2)
+	}
+	return a.visibilityTimeout / 2
+}
+
 type sqsInFlightHandle struct {
-	receiptHandle  string
-	timeoutSeconds int
-	addedAt        time.Time
+	receiptHandle string
+	addedAt       time.Time
 }
 
 type sqsInFlightTracker struct {
@@ -206,24 +345,44 @@ type sqsInFlightTracker struct {
 	m       sync.Mutex
 }
 
-func (t *sqsInFlightTracker) PullToRefresh() (handles []sqsMessageHandle, timeoutSeconds int) {
+// PullToRefresh returns the handles of in flight messages that should have
+// their visibility timeout extended, grouped by the timeout in seconds to
+// apply. A message is extended by no more than what remains of the max
+// extension period since it was received, and once that period has passed the
+// message is no longer tracked.
+func (t *sqsInFlightTracker) PullToRefresh(now time.Time, timeout, maxExtension time.Duration) map[int][]sqsMessageHandle {
 	t.m.Lock()
 	defer t.m.Unlock()
 
-	handles = make([]sqsMessageHandle, 0, len(t.handles))
+	handles := map[int][]sqsMessageHandle{}
+	if timeout < time.Second {
+		return handles
+	}
 	for k, v := range t.handles {
-		if time.Since(v.addedAt) < time.Second {
+		age := now.Sub(v.addedAt)
+		if age < time.Second {
 			continue
 		}
-		handles = append(handles, sqsMessageHandle{
+
+		msgTimeout := timeout
+		if maxExtension > 0 {
+			remaining := maxExtension - age
+			if remaining < time.Second {
+				delete(t.handles, k)
+				continue
+			}
+			if remaining < msgTimeout {
+				msgTimeout = remaining
+			}
+		}
+
+		timeoutSeconds := int(msgTimeout / time.Second)
+		handles[timeoutSeconds] = append(handles[timeoutSeconds], sqsMessageHandle{
 			id:            k,
 			receiptHandle: v.receiptHandle,
 		})
-		if v.timeoutSeconds > timeoutSeconds {
-			timeoutSeconds = v.timeoutSeconds
-		}
 	}
-	return
+	return handles
 }
 
 func (t *sqsInFlightTracker) Remove(id string) {
@@ -241,19 +400,10 @@ func (t *sqsInFlightTracker) AddNew(messages ...types.Message) {
 			continue
 		}
 
-		handle := sqsInFlightHandle{
-			timeoutSeconds: 30,
-			receiptHandle:  *m.ReceiptHandle,
-			addedAt:        time.Now(),
+		t.handles[*m.MessageId] = sqsInFlightHandle{
+			receiptHandle: *m.ReceiptHandle,
+			addedAt:       time.Now(),
 		}
-		if timeoutStr, exists := m.Attributes[sqsiAttributeNameVisibilityTimeout]; exists {
-			// Might as well keep the queue timeout setting refreshed as we
-			// consume new data.
-			if tmpTimeoutSeconds, err := strconv.Atoi(timeoutStr); err == nil {
-				handle.timeoutSeconds = tmpTimeoutSeconds
-			}
-		}
-		t.handles[*m.MessageId] = handle
 	}
 }
 
@@ -289,18 +439,24 @@ func (a *awsSQSReader) ackLoop(wg *sync.WaitGroup, inFlightTracker *sqsInFlightT
 	}
 
 	refreshCurrentHandles := func() {
-		currentHandles, timeoutSeconds := inFlightTracker.PullToRefresh()
-		if len(currentHandles) == 0 {
-			return
-		}
-		if err := a.updateVisibilityMessages(closeNowCtx, timeoutSeconds, currentHandles...); err != nil {
-			a.log.Debugf("Failed to update messages visibility timeout: %v", err)
+		currentHandles := inFlightTracker.PullToRefresh(time.Now(), a.visibilityTimeout, a.conf.Heartbeat.MaxExtension)
+		for timeoutSeconds, handles := range currentHandles {
+			if err := a.updateVisibilityMessages(closeNowCtx, timeoutSeconds, handles...); err != nil {
+				a.log.Debugf("Failed to update messages visibility timeout: %v", err)
+			}
 		}
 	}
 
 	flushTimer := time.NewTicker(time.Second)
 	defer flushTimer.Stop()
 
+	var heartbeatChan <-chan time.Time
+	if a.heartbeatEnabled() {
+		heartbeatTimer := time.NewTicker(a.heartbeatPeriod())
+		defer heartbeatTimer.Stop()
+		heartbeatChan = heartbeatTimer.C
+	}
+
 	// Both maps are of the message ID to the receipt handle
 	pendingAcks := map[string]string{}
 	pendingNacks := map[string]string{}
@@ -323,6 +479,7 @@ ackLoop:
 		case <-flushTimer.C:
 			flushFinishedHandles(pendingAcks, true)
 			flushFinishedHandles(pendingNacks, false)
+		case <-heartbeatChan:
 			refreshCurrentHandles()
 		case <-a.closeSignal.SoftStopChan():
 			break ackLoop
@@ -523,6 +680,9 @@ func (a *awsSQSReader) Read(ctx context.Context) (*service.Message, service.AckF
 
 	msg := service.NewMessage([]byte(*next.Body))
 	addSQSMetadata(msg, next)
+	if a.maxReceiveCount > 0 {
+		msg.MetaSetMut("sqs_max_receive_count", strconv.Itoa(a.maxReceiveCount))
+	}
 
 	mHandle := sqsMessageHandle{
 		id: *next.MessageId,
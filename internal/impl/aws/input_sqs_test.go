@@ -88,7 +88,7 @@ func (m *mockSqsInput) ReceiveMessage(context.Context, *sqs.ReceiveMessageInput,
 	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
 }
 
-func (m *mockSqsInput) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+func (m *mockSqsInput) GetQueueAttributes(ctx context.Context, input *sqs.GetQueueAttributesInput, opts ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
 	return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{sqsiAttributeNameVisibilityTimeout: strconv.Itoa(int(m.queueTimeout))}}, nil
 }
 
@@ -158,6 +158,10 @@ func TestSQSInput(t *testing.T) {
 			DeleteMessage:       true,
 			ResetVisibility:     true,
 			MaxNumberOfMessages: 10,
+			Heartbeat: sqsiHeartbeatConfig{
+				Enabled:      true,
+				MaxExtension: 12 * time.Hour,
+			},
 		},
 		conf,
 		nil,
@@ -247,6 +251,10 @@ func TestSQSInputBatchAck(t *testing.T) {
 			DeleteMessage:       true,
 			ResetVisibility:     true,
 			MaxNumberOfMessages: 10,
+			Heartbeat: sqsiHeartbeatConfig{
+				Enabled:      true,
+				MaxExtension: 12 * time.Hour,
+			},
 		},
 		conf,
 		nil,
@@ -299,3 +307,84 @@ func TestSQSInputBatchAck(t *testing.T) {
 		return msgsLen == 0
 	}, 5*time.Second, time.Second)
 }
+
+func TestSQSInFlightTrackerMaxExtension(t *testing.T) {
+	now := time.Now()
+	tracker := &sqsInFlightTracker{
+		handles: map[string]sqsInFlightHandle{
+			"new":     {receiptHandle: "a", addedAt: now},
+			"fresh":   {receiptHandle: "b", addedAt: now.Add(-time.Minute)},
+			"nearing": {receiptHandle: "c", addedAt: now.Add(-time.Minute * 59)},
+			"expired": {receiptHandle: "d", addedAt: now.Add(-time.Hour * 2)},
+		},
+	}
+
+	assert.Equal(t, map[int][]sqsMessageHandle{
+		30: {{id: "fresh", receiptHandle: "b"}},
+		10: {{id: "nearing", receiptHandle: "c"}},
+	}, tracker.PullToRefresh(now, time.Second*30, time.Minute*59+time.Second*10))
+
+	_, exists := tracker.handles["expired"]
+	assert.False(t, exists, "handles past the max extension should no longer be tracked")
+	assert.Len(t, tracker.handles, 3)
+
+	// Without a max extension messages are extended indefinitely.
+	assert.Equal(t, map[int][]sqsMessageHandle{
+		30: {{id: "fresh", receiptHandle: "b"}},
+	}, (&sqsInFlightTracker{
+		handles: map[string]sqsInFlightHandle{
+			"fresh": {receiptHandle: "b", addedAt: now.Add(-time.Hour * 24)},
+		},
+	}).PullToRefresh(now, time.Second*30, 0))
+}
+
+func TestSQSParseMaxReceiveCount(t *testing.T) {
+	for policy, exp := range map[string]int{
+		`{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:111122223333:dlq","maxReceiveCount":5}`:   5,
+		`{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:111122223333:dlq","maxReceiveCount":"3"}`: 3,
+		`{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:111122223333:dlq"}`:                       0,
+		`not json`: 0,
+	} {
+		assert.Equal(t, exp, parseSQSMaxReceiveCount(policy), policy)
+	}
+}
+
+func TestSQSHeartbeatPeriod(t *testing.T) {
+	a := &awsSQSReader{visibilityTimeout: time.Second * 30}
+	assert.Equal(t, time.Second*15, a.heartbeatPeriod())
+
+	a.visibilityTimeout = time.Second
+	assert.Equal(t, time.Millisecond*500, a.heartbeatPeriod())
+
+	a.conf.Heartbeat.Period = time.Second * 5
+	assert.Equal(t, time.Millisecond*500, a.heartbeatPeriod(), "the period must be less than the timeout")
+
+	a.visibilityTimeout = time.Second * 30
+	assert.Equal(t, time.Second*5, a.heartbeatPeriod())
+}
+
+func TestSQSHeartbeatZeroVisibilityTimeout(t *testing.T) {
+	a := &awsSQSReader{
+		conf: sqsiConfig{
+			URL:       "http://foo.example.com",
+			Heartbeat: sqsiHeartbeatConfig{Enabled: true},
+		},
+		sqs: &mockSqsInput{queueTimeout: 0},
+	}
+	a.readQueueAttributes(context.Background())
+	assert.Equal(t, time.Duration(0), a.visibilityTimeout)
+	assert.False(t, a.heartbeatEnabled())
+
+	// Messages are never extended by zero, which would release them.
+	now := time.Now()
+	assert.Empty(t, (&sqsInFlightTracker{
+		handles: map[string]sqsInFlightHandle{
+			"fresh": {receiptHandle: "b", addedAt: now.Add(-time.Minute)},
+		},
+	}).PullToRefresh(now, 0, 0))
+
+	a.conf.Heartbeat.VisibilityTimeout = time.Second * 10
+	a.readQueueAttributes(context.Background())
+	assert.True(t, a.heartbeatEnabled())
+	assert.Equal(t, time.Second*5, a.heartbeatPeriod())
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service/integration"
+)
+
+func createDynamoDBStreamTable(ctx context.Context, t testing.TB, awsPort, id string) error {
+	endpoint := fmt.Sprintf("http://localhost:%v", awsPort)
+
+	conf, err := config.LoadDefaultConfig(ctx,
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("xxxxx", "xxxxx", "xxxxx")),
+		config.WithRegion("us-east-1"),
+	)
+	require.NoError(t, err)
+
+	conf.BaseEndpoint = &endpoint
+	client := dynamodb.NewFromConfig(conf)
+
+	table := "table-" + id
+	if _, err = client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: &table,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: types.StreamViewTypeNewAndOldImages,
+		},
+	}); err != nil {
+		return err
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{
+		TableName: &table,
+	}, time.Second*30)
+}
+
+func dynamoDBStreamsIntegrationSuite(t *testing.T, lsPort string) {
+	template := `
+output:
+  aws_dynamodb:
+    endpoint: http://localhost:$PORT
+    region: us-east-1
+    table: table-$ID
+    string_columns:
+      id: ${! uuid_v4() }
+      content: ${! content() }
+    max_in_flight: $MAX_IN_FLIGHT
+    credentials:
+      id: xxxxx
+      secret: xxxxx
+      token: xxxxx
+    batching:
+      count: $OUTPUT_BATCH_COUNT
+
+input:
+  aws_dynamodb_streams:
+    endpoint: http://localhost:$PORT
+    table: table-$ID
+    checkpoint_limit: $VAR1
+    checkpoint_table:
+      table: checkpoints-$ID
+      create: true
+    rebalance_period: 1s
+    region: us-east-1
+    credentials:
+      id: xxxxx
+      secret: xxxxx
+      token: xxxxx
+  processors:
+    - mapping: 'root = this.new_image.content'
+`
+
+	integration.StreamTests(
+		integration.StreamTestOpenClose(),
+		integration.StreamTestSendBatch(10),
+		integration.StreamTestStreamParallel(100),
+		integration.StreamTestStreamParallelLossyThroughReconnect(100),
+	).Run(
+		t, template,
+		integration.StreamTestOptPreTest(func(t testing.TB, ctx context.Context, vars *integration.StreamTestConfigVars) {
+			require.NoError(t, createDynamoDBStreamTable(ctx, t, lsPort, vars.ID))
+		}),
+		integration.StreamTestOptPort(lsPort),
+		integration.StreamTestOptAllowDupes(),
+		integration.StreamTestOptVarSet("VAR1", "10"),
+	)
+}
@@ -107,6 +107,10 @@ input:
     dynamodb:
       table: stream-$ID
       create: true
+      kcl_compatible: $VAR3
+    enhanced_fan_out:
+      enabled: $VAR4
+      consumer_name: consumer-$ID
     start_from_oldest: true
     region: us-east-1
     credentials:
@@ -145,6 +149,8 @@ input:
 			integration.StreamTestOptAllowDupes(),
 			integration.StreamTestOptVarSet("VAR1", ""),
 			integration.StreamTestOptVarSet("VAR2", "10"),
+			integration.StreamTestOptVarSet("VAR3", "false"),
+			integration.StreamTestOptVarSet("VAR4", "false"),
 		)
 	})
 
@@ -159,6 +165,40 @@ input:
 			integration.StreamTestOptAllowDupes(),
 			integration.StreamTestOptVarSet("VAR1", ""),
 			integration.StreamTestOptVarSet("VAR2", "10"),
+			integration.StreamTestOptVarSet("VAR3", "false"),
+			integration.StreamTestOptVarSet("VAR4", "false"),
+		)
+	})
+
+	t.Run("with kcl lease table", func(t *testing.T) {
+		suite.Run(
+			t, template,
+			integration.StreamTestOptPreTest(func(t testing.TB, ctx context.Context, vars *integration.StreamTestConfigVars) {
+				_, err := createKinesisShards(ctx, t, lsPort, vars.ID, 2)
+				require.NoError(t, err)
+			}),
+			integration.StreamTestOptPort(lsPort),
+			integration.StreamTestOptAllowDupes(),
+			integration.StreamTestOptVarSet("VAR1", ""),
+			integration.StreamTestOptVarSet("VAR2", "10"),
+			integration.StreamTestOptVarSet("VAR3", "true"),
+			integration.StreamTestOptVarSet("VAR4", "false"),
+		)
+	})
+
+	t.Run("with enhanced fan-out", func(t *testing.T) {
+		suite.Run(
+			t, template,
+			integration.StreamTestOptPreTest(func(t testing.TB, ctx context.Context, vars *integration.StreamTestConfigVars) {
+				_, err := createKinesisShards(ctx, t, lsPort, vars.ID, 2)
+				require.NoError(t, err)
+			}),
+			integration.StreamTestOptPort(lsPort),
+			integration.StreamTestOptAllowDupes(),
+			integration.StreamTestOptVarSet("VAR1", ""),
+			integration.StreamTestOptVarSet("VAR2", "10"),
+			integration.StreamTestOptVarSet("VAR3", "false"),
+			integration.StreamTestOptVarSet("VAR4", "true"),
 		)
 	})
 
@@ -175,6 +215,8 @@ input:
 			integration.StreamTestOptPort(lsPort),
 			integration.StreamTestOptAllowDupes(),
 			integration.StreamTestOptVarSet("VAR2", "10"),
+			integration.StreamTestOptVarSet("VAR3", "false"),
+			integration.StreamTestOptVarSet("VAR4", "false"),
 		)
 	})
 }
@@ -346,6 +346,58 @@ input:
 		)
 	})
 
+	t.Run("via_sqs_rolling", func(t *testing.T) {
+		template := `
+output:
+  aws_s3:
+    bucket: bucket-$ID
+    endpoint: http://localhost:$PORT
+    force_path_style_urls: true
+    region: eu-west-1
+    path: ${!count("$ID")}.txt
+    max_in_flight: 64
+    credentials:
+      id: xxxxx
+      secret: xxxxx
+      token: xxxxx
+    rolling:
+      enabled: true
+      max_count: 5
+      max_period: 500ms
+
+input:
+  aws_s3:
+    bucket: bucket-$ID
+    endpoint: http://localhost:$PORT
+    force_path_style_urls: true
+    region: eu-west-1
+    delete_objects: true
+    scanner: { lines: {} }
+    sqs:
+      url: http://localhost:$PORT/000000000000/queue-$ID
+      key_path: Records.*.s3.object.key
+      endpoint: http://localhost:$PORT
+      delay_period: 1s
+    credentials:
+      id: xxxxx
+      secret: xxxxx
+      token: xxxxx
+`
+		integration.StreamTests(
+			integration.StreamTestOpenClose(),
+			integration.StreamTestStreamSequential(20),
+			integration.StreamTestSendBatchCount(10),
+			integration.StreamTestStreamParallelLossyThroughReconnect(20),
+		).Run(
+			t, template,
+			integration.StreamTestOptPreTest(func(t testing.TB, ctx context.Context, vars *integration.StreamTestConfigVars) {
+				require.NoError(t, createBucketQueue(ctx, lsPort, lsPort, vars.ID))
+			}),
+			integration.StreamTestOptPort(lsPort),
+			integration.StreamTestOptAllowDupes(),
+		)
+	})
+
 	t.Run("batch", func(t *testing.T) {
 		template := `
 output:
@@ -78,6 +78,10 @@ func TestIntegration(t *testing.T) {
 
 	servicePort := getLocalStack(t)
 
+	t.Run("dynamodb_streams", func(t *testing.T) {
+		dynamoDBStreamsIntegrationSuite(t, servicePort)
+	})
+
 	t.Run("kinesis", func(t *testing.T) {
 		kinesisIntegrationSuite(t, servicePort)
 	})
@@ -86,6 +90,10 @@ func TestIntegration(t *testing.T) {
 		s3IntegrationSuite(t, servicePort)
 	})
 
+	t.Run("secrets", func(t *testing.T) {
+		secretsIntegrationSuite(t, servicePort)
+	})
+
 	t.Run("sqs", func(t *testing.T) {
 		sqsIntegrationSuite(t, servicePort)
 	})
@@ -0,0 +1,257 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Records aggregated by the Kinesis Producer Library (KPL) consist of a magic
+// prefix, followed by an AggregatedRecord protobuf message and finally an MD5
+// digest of that message:
+// https://github.com/awslabs/amazon-kinesis-producer/blob/master/aggregation-format.md
+var kplMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+const (
+	kplOverhead = 4 + md5.Size
+
+	// An upper bound of the protobuf tags and lengths added by a record that
+	// is aggregated with messages of up to 1 MiB.
+	kplRecordOverhead = 24
+
+	// AggregatedRecord fields
+	kplFieldPartitionKeyTable    protowire.Number = 1
+	kplFieldExplicitHashKeyTable protowire.Number = 2
+	kplFieldRecords              protowire.Number = 3
+
+	// Record fields
+	kplRecordFieldPartitionKeyIndex    protowire.Number = 1
+	kplRecordFieldExplicitHashKeyIndex protowire.Number = 2
+	kplRecordFieldData                 protowire.Number = 3
+)
+
+type kplRecord struct {
+	PartitionKey    string
+	ExplicitHashKey string
+	Data            []byte
+}
+
+// kplAggregator packs user records into a single KPL aggregated record.
+type kplAggregator struct {
+	body       []byte
+	count      int
+	partKeys   map[string]uint64
+	hashKeys   map[string]uint64
+	partKeyLen int
+}
+
+func newKPLAggregator() *kplAggregator {
+	return &kplAggregator{
+		partKeys: map[string]uint64{},
+		hashKeys: map[string]uint64{},
+	}
+}
+
+func appendKPLString(b []byte, num protowire.Number, v string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// Add appends a record to the aggregation, returning false without modifying
+// the aggregation if the resulting record, along with the partition key used
+// to put it, would exceed the provided size limit. A record is always added
+// to an empty aggregation.
+func (k *kplAggregator) Add(r kplRecord, maxSize int) bool {
+	body := k.body
+
+	partIndex, exists := k.partKeys[r.PartitionKey]
+	if !exists {
+		partIndex = uint64(len(k.partKeys))
+		body = appendKPLString(body, kplFieldPartitionKeyTable, r.PartitionKey)
+	}
+
+	var hashIndex uint64
+	var hasHashKey, hashExists bool
+	if r.ExplicitHashKey != "" {
+		hasHashKey = true
+		if hashIndex, hashExists = k.hashKeys[r.ExplicitHashKey]; !hashExists {
+			hashIndex = uint64(len(k.hashKeys))
+			body = appendKPLString(body, kplFieldExplicitHashKeyTable, r.ExplicitHashKey)
+		}
+	}
+
+	var record []byte
+	record = protowire.AppendTag(record, kplRecordFieldPartitionKeyIndex, protowire.VarintType)
+	record = protowire.AppendVarint(record, partIndex)
+	if hasHashKey {
+		record = protowire.AppendTag(record, kplRecordFieldExplicitHashKeyIndex, protowire.VarintType)
+		record = protowire.AppendVarint(record, hashIndex)
+	}
+	record = protowire.AppendTag(record, kplRecordFieldData, protowire.BytesType)
+	record = protowire.AppendBytes(record, r.Data)
+
+	body = protowire.AppendTag(body, kplFieldRecords, protowire.BytesType)
+	body = protowire.AppendBytes(body, record)
+
+	partKeyLen := k.partKeyLen
+	if k.count == 0 {
+		partKeyLen = len(r.PartitionKey)
+	}
+	if k.count > 0 && len(body)+kplOverhead+partKeyLen > maxSize {
+		return false
+	}
+
+	if !exists {
+		k.partKeys[r.PartitionKey] = partIndex
+	}
+	if hasHashKey && !hashExists {
+		k.hashKeys[r.ExplicitHashKey] = hashIndex
+	}
+	k.body = body
+	k.partKeyLen = partKeyLen
+	k.count++
+	return true
+}
+
+// Len returns the number of records within the aggregation.
+func (k *kplAggregator) Len() int {
+	return k.count
+}
+
+// Bytes returns the aggregated record.
+func (k *kplAggregator) Bytes() []byte {
+	b := make([]byte, 0, len(k.body)+kplOverhead)
+	b = append(b, kplMagic...)
+	b = append(b, k.body...)
+	sum := md5.Sum(k.body)
+	return append(b, sum[:]...)
+}
+
+// Reset empties the aggregation.
+func (k *kplAggregator) Reset() {
+	*k = *newKPLAggregator()
+}
+
+// isKPLAggregated returns true if the data of a Kinesis record is a KPL
+// aggregated record.
+func isKPLAggregated(data []byte) bool {
+	if len(data) < kplOverhead || !bytes.HasPrefix(data, kplMagic) {
+		return false
+	}
+	body := data[len(kplMagic) : len(data)-md5.Size]
+	sum := md5.Sum(body)
+	return bytes.Equal(sum[:], data[len(data)-md5.Size:])
+}
+
+func consumeKPLField(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if n, err := fn(num, typ, b); err != nil {
+			return err
+		} else if n >= 0 {
+			b = b[n:]
+			continue
+		}
+
+		if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// kplDeaggregate extracts the user records of a KPL aggregated record, the
+// data of which must have been checked with isKPLAggregated.
+func kplDeaggregate(data []byte) ([]kplRecord, error) {
+	body := data[len(kplMagic) : len(data)-md5.Size]
+
+	var partKeys, hashKeys []string
+	var records [][]byte
+	if err := consumeKPLField(body, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType {
+			return -1, nil
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		switch num {
+		case kplFieldPartitionKeyTable:
+			partKeys = append(partKeys, string(v))
+		case kplFieldExplicitHashKeyTable:
+			hashKeys = append(hashKeys, string(v))
+		case kplFieldRecords:
+			records = append(records, v)
+		}
+		return n, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregated record: %w", err)
+	}
+
+	res := make([]kplRecord, 0, len(records))
+	for _, rBytes := range records {
+		var r kplRecord
+		var partIndex, hashIndex uint64
+		var hasPartIndex, hasHashIndex bool
+		if err := consumeKPLField(rBytes, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+			var n int
+			switch {
+			case num == kplRecordFieldPartitionKeyIndex && typ == protowire.VarintType:
+				partIndex, n = protowire.ConsumeVarint(b)
+				hasPartIndex = true
+			case num == kplRecordFieldExplicitHashKeyIndex && typ == protowire.VarintType:
+				hashIndex, n = protowire.ConsumeVarint(b)
+				hasHashIndex = true
+			case num == kplRecordFieldData && typ == protowire.BytesType:
+				r.Data, n = protowire.ConsumeBytes(b)
+			default:
+				return -1, nil
+			}
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			return n, nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to parse aggregated user record: %w", err)
+		}
+
+		if !hasPartIndex {
+			return nil, errors.New("aggregated user record is missing a partition key index")
+		}
+		if partIndex >= uint64(len(partKeys)) {
+			return nil, fmt.Errorf("aggregated user record partition key index %v is out of bounds", partIndex)
+		}
+		r.PartitionKey = partKeys[partIndex]
+		if hasHashIndex {
+			if hashIndex >= uint64(len(hashKeys)) {
+				return nil, fmt.Errorf("aggregated user record explicit hash key index %v is out of bounds", hashIndex)
+			}
+			r.ExplicitHashKey = hashKeys[hashIndex]
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
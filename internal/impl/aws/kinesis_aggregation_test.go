@@ -0,0 +1,305 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func TestKPLAggregationRoundTrip(t *testing.T) {
+	records := []kplRecord{
+		{PartitionKey: "foo", Data: []byte("first")},
+		{PartitionKey: "bar", ExplicitHashKey: "123", Data: []byte("second")},
+		{PartitionKey: "foo", ExplicitHashKey: "123", Data: []byte("third")},
+		{PartitionKey: "foo", Data: []byte{}},
+	}
+
+	agg := newKPLAggregator()
+	for _, r := range records {
+		require.True(t, agg.Add(r, mebibyte))
+	}
+	assert.Equal(t, 4, agg.Len())
+
+	data := agg.Bytes()
+	require.True(t, isKPLAggregated(data))
+
+	res, err := kplDeaggregate(data)
+	require.NoError(t, err)
+	require.Len(t, res, 4)
+	for i, r := range records {
+		assert.Equal(t, r.PartitionKey, res[i].PartitionKey, i)
+		assert.Equal(t, r.ExplicitHashKey, res[i].ExplicitHashKey, i)
+		assert.Equal(t, string(r.Data), string(res[i].Data), i)
+	}
+
+	agg.Reset()
+	assert.Equal(t, 0, agg.Len())
+}
+
+func TestKPLAggregationMaxSize(t *testing.T) {
+	agg := newKPLAggregator()
+	require.True(t, agg.Add(kplRecord{PartitionKey: "foo", Data: []byte("hello world")}, 10))
+	require.False(t, agg.Add(kplRecord{PartitionKey: "foo", Data: []byte("hello world")}, 10))
+	assert.Equal(t, 1, agg.Len())
+
+	res, err := kplDeaggregate(agg.Bytes())
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+}
+
+func TestKPLNotAggregated(t *testing.T) {
+	agg := newKPLAggregator()
+	require.True(t, agg.Add(kplRecord{PartitionKey: "foo", Data: []byte("hello world")}, mebibyte))
+	data := agg.Bytes()
+
+	assert.False(t, isKPLAggregated([]byte("hello world")))
+	assert.False(t, isKPLAggregated(kplMagic))
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(kplMagic)+1]++
+	assert.False(t, isKPLAggregated(corrupted))
+}
+
+func testKPLAggregate(t *testing.T, data ...string) []byte {
+	t.Helper()
+	agg := newKPLAggregator()
+	for i, d := range data {
+		require.True(t, agg.Add(kplRecord{PartitionKey: fmt.Sprintf("key%v", i), Data: []byte(d)}, mebibyte))
+	}
+	return agg.Bytes()
+}
+
+func testBatchContents(t *testing.T, batch service.MessageBatch) (contents, subSequences []string) {
+	t.Helper()
+	for _, m := range batch {
+		b, err := m.AsBytes()
+		require.NoError(t, err)
+		contents = append(contents, string(b))
+		v, _ := m.MetaGet("kinesis_sub_sequence_number")
+		subSequences = append(subSequences, v)
+	}
+	return
+}
+
+func TestKinesisRecordBatcherDeaggregate(t *testing.T) {
+	batcher, err := newAWSKinesisRecordBatcher(service.BatchPolicy{Count: 2}, service.MockResources(), 1024, "stream", "shard", "0")
+	require.NoError(t, err)
+	batcher.deaggregate = true
+
+	ready := batcher.AddRecord(types.Record{
+		Data:           testKPLAggregate(t, "first", "second", "third"),
+		PartitionKey:   aws.String("foo"),
+		SequenceNumber: aws.String("1"),
+	})
+	require.True(t, ready)
+
+	aMsg, err := batcher.FlushMessage(context.Background())
+	require.NoError(t, err)
+	require.Len(t, aMsg.msg, 2)
+
+	for i, exp := range []struct {
+		data, partKey, subSequence string
+	}{
+		{"first", "key0", "0"},
+		{"second", "key1", "1"},
+	} {
+		b, err := aMsg.msg[i].AsBytes()
+		require.NoError(t, err)
+		assert.Equal(t, exp.data, string(b))
+
+		v, _ := aMsg.msg[i].MetaGet("kinesis_partition_key")
+		assert.Equal(t, exp.partKey, v)
+
+		v, _ = aMsg.msg[i].MetaGet("kinesis_sub_sequence_number")
+		assert.Equal(t, exp.subSequence, v)
+
+		v, _ = aMsg.msg[i].MetaGet("kinesis_sequence_number")
+		assert.Equal(t, "1", v)
+	}
+
+	require.NoError(t, aMsg.ackFn(context.Background(), nil))
+	assert.Equal(t, "1:1", batcher.GetSequence())
+
+	// The remaining user record is carried into the next batch.
+	require.True(t, batcher.HasRemainingUserRecords())
+	require.False(t, batcher.AddRemainingUserRecords())
+	require.False(t, batcher.HasRemainingUserRecords())
+
+	require.True(t, batcher.AddRecord(types.Record{
+		Data:           []byte("fourth"),
+		PartitionKey:   aws.String("foo"),
+		SequenceNumber: aws.String("2"),
+	}))
+	aMsg, err = batcher.FlushMessage(context.Background())
+	require.NoError(t, err)
+
+	contents, subSequences := testBatchContents(t, aMsg.msg)
+	assert.Equal(t, []string{"third", "fourth"}, contents)
+	assert.Equal(t, []string{"2", ""}, subSequences)
+
+	require.NoError(t, aMsg.ackFn(context.Background(), nil))
+	assert.Equal(t, "2", batcher.GetSequence())
+	batcher.Close(context.Background(), false)
+}
+
+func TestKinesisRecordBatcherDeaggregateFlushBoundary(t *testing.T) {
+	batcher, err := newAWSKinesisRecordBatcher(service.BatchPolicy{Count: 1}, service.MockResources(), 1024, "stream", "shard", "0")
+	require.NoError(t, err)
+	batcher.deaggregate = true
+
+	var batches [][]string
+	var sequences []string
+	flush := func() {
+		aMsg, err := batcher.FlushMessage(context.Background())
+		require.NoError(t, err)
+		contents, _ := testBatchContents(t, aMsg.msg)
+		batches = append(batches, contents)
+		require.NoError(t, aMsg.ackFn(context.Background(), nil))
+		sequences = append(sequences, batcher.GetSequence())
+	}
+
+	require.True(t, batcher.AddRecord(types.Record{
+		Data:           testKPLAggregate(t, "a", "b", "c"),
+		SequenceNumber: aws.String("1"),
+	}))
+	flush()
+	for batcher.HasRemainingUserRecords() {
+		require.True(t, batcher.AddRemainingUserRecords())
+		flush()
+	}
+
+	assert.Equal(t, [][]string{{"a"}, {"b"}, {"c"}}, batches)
+	assert.Equal(t, []string{"1:0", "1:1", "1:2"}, sequences)
+	batcher.Close(context.Background(), false)
+}
+
+func TestKinesisRecordBatcherResume(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		sequence    string
+		deaggregate bool
+		records     []types.Record
+		exp         []string
+	}{
+		{
+			name:        "partial aggregate",
+			sequence:    "1:0",
+			deaggregate: true,
+			records: []types.Record{
+				{Data: testKPLAggregate(t, "a", "b", "c"), SequenceNumber: aws.String("1")},
+				{Data: []byte("d"), SequenceNumber: aws.String("2")},
+			},
+			exp: []string{"b", "c", "d"},
+		},
+		{
+			name:        "consumed aggregate",
+			sequence:    "1:2",
+			deaggregate: true,
+			records: []types.Record{
+				{Data: testKPLAggregate(t, "a", "b", "c"), SequenceNumber: aws.String("1")},
+				{Data: []byte("d"), SequenceNumber: aws.String("2")},
+			},
+			exp: []string{"d"},
+		},
+		{
+			name:     "consumed record",
+			sequence: "1:0",
+			records: []types.Record{
+				{Data: []byte("a"), SequenceNumber: aws.String("1")},
+				{Data: []byte("b"), SequenceNumber: aws.String("2")},
+			},
+			exp: []string{"b"},
+		},
+		{
+			name:     "partial aggregate without deaggregation",
+			sequence: "1:0",
+			records: []types.Record{
+				{Data: testKPLAggregate(t, "a", "b"), SequenceNumber: aws.String("1")},
+			},
+			exp: []string{string(testKPLAggregate(t, "a", "b"))},
+		},
+		{
+			name:        "only the first record is resumed",
+			sequence:    "1:0",
+			deaggregate: true,
+			records: []types.Record{
+				{Data: []byte("a"), SequenceNumber: aws.String("2")},
+				{Data: testKPLAggregate(t, "b", "c"), SequenceNumber: aws.String("1")},
+			},
+			exp: []string{"a", "b", "c"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			batcher, err := newAWSKinesisRecordBatcher(service.BatchPolicy{Count: 10}, service.MockResources(), 1024, "stream", "shard", test.sequence)
+			require.NoError(t, err)
+			batcher.deaggregate = test.deaggregate
+
+			for _, r := range test.records {
+				require.False(t, batcher.AddRecord(r))
+			}
+			aMsg, err := batcher.FlushMessage(context.Background())
+			require.NoError(t, err)
+
+			contents, _ := testBatchContents(t, aMsg.msg)
+			assert.Equal(t, test.exp, contents)
+			require.NoError(t, aMsg.ackFn(context.Background(), nil))
+			batcher.Close(context.Background(), false)
+		})
+	}
+}
+
+func TestKinesisIteratorPosition(t *testing.T) {
+	iterType, sequence := kinesisIteratorPosition("123")
+	assert.Equal(t, types.ShardIteratorTypeAfterSequenceNumber, iterType)
+	assert.Equal(t, "123", sequence)
+
+	iterType, sequence = kinesisIteratorPosition("123:4")
+	assert.Equal(t, types.ShardIteratorTypeAtSequenceNumber, iterType)
+	assert.Equal(t, "123", sequence)
+}
+
+func TestKinesisRecordBatcherDeaggregateDisabled(t *testing.T) {
+	agg := newKPLAggregator()
+	require.True(t, agg.Add(kplRecord{PartitionKey: "foo", Data: []byte("first")}, mebibyte))
+	data := agg.Bytes()
+
+	batcher, err := newAWSKinesisRecordBatcher(service.BatchPolicy{Count: 1}, service.MockResources(), 1024, "stream", "shard", "0")
+	require.NoError(t, err)
+
+	require.True(t, batcher.AddRecord(types.Record{
+		Data:           data,
+		PartitionKey:   aws.String("foo"),
+		SequenceNumber: aws.String("1"),
+	}))
+	aMsg, err := batcher.FlushMessage(context.Background())
+	require.NoError(t, err)
+	require.Len(t, aMsg.msg, 1)
+
+	b, err := aMsg.msg[0].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	require.NoError(t, aMsg.ackFn(context.Background(), nil))
+	batcher.Close(context.Background(), false)
+}
@@ -18,60 +18,67 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 
+	"github.com/redpanda-data/connect/v4/internal/secrets"
 	"github.com/redpanda-data/connect/v4/internal/serverless"
 )
 
+// LambdaExpandRecordsEnv is the environment variable that enables expanding
+// the records of invocations from event source mappings into batches.
+const LambdaExpandRecordsEnv = "CONNECT_LAMBDA_EXPAND_RECORDS"
+
+// LambdaHTTPEventsEnv is the environment variable that enables adapting
+// invocations from API Gateway and Application Load Balancers to HTTP requests
+// and responses.
+const LambdaHTTPEventsEnv = "CONNECT_LAMBDA_HTTP_EVENTS"
+
 var handler *serverless.Handler
 
 // RunLambda executes Benthos as an AWS Lambda function. Configuration can be
-// stored within the environment variable CONNECT_CONFIG.
+// stored within the environment variable CONNECT_CONFIG. When the environment
+// variable CONNECT_LAMBDA_HTTP_EVENTS is set to true, invocations from API
+// Gateway and Application Load Balancers are adapted to HTTP requests and
+// responses, and when the environment variable CONNECT_LAMBDA_EXPAND_RECORDS
+// is set to true, invocations from SQS, Kinesis, DynamoDB Streams and Kafka
+// event source mappings are expanded into batches of records. Secret
+// references within the values of environment variables are resolved before
+// the config is parsed.
 func RunLambda() {
-	// A list of default config paths to check for if not explicitly defined
-	defaultPaths := []string{
-		"./redpanda-connect.yaml",
-		"/redpanda-connect.yaml",
-		"/etc/redpanda-connect/config.yaml",
-		"/etc/redpanda-connect.yaml",
-
-		"./connect.yaml",
-		"/connect.yaml",
-		"/etc/connect/config.yaml",
-		"/etc/connect.yaml",
-
-		"./benthos.yaml",
-		"./config.yaml",
-		"/benthos.yaml",
-		"/etc/benthos/config.yaml",
-		"/etc/benthos.yaml",
-	}
-	if path := os.Getenv("BENTHOS_CONFIG_PATH"); path != "" {
-		defaultPaths = append([]string{path}, defaultPaths...)
-	}
-	if path := os.Getenv("CONNECT_CONFIG_PATH"); path != "" {
-		defaultPaths = append([]string{path}, defaultPaths...)
+	var opts []serverless.HandlerOpt
+	for env, opt := range map[string]func(bool) serverless.HandlerOpt{
+		LambdaExpandRecordsEnv: serverless.OptExpandEventRecords,
+		LambdaHTTPEventsEnv:    serverless.OptHTTPEvents,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Initialisation error: failed to parse %v: %v\n", env, err)
+			os.Exit(1)
+		}
+		opts = append(opts, opt(enabled))
 	}
 
-	confStr := os.Getenv("BENTHOS_CONFIG")
-	if confStr == "" {
-		confStr = os.Getenv("CONNECT_CONFIG")
+	confYAML := serverless.ConfigFromEnv()
+	if secrets.HasReferences(confYAML) {
+		fmt.Fprintf(os.Stderr, "Initialisation error: %v\n", secrets.ErrConfigReferences)
+		os.Exit(1)
 	}
 
-	if confStr == "" {
-		// Iterate default config paths
-		for _, path := range defaultPaths {
-			if confBytes, err := os.ReadFile(path); err == nil {
-				confStr = string(confBytes)
-				break
-			}
-		}
+	envLookup, err := secrets.EnvLookup(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Initialisation error: %v\n", err)
+		os.Exit(1)
 	}
+	opts = append(opts, serverless.OptEnvVarLookupFunc(envLookup))
 
-	var err error
-	if handler, err = serverless.NewHandler(confStr); err != nil {
+	if handler, err = serverless.NewHandler(confYAML, opts...); err != nil {
 		fmt.Fprintf(os.Stderr, "Initialisation error: %v\n", err)
 		os.Exit(1)
 	}
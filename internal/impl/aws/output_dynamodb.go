@@ -19,7 +19,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,7 +30,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/cenkalti/backoff/v4"
+	"github.com/gofrs/uuid"
 
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 
 	"github.com/redpanda-data/connect/v4/internal/impl/aws/config"
@@ -44,14 +48,40 @@ const (
 	ddboFieldTTL            = "ttl"
 	ddboFieldTTLKey         = "ttl_key"
 	ddboFieldBatching       = "batching"
+	ddboFieldAction         = "action"
+	ddboFieldUpdateMapping  = "update_mapping"
+	ddboFieldCondition      = "condition"
+	ddboFieldTransaction    = "transaction"
+
+	// Condition Fields
+	ddbocFieldExpression = "expression"
+	ddbocFieldNames      = "names"
+	ddbocFieldValues     = "values"
+
+	// Actions
+	ddboActionPut    = "put"
+	ddboActionUpdate = "update"
+	ddboActionDelete = "delete"
+
+	ddboMaxTransactItems = 100
 )
 
+type ddboConditionConfig struct {
+	Expression string
+	Names      map[string]string
+	Values     *bloblang.Executor
+}
+
 type ddboConfig struct {
 	Table          string
 	StringColumns  map[string]*service.InterpolatedString
 	JSONMapColumns map[string]string
 	TTL            string
 	TTLKey         string
+	Action         *service.InterpolatedString
+	UpdateMapping  *bloblang.Executor
+	Condition      ddboConditionConfig
+	Transaction    bool
 
 	aconf       aws.Config
 	backoffCtor func() backoff.BackOff
@@ -73,6 +103,28 @@ func ddboConfigFromParsed(pConf *service.ParsedConfig) (conf ddboConfig, err err
 	if conf.TTLKey, err = pConf.FieldString(ddboFieldTTLKey); err != nil {
 		return
 	}
+	if conf.Action, err = pConf.FieldInterpolatedString(ddboFieldAction); err != nil {
+		return
+	}
+	if pConf.Contains(ddboFieldUpdateMapping) {
+		if conf.UpdateMapping, err = pConf.FieldBloblang(ddboFieldUpdateMapping); err != nil {
+			return
+		}
+	}
+	if conf.Condition.Expression, err = pConf.FieldString(ddboFieldCondition, ddbocFieldExpression); err != nil {
+		return
+	}
+	if conf.Condition.Names, err = pConf.FieldStringMap(ddboFieldCondition, ddbocFieldNames); err != nil {
+		return
+	}
+	if pConf.Contains(ddboFieldCondition, ddbocFieldValues) {
+		if conf.Condition.Values, err = pConf.FieldBloblang(ddboFieldCondition, ddbocFieldValues); err != nil {
+			return
+		}
+	}
+	if conf.Transaction, err = pConf.FieldBool(ddboFieldTransaction); err != nil {
+		return
+	}
 	if conf.aconf, err = GetSession(context.TODO(), pConf); err != nil {
 		return
 	}
@@ -87,7 +139,7 @@ func ddboOutputSpec() *service.ConfigSpec {
 		Stable().
 		Version("3.36.0").
 		Categories("Services", "AWS").
-		Summary(`Inserts items into a DynamoDB table.`).
+		Summary(`Inserts, updates or deletes items of a DynamoDB table.`).
 		Description(`
 The field `+"`string_columns`"+` is a map of column names to string values, where the values are xref:configuration:interpolation.adoc#bloblang-queries[function interpolated] per message of a batch. This allows you to populate string columns of an item by extracting fields within the document payload or metadata like follows:
 
@@ -116,6 +168,34 @@ json_map_columns:
 
 In which case the top level document fields will be written at the root of the item, potentially overwriting previously defined column values. If a path is not found within a document the column will not be populated.
 
+== Actions
+
+The field `+"`action`"+` determines whether each message is written as a `+"`put`"+` of the whole item, an `+"`update`"+` of an existing item, or a `+"`delete`"+` of an item, and can be interpolated per message, allowing tombstone messages to delete items:
+
+`+"```yml"+`
+action: ${! if meta("kafka_tombstone_message") == "true" { "delete" } else { "put" } }
+`+"```"+`
+
+Updates and deletes identify the item from the key attributes of the table, which are taken from the columns of the message. By default an update sets all other columns of the message, and alternatively the field `+"`update_mapping`"+` can be used to build the update from a xref:guides:bloblang/about.adoc[Bloblang mapping] that results in an object of attributes to set, where attributes with a `+"`null`"+` value are removed from the item.
+
+== Conditional writes
+
+A https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/Expressions.ConditionExpressions.html[condition expression^] can be set with the field `+"`condition.expression`"+`, which must be satisfied for a write to succeed, such as for optimistic locking:
+
+`+"```yml"+`
+condition:
+  expression: 'attribute_not_exists(#v) OR #v < :version'
+  names:
+    '#v': version
+  values: 'root.version = this.version'
+`+"```"+`
+
+Messages that fail their condition are rejected without being retried. As conditional writes, updates and deletes cannot be performed with a batch write request, messages that require them are written individually unless `+"`transaction`"+` is enabled. The writes of a batch are performed in order, where the messages of a batch write request are written before any individual write that follows them.
+
+== Transactions
+
+When `+"`transaction`"+` is set to `+"`true`"+` each batch of up to 100 messages is written atomically with a TransactWriteItems request, where either all writes of a batch succeed or none of them are applied, and therefore when batching at the output level `+"`batching.count`"+` must be set to no more than 100. When a transaction is cancelled each message fails with the reason for its cancellation, such as a condition check failure, and transactions cancelled due to conflicts or throttling are retried according to the backoff policy.
+
 == Credentials
 
 By default Redpanda Connect will use a shared credentials file when connecting to AWS services. It's also possible to set them explicitly at the component level, allowing you to transfer data across accounts. You can find out more in xref:guides:cloud/aws.adoc[].
@@ -156,6 +236,40 @@ This output benefits from sending messages as a batch for improved performance.
 				Description("The column key to place the TTL value within.").
 				Default("").
 				Advanced(),
+			service.NewInterpolatedStringField(ddboFieldAction).
+				Description("The action to perform for each message, which must be one of `put`, `update` or `delete`.").
+				Default(ddboActionPut).
+				Version("4.31.0").
+				Example(`${! meta("action") }`),
+			service.NewBloblangField(ddboFieldUpdateMapping).
+				Description("An optional xref:guides:bloblang/about.adoc[Bloblang mapping] that results in an object of attributes to set for update actions, where attributes with a null value are removed from the item. When empty all columns other than the key attributes of the table are set.").
+				Optional().
+				Version("4.31.0").
+				Example(`root.count = this.count
+root.last_seen = now()
+root.pending = null`),
+			service.NewObjectField(ddboFieldCondition,
+				service.NewStringField(ddbocFieldExpression).
+					Description("A condition expression that must be satisfied for each write to succeed, or empty for unconditional writes.").
+					Default("").
+					Example("attribute_not_exists(id)"),
+				service.NewStringMapField(ddbocFieldNames).
+					Description("A map of expression attribute name placeholders to attribute names.").
+					Default(map[string]any{}).
+					Example(map[string]any{"#v": "version"}),
+				service.NewBloblangField(ddbocFieldValues).
+					Description("An optional xref:guides:bloblang/about.adoc[Bloblang mapping] that results in an object of expression attribute value placeholders, with or without their leading colon, to values.").
+					Optional().
+					Example(`root.version = this.version`),
+			).
+				Description("A condition for writes.").
+				Version("4.31.0").
+				Advanced(),
+			service.NewBoolField(ddboFieldTransaction).
+				Description("Whether to write each batch atomically with a transaction, which is limited to 100 messages. When batching at the output level `batching.count` must therefore be set to no more than 100.").
+				Default(false).
+				Version("4.31.0").
+				Advanced(),
 			service.NewOutputMaxInFlightField(),
 			service.NewBatchPolicyField(ddboFieldBatching),
 		).
@@ -176,6 +290,9 @@ func init() {
 			if wConf, err = ddboConfigFromParsed(conf); err != nil {
 				return
 			}
+			if err = ddboCheckTransactionBatching(wConf, batchPolicy); err != nil {
+				return
+			}
 			out, err = newDynamoDBWriter(wConf, mgr)
 			return
 		})
@@ -184,6 +301,19 @@ func init() {
 	}
 }
 
+// ddboCheckTransactionBatching ensures that batches formed by the output fit
+// within a transaction, as a transaction that exceeds the limit would fail on
+// every attempt.
+func ddboCheckTransactionBatching(conf ddboConfig, policy service.BatchPolicy) error {
+	if !conf.Transaction || policy.IsNoop() {
+		return nil
+	}
+	if policy.Count <= 0 || policy.Count > ddboMaxTransactItems {
+		return fmt.Errorf("field %v.count must be set between 1 and %v when %v is enabled", ddboFieldBatching, ddboMaxTransactItems, ddboFieldTransaction)
+	}
+	return nil
+}
+
 type dynamoDBAPI interface {
 	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
 	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
@@ -191,6 +321,8 @@ type dynamoDBAPI interface {
 	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
 	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
 	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
 }
 
 type dynamoDBWriter struct {
@@ -200,8 +332,9 @@ type dynamoDBWriter struct {
 
 	boffPool sync.Pool
 
-	table *string
-	ttl   time.Duration
+	table    *string
+	ttl      time.Duration
+	keyNames []string
 }
 
 func newDynamoDBWriter(conf ddboConfig, mgr *service.Resources) (*dynamoDBWriter, error) {
@@ -248,6 +381,10 @@ func (d *dynamoDBWriter) Connect(ctx context.Context) error {
 		return fmt.Errorf("dynamodb table '%s' must be active", d.conf.Table)
 	}
 
+	d.keyNames = nil
+	for _, k := range out.Table.KeySchema {
+		d.keyNames = append(d.keyNames, aws.ToString(k.AttributeName))
+	}
 	d.client = client
 	return nil
 }
@@ -312,6 +449,317 @@ func jsonToMap(path string, root any) (types.AttributeValue, error) {
 	return anyToAttributeValue(gObj.Data()), nil
 }
 
+// ddboWriteOp is the write of a single message.
+type ddboWriteOp struct {
+	action string
+	item   map[string]types.AttributeValue
+	key    map[string]types.AttributeValue
+
+	updateExpression    *string
+	conditionExpression *string
+	names               map[string]string
+	values              map[string]types.AttributeValue
+}
+
+// batchable returns whether the write can be performed as part of a batch
+// write request, which doesn't support updates or conditions.
+func (o *ddboWriteOp) batchable() bool {
+	return o.action != ddboActionUpdate && o.conditionExpression == nil
+}
+
+func (o *ddboWriteOp) writeRequest() types.WriteRequest {
+	if o.action == ddboActionDelete {
+		return types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: o.key},
+		}
+	}
+	return types.WriteRequest{
+		PutRequest: &types.PutRequest{Item: o.item},
+	}
+}
+
+func (o *ddboWriteOp) transactItem(table *string) types.TransactWriteItem {
+	switch o.action {
+	case ddboActionUpdate:
+		return types.TransactWriteItem{Update: &types.Update{
+			TableName:                 table,
+			Key:                       o.key,
+			UpdateExpression:          o.updateExpression,
+			ConditionExpression:       o.conditionExpression,
+			ExpressionAttributeNames:  o.names,
+			ExpressionAttributeValues: o.values,
+		}}
+	case ddboActionDelete:
+		return types.TransactWriteItem{Delete: &types.Delete{
+			TableName:                 table,
+			Key:                       o.key,
+			ConditionExpression:       o.conditionExpression,
+			ExpressionAttributeNames:  o.names,
+			ExpressionAttributeValues: o.values,
+		}}
+	}
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName:                 table,
+		Item:                      o.item,
+		ConditionExpression:       o.conditionExpression,
+		ExpressionAttributeNames:  o.names,
+		ExpressionAttributeValues: o.values,
+	}}
+}
+
+func (d *dynamoDBWriter) writeItem(ctx context.Context, o *ddboWriteOp) (err error) {
+	switch o.action {
+	case ddboActionUpdate:
+		_, err = d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 d.table,
+			Key:                       o.key,
+			UpdateExpression:          o.updateExpression,
+			ConditionExpression:       o.conditionExpression,
+			ExpressionAttributeNames:  o.names,
+			ExpressionAttributeValues: o.values,
+		})
+	case ddboActionDelete:
+		_, err = d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:                 d.table,
+			Key:                       o.key,
+			ConditionExpression:       o.conditionExpression,
+			ExpressionAttributeNames:  o.names,
+			ExpressionAttributeValues: o.values,
+		})
+	default:
+		_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                 d.table,
+			Item:                      o.item,
+			ConditionExpression:       o.conditionExpression,
+			ExpressionAttributeNames:  o.names,
+			ExpressionAttributeValues: o.values,
+		})
+	}
+	return
+}
+
+func (d *dynamoDBWriter) itemFromMessage(b service.MessageBatch, i int) (map[string]types.AttributeValue, error) {
+	items := map[string]types.AttributeValue{}
+	if d.ttl != 0 && d.conf.TTLKey != "" {
+		items[d.conf.TTLKey] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(time.Now().Add(d.ttl).Unix(), 10),
+		}
+	}
+	for k, v := range d.conf.StringColumns {
+		s, err := b.TryInterpolatedString(i, v)
+		if err != nil {
+			return nil, fmt.Errorf("string column %v interpolation error: %w", k, err)
+		}
+		items[k] = &types.AttributeValueMemberS{
+			Value: s,
+		}
+	}
+	if len(d.conf.JSONMapColumns) > 0 {
+		jRoot, err := b[i].AsStructured()
+		if err != nil {
+			d.log.Errorf("Failed to extract JSON maps from document: %v", err)
+			return nil, err
+		}
+		for k, v := range d.conf.JSONMapColumns {
+			if attr, err := jsonToMap(v, jRoot); err == nil {
+				if k == "" {
+					if mv, ok := attr.(*types.AttributeValueMemberM); ok {
+						for ak, av := range mv.Value {
+							items[ak] = av
+						}
+					} else {
+						items[k] = attr
+					}
+				} else {
+					items[k] = attr
+				}
+			} else {
+				d.log.Warnf("Unable to extract JSON map path '%v' from document: %v", v, err)
+				return nil, err
+			}
+		}
+	}
+	return items, nil
+}
+
+func (d *dynamoDBWriter) keyFromItem(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	if len(d.keyNames) == 0 {
+		return nil, errors.New("the key schema of the table is unknown")
+	}
+	key := make(map[string]types.AttributeValue, len(d.keyNames))
+	for _, k := range d.keyNames {
+		v, exists := item[k]
+		if !exists {
+			return nil, fmt.Errorf("key attribute %v is missing from the item", k)
+		}
+		key[k] = v
+	}
+	return key, nil
+}
+
+// mappedToAttributeValue converts the result of a mapping into an attribute
+// value, where unlike columns extracted from documents numbers are preserved
+// as number attributes.
+func mappedToAttributeValue(root any) types.AttributeValue {
+	switch v := root.(type) {
+	case json.Number:
+		return &types.AttributeValueMemberN{
+			Value: v.String(),
+		}
+	case map[string]any:
+		m := make(map[string]types.AttributeValue, len(v))
+		for k, v2 := range v {
+			m[k] = mappedToAttributeValue(v2)
+		}
+		return &types.AttributeValueMemberM{
+			Value: m,
+		}
+	case []any:
+		l := make([]types.AttributeValue, len(v))
+		for i, v2 := range v {
+			l[i] = mappedToAttributeValue(v2)
+		}
+		return &types.AttributeValueMemberL{
+			Value: l,
+		}
+	}
+	return anyToAttributeValue(root)
+}
+
+// structuredMapping executes a mapping that must result in an object.
+func structuredMapping(b service.MessageBatch, i int, exec *bloblang.Executor) (map[string]any, error) {
+	res, err := b.BloblangQuery(i, exec)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, nil
+	}
+	v, err := res.AsStructured()
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected mapping to result in an object, got %T", v)
+	}
+	return obj, nil
+}
+
+func (d *dynamoDBWriter) toWriteOp(b service.MessageBatch, i int) (*ddboWriteOp, error) {
+	action, err := b.TryInterpolatedString(i, d.conf.Action)
+	if err != nil {
+		return nil, fmt.Errorf("action interpolation error: %w", err)
+	}
+
+	op := &ddboWriteOp{action: action}
+	if op.item, err = d.itemFromMessage(b, i); err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+
+	switch action {
+	case ddboActionPut:
+	case ddboActionDelete:
+		if op.key, err = d.keyFromItem(op.item); err != nil {
+			return nil, err
+		}
+	case ddboActionUpdate:
+		if op.key, err = d.keyFromItem(op.item); err != nil {
+			return nil, err
+		}
+
+		var attrs map[string]types.AttributeValue
+		if d.conf.UpdateMapping != nil {
+			mapped, err := structuredMapping(b, i, d.conf.UpdateMapping)
+			if err != nil {
+				return nil, fmt.Errorf("update mapping error: %w", err)
+			}
+			attrs = make(map[string]types.AttributeValue, len(mapped))
+			for k, v := range mapped {
+				if v == nil {
+					attrs[k] = nil
+				} else {
+					attrs[k] = mappedToAttributeValue(v)
+				}
+			}
+			if ttl, exists := op.item[d.conf.TTLKey]; exists && d.conf.TTLKey != "" {
+				attrs[d.conf.TTLKey] = ttl
+			}
+		} else {
+			attrs = make(map[string]types.AttributeValue, len(op.item))
+			for k, v := range op.item {
+				if _, isKey := op.key[k]; !isKey {
+					attrs[k] = v
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var sets, removes []string
+		for j, k := range keys {
+			name := "#_u" + strconv.Itoa(j)
+			names[name] = k
+			if attrs[k] == nil {
+				removes = append(removes, name)
+				continue
+			}
+			value := ":_u" + strconv.Itoa(j)
+			values[value] = attrs[k]
+			sets = append(sets, name+" = "+value)
+		}
+
+		var expr []string
+		if len(sets) > 0 {
+			expr = append(expr, "SET "+strings.Join(sets, ", "))
+		}
+		if len(removes) > 0 {
+			expr = append(expr, "REMOVE "+strings.Join(removes, ", "))
+		}
+		if len(expr) == 0 {
+			return nil, errors.New("update resulted in no attributes to set or remove")
+		}
+		op.updateExpression = aws.String(strings.Join(expr, " "))
+	default:
+		return nil, fmt.Errorf("action %v is not supported, expected %v, %v or %v", action, ddboActionPut, ddboActionUpdate, ddboActionDelete)
+	}
+
+	if d.conf.Condition.Expression != "" {
+		op.conditionExpression = aws.String(d.conf.Condition.Expression)
+		for k, v := range d.conf.Condition.Names {
+			names[k] = v
+		}
+		if d.conf.Condition.Values != nil {
+			mapped, err := structuredMapping(b, i, d.conf.Condition.Values)
+			if err != nil {
+				return nil, fmt.Errorf("condition values mapping error: %w", err)
+			}
+			for k, v := range mapped {
+				if !strings.HasPrefix(k, ":") {
+					k = ":" + k
+				}
+				values[k] = mappedToAttributeValue(v)
+			}
+		}
+	}
+
+	// Empty expression attribute maps are rejected by DynamoDB.
+	if len(names) > 0 {
+		op.names = names
+	}
+	if len(values) > 0 {
+		op.values = values
+	}
+	return op, nil
+}
+
 func (d *dynamoDBWriter) WriteBatch(ctx context.Context, b service.MessageBatch) error {
 	if d.client == nil {
 		return service.ErrNotConnected
@@ -323,56 +771,174 @@ func (d *dynamoDBWriter) WriteBatch(ctx context.Context, b service.MessageBatch)
 		d.boffPool.Put(boff)
 	}()
 
-	writeReqs := []types.WriteRequest{}
-	if err := b.WalkWithBatchedErrors(func(i int, p *service.Message) error {
-		items := map[string]types.AttributeValue{}
-		if d.ttl != 0 && d.conf.TTLKey != "" {
-			items[d.conf.TTLKey] = &types.AttributeValueMemberN{
-				Value: strconv.FormatInt(time.Now().Add(d.ttl).Unix(), 10),
-			}
+	ops := make([]*ddboWriteOp, len(b))
+	if err := b.WalkWithBatchedErrors(func(i int, p *service.Message) (err error) {
+		ops[i], err = d.toWriteOp(b, i)
+		return
+	}); err != nil {
+		return err
+	}
+
+	if d.conf.Transaction {
+		return d.writeTransaction(ctx, b, ops, boff)
+	}
+
+	// Batchable writes are accumulated into batch write requests, which are
+	// flushed before each write that must be performed individually in order
+	// to preserve the order of writes to the same item.
+	batchErr := service.NewBatchError(b, errors.New("failed to write messages"))
+	var batchIndexes []int
+	flushBatch := func() {
+		if len(batchIndexes) == 0 {
+			return
 		}
-		for k, v := range d.conf.StringColumns {
-			s, err := b.TryInterpolatedString(i, v)
-			if err != nil {
-				return fmt.Errorf("string column %v interpolation error: %w", k, err)
-			}
-			items[k] = &types.AttributeValueMemberS{
-				Value: s,
+		err := d.writeBatchRequest(ctx, b, ops, batchIndexes, boff)
+		var bErr *service.BatchError
+		if errors.As(err, &bErr) {
+			bErr.WalkMessages(func(i int, _ *service.Message, err error) bool {
+				if err != nil {
+					batchErr.Failed(i, err)
+				}
+				return true
+			})
+		} else if err != nil {
+			for _, i := range batchIndexes {
+				batchErr.Failed(i, err)
 			}
 		}
-		if len(d.conf.JSONMapColumns) > 0 {
-			jRoot, err := p.AsStructured()
-			if err != nil {
-				d.log.Errorf("Failed to extract JSON maps from document: %v", err)
-				return err
+		boff.Reset()
+		batchIndexes = nil
+	}
+
+	var individualWrites bool
+	for i, op := range ops {
+		if op.batchable() {
+			batchIndexes = append(batchIndexes, i)
+			continue
+		}
+		individualWrites = true
+		flushBatch()
+		if err := d.writeItemWithRetries(ctx, op, boff); err != nil {
+			d.log.Errorf("Write error: %v", err)
+			batchErr.Failed(i, err)
+		}
+		boff.Reset()
+	}
+	if !individualWrites {
+		return d.writeBatchRequest(ctx, b, ops, batchIndexes, boff)
+	}
+	flushBatch()
+
+	if batchErr.IndexedErrors() > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// writeItemWithRetries writes a single item, retrying failed writes other than
+// condition check failures according to the backoff policy.
+func (d *dynamoDBWriter) writeItemWithRetries(ctx context.Context, op *ddboWriteOp, boff backoff.BackOff) error {
+	for {
+		err := d.writeItem(ctx, op)
+		if err == nil {
+			return nil
+		}
+
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return err
+		}
+
+		wait := boff.NextBackOff()
+		if wait == backoff.Stop {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Cancellation reasons of a transaction that are worth retrying.
+var ddboRetryableCancellations = map[string]struct{}{
+	"TransactionConflict":           {},
+	"ProvisionedThroughputExceeded": {},
+	"ThrottlingError":               {},
+}
+
+func (d *dynamoDBWriter) writeTransaction(ctx context.Context, b service.MessageBatch, ops []*ddboWriteOp, boff backoff.BackOff) error {
+	if len(ops) > ddboMaxTransactItems {
+		return fmt.Errorf("batch of %v messages exceeds the maximum of %v items in a transaction", len(ops), ddboMaxTransactItems)
+	}
+
+	items := make([]types.TransactWriteItem, len(ops))
+	for i, op := range ops {
+		items[i] = op.transactItem(d.table)
+	}
+
+	// The token makes retries of the transaction idempotent.
+	token, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems:      items,
+		ClientRequestToken: aws.String(token.String()),
+	}
+	for {
+		_, err := d.client.TransactWriteItems(ctx, input)
+		if err == nil {
+			return nil
+		}
+		d.log.Errorf("Transaction error: %v", err)
+
+		var cancelErr *types.TransactionCanceledException
+		if errors.As(err, &cancelErr) {
+			// As the transaction is atomic every message has failed, but only
+			// those with a reason caused the cancellation.
+			batchErr := service.NewBatchError(b, err)
+			for i := range b {
+				batchErr.Failed(i, err)
 			}
-			for k, v := range d.conf.JSONMapColumns {
-				if attr, err := jsonToMap(v, jRoot); err == nil {
-					if k == "" {
-						if mv, ok := attr.(*types.AttributeValueMemberM); ok {
-							for ak, av := range mv.Value {
-								items[ak] = av
-							}
-						} else {
-							items[k] = attr
-						}
-					} else {
-						items[k] = attr
-					}
-				} else {
-					d.log.Warnf("Unable to extract JSON map path '%v' from document: %v", v, err)
-					return err
+
+			retryable := true
+			for i, r := range cancelErr.CancellationReasons {
+				code := aws.ToString(r.Code)
+				if code == "" || code == "None" || i >= len(b) {
+					continue
+				}
+				if _, ok := ddboRetryableCancellations[code]; !ok {
+					retryable = false
 				}
+				batchErr.Failed(i, fmt.Errorf("transaction cancelled due to %v: %v", code, aws.ToString(r.Message)))
 			}
+			if !retryable {
+				return batchErr
+			}
+			err = batchErr
 		}
-		writeReqs = append(writeReqs, types.WriteRequest{
-			PutRequest: &types.PutRequest{
-				Item: items,
-			},
-		})
-		return nil
-	}); err != nil {
-		return err
+
+		wait := boff.NextBackOff()
+		if wait == backoff.Stop {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// writeBatchRequest writes the messages of the given indexes with batch write
+// requests, falling back to individual writes if the request fails.
+func (d *dynamoDBWriter) writeBatchRequest(ctx context.Context, b service.MessageBatch, ops []*ddboWriteOp, indexes []int, boff backoff.BackOff) error {
+	writeReqs := make([]types.WriteRequest, len(indexes))
+	for j, i := range indexes {
+		writeReqs[j] = ops[i].writeRequest()
 	}
 
 	batchResult, err := d.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
@@ -384,17 +950,15 @@ func (d *dynamoDBWriter) WriteBatch(ctx context.Context, b service.MessageBatch)
 		headlineErr := err
 
 		// None of the messages were successful, attempt to send individually
+		written := make([]bool, len(indexes))
 	individualRequestsLoop:
 		for err != nil {
 			batchErr := service.NewBatchError(b, headlineErr)
-			for i, req := range writeReqs {
-				if req.PutRequest == nil {
+			for j, i := range indexes {
+				if written[j] {
 					continue
 				}
-				if _, iErr := d.client.PutItem(ctx, &dynamodb.PutItemInput{
-					TableName: d.table,
-					Item:      req.PutRequest.Item,
-				}); iErr != nil {
+				if iErr := d.writeItem(ctx, ops[i]); iErr != nil {
 					d.log.Errorf("Put error: %v\n", iErr)
 					wait := boff.NextBackOff()
 					if wait == backoff.Stop {
@@ -407,7 +971,7 @@ func (d *dynamoDBWriter) WriteBatch(ctx context.Context, b service.MessageBatch)
 					}
 					batchErr.Failed(i, iErr)
 				} else {
-					writeReqs[i].PutRequest = nil
+					written[j] = true
 				}
 			}
 			if batchErr.IndexedErrors() == 0 {
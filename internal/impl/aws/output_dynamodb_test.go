@@ -30,8 +30,11 @@ import (
 
 type mockDynamoDB struct {
 	dynamoDBAPI
-	fn      func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
-	batchFn func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	fn         func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	batchFn    func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	updateFn   func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+	deleteFn   func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	transactFn func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
 }
 
 func (m *mockDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
@@ -42,6 +45,18 @@ func (m *mockDynamoDB) BatchWriteItem(ctx context.Context, params *dynamodb.Batc
 	return m.batchFn(params)
 }
 
+func (m *mockDynamoDB) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return m.updateFn(params)
+}
+
+func (m *mockDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return m.deleteFn(params)
+}
+
+func (m *mockDynamoDB) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return m.transactFn(params)
+}
+
 func testDDBOWriter(t *testing.T, conf string) *dynamoDBWriter {
 	t.Helper()
 
@@ -509,3 +524,401 @@ string_columns:
 
 	assert.Equal(t, expected, requests)
 }
+
+func TestDynamoDBDeleteAction(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+  content: ${!json("content")}
+action: ${! if json("deleted") == true { "delete" } else { "put" } }
+`)
+	db.keyNames = []string{"id"}
+
+	var request []types.WriteRequest
+	db.client = &mockDynamoDB{
+		batchFn: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+			request = input.RequestItems["FooTable"]
+			return &dynamodb.BatchWriteItemOutput{}, nil
+		},
+	}
+
+	require.NoError(t, db.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo","content":"foo stuff"}`)),
+		service.NewMessage([]byte(`{"id":"bar","deleted":true}`)),
+	}))
+
+	assert.Equal(t, []types.WriteRequest{
+		{
+			PutRequest: &types.PutRequest{
+				Item: map[string]types.AttributeValue{
+					"id":      &types.AttributeValueMemberS{Value: "foo"},
+					"content": &types.AttributeValueMemberS{Value: "foo stuff"},
+				},
+			},
+		},
+		{
+			DeleteRequest: &types.DeleteRequest{
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: "bar"},
+				},
+			},
+		},
+	}, request)
+}
+
+func TestDynamoDBUpdateAction(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+action: update
+update_mapping: |
+  root.count = this.count
+  root.pending = null
+condition:
+  expression: 'attribute_not_exists(#v) OR #v < :version'
+  names:
+    '#v': version
+  values: 'root.version = this.version'
+`)
+	db.keyNames = []string{"id"}
+
+	var requests []*dynamodb.UpdateItemInput
+	db.client = &mockDynamoDB{
+		updateFn: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			requests = append(requests, input)
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+
+	require.NoError(t, db.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo","count":5,"version":3}`)),
+	}))
+
+	assert.Equal(t, []*dynamodb.UpdateItemInput{
+		{
+			TableName: aws.String("FooTable"),
+			Key: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: "foo"},
+			},
+			UpdateExpression:    aws.String("SET #_u0 = :_u0 REMOVE #_u1"),
+			ConditionExpression: aws.String("attribute_not_exists(#v) OR #v < :version"),
+			ExpressionAttributeNames: map[string]string{
+				"#_u0": "count",
+				"#_u1": "pending",
+				"#v":   "version",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":_u0":     &types.AttributeValueMemberN{Value: "5"},
+				":version": &types.AttributeValueMemberN{Value: "3"},
+			},
+		},
+	}, requests)
+}
+
+func TestDynamoDBUpdateDefaultColumns(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+  content: ${!json("content")}
+action: update
+`)
+	db.keyNames = []string{"id"}
+
+	var requests []*dynamodb.UpdateItemInput
+	db.client = &mockDynamoDB{
+		updateFn: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			requests = append(requests, input)
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+
+	require.NoError(t, db.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo","content":"foo stuff"}`)),
+	}))
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, "SET #_u0 = :_u0", *requests[0].UpdateExpression)
+	assert.Equal(t, map[string]string{"#_u0": "content"}, requests[0].ExpressionAttributeNames)
+
+	db.keyNames = nil
+	require.Error(t, db.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo","content":"foo stuff"}`)),
+	}))
+}
+
+func TestDynamoDBConditionalPut(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+condition:
+  expression: attribute_not_exists(id)
+backoff:
+  max_elapsed_time: 100ms
+`)
+
+	var requests []*dynamodb.PutItemInput
+	condErr := &types.ConditionalCheckFailedException{Message: aws.String("nope")}
+	db.client = &mockDynamoDB{
+		fn: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			requests = append(requests, input)
+			if input.Item["id"].(*types.AttributeValueMemberS).Value == "bar" {
+				return nil, condErr
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		batchFn: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+			t.Error("not expected")
+			return nil, errors.New("not implemented")
+		},
+	}
+
+	msg := service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo"}`)),
+		service.NewMessage([]byte(`{"id":"bar"}`)),
+	}
+	err := db.WriteBatch(context.Background(), msg)
+
+	var bErr *service.BatchError
+	require.ErrorAs(t, err, &bErr)
+
+	var failed []int
+	bErr.WalkMessages(func(i int, _ *service.Message, err error) bool {
+		if err != nil {
+			failed = append(failed, i)
+			assert.ErrorIs(t, err, condErr)
+		}
+		return true
+	})
+	assert.Equal(t, []int{1}, failed)
+
+	// Condition check failures are not retried.
+	require.Len(t, requests, 2)
+	assert.Equal(t, "attribute_not_exists(id)", *requests[1].ConditionExpression)
+}
+
+func TestDynamoDBTransaction(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+action: ${! json("action") }
+transaction: true
+`)
+	db.keyNames = []string{"id"}
+
+	var requests []*dynamodb.TransactWriteItemsInput
+	db.client = &mockDynamoDB{
+		transactFn: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			requests = append(requests, input)
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+
+	require.NoError(t, db.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo","action":"put"}`)),
+		service.NewMessage([]byte(`{"id":"bar","action":"delete"}`)),
+	}))
+
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0].TransactItems, 2)
+	assert.NotEmpty(t, *requests[0].ClientRequestToken)
+	assert.Equal(t, &types.Put{
+		TableName: aws.String("FooTable"),
+		Item: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: "foo"},
+		},
+	}, requests[0].TransactItems[0].Put)
+	assert.Equal(t, &types.Delete{
+		TableName: aws.String("FooTable"),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: "bar"},
+		},
+	}, requests[0].TransactItems[1].Delete)
+}
+
+func TestDynamoDBTransactionCancelled(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+transaction: true
+condition:
+  expression: attribute_not_exists(id)
+`)
+
+	var attempts int
+	db.client = &mockDynamoDB{
+		transactFn: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+			attempts++
+			return nil, &types.TransactionCanceledException{
+				Message: aws.String("Transaction cancelled"),
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")},
+				},
+			}
+		},
+	}
+
+	msg := service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo"}`)),
+		service.NewMessage([]byte(`{"id":"bar"}`)),
+	}
+	err := db.WriteBatch(context.Background(), msg)
+	assert.Equal(t, 1, attempts)
+
+	var bErr *service.BatchError
+	require.ErrorAs(t, err, &bErr)
+
+	var errs []string
+	bErr.WalkMessages(func(i int, _ *service.Message, err error) bool {
+		require.Error(t, err)
+		errs = append(errs, err.Error())
+		return true
+	})
+	require.Len(t, errs, 2)
+	assert.Contains(t, errs[0], "Transaction cancelled")
+	assert.Equal(t, "transaction cancelled due to ConditionalCheckFailed: The conditional request failed", errs[1])
+}
+
+func TestDynamoDBTransactionTooLarge(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+transaction: true
+`)
+	db.client = &mockDynamoDB{}
+
+	var msg service.MessageBatch
+	for i := 0; i < 101; i++ {
+		msg = append(msg, service.NewMessage([]byte(`{"id":"foo"}`)))
+	}
+	require.Error(t, db.WriteBatch(context.Background(), msg))
+}
+
+func TestDynamoDBBadAction(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+action: upsert
+`)
+	db.client = &mockDynamoDB{}
+
+	require.Error(t, db.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo"}`)),
+	}))
+}
+
+func TestDynamoDBMixedBatchOrder(t *testing.T) {
+	db := testDDBOWriter(t, `
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+  content: ${!json("content")}
+action: ${! json("action") }
+`)
+	db.keyNames = []string{"id"}
+
+	var writes []string
+	db.client = &mockDynamoDB{
+		batchFn: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+			for _, r := range input.RequestItems["FooTable"] {
+				writes = append(writes, "batch put "+r.PutRequest.Item["id"].(*types.AttributeValueMemberS).Value)
+			}
+			return &dynamodb.BatchWriteItemOutput{}, nil
+		},
+		updateFn: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			writes = append(writes, "update "+input.Key["id"].(*types.AttributeValueMemberS).Value)
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+
+	require.NoError(t, db.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":"foo","content":"foo stuff","action":"put"}`)),
+		service.NewMessage([]byte(`{"id":"bar","content":"bar stuff","action":"put"}`)),
+		service.NewMessage([]byte(`{"id":"foo","content":"more foo stuff","action":"update"}`)),
+		service.NewMessage([]byte(`{"id":"baz","content":"baz stuff","action":"put"}`)),
+	}))
+
+	assert.Equal(t, []string{
+		"batch put foo",
+		"batch put bar",
+		"update foo",
+		"batch put baz",
+	}, writes)
+}
+
+func TestDynamoDBTransactionBatching(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		conf        string
+		errContains string
+	}{
+		{
+			name: "no batching",
+			conf: `transaction: true`,
+		},
+		{
+			name: "within limit",
+			conf: `
+transaction: true
+batching:
+  count: 100
+`,
+		},
+		{
+			name: "exceeds limit",
+			conf: `
+transaction: true
+batching:
+  count: 101
+`,
+			errContains: "batching.count",
+		},
+		{
+			name: "unbounded count",
+			conf: `
+transaction: true
+batching:
+  period: 1s
+`,
+			errContains: "batching.count",
+		},
+		{
+			name: "no transaction",
+			conf: `
+batching:
+  count: 101
+`,
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			pConf, err := ddboOutputSpec().ParseYAML(`
+table: FooTable
+string_columns:
+  id: ${!json("id")}
+`+test.conf, nil)
+			require.NoError(t, err)
+
+			dConf, err := ddboConfigFromParsed(pConf)
+			require.NoError(t, err)
+
+			policy, err := pConf.FieldBatchPolicy(ddboFieldBatching)
+			require.NoError(t, err)
+
+			err = ddboCheckTransactionBatching(dConf, policy)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
+		})
+	}
+}
@@ -37,12 +37,25 @@ const (
 	koFieldHashKey      = "hash_key"
 	koFieldPartitionKey = "partition_key"
 	koFieldBatching     = "batching"
+	koFieldAggregation  = "aggregation"
+
+	// Aggregation Fields
+	koaFieldEnabled    = "enabled"
+	koaFieldMaxRecords = "max_records"
+	koaFieldMaxSize    = "max_size"
 )
 
+type koAggregationConfig struct {
+	Enabled    bool
+	MaxRecords int
+	MaxSize    int
+}
+
 type koConfig struct {
 	Stream       string
 	HashKey      *service.InterpolatedString
 	PartitionKey *service.InterpolatedString
+	Aggregation  koAggregationConfig
 
 	aconf       aws.Config
 	backoffCtor func() backoff.BackOff
@@ -60,6 +73,19 @@ func koConfigFromParsed(pConf *service.ParsedConfig) (conf koConfig, err error)
 			return
 		}
 	}
+	if conf.Aggregation.Enabled, err = pConf.FieldBool(koFieldAggregation, koaFieldEnabled); err != nil {
+		return
+	}
+	if conf.Aggregation.MaxRecords, err = pConf.FieldInt(koFieldAggregation, koaFieldMaxRecords); err != nil {
+		return
+	}
+	if conf.Aggregation.MaxSize, err = pConf.FieldInt(koFieldAggregation, koaFieldMaxSize); err != nil {
+		return
+	}
+	if conf.Aggregation.Enabled && (conf.Aggregation.MaxSize <= 0 || conf.Aggregation.MaxSize > mebibyte) {
+		err = fmt.Errorf("field %v.%v must be greater than zero and no more than %v", koFieldAggregation, koaFieldMaxSize, mebibyte)
+		return
+	}
 	if conf.aconf, err = GetSession(context.TODO(), pConf); err != nil {
 		return
 	}
@@ -80,7 +106,13 @@ Both the `+"`partition_key`"+`(required) and `+"`hash_key`"+` (optional) fields
 
 == Credentials
 
-By default Redpanda Connect will use a shared credentials file when connecting to AWS services. It's also possible to set them explicitly at the component level, allowing you to transfer data across accounts. You can find out more in xref:guides:cloud/aws.adoc[].`+service.OutputPerformanceDocs(true, true)).
+By default Redpanda Connect will use a shared credentials file when connecting to AWS services. It's also possible to set them explicitly at the component level, allowing you to transfer data across accounts. You can find out more in xref:guides:cloud/aws.adoc[].
+
+== Aggregation
+
+When `+"`aggregation.enabled`"+` is set to `+"`true`"+` the messages of a batch are packed into Kinesis records using the aggregation format of the Kinesis Producer Library (KPL), which reduces the number of records put to the stream and therefore the cost and throughput consumed by small messages. Consumers of the stream must support deaggregation, such as the Kinesis Client Library (KCL), or the `+"`aws_kinesis`"+` input with `+"`deaggregate_records`"+` set to `+"`true`"+`.
+
+Messages are only aggregated with other messages of the same batch that share both their partition key and hash key, which preserves the shard each message is routed to, and therefore aggregation is most effective when combined with batching and a partition key of low cardinality.`+service.OutputPerformanceDocs(true, true)).
 		Fields(
 			service.NewStringField(koFieldStream).
 				Description("The stream to publish messages to. Streams can either be specified by their name or full ARN.").
@@ -94,6 +126,20 @@ By default Redpanda Connect will use a shared credentials file when connecting t
 			service.NewOutputMaxInFlightField().
 				Description("The maximum number of parallel message batches to have in flight at any given time."),
 			service.NewBatchPolicyField(koFieldBatching),
+			service.NewObjectField(koFieldAggregation,
+				service.NewBoolField(koaFieldEnabled).
+					Description("Whether to aggregate messages into records with the KPL aggregation format.").
+					Default(false),
+				service.NewIntField(koaFieldMaxRecords).
+					Description("The maximum number of messages to aggregate into a single record, or 0 for no limit.").
+					Default(0),
+				service.NewIntField(koaFieldMaxSize).
+					Description("The maximum size in bytes of an aggregated record, including its partition key, which cannot exceed 1 MiB. Messages too large to fit within this size on their own are sent without aggregation.").
+					Default(51200),
+			).
+				Description("Aggregate messages into records with the Kinesis Producer Library (KPL) aggregation format.").
+				Version("4.31.0").
+				Advanced(),
 		).
 		Fields(config.SessionFields()...).
 		Fields(retries.CommonRetryBackOffFields(0, "1s", "5s", "30s")...)
@@ -185,8 +231,71 @@ func (a *kinesisWriter) toRecords(batch service.MessageBatch) ([]types.PutRecord
 		entries[i] = entry
 		return nil
 	})
+	if err != nil || !a.conf.Aggregation.Enabled {
+		return entries, err
+	}
+	return aggregateKinesisRecords(entries, a.conf.Aggregation), nil
+}
+
+// aggregateKinesisRecords packs entries into KPL aggregated records, where
+// only entries that share a partition and hash key are aggregated together.
+func aggregateKinesisRecords(entries []types.PutRecordsRequestEntry, conf koAggregationConfig) []types.PutRecordsRequestEntry {
+	type aggKey struct {
+		partKey, hashKey string
+	}
+	type pendingAgg struct {
+		entry types.PutRecordsRequestEntry
+		agg   *kplAggregator
+	}
+
+	var aggregated []types.PutRecordsRequestEntry
+	var order []aggKey
+	pending := map[aggKey]*pendingAgg{}
+
+	flush := func(p *pendingAgg) {
+		p.entry.Data = p.agg.Bytes()
+		aggregated = append(aggregated, p.entry)
+		p.agg.Reset()
+	}
+
+	for _, e := range entries {
+		var k aggKey
+		k.partKey = aws.ToString(e.PartitionKey)
+		k.hashKey = aws.ToString(e.ExplicitHashKey)
+
+		p, exists := pending[k]
+
+		// Messages too large to be aggregated are sent as they are, after any
+		// pending aggregation of the same keys in order to preserve ordering.
+		if len(e.Data)+len(k.partKey)+len(k.hashKey)+kplOverhead+kplRecordOverhead > conf.MaxSize {
+			if exists && p.agg.Len() > 0 {
+				flush(p)
+			}
+			aggregated = append(aggregated, e)
+			continue
+		}
 
-	return entries, err
+		r := kplRecord{PartitionKey: k.partKey, ExplicitHashKey: k.hashKey, Data: e.Data}
+		if !exists {
+			p = &pendingAgg{entry: e, agg: newKPLAggregator()}
+			pending[k] = p
+			order = append(order, k)
+		}
+		if !p.agg.Add(r, conf.MaxSize) {
+			flush(p)
+			p.agg.Add(r, conf.MaxSize)
+		}
+		if conf.MaxRecords > 0 && p.agg.Len() >= conf.MaxRecords {
+			flush(p)
+		}
+	}
+
+	for _, k := range order {
+		if p := pending[k]; p.agg.Len() > 0 {
+			flush(p)
+		}
+	}
+	return aggregated
 }
 
 func (a *kinesisWriter) Connect(ctx context.Context) error {
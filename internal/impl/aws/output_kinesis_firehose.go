@@ -16,6 +16,7 @@ package aws
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -32,12 +33,41 @@ import (
 
 const (
 	// Kinesis Firehose Output Fields
-	kfoFieldStream   = "stream"
-	kfoFieldBatching = "batching"
+	kfoFieldStream              = "stream"
+	kfoFieldBatching            = "batching"
+	kfoFieldDynamicPartitioning = "dynamic_partitioning"
+	kfoFieldAggregation         = "aggregation"
+
+	// Dynamic Partitioning Fields
+	kfodpFieldKeys  = "keys"
+	kfodpFieldField = "field"
+
+	// Aggregation Fields
+	kfoaFieldEnabled    = "enabled"
+	kfoaFieldMaxRecords = "max_records"
+	kfoaFieldMaxSize    = "max_size"
+	kfoaFieldDelimiter  = "delimiter"
+
+	// The maximum size of a Kinesis Firehose record is 1000 KiB.
+	firehoseMaxRecordSize = 1024000
 )
 
+type kfoDynamicPartitioningConfig struct {
+	Keys  map[string]*service.InterpolatedString
+	Field string
+}
+
+type kfoAggregationConfig struct {
+	Enabled    bool
+	MaxRecords int
+	MaxSize    int
+	Delimiter  string
+}
+
 type kfoConfig struct {
-	Stream string
+	Stream              string
+	DynamicPartitioning kfoDynamicPartitioningConfig
+	Aggregation         kfoAggregationConfig
 
 	aconf       aws.Config
 	backoffCtor func() backoff.BackOff
@@ -47,6 +77,32 @@ func kfoConfigFromParsed(pConf *service.ParsedConfig) (conf kfoConfig, err error
 	if conf.Stream, err = pConf.FieldString(kfoFieldStream); err != nil {
 		return
 	}
+	if conf.DynamicPartitioning.Keys, err = pConf.FieldInterpolatedStringMap(kfoFieldDynamicPartitioning, kfodpFieldKeys); err != nil {
+		return
+	}
+	if conf.DynamicPartitioning.Field, err = pConf.FieldString(kfoFieldDynamicPartitioning, kfodpFieldField); err != nil {
+		return
+	}
+	if len(conf.DynamicPartitioning.Keys) > 0 && conf.DynamicPartitioning.Field == "" {
+		err = fmt.Errorf("field %v.%v must not be empty when partition keys are set", kfoFieldDynamicPartitioning, kfodpFieldField)
+		return
+	}
+	if conf.Aggregation.Enabled, err = pConf.FieldBool(kfoFieldAggregation, kfoaFieldEnabled); err != nil {
+		return
+	}
+	if conf.Aggregation.MaxRecords, err = pConf.FieldInt(kfoFieldAggregation, kfoaFieldMaxRecords); err != nil {
+		return
+	}
+	if conf.Aggregation.MaxSize, err = pConf.FieldInt(kfoFieldAggregation, kfoaFieldMaxSize); err != nil {
+		return
+	}
+	if conf.Aggregation.Enabled && (conf.Aggregation.MaxSize <= 0 || conf.Aggregation.MaxSize > firehoseMaxRecordSize) {
+		err = fmt.Errorf("field %v.%v must be greater than zero and no more than %v", kfoFieldAggregation, kfoaFieldMaxSize, firehoseMaxRecordSize)
+		return
+	}
+	if conf.Aggregation.Delimiter, err = pConf.FieldString(kfoFieldAggregation, kfoaFieldDelimiter); err != nil {
+		return
+	}
 	if conf.aconf, err = GetSession(context.TODO(), pConf); err != nil {
 		return
 	}
@@ -72,12 +128,52 @@ By default Redpanda Connect will use a shared credentials file when connecting t
 This output benefits from sending multiple messages in flight in parallel for improved performance. You can tune the max number of in flight messages (or message batches) with the field `+"`max_in_flight`"+`.
 
 This output benefits from sending messages as a batch for improved performance. Batches can be formed at both the input and output level. You can find out more xref:configuration:batching.adoc[in this doc].
+
+== Dynamic partitioning
+
+Delivery streams with https://docs.aws.amazon.com/firehose/latest/dev/dynamic-partitioning.html[dynamic partitioning^] enabled can extract partitioning keys from JSON records with inline parsing. The field `+"`dynamic_partitioning.keys`"+` sets partitioning keys from interpolated expressions, which are added to each message, which must be a JSON object, as an object at the field `+"`dynamic_partitioning.field`"+`. For example, with the default field a key `+"`customer_id`"+` can be extracted by the delivery stream with the JQ expression `+"`.partition_keys.customer_id`"+`.
+
+== Aggregation
+
+When `+"`aggregation.enabled`"+` is set to `+"`true`"+` the messages of a batch are joined with a delimiter into records of up to `+"`aggregation.max_size`"+` bytes, which reduces the number of records put to the delivery stream and therefore the cost of small messages, as Kinesis Firehose rounds the size of each record up to the nearest 5 KiB. When combined with dynamic partitioning the delivery stream must be configured with multi record deaggregation, using either the JSON or delimited type, in order to partition the individual messages of each record.
 `).
 		Fields(
 			service.NewStringField(kfoFieldStream).
 				Description("The stream to publish messages to."),
 			service.NewOutputMaxInFlightField(),
 			service.NewBatchPolicyField(kfoFieldBatching),
+			service.NewObjectField(kfoFieldDynamicPartitioning,
+				service.NewInterpolatedStringMapField(kfodpFieldKeys).
+					Description("A map of partitioning keys to interpolated values, which are added to each message.").
+					Example(map[string]any{
+						"customer_id": `${! json("customer.id") }`,
+						"year":        `${! timestamp_unix().ts_format("2006") }`,
+					}).
+					Default(map[string]any{}),
+				service.NewStringField(kfodpFieldField).
+					Description("The field of each message to add the partitioning keys to as an object.").
+					Default("partition_keys"),
+			).
+				Description("Add partitioning keys to messages for the dynamic partitioning of the delivery stream.").
+				Version("4.31.0").
+				Advanced(),
+			service.NewObjectField(kfoFieldAggregation,
+				service.NewBoolField(kfoaFieldEnabled).
+					Description("Whether to aggregate messages into delimited records.").
+					Default(false),
+				service.NewIntField(kfoaFieldMaxRecords).
+					Description("The maximum number of messages to aggregate into a single record, or 0 for no limit.").
+					Default(0),
+				service.NewIntField(kfoaFieldMaxSize).
+					Description("The maximum size in bytes of an aggregated record, which cannot exceed 1000 KiB.").
+					Default(firehoseMaxRecordSize),
+				service.NewStringField(kfoaFieldDelimiter).
+					Description("A delimiter added after each message of an aggregated record.").
+					Default("\n"),
+			).
+				Description("Aggregate messages into delimited records.").
+				Version("4.31.0").
+				Advanced(),
 		).
 		Fields(config.SessionFields()...).
 		Fields(retries.CommonRetryBackOffFields(0, "1s", "5s", "30s")...)
@@ -131,23 +227,91 @@ func newKinesisFirehoseWriter(conf kfoConfig, log *service.Logger) (*kinesisFire
 func (a *kinesisFirehoseWriter) toRecords(batch service.MessageBatch) ([]types.Record, error) {
 	entries := make([]types.Record, len(batch))
 
-	for i, p := range batch {
+	err := batch.WalkWithBatchedErrors(func(i int, p *service.Message) error {
 		var entry types.Record
 		var err error
-		if entry.Data, err = p.AsBytes(); err != nil {
-			return nil, err
+		if len(a.conf.DynamicPartitioning.Keys) > 0 {
+			if entry.Data, err = a.addPartitionKeys(batch, i); err != nil {
+				return err
+			}
+		} else if entry.Data, err = p.AsBytes(); err != nil {
+			return err
 		}
 
-		if len(entry.Data) > mebibyte {
-			err = fmt.Errorf("batch message %d exceeds the maximum Kinesis Firehose payload limit of 1 MiB", i)
+		// Aggregated messages are followed by the delimiter, which counts
+		// towards the size of the record they are written to.
+		size := len(entry.Data)
+		if a.conf.Aggregation.Enabled {
+			size += len(a.conf.Aggregation.Delimiter)
+		}
+		if size > firehoseMaxRecordSize {
+			err = fmt.Errorf("batch message %d exceeds the maximum Kinesis Firehose record size of %v bytes", i, firehoseMaxRecordSize)
 			a.log.With("error", err).Error("Failed to prepare record")
-			return nil, err
+			return err
 		}
 
 		entries[i] = entry
+		return nil
+	})
+	if err != nil || !a.conf.Aggregation.Enabled {
+		return entries, err
+	}
+	return aggregateFirehoseRecords(entries, a.conf.Aggregation), nil
+}
+
+// addPartitionKeys returns the contents of a message with the dynamic
+// partitioning keys added to it.
+func (a *kinesisFirehoseWriter) addPartitionKeys(batch service.MessageBatch, index int) ([]byte, error) {
+	keys := make(map[string]any, len(a.conf.DynamicPartitioning.Keys))
+	for k, v := range a.conf.DynamicPartitioning.Keys {
+		str, err := batch.TryInterpolatedString(index, v)
+		if err != nil {
+			return nil, fmt.Errorf("partition key %v interpolation error: %w", k, err)
+		}
+		keys[k] = str
 	}
 
-	return entries, nil
+	structured, err := batch[index].AsStructured()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message for dynamic partitioning: %w", err)
+	}
+	obj, ok := structured.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected message to be a JSON object for dynamic partitioning, got %T", structured)
+	}
+
+	// Copy the object so that the message itself is left unmodified.
+	withKeys := make(map[string]any, len(obj)+1)
+	for k, v := range obj {
+		withKeys[k] = v
+	}
+	withKeys[a.conf.DynamicPartitioning.Field] = keys
+	return json.Marshal(withKeys)
+}
+
+// aggregateFirehoseRecords joins records with a delimiter into records of up
+// to the configured size. A record that exceeds the configured size on its own
+// is not joined with others, and records are expected to be within
+// firehoseMaxRecordSize including the delimiter.
+func aggregateFirehoseRecords(records []types.Record, conf kfoAggregationConfig) []types.Record {
+	var aggregated []types.Record
+
+	var current []byte
+	var count int
+	for _, r := range records {
+		size := len(r.Data) + len(conf.Delimiter)
+		if count > 0 && (len(current)+size > conf.MaxSize || (conf.MaxRecords > 0 && count >= conf.MaxRecords)) {
+			aggregated = append(aggregated, types.Record{Data: current})
+			current, count = nil, 0
+		}
+		current = append(current, r.Data...)
+		current = append(current, conf.Delimiter...)
+		count++
+	}
+	if count > 0 {
+		aggregated = append(aggregated, types.Record{Data: current})
+	}
+	return aggregated
 }
 
 //------------------------------------------------------------------------------
@@ -15,6 +15,7 @@
 package aws
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -26,6 +27,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/firehose"
 	"github.com/aws/aws-sdk-go-v2/service/firehose/types"
 	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
@@ -296,3 +298,127 @@ func TestKinesisFirehoseWriteBackoffMaxRetriesExceeded(t *testing.T) {
 		t.Errorf("Expected kinesis firehose PutRecordBatch to have call count %d, got %d", exp, calls)
 	}
 }
+
+func testKFOFromConfig(t *testing.T, conf string, m *mockKinesisFirehose) *kinesisFirehoseWriter {
+	t.Helper()
+
+	pConf, err := kfoOutputSpec().ParseYAML(conf, nil)
+	require.NoError(t, err)
+
+	kConf, err := kfoConfigFromParsed(pConf)
+	require.NoError(t, err)
+
+	w, err := newKinesisFirehoseWriter(kConf, nil)
+	require.NoError(t, err)
+
+	w.firehose = m
+	return w
+}
+
+func TestKinesisFirehoseWriteDynamicPartitioning(t *testing.T) {
+	var records []types.Record
+	k := testKFOFromConfig(t, `
+stream: foo
+dynamic_partitioning:
+  keys:
+    customer_id: ${! json("customer.id") }
+    source: ${! meta("source") }
+`, &mockKinesisFirehose{
+		fn: func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			records = append(records, input.Records...)
+			return &firehose.PutRecordBatchOutput{}, nil
+		},
+	})
+
+	msg := service.NewMessage([]byte(`{"customer":{"id":"abc"}}`))
+	msg.MetaSetMut("source", "web")
+	require.NoError(t, k.WriteBatch(context.Background(), service.MessageBatch{msg}))
+
+	require.Len(t, records, 1)
+	assert.JSONEq(t, `{"customer":{"id":"abc"},"partition_keys":{"customer_id":"abc","source":"web"}}`, string(records[0].Data))
+
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, `{"customer":{"id":"abc"}}`, string(b))
+
+	err = k.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"customer":{"id":"abc"}}`)),
+		service.NewMessage([]byte(`["not","an","object"]`)),
+	})
+	var bErr *service.BatchError
+	require.ErrorAs(t, err, &bErr)
+	assert.Equal(t, 1, bErr.IndexedErrors())
+}
+
+func TestKinesisFirehoseWriteAggregated(t *testing.T) {
+	var records []types.Record
+	k := testKFOFromConfig(t, `
+stream: foo
+aggregation:
+  enabled: true
+  max_records: 3
+  max_size: 10
+`, &mockKinesisFirehose{
+		fn: func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			records = append(records, input.Records...)
+			return &firehose.PutRecordBatchOutput{}, nil
+		},
+	})
+
+	var batch service.MessageBatch
+	for _, content := range []string{"a", "b", "c", "d", "efghij", "klmnopqrstuv", "w"} {
+		batch = append(batch, service.NewMessage([]byte(content)))
+	}
+	require.NoError(t, k.WriteBatch(context.Background(), batch))
+
+	var data []string
+	for _, r := range records {
+		data = append(data, string(r.Data))
+	}
+	assert.Equal(t, []string{"a\nb\nc\n", "d\nefghij\n", "klmnopqrstuv\n", "w\n"}, data)
+}
+
+func TestKinesisFirehoseWriteMaxRecordSize(t *testing.T) {
+	var records []types.Record
+	mock := &mockKinesisFirehose{
+		fn: func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			records = append(records, input.Records...)
+			return &firehose.PutRecordBatchOutput{}, nil
+		},
+	}
+
+	// Messages at the limit are written as they are.
+	k := testKFO(t, mock)
+	require.NoError(t, k.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage(bytes.Repeat([]byte("a"), firehoseMaxRecordSize)),
+	}))
+	require.Len(t, records, 1)
+	assert.Len(t, records[0].Data, firehoseMaxRecordSize)
+
+	err := k.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage(bytes.Repeat([]byte("a"), firehoseMaxRecordSize+1)),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the maximum Kinesis Firehose record size")
+
+	// When aggregated the delimiter must also fit within the limit.
+	records = nil
+	k = testKFOFromConfig(t, `
+stream: foo
+aggregation:
+  enabled: true
+`, mock)
+	require.NoError(t, k.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage(bytes.Repeat([]byte("a"), firehoseMaxRecordSize-1)),
+		service.NewMessage([]byte("b")),
+	}))
+	require.Len(t, records, 2)
+	assert.Len(t, records[0].Data, firehoseMaxRecordSize)
+	assert.Equal(t, "b\n", string(records[1].Data))
+
+	err = k.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage(bytes.Repeat([]byte("a"), firehoseMaxRecordSize)),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the maximum Kinesis Firehose record size")
+}
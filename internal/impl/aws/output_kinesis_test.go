@@ -313,3 +313,77 @@ max_retries: 2
 		t.Errorf("Expected kinesis.PutRecords to have call count %d, got %d", exp, calls)
 	}
 }
+
+func TestKinesisWriteAggregated(t *testing.T) {
+	k := testKOWriter(t, `
+stream: foo
+partition_key: ${! json("key") }
+aggregation:
+  enabled: true
+  max_records: 2
+`)
+
+	var records []types.PutRecordsRequestEntry
+	k.kinesis = &mockKinesis{
+		fn: func(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+			records = append(records, input.Records...)
+			return &kinesis.PutRecordsOutput{}, nil
+		},
+	}
+
+	var batch service.MessageBatch
+	for _, key := range []string{"a", "b", "a", "a", "b"} {
+		batch = append(batch, service.NewMessage([]byte(fmt.Sprintf(`{"key":"%v"}`, key))))
+	}
+	require.NoError(t, k.WriteBatch(context.Background(), batch))
+
+	type result struct {
+		partKey string
+		count   int
+	}
+	var results []result
+	for _, r := range records {
+		require.True(t, isKPLAggregated(r.Data))
+		userRecords, err := kplDeaggregate(r.Data)
+		require.NoError(t, err)
+		for _, ur := range userRecords {
+			assert.Equal(t, *r.PartitionKey, ur.PartitionKey)
+		}
+		results = append(results, result{partKey: *r.PartitionKey, count: len(userRecords)})
+	}
+	assert.Equal(t, []result{
+		{partKey: "a", count: 2},
+		{partKey: "b", count: 2},
+		{partKey: "a", count: 1},
+	}, results)
+}
+
+func TestKinesisWriteAggregatedLargeMessage(t *testing.T) {
+	k := testKOWriter(t, `
+stream: foo
+partition_key: foo
+aggregation:
+  enabled: true
+  max_size: 100
+`)
+
+	var records []types.PutRecordsRequestEntry
+	k.kinesis = &mockKinesis{
+		fn: func(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+			records = append(records, input.Records...)
+			return &kinesis.PutRecordsOutput{}, nil
+		},
+	}
+
+	large := make([]byte, 200)
+	require.NoError(t, k.WriteBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("small")),
+		service.NewMessage(large),
+		service.NewMessage([]byte("small")),
+	}))
+
+	require.Len(t, records, 3)
+	assert.True(t, isKPLAggregated(records[0].Data))
+	assert.Equal(t, large, records[1].Data)
+	assert.True(t, isKPLAggregated(records[2].Data))
+}
@@ -17,7 +17,9 @@ package aws
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"sort"
 	"strings"
@@ -32,6 +34,7 @@ import (
 	"github.com/redpanda-data/benthos/v4/public/service"
 
 	"github.com/redpanda-data/connect/v4/internal/impl/aws/config"
+	"github.com/redpanda-data/connect/v4/internal/rolling"
 )
 
 const (
@@ -76,6 +79,7 @@ type s3oConfig struct {
 	KMSKeyID                string
 	ServerSideEncryption    string
 	UsePathStyle            bool
+	Rolling                 rolling.Config
 
 	aconf aws.Config
 }
@@ -139,6 +143,9 @@ func s3oConfigFromParsed(pConf *service.ParsedConfig) (conf s3oConfig, err error
 	if conf.ServerSideEncryption, err = pConf.FieldString(s3oFieldServerSideEncryption); err != nil {
 		return
 	}
+	if conf.Rolling, err = rolling.ConfigFromParsed(pConf); err != nil {
+		return
+	}
 	if conf.aconf, err = GetSession(context.TODO(), pConf); err != nil {
 		return
 	}
@@ -209,7 +216,26 @@ output:
       processors:
         - archive:
             format: json_array
-`+"```"+``+service.OutputPerformanceDocs(true, false)).
+`+"```"+`
+
+== Rolling files
+
+Batching holds each window of messages in memory and uploads an object per batch, which doesn't scale well to large objects. When `+"`rolling.enabled`"+` is set messages are instead streamed into rolling files as multipart uploads. A file is committed once it reaches the configured size, message count or age, and messages are only acknowledged once the file they were written to has been committed. The `+"`path`"+` and other object attributes are resolved from the first message of each file, and `+"`rolling.partition_by`"+` can be used in order to write messages into separate files:
+
+`+"```yaml"+`
+output:
+  aws_s3:
+    bucket: TODO
+    path: ${!meta("kafka_topic")}/${!timestamp_unix_nano()}.jsonl
+    max_in_flight: 256
+    rolling:
+      enabled: true
+      partition_by: ${!meta("kafka_topic")}
+      max_size: 134217728
+      max_period: 5m
+`+"```"+`
+
+Since the writes of messages are held until their file is committed all open files are committed whenever the number of pending writes reaches `+"`max_in_flight`"+`, which should therefore be increased in proportion to the expected number of batches written to each file. The `+"`timeout`"+` field does not apply to rolling files.`+service.OutputPerformanceDocs(true, false)).
 		Fields(
 			service.NewStringField(s3oFieldBucket).
 				Description("The bucket to upload messages to."),
@@ -276,6 +302,7 @@ output:
 				Advanced().
 				Default("5s"),
 			service.NewBatchPolicyField(s3oFieldBatching),
+			rolling.ConfigField().Version("4.31.0"),
 		).
 		Fields(config.SessionFields()...)
 }
@@ -293,7 +320,7 @@ func init() {
 			if wConf, err = s3oConfigFromParsed(conf); err != nil {
 				return
 			}
-			out, err = newAmazonS3Writer(wConf, mgr)
+			out, err = newAmazonS3Writer(wConf, maxInFlight, mgr)
 			return
 		})
 	if err != nil {
@@ -304,14 +331,18 @@ func init() {
 type amazonS3Writer struct {
 	conf     s3oConfig
 	uploader *manager.Uploader
+	rolling  *rolling.Writer
 	log      *service.Logger
 }
 
-func newAmazonS3Writer(conf s3oConfig, mgr *service.Resources) (*amazonS3Writer, error) {
+func newAmazonS3Writer(conf s3oConfig, maxInFlight int, mgr *service.Resources) (*amazonS3Writer, error) {
 	a := &amazonS3Writer{
 		conf: conf,
 		log:  mgr.Logger(),
 	}
+	if conf.Rolling.Enabled {
+		a.rolling = rolling.NewWriter(conf.Rolling, maxInFlight, a.openRollingObject, a.log)
+	}
 	return a, nil
 }
 
@@ -332,119 +363,201 @@ func (a *amazonS3Writer) WriteBatch(wctx context.Context, msg service.MessageBat
 		return service.ErrNotConnected
 	}
 
+	if a.rolling != nil {
+		return a.rolling.WriteBatch(wctx, msg)
+	}
+
 	ctx, cancel := context.WithTimeout(wctx, a.conf.Timeout)
 	defer cancel()
 
 	return msg.WalkWithBatchedErrors(func(i int, m *service.Message) error {
-		metadata := map[string]string{}
-		_ = a.conf.Metadata.WalkMut(m, func(k string, v any) error {
-			metadata[k] = bloblang.ValueToString(v)
-			return nil
-		})
-
-		var contentEncoding *string
-		ce, err := msg.TryInterpolatedString(i, a.conf.ContentEncoding)
+		uploadInput, err := a.uploadInput(msg, i)
 		if err != nil {
-			return fmt.Errorf("content encoding interpolation: %w", err)
-		}
-		if ce != "" {
-			contentEncoding = aws.String(ce)
-		}
-		var cacheControl *string
-		if ce, err = msg.TryInterpolatedString(i, a.conf.CacheControl); err != nil {
-			return fmt.Errorf("cache control interpolation: %w", err)
-		}
-		if ce != "" {
-			cacheControl = aws.String(ce)
-		}
-		var contentDisposition *string
-		if ce, err = msg.TryInterpolatedString(i, a.conf.ContentDisposition); err != nil {
-			return fmt.Errorf("content disposition interpolation: %w", err)
-		}
-		if ce != "" {
-			contentDisposition = aws.String(ce)
-		}
-		var contentLanguage *string
-		if ce, err = msg.TryInterpolatedString(i, a.conf.ContentLanguage); err != nil {
-			return fmt.Errorf("content language interpolation: %w", err)
-		}
-		if ce != "" {
-			contentLanguage = aws.String(ce)
-		}
-		var websiteRedirectLocation *string
-		if ce, err = msg.TryInterpolatedString(i, a.conf.WebsiteRedirectLocation); err != nil {
-			return fmt.Errorf("website redirect location interpolation: %w", err)
-		}
-		if ce != "" {
-			websiteRedirectLocation = aws.String(ce)
+			return err
 		}
 
-		key, err := msg.TryInterpolatedString(i, a.conf.Path)
+		mBytes, err := m.AsBytes()
 		if err != nil {
-			return fmt.Errorf("key interpolation: %w", err)
+			return err
 		}
+		uploadInput.Body = bytes.NewReader(mBytes)
 
-		contentType, err := msg.TryInterpolatedString(i, a.conf.ContentType)
-		if err != nil {
-			return fmt.Errorf("content type interpolation: %w", err)
+		if _, err := a.uploader.Upload(ctx, uploadInput); err != nil {
+			return err
 		}
+		return nil
+	})
+}
 
-		storageClass, err := msg.TryInterpolatedString(i, a.conf.StorageClass)
-		if err != nil {
-			return fmt.Errorf("storage class interpolation: %w", err)
-		}
+// uploadInput resolves the attributes of the object of a message.
+func (a *amazonS3Writer) uploadInput(msg service.MessageBatch, i int) (*s3.PutObjectInput, error) {
+	metadata := map[string]string{}
+	_ = a.conf.Metadata.WalkMut(msg[i], func(k string, v any) error {
+		metadata[k] = bloblang.ValueToString(v)
+		return nil
+	})
 
-		mBytes, err := m.AsBytes()
-		if err != nil {
-			return err
-		}
+	var contentEncoding *string
+	ce, err := msg.TryInterpolatedString(i, a.conf.ContentEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("content encoding interpolation: %w", err)
+	}
+	if ce != "" {
+		contentEncoding = aws.String(ce)
+	}
+	var cacheControl *string
+	if ce, err = msg.TryInterpolatedString(i, a.conf.CacheControl); err != nil {
+		return nil, fmt.Errorf("cache control interpolation: %w", err)
+	}
+	if ce != "" {
+		cacheControl = aws.String(ce)
+	}
+	var contentDisposition *string
+	if ce, err = msg.TryInterpolatedString(i, a.conf.ContentDisposition); err != nil {
+		return nil, fmt.Errorf("content disposition interpolation: %w", err)
+	}
+	if ce != "" {
+		contentDisposition = aws.String(ce)
+	}
+	var contentLanguage *string
+	if ce, err = msg.TryInterpolatedString(i, a.conf.ContentLanguage); err != nil {
+		return nil, fmt.Errorf("content language interpolation: %w", err)
+	}
+	if ce != "" {
+		contentLanguage = aws.String(ce)
+	}
+	var websiteRedirectLocation *string
+	if ce, err = msg.TryInterpolatedString(i, a.conf.WebsiteRedirectLocation); err != nil {
+		return nil, fmt.Errorf("website redirect location interpolation: %w", err)
+	}
+	if ce != "" {
+		websiteRedirectLocation = aws.String(ce)
+	}
 
-		uploadInput := &s3.PutObjectInput{
-			Bucket:                  &a.conf.Bucket,
-			Key:                     aws.String(key),
-			Body:                    bytes.NewReader(mBytes),
-			ContentType:             aws.String(contentType),
-			ContentEncoding:         contentEncoding,
-			CacheControl:            cacheControl,
-			ContentDisposition:      contentDisposition,
-			ContentLanguage:         contentLanguage,
-			WebsiteRedirectLocation: websiteRedirectLocation,
-			StorageClass:            types.StorageClass(storageClass),
-			Metadata:                metadata,
-		}
+	key, err := msg.TryInterpolatedString(i, a.conf.Path)
+	if err != nil {
+		return nil, fmt.Errorf("key interpolation: %w", err)
+	}
+
+	contentType, err := msg.TryInterpolatedString(i, a.conf.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("content type interpolation: %w", err)
+	}
+
+	storageClass, err := msg.TryInterpolatedString(i, a.conf.StorageClass)
+	if err != nil {
+		return nil, fmt.Errorf("storage class interpolation: %w", err)
+	}
 
-		// Prepare tags, escaping keys and values to ensure they're valid query string parameters.
-		if len(a.conf.Tags) > 0 {
-			tags := make([]string, len(a.conf.Tags))
-			for j, pair := range a.conf.Tags {
-				tagStr, err := msg.TryInterpolatedString(i, pair.value)
-				if err != nil {
-					return fmt.Errorf("tag %v interpolation: %w", pair.key, err)
-				}
-				tags[j] = url.QueryEscape(pair.key) + "=" + url.QueryEscape(tagStr)
+	uploadInput := &s3.PutObjectInput{
+		Bucket:                  &a.conf.Bucket,
+		Key:                     aws.String(key),
+		ContentType:             aws.String(contentType),
+		ContentEncoding:         contentEncoding,
+		CacheControl:            cacheControl,
+		ContentDisposition:      contentDisposition,
+		ContentLanguage:         contentLanguage,
+		WebsiteRedirectLocation: websiteRedirectLocation,
+		StorageClass:            types.StorageClass(storageClass),
+		Metadata:                metadata,
+	}
+
+	// Prepare tags, escaping keys and values to ensure they're valid query string parameters.
+	if len(a.conf.Tags) > 0 {
+		tags := make([]string, len(a.conf.Tags))
+		for j, pair := range a.conf.Tags {
+			tagStr, err := msg.TryInterpolatedString(i, pair.value)
+			if err != nil {
+				return nil, fmt.Errorf("tag %v interpolation: %w", pair.key, err)
 			}
-			uploadInput.Tagging = aws.String(strings.Join(tags, "&"))
+			tags[j] = url.QueryEscape(pair.key) + "=" + url.QueryEscape(tagStr)
 		}
+		uploadInput.Tagging = aws.String(strings.Join(tags, "&"))
+	}
 
-		if a.conf.KMSKeyID != "" {
-			uploadInput.ServerSideEncryption = types.ServerSideEncryptionAwsKms
-			uploadInput.SSEKMSKeyId = &a.conf.KMSKeyID
-		}
+	if a.conf.KMSKeyID != "" {
+		uploadInput.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		uploadInput.SSEKMSKeyId = &a.conf.KMSKeyID
+	}
 
-		// NOTE: This overrides the ServerSideEncryption set above. We need this to preserve
-		// backwards compatibility, where it is allowed to only set kms_key_id in the config and
-		// the ServerSideEncryption value of "aws:kms" is implied.
-		if a.conf.ServerSideEncryption != "" {
-			uploadInput.ServerSideEncryption = types.ServerSideEncryption(a.conf.ServerSideEncryption)
-		}
+	// NOTE: This overrides the ServerSideEncryption set above. We need this to preserve
+	// backwards compatibility, where it is allowed to only set kms_key_id in the config and
+	// the ServerSideEncryption value of "aws:kms" is implied.
+	if a.conf.ServerSideEncryption != "" {
+		uploadInput.ServerSideEncryption = types.ServerSideEncryption(a.conf.ServerSideEncryption)
+	}
 
-		if _, err := a.uploader.Upload(ctx, uploadInput); err != nil {
-			return err
-		}
-		return nil
-	})
+	return uploadInput, nil
 }
 
-func (a *amazonS3Writer) Close(context.Context) error {
+// openRollingObject starts a multipart upload of a rolling file, where the
+// contents of the file are streamed to the uploader through a pipe.
+func (a *amazonS3Writer) openRollingObject(ctx context.Context, msg service.MessageBatch, i int) (rolling.ObjectWriter, error) {
+	uploadInput, err := a.uploadInput(msg, i)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	uploadInput.Body = pr
+
+	o := &s3RollingObject{
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+	go func() {
+		_, o.err = a.uploader.Upload(ctx, uploadInput)
+		_ = pr.CloseWithError(o.err)
+		close(o.done)
+	}()
+	return o, nil
+}
+
+func (a *amazonS3Writer) Close(ctx context.Context) error {
+	if a.rolling != nil {
+		return a.rolling.Close(ctx)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+var errS3RollingObjectAborted = errors.New("object aborted")
+
+// s3RollingObject is a rolling file that is uploaded in parts as it is being
+// written. The uploader aborts the multipart upload when the pipe is closed
+// with an error, so an aborted object never becomes visible.
+type s3RollingObject struct {
+	pw *io.PipeWriter
+
+	// Closed once the upload has completed, at which point err holds the
+	// outcome.
+	done chan struct{}
+	err  error
+}
+
+func (o *s3RollingObject) Write(p []byte) (int, error) {
+	return o.pw.Write(p)
+}
+
+func (o *s3RollingObject) wait(ctx context.Context) error {
+	select {
+	case <-o.done:
+		return o.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (o *s3RollingObject) Commit(ctx context.Context) error {
+	_ = o.pw.Close()
+	return o.wait(ctx)
+}
+
+func (o *s3RollingObject) Abort(ctx context.Context) error {
+	_ = o.pw.CloseWithError(errS3RollingObjectAborted)
+	if err := o.wait(ctx); err != nil && !errors.Is(err, errS3RollingObjectAborted) {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,162 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/aws/config"
+	"github.com/redpanda-data/connect/v4/internal/secrets"
+)
+
+const (
+	// SecretsConfigEnv is the environment variable that optionally holds the
+	// YAML config of the AWS session used for resolving secrets.
+	SecretsConfigEnv = "CONNECT_AWS_SECRETS"
+
+	// Secret Reference Providers
+	secretProviderSecretsManager = "aws_sm"
+	secretProviderSSM            = "ssm"
+)
+
+func init() {
+	// The session is only created once a secret is referenced.
+	getProvider := sync.OnceValues(func() (*SecretsProvider, error) {
+		return NewSecretsProvider(context.Background(), os.Getenv(SecretsConfigEnv))
+	})
+	for _, name := range []string{secretProviderSecretsManager, secretProviderSSM} {
+		name := name
+		secrets.RegisterProvider(name, func(ctx context.Context, ref string) (string, error) {
+			p, err := getProvider()
+			if err != nil {
+				return "", err
+			}
+			return p.Resolve(ctx, name+":"+ref)
+		})
+	}
+}
+
+func secretsProviderSpec() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Fields(config.SessionFields()...)
+}
+
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+type ssmAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// SecretsProvider resolves references to secrets stored within AWS Secrets
+// Manager and SSM Parameter Store.
+type SecretsProvider struct {
+	sm  secretsManagerAPI
+	ssm ssmAPI
+}
+
+// NewSecretsProvider creates a secrets provider from a YAML config of AWS
+// session fields, where an empty config results in the default AWS session.
+func NewSecretsProvider(ctx context.Context, confYAML string) (*SecretsProvider, error) {
+	pConf, err := secretsProviderSpec().ParseYAML(confYAML, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secrets provider config: %w", err)
+	}
+
+	aconf, err := GetSession(ctx, pConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretsProvider{
+		sm:  secretsmanager.NewFromConfig(aconf),
+		ssm: ssm.NewFromConfig(aconf),
+	}, nil
+}
+
+// Resolve returns the value of a secret reference, which is either of the form
+// aws_sm:<name>, where an optional #<field> suffix extracts a field of a JSON
+// secret, or of the form ssm:<parameter name>.
+func (s *SecretsProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	provider, target, ok := strings.Cut(ref, ":")
+	if !ok || target == "" {
+		return "", fmt.Errorf("secret reference %v must be of the form <provider>:<name>", ref)
+	}
+
+	switch provider {
+	case secretProviderSecretsManager:
+		name, field, hasField := strings.Cut(target, "#")
+		out, err := s.sm.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(name),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get secret %v: %w", name, err)
+		}
+
+		value := aws.ToString(out.SecretString)
+		if out.SecretString == nil {
+			value = string(out.SecretBinary)
+		}
+		if !hasField {
+			return value, nil
+		}
+		return secretField(name, value, field)
+	case secretProviderSSM:
+		out, err := s.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(target),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get parameter %v: %w", target, err)
+		}
+		if out.Parameter == nil {
+			return "", fmt.Errorf("parameter %v has no value", target)
+		}
+		return aws.ToString(out.Parameter.Value), nil
+	}
+	return "", fmt.Errorf("secret reference %v has an unknown provider %v, expected %v or %v", ref, provider, secretProviderSecretsManager, secretProviderSSM)
+}
+
+func secretField(name, value, field string) (string, error) {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(value), &obj); err != nil {
+		return "", fmt.Errorf("failed to parse secret %v as a JSON object: %w", name, err)
+	}
+
+	v, exists := obj[field]
+	if !exists {
+		return "", fmt.Errorf("field %v was not found in secret %v", field, name)
+	}
+	if str, ok := v.(string); ok {
+		return str, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
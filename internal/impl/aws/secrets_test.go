@@ -0,0 +1,96 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSecretsManager struct {
+	secrets map[string]string
+	calls   int
+}
+
+func (m *mockSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.calls++
+	v, exists := m.secrets[*params.SecretId]
+	if !exists {
+		return nil, errors.New("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(v)}, nil
+}
+
+type mockSSM struct {
+	params map[string]string
+}
+
+func (m *mockSSM) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	v, exists := m.params[*params.Name]
+	if !exists {
+		return nil, errors.New("parameter not found")
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Value: aws.String(v)}}, nil
+}
+
+func testSecretsProvider() (*SecretsProvider, *mockSecretsManager, *mockSSM) {
+	sm := &mockSecretsManager{secrets: map[string]string{
+		"plain": "hello world",
+		"json":  `{"user":"foo","password":"bar","port":5432}`,
+		"key":   "line one\nline two",
+	}}
+	params := &mockSSM{params: map[string]string{
+		"/prod/db/password": "baz",
+	}}
+	return &SecretsProvider{
+		sm:  sm,
+		ssm: params,
+	}, sm, params
+}
+
+func TestSecretsResolve(t *testing.T) {
+	p, _, _ := testSecretsProvider()
+
+	for ref, exp := range map[string]string{
+		"aws_sm:plain":          "hello world",
+		"aws_sm:json#password":  "bar",
+		"aws_sm:json#port":      "5432",
+		"ssm:/prod/db/password": "baz",
+	} {
+		v, err := p.Resolve(context.Background(), ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, exp, v, ref)
+	}
+
+	for _, ref := range []string{
+		"aws_sm:nope",
+		"aws_sm:plain#password",
+		"aws_sm:json#nope",
+		"ssm:/nope",
+		"vault:foo",
+		"aws_sm",
+	} {
+		_, err := p.Resolve(context.Background(), ref)
+		assert.Error(t, err, ref)
+	}
+}
@@ -116,6 +116,37 @@ input:
 		)
 	})
 
+	t.Run("blob_storage_rolling", func(t *testing.T) {
+		template := `
+output:
+  azure_blob_storage:
+    container: $VAR1-$ID
+    max_in_flight: 16
+    path: $VAR2/${!count("$ID")}.txt
+    storage_connection_string: $VAR3
+    rolling:
+      enabled: true
+      max_count: 5
+      max_period: 500ms
+
+input:
+  azure_blob_storage:
+    container: $VAR1-$ID
+    prefix: $VAR2
+    storage_connection_string: $VAR3
+    scanner: { lines: {} }
+`
+		integration.StreamTests(
+			integration.StreamTestOpenCloseIsolated(),
+			integration.StreamTestStreamIsolated(10),
+		).Run(
+			t, template,
+			integration.StreamTestOptVarSet("VAR1", dummyContainer),
+			integration.StreamTestOptVarSet("VAR2", dummyPrefix),
+			integration.StreamTestOptVarSet("VAR3", connString),
+		)
+	})
+
 	t.Run("blob_storage_streamed", func(t *testing.T) {
 		template := `
 output:
@@ -17,6 +17,7 @@ package azure
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 
@@ -24,8 +25,12 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/gofrs/uuid"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/rolling"
 )
 
 const (
@@ -42,6 +47,7 @@ type bsoConfig struct {
 	Path              *service.InterpolatedString
 	BlobType          *service.InterpolatedString
 	PublicAccessLevel *service.InterpolatedString
+	Rolling           rolling.Config
 }
 
 func bsoConfigFromParsed(pConf *service.ParsedConfig) (conf bsoConfig, err error) {
@@ -69,6 +75,9 @@ func bsoConfigFromParsed(pConf *service.ParsedConfig) (conf bsoConfig, err error
 	if conf.PublicAccessLevel, err = pConf.FieldInterpolatedString(bsoFieldPublicAccessLevel); err != nil {
 		return
 	}
+	if conf.Rolling, err = rolling.ConfigFromParsed(pConf); err != nil {
+		return
+	}
 	return
 }
 
@@ -92,7 +101,13 @@ Supports multiple authentication methods but only one of the following is requir
 If multiple are set then the `+"`storage_connection_string`"+` is given priority.
 
 If the `+"`storage_connection_string`"+` does not contain the `+"`AccountName`"+` parameter, please specify it in the
-`+"`storage_account`"+` field.`+service.OutputPerformanceDocs(true, false)).
+`+"`storage_account`"+` field.
+
+== Rolling files
+
+When `+"`rolling.enabled`"+` is set messages are streamed into rolling block blobs rather than uploading a blob per message. Blocks are staged as a file is written and a file is committed once it reaches the configured size, message count or age, and messages are only acknowledged once the file they were written to has been committed. The `+"`path`"+` and other blob attributes are resolved from the first message of each file, and `+"`rolling.partition_by`"+` can be used in order to write messages into separate files.
+
+Since the writes of messages are held until their file is committed all open files are committed whenever the number of pending writes reaches `+"`max_in_flight`"+`, which should therefore be increased in proportion to the expected number of messages written to each file. Append blobs are not supported with rolling files.`+service.OutputPerformanceDocs(true, false)).
 		Fields(
 			service.NewInterpolatedStringField(bsoFieldContainer).
 				Description("The container for uploading the messages to.").
@@ -112,6 +127,7 @@ If the `+"`storage_connection_string`"+` does not contain the `+"`AccountName`"+
 				Advanced().
 				Default("PRIVATE"),
 			service.NewOutputMaxInFlightField(),
+			rolling.ConfigField().Version("4.31.0"),
 		)
 }
 
@@ -125,7 +141,7 @@ func init() {
 			if mif, err = conf.FieldMaxInFlight(); err != nil {
 				return
 			}
-			if out, err = newAzureBlobStorageWriter(pConf, mgr.Logger()); err != nil {
+			if out, err = newAzureBlobStorageWriter(pConf, mif, mgr.Logger()); err != nil {
 				return
 			}
 			return
@@ -136,15 +152,19 @@ func init() {
 }
 
 type azureBlobStorageWriter struct {
-	conf bsoConfig
-	log  *service.Logger
+	conf    bsoConfig
+	rolling *rolling.Writer
+	log     *service.Logger
 }
 
-func newAzureBlobStorageWriter(conf bsoConfig, log *service.Logger) (*azureBlobStorageWriter, error) {
+func newAzureBlobStorageWriter(conf bsoConfig, maxInFlight int, log *service.Logger) (*azureBlobStorageWriter, error) {
 	a := &azureBlobStorageWriter{
 		conf: conf,
 		log:  log,
 	}
+	if conf.Rolling.Enabled {
+		a.rolling = rolling.NewWriter(conf.Rolling, maxInFlight, a.openRollingBlob, log)
+	}
 	return a, nil
 }
 
@@ -198,6 +218,10 @@ func (a *azureBlobStorageWriter) createContainer(ctx context.Context, containerN
 }
 
 func (a *azureBlobStorageWriter) Write(ctx context.Context, msg *service.Message) error {
+	if a.rolling != nil {
+		return a.rolling.WriteBatch(ctx, service.MessageBatch{msg})
+	}
+
 	containerName, err := a.conf.Container.TryString(msg)
 	if err != nil {
 		return fmt.Errorf("container interpolation error: %s", err)
@@ -241,7 +265,121 @@ func (a *azureBlobStorageWriter) Write(ctx context.Context, msg *service.Message
 	return nil
 }
 
-func (a *azureBlobStorageWriter) Close(context.Context) error {
+func (a *azureBlobStorageWriter) Close(ctx context.Context) error {
+	if a.rolling != nil {
+		return a.rolling.Close(ctx)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// The size of the blocks staged for a rolling blob.
+const bsoRollingBlockSize = 4 * 1024 * 1024
+
+func (a *azureBlobStorageWriter) openRollingBlob(ctx context.Context, batch service.MessageBatch, i int) (rolling.ObjectWriter, error) {
+	msg := batch[i]
+
+	containerName, err := a.conf.Container.TryString(msg)
+	if err != nil {
+		return nil, fmt.Errorf("container interpolation error: %s", err)
+	}
+
+	blobName, err := a.conf.Path.TryString(msg)
+	if err != nil {
+		return nil, fmt.Errorf("path interpolation error: %s", err)
+	}
+
+	blobType, err := a.conf.BlobType.TryString(msg)
+	if err != nil {
+		return nil, fmt.Errorf("blob type interpolation error: %s", err)
+	}
+	if blobType == "APPEND" {
+		return nil, errors.New("append blobs are not supported with rolling files")
+	}
+
+	accessLevel, err := a.conf.PublicAccessLevel.TryString(msg)
+	if err != nil {
+		return nil, fmt.Errorf("access level interpolation error: %s", err)
+	}
+
+	// Block IDs are only unique within a blob, and so a random prefix prevents
+	// collisions with the uncommitted blocks of other writers of the same
+	// path.
+	prefix, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	return &azureRollingBlob{
+		a:             a,
+		ctx:           ctx,
+		containerName: containerName,
+		accessLevel:   accessLevel,
+		client:        a.conf.client.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(blobName),
+		prefix:        prefix.String(),
+	}, nil
+}
+
+// azureRollingBlob is a rolling file that stages blocks of a block blob as it
+// is being written. Staged blocks only become visible once the block list is
+// committed, and uncommitted blocks are garbage collected by the service, so
+// there is nothing to clean up when a blob is aborted.
+type azureRollingBlob struct {
+	a             *azureBlobStorageWriter
+	ctx           context.Context
+	containerName string
+	accessLevel   string
+
+	client   *blockblob.Client
+	prefix   string
+	blockIDs []string
+	buf      bytes.Buffer
+}
+
+func (b *azureRollingBlob) stageBlock(ctx context.Context) error {
+	blockID := base64.StdEncoding.EncodeToString(fmt.Appendf(nil, "%s-%06d", b.prefix, len(b.blockIDs)))
+
+	_, err := b.client.StageBlock(ctx, blockID, streaming.NopCloser(bytes.NewReader(b.buf.Bytes())), nil)
+	if err != nil && isErrorCode(err, bloberror.ContainerNotFound) {
+		if err = b.a.createContainer(ctx, b.containerName, b.accessLevel); err != nil && !isErrorCode(err, bloberror.ContainerAlreadyExists) {
+			return fmt.Errorf("failed to create container: %s", err)
+		}
+		_, err = b.client.StageBlock(ctx, blockID, streaming.NopCloser(bytes.NewReader(b.buf.Bytes())), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stage block: %w", err)
+	}
+
+	b.blockIDs = append(b.blockIDs, blockID)
+	b.buf.Reset()
+	return nil
+}
+
+func (b *azureRollingBlob) Write(p []byte) (int, error) {
+	_, _ = b.buf.Write(p)
+	if b.buf.Len() >= bsoRollingBlockSize {
+		if err := b.stageBlock(b.ctx); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (b *azureRollingBlob) Commit(ctx context.Context) error {
+	if b.buf.Len() > 0 || len(b.blockIDs) == 0 {
+		if err := b.stageBlock(ctx); err != nil {
+			return err
+		}
+	}
+	if _, err := b.client.CommitBlockList(ctx, b.blockIDs, nil); err != nil {
+		return fmt.Errorf("failed to commit block list: %w", err)
+	}
+	return nil
+}
+
+func (b *azureRollingBlob) Abort(context.Context) error {
+	b.buf.Reset()
 	return nil
 }
 
@@ -0,0 +1,305 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+const encryptionCategory = "Encoding and Encryption"
+
+var hashFuncs = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+func getHashFunc(name string) (func() hash.Hash, error) {
+	fn, exists := hashFuncs[name]
+	if !exists {
+		return nil, fmt.Errorf("unsupported hash algorithm: %v", name)
+	}
+	return fn, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// aeadSeal encrypts plaintext with a random nonce, which is prepended to the
+// result.
+func aeadSeal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// aeadOpen decrypts a ciphertext produced by aeadSeal.
+func aeadOpen(aead cipher.AEAD, ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+type aeadMethodSpec struct {
+	name       string
+	cipherName string
+	keyDesc    string
+	newAEAD    func(key []byte) (cipher.AEAD, error)
+
+	// sampleCiphertext is the base64 encoded result of encrypting the sample
+	// input with the sample key.
+	sampleCiphertext string
+}
+
+const sampleAEADKey = "0123456789abcdef0123456789abcdef"
+
+func aeadParams(spec *bloblang.PluginSpec, keyDesc string) *bloblang.PluginSpec {
+	return spec.
+		Param(bloblang.NewStringParam("key").Description(keyDesc + " The key can also be provided as a JWK or JWKS document containing a symmetric (`oct`) key.")).
+		Param(bloblang.NewStringParam("aad").Description("Additional authenticated data, which is not encrypted but must be identical when decrypting.").Default("")).
+		Param(bloblang.NewStringParam("kid").Description("The ID of the key to use when the key is a JWKS document containing multiple keys.").Default(""))
+}
+
+func aeadCtor(newAEAD func(key []byte) (cipher.AEAD, error), fn func(aead cipher.AEAD, data, aad []byte) ([]byte, error)) bloblang.MethodConstructorV2 {
+	return func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		keyStr, err := args.GetString("key")
+		if err != nil {
+			return nil, err
+		}
+		aad, err := args.GetString("aad")
+		if err != nil {
+			return nil, err
+		}
+		kid, err := args.GetString("kid")
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := symmetricKey(keyStr, kid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return bloblang.BytesMethod(func(data []byte) (any, error) {
+			return fn(aead, data, []byte(aad))
+		}), nil
+	}
+}
+
+func registerAEADMethods(m aeadMethodSpec) error {
+	encryptSpec := aeadParams(bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description(fmt.Sprintf("Encrypts a string or byte array using %v with a random nonce, which is prepended to the resulting byte array. This method is suitable for encrypting individual fields of a document before it is shared with other systems.", m.cipherName)).
+		Version("4.31.0").
+		ExampleNotTested("", fmt.Sprintf(`root.ssn = this.ssn.%v(key: file("./data_key.bin")).encode("base64")`, m.name), [2]string{
+			`{"ssn":"123-45-6789"}`,
+			fmt.Sprintf(`{"ssn":%q}`, m.sampleCiphertext),
+		}), m.keyDesc)
+	if err := bloblang.RegisterMethodV2(m.name, encryptSpec, aeadCtor(m.newAEAD, aeadSeal)); err != nil {
+		return err
+	}
+
+	decryptName := "de" + m.name[2:]
+	decryptSpec := aeadParams(bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description(fmt.Sprintf("Decrypts a byte array produced by the `%v` method, where the nonce is prepended to the ciphertext. Decryption fails if the ciphertext, key or additional authenticated data do not match.", m.name)).
+		Version("4.31.0").
+		Example("", fmt.Sprintf(`root.ssn = this.ssn.decode("base64").%v(key: %q).string()`, decryptName, sampleAEADKey), [2]string{
+			fmt.Sprintf(`{"ssn":%q}`, m.sampleCiphertext),
+			`{"ssn":"123-45-6789"}`,
+		}), m.keyDesc)
+	return bloblang.RegisterMethodV2(decryptName, decryptSpec, aeadCtor(m.newAEAD, aeadOpen))
+}
+
+func rsaOAEPParams(spec *bloblang.PluginSpec) *bloblang.PluginSpec {
+	return spec.
+		Param(bloblang.NewStringParam("key").Description("The RSA key to use. " + keyDocsDescription)).
+		Param(bloblang.NewStringParam("hash").Description("The hash function used by OAEP, one of `sha1`, `sha256`, `sha384` or `sha512`.").Default("sha256")).
+		Param(bloblang.NewStringParam("label").Description("An optional label, which must be identical when decrypting.").Default("")).
+		Param(bloblang.NewStringParam("kid").Description("The ID of the key to use when the key is a JWKS document containing multiple keys.").Default(""))
+}
+
+func rsaOAEPCtor[T any](convert func(any) (T, bool), fn func(hash.Hash, T, []byte, []byte) ([]byte, error)) bloblang.MethodConstructorV2 {
+	return func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		keyStr, err := args.GetString("key")
+		if err != nil {
+			return nil, err
+		}
+		hashStr, err := args.GetString("hash")
+		if err != nil {
+			return nil, err
+		}
+		label, err := args.GetString("label")
+		if err != nil {
+			return nil, err
+		}
+		kid, err := args.GetString("kid")
+		if err != nil {
+			return nil, err
+		}
+
+		hashFn, err := getHashFunc(hashStr)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := parseKeys([]byte(keyStr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+		_, key, err := selectKey(keys, kid, convert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+
+		return bloblang.BytesMethod(func(data []byte) (any, error) {
+			return fn(hashFn(), key, data, []byte(label))
+		}), nil
+	}
+}
+
+func registerRSAOAEPMethods() error {
+	encryptSpec := rsaOAEPParams(bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description("Encrypts a string or byte array with an RSA public key using RSA-OAEP. The length of the data is limited by the size of the key, and therefore this method is typically used for encrypting data keys rather than documents.").
+		Version("4.31.0").
+		ExampleNotTested("", `root.data_key = this.data_key.encrypt_rsa_oaep(key: file("./public.pem")).encode("base64")`, [2]string{
+			`{"data_key":"9ad7f3d5a2cc4c22"}`,
+			`{"data_key":"Pq2Ibb0Nd6s1...dAcxGg=="}`,
+		}))
+	if err := bloblang.RegisterMethodV2("encrypt_rsa_oaep", encryptSpec, rsaOAEPCtor(asRSAPublicKey,
+		func(h hash.Hash, key *rsa.PublicKey, data, label []byte) ([]byte, error) {
+			return rsa.EncryptOAEP(h, rand.Reader, key, data, label)
+		},
+	)); err != nil {
+		return err
+	}
+
+	decryptSpec := rsaOAEPParams(bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description("Decrypts a byte array with an RSA private key using RSA-OAEP.").
+		Version("4.31.0").
+		ExampleNotTested("", `root.data_key = this.data_key.decode("base64").decrypt_rsa_oaep(key: file("./private.pem")).string()`, [2]string{
+			`{"data_key":"Pq2Ibb0Nd6s1...dAcxGg=="}`,
+			`{"data_key":"9ad7f3d5a2cc4c22"}`,
+		}))
+	return bloblang.RegisterMethodV2("decrypt_rsa_oaep", decryptSpec, rsaOAEPCtor(asRSAPrivateKey,
+		func(h hash.Hash, key *rsa.PrivateKey, data, label []byte) ([]byte, error) {
+			return rsa.DecryptOAEP(h, nil, key, data, label)
+		},
+	))
+}
+
+func registerHMACCompareMethod() error {
+	spec := bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description("Checks whether a signature is a valid HMAC of a string or byte array, comparing them in constant time. This is useful for verifying the signatures of webhook payloads.").
+		Version("4.31.0").
+		Param(bloblang.NewStringParam("algorithm").Description("The hash function used for the HMAC, one of `sha1`, `sha256`, `sha384` or `sha512`.")).
+		Param(bloblang.NewStringParam("key").Description("The secret key used for the HMAC.")).
+		Param(bloblang.NewStringParam("signature").Description("The raw signature to check, which often needs decoding from hex or base64 first.")).
+		Example("", `root.valid = this.payload.compare_hmac(algorithm: "sha256", key: "static-key", signature: this.signature.decode("hex"))`, [2]string{
+			`{"payload":"hello world","signature":"b1cdce8b2add1f96135b2506f8ab748ae8ef15c49c0320357a6d168c42e20746"}`,
+			`{"valid":true}`,
+		}, [2]string{
+			`{"payload":"hello world","signature":"0000ce8b2add1f96135b2506f8ab748ae8ef15c49c0320357a6d168c42e20746"}`,
+			`{"valid":false}`,
+		})
+
+	return bloblang.RegisterMethodV2("compare_hmac", spec, func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		algorithm, err := args.GetString("algorithm")
+		if err != nil {
+			return nil, err
+		}
+		key, err := args.GetString("key")
+		if err != nil {
+			return nil, err
+		}
+		signature, err := args.GetString("signature")
+		if err != nil {
+			return nil, err
+		}
+
+		hashFn, err := getHashFunc(algorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		return bloblang.BytesMethod(func(data []byte) (any, error) {
+			h := hmac.New(hashFn, []byte(key))
+			_, _ = h.Write(data)
+			return hmac.Equal(h.Sum(nil), []byte(signature)), nil
+		}), nil
+	})
+}
+
+func init() {
+	if err := registerAEADMethods(aeadMethodSpec{
+		name:       "encrypt_aes_gcm",
+		cipherName: "AES-GCM",
+		keyDesc:    "The AES key to use, which must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256 respectively.",
+		newAEAD:    newAESGCM,
+
+		sampleCiphertext: "29ZhKaqwk5kby3D/vJVKUsSyAn3C/JFVsDVQko/QjYs96XgkJ/ds",
+	}); err != nil {
+		panic(err)
+	}
+
+	if err := registerAEADMethods(aeadMethodSpec{
+		name:       "encrypt_chacha20_poly1305",
+		cipherName: "ChaCha20-Poly1305",
+		keyDesc:    "The key to use, which must be 32 bytes long.",
+		newAEAD:    chacha20poly1305.New,
+
+		sampleCiphertext: "ap4jBVwX7B7a+Rj1AqVCvrXs4YB0B0+zzQqh7/pOOYTAjhRjmoDX",
+	}); err != nil {
+		panic(err)
+	}
+
+	if err := registerRSAOAEPMethods(); err != nil {
+		panic(err)
+	}
+
+	if err := registerHMACCompareMethod(); err != nil {
+		panic(err)
+	}
+}
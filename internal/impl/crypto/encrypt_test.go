@@ -0,0 +1,164 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func testPEM(t *testing.T, key any) (pub, priv string) {
+	t.Helper()
+	privBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubBytes, err := x509.MarshalPKIXPublicKey(&key.(*rsa.PrivateKey).PublicKey)
+	require.NoError(t, err)
+	pub = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}))
+	priv = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}))
+	return
+}
+
+func testRSAJWK(key *rsa.PrivateKey, kid string, private bool) map[string]any {
+	enc := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	jwk := map[string]any{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   enc(key.N),
+		"e":   enc(big.NewInt(int64(key.E))),
+	}
+	if private {
+		jwk["d"] = enc(key.D)
+		jwk["p"] = enc(key.Primes[0])
+		jwk["q"] = enc(key.Primes[1])
+	}
+	return jwk
+}
+
+func testJWKS(t *testing.T, keys ...map[string]any) string {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestAEADMethods(t *testing.T) {
+	const key = "0123456789abcdef0123456789abcdef"
+	jwks := testJWKS(t,
+		map[string]any{"kty": "oct", "kid": "old", "k": base64.RawURLEncoding.EncodeToString([]byte("fedcba9876543210"))},
+		map[string]any{"kty": "oct", "kid": "new", "k": base64.RawURLEncoding.EncodeToString([]byte(key))},
+	)
+
+	for _, method := range []string{"aes_gcm", "chacha20_poly1305"} {
+		t.Run(method, func(t *testing.T) {
+			exe, err := bloblang.Parse(fmt.Sprintf(`
+let encrypted = this.value.encrypt_%[1]v(key: %[2]q, aad: "foo")
+root.decrypted = $encrypted.decrypt_%[1]v(key: %[2]q, aad: "foo").string()
+root.wrong_aad = $encrypted.decrypt_%[1]v(key: %[2]q, aad: "bar").catch("failed")
+root.jwks = $encrypted.decrypt_%[1]v(key: %[3]q, kid: "new", aad: "foo").string()
+root.differs = $encrypted != this.value.encrypt_%[1]v(key: %[2]q, aad: "foo")
+`, method, key, jwks))
+			require.NoError(t, err)
+
+			res, err := exe.Query(map[string]any{"value": "123-45-6789"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]any{
+				"decrypted": "123-45-6789",
+				"wrong_aad": "failed",
+				"jwks":      "123-45-6789",
+				"differs":   true,
+			}, res)
+
+			_, err = bloblang.Parse(fmt.Sprintf(`root = this.encrypt_%v(key: "tooshort")`, method))
+			require.Error(t, err)
+
+			_, err = bloblang.Parse(fmt.Sprintf(`root = this.encrypt_%v(key: %q)`, method, jwks))
+			require.ErrorContains(t, err, "a kid must be specified")
+		})
+	}
+}
+
+func TestRSAOAEPMethods(t *testing.T) {
+	key := testRSAKey(t)
+	pubPEM, privPEM := testPEM(t, key)
+	jwks := testJWKS(t, testRSAJWK(testRSAKey(t), "old", true), testRSAJWK(key, "new", true))
+
+	for _, test := range []struct {
+		name    string
+		encrypt string
+		decrypt string
+	}{
+		{
+			name:    "pem",
+			encrypt: fmt.Sprintf(`encrypt_rsa_oaep(key: %q)`, pubPEM),
+			decrypt: fmt.Sprintf(`decrypt_rsa_oaep(key: %q)`, privPEM),
+		},
+		{
+			name:    "jwks sha1",
+			encrypt: fmt.Sprintf(`encrypt_rsa_oaep(key: %q, kid: "new", hash: "sha1", label: "foo")`, jwks),
+			decrypt: fmt.Sprintf(`decrypt_rsa_oaep(key: %q, hash: "sha1", label: "foo")`, privPEM),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exe, err := bloblang.Parse(fmt.Sprintf(`root = this.value.%v.%v.string()`, test.encrypt, test.decrypt))
+			require.NoError(t, err)
+
+			res, err := exe.Query(map[string]any{"value": "data key"})
+			require.NoError(t, err)
+			assert.Equal(t, "data key", res)
+		})
+	}
+
+	_, err := bloblang.Parse(fmt.Sprintf(`root = this.decrypt_rsa_oaep(key: %q)`, pubPEM))
+	require.ErrorContains(t, err, "no suitable key")
+
+	_, err = bloblang.Parse(fmt.Sprintf(`root = this.encrypt_rsa_oaep(key: %q, hash: "md5")`, pubPEM))
+	require.ErrorContains(t, err, "unsupported hash")
+}
+
+func TestCompareHMAC(t *testing.T) {
+	exe, err := bloblang.Parse(`root = this.payload.compare_hmac(algorithm: "sha256", key: "static-key", signature: this.signature.decode("hex"))`)
+	require.NoError(t, err)
+
+	for sig, exp := range map[string]bool{
+		"b1cdce8b2add1f96135b2506f8ab748ae8ef15c49c0320357a6d168c42e20746": true,
+		"b1cdce8b2add1f96135b2506f8ab748ae8ef15c49c0320357a6d168c42e20747": false,
+		"b1cdce8b": false,
+	} {
+		res, err := exe.Query(map[string]any{"payload": "hello world", "signature": sig})
+		require.NoError(t, err)
+		assert.Equal(t, exp, res, sig)
+	}
+}
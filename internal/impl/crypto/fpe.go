@@ -0,0 +1,451 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+// The format-preserving encryption modes FF1 and FF3-1 as specified by NIST
+// SP 800-38G, which encrypt a string of numerals of a given radix into a string
+// of numerals of the same radix and length.
+
+// fpeMinDomain is the minimum number of possible values of an input.
+const fpeMinDomain = 1000000
+
+var errFPEInputTooShort = errors.New("input is too short for format-preserving encryption")
+
+// fpeNum returns the number represented by a string of numerals, with the most
+// significant numeral first.
+func fpeNum(x []uint16, radix *big.Int) *big.Int {
+	n := new(big.Int)
+	for _, d := range x {
+		n.Mul(n, radix).Add(n, big.NewInt(int64(d)))
+	}
+	return n
+}
+
+// fpeStr returns the representation of v as a string of m numerals, with the
+// most significant numeral first.
+func fpeStr(v *big.Int, radix *big.Int, m int) []uint16 {
+	x := make([]uint16, m)
+	v, r := new(big.Int).Set(v), new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		v.QuoRem(v, radix, r)
+		x[i] = uint16(r.Uint64())
+	}
+	return x
+}
+
+func fpeReversed[T any](x []T) []T {
+	r := slices.Clone(x)
+	slices.Reverse(r)
+	return r
+}
+
+func fpeCheckLength(radix *big.Int, n int) error {
+	if n < 2 || new(big.Int).Exp(radix, big.NewInt(int64(n)), nil).Cmp(big.NewInt(fpeMinDomain)) < 0 {
+		return errFPEInputTooShort
+	}
+	return nil
+}
+
+// fpeCipher encrypts and decrypts strings of numerals.
+type fpeCipher interface {
+	encrypt(x []uint16) ([]uint16, error)
+	decrypt(x []uint16) ([]uint16, error)
+}
+
+//------------------------------------------------------------------------------
+
+type ff1Cipher struct {
+	block cipher.Block
+	radix *big.Int
+	tweak []byte
+}
+
+func newFF1(key, tweak []byte, radix int) (*ff1Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ff1Cipher{block: block, radix: big.NewInt(int64(radix)), tweak: tweak}, nil
+}
+
+// prf is the CBC-MAC of data with a zero IV, data must be a multiple of the
+// block size.
+func (f *ff1Cipher) prf(data []byte) []byte {
+	y := make([]byte, aes.BlockSize)
+	for i := 0; i < len(data); i += aes.BlockSize {
+		xorBytes(y, data[i:i+aes.BlockSize])
+		f.block.Encrypt(y, y)
+	}
+	return y
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+func (f *ff1Cipher) crypt(x []uint16, decrypt bool) ([]uint16, error) {
+	n := len(x)
+	if err := fpeCheckLength(f.radix, n); err != nil {
+		return nil, err
+	}
+	u, v := n/2, n-n/2
+	a, b := slices.Clone(x[:u]), slices.Clone(x[u:])
+
+	radixV := new(big.Int).Exp(f.radix, big.NewInt(int64(v)), nil)
+	radixU := new(big.Int).Exp(f.radix, big.NewInt(int64(u)), nil)
+	byteLen := (new(big.Int).Sub(radixV, big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((byteLen+3)/4) + 4
+
+	t := len(f.tweak)
+	radix := f.radix.Uint64()
+	p := []byte{
+		1, 2, 1, byte(radix >> 16), byte(radix >> 8), byte(radix), 10, byte(u),
+		byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n),
+		byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t),
+	}
+	pad := ((-t-byteLen-1)%16 + 16) % 16
+	q := make([]byte, t+pad+1+byteLen)
+	copy(q, f.tweak)
+
+	s := make([]byte, ((d+15)/16)*16)
+	block := make([]byte, aes.BlockSize)
+	y, c := new(big.Int), new(big.Int)
+
+	for j := 0; j < 10; j++ {
+		i, numerals := j, b
+		if decrypt {
+			i, numerals = 9-j, a
+		}
+
+		q[t+pad] = byte(i)
+		fpeNum(numerals, f.radix).FillBytes(q[t+pad+1:])
+
+		r := f.prf(append(slices.Clone(p), q...))
+		copy(s, r)
+		for k := 1; k*aes.BlockSize < d; k++ {
+			copy(block, r)
+			for bi := 0; bi < 8; bi++ {
+				block[aes.BlockSize-1-bi] ^= byte(uint64(k) >> (8 * bi))
+			}
+			f.block.Encrypt(s[k*aes.BlockSize:], block)
+		}
+		y.SetBytes(s[:d])
+
+		m, mod := u, radixU
+		if i%2 == 1 {
+			m, mod = v, radixV
+		}
+		if decrypt {
+			c.Sub(fpeNum(b, f.radix), y).Mod(c, mod)
+			a, b = fpeStr(c, f.radix, m), a
+		} else {
+			c.Add(fpeNum(a, f.radix), y).Mod(c, mod)
+			a, b = b, fpeStr(c, f.radix, m)
+		}
+	}
+	return append(a, b...), nil
+}
+
+func (f *ff1Cipher) encrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, false)
+}
+
+func (f *ff1Cipher) decrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, true)
+}
+
+//------------------------------------------------------------------------------
+
+type ff3Cipher struct {
+	block  cipher.Block
+	radix  *big.Int
+	maxLen int
+
+	// The left and right halves of the 64-bit tweak.
+	tl, tr []byte
+}
+
+// newFF3 creates an FF3 cipher with a 64-bit tweak, which is used with an
+// expanded 56-bit tweak by FF3-1.
+func newFF3(key, tweak []byte, radix int) (*ff3Cipher, error) {
+	if len(tweak) != 8 {
+		return nil, fmt.Errorf("expected a tweak of 8 bytes, got %v", len(tweak))
+	}
+	block, err := aes.NewCipher(fpeReversed(key))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ff3Cipher{
+		block: block,
+		radix: big.NewInt(int64(radix)),
+		tl:    tweak[:4],
+		tr:    tweak[4:],
+	}
+
+	// The maximum length is 2 * floor(log_radix(2^96)).
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	for v := new(big.Int).Set(f.radix); v.Cmp(limit) <= 0; v.Mul(v, f.radix) {
+		f.maxLen++
+	}
+	f.maxLen *= 2
+	return f, nil
+}
+
+// newFF31 creates an FF3-1 cipher with a 56-bit tweak.
+func newFF31(key, tweak []byte, radix int) (*ff3Cipher, error) {
+	if len(tweak) != 7 {
+		return nil, fmt.Errorf("expected a tweak of 7 bytes, got %v", len(tweak))
+	}
+	return newFF3(key, []byte{
+		tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0,
+		tweak[4], tweak[5], tweak[6], tweak[3] << 4,
+	}, radix)
+}
+
+func (f *ff3Cipher) crypt(x []uint16, decrypt bool) ([]uint16, error) {
+	n := len(x)
+	if err := fpeCheckLength(f.radix, n); err != nil {
+		return nil, err
+	}
+	if n > f.maxLen {
+		return nil, fmt.Errorf("input length %v exceeds the maximum of %v", n, f.maxLen)
+	}
+	u, v := (n+1)/2, n-(n+1)/2
+	a, b := slices.Clone(x[:u]), slices.Clone(x[u:])
+
+	radixU := new(big.Int).Exp(f.radix, big.NewInt(int64(u)), nil)
+	radixV := new(big.Int).Exp(f.radix, big.NewInt(int64(v)), nil)
+
+	p := make([]byte, aes.BlockSize)
+	y, c := new(big.Int), new(big.Int)
+
+	for j := 0; j < 8; j++ {
+		i, numerals := j, b
+		if decrypt {
+			i, numerals = 7-j, a
+		}
+
+		m, mod, w := u, radixU, f.tr
+		if i%2 == 1 {
+			m, mod, w = v, radixV, f.tl
+		}
+
+		copy(p, w)
+		p[3] ^= byte(i)
+		fpeNum(fpeReversed(numerals), f.radix).FillBytes(p[4:])
+
+		s := fpeReversed(p)
+		f.block.Encrypt(s, s)
+		y.SetBytes(fpeReversed(s))
+
+		if decrypt {
+			c.Sub(fpeNum(fpeReversed(b), f.radix), y).Mod(c, mod)
+			a, b = fpeReversed(fpeStr(c, f.radix, m)), a
+		} else {
+			c.Add(fpeNum(fpeReversed(a), f.radix), y).Mod(c, mod)
+			a, b = b, fpeReversed(fpeStr(c, f.radix, m))
+		}
+	}
+	return append(a, b...), nil
+}
+
+func (f *ff3Cipher) encrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, false)
+}
+
+func (f *ff3Cipher) decrypt(x []uint16) ([]uint16, error) {
+	return f.crypt(x, true)
+}
+
+//------------------------------------------------------------------------------
+
+// fpeAlphabet maps the characters of an alphabet to numerals.
+type fpeAlphabet struct {
+	chars []rune
+	index map[rune]uint16
+}
+
+func newFPEAlphabet(s string) (*fpeAlphabet, error) {
+	a := &fpeAlphabet{chars: []rune(s), index: map[rune]uint16{}}
+	if len(a.chars) < 2 || len(a.chars) > 1<<16 {
+		return nil, errors.New("alphabet must contain between 2 and 65536 characters")
+	}
+	for i, c := range a.chars {
+		if _, exists := a.index[c]; exists {
+			return nil, fmt.Errorf("alphabet contains duplicate character %q", c)
+		}
+		a.index[c] = uint16(i)
+	}
+	return a, nil
+}
+
+// transform applies fn to the characters of s that are within the alphabet,
+// leaving all other characters in place.
+func (a *fpeAlphabet) transform(s string, fn func([]uint16) ([]uint16, error)) (string, error) {
+	runes := []rune(s)
+
+	var numerals []uint16
+	for _, r := range runes {
+		if i, exists := a.index[r]; exists {
+			numerals = append(numerals, i)
+		}
+	}
+
+	numerals, err := fn(numerals)
+	if err != nil {
+		return "", err
+	}
+
+	for i, j := 0, 0; i < len(runes); i++ {
+		if _, exists := a.index[runes[i]]; exists {
+			runes[i] = a.chars[numerals[j]]
+			j++
+		}
+	}
+	return string(runes), nil
+}
+
+type fpeMethodSpec struct {
+	name      string
+	mode      string
+	tweakDesc string
+	newCipher func(key, tweak []byte, radix int) (fpeCipher, error)
+
+	sampleTweak  string
+	sampleOutput string
+}
+
+func fpeCtor(newCipher func(key, tweak []byte, radix int) (fpeCipher, error), decrypt bool) bloblang.MethodConstructorV2 {
+	return func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		keyStr, err := args.GetString("key")
+		if err != nil {
+			return nil, err
+		}
+		tweak, err := args.GetString("tweak")
+		if err != nil {
+			return nil, err
+		}
+		alphabetStr, err := args.GetString("alphabet")
+		if err != nil {
+			return nil, err
+		}
+		kid, err := args.GetString("kid")
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := symmetricKey(keyStr, kid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+		alphabet, err := newFPEAlphabet(alphabetStr)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newCipher(key, []byte(tweak), len(alphabet.chars))
+		if err != nil {
+			return nil, err
+		}
+
+		fn := c.encrypt
+		if decrypt {
+			fn = c.decrypt
+		}
+		return bloblang.StringMethod(func(s string) (any, error) {
+			return alphabet.transform(s, fn)
+		}), nil
+	}
+}
+
+func registerFPEMethods(m fpeMethodSpec) error {
+	tweakArg := ""
+	tweakParam := bloblang.NewStringParam("tweak").Description(m.tweakDesc)
+	if m.sampleTweak != "" {
+		tweakArg = fmt.Sprintf(", tweak: %q", m.sampleTweak)
+	} else {
+		tweakParam = tweakParam.Default("")
+	}
+
+	params := func(spec *bloblang.PluginSpec) *bloblang.PluginSpec {
+		return spec.
+			Param(bloblang.NewStringParam("key").Description("The AES key to use, which must be 16, 24 or 32 bytes long. The key can also be provided as a JWK or JWKS document containing a symmetric (`oct`) key, and can be loaded from a file with the `file` function.")).
+			Param(tweakParam).
+			Param(bloblang.NewStringParam("alphabet").Description("The characters that are encrypted, where the number of characters is the radix of the encryption. Characters of the input that are not within the alphabet are left in place.").Default("0123456789")).
+			Param(bloblang.NewStringParam("kid").Description("The ID of the key to use when the key is a JWKS document containing multiple keys.").Default(""))
+	}
+
+	encryptSpec := params(bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description(fmt.Sprintf("Encrypts the characters of a string that are within an alphabet using the %v mode of format-preserving encryption (NIST SP 800-38G), resulting in a string of the same length and format. The same input, key and tweak always result in the same output, and the output can be decrypted with the `%v` method. The number of possible values of the encrypted characters must be at least one million, for example at least six digits.", m.mode, "de"+m.name[2:])).
+		Version("4.31.0").
+		Example("", fmt.Sprintf(`root.card = this.card.%v(key: "0123456789abcdef"%v)`, m.name, tweakArg), [2]string{
+			`{"card":"4111-1111-1111-1111"}`,
+			fmt.Sprintf(`{"card":%q}`, m.sampleOutput),
+		}))
+	if err := bloblang.RegisterMethodV2(m.name, encryptSpec, fpeCtor(m.newCipher, false)); err != nil {
+		return err
+	}
+
+	decryptSpec := params(bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description(fmt.Sprintf("Decrypts the characters of a string that are within an alphabet using the %v mode of format-preserving encryption (NIST SP 800-38G), reversing the `%v` method.", m.mode, m.name)).
+		Version("4.31.0").
+		Example("", fmt.Sprintf(`root.card = this.card.%v(key: "0123456789abcdef"%v)`, "de"+m.name[2:], tweakArg), [2]string{
+			fmt.Sprintf(`{"card":%q}`, m.sampleOutput),
+			`{"card":"4111-1111-1111-1111"}`,
+		}))
+	return bloblang.RegisterMethodV2("de"+m.name[2:], decryptSpec, fpeCtor(m.newCipher, true))
+}
+
+func init() {
+	if err := registerFPEMethods(fpeMethodSpec{
+		name:      "encrypt_ff1",
+		mode:      "FF1",
+		tweakDesc: "An optional tweak of any length, which is not secret but changes the result of the encryption, such as the name of the field being encrypted.",
+		newCipher: func(key, tweak []byte, radix int) (fpeCipher, error) {
+			return newFF1(key, tweak, radix)
+		},
+		sampleOutput: "6313-1760-0128-0203",
+	}); err != nil {
+		panic(err)
+	}
+
+	if err := registerFPEMethods(fpeMethodSpec{
+		name:      "encrypt_ff3_1",
+		mode:      "FF3-1",
+		tweakDesc: "A tweak of exactly 7 bytes, which is not secret but changes the result of the encryption, such as an identifier of the field being encrypted.",
+		newCipher: func(key, tweak []byte, radix int) (fpeCipher, error) {
+			return newFF31(key, tweak, radix)
+		},
+		sampleTweak:  "card_no",
+		sampleOutput: "9405-6211-8607-2344",
+	}); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+const testFPEAlphabet36 = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func testFPECrypt(t *testing.T, c fpeCipher, alphabet, plaintext, ciphertext string) {
+	t.Helper()
+
+	a, err := newFPEAlphabet(alphabet)
+	require.NoError(t, err)
+
+	res, err := a.transform(plaintext, c.encrypt)
+	require.NoError(t, err)
+	assert.Equal(t, ciphertext, res)
+
+	res, err = a.transform(ciphertext, c.decrypt)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, res)
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// Sample vectors published by NIST for SP 800-38G.
+func TestFF1Vectors(t *testing.T) {
+	for i, test := range []struct {
+		key, tweak, alphabet, plaintext, ciphertext string
+	}{
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "", "0123456789", "0123456789", "2433477484"},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "39383736353433323130", "0123456789", "0123456789", "6124200773"},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", "3737373770717273373737", testFPEAlphabet36, "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F", "", "0123456789", "0123456789", "2830668132"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94", "", "0123456789", "0123456789", "6657667009"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			a, err := newFPEAlphabet(test.alphabet)
+			require.NoError(t, err)
+			c, err := newFF1(mustHex(t, test.key), mustHex(t, test.tweak), len(a.chars))
+			require.NoError(t, err)
+			testFPECrypt(t, c, test.alphabet, test.plaintext, test.ciphertext)
+		})
+	}
+}
+
+// Sample vectors published by NIST for FF3, which FF3-1 only differs from by
+// the size of the tweak.
+func TestFF3Vectors(t *testing.T) {
+	for i, test := range []struct {
+		key, tweak, alphabet, plaintext, ciphertext string
+	}{
+		{"EF4359D8D580AA4F7F036D6F04FC6A94", "D8E7920AFA330A73", "0123456789", "890121234567890000", "750918814058654607"},
+		{"EF4359D8D580AA4F7F036D6F04FC6A94", "9A768A92F60E12D8", "0123456789", "890121234567890000", "018989839189395384"},
+		{"EF4359D8D580AA4F7F036D6F04FC6A94", "D8E7920AFA330A73", "0123456789", "89012123456789000000789000000", "48598367162252569629397416226"},
+		{"EF4359D8D580AA4F7F036D6F04FC6A94", "9A768A92F60E12D8", testFPEAlphabet36[:26], "0123456789abcdefghi", "g2pk40i992fn20cjakb"},
+	} {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			a, err := newFPEAlphabet(test.alphabet)
+			require.NoError(t, err)
+			c, err := newFF3(mustHex(t, test.key), mustHex(t, test.tweak), len(a.chars))
+			require.NoError(t, err)
+			testFPECrypt(t, c, test.alphabet, test.plaintext, test.ciphertext)
+		})
+	}
+}
+
+func TestFF31Tweak(t *testing.T) {
+	c, err := newFF31(make([]byte, 16), mustHex(t, "D8E7920AFA330A"), 10)
+	require.NoError(t, err)
+	assert.Equal(t, mustHex(t, "D8E79200"), c.tl)
+	assert.Equal(t, mustHex(t, "FA330AA0"), c.tr)
+
+	_, err = newFF31(make([]byte, 16), []byte("too long"), 10)
+	require.Error(t, err)
+}
+
+func TestFPEMethods(t *testing.T) {
+	for _, method := range []string{"ff1", "ff3_1"} {
+		t.Run(method, func(t *testing.T) {
+			exe, err := bloblang.Parse(fmt.Sprintf(`
+root.card = this.card.encrypt_%[1]v(key: %[2]q, tweak: "account")
+root.email = this.email.encrypt_%[1]v(key: %[2]q, tweak: "account", alphabet: %[3]q)
+root.card_decrypted = root.card.decrypt_%[1]v(key: %[2]q, tweak: "account")
+root.email_decrypted = root.email.decrypt_%[1]v(key: %[2]q, tweak: "account", alphabet: %[3]q)
+`, method, string(mustHex(t, "2B7E151628AED2A6ABF7158809CF4F3C")), testFPEAlphabet36))
+			require.NoError(t, err)
+
+			input := map[string]any{"card": "4111-1111-1111-1111", "email": "alice.smith@example.com"}
+			res, err := exe.Query(input)
+			require.NoError(t, err)
+
+			obj := res.(map[string]any)
+			assert.Equal(t, input["card"], obj["card_decrypted"])
+			assert.Equal(t, input["email"], obj["email_decrypted"])
+			assert.Regexp(t, `^\d{4}-\d{4}-\d{4}-\d{4}$`, obj["card"])
+			assert.Regexp(t, `^[a-z0-9]{5}\.[a-z0-9]{5}@[a-z0-9]{7}\.[a-z0-9]{3}$`, obj["email"])
+			assert.NotEqual(t, input["card"], obj["card"])
+
+			res2, err := exe.Query(input)
+			require.NoError(t, err)
+			assert.Equal(t, res, res2)
+
+			_, err = exe.Query(map[string]any{"card": "12-34", "email": "alice.smith@example.com"})
+			require.ErrorIs(t, err, errFPEInputTooShort)
+		})
+	}
+
+	for _, mapping := range []string{
+		`root = this.encrypt_ff1(key: "tooshort")`,
+		`root = this.encrypt_ff1(key: "0123456789abcdef", alphabet: "aa")`,
+		`root = this.encrypt_ff3_1(key: "0123456789abcdef", tweak: "")`,
+	} {
+		_, err := bloblang.Parse(mapping)
+		require.Error(t, err, mapping)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+// jweHeader is the protected header of a JWE in compact serialization as
+// described in RFC 7516.
+type jweHeader struct {
+	Alg  string   `json:"alg"`
+	Enc  string   `json:"enc"`
+	Kid  string   `json:"kid,omitempty"`
+	Zip  string   `json:"zip,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+var jweContentKeySizes = map[string]int{
+	"A128GCM": 16,
+	"A192GCM": 24,
+	"A256GCM": 32,
+}
+
+var jweRSAHashes = map[string]func() hash.Hash{
+	"RSA-OAEP":     sha1.New,
+	"RSA-OAEP-256": sha256.New,
+}
+
+func checkJWEAlgorithms(alg, enc string) error {
+	if _, exists := jweRSAHashes[alg]; !exists && alg != "dir" {
+		return fmt.Errorf("unsupported key management algorithm: %v", alg)
+	}
+	if _, exists := jweContentKeySizes[enc]; !exists {
+		return fmt.Errorf("unsupported content encryption algorithm: %v", enc)
+	}
+	return nil
+}
+
+// keySelectionID returns the kid to select a key with from a key set, where
+// keys without IDs, such as PEM encoded keys, are selected regardless of kid.
+func keySelectionID(keys []parsedKey, kid string) string {
+	for _, k := range keys {
+		if k.kid != "" {
+			return kid
+		}
+	}
+	return ""
+}
+
+type jweEncoder struct {
+	header jweHeader
+
+	// Either a public key for RSA-OAEP algorithms or a content encryption key
+	// for direct encryption.
+	rsaKey    *rsa.PublicKey
+	directKey []byte
+}
+
+func newJWEEncoder(keyStr, alg, enc, kid string) (*jweEncoder, error) {
+	if err := checkJWEAlgorithms(alg, enc); err != nil {
+		return nil, err
+	}
+
+	e := &jweEncoder{header: jweHeader{Alg: alg, Enc: enc, Kid: kid}}
+	if alg == "dir" {
+		keys, err := parseKeysOrSecret([]byte(keyStr))
+		if err != nil {
+			return nil, err
+		}
+		if _, e.directKey, err = selectKey(keys, keySelectionID(keys, kid), asSymmetricKey); err != nil {
+			return nil, err
+		}
+		if len(e.directKey) != jweContentKeySizes[enc] {
+			return nil, fmt.Errorf("algorithm %v requires a key of %v bytes, got %v", enc, jweContentKeySizes[enc], len(e.directKey))
+		}
+		return e, nil
+	}
+
+	keys, err := parseKeys([]byte(keyStr))
+	if err != nil {
+		return nil, err
+	}
+	if _, e.rsaKey, err = selectKey(keys, keySelectionID(keys, kid), asRSAPublicKey); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *jweEncoder) encode(plaintext []byte) (string, error) {
+	headerBytes, err := json.Marshal(e.header)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerBytes)
+
+	cek, encryptedKey := e.directKey, []byte(nil)
+	if e.rsaKey != nil {
+		cek = make([]byte, jweContentKeySizes[e.header.Enc])
+		if _, err := rand.Read(cek); err != nil {
+			return "", fmt.Errorf("failed to generate content encryption key: %w", err)
+		}
+		if encryptedKey, err = rsa.EncryptOAEP(jweRSAHashes[e.header.Alg](), rand.Reader, e.rsaKey, cek, nil); err != nil {
+			return "", fmt.Errorf("failed to encrypt content encryption key: %w", err)
+		}
+	}
+
+	aead, err := newAESGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := aeadSeal(aead, plaintext, []byte(protected))
+	if err != nil {
+		return "", err
+	}
+	iv := sealed[:aead.NonceSize()]
+	ciphertext := sealed[aead.NonceSize() : len(sealed)-aead.Overhead()]
+	tag := sealed[len(sealed)-aead.Overhead():]
+
+	enc := base64.RawURLEncoding.EncodeToString
+	return strings.Join([]string{protected, enc(encryptedKey), enc(iv), enc(ciphertext), enc(tag)}, "."), nil
+}
+
+type jweDecoder struct {
+	keys []parsedKey
+	kid  string
+}
+
+func (d *jweDecoder) decode(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, errors.New("expected a JWE in compact serialization with five segments")
+	}
+
+	segments := make([][]byte, 5)
+	for i, p := range parts {
+		var err error
+		if segments[i], err = base64.RawURLEncoding.DecodeString(p); err != nil {
+			return nil, fmt.Errorf("failed to decode segment %v: %w", i, err)
+		}
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(segments[0], &header); err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+	if err := checkJWEAlgorithms(header.Alg, header.Enc); err != nil {
+		return nil, err
+	}
+	if header.Zip != "" {
+		return nil, fmt.Errorf("unsupported compression algorithm: %v", header.Zip)
+	}
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("unsupported critical header parameters: %v", header.Crit)
+	}
+
+	kid := d.kid
+	if kid == "" {
+		kid = header.Kid
+	}
+	kid = keySelectionID(d.keys, kid)
+
+	var cek []byte
+	if header.Alg == "dir" {
+		if len(segments[1]) > 0 {
+			return nil, errors.New("encrypted key must be empty for direct encryption")
+		}
+		_, key, err := selectKey(d.keys, kid, asSymmetricKey)
+		if err != nil {
+			return nil, err
+		}
+		cek = key
+	} else {
+		_, key, err := selectKey(d.keys, kid, asRSAPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if cek, err = rsa.DecryptOAEP(jweRSAHashes[header.Alg](), nil, key, segments[1], nil); err != nil {
+			return nil, fmt.Errorf("failed to decrypt content encryption key: %w", err)
+		}
+	}
+	if len(cek) != jweContentKeySizes[header.Enc] {
+		return nil, fmt.Errorf("algorithm %v requires a key of %v bytes, got %v", header.Enc, jweContentKeySizes[header.Enc], len(cek))
+	}
+
+	aead, err := newAESGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments[2]) != aead.NonceSize() {
+		return nil, errors.New("invalid initialization vector length")
+	}
+	sealed := append(append([]byte{}, segments[3]...), segments[4]...)
+	return aead.Open(nil, segments[2], sealed, []byte(parts[0]))
+}
+
+func registerJWEMethods() error {
+	encodeSpec := bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description("Encrypts a string or byte array as a JSON Web Encryption (JWE) in compact serialization. The key management algorithms `RSA-OAEP`, `RSA-OAEP-256` and `dir` (direct encryption with a shared symmetric key) are supported, along with the content encryption algorithms `A128GCM`, `A192GCM` and `A256GCM`.").
+		Version("4.31.0").
+		Param(bloblang.NewStringParam("key").Description("The key to encrypt with, which is an RSA public key for RSA-OAEP algorithms, or a symmetric key for direct encryption. "+keyDocsDescription)).
+		Param(bloblang.NewStringParam("alg").Description("The key management algorithm.").Default("RSA-OAEP-256")).
+		Param(bloblang.NewStringParam("enc").Description("The content encryption algorithm.").Default("A256GCM")).
+		Param(bloblang.NewStringParam("kid").Description("The ID of the key to use when the key is a JWKS document containing multiple keys. The ID is added to the header of the token, and is used as is when the key is not a JWKS document.").Default("")).
+		ExampleNotTested("", `root.payload = this.payload.format_json().encode_jwe(key: file("./jwks.json"), kid: "2024-06")`, [2]string{
+			`{"payload":{"name":"Alice","ssn":"123-45-6789"}}`,
+			`{"payload":"eyJhbGciOiJSU0EtT0FFUC0yNTYiLCJlbmMiOiJBMjU2R0NNIiwia2lkIjoiMjAyNC0wNiJ9.ZK6rU...Q.6XLhE7v1DQ5sM1RC.hpNDm...A.vS3uVMXzs7Jf9hF0o3k6Xw"}`,
+		})
+
+	if err := bloblang.RegisterMethodV2("encode_jwe", encodeSpec, func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		keyStr, err := args.GetString("key")
+		if err != nil {
+			return nil, err
+		}
+		alg, err := args.GetString("alg")
+		if err != nil {
+			return nil, err
+		}
+		enc, err := args.GetString("enc")
+		if err != nil {
+			return nil, err
+		}
+		kid, err := args.GetString("kid")
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := newJWEEncoder(keyStr, alg, enc, kid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+		return bloblang.BytesMethod(func(data []byte) (any, error) {
+			return e.encode(data)
+		}), nil
+	}); err != nil {
+		return err
+	}
+
+	decodeSpec := bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description("Decrypts a JSON Web Encryption (JWE) in compact serialization, as produced by the `encode_jwe` method, and returns the plaintext as a byte array. When the key is a JWKS document the key is selected using the `kid` header of the token.").
+		Version("4.31.0").
+		Param(bloblang.NewStringParam("key").Description("The key to decrypt with, which is an RSA private key for RSA-OAEP algorithms, or a symmetric key for direct encryption. "+keyDocsDescription)).
+		Param(bloblang.NewStringParam("kid").Description("The ID of the key to use, overriding the `kid` header of the token.").Default("")).
+		Example("", `root.payload = this.payload.decode_jwe(key: "0123456789abcdef0123456789abcdef").string()`, [2]string{
+			`{"payload":"` + sampleJWE + `"}`,
+			`{"payload":"123-45-6789"}`,
+		})
+
+	return bloblang.RegisterMethodV2("decode_jwe", decodeSpec, func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		keyStr, err := args.GetString("key")
+		if err != nil {
+			return nil, err
+		}
+		kid, err := args.GetString("kid")
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := parseKeysOrSecret([]byte(keyStr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+		d := &jweDecoder{keys: keys, kid: kid}
+		return bloblang.StringMethod(func(token string) (any, error) {
+			return d.decode(token)
+		}), nil
+	})
+}
+
+// sampleJWE is the value 123-45-6789 encrypted using direct encryption with
+// A256GCM and the key 0123456789abcdef0123456789abcdef.
+const sampleJWE = "eyJhbGciOiJkaXIiLCJlbmMiOiJBMjU2R0NNIn0..fRb9CbnyJX3Ct7lq.hdOuL360Nf55iF8.s1jB4RCqWqLyawgpDO3GEg"
+
+func init() {
+	if err := registerJWEMethods(); err != nil {
+		panic(err)
+	}
+}
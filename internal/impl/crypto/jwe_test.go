@@ -0,0 +1,131 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+func TestJWERoundTrip(t *testing.T) {
+	oldKey, newKey := testRSAKey(t), testRSAKey(t)
+	pubPEM, privPEM := testPEM(t, newKey)
+	pubJWKS := testJWKS(t, testRSAJWK(oldKey, "old", false), testRSAJWK(newKey, "new", false))
+	privJWKS := testJWKS(t, testRSAJWK(oldKey, "old", true), testRSAJWK(newKey, "new", true))
+
+	for _, test := range []struct {
+		name      string
+		encodeKey string
+		decodeKey string
+		params    string
+		header    map[string]any
+	}{
+		{
+			name:      "rsa-oaep-256 jwks",
+			encodeKey: pubJWKS,
+			decodeKey: privJWKS,
+			params:    `kid: "new"`,
+			header:    map[string]any{"alg": "RSA-OAEP-256", "enc": "A256GCM", "kid": "new"},
+		},
+		{
+			name:      "rsa-oaep pem to jwks",
+			encodeKey: pubPEM,
+			decodeKey: privJWKS,
+			params:    `alg: "RSA-OAEP", enc: "A128GCM", kid: "new"`,
+			header:    map[string]any{"alg": "RSA-OAEP", "enc": "A128GCM", "kid": "new"},
+		},
+		{
+			name:      "rsa-oaep-256 pem",
+			encodeKey: pubPEM,
+			decodeKey: privPEM,
+			params:    `enc: "A192GCM"`,
+			header:    map[string]any{"alg": "RSA-OAEP-256", "enc": "A192GCM"},
+		},
+		{
+			name:      "dir",
+			encodeKey: "0123456789abcdef",
+			decodeKey: "0123456789abcdef",
+			params:    `alg: "dir", enc: "A128GCM"`,
+			header:    map[string]any{"alg": "dir", "enc": "A128GCM"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exe, err := bloblang.Parse(fmt.Sprintf(`
+root.token = this.value.encode_jwe(key: %q, %v)
+root.value = root.token.decode_jwe(key: %q).string()
+`, test.encodeKey, test.params, test.decodeKey))
+			require.NoError(t, err)
+
+			res, err := exe.Query(map[string]any{"value": "123-45-6789"})
+			require.NoError(t, err)
+
+			obj := res.(map[string]any)
+			assert.Equal(t, "123-45-6789", obj["value"])
+
+			headerBytes, err := base64.RawURLEncoding.DecodeString(strings.Split(obj["token"].(string), ".")[0])
+			require.NoError(t, err)
+			var header map[string]any
+			require.NoError(t, json.Unmarshal(headerBytes, &header))
+			assert.Equal(t, test.header, header)
+		})
+	}
+}
+
+func TestJWEDecodeSample(t *testing.T) {
+	exe, err := bloblang.Parse(`root = this.decode_jwe("0123456789abcdef0123456789abcdef").string()`)
+	require.NoError(t, err)
+
+	res, err := exe.Query(sampleJWE)
+	require.NoError(t, err)
+	assert.Equal(t, "123-45-6789", res)
+
+	parts := strings.Split(sampleJWE, ".")
+	for i, p := range parts {
+		if p == "" {
+			continue
+		}
+		tampered := append([]string{}, parts...)
+		b, err := base64.RawURLEncoding.DecodeString(p)
+		require.NoError(t, err)
+		b[0] ^= 1
+		tampered[i] = base64.RawURLEncoding.EncodeToString(b)
+
+		_, err = exe.Query(strings.Join(tampered, "."))
+		require.Error(t, err, i)
+	}
+
+	_, err = exe.Query("not.a.jwe")
+	require.Error(t, err)
+}
+
+func TestJWEErrors(t *testing.T) {
+	for _, mapping := range []string{
+		`root = this.encode_jwe(key: "0123456789abcdef", alg: "dir", enc: "A256GCM")`,
+		`root = this.encode_jwe(key: "0123456789abcdef", alg: "A128KW")`,
+		`root = this.encode_jwe(key: "0123456789abcdef", alg: "dir", enc: "A128CBC-HS256")`,
+		`root = this.encode_jwe(key: "not a key")`,
+	} {
+		_, err := bloblang.Parse(mapping)
+		require.Error(t, err, mapping)
+	}
+}
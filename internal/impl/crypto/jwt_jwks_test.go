@@ -0,0 +1,317 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+type testJWKSServer struct {
+	*httptest.Server
+	fetches atomic.Int64
+
+	mut  sync.Mutex
+	jwks string
+	fail bool
+}
+
+func newTestJWKSServer(t *testing.T, jwks string) *testJWKSServer {
+	t.Helper()
+	s := &testJWKSServer{jwks: jwks}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		if s.fail {
+			http.Error(w, "nope", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(s.jwks))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testJWKSServer) set(jwks string, fail bool) {
+	s.mut.Lock()
+	s.jwks, s.fail = jwks, fail
+	s.mut.Unlock()
+}
+
+func testSignJWT(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestParseJwtJWKS(t *testing.T) {
+	rsaKey := testRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := testJWKS(t,
+		testRSAJWK(rsaKey, "rsa", false),
+		map[string]any{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		map[string]any{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+	)
+	server := newTestJWKSServer(t, jwks)
+
+	exe, err := bloblang.Parse(fmt.Sprintf(`root = this.parse_jwt_jwks(jwks_url: %q, issuer: "idp", audience: "orders")`, server.URL))
+	require.NoError(t, err)
+
+	valid := jwt.MapClaims{"iss": "idp", "aud": "orders", "sub": "foo"}
+	for _, test := range []struct {
+		name   string
+		token  string
+		errStr string
+	}{
+		{name: "rs256", token: testSignJWT(t, jwt.SigningMethodRS256, rsaKey, "rsa", valid)},
+		{name: "ps384", token: testSignJWT(t, jwt.SigningMethodPS384, rsaKey, "rsa", valid)},
+		{name: "es256", token: testSignJWT(t, jwt.SigningMethodES256, ecKey, "ec", valid)},
+		{name: "eddsa", token: testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", valid)},
+		{
+			name:   "wrong kid",
+			token:  testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "rsa", valid),
+			errStr: "no suitable key",
+		},
+		{name: "no kid", token: testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "", valid)},
+		{
+			name:   "hmac",
+			token:  testSignJWT(t, jwt.SigningMethodHS256, []byte("secret"), "rsa", valid),
+			errStr: "signing method HS256 is invalid",
+		},
+		{
+			name:   "wrong issuer",
+			token:  testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", jwt.MapClaims{"iss": "other", "aud": "orders"}),
+			errStr: "token has invalid issuer",
+		},
+		{
+			name:   "wrong audience",
+			token:  testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", jwt.MapClaims{"iss": "idp", "aud": []string{"a", "b"}}),
+			errStr: "token has invalid audience",
+		},
+		{
+			name:   "expired",
+			token:  testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", jwt.MapClaims{"iss": "idp", "aud": "orders", "exp": time.Now().Add(-time.Minute).Unix()}),
+			errStr: "token is expired",
+		},
+		{
+			name:   "not yet valid",
+			token:  testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", jwt.MapClaims{"iss": "idp", "aud": "orders", "nbf": time.Now().Add(time.Minute).Unix()}),
+			errStr: "token is not valid yet",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := exe.Query(test.token)
+			if test.errStr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errStr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, map[string]any{"iss": "idp", "aud": "orders", "sub": "foo"}, res)
+		})
+	}
+
+	// The JWKS is only fetched once, including for unknown key IDs as it was
+	// fetched recently.
+	assert.Equal(t, int64(1), server.fetches.Load())
+}
+
+func TestParseJwtJWKSDynamicURL(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := testJWKS(t, map[string]any{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)})
+	serverA, serverB := newTestJWKSServer(t, jwks), newTestJWKSServer(t, jwks)
+
+	exe, err := bloblang.Parse(`root = this.token.parse_jwt_jwks(jwks_url: this.url)`)
+	require.NoError(t, err)
+
+	token := testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", jwt.MapClaims{"sub": "foo"})
+	for i := 0; i < 5; i++ {
+		for _, server := range []*testJWKSServer{serverA, serverB} {
+			res, err := exe.Query(map[string]any{"token": token, "url": server.URL})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]any{"sub": "foo"}, res)
+		}
+	}
+
+	// Each resolved URL is fetched once and then served from its cache.
+	assert.Equal(t, int64(1), serverA.fetches.Load())
+	assert.Equal(t, int64(1), serverB.fetches.Load())
+}
+
+func TestJWKSCacheRefresh(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	oldJWKS := testJWKS(t, map[string]any{"kty": "OKP", "kid": "old", "crv": "Ed25519", "x": b64(edPub)})
+	newJWKS := testJWKS(t, map[string]any{"kty": "OKP", "kid": "new", "crv": "Ed25519", "x": b64(edPub)})
+	server := newTestJWKSServer(t, oldJWKS)
+
+	now := time.Now()
+	cache := newJWKSCache(server.URL, time.Hour)
+	cache.nowFn = func() time.Time { return now }
+
+	kids := func(keys []parsedKey, err error) []string {
+		t.Helper()
+		require.NoError(t, err)
+		var s []string
+		for _, k := range keys {
+			s = append(s, k.kid)
+		}
+		return s
+	}
+
+	assert.Equal(t, []string{"old"}, kids(cache.getKeys("old")))
+	server.set(newJWKS, false)
+
+	// Unknown key IDs only trigger a fetch after the minimum refresh interval.
+	assert.Equal(t, []string{"old"}, kids(cache.getKeys("new")))
+	now = now.Add(jwksMinRefreshInterval)
+	assert.Equal(t, []string{"new"}, kids(cache.getKeys("new")))
+	assert.Equal(t, int64(2), server.fetches.Load())
+
+	// Failed refreshes continue to use the previous keys and back off.
+	server.set(oldJWKS, true)
+	now = now.Add(time.Hour)
+	assert.Equal(t, []string{"new"}, kids(cache.getKeys("new")))
+	assert.Equal(t, []string{"new"}, kids(cache.getKeys("new")))
+	assert.Equal(t, int64(3), server.fetches.Load())
+
+	server.set(oldJWKS, false)
+	now = now.Add(jwksMinRefreshInterval)
+	assert.Equal(t, []string{"old"}, kids(cache.getKeys("")))
+	assert.Equal(t, int64(4), server.fetches.Load())
+}
+
+func TestJWKSCacheConcurrentRefresh(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := testJWKS(t, map[string]any{"kty": "OKP", "kid": "foo", "crv": "Ed25519", "x": b64(edPub)})
+
+	var fetches atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		_, _ = w.Write([]byte(jwks))
+	}))
+	t.Cleanup(server.Close)
+
+	var nowMut sync.Mutex
+	now := time.Now()
+	cache := newJWKSCache(server.URL, time.Hour)
+	cache.nowFn = func() time.Time {
+		nowMut.Lock()
+		defer nowMut.Unlock()
+		return now
+	}
+
+	// Concurrent callers without cached keys wait for a single fetch.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := cache.getKeys("foo")
+			assert.NoError(t, err)
+			assert.Len(t, keys, 1)
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	release <- struct{}{}
+	wg.Wait()
+	assert.Equal(t, int64(1), fetches.Load())
+
+	// Cached keys are served while a refresh is in progress.
+	nowMut.Lock()
+	now = now.Add(time.Hour)
+	nowMut.Unlock()
+
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		_, err := cache.getKeys("foo")
+		assert.NoError(t, err)
+	}()
+	require.Eventually(t, func() bool {
+		return fetches.Load() == 2
+	}, time.Second, time.Millisecond*5)
+
+	keys, err := cache.getKeys("foo")
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	release <- struct{}{}
+	<-refreshed
+	assert.Equal(t, int64(2), fetches.Load())
+}
+
+func TestParseJwtJWKSFile(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(testJWKS(t,
+		map[string]any{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edPub)},
+	)), 0o644))
+
+	for _, location := range []string{path, "file://" + path} {
+		exe, err := bloblang.Parse(fmt.Sprintf(`root = this.parse_jwt_jwks(%q)`, location))
+		require.NoError(t, err)
+
+		res, err := exe.Query(testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", jwt.MapClaims{"sub": "foo"}))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"sub": "foo"}, res)
+	}
+
+	exe, err := bloblang.Parse(`root = this.parse_jwt_jwks("/does/not/exist.json")`)
+	require.NoError(t, err)
+
+	_, err = exe.Query(testSignJWT(t, jwt.SigningMethodEdDSA, edKey, "ed", jwt.MapClaims{"sub": "foo"}))
+	require.ErrorContains(t, err, "failed to fetch JWKS")
+}
@@ -0,0 +1,347 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// keyDocsDescription describes the formats accepted by the key parameters of
+// the encryption methods.
+const keyDocsDescription = "Asymmetric keys can be provided either as PEM encoded data (PKCS #1, PKCS #8, PKIX or an X.509 certificate) or as a JSON Web Key (JWK) or JSON Web Key Set (JWKS) document, and can be loaded from a file with the `file` function."
+
+// jsonWebKey is a single JSON Web Key as described in RFC 7517. Only the
+// parameters of supported key types are captured.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+
+	// Symmetric keys
+	K string `json:"k"`
+
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	D string `json:"d"`
+	P string `json:"p"`
+	Q string `json:"q"`
+
+	// Elliptic curve and octet key pair keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parsedKey is a decoded key along with the key ID it was published under, if
+// any.
+type parsedKey struct {
+	kid string
+	key any
+}
+
+func decodeJWKField(name, v string) ([]byte, error) {
+	if v == "" {
+		return nil, fmt.Errorf("missing field %v", name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode field %v: %w", name, err)
+	}
+	return b, nil
+}
+
+func decodeJWKBigInt(name, v string) (*big.Int, error) {
+	b, err := decodeJWKField(name, v)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// decode returns the key represented by a JWK, which is a []byte for symmetric
+// keys, either an *rsa.PublicKey or *rsa.PrivateKey for RSA keys, an
+// *ecdsa.PublicKey for EC keys and an ed25519.PublicKey for OKP keys.
+func (k *jsonWebKey) decode() (any, error) {
+	switch k.Kty {
+	case "oct":
+		return decodeJWKField("k", k.K)
+	case "RSA":
+		n, err := decodeJWKBigInt("n", k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKBigInt("e", k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent is too large")
+		}
+		pub := rsa.PublicKey{N: n, E: int(e.Int64())}
+		if k.D == "" {
+			return &pub, nil
+		}
+
+		priv := &rsa.PrivateKey{PublicKey: pub}
+		if priv.D, err = decodeJWKBigInt("d", k.D); err != nil {
+			return nil, err
+		}
+		if k.P == "" || k.Q == "" {
+			return nil, errors.New("private keys without the prime factors p and q are not supported")
+		}
+		p, err := decodeJWKBigInt("p", k.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeJWKBigInt("q", k.Q)
+		if err != nil {
+			return nil, err
+		}
+		priv.Primes = []*big.Int{p, q}
+		if err := priv.Validate(); err != nil {
+			return nil, err
+		}
+		priv.Precompute()
+		return priv, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %v", k.Crv)
+		}
+		x, err := decodeJWKBigInt("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKBigInt("y", k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %v", k.Crv)
+		}
+		x, err := decodeJWKField("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key length")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %v", k.Kty)
+}
+
+// parseJWKs parses either a single JWK or a JWKS document.
+func parseJWKs(data []byte) ([]parsedKey, error) {
+	var doc struct {
+		jsonWebKey
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JWK document: %w", err)
+	}
+
+	jwks := doc.Keys
+	if doc.Kty != "" {
+		jwks = append(jwks, doc.jsonWebKey)
+	}
+
+	var keys []parsedKey
+	for i, jwk := range jwks {
+		key, err := jwk.decode()
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", i, err)
+		}
+		keys = append(keys, parsedKey{kid: jwk.Kid, key: key})
+	}
+	return keys, nil
+}
+
+func parsePEMKey(block *pem.Block) (any, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type: %v", block.Type)
+}
+
+// parsePEMKeys parses all PEM blocks of data, which must contain at least one.
+func parsePEMKeys(data []byte) ([]parsedKey, error) {
+	var keys []parsedKey
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		key, err := parsePEMKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PEM block %v: %w", len(keys), err)
+		}
+		keys = append(keys, parsedKey{key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("expected a JWK, JWKS or PEM encoded key")
+	}
+	return keys, nil
+}
+
+func isJSONDocument(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// parseKeys parses a JWK, JWKS or PEM encoded key set.
+func parseKeys(data []byte) ([]parsedKey, error) {
+	if isJSONDocument(data) {
+		return parseJWKs(data)
+	}
+	return parsePEMKeys(data)
+}
+
+// selectKey returns the key of a set that has the provided kid and that is
+// accepted by the convert func. When kid is empty the key set must contain
+// exactly one accepted key.
+func selectKey[T any](keys []parsedKey, kid string, convert func(any) (T, bool)) (parsedKey, T, error) {
+	var (
+		match     parsedKey
+		converted T
+		found     int
+	)
+	for _, k := range keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if c, ok := convert(k.key); ok {
+			if found == 0 {
+				match, converted = k, c
+			}
+			found++
+		}
+	}
+
+	var zero T
+	switch {
+	case found == 0 && kid != "":
+		return parsedKey{}, zero, fmt.Errorf("no suitable key found with kid %v", kid)
+	case found == 0:
+		return parsedKey{}, zero, errors.New("no suitable key found")
+	case found > 1 && kid == "":
+		return parsedKey{}, zero, errors.New("multiple suitable keys found, a kid must be specified")
+	}
+	return match, converted, nil
+}
+
+func asSymmetricKey(k any) ([]byte, bool) {
+	b, ok := k.([]byte)
+	return b, ok
+}
+
+func asRSAPublicKey(k any) (*rsa.PublicKey, bool) {
+	switch t := k.(type) {
+	case *rsa.PublicKey:
+		return t, true
+	case *rsa.PrivateKey:
+		return &t.PublicKey, true
+	}
+	return nil, false
+}
+
+func asECDSAPublicKey(k any) (*ecdsa.PublicKey, bool) {
+	switch t := k.(type) {
+	case *ecdsa.PublicKey:
+		return t, true
+	case *ecdsa.PrivateKey:
+		return &t.PublicKey, true
+	}
+	return nil, false
+}
+
+func asEd25519PublicKey(k any) (ed25519.PublicKey, bool) {
+	switch t := k.(type) {
+	case ed25519.PublicKey:
+		return t, true
+	case ed25519.PrivateKey:
+		return t.Public().(ed25519.PublicKey), true
+	}
+	return nil, false
+}
+
+func asRSAPrivateKey(k any) (*rsa.PrivateKey, bool) {
+	t, ok := k.(*rsa.PrivateKey)
+	return t, ok
+}
+
+// parseKeysOrSecret parses a JWK, JWKS or PEM encoded key set, and otherwise
+// treats data as a raw symmetric key.
+func parseKeysOrSecret(data []byte) ([]parsedKey, error) {
+	if isJSONDocument(data) {
+		return parseJWKs(data)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		return parsePEMKeys(data)
+	}
+	return []parsedKey{{key: data}}, nil
+}
+
+// symmetricKey returns either the raw bytes of key or, when key is a JWK or
+// JWKS document, the symmetric key it contains with the provided kid.
+func symmetricKey(key, kid string) ([]byte, error) {
+	if !isJSONDocument([]byte(key)) {
+		if kid != "" {
+			return nil, errors.New("a kid can only be specified when the key is a JWK or JWKS document")
+		}
+		return []byte(key), nil
+	}
+	keys, err := parseJWKs([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	_, k, err := selectKey(keys, kid, asSymmetricKey)
+	return k, err
+}
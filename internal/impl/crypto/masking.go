@@ -0,0 +1,187 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/hmac"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+func registerPseudonymizeMethod() error {
+	spec := bloblang.NewPluginSpec().
+		Category(encryptionCategory).
+		Description("Replaces a string or byte array with a deterministic pseudonym derived from an HMAC of the value. The same value and key always result in the same pseudonym, which allows datasets to be joined on pseudonymized fields without exposing the original values, but unlike encryption the original value cannot be recovered.").
+		Version("4.31.0").
+		Param(bloblang.NewStringParam("key").Description("The secret key of the HMAC, which can be loaded from a file with the `file` function. Pseudonyms can only be matched when created with the same key.")).
+		Param(bloblang.NewStringParam("algorithm").Description("The hash function used for the HMAC, one of `sha1`, `sha256`, `sha384` or `sha512`.").Default("sha256")).
+		Param(bloblang.NewStringParam("encoding").Description("The encoding of the pseudonym, one of `hex`, `base64url` or `base32`.").Default("hex")).
+		Param(bloblang.NewInt64Param("length").Description("The number of characters of the encoded pseudonym to keep, where zero keeps all of them. Shorter pseudonyms are more likely to collide.").Default(0)).
+		Param(bloblang.NewStringParam("prefix").Description("A prefix added to the pseudonym, which can be used to identify pseudonymized values.").Default("")).
+		Example("", `root.email = this.email.pseudonymize(key: "static-key", length: 16, prefix: "user_")`, [2]string{
+			`{"email":"alice@example.com"}`,
+			`{"email":"user_21279a177af4a10b"}`,
+		})
+
+	return bloblang.RegisterMethodV2("pseudonymize", spec, func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		key, err := args.GetString("key")
+		if err != nil {
+			return nil, err
+		}
+		algorithm, err := args.GetString("algorithm")
+		if err != nil {
+			return nil, err
+		}
+		encodingStr, err := args.GetString("encoding")
+		if err != nil {
+			return nil, err
+		}
+		length, err := args.GetInt64("length")
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := args.GetString("prefix")
+		if err != nil {
+			return nil, err
+		}
+
+		hashFn, err := getHashFunc(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, errors.New("length must not be negative")
+		}
+
+		var encode func([]byte) string
+		switch encodingStr {
+		case "hex":
+			encode = hex.EncodeToString
+		case "base64url":
+			encode = base64.RawURLEncoding.EncodeToString
+		case "base32":
+			encode = func(b []byte) string {
+				return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported encoding: %v", encodingStr)
+		}
+
+		return bloblang.BytesMethod(func(data []byte) (any, error) {
+			h := hmac.New(hashFn, []byte(key))
+			_, _ = h.Write(data)
+			pseudonym := encode(h.Sum(nil))
+			if length > 0 && int(length) < len(pseudonym) {
+				pseudonym = pseudonym[:length]
+			}
+			return prefix + pseudonym, nil
+		}), nil
+	})
+}
+
+func registerRedactMethod() error {
+	spec := bloblang.NewPluginSpec().
+		Category("String Manipulation").
+		Description("Replaces the characters of a string with a mask character, optionally keeping a number of characters at the start or end of the string visible.").
+		Version("4.31.0").
+		Param(bloblang.NewInt64Param("keep_start").Description("The number of characters at the start of the string to leave visible.").Default(0)).
+		Param(bloblang.NewInt64Param("keep_end").Description("The number of characters at the end of the string to leave visible.").Default(0)).
+		Param(bloblang.NewStringParam("mask").Description("The character used to replace redacted characters.").Default("*")).
+		Param(bloblang.NewBoolParam("keep_separators").Description("Whether characters other than letters and digits, such as the `-` of a card number or the `@` of an email address, are left in place. When enabled these characters are not counted by `keep_start` and `keep_end`.").Default(false)).
+		Example("", `root.card = this.card.redact(keep_end: 4, keep_separators: true)`, [2]string{
+			`{"card":"4111-1111-1111-1234"}`,
+			`{"card":"****-****-****-1234"}`,
+		}).
+		Example("", `root.email = this.email.redact(keep_start: 1, keep_separators: true)`, [2]string{
+			`{"email":"alice@example.com"}`,
+			`{"email":"a****@*******.***"}`,
+		}).
+		Example("", `root.name = this.name.redact(mask: "#")`, [2]string{
+			`{"name":"Alice"}`,
+			`{"name":"#####"}`,
+		})
+
+	return bloblang.RegisterMethodV2("redact", spec, func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+		keepStart, err := args.GetInt64("keep_start")
+		if err != nil {
+			return nil, err
+		}
+		keepEnd, err := args.GetInt64("keep_end")
+		if err != nil {
+			return nil, err
+		}
+		maskStr, err := args.GetString("mask")
+		if err != nil {
+			return nil, err
+		}
+		keepSeparators, err := args.GetBool("keep_separators")
+		if err != nil {
+			return nil, err
+		}
+
+		if keepStart < 0 || keepEnd < 0 {
+			return nil, errors.New("keep_start and keep_end must not be negative")
+		}
+		maskRunes := []rune(maskStr)
+		if len(maskRunes) != 1 {
+			return nil, errors.New("mask must be a single character")
+		}
+		mask := maskRunes[0]
+
+		isMaskable := func(r rune) bool {
+			return !keepSeparators || unicode.IsLetter(r) || unicode.IsDigit(r)
+		}
+
+		return bloblang.StringMethod(func(s string) (any, error) {
+			runes := []rune(s)
+
+			var total int64
+			for _, r := range runes {
+				if isMaskable(r) {
+					total++
+				}
+			}
+
+			var i int64
+			for j, r := range runes {
+				if !isMaskable(r) {
+					continue
+				}
+				if i >= keepStart && i < total-keepEnd {
+					runes[j] = mask
+				}
+				i++
+			}
+			return string(runes), nil
+		}), nil
+	})
+}
+
+func init() {
+	if err := registerPseudonymizeMethod(); err != nil {
+		panic(err)
+	}
+
+	if err := registerRedactMethod(); err != nil {
+		panic(err)
+	}
+}
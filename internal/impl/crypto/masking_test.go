@@ -0,0 +1,151 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+)
+
+func TestPseudonymize(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		mapping string
+		output  any
+		errStr  string
+	}{
+		{
+			name:    "hex",
+			mapping: `root = this.pseudonymize(key: "static-key")`,
+			output:  "21279a177af4a10bf6c589242eb8643bd5dd7bcf4f752ef309969fa5cc20c090",
+		},
+		{
+			name:    "length and prefix",
+			mapping: `root = this.pseudonymize(key: "static-key", length: 16, prefix: "user_")`,
+			output:  "user_21279a177af4a10b",
+		},
+		{
+			name:    "length exceeds pseudonym",
+			mapping: `root = this.pseudonymize(key: "static-key", algorithm: "sha1", length: 100).length()`,
+			output:  int64(40),
+		},
+		{
+			name:    "base64url",
+			mapping: `root = this.pseudonymize(key: "static-key", encoding: "base64url")`,
+			output:  "ISeaF3r0oQv2xYkkLrhkO9Xde89PdS7zCZafpcwgwJA",
+		},
+		{
+			name:    "base32",
+			mapping: `root = this.pseudonymize(key: "static-key", encoding: "base32")`,
+			output:  "eetzuf326sqqx5wfresc5odehpk5266pj52s54yjs2p2ltbaycia",
+		},
+		{
+			name:    "bad encoding",
+			mapping: `root = this.pseudonymize(key: "static-key", encoding: "base58")`,
+			errStr:  "unsupported encoding: base58",
+		},
+		{
+			name:    "bad algorithm",
+			mapping: `root = this.pseudonymize(key: "static-key", algorithm: "md4")`,
+			errStr:  "md4",
+		},
+		{
+			name:    "negative length",
+			mapping: `root = this.pseudonymize(key: "static-key", length: -1)`,
+			errStr:  "length must not be negative",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exe, err := bloblang.Parse(test.mapping)
+			if test.errStr != "" {
+				require.ErrorContains(t, err, test.errStr)
+				return
+			}
+			require.NoError(t, err)
+
+			res, err := exe.Query("alice@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, test.output, res)
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		mapping string
+		input   string
+		output  string
+	}{
+		{
+			name:    "defaults",
+			mapping: `root = this.redact()`,
+			input:   "secret",
+			output:  "******",
+		},
+		{
+			name:    "keep start and end",
+			mapping: `root = this.redact(keep_start: 2, keep_end: 2)`,
+			input:   "4111-1111",
+			output:  "41*****11",
+		},
+		{
+			name:    "keep separators",
+			mapping: `root = this.redact(keep_end: 4, keep_separators: true)`,
+			input:   "4111-1111-1111-1234",
+			output:  "****-****-****-1234",
+		},
+		{
+			name:    "overlapping keep",
+			mapping: `root = this.redact(keep_start: 4, keep_end: 4)`,
+			input:   "short",
+			output:  "short",
+		},
+		{
+			name:    "multi-byte characters",
+			mapping: `root = this.redact(keep_start: 1, mask: "•")`,
+			input:   "héllo",
+			output:  "h••••",
+		},
+		{
+			name:    "empty",
+			mapping: `root = this.redact(keep_end: 2)`,
+			input:   "",
+			output:  "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exe, err := bloblang.Parse(test.mapping)
+			require.NoError(t, err)
+
+			res, err := exe.Query(test.input)
+			require.NoError(t, err)
+			assert.Equal(t, test.output, res)
+		})
+	}
+
+	for _, mapping := range []string{
+		`root = this.redact(mask: "**")`,
+		`root = this.redact(mask: "")`,
+		`root = this.redact(keep_start: -1)`,
+	} {
+		_, err := bloblang.Parse(mapping)
+		require.Error(t, err, mapping)
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	ceFieldColumns          = "columns"
+	ceFieldHeader           = "header"
+	ceFieldDelimiter        = "delimiter"
+	ceFieldQuoting          = "quoting"
+	ceFieldNullValue        = "null_value"
+	ceFieldNested           = "nested"
+	ceFieldFlattenSeparator = "flatten_separator"
+	ceFieldCRLF             = "crlf"
+)
+
+func csvEncodeProcessorConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Parsing").
+		Summary("Encodes a batch of structured messages into a single CSV document.").
+		Description(`
+Each message of a batch must be an object, which is written as a row of the document, and the resulting document replaces the contents of the first message of the batch, with all other messages of the batch being dropped.
+
+The columns of the document are either specified explicitly with the field `+"`columns`"+`, in which case keys of messages that are not listed are ignored, or are inferred from the union of the keys of all messages of the batch, sorted alphabetically. Values that are missing or `+"`null`"+` are written using the `+"`null_value`"+`.
+
+Strings are written as they are, numbers and booleans are written in their canonical form, timestamps are written in RFC 3339 format, and nested objects and arrays are either written as JSON documents or flattened into multiple columns depending on the field `+"`nested`"+`.
+`).
+		Fields(
+			service.NewStringListField(ceFieldColumns).
+				Description("An explicit list of columns to write, in order. If empty the columns are inferred from the keys of the messages of each batch, sorted alphabetically. When `nested` is `flatten` the columns refer to the flattened keys.").
+				Example([]string{"id", "name", "address.city"}).
+				Default([]string{}),
+			service.NewBoolField(ceFieldHeader).
+				Description("Whether to write a header row containing the column names.").
+				Default(true),
+			service.NewStringField(ceFieldDelimiter).
+				Description("The delimiter to use for separating values, which must be a single character.").
+				Examples(",", "\t", ";", "|").
+				Default(","),
+			service.NewStringAnnotatedEnumField(ceFieldQuoting, map[string]string{
+				"minimal":     "Only values containing the delimiter, quotes or line breaks are quoted.",
+				"all":         "All values are quoted.",
+				"non_numeric": "All values are quoted except numbers.",
+				"none":        "Values are never quoted, and values containing the delimiter, quotes or line breaks result in an error.",
+			}).
+				Description("The policy for quoting values. Null values are never quoted, which allows them to be distinguished from empty strings when the policy is `all` or `non_numeric`.").
+				Default("minimal"),
+			service.NewStringField(ceFieldNullValue).
+				Description("The representation of missing and null values.").
+				Examples("", "NULL", `\N`).
+				Default(""),
+			service.NewStringAnnotatedEnumField(ceFieldNested, map[string]string{
+				"json":    "Nested objects and arrays are written as JSON documents.",
+				"flatten": "Nested objects and arrays are flattened into a column for each leaf value, named by joining the path of the value with the `flatten_separator`, where array elements are identified by their index.",
+			}).
+				Description("How nested objects and arrays are written.").
+				Default("json"),
+			service.NewStringField(ceFieldFlattenSeparator).
+				Description("The separator used for joining the path segments of flattened values.").
+				Advanced().
+				Default("."),
+			service.NewBoolField(ceFieldCRLF).
+				Description("Whether rows are terminated with `\\r\\n` rather than `\\n`.").
+				Advanced().
+				Default(false),
+		).
+		Version("4.31.0").
+		Example("Writing CSV Files to AWS S3",
+			"In this example we use the batching mechanism of an `aws_s3` output to collect a batch of messages in memory, which then converts it to a CSV document with a header row and uploads it.",
+			`
+output:
+  aws_s3:
+    bucket: TODO
+    path: 'stuff/${! timestamp_unix() }-${! uuid_v4() }.csv'
+    batching:
+      count: 1000
+      period: 10s
+      processors:
+        - csv_encode:
+            columns: [ id, name, address.city ]
+            nested: flatten
+`).
+		Example("Writing TSV Files",
+			"Columns are inferred from the messages, values are separated with tabs and nested values are written as JSON documents.",
+			`
+pipeline:
+  processors:
+    - csv_encode:
+        delimiter: "\t"
+        null_value: '\N'
+`)
+}
+
+func init() {
+	err := service.RegisterBatchProcessor(
+		"csv_encode", csvEncodeProcessorConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+			return newCSVEncodeProcessorFromConfig(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type csvEncodeProcessor struct {
+	columns          []string
+	header           bool
+	delimiter        rune
+	quoting          string
+	nullValue        string
+	flatten          bool
+	flattenSeparator string
+	lineEnding       string
+}
+
+func newCSVEncodeProcessorFromConfig(conf *service.ParsedConfig) (*csvEncodeProcessor, error) {
+	p := &csvEncodeProcessor{lineEnding: "\n"}
+
+	var err error
+	if p.columns, err = conf.FieldStringList(ceFieldColumns); err != nil {
+		return nil, err
+	}
+	if p.header, err = conf.FieldBool(ceFieldHeader); err != nil {
+		return nil, err
+	}
+
+	delimStr, err := conf.FieldString(ceFieldDelimiter)
+	if err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(delimStr) != 1 {
+		return nil, fmt.Errorf("delimiter must be a single character, got '%v'", delimStr)
+	}
+	p.delimiter, _ = utf8.DecodeRuneInString(delimStr)
+	if p.delimiter == '"' || p.delimiter == '\r' || p.delimiter == '\n' || p.delimiter == utf8.RuneError {
+		return nil, fmt.Errorf("invalid delimiter '%v'", delimStr)
+	}
+
+	if p.quoting, err = conf.FieldString(ceFieldQuoting); err != nil {
+		return nil, err
+	}
+	if p.nullValue, err = conf.FieldString(ceFieldNullValue); err != nil {
+		return nil, err
+	}
+
+	nestedStr, err := conf.FieldString(ceFieldNested)
+	if err != nil {
+		return nil, err
+	}
+	p.flatten = nestedStr == "flatten"
+	if p.flattenSeparator, err = conf.FieldString(ceFieldFlattenSeparator); err != nil {
+		return nil, err
+	}
+
+	crlf, err := conf.FieldBool(ceFieldCRLF)
+	if err != nil {
+		return nil, err
+	}
+	if crlf {
+		p.lineEnding = "\r\n"
+	}
+	return p, nil
+}
+
+// csvValue is a single cell of a row.
+type csvValue struct {
+	str     string
+	null    bool
+	numeric bool
+}
+
+func flattenInto(row map[string]any, prefix, sep string, v any) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			key := k
+			if prefix != "" {
+				key = prefix + sep + k
+			}
+			flattenInto(row, key, sep, e)
+		}
+	case []any:
+		for i, e := range t {
+			key := strconv.Itoa(i)
+			if prefix != "" {
+				key = prefix + sep + key
+			}
+			flattenInto(row, key, sep, e)
+		}
+	default:
+		row[prefix] = v
+	}
+}
+
+func (p *csvEncodeProcessor) formatValue(v any) (csvValue, error) {
+	switch t := v.(type) {
+	case nil:
+		return csvValue{str: p.nullValue, null: true}, nil
+	case string:
+		return csvValue{str: t}, nil
+	case []byte:
+		return csvValue{str: string(t)}, nil
+	case bool:
+		return csvValue{str: strconv.FormatBool(t)}, nil
+	case json.Number:
+		return csvValue{str: t.String(), numeric: true}, nil
+	case float64:
+		return csvValue{str: strconv.FormatFloat(t, 'f', -1, 64), numeric: true}, nil
+	case float32:
+		return csvValue{str: strconv.FormatFloat(float64(t), 'f', -1, 32), numeric: true}, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return csvValue{str: fmt.Sprintf("%d", t), numeric: true}, nil
+	case time.Time:
+		return csvValue{str: t.Format(time.RFC3339Nano)}, nil
+	}
+
+	jBytes, err := json.Marshal(v)
+	if err != nil {
+		return csvValue{}, err
+	}
+	return csvValue{str: string(jBytes)}, nil
+}
+
+func (p *csvEncodeProcessor) needsQuotes(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == ' ' || s[0] == '\t' {
+		return true
+	}
+	return strings.ContainsRune(s, p.delimiter) || strings.ContainsAny(s, "\"\r\n")
+}
+
+func (p *csvEncodeProcessor) writeRow(buf *bytes.Buffer, row []csvValue) error {
+	for i, v := range row {
+		if i > 0 {
+			buf.WriteRune(p.delimiter)
+		}
+
+		var quote bool
+		if !v.null {
+			switch p.quoting {
+			case "all":
+				quote = true
+			case "non_numeric":
+				quote = !v.numeric
+			case "none":
+				if strings.ContainsRune(v.str, p.delimiter) || strings.ContainsAny(v.str, "\"\r\n") {
+					return fmt.Errorf("value '%v' cannot be written without quotes", v.str)
+				}
+			default:
+				quote = p.needsQuotes(v.str)
+			}
+		}
+
+		if !quote {
+			buf.WriteString(v.str)
+			continue
+		}
+		buf.WriteByte('"')
+		buf.WriteString(strings.ReplaceAll(v.str, `"`, `""`))
+		buf.WriteByte('"')
+	}
+	buf.WriteString(p.lineEnding)
+	return nil
+}
+
+func (p *csvEncodeProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	rows := make([]map[string]any, len(batch))
+	for i, m := range batch {
+		ms, err := m.AsStructured()
+		if err != nil {
+			return nil, err
+		}
+
+		obj, isObj := ms.(map[string]any)
+		if !isObj {
+			return nil, fmt.Errorf("unable to encode message type %T as CSV row", ms)
+		}
+		if p.flatten {
+			flat := map[string]any{}
+			flattenInto(flat, "", p.flattenSeparator, obj)
+			obj = flat
+		}
+		rows[i] = obj
+	}
+
+	columns := p.columns
+	if len(columns) == 0 {
+		seen := map[string]struct{}{}
+		for _, row := range rows {
+			for k := range row {
+				if _, exists := seen[k]; !exists {
+					seen[k] = struct{}{}
+					columns = append(columns, k)
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("unable to infer columns as all messages are empty")
+	}
+
+	var buf bytes.Buffer
+	values := make([]csvValue, len(columns))
+	if p.header {
+		for i, c := range columns {
+			values[i] = csvValue{str: c}
+		}
+		if err := p.writeRow(&buf, values); err != nil {
+			return nil, fmt.Errorf("header: %w", err)
+		}
+	}
+
+	for i, row := range rows {
+		for j, c := range columns {
+			v, err := p.formatValue(row[c])
+			if err != nil {
+				return nil, fmt.Errorf("message %v column %v: %w", i, c, err)
+			}
+			values[j] = v
+		}
+		if err := p.writeRow(&buf, values); err != nil {
+			return nil, fmt.Errorf("message %v: %w", i, err)
+		}
+	}
+
+	outMsg := batch[0]
+	outMsg.SetBytes(buf.Bytes())
+	return []service.MessageBatch{{outMsg}}, nil
+}
+
+func (p *csvEncodeProcessor) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func TestCSVEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		input  []string
+		output string
+	}{
+		{
+			name:   "inferred columns",
+			config: ``,
+			input: []string{
+				`{"b":"foo","a":1}`,
+				`{"a":2.5,"c":true}`,
+			},
+			output: "a,b,c\n1,foo,\n2.5,,true\n",
+		},
+		{
+			name: "explicit columns without header",
+			config: `
+columns: [ c, a ]
+header: false
+`,
+			input: []string{
+				`{"a":1,"b":"ignored","c":"x"}`,
+				`{"a":null}`,
+			},
+			output: "x,1\n,\n",
+		},
+		{
+			name: "minimal quoting",
+			config: `
+columns: [ a, b ]
+`,
+			input: []string{
+				`{"a":"has,comma","b":"has \"quotes\""}`,
+				`{"a":"multi\nline","b":" leading space"}`,
+			},
+			output: "a,b\n\"has,comma\",\"has \"\"quotes\"\"\"\n\"multi\nline\",\" leading space\"\n",
+		},
+		{
+			name: "quote all with null value",
+			config: `
+quoting: all
+null_value: "NULL"
+`,
+			input: []string{
+				`{"a":1,"b":"foo","c":null}`,
+			},
+			output: "\"a\",\"b\",\"c\"\n\"1\",\"foo\",NULL\n",
+		},
+		{
+			name: "quote non numeric tsv",
+			config: `
+quoting: non_numeric
+delimiter: "\t"
+crlf: true
+`,
+			input: []string{
+				`{"a":1,"b":"foo","c":""}`,
+			},
+			output: "\"a\"\t\"b\"\t\"c\"\r\n1\t\"foo\"\t\"\"\r\n",
+		},
+		{
+			name:   "nested as json",
+			config: ``,
+			input: []string{
+				`{"id":1,"tags":["a","b"],"meta":{"x":1}}`,
+			},
+			output: "id,meta,tags\n1,\"{\"\"x\"\":1}\",\"[\"\"a\"\",\"\"b\"\"]\"\n",
+		},
+		{
+			name: "nested flattened",
+			config: `
+nested: flatten
+columns: [ id, meta.x, meta.y.z, tags.0, tags.1 ]
+`,
+			input: []string{
+				`{"id":1,"tags":["a","b"],"meta":{"x":1,"y":{"z":"deep"}}}`,
+				`{"id":2,"tags":["c"]}`,
+			},
+			output: "id,meta.x,meta.y.z,tags.0,tags.1\n1,1,deep,a,b\n2,,,c,\n",
+		},
+		{
+			name: "nested flattened inferred",
+			config: `
+nested: flatten
+flatten_separator: _
+`,
+			input: []string{
+				`{"a":{"b":1,"c":[true]}}`,
+			},
+			output: "a_b,a_c_0\n1,true\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			conf, err := csvEncodeProcessorConfig().ParseYAML(test.config, nil)
+			require.NoError(t, err)
+
+			proc, err := newCSVEncodeProcessorFromConfig(conf)
+			require.NoError(t, err)
+
+			var batch service.MessageBatch
+			for _, in := range test.input {
+				batch = append(batch, service.NewMessage([]byte(in)))
+			}
+
+			batches, err := proc.ProcessBatch(context.Background(), batch)
+			require.NoError(t, err)
+			require.Len(t, batches, 1)
+			require.Len(t, batches[0], 1)
+
+			mBytes, err := batches[0][0].AsBytes()
+			require.NoError(t, err)
+			assert.Equal(t, test.output, string(mBytes))
+		})
+	}
+}
+
+func TestCSVEncodeStructuredValues(t *testing.T) {
+	conf, err := csvEncodeProcessorConfig().ParseYAML(`columns: [ a, b, c, d ]`, nil)
+	require.NoError(t, err)
+
+	proc, err := newCSVEncodeProcessorFromConfig(conf)
+	require.NoError(t, err)
+
+	msg := service.NewMessage(nil)
+	msg.SetStructured(map[string]any{
+		"a": int64(10),
+		"b": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"c": []byte("raw"),
+		"d": 0.000001,
+	})
+
+	batches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{msg})
+	require.NoError(t, err)
+
+	mBytes, err := batches[0][0].AsBytes()
+	require.NoError(t, err)
+
+	// The output must be readable by a standard CSV reader.
+	records, err := csv.NewReader(strings.NewReader(string(mBytes))).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"a", "b", "c", "d"},
+		{"10", "2024-01-02T03:04:05Z", "raw", "0.000001"},
+	}, records)
+}
+
+func TestCSVEncodeErrors(t *testing.T) {
+	for _, test := range []struct {
+		config string
+		input  string
+		errStr string
+	}{
+		{config: `delimiter: ",,"`, errStr: "must be a single character"},
+		{config: `delimiter: '"'`, errStr: "invalid delimiter"},
+		{input: `["not","an","object"]`, errStr: "as CSV row"},
+		{input: `{}`, errStr: "unable to infer columns"},
+		{config: `quoting: none`, input: `{"a":"b,c"}`, errStr: "cannot be written without quotes"},
+	} {
+		conf, err := csvEncodeProcessorConfig().ParseYAML(test.config, nil)
+		require.NoError(t, err)
+
+		proc, err := newCSVEncodeProcessorFromConfig(conf)
+		if test.input == "" {
+			require.Error(t, err, test.config)
+			assert.Contains(t, err.Error(), test.errStr)
+			continue
+		}
+		require.NoError(t, err)
+
+		_, err = proc.ProcessBatch(context.Background(), service.MessageBatch{
+			service.NewMessage([]byte(test.input)),
+		})
+		require.Error(t, err, test.input)
+		assert.Contains(t, err.Error(), test.errStr)
+	}
+}
@@ -125,6 +125,37 @@ input:
 		)
 	})
 
+	t.Run("gcs_rolling", func(t *testing.T) {
+		template := `
+output:
+  gcp_cloud_storage:
+    bucket: $VAR1-$ID
+    path: $VAR2/${!count("$ID")}.txt
+    max_in_flight: 16
+    rolling:
+      enabled: true
+      max_count: 5
+      max_period: 500ms
+
+input:
+  gcp_cloud_storage:
+    bucket: $VAR1-$ID
+    prefix: $VAR2
+    scanner: { lines: {} }
+`
+		integration.StreamTests(
+			integration.StreamTestOpenCloseIsolated(),
+			integration.StreamTestStreamIsolated(10),
+		).Run(
+			t, template,
+			integration.StreamTestOptPreTest(func(t testing.TB, ctx context.Context, vars *integration.StreamTestConfigVars) {
+				require.NoError(t, createGCPCloudStorageBucket(vars.General["VAR1"], vars.ID))
+			}),
+			integration.StreamTestOptVarSet("VAR1", dummyBucketPrefix),
+			integration.StreamTestOptVarSet("VAR2", dummyPathPrefix),
+		)
+	})
+
 	t.Run("gcs_append", func(t *testing.T) {
 		template := `
 output:
@@ -27,6 +27,8 @@ import (
 	"go.uber.org/multierr"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/rolling"
 )
 
 const (
@@ -62,6 +64,7 @@ type csoConfig struct {
 	ChunkSize       int
 	CollisionMode   string
 	Timeout         time.Duration
+	Rolling         rolling.Config
 }
 
 func csoConfigFromParsed(pConf *service.ParsedConfig) (conf csoConfig, err error) {
@@ -86,6 +89,14 @@ func csoConfigFromParsed(pConf *service.ParsedConfig) (conf csoConfig, err error
 	if conf.Timeout, err = pConf.FieldDuration(csoFieldTimeout); err != nil {
 		return
 	}
+	if conf.Rolling, err = rolling.ConfigFromParsed(pConf); err != nil {
+		return
+	}
+	if conf.Rolling.Enabled &&
+		conf.CollisionMode != GCPCloudStorageOverwriteCollisionMode &&
+		conf.CollisionMode != GCPCloudStorageErrorIfExistsCollisionMode {
+		err = fmt.Errorf("collision mode %v is not supported with rolling files", conf.CollisionMode)
+	}
 	return
 }
 
@@ -139,7 +150,26 @@ output:
       processors:
         - archive:
             format: json_array
-`+"```"+``+service.OutputPerformanceDocs(true, true)).
+`+"```"+`
+
+== Rolling files
+
+Batching holds each window of messages in memory and uploads an object per batch, which doesn't scale well to large objects. When `+"`rolling.enabled`"+` is set messages are instead streamed into rolling files as resumable uploads. A file is committed once it reaches the configured size, message count or age, and messages are only acknowledged once the file they were written to has been committed. The `+"`path`"+` and other object attributes are resolved from the first message of each file, and `+"`rolling.partition_by`"+` can be used in order to write messages into separate files:
+
+`+"```yaml"+`
+output:
+  gcp_cloud_storage:
+    bucket: TODO
+    path: ${!meta("kafka_topic")}/${!timestamp_unix_nano()}.jsonl
+    max_in_flight: 256
+    rolling:
+      enabled: true
+      partition_by: ${!meta("kafka_topic")}
+      max_size: 134217728
+      max_period: 5m
+`+"```"+`
+
+Since the writes of messages are held until their file is committed all open files are committed whenever the number of pending writes reaches `+"`max_in_flight`"+`, which should therefore be increased in proportion to the expected number of batches written to each file. Only the `+"`overwrite`"+` and `+"`error-if-exists`"+` collision modes are supported with rolling files, and the `+"`timeout`"+` field does not apply to them.`+service.OutputPerformanceDocs(true, true)).
 		Fields(
 			service.NewStringField(csoFieldBucket).
 				Description("The bucket to upload messages to."),
@@ -177,6 +207,7 @@ output:
 			service.NewOutputMaxInFlightField().
 				Description("The maximum number of message batches to have in flight at a given time. Increase this to improve throughput."),
 			service.NewBatchPolicyField(csoFieldBatching),
+			rolling.ConfigField().Version("4.31.0"),
 		)
 }
 
@@ -195,7 +226,7 @@ func init() {
 				return
 			}
 
-			out, err = newGCPCloudStorageOutput(pConf, mgr)
+			out, err = newGCPCloudStorageOutput(pConf, maxInFlight, mgr)
 			return
 		})
 	if err != nil {
@@ -211,15 +242,20 @@ type gcpCloudStorageOutput struct {
 	client  *storage.Client
 	connMut sync.RWMutex
 
+	rolling *rolling.Writer
+
 	log *service.Logger
 }
 
 // newGCPCloudStorageOutput creates a new GCP Cloud Storage bucket writer.Type.
-func newGCPCloudStorageOutput(conf csoConfig, res *service.Resources) (*gcpCloudStorageOutput, error) {
+func newGCPCloudStorageOutput(conf csoConfig, maxInFlight int, res *service.Resources) (*gcpCloudStorageOutput, error) {
 	g := &gcpCloudStorageOutput{
 		conf: conf,
 		log:  res.Logger(),
 	}
+	if conf.Rolling.Enabled {
+		g.rolling = rolling.NewWriter(conf.Rolling, maxInFlight, g.openRollingObject, g.log)
+	}
 	return g, nil
 }
 
@@ -246,6 +282,10 @@ func (g *gcpCloudStorageOutput) WriteBatch(ctx context.Context, batch service.Me
 		return service.ErrNotConnected
 	}
 
+	if g.rolling != nil {
+		return g.rolling.WriteBatch(ctx, batch)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, g.conf.Timeout)
 	defer cancel()
 
@@ -338,14 +378,62 @@ func (g *gcpCloudStorageOutput) WriteBatch(ctx context.Context, batch service.Me
 	})
 }
 
+// openRollingObject opens a writer for a rolling file, where the object is
+// only created once the writer is closed.
+func (g *gcpCloudStorageOutput) openRollingObject(ctx context.Context, batch service.MessageBatch, i int) (rolling.ObjectWriter, error) {
+	g.connMut.RLock()
+	client := g.client
+	g.connMut.RUnlock()
+
+	if client == nil {
+		return nil, service.ErrNotConnected
+	}
+
+	msg := batch[i]
+	outputPath, err := g.conf.Path.TryString(msg)
+	if err != nil {
+		return nil, fmt.Errorf("path interpolation error: %w", err)
+	}
+
+	obj := client.Bucket(g.conf.Bucket).Object(outputPath)
+	if g.conf.CollisionMode == GCPCloudStorageErrorIfExistsCollisionMode {
+		obj = obj.If(storage.Conditions{DoesNotExist: true})
+	}
+
+	// Cancelling the context of a writer is the only way to abort an upload.
+	ctx, cancel := context.WithCancel(ctx)
+
+	w := obj.NewWriter(ctx)
+	w.ChunkSize = g.conf.ChunkSize
+	if w.ContentType, err = g.conf.ContentType.TryString(msg); err != nil {
+		cancel()
+		return nil, fmt.Errorf("content type interpolation error: %w", err)
+	}
+	if w.ContentEncoding, err = g.conf.ContentEncoding.TryString(msg); err != nil {
+		cancel()
+		return nil, fmt.Errorf("content encoding interpolation error: %w", err)
+	}
+	w.Metadata = map[string]string{}
+	_ = msg.MetaWalk(func(k, v string) error {
+		w.Metadata[k] = v
+		return nil
+	})
+
+	return &gcpCloudStorageRollingObject{w: w, cancel: cancel}, nil
+}
+
 // Close begins cleaning up resources used by this reader asynchronously.
-func (g *gcpCloudStorageOutput) Close(context.Context) error {
+func (g *gcpCloudStorageOutput) Close(ctx context.Context) error {
+	var err error
+	if g.rolling != nil {
+		err = g.rolling.Close(ctx)
+	}
+
 	g.connMut.Lock()
 	defer g.connMut.Unlock()
 
-	var err error
 	if g.client != nil {
-		err = g.client.Close()
+		err = multierr.Append(err, g.client.Close())
 		g.client = nil
 	}
 	return err
@@ -364,3 +452,25 @@ func (g *gcpCloudStorageOutput) removeTempFile(ctx context.Context, src *storage
 		g.log.Errorf("Failed to delete temporary file used for merging: %v", err)
 	}
 }
+
+//------------------------------------------------------------------------------
+
+type gcpCloudStorageRollingObject struct {
+	w      *storage.Writer
+	cancel func()
+}
+
+func (o *gcpCloudStorageRollingObject) Write(p []byte) (int, error) {
+	return o.w.Write(p)
+}
+
+func (o *gcpCloudStorageRollingObject) Commit(context.Context) error {
+	defer o.cancel()
+	return o.w.Close()
+}
+
+func (o *gcpCloudStorageRollingObject) Abort(context.Context) error {
+	o.cancel()
+	_ = o.w.Close()
+	return nil
+}
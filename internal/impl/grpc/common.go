@@ -0,0 +1,94 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// parseMethodName splits a method name of the form `package.Service/Method`,
+// `/package.Service/Method` or `package.Service.Method` into the fully
+// qualified service name and the method name.
+func parseMethodName(name string) (service, method string, err error) {
+	name = strings.TrimPrefix(name, "/")
+	if i := strings.LastIndex(name, "/"); i > 0 {
+		service, method = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, "."); i > 0 {
+		service, method = name[:i], name[i+1:]
+	}
+	if service == "" || method == "" {
+		return "", "", fmt.Errorf("method name '%v' must be of the form package.Service/Method", name)
+	}
+	return service, method, nil
+}
+
+// findMethod resolves a method descriptor from a registry of files.
+func findMethod(files *protoregistry.Files, serviceName, methodName string) (protoreflect.MethodDescriptor, error) {
+	sd, err := findService(files, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	md := sd.Methods().ByName(protoreflect.Name(methodName))
+	if md == nil {
+		return nil, fmt.Errorf("method '%v' not found within service '%v'", methodName, serviceName)
+	}
+	return md, nil
+}
+
+func findService(files *protoregistry.Files, serviceName string) (protoreflect.ServiceDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find service '%v' definition within the loaded schemas", serviceName)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("descriptor %v was unexpected type %T", serviceName, d)
+	}
+	return sd, nil
+}
+
+// fullMethodName returns the HTTP/2 path of a method.
+func fullMethodName(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+// fallbackResolver resolves descriptors from a primary registry and falls back
+// to a secondary one, which allows the reflection API to describe services
+// that are not part of the loaded schemas (such as the reflection service
+// itself).
+type fallbackResolver struct {
+	primary, secondary protodesc.Resolver
+}
+
+func (f fallbackResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	fd, err := f.primary.FindFileByPath(path)
+	if err != nil {
+		return f.secondary.FindFileByPath(path)
+	}
+	return fd, nil
+}
+
+func (f fallbackResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	d, err := f.primary.FindDescriptorByName(name)
+	if err != nil {
+		return f.secondary.FindDescriptorByName(name)
+	}
+	return d, nil
+}
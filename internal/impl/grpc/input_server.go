@@ -0,0 +1,434 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/shutdown"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/protobuf"
+)
+
+const (
+	gsiFieldAddress       = "address"
+	gsiFieldServices      = "services"
+	gsiFieldReflection    = "reflection"
+	gsiFieldCertFile      = "cert_file"
+	gsiFieldKeyFile       = "key_file"
+	gsiFieldTimeout       = "timeout"
+	gsiFieldUseProtoNames = "use_proto_names"
+)
+
+func grpcServerInputSpec() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Network").
+		Version("4.31.0").
+		Summary("Receive messages as requests to a gRPC server, where the services served are described by protobuf schemas loaded at runtime.").
+		Description(`
+The methods of the configured services are served without any generated code, each request received is converted into a JSON document using the https://protobuf.dev/programming-guides/proto3/#json[canonical protobuf JSON mapping^] and emitted as a message.
+
+Unary methods emit a batch containing a single message. Client streaming methods emit a batch containing all messages sent by the client once the client closes the stream. Server streaming and bidirectional streaming methods are not supported and result in an `+"`UNIMPLEMENTED`"+` status.
+
+== Responses
+
+It's possible to return a response for each request by using xref:guides:sync_responses.adoc[synchronous responses]. The first message of the synchronous response is parsed as a JSON document and converted into the response message of the method. When no synchronous response is provided an empty response message is returned.
+
+When a message is rejected (nacked) by the pipeline the request is responded to with an `+"`INTERNAL`"+` status containing the error, and when no acknowledgement is received within the configured `+"`timeout`"+` a `+"`DEADLINE_EXCEEDED`"+` status is returned.
+
+== Metadata
+
+This input adds the following metadata fields to each message:
+
+`+"```text"+`
+- grpc_method
+- All request metadata (excluding binary values)
+`+"```"+`
+
+You can access these metadata fields using xref:configuration:interpolation.adoc#bloblang-queries[function interpolation].
+`).
+		Fields(
+			service.NewStringField(gsiFieldAddress).
+				Description("The address to listen on.").
+				Default("0.0.0.0:50051"),
+			service.NewStringListField(gsiFieldServices).
+				Description("A list of fully qualified names of the services to serve. If empty all services found within the loaded schemas are served.").
+				Example([]string{"helloworld.Greeter"}).
+				Default([]string{}),
+		).
+		Fields(protobuf.DescriptorFields()...).
+		Fields(
+			service.NewBoolField(gsiFieldReflection).
+				Description("Whether to enable the https://grpc.io/docs/guides/reflection/[gRPC server reflection^] service, which allows clients to discover the served services and their schemas.").
+				Default(false),
+			service.NewStringField(gsiFieldCertFile).
+				Description("An optional certificate file for enabling TLS.").
+				Advanced().
+				Default(""),
+			service.NewStringField(gsiFieldKeyFile).
+				Description("An optional key file for enabling TLS.").
+				Advanced().
+				Default(""),
+			service.NewDurationField(gsiFieldTimeout).
+				Description("The maximum period of time to wait for a request to be acknowledged before responding with a `DEADLINE_EXCEEDED` status.").
+				Advanced().
+				Default("5s"),
+			service.NewBoolField(gsiFieldUseProtoNames).
+				Description("Whether request fields are converted to JSON using the field names exactly as defined in the schema rather than their lowerCamelCase JSON names.").
+				Advanced().
+				Default(false),
+		).
+		Example("Greeter Service", "Serve the methods of a service defined in a local directory of .proto files, and respond to each request with a greeting.", `
+input:
+  grpc_server:
+    address: 0.0.0.0:50051
+    services: [ helloworld.Greeter ]
+    import_paths: [ ./protos ]
+    reflection: true
+
+pipeline:
+  processors:
+    - mapping: 'root.message = "Hello " + this.name'
+    - sync_response: {}
+`)
+}
+
+func init() {
+	err := service.RegisterBatchInput("grpc_server", grpcServerInputSpec(), func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+		return newGRPCServerInputFromParsed(conf, mgr)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type serverRequest struct {
+	batch   service.MessageBatch
+	stores  []*service.SyncResponseStore
+	resChan chan error
+}
+
+type grpcServerInput struct {
+	address    string
+	certFile   string
+	keyFile    string
+	timeout    time.Duration
+	reflection bool
+
+	files    *protoregistry.Files
+	types    *protoregistry.Types
+	services []protoreflect.ServiceDescriptor
+
+	marshaller   protojson.MarshalOptions
+	unmarshaller protojson.UnmarshalOptions
+
+	log     *service.Logger
+	shutSig *shutdown.Signaller
+
+	requests chan serverRequest
+
+	mut      sync.Mutex
+	server   *grpc.Server
+	listener net.Listener
+}
+
+func newGRPCServerInputFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (*grpcServerInput, error) {
+	g := &grpcServerInput{
+		log:      mgr.Logger(),
+		shutSig:  shutdown.NewSignaller(),
+		requests: make(chan serverRequest),
+	}
+
+	var err error
+	if g.address, err = conf.FieldString(gsiFieldAddress); err != nil {
+		return nil, err
+	}
+	if g.certFile, err = conf.FieldString(gsiFieldCertFile); err != nil {
+		return nil, err
+	}
+	if g.keyFile, err = conf.FieldString(gsiFieldKeyFile); err != nil {
+		return nil, err
+	}
+	if (g.certFile == "") != (g.keyFile == "") {
+		return nil, errors.New("both the cert_file and key_file fields must be specified in order to enable TLS")
+	}
+	if g.timeout, err = conf.FieldDuration(gsiFieldTimeout); err != nil {
+		return nil, err
+	}
+	if g.reflection, err = conf.FieldBool(gsiFieldReflection); err != nil {
+		return nil, err
+	}
+
+	var useProtoNames bool
+	if useProtoNames, err = conf.FieldBool(gsiFieldUseProtoNames); err != nil {
+		return nil, err
+	}
+
+	if g.files, g.types, err = protobuf.LoadDescriptors(context.Background(), conf, mgr); err != nil {
+		return nil, err
+	}
+	g.marshaller = protojson.MarshalOptions{Resolver: g.types, UseProtoNames: useProtoNames}
+	g.unmarshaller = protojson.UnmarshalOptions{Resolver: g.types}
+
+	serviceNames, err := conf.FieldStringList(gsiFieldServices)
+	if err != nil {
+		return nil, err
+	}
+	if len(serviceNames) == 0 {
+		g.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+			for i := 0; i < fd.Services().Len(); i++ {
+				g.services = append(g.services, fd.Services().Get(i))
+			}
+			return true
+		})
+	}
+	for _, name := range serviceNames {
+		sd, err := findService(g.files, name)
+		if err != nil {
+			return nil, err
+		}
+		g.services = append(g.services, sd)
+	}
+	if len(g.services) == 0 {
+		return nil, errors.New("no services were found within the loaded schemas")
+	}
+	return g, nil
+}
+
+func (g *grpcServerInput) serviceDesc(sd protoreflect.ServiceDescriptor) *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: string(sd.FullName()),
+		HandlerType: (*any)(nil),
+		Metadata:    sd.ParentFile().Path(),
+	}
+	for i := 0; i < sd.Methods().Len(); i++ {
+		md := sd.Methods().Get(i)
+		if md.IsStreamingServer() {
+			g.log.Warnf("Server streaming method %v is not supported and will not be served", md.FullName())
+			continue
+		}
+		// Unary methods are served as streams, which is indistinguishable
+		// from a unary handler at the protocol level.
+		desc.Streams = append(desc.Streams, grpc.StreamDesc{
+			StreamName: string(md.Name()),
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				return g.handleStream(md, stream)
+			},
+			ClientStreams: md.IsStreamingClient(),
+		})
+	}
+	return desc
+}
+
+func (g *grpcServerInput) requestToMessage(ctx context.Context, md protoreflect.MethodDescriptor, req *dynamicpb.Message) (*service.Message, error) {
+	jBytes, err := g.marshaller.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := service.NewMessage(jBytes)
+	msg.MetaSetMut("grpc_method", fullMethodName(md))
+	if reqMeta, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, v := range reqMeta {
+			if strings.HasSuffix(k, "-bin") || len(v) == 0 {
+				continue
+			}
+			msg.MetaSetMut(k, strings.Join(v, ","))
+		}
+	}
+	return msg, nil
+}
+
+func (g *grpcServerInput) handleStream(md protoreflect.MethodDescriptor, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+
+	var req serverRequest
+	for {
+		reqMsg := dynamicpb.NewMessage(md.Input())
+		if err := stream.RecvMsg(reqMsg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		msg, err := g.requestToMessage(ctx, md, reqMsg)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to convert request: %v", err)
+		}
+
+		msg, store := msg.WithSyncResponseStore()
+		req.batch = append(req.batch, msg)
+		req.stores = append(req.stores, store)
+
+		if !md.IsStreamingClient() {
+			break
+		}
+	}
+
+	if len(req.batch) > 0 {
+		req.resChan = make(chan error, 1)
+
+		timeoutCtx, done := context.WithTimeout(ctx, g.timeout)
+		defer done()
+
+		select {
+		case g.requests <- req:
+		case <-timeoutCtx.Done():
+			return status.Error(codes.DeadlineExceeded, "request timed out")
+		case <-g.shutSig.SoftStopChan():
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+
+		select {
+		case err := <-req.resChan:
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+		case <-timeoutCtx.Done():
+			return status.Error(codes.DeadlineExceeded, "request timed out")
+		case <-g.shutSig.SoftStopChan():
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+
+	res := dynamicpb.NewMessage(md.Output())
+	for _, store := range req.stores {
+		resBatches := store.Read()
+		if len(resBatches) == 0 || len(resBatches[0]) == 0 {
+			continue
+		}
+		resBytes, err := resBatches[0][0].AsBytes()
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read response: %v", err)
+		}
+		if err := g.unmarshaller.Unmarshal(resBytes, res); err != nil {
+			return status.Errorf(codes.Internal, "failed to convert response: %v", err)
+		}
+		break
+	}
+	return stream.SendMsg(res)
+}
+
+func (g *grpcServerInput) Connect(ctx context.Context) error {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	if g.server != nil {
+		return nil
+	}
+
+	var opts []grpc.ServerOption
+	if g.certFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(g.certFile, g.keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	server := grpc.NewServer(opts...)
+	for _, sd := range g.services {
+		server.RegisterService(g.serviceDesc(sd), g)
+	}
+
+	if g.reflection {
+		reflOpts := reflection.ServerOptions{
+			Services: server,
+			DescriptorResolver: fallbackResolver{
+				primary:   g.files,
+				secondary: protoregistry.GlobalFiles,
+			},
+			ExtensionResolver: g.types,
+		}
+		reflectionv1.RegisterServerReflectionServer(server, reflection.NewServerV1(reflOpts))
+		reflectionv1alpha.RegisterServerReflectionServer(server, reflection.NewServer(reflOpts))
+	}
+
+	listener, err := net.Listen("tcp", g.address)
+	if err != nil {
+		return err
+	}
+
+	g.server, g.listener = server, listener
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			g.log.Errorf("Server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (g *grpcServerInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	select {
+	case req := <-g.requests:
+		return req.batch, func(ctx context.Context, err error) error {
+			req.resChan <- err
+			return nil
+		}, nil
+	case <-g.shutSig.SoftStopChan():
+		return nil, nil, service.ErrEndOfInput
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (g *grpcServerInput) Close(ctx context.Context) error {
+	g.shutSig.TriggerSoftStop()
+
+	g.mut.Lock()
+	server := g.server
+	g.server = nil
+	g.mut.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+	return nil
+}
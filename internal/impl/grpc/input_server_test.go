@@ -0,0 +1,359 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const testGreeterProto = `
+syntax = "proto3";
+package testing;
+
+import "google/protobuf/timestamp.proto";
+
+message HelloRequest {
+  string name = 1;
+  google.protobuf.Timestamp sent_at = 2;
+}
+
+message HelloReply {
+  string message = 1;
+  int32 count = 2;
+}
+
+service Greeter {
+  rpc SayHello (HelloRequest) returns (HelloReply);
+  rpc SayHelloToAll (stream HelloRequest) returns (HelloReply);
+  rpc SayHellos (HelloRequest) returns (stream HelloReply);
+}
+`
+
+func testProtoDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "greeter.proto"), []byte(testGreeterProto), 0o644))
+	return dir
+}
+
+func testServerInput(t *testing.T, confStr string) (*grpcServerInput, string) {
+	t.Helper()
+
+	conf, err := grpcServerInputSpec().ParseYAML(confStr, nil)
+	require.NoError(t, err)
+
+	input, err := newGRPCServerInputFromParsed(conf, service.MockResources())
+	require.NoError(t, err)
+	require.NoError(t, input.Connect(context.Background()))
+	t.Cleanup(func() {
+		ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+		defer done()
+		require.NoError(t, input.Close(ctx))
+	})
+	return input, input.listener.Addr().String()
+}
+
+func testClientProc(t *testing.T, confStr string) *grpcClientProcessor {
+	t.Helper()
+
+	conf, err := grpcClientProcessorSpec().ParseYAML(confStr, nil)
+	require.NoError(t, err)
+
+	proc, err := newGRPCClientProcessorFromParsed(conf, service.MockResources())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = proc.Close(context.Background())
+	})
+	return proc
+}
+
+// respondWith reads a batch from the input and responds to it with the
+// result of a function, or nacks it when the function returns an error.
+func respondWith(t *testing.T, input *grpcServerInput, fn func(batch service.MessageBatch) (string, error)) {
+	t.Helper()
+
+	go func() {
+		ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+		defer done()
+
+		batch, ackFn, err := input.ReadBatch(ctx)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		res, err := fn(batch)
+		if err == nil && res != "" {
+			resMsg := batch[0].Copy()
+			resMsg.SetBytes([]byte(res))
+			assert.NoError(t, service.MessageBatch{resMsg}.AddSyncResponse())
+		}
+		assert.NoError(t, ackFn(ctx, err))
+	}()
+}
+
+func TestGRPCServerClientUnary(t *testing.T) {
+	protoDir := testProtoDir(t)
+
+	input, addr := testServerInput(t, fmt.Sprintf(`
+address: 127.0.0.1:0
+import_paths: [ %v ]
+`, protoDir))
+
+	proc := testClientProc(t, fmt.Sprintf(`
+address: %v
+method: testing.Greeter/SayHello
+import_paths: [ %v ]
+metadata:
+  x-name: ${! this.name }
+`, addr, protoDir))
+
+	respondWith(t, input, func(batch service.MessageBatch) (string, error) {
+		assert.Len(t, batch, 1)
+
+		mBytes, err := batch[0].AsBytes()
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":"foo","sentAt":"2024-01-02T03:04:05Z"}`, string(mBytes))
+
+		method, _ := batch[0].MetaGet("grpc_method")
+		assert.Equal(t, "/testing.Greeter/SayHello", method)
+
+		xName, _ := batch[0].MetaGet("x-name")
+		assert.Equal(t, "foo", xName)
+
+		return `{"message":"hello foo","count":1}`, nil
+	})
+
+	inMsg := service.NewMessage([]byte(`{"name":"foo","sentAt":"2024-01-02T03:04:05Z"}`))
+	inMsg.MetaSetMut("keep", "me")
+
+	batches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{inMsg})
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+	require.NoError(t, batches[0][0].GetError())
+
+	mBytes, err := batches[0][0].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"message":"hello foo","count":1}`, string(mBytes))
+
+	keep, _ := batches[0][0].MetaGet("keep")
+	assert.Equal(t, "me", keep)
+}
+
+func TestGRPCServerClientNack(t *testing.T) {
+	protoDir := testProtoDir(t)
+
+	input, addr := testServerInput(t, fmt.Sprintf(`
+address: 127.0.0.1:0
+services: [ testing.Greeter ]
+import_paths: [ %v ]
+`, protoDir))
+
+	proc := testClientProc(t, fmt.Sprintf(`
+address: %v
+method: /testing.Greeter/SayHello
+import_paths: [ %v ]
+`, addr, protoDir))
+
+	respondWith(t, input, func(batch service.MessageBatch) (string, error) {
+		return "", fmt.Errorf("nope")
+	})
+
+	batches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"name":"foo"}`)),
+	})
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+
+	mErr := batches[0][0].GetError()
+	require.Error(t, mErr)
+	assert.Equal(t, codes.Internal, status.Code(mErr))
+	assert.Contains(t, mErr.Error(), "nope")
+
+	code, _ := batches[0][0].MetaGet("grpc_status")
+	assert.Equal(t, codes.Internal.String(), code)
+
+	// Server streaming methods aren't served.
+	streamProc := testClientProc(t, fmt.Sprintf(`
+address: %v
+method: testing.Greeter.SayHellos
+import_paths: [ %v ]
+`, addr, protoDir))
+
+	batches, err = streamProc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"name":"foo"}`)),
+	})
+	require.NoError(t, err)
+	require.Len(t, batches[0], 1)
+	assert.Equal(t, codes.Unimplemented, status.Code(batches[0][0].GetError()))
+}
+
+func TestGRPCServerClientStreamingReflection(t *testing.T) {
+	protoDir := testProtoDir(t)
+
+	input, addr := testServerInput(t, fmt.Sprintf(`
+address: 127.0.0.1:0
+import_paths: [ %v ]
+reflection: true
+`, protoDir))
+
+	proc := testClientProc(t, fmt.Sprintf(`
+address: %v
+method: testing.Greeter/SayHelloToAll
+reflection: true
+`, addr))
+
+	respondWith(t, input, func(batch service.MessageBatch) (string, error) {
+		assert.Len(t, batch, 3)
+		var names string
+		for _, m := range batch {
+			mBytes, err := m.AsBytes()
+			assert.NoError(t, err)
+			names += string(mBytes)
+		}
+		assert.Equal(t, `{"name":"a"}{"name":"b"}{"name":"c"}`, names)
+		return fmt.Sprintf(`{"message":"hello all","count":%v}`, len(batch)), nil
+	})
+
+	batches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"name":"a"}`)),
+		service.NewMessage([]byte(`{"name":"b"}`)),
+		service.NewMessage([]byte(`{"name":"c"}`)),
+	})
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+	require.NoError(t, batches[0][0].GetError())
+
+	mBytes, err := batches[0][0].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"message":"hello all","count":3}`, string(mBytes))
+}
+
+func TestGRPCServerNoSyncResponse(t *testing.T) {
+	protoDir := testProtoDir(t)
+
+	input, addr := testServerInput(t, fmt.Sprintf(`
+address: 127.0.0.1:0
+import_paths: [ %v ]
+`, protoDir))
+
+	proc := testClientProc(t, fmt.Sprintf(`
+address: %v
+method: testing.Greeter/SayHello
+import_paths: [ %v ]
+`, addr, protoDir))
+
+	respondWith(t, input, func(batch service.MessageBatch) (string, error) {
+		return "", nil
+	})
+
+	batches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"name":"foo"}`)),
+	})
+	require.NoError(t, err)
+	require.Len(t, batches[0], 1)
+	require.NoError(t, batches[0][0].GetError())
+
+	mBytes, err := batches[0][0].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(mBytes))
+}
+
+func TestGRPCClientNoResponse(t *testing.T) {
+	protoDir := testProtoDir(t)
+
+	// A server that completes every call without sending a response.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(any, grpc.ServerStream) error {
+		return nil
+	}))
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	for _, method := range []string{"SayHello", "SayHelloToAll", "SayHellos"} {
+		proc := testClientProc(t, fmt.Sprintf(`
+address: %v
+method: testing.Greeter/%v
+import_paths: [ %v ]
+`, lis.Addr().String(), method, protoDir))
+
+		batches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+			service.NewMessage([]byte(`{"name":"foo"}`)),
+		})
+		require.NoError(t, err, method)
+		require.Len(t, batches, 1, method)
+		require.Len(t, batches[0], 1, method)
+		require.Error(t, batches[0][0].GetError(), method)
+
+		mBytes, err := batches[0][0].AsBytes()
+		require.NoError(t, err, method)
+		assert.Equal(t, `{"name":"foo"}`, string(mBytes), method)
+	}
+}
+
+func TestGRPCConfigErrors(t *testing.T) {
+	protoDir := testProtoDir(t)
+
+	conf, err := grpcServerInputSpec().ParseYAML(fmt.Sprintf(`
+import_paths: [ %v ]
+services: [ testing.Nope ]
+`, protoDir), nil)
+	require.NoError(t, err)
+
+	_, err = newGRPCServerInputFromParsed(conf, service.MockResources())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to find service 'testing.Nope'")
+
+	for _, test := range []struct {
+		conf    string
+		errCont string
+	}{
+		{
+			conf:    `{ address: localhost:1234, method: nope }`,
+			errCont: "must be of the form",
+		},
+		{
+			conf:    fmt.Sprintf(`{ address: localhost:1234, method: testing.Greeter/Nope, import_paths: [ %v ] }`, protoDir),
+			errCont: "method 'Nope' not found within service 'testing.Greeter'",
+		},
+	} {
+		conf, err := grpcClientProcessorSpec().ParseYAML(test.conf, nil)
+		require.NoError(t, err)
+
+		_, err = newGRPCClientProcessorFromParsed(conf, service.MockResources())
+		require.Error(t, err, test.conf)
+		assert.Contains(t, err.Error(), test.errCont, test.conf)
+	}
+}
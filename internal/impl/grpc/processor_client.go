@@ -0,0 +1,420 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/protobuf"
+)
+
+const (
+	gcpFieldAddress        = "address"
+	gcpFieldMethod         = "method"
+	gcpFieldReflection     = "reflection"
+	gcpFieldTLS            = "tls"
+	gcpFieldMetadata       = "metadata"
+	gcpFieldTimeout        = "timeout"
+	gcpFieldDiscardUnknown = "discard_unknown"
+	gcpFieldUseProtoNames  = "use_proto_names"
+)
+
+func grpcClientProcessorSpec() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Integration").
+		Version("4.31.0").
+		Summary("Invokes a method of a gRPC service for each message, where the method is described by protobuf schemas loaded at runtime or obtained from the server via reflection.").
+		Description(`
+Messages are parsed as JSON documents and converted into the request message of the method using the https://protobuf.dev/programming-guides/proto3/#json[canonical protobuf JSON mapping^], the response of the method replaces the contents of the message in the same JSON form.
+
+The behaviour of the processor depends on the type of the method:
+
+- Unary methods are invoked once for each message of a batch.
+- Client streaming methods are invoked once for each batch, with each message sent as a request of the stream, and the batch is replaced with a single message containing the response.
+- Server streaming methods are invoked once for each message of a batch, and the message is replaced with one message for each response received.
+
+When an invocation completes without any response the affected messages are flagged with an error rather than dropped.
+
+Bidirectional streaming methods are not supported.
+
+== Schemas
+
+The schema of the method can either be loaded from any of the supported schema sources, or obtained from the server itself when `+"`reflection`"+` is enabled, in which case the https://grpc.io/docs/guides/reflection/[gRPC server reflection^] service of the server is queried the first time the method is invoked.
+
+== Error Handling
+
+When a method invocation fails the error is added to the affected messages, and they continue through the pipeline unchanged so that they can be handled using xref:configuration:error_handling.adoc[error handling patterns]. The gRPC status code of the error is added to the metadata field `+"`grpc_status`"+`.
+`).
+		Fields(
+			service.NewStringField(gcpFieldAddress).
+				Description("The address of the gRPC server.").
+				Example("localhost:50051"),
+			service.NewStringField(gcpFieldMethod).
+				Description("The fully qualified name of the method to invoke, in the form `package.Service/Method`.").
+				Example("helloworld.Greeter/SayHello"),
+			service.NewBoolField(gcpFieldReflection).
+				Description("Whether to obtain the schema of the method from the server using the gRPC server reflection service rather than the configured schema sources.").
+				Default(false),
+		).
+		Fields(protobuf.DescriptorFields()...).
+		Fields(
+			service.NewTLSToggledField(gcpFieldTLS),
+			service.NewInterpolatedStringMapField(gcpFieldMetadata).
+				Description("A map of metadata to add to each request.").
+				Example(map[string]any{"authorization": `Bearer ${! env("API_TOKEN") }`}).
+				Default(map[string]any{}),
+			service.NewDurationField(gcpFieldTimeout).
+				Description("The maximum period of time to wait for an invocation to complete.").
+				Default("5s"),
+			service.NewBoolField(gcpFieldDiscardUnknown).
+				Description("Whether fields of messages that are unknown to the request schema are discarded rather than resulting in an error.").
+				Advanced().
+				Default(false),
+			service.NewBoolField(gcpFieldUseProtoNames).
+				Description("Whether response fields are converted to JSON using the field names exactly as defined in the schema rather than their lowerCamelCase JSON names.").
+				Advanced().
+				Default(false),
+		).
+		Example("Reflection", "Invoke a method of a server that supports reflection, and store the response within a field of the original message.", `
+pipeline:
+  processors:
+    - branch:
+        request_map: 'root.name = this.user.name'
+        processors:
+          - grpc_client:
+              address: localhost:50051
+              method: helloworld.Greeter/SayHello
+              reflection: true
+        result_map: 'root.greeting = this.message'
+`)
+}
+
+func init() {
+	err := service.RegisterBatchProcessor("grpc_client", grpcClientProcessorSpec(), func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+		return newGRPCClientProcessorFromParsed(conf, mgr)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type grpcClientProcessor struct {
+	serviceName string
+	methodName  string
+	reflection  bool
+	metadata    map[string]*service.InterpolatedString
+	timeout     time.Duration
+
+	discardUnknown bool
+	useProtoNames  bool
+
+	conn *grpc.ClientConn
+	log  *service.Logger
+
+	mut     sync.Mutex
+	method  protoreflect.MethodDescriptor
+	marshal protojson.MarshalOptions
+	unmarsh protojson.UnmarshalOptions
+}
+
+func newGRPCClientProcessorFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (*grpcClientProcessor, error) {
+	g := &grpcClientProcessor{
+		log: mgr.Logger(),
+	}
+
+	address, err := conf.FieldString(gcpFieldAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	methodStr, err := conf.FieldString(gcpFieldMethod)
+	if err != nil {
+		return nil, err
+	}
+	if g.serviceName, g.methodName, err = parseMethodName(methodStr); err != nil {
+		return nil, err
+	}
+
+	if g.reflection, err = conf.FieldBool(gcpFieldReflection); err != nil {
+		return nil, err
+	}
+	if g.metadata, err = conf.FieldInterpolatedStringMap(gcpFieldMetadata); err != nil {
+		return nil, err
+	}
+	if g.timeout, err = conf.FieldDuration(gcpFieldTimeout); err != nil {
+		return nil, err
+	}
+	if g.discardUnknown, err = conf.FieldBool(gcpFieldDiscardUnknown); err != nil {
+		return nil, err
+	}
+	if g.useProtoNames, err = conf.FieldBool(gcpFieldUseProtoNames); err != nil {
+		return nil, err
+	}
+
+	if !g.reflection {
+		files, types, err := protobuf.LoadDescriptors(context.Background(), conf, mgr)
+		if err != nil {
+			return nil, err
+		}
+		md, err := findMethod(files, g.serviceName, g.methodName)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.setMethod(md, types); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConf, tlsEnabled, err := conf.FieldTLSToggled(gcpFieldTLS)
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if tlsEnabled {
+		creds = credentials.NewTLS(tlsConf)
+	}
+
+	if g.conn, err = grpc.Dial(address, grpc.WithTransportCredentials(creds)); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *grpcClientProcessor) setMethod(md protoreflect.MethodDescriptor, types *protoregistry.Types) error {
+	if md.IsStreamingClient() && md.IsStreamingServer() {
+		return fmt.Errorf("bidirectional streaming method '%v' is not supported", md.FullName())
+	}
+	g.method = md
+	g.marshal = protojson.MarshalOptions{Resolver: types, UseProtoNames: g.useProtoNames}
+	g.unmarsh = protojson.UnmarshalOptions{Resolver: types, DiscardUnknown: g.discardUnknown}
+	return nil
+}
+
+// getMethod returns the descriptor of the target method, obtaining it from the
+// server via reflection the first time it is called when reflection is enabled.
+func (g *grpcClientProcessor) getMethod(ctx context.Context) (protoreflect.MethodDescriptor, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	if g.method != nil {
+		return g.method, nil
+	}
+
+	files, types, err := reflectDescriptors(ctx, g.conn, g.serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain schema via reflection: %w", err)
+	}
+	md, err := findMethod(files, g.serviceName, g.methodName)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.setMethod(md, types); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+func (g *grpcClientProcessor) outgoingContext(ctx context.Context, msg *service.Message) (context.Context, error) {
+	if len(g.metadata) == 0 {
+		return ctx, nil
+	}
+	md := metadata.MD{}
+	for k, v := range g.metadata {
+		str, err := v.TryString(msg)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %v interpolation error: %w", k, err)
+		}
+		md.Append(k, str)
+	}
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+func (g *grpcClientProcessor) toRequest(md protoreflect.MethodDescriptor, msg *service.Message) (*dynamicpb.Message, error) {
+	mBytes, err := msg.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+	req := dynamicpb.NewMessage(md.Input())
+	if err := g.unmarsh.Unmarshal(mBytes, req); err != nil {
+		return nil, fmt.Errorf("failed to convert message into request: %w", err)
+	}
+	return req, nil
+}
+
+// invoke opens a stream for the method, sends all requests, and returns all
+// responses received, which is an error when there are none.
+func (g *grpcClientProcessor) invoke(ctx context.Context, md protoreflect.MethodDescriptor, reqs []*dynamicpb.Message) ([]*service.Message, error) {
+	ctx, done := context.WithTimeout(ctx, g.timeout)
+	defer done()
+
+	stream, err := g.conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(md.Name()),
+		ServerStreams: md.IsStreamingServer(),
+		ClientStreams: md.IsStreamingClient(),
+	}, fullMethodName(md))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, req := range reqs {
+		if err := stream.SendMsg(req); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The server has ended the stream, the actual error is
+				// obtained when receiving.
+				break
+			}
+			return nil, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	var responses []*service.Message
+	for {
+		res := dynamicpb.NewMessage(md.Output())
+		if err := stream.RecvMsg(res); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		resBytes, err := g.marshal.Marshal(res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert response: %w", err)
+		}
+		responses = append(responses, service.NewMessage(resBytes))
+		if !md.IsStreamingServer() {
+			break
+		}
+	}
+	if len(responses) == 0 {
+		return nil, errNoResponse
+	}
+	return responses, nil
+}
+
+var errNoResponse = errors.New("method returned no response")
+
+func setInvokeError(msg *service.Message, err error) {
+	if s, ok := status.FromError(err); ok {
+		msg.MetaSetMut("grpc_status", s.Code().String())
+	}
+	msg.SetError(err)
+}
+
+func (g *grpcClientProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	md, err := g.getMethod(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if md.IsStreamingClient() {
+		return g.processClientStream(ctx, md, batch), nil
+	}
+
+	var outBatch service.MessageBatch
+	for _, msg := range batch {
+		req, err := g.toRequest(md, msg)
+		if err != nil {
+			msg.SetError(err)
+			outBatch = append(outBatch, msg)
+			continue
+		}
+
+		reqCtx, err := g.outgoingContext(ctx, msg)
+		if err != nil {
+			msg.SetError(err)
+			outBatch = append(outBatch, msg)
+			continue
+		}
+
+		responses, err := g.invoke(reqCtx, md, []*dynamicpb.Message{req})
+		if err != nil {
+			g.log.Debugf("Failed to invoke method %v: %v", md.FullName(), err)
+			setInvokeError(msg, err)
+			outBatch = append(outBatch, msg)
+			continue
+		}
+
+		for _, res := range responses {
+			resBytes, _ := res.AsBytes()
+			outMsg := msg.Copy()
+			outMsg.SetBytes(resBytes)
+			outBatch = append(outBatch, outMsg)
+		}
+	}
+	return []service.MessageBatch{outBatch}, nil
+}
+
+func (g *grpcClientProcessor) processClientStream(ctx context.Context, md protoreflect.MethodDescriptor, batch service.MessageBatch) []service.MessageBatch {
+	failBatch := func(err error) []service.MessageBatch {
+		for _, msg := range batch {
+			setInvokeError(msg, err)
+		}
+		return []service.MessageBatch{batch}
+	}
+
+	reqs := make([]*dynamicpb.Message, 0, len(batch))
+	for _, msg := range batch {
+		req, err := g.toRequest(md, msg)
+		if err != nil {
+			return failBatch(err)
+		}
+		reqs = append(reqs, req)
+	}
+
+	reqCtx, err := g.outgoingContext(ctx, batch[0])
+	if err != nil {
+		return failBatch(err)
+	}
+
+	responses, err := g.invoke(reqCtx, md, reqs)
+	if err != nil {
+		g.log.Debugf("Failed to invoke method %v: %v", md.FullName(), err)
+		return failBatch(err)
+	}
+
+	outBatch := make(service.MessageBatch, 0, len(responses))
+	for _, res := range responses {
+		resBytes, _ := res.AsBytes()
+		outMsg := batch[0].Copy()
+		outMsg.SetBytes(resBytes)
+		outBatch = append(outBatch, outMsg)
+	}
+	return []service.MessageBatch{outBatch}
+}
+
+func (g *grpcClientProcessor) Close(ctx context.Context) error {
+	return g.conn.Close()
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/protobuf"
+)
+
+// reflectDescriptors obtains the file defining a service, and all of its
+// dependencies, from a server via the reflection service.
+func reflectDescriptors(ctx context.Context, conn *grpc.ClientConn, serviceName string) (*protoregistry.Files, *protoregistry.Types, error) {
+	ctx, done := context.WithCancel(ctx)
+	defer done()
+
+	stream, err := reflectionv1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = stream.CloseSend()
+	}()
+
+	seen := map[string]struct{}{}
+	fdSet := &descriptorpb.FileDescriptorSet{}
+
+	addFiles := func(res *reflectionv1.ServerReflectionResponse) ([]string, error) {
+		if errRes := res.GetErrorResponse(); errRes != nil {
+			return nil, fmt.Errorf("reflection error (%v): %v", errRes.GetErrorCode(), errRes.GetErrorMessage())
+		}
+		fdRes := res.GetFileDescriptorResponse()
+		if fdRes == nil {
+			return nil, errors.New("unexpected reflection response")
+		}
+		var deps []string
+		for _, fdBytes := range fdRes.GetFileDescriptorProto() {
+			var fdProto descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(fdBytes, &fdProto); err != nil {
+				return nil, err
+			}
+			if _, exists := seen[fdProto.GetName()]; exists {
+				continue
+			}
+			seen[fdProto.GetName()] = struct{}{}
+			fdSet.File = append(fdSet.File, &fdProto)
+			deps = append(deps, fdProto.GetDependency()...)
+		}
+		return deps, nil
+	}
+
+	request := func(req *reflectionv1.ServerReflectionRequest) ([]string, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return addFiles(res)
+	}
+
+	pending, err := request(&reflectionv1.ServerReflectionRequest{
+		MessageRequest: &reflectionv1.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: serviceName,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Servers usually respond with all transitive dependencies, but any that
+	// are missing are requested individually.
+	for len(pending) > 0 {
+		dep := pending[0]
+		pending = pending[1:]
+		if _, exists := seen[dep]; exists {
+			continue
+		}
+		if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+			continue
+		}
+		deps, err := request(&reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_FileByFilename{
+				FileByFilename: dep,
+			},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		pending = append(pending, deps...)
+	}
+
+	return protobuf.RegistriesFromFileDescriptorSet(fdSet)
+}
@@ -15,11 +15,13 @@
 package javascript
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dop251/goja"
 
@@ -99,6 +101,47 @@ func registerVMRunnerFunction(name, description string) *jsFunctionDefinition {
 
 //------------------------------------------------------------------------------
 
+func fetch(ctx context.Context, client *http.Client, url string, httpHeaders map[string]any, method, payload string) (map[string]any, error) {
+	var payloadReader io.Reader
+	if payload != "" {
+		payloadReader = strings.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, payloadReader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse HTTP headers
+	for k, v := range httpHeaders {
+		vStr, _ := v.(string)
+		req.Header.Add(k, vStr)
+	}
+
+	// Do request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"status": resp.StatusCode,
+		"body":   string(respBody),
+	}, nil
+}
+
+func parseFetchArgs(call goja.FunctionCall) (url string, httpHeaders map[string]any, method, payload string, err error) {
+	method = "GET"
+	err = parseArgs(call, &url, &httpHeaders, &method, &payload)
+	return
+}
+
 var _ = registerVMRunnerFunction(
 	"v0_fetch",
 	`Executes an HTTP request synchronously and returns the result as an object of the form `+"`"+`{"status":200,"body":"foo"}`+"`"+`.`,
@@ -113,48 +156,132 @@ benthos.v0_msg_set_structured(result);
 `).
 	FnCtor(func(r *vmRunner) jsFunction {
 		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
-			var (
-				url         string
-				httpHeaders map[string]any
-				method      = "GET"
-				payload     = ""
-			)
-			if err := parseArgs(call, &url, &httpHeaders, &method, &payload); err != nil {
+			url, httpHeaders, method, payload, err := parseFetchArgs(call)
+			if err != nil {
 				return nil, err
 			}
+			return fetch(r.ctx, r.httpClient, url, httpHeaders, method, payload)
+		}
+	})
 
-			var payloadReader io.Reader
-			if payload != "" {
-				payloadReader = strings.NewReader(payload)
-			}
-
-			req, err := http.NewRequest(method, url, payloadReader)
+var _ = registerVMRunnerFunction(
+	"v0_fetch_async",
+	`Executes an HTTP request in the background and returns a promise that resolves to an object of the form `+"`"+`{"status":200,"body":"foo"}`+"`"+`, allowing multiple requests to be executed concurrently. The processor waits for all promises to be settled before completing.`,
+).
+	Param("url", "string", "The URL to fetch").
+	Param("headers", "object(string,string)", "An object of string/string key/value pairs to add the request as headers.").
+	Param("method", "string", "The method of the request.").
+	Param("body", "(optional) string", "A body to send.").
+	Example(`
+(async () => {
+  let [a, b] = await Promise.all([
+    benthos.v0_fetch_async("http://example.com/a", {}, "GET", ""),
+    benthos.v0_fetch_async("http://example.com/b", {}, "GET", ""),
+  ]);
+  benthos.v0_msg_set_structured({ a: a.body, b: b.body });
+})();
+`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			url, httpHeaders, method, payload, err := parseFetchArgs(call)
 			if err != nil {
 				return nil, err
 			}
+			client := r.httpClient
+			return r.async(func(ctx context.Context) (any, error) {
+				return fetch(ctx, client, url, httpHeaders, method, payload)
+			}), nil
+		}
+	})
 
-			// Parse HTTP headers
-			for k, v := range httpHeaders {
-				vStr, _ := v.(string)
-				req.Header.Add(k, vStr)
+var _ = registerVMRunnerFunction("v0_batch_as_array", `Obtain all messages of the processed batch as an array of objects of the form `+"`"+`{"index":0,"content":"foo","metadata":{}}`+"`"+`. Only available when the processor mode is `+"`batch`"+`.`).
+	Example(`let docs = benthos.v0_batch_as_array().map(m => JSON.parse(m.content));`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			if !r.batchMode {
+				return nil, errors.New("batch functions can only be used when the processor mode is batch")
+			}
+			msgs := make([]any, len(r.runBatch))
+			for i, m := range r.runBatch {
+				b, err := m.AsBytes()
+				if err != nil {
+					return nil, err
+				}
+				meta := map[string]any{}
+				_ = m.MetaWalkMut(func(k string, v any) error {
+					meta[k] = v
+					return nil
+				})
+				msgs[i] = map[string]any{
+					"index":    i,
+					"content":  string(b),
+					"metadata": meta,
+				}
 			}
+			return msgs, nil
+		}
+	})
 
-			// Do request
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
+var _ = registerVMRunnerFunction("v0_batch_set", `Replace the processed batch with an array of messages, where each message is an object with a `+"`content`"+` field, containing either a string or a structured value, and an optional `+"`metadata`"+` object. Messages with an `+"`index`"+` field referencing a message of the original batch are derived from that message, retaining its metadata unless a `+"`metadata`"+` field is provided. Only available when the processor mode is `+"`batch`"+`.`).
+	Param("messages", "array", "The messages of the new batch.").
+	Example(`
+let msgs = benthos.v0_batch_as_array();
+benthos.v0_batch_set(msgs.filter(m => m.content !== "drop me"));
+`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			if !r.batchMode {
+				return nil, errors.New("batch functions can only be used when the processor mode is batch")
+			}
+			var msgs []map[string]any
+			if err := parseArgs(call, &msgs); err != nil {
 				return nil, err
 			}
-			defer resp.Body.Close()
 
-			respBody, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return nil, err
+			outBatch := make(service.MessageBatch, 0, len(msgs))
+			for i, obj := range msgs {
+				var msg *service.Message
+				if index, ok := obj["index"].(int64); ok && index >= 0 && int(index) < len(r.runBatch) {
+					msg = r.runBatch[index].Copy()
+				} else {
+					msg = service.NewMessage(nil)
+				}
+
+				if metaV, exists := obj["metadata"]; exists {
+					meta, ok := metaV.(map[string]any)
+					if !ok {
+						return nil, fmt.Errorf("message %v: expected metadata object, got %T", i, metaV)
+					}
+					var keys []string
+					_ = msg.MetaWalkMut(func(k string, _ any) error {
+						keys = append(keys, k)
+						return nil
+					})
+					for _, k := range keys {
+						msg.MetaDelete(k)
+					}
+					for k, v := range meta {
+						msg.MetaSetMut(k, v)
+					}
+				}
+
+				switch c := obj["content"].(type) {
+				case string:
+					msg.SetBytes([]byte(c))
+				case nil:
+					if _, exists := obj["content"]; !exists {
+						return nil, fmt.Errorf("message %v: missing content field", i)
+					}
+					msg.SetStructured(nil)
+				default:
+					msg.SetStructured(c)
+				}
+				outBatch = append(outBatch, msg)
 			}
 
-			return map[string]any{
-				"status": resp.StatusCode,
-				"body":   string(respBody),
-			}, nil
+			r.outBatch = outBatch
+			r.batchSet = true
+			return nil, nil
 		}
 	})
 
@@ -168,7 +295,11 @@ var _ = registerVMRunnerFunction("v0_msg_set_string", `Set the contents of the p
 				return nil, err
 			}
 
-			r.targetMessage.SetBytes([]byte(value))
+			msg, err := r.message()
+			if err != nil {
+				return nil, err
+			}
+			msg.SetBytes([]byte(value))
 			return nil, nil
 		}
 	})
@@ -177,7 +308,11 @@ var _ = registerVMRunnerFunction("v0_msg_as_string", `Obtain the raw contents of
 	Example(`let contents = benthos.v0_msg_as_string();`).
 	FnCtor(func(r *vmRunner) jsFunction {
 		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
-			b, err := r.targetMessage.AsBytes()
+			msg, err := r.message()
+			if err != nil {
+				return nil, err
+			}
+			b, err := msg.AsBytes()
 			if err != nil {
 				return nil, err
 			}
@@ -201,7 +336,11 @@ benthos.v0_msg_set_structured({
 				return nil, err
 			}
 
-			r.targetMessage.SetStructured(value)
+			msg, err := r.message()
+			if err != nil {
+				return nil, err
+			}
+			msg.SetStructured(value)
 			return nil, nil
 		}
 	})
@@ -210,7 +349,11 @@ var _ = registerVMRunnerFunction("v0_msg_as_structured", `Obtain the root of the
 	Example(`let foo = benthos.v0_msg_as_structured().foo;`).
 	FnCtor(func(r *vmRunner) jsFunction {
 		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
-			return r.targetMessage.AsStructured()
+			msg, err := r.message()
+			if err != nil {
+				return nil, err
+			}
+			return msg.AsStructured()
 		}
 	})
 
@@ -224,7 +367,11 @@ var _ = registerVMRunnerFunction("v0_msg_exists_meta", `Check that a metadata ke
 				return nil, err
 			}
 
-			_, ok := r.targetMessage.MetaGet(name)
+			msg, err := r.message()
+			if err != nil {
+				return nil, err
+			}
+			_, ok := msg.MetaGet(name)
 			if !ok {
 				return false, nil
 			}
@@ -242,7 +389,11 @@ var _ = registerVMRunnerFunction("v0_msg_get_meta", `Get the value of a metadata
 				return nil, err
 			}
 
-			result, ok := r.targetMessage.MetaGet(name)
+			msg, err := r.message()
+			if err != nil {
+				return nil, err
+			}
+			result, ok := msg.MetaGet(name)
 			if !ok {
 				return nil, errors.New("key not found")
 			}
@@ -263,7 +414,210 @@ var _ = registerVMRunnerFunction("v0_msg_set_meta", `Set a metadata key on the p
 			if err := parseArgs(call, &name, &value); err != nil {
 				return "", err
 			}
-			r.targetMessage.MetaSetMut(name, value)
+			msg, err := r.message()
+			if err != nil {
+				return nil, err
+			}
+			msg.MetaSetMut(name, value)
+			return nil, nil
+		}
+	})
+
+var _ = registerVMRunnerFunction("v0_cache_get", `Obtain the value of a key from a cache resource, returns `+"`null`"+` if the key does not exist.`).
+	Param("resource", "string", "The name of the cache resource.").
+	Param("key", "string", "The key to obtain.").
+	Example(`
+let cached = benthos.v0_cache_get("foocache", benthos.v0_msg_get_meta("id"));
+if (cached !== null) {
+  benthos.v0_msg_set_string(cached);
+}
+`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			var resource, key string
+			if err := parseArgs(call, &resource, &key); err != nil {
+				return nil, err
+			}
+
+			var (
+				result []byte
+				getErr error
+			)
+			if err := r.mgr.AccessCache(r.ctx, resource, func(c service.Cache) {
+				result, getErr = c.Get(r.ctx, key)
+			}); err != nil {
+				return nil, fmt.Errorf("cache resource '%v': %w", resource, err)
+			}
+			if getErr != nil {
+				if errors.Is(getErr, service.ErrKeyNotFound) {
+					return nil, nil
+				}
+				return nil, getErr
+			}
+			return string(result), nil
+		}
+	})
+
+var _ = registerVMRunnerFunction("v0_cache_set", `Set the value of a key within a cache resource.`).
+	Param("resource", "string", "The name of the cache resource.").
+	Param("key", "string", "The key to set.").
+	Param("value", "string", "The value to set.").
+	Param("ttl", "(optional) string", "A duration string such as `1m` after which the key expires, if supported by the cache.").
+	Example(`benthos.v0_cache_set("foocache", benthos.v0_msg_get_meta("id"), benthos.v0_msg_as_string(), "1h");`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			var resource, key, value, ttlStr string
+			if err := parseArgs(call, &resource, &key, &value, &ttlStr); err != nil {
+				return nil, err
+			}
+
+			var ttl *time.Duration
+			if ttlStr != "" {
+				d, err := time.ParseDuration(ttlStr)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse ttl: %w", err)
+				}
+				ttl = &d
+			}
+
+			var setErr error
+			if err := r.mgr.AccessCache(r.ctx, resource, func(c service.Cache) {
+				setErr = c.Set(r.ctx, key, []byte(value), ttl)
+			}); err != nil {
+				return nil, fmt.Errorf("cache resource '%v': %w", resource, err)
+			}
+			return nil, setErr
+		}
+	})
+
+var _ = registerVMRunnerFunction("v0_cache_delete", `Delete a key from a cache resource.`).
+	Param("resource", "string", "The name of the cache resource.").
+	Param("key", "string", "The key to delete.").
+	Example(`benthos.v0_cache_delete("foocache", benthos.v0_msg_get_meta("id"));`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			var resource, key string
+			if err := parseArgs(call, &resource, &key); err != nil {
+				return nil, err
+			}
+
+			var delErr error
+			if err := r.mgr.AccessCache(r.ctx, resource, func(c service.Cache) {
+				delErr = c.Delete(r.ctx, key)
+			}); err != nil {
+				return nil, fmt.Errorf("cache resource '%v': %w", resource, err)
+			}
+			return nil, delErr
+		}
+	})
+
+var _ = registerVMRunnerFunction("v0_rate_limit_access", `Access a rate limit resource, blocking until access is granted.`).
+	Param("resource", "string", "The name of the rate limit resource.").
+	Example(`benthos.v0_rate_limit_access("foolimit");`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			var resource string
+			if err := parseArgs(call, &resource); err != nil {
+				return nil, err
+			}
+
+			for {
+				var (
+					waitFor   time.Duration
+					accessErr error
+				)
+				if err := r.mgr.AccessRateLimit(r.ctx, resource, func(rl service.RateLimit) {
+					waitFor, accessErr = rl.Access(r.ctx)
+				}); err != nil {
+					return nil, fmt.Errorf("rate limit resource '%v': %w", resource, err)
+				}
+				if accessErr != nil {
+					return nil, accessErr
+				}
+				if waitFor <= 0 {
+					return nil, nil
+				}
+				select {
+				case <-time.After(waitFor):
+				case <-r.ctx.Done():
+					return nil, r.ctx.Err()
+				}
+			}
+		}
+	})
+
+var _ = registerVMRunnerFunction("v0_metric_counter", `Increment a counter metric.`).
+	Param("name", "string", "The name of the metric.").
+	Param("value", "(optional) number", "The amount to increment the counter by, defaults to 1.").
+	Param("labels", "(optional) object(string,string)", "An object of label key/value pairs.").
+	Example(`benthos.v0_metric_counter("documents_processed", 1, { "type": benthos.v0_msg_get_meta("type") });`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			var (
+				name   string
+				value  float64 = 1
+				labels map[string]any
+			)
+			if err := parseArgs(call, &name, &value, &labels); err != nil {
+				return nil, err
+			}
+
+			keys, values := metricLabels(labels)
+			r.metrics.counter(name, keys).IncrFloat64(value, values...)
+			return nil, nil
+		}
+	})
+
+var _ = registerVMRunnerFunction("v0_metric_gauge", `Set the value of a gauge metric.`).
+	Param("name", "string", "The name of the metric.").
+	Param("value", "number", "The value to set the gauge to.").
+	Param("labels", "(optional) object(string,string)", "An object of label key/value pairs.").
+	Example(`benthos.v0_metric_gauge("queue_depth", benthos.v0_msg_as_structured().depth);`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			var (
+				name   string
+				value  float64
+				labels map[string]any
+			)
+			if len(call.Arguments) < 2 {
+				return nil, errors.New("expected at least two arguments")
+			}
+			if err := parseArgs(call, &name, &value, &labels); err != nil {
+				return nil, err
+			}
+
+			keys, values := metricLabels(labels)
+			r.metrics.gauge(name, keys).SetFloat64(value, values...)
+			return nil, nil
+		}
+	})
+
+var _ = registerVMRunnerFunction("v0_metric_timer", `Record a timing metric.`).
+	Param("name", "string", "The name of the metric.").
+	Param("value", "number", "The duration to record in nanoseconds.").
+	Param("labels", "(optional) object(string,string)", "An object of label key/value pairs.").
+	Example(`
+let started = Date.now();
+benthos.v0_fetch("http://example.com", {}, "GET", "");
+benthos.v0_metric_timer("fetch_latency", (Date.now() - started) * 1000000);
+`).
+	FnCtor(func(r *vmRunner) jsFunction {
+		return func(call goja.FunctionCall, rt *goja.Runtime, l *service.Logger) (interface{}, error) {
+			var (
+				name   string
+				value  int64
+				labels map[string]any
+			)
+			if len(call.Arguments) < 2 {
+				return nil, errors.New("expected at least two arguments")
+			}
+			if err := parseArgs(call, &name, &value, &labels); err != nil {
+				return nil, err
+			}
+
+			keys, values := metricLabels(labels)
+			r.metrics.timer(name, keys).Timing(value, values...)
 			return nil, nil
 		}
 	})
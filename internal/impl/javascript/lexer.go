@@ -0,0 +1,345 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package javascript
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type jsTokenKind int
+
+const (
+	jsTokenIdent jsTokenKind = iota
+	jsTokenString
+	jsTokenTemplate
+	jsTokenNumber
+	jsTokenRegex
+	jsTokenPunct
+)
+
+// jsToken is a token of a JavaScript program, which is only lexed as far as
+// is needed for finding the import and export statements of modules.
+type jsToken struct {
+	kind       jsTokenKind
+	start, end int
+
+	// The number of brackets, braces and template substitutions the token is
+	// nested within, where an opening or closing bracket belongs to the outer
+	// level.
+	depth int
+
+	// Whether the token is preceded by a line break.
+	newline bool
+}
+
+var errUnterminated = errors.New("unterminated literal or comment")
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+// jsBracket is an open bracket, brace, parenthesis or template substitution.
+type jsBracket struct {
+	c byte // The opening character, where '`' marks a template substitution
+
+	// Whether a slash following the closing bracket starts a regular
+	// expression literal, which is the case for the end of a block or the
+	// condition of a control statement such as `if (x) /re/.test(s)`.
+	regexAfter bool
+}
+
+// openBracket returns the bracket opened by the character c following the
+// tokens toks.
+func openBracket(src string, toks []jsToken, c byte) jsBracket {
+	b := jsBracket{c: c}
+	switch c {
+	case '(':
+		if n := len(toks); n > 0 && toks[n-1].kind == jsTokenIdent && (n == 1 || !isPunct(src, &toks[n-2], ".")) {
+			switch src[toks[n-1].start:toks[n-1].end] {
+			case "if", "while", "for", "with":
+				b.regexAfter = true
+			}
+		}
+	case '{':
+		b.regexAfter = braceStartsBlock(src, toks)
+	}
+	return b
+}
+
+// braceStartsBlock returns whether an opening brace following the tokens toks
+// starts a block, class body or function body rather than an object literal.
+func braceStartsBlock(src string, toks []jsToken) bool {
+	n := len(toks)
+	if n == 0 {
+		return true
+	}
+	prev := &toks[n-1]
+	text := src[prev.start:prev.end]
+	switch prev.kind {
+	case jsTokenPunct:
+		switch text {
+		case ";", "{", "}", ")":
+			return true
+		case ">":
+			// The body of an arrow function.
+			return n > 1 && isPunct(src, &toks[n-2], "=") && toks[n-2].end == prev.start
+		}
+	case jsTokenIdent:
+		switch text {
+		case "do", "else", "try", "finally":
+			return true
+		}
+		return !regexAllowed(src, prev, nil)
+	}
+	return false
+}
+
+func isPunct(src string, tok *jsToken, text string) bool {
+	return tok.kind == jsTokenPunct && src[tok.start:tok.end] == text
+}
+
+// regexAllowed returns whether a slash following a token starts a regular
+// expression literal rather than being a division operator. When the token
+// closes a bracket then closed is the bracket it closes.
+func regexAllowed(src string, prev *jsToken, closed *jsBracket) bool {
+	if prev == nil {
+		return true
+	}
+	if closed != nil {
+		return closed.regexAfter
+	}
+	text := src[prev.start:prev.end]
+	switch prev.kind {
+	case jsTokenPunct:
+		return text != ")" && text != "]"
+	case jsTokenIdent:
+		switch text {
+		case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void",
+			"throw", "case", "do", "else", "yield", "await":
+			return true
+		}
+	}
+	return false
+}
+
+// scanTemplate scans the remainder of a template literal from index i, and
+// returns the index following either the end of the template or the start of
+// a substitution.
+func scanTemplate(src string, i int) (end int, substitution bool, err error) {
+	for i < len(src) {
+		switch src[i] {
+		case '\\':
+			i += 2
+		case '`':
+			return i + 1, false, nil
+		case '$':
+			if i+1 < len(src) && src[i+1] == '{' {
+				return i + 2, true, nil
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return 0, false, errUnterminated
+}
+
+func scanString(src string, i int) (int, error) {
+	quote := src[i]
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '\n':
+			return 0, errUnterminated
+		case quote:
+			return i + 1, nil
+		}
+	}
+	return 0, errUnterminated
+}
+
+func scanRegex(src string, i int) (int, error) {
+	inClass := false
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '\n':
+			return 0, errUnterminated
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				for i++; i < len(src) && isIdentPart(src[i]); i++ {
+				}
+				return i, nil
+			}
+		}
+	}
+	return 0, errUnterminated
+}
+
+// tokenizeJS splits a JavaScript program into tokens.
+func tokenizeJS(src string) ([]jsToken, error) {
+	toks, pos, err := tokenize(src)
+	if err != nil {
+		return nil, fmt.Errorf("line %v: %w", strings.Count(src[:pos], "\n")+1, err)
+	}
+	return toks, nil
+}
+
+// tokenize splits a JavaScript program into tokens, returning the position of
+// the token that could not be lexed on error.
+func tokenize(src string) ([]jsToken, int, error) {
+	var (
+		toks    []jsToken
+		stack   []jsBracket
+		closed  *jsBracket // The bracket closed by the last token, if any
+		newline bool
+	)
+
+	emit := func(kind jsTokenKind, start, end int) {
+		toks = append(toks, jsToken{
+			kind:    kind,
+			start:   start,
+			end:     end,
+			depth:   len(stack),
+			newline: newline,
+		})
+		newline = false
+		closed = nil
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n' || c == '\r':
+			newline = true
+			i++
+
+		case c == ' ' || c == '\t' || c == '\v' || c == '\f':
+			i++
+
+		case c == '/' && strings.HasPrefix(src[i:], "//"):
+			if end := strings.IndexByte(src[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(src)
+			}
+
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, i, errUnterminated
+			}
+			if strings.Contains(src[i:i+2+end], "\n") {
+				newline = true
+			}
+			i += end + 4
+
+		case c == '\'' || c == '"':
+			end, err := scanString(src, i)
+			if err != nil {
+				return nil, i, err
+			}
+			emit(jsTokenString, i, end)
+			i = end
+
+		case c == '`' || (c == '}' && len(stack) > 0 && stack[len(stack)-1].c == '`'):
+			if c == '}' {
+				stack = stack[:len(stack)-1]
+			}
+			end, substitution, err := scanTemplate(src, i+1)
+			if err != nil {
+				return nil, i, err
+			}
+			emit(jsTokenTemplate, i, end)
+			if substitution {
+				stack = append(stack, jsBracket{c: '`'})
+			}
+			i = end
+
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(src) && isIdentPart(src[end]) {
+				end++
+			}
+			emit(jsTokenIdent, i, end)
+			i = end
+
+		case (c >= '0' && c <= '9') || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			end := i + 1
+			for end < len(src) {
+				if d := src[end]; isIdentPart(d) || d == '.' {
+					end++
+				} else if (d == '+' || d == '-') && (src[end-1] == 'e' || src[end-1] == 'E') && !strings.HasPrefix(src[i:], "0x") && !strings.HasPrefix(src[i:], "0X") {
+					end++
+				} else {
+					break
+				}
+			}
+			emit(jsTokenNumber, i, end)
+			i = end
+
+		case c == '/':
+			var prev *jsToken
+			if len(toks) > 0 {
+				prev = &toks[len(toks)-1]
+			}
+			if !regexAllowed(src, prev, closed) {
+				emit(jsTokenPunct, i, i+1)
+				i++
+				continue
+			}
+			end, err := scanRegex(src, i)
+			if err != nil {
+				return nil, i, err
+			}
+			emit(jsTokenRegex, i, end)
+			i = end
+
+		case c == '(' || c == '[' || c == '{':
+			b := openBracket(src, toks, c)
+			emit(jsTokenPunct, i, i+1)
+			stack = append(stack, b)
+			i++
+
+		case c == ')' || c == ']' || c == '}':
+			var b *jsBracket
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				b = &top
+				stack = stack[:len(stack)-1]
+			}
+			emit(jsTokenPunct, i, i+1)
+			closed = b
+			i++
+
+		default:
+			emit(jsTokenPunct, i, i+1)
+			i++
+		}
+	}
+	return toks, 0, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package javascript
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// metricLabels converts an object of labels into a sorted list of keys and the
+// corresponding values.
+func metricLabels(labels map[string]any) (keys, values []string) {
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values = append(values, fmt.Sprintf("%v", labels[k]))
+	}
+	return
+}
+
+// jsMetrics caches metrics created by scripts, which are shared across all VMs
+// of a processor, by their name and label keys.
+type jsMetrics struct {
+	m *service.Metrics
+
+	mut      sync.Mutex
+	counters map[string]*service.MetricCounter
+	gauges   map[string]*service.MetricGauge
+	timers   map[string]*service.MetricTimer
+}
+
+func newJSMetrics(m *service.Metrics) *jsMetrics {
+	return &jsMetrics{
+		m:        m,
+		counters: map[string]*service.MetricCounter{},
+		gauges:   map[string]*service.MetricGauge{},
+		timers:   map[string]*service.MetricTimer{},
+	}
+}
+
+func metricKey(name string, labelKeys []string) string {
+	return name + "\x00" + strings.Join(labelKeys, "\x00")
+}
+
+func (j *jsMetrics) counter(name string, labelKeys []string) *service.MetricCounter {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+
+	key := metricKey(name, labelKeys)
+	c, exists := j.counters[key]
+	if !exists {
+		c = j.m.NewCounter(name, labelKeys...)
+		j.counters[key] = c
+	}
+	return c
+}
+
+func (j *jsMetrics) gauge(name string, labelKeys []string) *service.MetricGauge {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+
+	key := metricKey(name, labelKeys)
+	g, exists := j.gauges[key]
+	if !exists {
+		g = j.m.NewGauge(name, labelKeys...)
+		j.gauges[key] = g
+	}
+	return g
+}
+
+func (j *jsMetrics) timer(name string, labelKeys []string) *service.MetricTimer {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+
+	key := metricKey(name, labelKeys)
+	t, exists := j.timers[key]
+	if !exists {
+		t = j.m.NewTimer(name, labelKeys...)
+		j.timers[key] = t
+	}
+	return t
+}
@@ -0,0 +1,735 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package javascript
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja_nodejs/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// moduleSourceLoader extends sourceLoader with support for ES modules, which
+// are converted into CommonJS modules as they're loaded, and for the `exports`
+// and `module` fields of package.json files. Since the require registry caches
+// compiled modules by path, and is shared by all runtimes of a processor, each
+// module is loaded and converted at most once.
+func moduleSourceLoader(serviceFS *service.FS) require.SourceLoader {
+	load := sourceLoader(serviceFS)
+	return func(filename string) ([]byte, error) {
+		if path.Base(filename) == "package.json" {
+			return loadPackageJSON(load, filename)
+		}
+
+		src, err := load(filename)
+		if err != nil {
+			return nil, err
+		}
+		if ext := path.Ext(filename); ext != ".js" && ext != ".mjs" {
+			return src, nil
+		}
+
+		code, isModule, err := transformESM(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", filename, err)
+		}
+		if !isModule {
+			return src, nil
+		}
+		return []byte(code), nil
+	}
+}
+
+// mainModuleProgram converts the main program into a script when it is an ES
+// module. The module is executed as the body of an async function, which gives
+// each invocation its own scope and allows the use of top level await.
+func mainModuleProgram(code string) (string, error) {
+	code, isModule, err := transformESM(code)
+	if err != nil || !isModule {
+		return code, err
+	}
+	return "(async function(exports) {" + code + "\n})({});", nil
+}
+
+//------------------------------------------------------------------------------
+
+// loadPackageJSON loads a package.json file and replaces it with a document
+// that only contains the `main` field understood by the require registry,
+// resolved from the `exports` and `module` fields when present. When a
+// package.json file is requested for a subpath of a package that doesn't exist
+// the subpath is resolved from the `exports` field of the package itself.
+func loadPackageJSON(load require.SourceLoader, filename string) ([]byte, error) {
+	src, err := load(filename)
+	if err == nil {
+		var pkg map[string]any
+		if json.Unmarshal(src, &pkg) != nil {
+			return src, nil
+		}
+
+		main, _ := pkg["main"].(string)
+		if exports, exists := pkg["exports"]; exists {
+			if target := resolvePackageExports(exports, "."); target != "" {
+				main = target
+			}
+		} else if module, _ := pkg["module"].(string); main == "" && module != "" {
+			main = module
+		}
+		return json.Marshal(map[string]any{"main": main})
+	}
+	if !errors.Is(err, require.ModuleFileDoesNotExistError) {
+		return nil, err
+	}
+
+	root, subpath, ok := splitPackagePath(path.Dir(filename))
+	if !ok {
+		return nil, err
+	}
+
+	var pkg struct {
+		Exports any `json:"exports"`
+	}
+	rootSrc, rootErr := load(path.Join(root, "package.json"))
+	if rootErr != nil || json.Unmarshal(rootSrc, &pkg) != nil || pkg.Exports == nil {
+		return nil, err
+	}
+
+	target := resolvePackageExports(pkg.Exports, "./"+subpath)
+	if target == "" {
+		return nil, err
+	}
+
+	// The main field is resolved relative to the requested subpath.
+	main := strings.Repeat("../", strings.Count(subpath, "/")+1) + path.Clean(target)
+	return json.Marshal(map[string]any{"main": main})
+}
+
+// splitPackagePath splits a path within a node_modules directory into the root
+// directory of the package and the subpath within it.
+func splitPackagePath(p string) (root, subpath string, ok bool) {
+	i := strings.LastIndex(p, "node_modules/")
+	if i < 0 {
+		return "", "", false
+	}
+	i += len("node_modules/")
+
+	segments := strings.Split(p[i:], "/")
+	nameLen := 1
+	if strings.HasPrefix(segments[0], "@") {
+		nameLen = 2
+	}
+	if len(segments) <= nameLen {
+		return "", "", false
+	}
+	return p[:i] + strings.Join(segments[:nameLen], "/"), strings.Join(segments[nameLen:], "/"), true
+}
+
+// packageConditions are the conditions of package exports that are supported,
+// in order of preference. ES modules are supported as they're converted into
+// CommonJS modules when loaded.
+var packageConditions = []string{"require", "node", "default", "import", "module"}
+
+// resolvePackageExports returns the target of a subpath of the `exports` field
+// of a package.json file, or an empty string if the subpath isn't exported.
+func resolvePackageExports(exports any, subpath string) string {
+	obj, isObj := exports.(map[string]any)
+	if !isObj {
+		if subpath == "." {
+			return resolvePackageConditions(exports)
+		}
+		return ""
+	}
+
+	isSubpaths := false
+	for k := range obj {
+		isSubpaths = strings.HasPrefix(k, ".")
+		break
+	}
+	if !isSubpaths {
+		if subpath == "." {
+			return resolvePackageConditions(obj)
+		}
+		return ""
+	}
+
+	if target, exists := obj[subpath]; exists {
+		return resolvePackageConditions(target)
+	}
+
+	// Subpath patterns such as "./*" or "./lib/*.js"
+	for k, target := range obj {
+		prefix, suffix, hasWildcard := strings.Cut(k, "*")
+		if !hasWildcard || !strings.HasPrefix(subpath, prefix) || !strings.HasSuffix(subpath[len(prefix):], suffix) {
+			continue
+		}
+		match := strings.TrimSuffix(subpath[len(prefix):], suffix)
+		if resolved := resolvePackageConditions(target); resolved != "" {
+			return strings.ReplaceAll(resolved, "*", match)
+		}
+	}
+	return ""
+}
+
+func resolvePackageConditions(target any) string {
+	switch t := target.(type) {
+	case string:
+		return t
+	case []any:
+		for _, e := range t {
+			if resolved := resolvePackageConditions(e); resolved != "" {
+				return resolved
+			}
+		}
+	case map[string]any:
+		for _, cond := range packageConditions {
+			if e, exists := t[cond]; exists {
+				if resolved := resolvePackageConditions(e); resolved != "" {
+					return resolved
+				}
+			}
+		}
+	}
+	return ""
+}
+
+//------------------------------------------------------------------------------
+
+// esmHelpers are defined at the start of converted ES modules, implementing the
+// interoperability between ES modules and CommonJS modules.
+const esmHelpers = `var __esm_default = function(m) { return m && m.__esModule ? m.default : m; }; ` +
+	`var __esm_star = function(m) { if (m && m.__esModule) return m; var n = { default: m }; if (m != null) for (var k in m) if (k !== "default") n[k] = m[k]; return n; }; ` +
+	`var __esm_export = function(e, k, g) { Object.defineProperty(e, k, { enumerable: true, configurable: true, get: g }); }; ` +
+	`var __esm_export_star = function(e, m) { Object.keys(m).forEach(function(k) { if (k !== "default" && !Object.prototype.hasOwnProperty.call(e, k)) __esm_export(e, k, function() { return m[k]; }); }); }; ` +
+	`Object.defineProperty(exports, "__esModule", { value: true }); `
+
+type esmEdit struct {
+	start, end int
+	text       string
+}
+
+type esmTransformer struct {
+	src    string
+	toks   []jsToken
+	edits  []esmEdit
+	hoists []string
+	tmps   int
+}
+
+var esmKeywordRegex = regexp.MustCompile(`\b(import|export)\b`)
+
+// transformESM converts a program using ES module import and export statements
+// into a CommonJS module. Import statements are replaced with calls to require
+// and exported bindings are defined as getters of the exports object, which
+// preserves live bindings. The conversion keeps the line numbers of the program
+// intact.
+//
+// Returns false if the program doesn't contain any import or export
+// statements, in which case the program is returned unchanged. An error is
+// returned when a program that might be a module can't be tokenized, as
+// compiling it as a script would fail on the first import or export statement
+// rather than at the actual syntax error.
+//
+// The parser of goja doesn't support ES modules, and therefore the program is
+// only tokenized. Whether a slash starts a regular expression or is a division
+// operator is decided from the preceding tokens, including what the closing
+// bracket before it was opened for. This misreads a few rare constructs: a
+// division following a postfix increment or decrement (`a++ / 2`) or a
+// function or class expression (`(function() {} / 2)`), and a regular
+// expression following a label or a `case` clause ending with a block
+// (`case 1: {} /re/`). A misread slash either fails the conversion with an
+// unterminated literal error or hides the import and export statements up to
+// the next slash of the same line.
+func transformESM(src string) (string, bool, error) {
+	toks, err := tokenizeJS(src)
+	if err != nil {
+		if esmKeywordRegex.MatchString(src) {
+			return "", false, fmt.Errorf("failed to parse module: %w", err)
+		}
+		// Leave it to the compiler to report syntax errors of scripts.
+		return src, false, nil
+	}
+
+	t := &esmTransformer{src: src, toks: toks}
+	isModule := false
+	for i := 0; i < len(toks); i++ {
+		if toks[i].depth != 0 || toks[i].kind != jsTokenIdent || !t.isStatementStart(i) {
+			continue
+		}
+
+		var end int
+		switch t.text(i) {
+		case "import":
+			if t.isPunct(i+1, "(") || t.isPunct(i+1, ".") {
+				continue
+			}
+			end, err = t.importStatement(i)
+		case "export":
+			end, err = t.exportStatement(i)
+		default:
+			continue
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("line %v: %w", t.line(i), err)
+		}
+		isModule = true
+		i = end - 1
+	}
+	if !isModule {
+		return src, false, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(esmHelpers)
+	for _, h := range t.hoists {
+		b.WriteString(h)
+		b.WriteString(" ")
+	}
+
+	last := 0
+	for _, e := range t.edits {
+		b.WriteString(src[last:e.start])
+		b.WriteString(e.text)
+		// Preserve line numbers of the remaining program
+		b.WriteString(strings.Repeat("\n", strings.Count(src[e.start:e.end], "\n")))
+		last = e.end
+	}
+	b.WriteString(src[last:])
+	return b.String(), true, nil
+}
+
+func (t *esmTransformer) line(i int) int {
+	return strings.Count(t.src[:t.toks[i].start], "\n") + 1
+}
+
+func (t *esmTransformer) text(i int) string {
+	if i >= len(t.toks) {
+		return ""
+	}
+	return t.src[t.toks[i].start:t.toks[i].end]
+}
+
+func (t *esmTransformer) isKind(i int, kind jsTokenKind) bool {
+	return i < len(t.toks) && t.toks[i].kind == kind
+}
+
+func (t *esmTransformer) isPunct(i int, p string) bool {
+	return t.isKind(i, jsTokenPunct) && t.text(i) == p
+}
+
+func (t *esmTransformer) isIdent(i int, name string) bool {
+	return t.isKind(i, jsTokenIdent) && t.text(i) == name
+}
+
+func (t *esmTransformer) isStatementStart(i int) bool {
+	return i == 0 || t.toks[i].newline || t.isPunct(i-1, ";") || t.isPunct(i-1, "}")
+}
+
+// edit replaces the tokens from index i up to but excluding index end.
+func (t *esmTransformer) edit(i, end int, text string) {
+	t.edits = append(t.edits, esmEdit{
+		start: t.toks[i].start,
+		end:   t.toks[end-1].end,
+		text:  text,
+	})
+}
+
+func (t *esmTransformer) hoistExport(key, expr string) {
+	t.hoists = append(t.hoists, fmt.Sprintf("__esm_export(exports, %v, function() { return %v; });", key, expr))
+}
+
+func (t *esmTransformer) tmpName() string {
+	t.tmps++
+	return "__esm_module" + strconv.Itoa(t.tmps)
+}
+
+// statementEnd skips over import attributes and the terminating semicolon of
+// an import or export statement.
+func (t *esmTransformer) statementEnd(i int) int {
+	if (t.isIdent(i, "with") || t.isIdent(i, "assert")) && !t.toks[i].newline && t.isPunct(i+1, "{") {
+		depth := t.toks[i+1].depth
+		for i += 2; i < len(t.toks) && !(t.toks[i].depth == depth && t.isPunct(i, "}")); i++ {
+		}
+		i++
+	}
+	if t.isPunct(i, ";") {
+		i++
+	}
+	return i
+}
+
+// moduleSpecifier parses `from "specifier"` at index i.
+func (t *esmTransformer) moduleSpecifier(i int) (string, error) {
+	if !t.isIdent(i, "from") || !t.isKind(i+1, jsTokenString) {
+		return "", errors.New("expected a module specifier")
+	}
+	return t.text(i + 1), nil
+}
+
+// moduleExportName returns an identifier or string module export name as a
+// string literal.
+func (t *esmTransformer) moduleExportName(i int) (string, error) {
+	switch {
+	case t.isKind(i, jsTokenIdent):
+		return strconv.Quote(t.text(i)), nil
+	case t.isKind(i, jsTokenString):
+		return t.text(i), nil
+	}
+	return "", fmt.Errorf("unexpected token '%v'", t.text(i))
+}
+
+// specifiers parses a list of import or export specifiers of the form
+// `{ a, b as c }` starting at index i, returning pairs of names and the index
+// following the list.
+func (t *esmTransformer) specifiers(i int) (names [][2]int, end int, err error) {
+	if !t.isPunct(i, "{") {
+		return nil, 0, fmt.Errorf("unexpected token '%v'", t.text(i))
+	}
+	for i++; i < len(t.toks); {
+		if t.isPunct(i, "}") {
+			return names, i + 1, nil
+		}
+		if !t.isKind(i, jsTokenIdent) && !t.isKind(i, jsTokenString) {
+			return nil, 0, fmt.Errorf("unexpected token '%v'", t.text(i))
+		}
+		pair := [2]int{i, i}
+		i++
+		if t.isIdent(i, "as") {
+			pair[1] = i + 1
+			i += 2
+		}
+		names = append(names, pair)
+		if t.isPunct(i, ",") {
+			i++
+		}
+	}
+	return nil, 0, errors.New("unterminated specifier list")
+}
+
+func (t *esmTransformer) importStatement(i int) (int, error) {
+	j := i + 1
+	if t.isKind(j, jsTokenString) {
+		end := t.statementEnd(j + 1)
+		t.edit(i, end, "require("+t.text(j)+");")
+		return end, nil
+	}
+
+	var defaultName, nsName string
+	var named [][2]int
+	if t.isKind(j, jsTokenIdent) && (t.isPunct(j+1, ",") || t.isIdent(j+1, "from")) {
+		defaultName = t.text(j)
+		if j++; t.isPunct(j, ",") {
+			j++
+		}
+	}
+	if t.isPunct(j, "*") {
+		if !t.isIdent(j+1, "as") || !t.isKind(j+2, jsTokenIdent) {
+			return 0, errors.New("expected a namespace import")
+		}
+		nsName = t.text(j + 2)
+		j += 3
+	} else if t.isPunct(j, "{") {
+		var err error
+		if named, j, err = t.specifiers(j); err != nil {
+			return 0, err
+		}
+	}
+
+	spec, err := t.moduleSpecifier(j)
+	if err != nil {
+		return 0, err
+	}
+	end := t.statementEnd(j + 2)
+
+	var b strings.Builder
+	mod := "require(" + spec + ")"
+	bindings := 0
+	for _, b := range []bool{defaultName != "", nsName != "", len(named) > 0} {
+		if b {
+			bindings++
+		}
+	}
+	if bindings > 1 {
+		tmp := t.tmpName()
+		fmt.Fprintf(&b, "var %v = %v; ", tmp, mod)
+		mod = tmp
+	}
+	if defaultName != "" {
+		fmt.Fprintf(&b, "const %v = __esm_default(%v); ", defaultName, mod)
+	}
+	if nsName != "" {
+		fmt.Fprintf(&b, "const %v = __esm_star(%v); ", nsName, mod)
+	}
+	if len(named) > 0 {
+		props := make([]string, len(named))
+		for k, pair := range named {
+			imported, local := t.text(pair[0]), t.text(pair[1])
+			if t.isKind(pair[1], jsTokenString) {
+				return 0, fmt.Errorf("invalid import binding %v", local)
+			}
+			if pair[0] == pair[1] {
+				props[k] = local
+			} else {
+				props[k] = imported + ": " + local
+			}
+		}
+		fmt.Fprintf(&b, "const { %v } = %v; ", strings.Join(props, ", "), mod)
+	}
+	if b.Len() == 0 {
+		b.WriteString(mod + "; ")
+	}
+	t.edit(i, end, strings.TrimSuffix(b.String(), " "))
+	return end, nil
+}
+
+func (t *esmTransformer) exportStatement(i int) (int, error) {
+	j := i + 1
+	switch {
+	case t.isIdent(j, "default"):
+		if name := t.declarationName(j + 1); name != "" {
+			t.edit(i, j+1, "")
+			t.hoistExport(`"default"`, name)
+		} else {
+			t.edit(i, j+1, "exports.default =")
+		}
+		return j + 1, nil
+
+	case t.isIdent(j, "const") || t.isIdent(j, "let") || t.isIdent(j, "var"):
+		names, err := t.declaratorNames(j + 1)
+		if err != nil {
+			return 0, err
+		}
+		t.edit(i, j, "")
+		for _, name := range names {
+			t.hoistExport(strconv.Quote(name), name)
+		}
+		return j, nil
+
+	case t.isPunct(j, "*"):
+		if t.isIdent(j+1, "as") {
+			key, err := t.moduleExportName(j + 2)
+			if err != nil {
+				return 0, err
+			}
+			spec, err := t.moduleSpecifier(j + 3)
+			if err != nil {
+				return 0, err
+			}
+			end := t.statementEnd(j + 5)
+			tmp := t.tmpName()
+			t.edit(i, end, fmt.Sprintf("var %v = __esm_star(require(%v));", tmp, spec))
+			t.hoistExport(key, tmp)
+			return end, nil
+		}
+		spec, err := t.moduleSpecifier(j + 1)
+		if err != nil {
+			return 0, err
+		}
+		end := t.statementEnd(j + 3)
+		t.edit(i, end, fmt.Sprintf("__esm_export_star(exports, require(%v));", spec))
+		return end, nil
+
+	case t.isPunct(j, "{"):
+		names, k, err := t.specifiers(j)
+		if err != nil {
+			return 0, err
+		}
+
+		var replacement, source string
+		if t.isIdent(k, "from") {
+			spec, err := t.moduleSpecifier(k)
+			if err != nil {
+				return 0, err
+			}
+			k += 2
+			source = t.tmpName()
+			replacement = fmt.Sprintf("var %v = require(%v);", source, spec)
+		} else if k < len(t.toks) && !t.toks[k].newline && !t.isPunct(k, ";") {
+			return 0, fmt.Errorf("unexpected token '%v'", t.text(k))
+		}
+
+		for _, pair := range names {
+			key, err := t.moduleExportName(pair[1])
+			if err != nil {
+				return 0, err
+			}
+			local := t.text(pair[0])
+			switch {
+			case source == "" && t.isKind(pair[0], jsTokenString):
+				return 0, fmt.Errorf("invalid export binding %v", local)
+			case source == "":
+				t.hoistExport(key, local)
+			case t.isKind(pair[0], jsTokenString):
+				t.hoistExport(key, source+"["+local+"]")
+			default:
+				t.hoistExport(key, source+"."+local)
+			}
+		}
+
+		end := t.statementEnd(k)
+		t.edit(i, end, replacement)
+		return end, nil
+	}
+
+	if name := t.declarationName(j); name != "" {
+		t.edit(i, j, "")
+		t.hoistExport(strconv.Quote(name), name)
+		return j, nil
+	}
+	return 0, fmt.Errorf("unsupported export of '%v'", t.text(j))
+}
+
+// declarationName returns the name of a function or class declaration at index
+// i, or an empty string if there isn't a named declaration.
+func (t *esmTransformer) declarationName(i int) string {
+	if t.isIdent(i, "async") && t.isIdent(i+1, "function") && !t.toks[i+1].newline {
+		i++
+	}
+	switch {
+	case t.isIdent(i, "function"):
+		if i++; t.isPunct(i, "*") {
+			i++
+		}
+	case t.isIdent(i, "class"):
+		if i++; t.isIdent(i, "extends") {
+			return ""
+		}
+	default:
+		return ""
+	}
+	if !t.isKind(i, jsTokenIdent) {
+		return ""
+	}
+	return t.text(i)
+}
+
+// declaratorNames returns the names bound by the variable declarators
+// starting at index i.
+func (t *esmTransformer) declaratorNames(i int) ([]string, error) {
+	var names []string
+	for {
+		var err error
+		if names, i, err = t.bindingNames(names, i); err != nil {
+			return nil, err
+		}
+
+		// Skip the initializer of the declarator
+		for ; i < len(t.toks); i++ {
+			tok := t.toks[i]
+			if tok.depth != 0 {
+				continue
+			}
+			if t.isPunct(i, ",") || t.isPunct(i, ";") {
+				break
+			}
+			if tok.newline && !t.continuesExpression(i) {
+				return names, nil
+			}
+		}
+		if !t.isPunct(i, ",") {
+			return names, nil
+		}
+		i++
+	}
+}
+
+// continuesExpression returns whether the token at index i, which is preceded
+// by a line break, continues the expression of the previous line.
+func (t *esmTransformer) continuesExpression(i int) bool {
+	if t.isKind(i, jsTokenTemplate) {
+		return true
+	}
+	if t.isKind(i, jsTokenPunct) && strings.Contains(".,?:+-*/%&|^=<>()[]}", t.text(i)) {
+		return true
+	}
+	if t.isKind(i-1, jsTokenPunct) && strings.Contains(".,?:+-*/%&|^=<>!~([{", t.text(i-1)) {
+		return true
+	}
+	switch t.text(i - 1) {
+	case "in", "instanceof", "typeof", "new", "void", "delete", "await", "yield":
+		return true
+	}
+	switch t.text(i) {
+	case "in", "instanceof":
+		return true
+	}
+	return false
+}
+
+// bindingNames appends the names bound by an identifier or destructuring
+// pattern at index i, and returns the index following the pattern.
+func (t *esmTransformer) bindingNames(names []string, i int) ([]string, int, error) {
+	if t.isKind(i, jsTokenIdent) {
+		return append(names, t.text(i)), i + 1, nil
+	}
+
+	isObj := t.isPunct(i, "{")
+	if !isObj && !t.isPunct(i, "[") {
+		return nil, 0, fmt.Errorf("unexpected token '%v'", t.text(i))
+	}
+	closing := "]"
+	if isObj {
+		closing = "}"
+	}
+
+	depth := t.toks[i].depth
+	for i++; i < len(t.toks); {
+		var err error
+		switch {
+		case t.isPunct(i, closing) && t.toks[i].depth == depth:
+			return names, i + 1, nil
+		case t.isPunct(i, ","):
+			i++
+			continue
+		case t.isPunct(i, ".") && t.isPunct(i+1, ".") && t.isPunct(i+2, "."):
+			if names, i, err = t.bindingNames(names, i+3); err != nil {
+				return nil, 0, err
+			}
+		case isObj:
+			key := i
+			if t.isPunct(i, "[") {
+				// Computed property keys
+				for i++; i < len(t.toks) && !(t.isPunct(i, "]") && t.toks[i].depth == depth+1); i++ {
+				}
+			}
+			if i++; t.isPunct(i, ":") {
+				if names, i, err = t.bindingNames(names, i+1); err != nil {
+					return nil, 0, err
+				}
+			} else if t.isKind(key, jsTokenIdent) {
+				names = append(names, t.text(key))
+			} else {
+				return nil, 0, fmt.Errorf("unexpected token '%v'", t.text(key))
+			}
+		default:
+			if names, i, err = t.bindingNames(names, i); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		// Skip default values
+		for ; i < len(t.toks); i++ {
+			if t.toks[i].depth == depth+1 && t.isPunct(i, ",") || t.toks[i].depth == depth && t.isPunct(i, closing) {
+				break
+			}
+		}
+	}
+	return nil, 0, errors.New("unterminated destructuring pattern")
+}
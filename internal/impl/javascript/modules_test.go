@@ -0,0 +1,204 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package javascript
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func TestProcessorModules(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestFiles(t, tmpDir, map[string]string{
+		"node_modules/cjs-lib/package.json": `{"name":"cjs-lib","main":"lib/index.js"}`,
+		"node_modules/cjs-lib/lib/index.js": `
+exports.shout = function(s) { return s.toUpperCase(); };
+`,
+		"node_modules/esm-lib/package.json": `{
+  "name": "esm-lib",
+  "type": "module",
+  "exports": {
+    ".": { "types": "./index.d.ts", "import": "./dist/index.mjs" },
+    "./utils/*": "./dist/utils/*.mjs"
+  }
+}`,
+		"node_modules/esm-lib/dist/index.mjs": `
+import { shout } from "cjs-lib";
+import suffix, * as utils from "./utils/suffix.mjs";
+
+export let calls = 0;
+
+export default function greet(name) {
+  calls++;
+  return shout("hello " + name) + suffix + utils.extra;
+}
+`,
+		"node_modules/esm-lib/dist/utils/suffix.mjs": `
+export const extra = "?";
+export default "!";
+`,
+		"shared/local.js": `
+module.exports = { answer: 42 };
+`,
+		"main.js": `
+import greet, * as lib from "esm-lib";
+import { extra } from "esm-lib/utils/suffix";
+import local from "local";
+
+const name = benthos.v0_msg_as_string();
+const value = await Promise.resolve(greet(name));
+benthos.v0_msg_set_structured({ value, extra, calls: lib.calls, answer: local.answer });
+`,
+	})
+
+	conf, err := javascriptProcessorConfig().ParseYAML(fmt.Sprintf(`
+file: %v
+global_folders: [ %v ]
+`, filepath.Join(tmpDir, "main.js"), filepath.Join(tmpDir, "shared")), nil)
+	require.NoError(t, err)
+
+	proc, err := newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	resBatches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("foo")),
+		service.NewMessage([]byte("bar")),
+	})
+	require.NoError(t, err)
+	require.Len(t, resBatches, 1)
+	require.Len(t, resBatches[0], 2)
+
+	resBytes, err := resBatches[0][0].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":"HELLO FOO!?","extra":"?","calls":1,"answer":42}`, string(resBytes))
+
+	// Modules are evaluated once per runtime, whereas the main program is
+	// scoped to each invocation.
+	resBytes, err = resBatches[0][1].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":"HELLO BAR!?","extra":"?","calls":2,"answer":42}`, string(resBytes))
+
+	require.NoError(t, proc.Close(context.Background()))
+}
+
+func TestTransformESM(t *testing.T) {
+	code, isModule, err := transformESM(`
+const x = require("foo"); // import x from "foo"
+const s = "export default 1";
+const r = /import/;
+`)
+	require.NoError(t, err)
+	assert.False(t, isModule)
+	assert.Contains(t, code, `require("foo")`)
+
+	code, isModule, err = transformESM(`import a, { b as c, d } from "./a";
+import "./side-effect.js"
+export { c as e };
+export * from "./f";
+export const g = 1, { h, i: [j] } = c;
+export default class K {}
+throw new Error("line 7");
+`)
+	require.NoError(t, err)
+	assert.True(t, isModule)
+
+	lines := strings.Split(code, "\n")
+	require.Len(t, lines, 8)
+	assert.Contains(t, lines[0], `var __esm_module1 = require("./a"); const a = __esm_default(__esm_module1); const { b: c, d } = __esm_module1;`)
+	for _, name := range []string{"e", "g", "h", "j", "default"} {
+		assert.Contains(t, lines[0], fmt.Sprintf(`__esm_export(exports, "%v"`, name))
+	}
+	assert.Equal(t, `require("./side-effect.js");`, lines[1])
+	assert.Equal(t, ``, lines[2])
+	assert.Equal(t, `__esm_export_star(exports, require("./f"));`, lines[3])
+	assert.Equal(t, ` const g = 1, { h, i: [j] } = c;`, lines[4])
+	assert.Equal(t, ` class K {}`, lines[5])
+	assert.Equal(t, `throw new Error("line 7");`, lines[6])
+
+	_, _, err = transformESM(`
+export { a } form "./a";
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+
+	// Modules that can't be tokenized are rejected rather than compiled as
+	// scripts.
+	_, _, err = transformESM("const f = () => { return n }\n/ 2;\nexport default f;")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+
+	// Slashes following closing brackets are told apart by what the bracket
+	// was opened for.
+	code, isModule, err = transformESM(`if (x) /"/.test(s);
+const y = ({}) / 2 + "/";
+const z = { a: 1 } / 2 + "/";
+function f() {} /"/.test(s);
+const g = () => {}
+/"/.test(s);
+while (a.if(b) / 2 + "/") {}
+export default y;
+`)
+	require.NoError(t, err)
+	assert.True(t, isModule)
+	assert.NotContains(t, code, "export default")
+
+	code, isModule, err = transformESM("const s = 'nope\n';")
+	require.NoError(t, err)
+	assert.False(t, isModule)
+	assert.Equal(t, "const s = 'nope\n';", code)
+}
+
+func TestResolvePackageExports(t *testing.T) {
+	exports := map[string]any{
+		".": map[string]any{
+			"import":  "./index.mjs",
+			"require": "./index.cjs",
+		},
+		"./feature": []any{map[string]any{"browser": "./browser.js"}, "./feature.js"},
+		"./lib/*":   map[string]any{"default": "./dist/lib/*.js"},
+	}
+
+	for subpath, target := range map[string]string{
+		".":           "./index.cjs",
+		"./feature":   "./feature.js",
+		"./lib/a/b":   "./dist/lib/a/b.js",
+		"./nope":      "",
+		"./lib/a.txt": "./dist/lib/a.txt.js",
+	} {
+		assert.Equal(t, target, resolvePackageExports(exports, subpath), subpath)
+	}
+
+	assert.Equal(t, "./main.js", resolvePackageExports("./main.js", "."))
+	assert.Equal(t, "./main.js", resolvePackageExports(map[string]any{"node": "./main.js"}, "."))
+	assert.Equal(t, "", resolvePackageExports(map[string]any{"node": "./main.js"}, "./foo"))
+}
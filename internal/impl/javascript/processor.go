@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -38,6 +39,11 @@ const (
 	codeField    = "code"
 	fileField    = "file"
 	includeField = "global_folders"
+	modeField    = "mode"
+	fetchField   = "fetch"
+
+	fetchTimeoutField = "timeout"
+	fetchTLSField     = "tls"
 )
 
 func javascriptProcessorConfig() *service.ConfigSpec {
@@ -56,13 +62,29 @@ func javascriptProcessorConfig() *service.ConfigSpec {
 	return service.NewConfigSpec().
 		Categories("Mapping").
 		Version("4.14.0").
-		Summary("Executes a provided JavaScript code block or file for each message.").
+		Summary("Executes a provided JavaScript code block or file for each message, or for each batch of messages.").
 		Description(`
 The https://github.com/dop251/goja[execution engine^] behind this processor provides full ECMAScript 5.1 support (including regex and strict mode). Most of the ECMAScript 6 spec is implemented but this is a work in progress.
 
 Imports via `+"`require`"+` should work similarly to NodeJS, and access to the console is supported which will print via the Redpanda Connect logger. More caveats can be found on https://github.com/dop251/goja#known-incompatibilities-and-caveats[GitHub^].
 
-This processor is implemented using the https://github.com/dop251/goja[github.com/dop251/goja^] library.`).
+== Modules
+
+Both CommonJS modules and ES modules can be imported, with ES modules being converted into CommonJS modules as they are loaded. Packages are resolved from `+"`node_modules`"+` directories relative to the importing file, starting with the directory of the program, and from the directories listed in `+"`"+includeField+"`"+`, which allows pure JavaScript libraries installed with npm to be used without bundling them. The `+"`exports`"+`, `+"`main`"+` and `+"`module`"+` fields of `+"`package.json`"+` files are respected, preferring CommonJS entry points when a package provides both.
+
+When the program itself uses `+"`import`"+` or `+"`export`"+` statements it is executed as an ES module, where each invocation has its own scope and top level `+"`await`"+` is supported. Bindings imported by name are evaluated once at the point of import, and therefore values that are reassigned by a module after it is imported should be accessed through a namespace import (`+"`import * as lib from \"lib\"`"+`).
+
+Modules are compiled once and cached for the lifetime of the processor, and are evaluated once for each runtime.
+
+This processor is implemented using the https://github.com/dop251/goja[github.com/dop251/goja^] library.
+
+== Batch Mode
+
+By default the program is executed once for each message of a batch. When the field `+"`"+modeField+"`"+` is set to `+"`batch`"+` the program is instead executed once for each batch, where the messages of the batch can be read with `+"`v0_batch_as_array`"+` and replaced with `+"`v0_batch_set`"+`, allowing programs to split, merge, drop or reorder messages. The `+"`v0_msg_*`"+` functions cannot be used in batch mode. When a program does not call `+"`v0_batch_set`"+` the batch is left unchanged.
+
+== Asynchronous Functions
+
+Functions such as `+"`v0_fetch_async`"+` return a promise and run in the background, allowing programs to perform multiple operations concurrently with `+"`async`"+` functions, `+"`await`"+` and `+"`Promise.all`"+`. Execution of a program only completes once all of its promises are settled, and if the result of the program is a promise that is rejected then processing fails with the rejection reason.`).
 		Footnotes(`
 == Runtime
 
@@ -80,8 +102,24 @@ Although technically possible, it is recommended that you do not rely on the glo
 			Description("A file containing a JavaScript program to run. One of `"+codeField+"` or `"+fileField+"` must be defined.").
 			Optional()).
 		Field(service.NewStringListField(includeField).
-			Description("List of folders that will be used to load modules from if the requested JS module is not found elsewhere.").
+			Description("List of folders that will be used to load modules from if the requested JS module is not found elsewhere. Each folder is searched for packages in the same way as a `node_modules` directory.").
 			Default([]string{})).
+		Field(service.NewStringAnnotatedEnumField(modeField, map[string]string{
+			"message": "The program is executed once for each message of a batch.",
+			"batch":   "The program is executed once for each batch, and the messages of the batch are accessed and replaced with the `v0_batch_*` functions.",
+		}).
+			Description("Whether the program is executed for each message or for each batch.").
+			Default("message").
+			Version("4.31.0")).
+		Field(service.NewObjectField(fetchField,
+			service.NewDurationField(fetchTimeoutField).
+				Description("The maximum period to wait for an HTTP request made with `v0_fetch` or `v0_fetch_async` to complete, including reading the response body.").
+				Default("30s"),
+			service.NewTLSToggledField(fetchTLSField),
+		).
+			Description("Configures the HTTP client used by the fetch functions.").
+			Advanced().
+			Version("4.31.0")).
 		LintRule(fmt.Sprintf(`
 let codeLen = (this.%v | "").length()
 let fileLen = (this.%v | "").length()
@@ -114,6 +152,47 @@ pipeline:
             delete thing["b"];
             benthos.v0_msg_set_structured(thing);
           })();
+`,
+		).
+		Example(
+			`ES modules`,
+			`In this example we import functions from packages installed with npm into a `+"`node_modules`"+` directory next to the program file.`,
+			`
+# Contents of ./scripts/enrich.js:
+#
+# import { formatISO } from "date-fns";
+# import get from "lodash/get.js";
+#
+# const doc = benthos.v0_msg_as_structured();
+# doc.city = get(doc, "address.city", "unknown");
+# doc.processed_at = formatISO(new Date());
+# benthos.v0_msg_set_structured(doc);
+
+pipeline:
+  processors:
+    - javascript:
+        file: ./scripts/enrich.js
+`,
+		).
+		Example(
+			`Batch enrichment`,
+			`In this example we execute the program once per batch and enrich all documents of a batch concurrently with data fetched from an HTTP service, then merge them into a single message. Since the program is an async function the processor waits until all requests are completed.`,
+			`
+pipeline:
+  processors:
+    - javascript:
+        mode: batch
+        fetch:
+          timeout: 5s
+        code: |
+          (async () => {
+            let docs = benthos.v0_batch_as_array().map(m => JSON.parse(m.content));
+            let results = await Promise.all(docs.map(doc =>
+              benthos.v0_fetch_async("http://localhost:8080/users/" + doc.user_id, {}, "GET", "")
+            ));
+            docs.forEach((doc, i) => { doc.user = JSON.parse(results[i].body); });
+            benthos.v0_batch_set([{ content: docs }]);
+          })();
 `,
 		)
 }
@@ -135,6 +214,10 @@ type javascriptProcessor struct {
 	program         *goja.Program
 	requireRegistry *require.Registry
 	logger          *service.Logger
+	mgr             *service.Resources
+	metrics         *jsMetrics
+	batchMode       bool
+	httpClient      *http.Client
 	vmPool          sync.Pool
 }
 
@@ -178,6 +261,7 @@ func newJavascriptProcessorFromConfig(conf *service.ParsedConfig, mgr *service.R
 	}
 
 	filename := "main.js"
+	var err error
 	if file != "" {
 		// Open file and read code
 		codeBytes, err := service.ReadFile(mgr.FS(), file)
@@ -188,6 +272,10 @@ func newJavascriptProcessorFromConfig(conf *service.ParsedConfig, mgr *service.R
 		code = string(codeBytes)
 	}
 
+	if code, err = mainModuleProgram(code); err != nil {
+		return nil, fmt.Errorf("failed to load javascript module: %v", err)
+	}
+
 	program, err := goja.Compile(filename, code, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile javascript code: %v", err)
@@ -200,18 +288,52 @@ func newJavascriptProcessorFromConfig(conf *service.ParsedConfig, mgr *service.R
 	}
 	requireRegistry := require.NewRegistry(
 		require.WithGlobalFolders(registryGlobalFolders...),
-		require.WithLoader(sourceLoader(mgr.FS())),
+		require.WithLoader(moduleSourceLoader(mgr.FS())),
 	)
 	requireRegistry.RegisterNativeModule("console", console.RequireWithPrinter(&Logger{logger}))
 
+	mode, err := conf.FieldString(modeField)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := fetchClientFromParsed(conf.Namespace(fetchField))
+	if err != nil {
+		return nil, err
+	}
+
 	return &javascriptProcessor{
 		program:         program,
 		requireRegistry: requireRegistry,
 		logger:          logger,
+		mgr:             mgr,
+		metrics:         newJSMetrics(mgr.Metrics()),
+		batchMode:       mode == "batch",
+		httpClient:      httpClient,
 		vmPool:          sync.Pool{},
 	}, nil
 }
 
+func fetchClientFromParsed(conf *service.ParsedConfig) (*http.Client, error) {
+	timeout, err := conf.FieldDuration(fetchTimeoutField)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf, tlsEnabled, err := conf.FieldTLSToggled(fetchTLSField)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	if tlsEnabled {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConf
+		client.Transport = transport
+	}
+	return client, nil
+}
+
 func (j *javascriptProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
 	var vr *vmRunner
 	var err error
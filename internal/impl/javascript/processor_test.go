@@ -23,6 +23,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -393,3 +394,299 @@ code: |
 
 	require.NoError(t, proc.Close(bCtx))
 }
+
+func TestProcessorResources(t *testing.T) {
+	conf, err := javascriptProcessorConfig().ParseYAML(`
+code: |
+  (() => {
+    benthos.v0_rate_limit_access("foolimit");
+
+    let key = benthos.v0_msg_get_meta("id");
+    let seen = benthos.v0_cache_get("foocache", key);
+    if (seen !== null) {
+      benthos.v0_metric_counter("duplicates", 1, { "id": key });
+      benthos.v0_msg_set_string("duplicate of " + seen);
+      benthos.v0_cache_delete("foocache", key);
+      return;
+    }
+    benthos.v0_cache_set("foocache", key, benthos.v0_msg_as_string(), "1m");
+    benthos.v0_metric_gauge("last_length", benthos.v0_msg_as_string().length);
+    benthos.v0_metric_timer("timing", 1000);
+  })();
+`, nil)
+	require.NoError(t, err)
+
+	var accesses int
+	mgr := service.MockResources(
+		service.MockResourcesOptAddCache("foocache"),
+		service.MockResourcesOptAddRateLimit("foolimit", func(ctx context.Context) (time.Duration, error) {
+			accesses++
+			if accesses%2 == 0 {
+				return time.Millisecond, nil
+			}
+			return 0, nil
+		}),
+	)
+
+	proc, err := newJavascriptProcessorFromConfig(conf, mgr)
+	require.NoError(t, err)
+
+	bCtx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	newMsg := func(id, content string) *service.Message {
+		msg := service.NewMessage([]byte(content))
+		msg.MetaSetMut("id", id)
+		return msg
+	}
+
+	resBatches, err := proc.ProcessBatch(bCtx, service.MessageBatch{
+		newMsg("a", "first"),
+		newMsg("b", "second"),
+		newMsg("a", "third"),
+		newMsg("a", "fourth"),
+	})
+	require.NoError(t, err)
+	require.Len(t, resBatches, 1)
+	require.Len(t, resBatches[0], 4)
+
+	var results []string
+	for _, m := range resBatches[0] {
+		resBytes, err := m.AsBytes()
+		require.NoError(t, err)
+		results = append(results, string(resBytes))
+	}
+	assert.Equal(t, []string{"first", "second", "duplicate of first", "fourth"}, results)
+
+	// Every other access is rejected once before being granted.
+	assert.Equal(t, 7, accesses)
+
+	require.NoError(t, mgr.AccessCache(bCtx, "foocache", func(c service.Cache) {
+		v, err := c.Get(bCtx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "fourth", string(v))
+	}))
+
+	require.NoError(t, proc.Close(bCtx))
+}
+
+func TestProcessorResourcesMissing(t *testing.T) {
+	conf, err := javascriptProcessorConfig().ParseYAML(`
+code: |
+  (() => {
+    try {
+      benthos.v0_cache_get("nope", "foo");
+    } catch (e) {
+      benthos.v0_msg_set_string(e.toString());
+    }
+  })();
+`, nil)
+	require.NoError(t, err)
+
+	proc, err := newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	resBatches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello")),
+	})
+	require.NoError(t, err)
+	require.Len(t, resBatches[0], 1)
+
+	resBytes, err := resBatches[0][0].AsBytes()
+	require.NoError(t, err)
+	assert.Contains(t, string(resBytes), "nope")
+}
+
+func TestProcessorBatchMode(t *testing.T) {
+	conf, err := javascriptProcessorConfig().ParseYAML(`
+mode: batch
+code: |
+  (() => {
+    let msgs = benthos.v0_batch_as_array();
+    let out = [];
+    msgs.forEach(m => {
+      if (m.content === "drop") {
+        return;
+      }
+      if (m.content === "split") {
+        out.push({ index: m.index, content: "split a" });
+        out.push({ index: m.index, content: "split b", metadata: { part: "b" } });
+        return;
+      }
+      out.push(m);
+    });
+    out.push({ content: { count: msgs.length } });
+    benthos.v0_batch_set(out);
+  })();
+`, nil)
+	require.NoError(t, err)
+
+	proc, err := newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	inMsgs := service.MessageBatch{
+		service.NewMessage([]byte("keep")),
+		service.NewMessage([]byte("drop")),
+		service.NewMessage([]byte("split")),
+	}
+	inMsgs[0].MetaSetMut("foo", "a")
+	inMsgs[2].MetaSetMut("foo", "c")
+
+	resBatches, err := proc.ProcessBatch(context.Background(), inMsgs)
+	require.NoError(t, err)
+	require.Len(t, resBatches, 1)
+	require.Len(t, resBatches[0], 4)
+
+	var contents []string
+	var fooMeta []string
+	for _, m := range resBatches[0] {
+		b, err := m.AsBytes()
+		require.NoError(t, err)
+		contents = append(contents, string(b))
+		v, _ := m.MetaGet("foo")
+		fooMeta = append(fooMeta, v)
+	}
+	assert.Equal(t, []string{"keep", "split a", "split b", `{"count":3}`}, contents)
+	assert.Equal(t, []string{"a", "c", "", ""}, fooMeta)
+
+	part, _ := resBatches[0][2].MetaGet("part")
+	assert.Equal(t, "b", part)
+
+	// Original messages are not modified.
+	inBytes, err := inMsgs[2].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "split", string(inBytes))
+}
+
+func TestProcessorBatchModeErrors(t *testing.T) {
+	conf, err := javascriptProcessorConfig().ParseYAML(`
+mode: batch
+code: 'benthos.v0_msg_as_string();'
+`, nil)
+	require.NoError(t, err)
+
+	proc, err := newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	_, err = proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello")),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "processor mode is batch")
+
+	conf, err = javascriptProcessorConfig().ParseYAML(`
+code: 'benthos.v0_batch_as_array();'
+`, nil)
+	require.NoError(t, err)
+
+	proc, err = newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	_, err = proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello")),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "processor mode is batch")
+}
+
+func TestProcessorHTTPFetchAsync(t *testing.T) {
+	release := make(chan struct{})
+	var reqCount int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Both requests must be in flight before either is answered.
+		if atomic.AddInt32(&reqCount, 1) == 2 {
+			close(release)
+		}
+		select {
+		case <-release:
+		case <-time.After(time.Second * 5):
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		_, _ = w.Write([]byte("hello " + r.URL.Path[1:]))
+	}))
+	t.Cleanup(testServer.Close)
+
+	conf, err := javascriptProcessorConfig().ParseYAML(fmt.Sprintf(`
+code: |
+  (async () => {
+    let [a, b] = await Promise.all([
+      benthos.v0_fetch_async("%[1]v/a", {}, "GET", ""),
+      benthos.v0_fetch_async("%[1]v/b", {}, "GET", ""),
+    ]);
+    benthos.v0_msg_set_structured({ a: a.body, b: b.body, status: a.status });
+  })();
+`, testServer.URL), nil)
+	require.NoError(t, err)
+
+	proc, err := newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	resBatches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello")),
+	})
+	require.NoError(t, err)
+	require.Len(t, resBatches[0], 1)
+
+	resBytes, err := resBatches[0][0].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":"hello a","b":"hello b","status":200}`, string(resBytes))
+}
+
+func TestProcessorHTTPFetchAsyncErrors(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 5):
+		}
+	}))
+	t.Cleanup(testServer.Close)
+
+	conf, err := javascriptProcessorConfig().ParseYAML(fmt.Sprintf(`
+fetch:
+  timeout: 50ms
+code: |
+  (async () => {
+    await benthos.v0_fetch_async("%v", {}, "GET", "");
+    benthos.v0_msg_set_string("unreachable");
+  })();
+`, testServer.URL), nil)
+	require.NoError(t, err)
+
+	proc, err := newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	_, err = proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello")),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "promise rejected")
+	assert.Contains(t, err.Error(), "Client.Timeout")
+
+	conf, err = javascriptProcessorConfig().ParseYAML(fmt.Sprintf(`
+fetch:
+  timeout: 50ms
+code: |
+  (async () => {
+    try {
+      await benthos.v0_fetch_async("%v", {}, "GET", "");
+    } catch (e) {
+      benthos.v0_msg_set_string("caught");
+    }
+  })();
+`, testServer.URL), nil)
+	require.NoError(t, err)
+
+	proc, err = newJavascriptProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+
+	resBatches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello")),
+	})
+	require.NoError(t, err)
+	require.Len(t, resBatches[0], 1)
+
+	resBytes, err := resBatches[0][0].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "caught", string(resBytes))
+}
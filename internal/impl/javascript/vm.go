@@ -16,7 +16,9 @@ package javascript
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/dop251/goja"
 	"github.com/dop251/goja_nodejs/console"
@@ -28,11 +30,22 @@ type vmRunner struct {
 	vm *goja.Runtime
 	p  *goja.Program
 
-	logger *service.Logger
+	logger  *service.Logger
+	mgr     *service.Resources
+	metrics *jsMetrics
 
+	batchMode  bool
+	httpClient *http.Client
+
+	ctx           context.Context
 	runBatch      service.MessageBatch
+	outBatch      service.MessageBatch
+	batchSet      bool
 	targetMessage *service.Message
 	targetIndex   int
+
+	pending     int
+	completions chan func()
 }
 
 func (j *javascriptProcessor) newVM() (*vmRunner, error) {
@@ -42,9 +55,14 @@ func (j *javascriptProcessor) newVM() (*vmRunner, error) {
 	console.Enable(vm)
 
 	vr := &vmRunner{
-		vm:     vm,
-		logger: j.logger,
-		p:      j.program,
+		vm:      vm,
+		logger:  j.logger,
+		mgr:     j.mgr,
+		metrics: j.metrics,
+		p:       j.program,
+
+		batchMode:  j.batchMode,
+		httpClient: j.httpClient,
 	}
 
 	for name, fc := range vmRunnerFunctionCtors {
@@ -129,14 +147,98 @@ func parseArgs(call goja.FunctionCall, ptrs ...any) error {
 }
 
 func (r *vmRunner) reset() {
+	r.ctx = nil
 	r.runBatch = nil
+	r.outBatch = nil
+	r.batchSet = false
 	r.targetMessage = nil
 	r.targetIndex = 0
+	r.pending = 0
+	r.completions = nil
+}
+
+var errBatchMode = errors.New("message functions cannot be used when the processor mode is batch")
+
+// message returns the message currently being processed, or an error when the
+// program is executed against a whole batch.
+func (r *vmRunner) message() (*service.Message, error) {
+	if r.targetMessage == nil {
+		return nil, errBatchMode
+	}
+	return r.targetMessage, nil
+}
+
+// async executes a function in the background and returns a promise that is
+// settled with its result. The promise is settled by the event loop of run,
+// as the VM must not be accessed concurrently.
+func (r *vmRunner) async(fn func(ctx context.Context) (any, error)) *goja.Promise {
+	promise, resolve, reject := r.vm.NewPromise()
+
+	ctx, completions := r.ctx, r.completions
+	r.pending++
+	go func() {
+		res, err := fn(ctx)
+		settle := func() {
+			if err != nil {
+				reject(r.vm.NewGoError(err))
+				return
+			}
+			resolve(res)
+		}
+		select {
+		case completions <- settle:
+		case <-ctx.Done():
+		}
+	}()
+	return promise
+}
+
+// run executes the program and then settles all promises created with async
+// until none are pending.
+func (r *vmRunner) run(ctx context.Context) error {
+	runCtx, done := context.WithCancel(ctx)
+	defer done()
+
+	r.ctx = runCtx
+	r.pending = 0
+	r.completions = make(chan func())
+
+	res, err := r.vm.RunProgram(r.p)
+	if err != nil {
+		return err
+	}
+
+	for r.pending > 0 {
+		select {
+		case settle := <-r.completions:
+			r.pending--
+			settle()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if p, ok := res.Export().(*goja.Promise); ok && p.State() == goja.PromiseStateRejected {
+		return fmt.Errorf("promise rejected: %v", p.Result())
+	}
+	return nil
 }
 
 func (r *vmRunner) Run(ctx context.Context, batch service.MessageBatch) (service.MessageBatch, error) {
 	defer r.reset()
 
+	if r.batchMode {
+		r.reset()
+		r.runBatch = batch
+		if err := r.run(ctx); err != nil {
+			return nil, err
+		}
+		if r.batchSet {
+			return r.outBatch, nil
+		}
+		return batch, nil
+	}
+
 	var newBatch service.MessageBatch
 	for i := range batch {
 		r.reset()
@@ -144,8 +246,7 @@ func (r *vmRunner) Run(ctx context.Context, batch service.MessageBatch) (service
 		r.targetIndex = i
 		r.targetMessage = batch[i]
 
-		_, err := r.vm.RunProgram(r.p)
-		if err != nil {
+		if err := r.run(ctx); err != nil {
 			// TODO: Make this more granular, error could be message specific
 			return nil, err
 		}
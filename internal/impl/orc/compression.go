@@ -0,0 +1,245 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+const (
+	defaultCompressionBlockSize = 256 * 1024
+
+	// Chunks stored in their original form are limited by the 23 bit length
+	// of chunk headers, and therefore compression blocks never exceed it.
+	maxCompressionBlockSize = 1<<23 - 1
+
+	// The maximum size of a decompressed stream.
+	maxStreamSize = 1 << 28
+)
+
+func compressionFromString(s string) (compressionKind, error) {
+	switch s {
+	case "none":
+		return compressionNone, nil
+	case "zlib":
+		return compressionZlib, nil
+	case "snappy":
+		return compressionSnappy, nil
+	case "lz4":
+		return compressionLz4, nil
+	case "zstd":
+		return compressionZstd, nil
+	}
+	return 0, fmt.Errorf("compression type %v not recognised", s)
+}
+
+type blockCodec interface {
+	encode(src []byte) ([]byte, error)
+	decode(src []byte, blockSize int) ([]byte, error)
+}
+
+func newBlockCodec(kind compressionKind) (blockCodec, error) {
+	switch kind {
+	case compressionNone:
+		return nil, nil
+	case compressionZlib:
+		return zlibCodec{}, nil
+	case compressionSnappy:
+		return snappyCodec{}, nil
+	case compressionLz4:
+		return lz4Codec{}, nil
+	case compressionZstd:
+		return zstdCodec{}, nil
+	}
+	return nil, fmt.Errorf("compression kind %d is not supported", uint64(kind))
+}
+
+type zlibCodec struct{}
+
+func (zlibCodec) encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (zlibCodec) decode(src []byte, blockSize int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(blockSize)+1))
+	if err == nil && len(out) > blockSize {
+		err = errChunkTooLarge
+	}
+	return out, err
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) encode(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (snappyCodec) decode(src []byte, blockSize int) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > blockSize {
+		return nil, errChunkTooLarge
+	}
+	return snappy.Decode(nil, src)
+}
+
+type lz4Codec struct{}
+
+func (lz4Codec) encode(src []byte) ([]byte, error) {
+	dst := make([]byte, lz4.CompressBlockBound(len(src)))
+	n, err := lz4.CompressBlock(src, dst, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		// Incompressible, signal to the caller that the original should be
+		// used instead.
+		return src, nil
+	}
+	return dst[:n], nil
+}
+
+func (lz4Codec) decode(src []byte, blockSize int) ([]byte, error) {
+	dst := make([]byte, blockSize)
+	n, err := lz4.UncompressBlock(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	return dst[:n], nil
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) encode(src []byte) ([]byte, error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.EncodeAll(src, nil), nil
+}
+
+func (zstdCodec) decode(src []byte, blockSize int) ([]byte, error) {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(blockSize)))
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	out, err := dec.DecodeAll(src, nil)
+	if err == nil && len(out) > blockSize {
+		err = errChunkTooLarge
+	}
+	return out, err
+}
+
+// compressStream splits a stream into chunks of at most blockSize bytes and
+// compresses each, prefixing them with the three byte ORC chunk header. Chunks
+// that do not benefit from compression are stored in their original form.
+func compressStream(codec blockCodec, blockSize int, data []byte) ([]byte, error) {
+	if codec == nil {
+		return data, nil
+	}
+
+	var out []byte
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > blockSize {
+			chunk = chunk[:blockSize]
+		}
+		data = data[len(chunk):]
+
+		compressed, err := codec.encode(chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		isOriginal := 0
+		if len(compressed) >= len(chunk) {
+			compressed, isOriginal = chunk, 1
+		}
+
+		header := len(compressed)<<1 | isOriginal
+		out = append(out, byte(header), byte(header>>8), byte(header>>16))
+		out = append(out, compressed...)
+	}
+	return out, nil
+}
+
+var (
+	errTruncatedChunk = errors.New("compressed chunk exceeds stream length")
+	errChunkTooLarge  = errors.New("decompressed chunk exceeds the compression block size")
+)
+
+// decompressStream reverses compressStream.
+func decompressStream(codec blockCodec, blockSize int, data []byte) ([]byte, error) {
+	if codec == nil {
+		return data, nil
+	}
+
+	var out []byte
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, errTruncatedChunk
+		}
+		header := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+		data = data[3:]
+
+		length := header >> 1
+		if length > len(data) {
+			return nil, errTruncatedChunk
+		}
+
+		chunk := data[:length]
+		data = data[length:]
+
+		if header&1 == 1 {
+			out = append(out, chunk...)
+			continue
+		}
+
+		decoded, err := codec.decode(chunk, blockSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress chunk: %w", err)
+		}
+		out = append(out, decoded...)
+		if len(out) > maxStreamSize {
+			return nil, fmt.Errorf("decompressed stream exceeds the maximum of %v bytes", maxStreamSize)
+		}
+	}
+	return out, nil
+}
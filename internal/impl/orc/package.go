@@ -0,0 +1,23 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package orc implements processors that encode and decode Apache ORC files.
+//
+// The codec is implemented within this package as there is no maintained ORC
+// library for Go: the Apache ORC project only provides C++ and Java
+// implementations, and github.com/scritchley/orc is no longer maintained. As
+// decoded files are untrusted input, the reader validates all offsets, lengths
+// and counts against the file, and bounds the memory allocated from them, which
+// is exercised by the fuzz tests FuzzFileReader and FuzzDecodeRLE.
+package orc
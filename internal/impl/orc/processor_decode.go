@@ -0,0 +1,96 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"context"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func orcDecodeProcessorConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Parsing").
+		Summary("Decodes https://orc.apache.org/docs/[ORC files^] into a batch of structured messages.").
+		Description(`
+Each row of the file becomes a message containing an object. Both version 1 and version 2 of the ORC run length encodings are supported, along with direct and dictionary encoded string columns, and the compression codecs `+"`none`, `zlib`, `snappy`, `lz4` and `zstd`"+`.
+
+Columns of type `+"`DATE`"+` are extracted as strings in the format `+"`2006-01-02`"+`, and columns of type `+"`TIMESTAMP`"+` are extracted as timestamps in UTC. Columns of type `+"`DECIMAL`"+` and `+"`UNION`"+` are not currently supported.`).
+		Version("4.31.0").
+		Example("Reading ORC Files from AWS S3",
+			"In this example we consume files from AWS S3 as they're written by listening onto an SQS queue for upload events. We make sure to use the `to_the_end` scanner which means files are read into memory in full, which then allows us to use an `orc_decode` processor to expand each file into a batch of messages. Finally, we write the data out to local files as newline delimited JSON.",
+			`
+input:
+  aws_s3:
+    bucket: TODO
+    prefix: foos/
+    scanner:
+      to_the_end: {}
+    sqs:
+      url: TODO
+  processors:
+    - orc_decode: {}
+
+output:
+  file:
+    codec: lines
+    path: './foos/${! meta("s3_key") }.jsonl'
+`)
+}
+
+func init() {
+	err := service.RegisterProcessor(
+		"orc_decode", orcDecodeProcessorConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return &orcDecodeProcessor{}, nil
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type orcDecodeProcessor struct{}
+
+func (s *orcDecodeProcessor) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
+	mBytes, err := msg.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	rdr, err := newFileReader(mBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := rdr.readRows()
+	if err != nil {
+		return nil, err
+	}
+
+	resBatch := make(service.MessageBatch, 0, len(rows))
+	for _, row := range rows {
+		newMsg := msg.Copy()
+		newMsg.SetStructuredMut(row)
+		resBatch = append(resBatch, newMsg)
+	}
+	return resBatch, nil
+}
+
+func (s *orcDecodeProcessor) Close(ctx context.Context) error {
+	return nil
+}
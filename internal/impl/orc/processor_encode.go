@@ -0,0 +1,208 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func orcEncodeProcessorConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Parsing").
+		Summary("Encodes https://orc.apache.org/docs/[ORC files^] from a batch of structured messages.").
+		Field(orcSchemaConfig()).
+		Field(service.NewStringEnumField("compression", "none", "zlib", "snappy", "lz4", "zstd").
+			Description("The compression codec to apply to the streams of the file.").
+			Default("none")).
+		Description(`
+Each batch of messages is written as a single ORC file containing one stripe. Columns are written with the `+"`DIRECT`"+` encoding and version 1 of the ORC run length encodings, which can be consumed by all ORC readers including Hive, Spark and Trino. Row indexes are not written.`).
+		Version("4.31.0").
+		Example("Writing ORC Files to AWS S3",
+			"In this example we use the batching mechanism of an `aws_s3` output to collect a batch of messages in memory, which then converts it to an ORC file and uploads it.",
+			`
+output:
+  aws_s3:
+    bucket: TODO
+    path: 'stuff/${! timestamp_unix() }-${! uuid_v4() }.orc'
+    batching:
+      count: 1000
+      period: 10s
+      processors:
+        - orc_encode:
+            schema:
+              - name: id
+                type: BIGINT
+              - name: weight
+                type: DOUBLE
+              - name: tags
+                type: STRING
+                repeated: true
+            compression: zlib
+`)
+}
+
+func init() {
+	err := service.RegisterBatchProcessor(
+		"orc_encode", orcEncodeProcessorConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+			return newORCEncodeProcessorFromConfig(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+func orcSchemaConfig() *service.ConfigField {
+	return service.NewObjectListField("schema",
+		service.NewStringField("name").Description("The name of the column."),
+		service.NewStringEnumField("type", "BOOLEAN", "TINYINT", "SMALLINT", "INT", "BIGINT", "FLOAT", "DOUBLE", "STRING", "BINARY").
+			Description("The type of the column, only applicable for leaf columns with no child fields.").Optional(),
+		service.NewBoolField("repeated").Description("Whether the field is repeated, in which case it is written as a list.").Default(false),
+		service.NewBoolField("optional").Description("Whether the field is optional.").Default(false),
+		service.NewAnyListField("fields").Description("A list of child fields, in which case the column is written as a struct.").Optional().Example([]any{
+			map[string]any{
+				"name": "foo",
+				"type": "BIGINT",
+			},
+			map[string]any{
+				"name": "bar",
+				"type": "STRING",
+			},
+		}),
+	).Description("ORC schema.")
+}
+
+var orcTypeKinds = map[string]typeKind{
+	"BOOLEAN":  kindBoolean,
+	"TINYINT":  kindByte,
+	"SMALLINT": kindShort,
+	"INT":      kindInt,
+	"BIGINT":   kindLong,
+	"FLOAT":    kindFloat,
+	"DOUBLE":   kindDouble,
+	"STRING":   kindString,
+	"BINARY":   kindBinary,
+}
+
+func orcStructFromConfig(name string, columnConfs []*service.ParsedConfig) (*schemaNode, error) {
+	node := &schemaNode{name: name, kind: kindStruct}
+	seen := map[string]struct{}{}
+
+	for _, colConf := range columnConfs {
+		name, err := colConf.FieldString("name")
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := seen[name]; exists {
+			return nil, fmt.Errorf("column %v is defined more than once", name)
+		}
+		seen[name] = struct{}{}
+
+		var n *schemaNode
+		if childColumns, _ := colConf.FieldAnyList("fields"); len(childColumns) > 0 {
+			if n, err = orcStructFromConfig(name, childColumns); err != nil {
+				return nil, err
+			}
+		} else {
+			typeStr, err := colConf.FieldString("type")
+			if err != nil {
+				return nil, err
+			}
+			kind, exists := orcTypeKinds[typeStr]
+			if !exists {
+				return nil, fmt.Errorf("field %v type of '%v' not recognised", name, typeStr)
+			}
+			n = &schemaNode{name: name, kind: kind}
+		}
+
+		repeated, _ := colConf.FieldBool("repeated")
+		if repeated {
+			n = &schemaNode{name: name, kind: kindList, children: []*schemaNode{n}}
+		}
+
+		optional, _ := colConf.FieldBool("optional")
+		if optional {
+			if repeated {
+				return nil, fmt.Errorf("column %v cannot be both repeated and optional", name)
+			}
+			n.optional = true
+		}
+
+		node.children = append(node.children, n)
+	}
+
+	return node, nil
+}
+
+//------------------------------------------------------------------------------
+
+type orcEncodeProcessor struct {
+	schema      *schemaNode
+	compression compressionKind
+}
+
+func newORCEncodeProcessorFromConfig(conf *service.ParsedConfig) (*orcEncodeProcessor, error) {
+	schemaConfs, err := conf.FieldObjectList("schema")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &orcEncodeProcessor{}
+	if p.schema, err = orcStructFromConfig("", schemaConfs); err != nil {
+		return nil, err
+	}
+
+	compressStr, err := conf.FieldString("compression")
+	if err != nil {
+		return nil, err
+	}
+	if p.compression, err = compressionFromString(compressStr); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *orcEncodeProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	rows := make([]any, len(batch))
+	for i, m := range batch {
+		var err error
+		if rows[i], err = m.AsStructured(); err != nil {
+			return nil, err
+		}
+	}
+
+	fileBytes, err := writeFile(p.schema, rows, p.compression)
+	if err != nil {
+		return nil, err
+	}
+
+	outMsg := batch[0]
+	outMsg.SetBytes(fileBytes)
+	return []service.MessageBatch{{outMsg}}, nil
+}
+
+func (p *orcEncodeProcessor) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func TestORCEncodeDecodeRoundTrip(t *testing.T) {
+	for _, compression := range []string{"none", "zlib", "snappy", "lz4", "zstd"} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			encodeConf, err := orcEncodeProcessorConfig().ParseYAML(fmt.Sprintf(`
+compression: %v
+schema:
+  - { name: id, type: BIGINT }
+  - { name: small, type: TINYINT }
+  - { name: medium, type: SMALLINT }
+  - { name: as, type: DOUBLE, repeated: true }
+  - { name: b, type: BINARY }
+  - { name: c, type: FLOAT }
+  - { name: d, type: BOOLEAN }
+  - { name: e, type: INT, optional: true }
+  - { name: g, type: STRING }
+  - name: nested_stuff
+    optional: true
+    fields:
+      - { name: a_stuff, type: STRING }
+      - { name: b_stuff, type: BIGINT, optional: true }
+`, compression), nil)
+			require.NoError(t, err)
+
+			encodeProc, err := newORCEncodeProcessorFromConfig(encodeConf)
+			require.NoError(t, err)
+
+			inputDocs := []string{
+				`{"id":3,"small":-3,"medium":300,"as":[0.1,0.2,0.3,0.4],"b":"foo","c":0.5,"d":true,"e":6,"g":"bar","nested_stuff":{"a_stuff":"a value","b_stuff":12}}`,
+				`{"id":12,"small":12,"medium":-1200,"as":[0.5,0.7],"b":"bar","c":0.25,"d":false,"e":null,"g":"baz","nested_stuff":null}`,
+				`{"id":13,"small":0,"medium":0,"as":[],"b":"","c":-1,"d":true,"g":"","nested_stuff":{"a_stuff":"another value"}}`,
+			}
+			for i := 0; i < 500; i++ {
+				inputDocs = append(inputDocs, fmt.Sprintf(
+					`{"id":%v,"small":%v,"medium":%v,"as":[%v],"b":"%v","c":%v,"d":%v,"e":%v,"g":"%v","nested_stuff":null}`,
+					100+i, i%100, i*3, i, strings.Repeat("x", i%10), i, i%2 == 0, i/10, "same",
+				))
+			}
+
+			var inputBatch service.MessageBatch
+			for _, d := range inputDocs {
+				inputBatch = append(inputBatch, service.NewMessage([]byte(d)))
+			}
+
+			encodedBatches, err := encodeProc.ProcessBatch(context.Background(), inputBatch)
+			require.NoError(t, err)
+			require.Len(t, encodedBatches, 1)
+			require.Len(t, encodedBatches[0], 1)
+
+			decodeConf, err := orcDecodeProcessorConfig().ParseYAML(``, nil)
+			require.NoError(t, err)
+			require.NotNil(t, decodeConf)
+
+			decodedBatch, err := (&orcDecodeProcessor{}).Process(context.Background(), encodedBatches[0][0])
+			require.NoError(t, err)
+			require.Len(t, decodedBatch, len(inputDocs))
+
+			for i, m := range decodedBatch {
+				v, err := m.AsStructured()
+				require.NoError(t, err)
+
+				// Binary fields are decoded as raw bytes.
+				obj := v.(map[string]any)
+				obj["b"] = string(obj["b"].([]byte))
+
+				actBytes, err := json.Marshal(obj)
+				require.NoError(t, err)
+
+				expected := inputDocs[i]
+				if i == 2 {
+					expected = `{"id":13,"small":0,"medium":0,"as":[],"b":"","c":-1,"d":true,"e":null,"g":"","nested_stuff":{"a_stuff":"another value","b_stuff":null}}`
+				}
+				assert.JSONEq(t, expected, string(actBytes), i)
+			}
+		})
+	}
+}
+
+func TestORCEncodeErrors(t *testing.T) {
+	encodeConf, err := orcEncodeProcessorConfig().ParseYAML(`
+schema:
+  - { name: id, type: INT }
+  - { name: name, type: STRING }
+`, nil)
+	require.NoError(t, err)
+
+	encodeProc, err := newORCEncodeProcessorFromConfig(encodeConf)
+	require.NoError(t, err)
+
+	tests := []struct {
+		input  string
+		errStr string
+	}{
+		{input: `{"name":"foo"}`, errStr: "field id is required"},
+		{input: `{"id":"nope","name":"foo"}`, errStr: "expected integer value"},
+		{input: `{"id":5000000000,"name":"foo"}`, errStr: "overflows INT"},
+		{input: `{"id":5,"name":10}`, errStr: "expected string value"},
+		{input: `["not","an","object"]`, errStr: "as ORC struct"},
+	}
+	for _, test := range tests {
+		_, err = encodeProc.ProcessBatch(context.Background(), service.MessageBatch{
+			service.NewMessage([]byte(test.input)),
+		})
+		require.Error(t, err, test.input)
+		assert.Contains(t, err.Error(), test.errStr, test.input)
+	}
+
+	encodeConf, err = orcEncodeProcessorConfig().ParseYAML(`
+schema:
+  - { name: id, type: INT, repeated: true, optional: true }
+`, nil)
+	require.NoError(t, err)
+
+	_, err = newORCEncodeProcessorFromConfig(encodeConf)
+	require.Error(t, err)
+}
+
+func TestORCDecodeInvalid(t *testing.T) {
+	_, err := (&orcDecodeProcessor{}).Process(context.Background(), service.NewMessage([]byte(`not an orc file`)))
+	require.Error(t, err)
+}
+
+func TestORCToFloat64(t *testing.T) {
+	for _, v := range []any{
+		int(3), int32(3), int64(3), uint32(3), uint64(3), float32(3), float64(3), json.Number("3"),
+	} {
+		f, err := toFloat64(v)
+		require.NoError(t, err, "%T", v)
+		assert.Equal(t, float64(3), f, "%T", v)
+	}
+
+	_, err := toFloat64("3")
+	require.Error(t, err)
+}
@@ -0,0 +1,464 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The structures within this file are hand rolled subsets of the ORC protobuf
+// definitions (orc_proto.proto), covering only the fields we read or write.
+
+type compressionKind uint64
+
+const (
+	compressionNone   compressionKind = 0
+	compressionZlib   compressionKind = 1
+	compressionSnappy compressionKind = 2
+	compressionLzo    compressionKind = 3
+	compressionLz4    compressionKind = 4
+	compressionZstd   compressionKind = 5
+)
+
+type typeKind uint64
+
+const (
+	kindBoolean   typeKind = 0
+	kindByte      typeKind = 1
+	kindShort     typeKind = 2
+	kindInt       typeKind = 3
+	kindLong      typeKind = 4
+	kindFloat     typeKind = 5
+	kindDouble    typeKind = 6
+	kindString    typeKind = 7
+	kindBinary    typeKind = 8
+	kindTimestamp typeKind = 9
+	kindList      typeKind = 10
+	kindMap       typeKind = 11
+	kindStruct    typeKind = 12
+	kindUnion     typeKind = 13
+	kindDecimal   typeKind = 14
+	kindDate      typeKind = 15
+	kindVarchar   typeKind = 16
+	kindChar      typeKind = 17
+)
+
+type streamKind uint64
+
+const (
+	streamPresent        streamKind = 0
+	streamData           streamKind = 1
+	streamLength         streamKind = 2
+	streamDictionaryData streamKind = 3
+	streamSecondary      streamKind = 5
+)
+
+type encodingKind uint64
+
+const (
+	encodingDirect       encodingKind = 0
+	encodingDictionary   encodingKind = 1
+	encodingDirectV2     encodingKind = 2
+	encodingDictionaryV2 encodingKind = 3
+)
+
+type postScript struct {
+	footerLength         uint64
+	compression          compressionKind
+	compressionBlockSize uint64
+	version              []uint64
+	metadataLength       uint64
+	writerVersion        uint64
+	magic                string
+}
+
+type stripeInformation struct {
+	offset       uint64
+	indexLength  uint64
+	dataLength   uint64
+	footerLength uint64
+	numberOfRows uint64
+}
+
+type orcType struct {
+	kind       typeKind
+	subtypes   []uint64
+	fieldNames []string
+}
+
+type columnStatistics struct {
+	numberOfValues uint64
+	hasNull        bool
+}
+
+type footer struct {
+	headerLength   uint64
+	contentLength  uint64
+	stripes        []stripeInformation
+	types          []orcType
+	numberOfRows   uint64
+	statistics     []columnStatistics
+	rowIndexStride uint64
+}
+
+type stream struct {
+	kind   streamKind
+	column uint64
+	length uint64
+}
+
+type columnEncoding struct {
+	kind           encodingKind
+	dictionarySize uint64
+}
+
+type stripeFooter struct {
+	streams []stream
+	columns []columnEncoding
+}
+
+//------------------------------------------------------------------------------
+
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBytesField(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendPackedField(b []byte, num protowire.Number, vs []uint64) []byte {
+	if len(vs) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, v := range vs {
+		packed = protowire.AppendVarint(packed, v)
+	}
+	return appendBytesField(b, num, packed)
+}
+
+func (p *postScript) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, p.footerLength)
+	b = appendVarintField(b, 2, uint64(p.compression))
+	b = appendVarintField(b, 3, p.compressionBlockSize)
+	b = appendPackedField(b, 4, p.version)
+	b = appendVarintField(b, 5, p.metadataLength)
+	b = appendVarintField(b, 6, p.writerVersion)
+	b = appendBytesField(b, 8000, []byte(p.magic))
+	return b
+}
+
+func (s *stripeInformation) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, s.offset)
+	b = appendVarintField(b, 2, s.indexLength)
+	b = appendVarintField(b, 3, s.dataLength)
+	b = appendVarintField(b, 4, s.footerLength)
+	b = appendVarintField(b, 5, s.numberOfRows)
+	return b
+}
+
+func (t *orcType) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(t.kind))
+	b = appendPackedField(b, 2, t.subtypes)
+	for _, n := range t.fieldNames {
+		b = appendBytesField(b, 3, []byte(n))
+	}
+	return b
+}
+
+func (c *columnStatistics) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, c.numberOfValues)
+	hasNull := uint64(0)
+	if c.hasNull {
+		hasNull = 1
+	}
+	b = appendVarintField(b, 10, hasNull)
+	return b
+}
+
+func (f *footer) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, f.headerLength)
+	b = appendVarintField(b, 2, f.contentLength)
+	for _, s := range f.stripes {
+		b = appendBytesField(b, 3, s.marshal())
+	}
+	for _, t := range f.types {
+		b = appendBytesField(b, 4, t.marshal())
+	}
+	b = appendVarintField(b, 6, f.numberOfRows)
+	for _, s := range f.statistics {
+		b = appendBytesField(b, 7, s.marshal())
+	}
+	b = appendVarintField(b, 8, f.rowIndexStride)
+	return b
+}
+
+func (s *stream) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(s.kind))
+	b = appendVarintField(b, 2, s.column)
+	b = appendVarintField(b, 3, s.length)
+	return b
+}
+
+func (c *columnEncoding) marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(c.kind))
+	if c.dictionarySize > 0 {
+		b = appendVarintField(b, 2, c.dictionarySize)
+	}
+	return b
+}
+
+func (s *stripeFooter) marshal() []byte {
+	var b []byte
+	for _, st := range s.streams {
+		b = appendBytesField(b, 1, st.marshal())
+	}
+	for _, c := range s.columns {
+		b = appendBytesField(b, 2, c.marshal())
+	}
+	return b
+}
+
+//------------------------------------------------------------------------------
+
+var errMalformedProto = errors.New("malformed protobuf message")
+
+// walkProto calls fn for every field of a protobuf message. Varint fields are
+// provided via v, length delimited fields via b, all other wire types are
+// skipped.
+func walkProto(data []byte, fn func(num protowire.Number, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errMalformedProto
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			data = data[n:]
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			data = data[n:]
+			if err := fn(num, 0, v); err != nil {
+				return err
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return errMalformedProto
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
+
+// appendRepeatedUint handles both packed and unpacked encodings of a repeated
+// varint field.
+func appendRepeatedUint(vs []uint64, v uint64, b []byte) ([]uint64, error) {
+	if b == nil {
+		return append(vs, v), nil
+	}
+	for len(b) > 0 {
+		pv, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, errMalformedProto
+		}
+		b = b[n:]
+		vs = append(vs, pv)
+	}
+	return vs, nil
+}
+
+func unmarshalPostScript(data []byte) (p postScript, err error) {
+	err = walkProto(data, func(num protowire.Number, v uint64, b []byte) (err error) {
+		switch num {
+		case 1:
+			p.footerLength = v
+		case 2:
+			p.compression = compressionKind(v)
+		case 3:
+			p.compressionBlockSize = v
+		case 4:
+			p.version, err = appendRepeatedUint(p.version, v, b)
+		case 5:
+			p.metadataLength = v
+		case 6:
+			p.writerVersion = v
+		case 8000:
+			p.magic = string(b)
+		}
+		return
+	})
+	return
+}
+
+func unmarshalFooter(data []byte) (f footer, err error) {
+	err = walkProto(data, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			f.headerLength = v
+		case 2:
+			f.contentLength = v
+		case 3:
+			var s stripeInformation
+			if err := walkProto(b, func(num protowire.Number, v uint64, _ []byte) error {
+				switch num {
+				case 1:
+					s.offset = v
+				case 2:
+					s.indexLength = v
+				case 3:
+					s.dataLength = v
+				case 4:
+					s.footerLength = v
+				case 5:
+					s.numberOfRows = v
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			f.stripes = append(f.stripes, s)
+		case 4:
+			var t orcType
+			if err := walkProto(b, func(num protowire.Number, v uint64, b []byte) (err error) {
+				switch num {
+				case 1:
+					t.kind = typeKind(v)
+				case 2:
+					t.subtypes, err = appendRepeatedUint(t.subtypes, v, b)
+				case 3:
+					t.fieldNames = append(t.fieldNames, string(b))
+				}
+				return
+			}); err != nil {
+				return err
+			}
+			f.types = append(f.types, t)
+		case 6:
+			f.numberOfRows = v
+		case 8:
+			f.rowIndexStride = v
+		}
+		return nil
+	})
+	return
+}
+
+func unmarshalStripeFooter(data []byte) (f stripeFooter, err error) {
+	err = walkProto(data, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			var s stream
+			if err := walkProto(b, func(num protowire.Number, v uint64, _ []byte) error {
+				switch num {
+				case 1:
+					s.kind = streamKind(v)
+				case 2:
+					s.column = v
+				case 3:
+					s.length = v
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			f.streams = append(f.streams, s)
+		case 2:
+			var c columnEncoding
+			if err := walkProto(b, func(num protowire.Number, v uint64, _ []byte) error {
+				switch num {
+				case 1:
+					c.kind = encodingKind(v)
+				case 2:
+					c.dictionarySize = v
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			f.columns = append(f.columns, c)
+		}
+		return nil
+	})
+	return
+}
+
+func (k typeKind) String() string {
+	switch k {
+	case kindBoolean:
+		return "BOOLEAN"
+	case kindByte:
+		return "TINYINT"
+	case kindShort:
+		return "SMALLINT"
+	case kindInt:
+		return "INT"
+	case kindLong:
+		return "BIGINT"
+	case kindFloat:
+		return "FLOAT"
+	case kindDouble:
+		return "DOUBLE"
+	case kindString:
+		return "STRING"
+	case kindBinary:
+		return "BINARY"
+	case kindTimestamp:
+		return "TIMESTAMP"
+	case kindList:
+		return "LIST"
+	case kindMap:
+		return "MAP"
+	case kindStruct:
+		return "STRUCT"
+	case kindUnion:
+		return "UNION"
+	case kindDecimal:
+		return "DECIMAL"
+	case kindDate:
+		return "DATE"
+	case kindVarchar:
+		return "VARCHAR"
+	case kindChar:
+		return "CHAR"
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", uint64(k))
+}
@@ -0,0 +1,465 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Timestamps are stored as seconds relative to 2015-01-01 00:00:00.
+const orcTimestampBase = 1420070400
+
+// The maximum number of values decoded from a column of a stripe, which bounds
+// the memory allocated from lengths and counts read from untrusted files.
+const maxColumnValues = 1 << 24
+
+type fileReader struct {
+	data      []byte
+	codec     blockCodec
+	blockSize int
+	footer    footer
+}
+
+func newFileReader(data []byte) (*fileReader, error) {
+	if len(data) < len(orcMagic)+1 {
+		return nil, errors.New("data is too short to be an ORC file")
+	}
+
+	psLen := int(data[len(data)-1])
+	psEnd := len(data) - 1
+	if psLen > psEnd {
+		return nil, errors.New("invalid ORC postscript length")
+	}
+	ps, err := unmarshalPostScript(data[psEnd-psLen : psEnd])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postscript: %w", err)
+	}
+	if ps.magic != orcMagic {
+		return nil, errors.New("postscript is missing the ORC magic")
+	}
+
+	if ps.compressionBlockSize > maxCompressionBlockSize {
+		return nil, fmt.Errorf("compression block size %v exceeds the maximum of %v", ps.compressionBlockSize, maxCompressionBlockSize)
+	}
+	r := &fileReader{
+		data:      data,
+		blockSize: int(ps.compressionBlockSize),
+	}
+	if r.blockSize == 0 {
+		r.blockSize = defaultCompressionBlockSize
+	}
+	if r.codec, err = newBlockCodec(ps.compression); err != nil {
+		return nil, err
+	}
+
+	footerEnd := psEnd - psLen
+	if ps.footerLength > uint64(footerEnd) {
+		return nil, errors.New("invalid ORC footer length")
+	}
+	footerBytes, err := decompressStream(r.codec, r.blockSize, data[footerEnd-int(ps.footerLength):footerEnd])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read footer: %w", err)
+	}
+	if r.footer, err = unmarshalFooter(footerBytes); err != nil {
+		return nil, fmt.Errorf("failed to parse footer: %w", err)
+	}
+	if len(r.footer.types) == 0 || r.footer.types[0].kind != kindStruct {
+		return nil, errors.New("root type of ORC file must be a struct")
+	}
+
+	// Types are listed in pre-order, and therefore the subtypes of a type
+	// always follow it, which prevents cycles when reading nested columns.
+	for id, t := range r.footer.types {
+		for _, child := range t.subtypes {
+			if child <= uint64(id) || child >= uint64(len(r.footer.types)) {
+				return nil, fmt.Errorf("type %v has an invalid subtype %v", id, child)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *fileReader) slice(offset, length uint64) ([]byte, error) {
+	if offset+length > uint64(len(r.data)) || offset+length < offset {
+		return nil, errors.New("section exceeds file bounds")
+	}
+	return r.data[offset : offset+length], nil
+}
+
+// readRows decodes all rows of all stripes within the file.
+func (r *fileReader) readRows() ([]any, error) {
+	var rows []any
+	for i, s := range r.footer.stripes {
+		if s.numberOfRows > maxColumnValues {
+			return nil, fmt.Errorf("stripe %v: number of rows %v exceeds the maximum of %v", i, s.numberOfRows, maxColumnValues)
+		}
+		sr, err := r.stripe(s)
+		if err != nil {
+			return nil, fmt.Errorf("stripe %v: %w", i, err)
+		}
+		values, err := sr.readColumn(0, int(s.numberOfRows))
+		if err != nil {
+			return nil, fmt.Errorf("stripe %v: %w", i, err)
+		}
+		rows = append(rows, values...)
+	}
+	return rows, nil
+}
+
+type streamKey struct {
+	column uint64
+	kind   streamKind
+}
+
+type stripeReader struct {
+	file      *fileReader
+	encodings []columnEncoding
+	streams   map[streamKey][]byte
+}
+
+func (r *fileReader) stripe(s stripeInformation) (*stripeReader, error) {
+	footerBytes, err := r.slice(s.offset+s.indexLength+s.dataLength, s.footerLength)
+	if err != nil {
+		return nil, err
+	}
+	if footerBytes, err = decompressStream(r.codec, r.blockSize, footerBytes); err != nil {
+		return nil, fmt.Errorf("failed to read stripe footer: %w", err)
+	}
+	sFooter, err := unmarshalStripeFooter(footerBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stripe footer: %w", err)
+	}
+
+	sr := &stripeReader{
+		file:      r,
+		encodings: sFooter.columns,
+		streams:   map[streamKey][]byte{},
+	}
+	offset := s.offset
+	for _, st := range sFooter.streams {
+		raw, err := r.slice(offset, st.length)
+		if err != nil {
+			return nil, err
+		}
+		offset += st.length
+		sr.streams[streamKey{column: st.column, kind: st.kind}] = raw
+	}
+	return sr, nil
+}
+
+func (s *stripeReader) stream(column uint64, kind streamKind) ([]byte, error) {
+	raw, exists := s.streams[streamKey{column: column, kind: kind}]
+	if !exists {
+		return nil, nil
+	}
+	return decompressStream(s.file.codec, s.file.blockSize, raw)
+}
+
+func (s *stripeReader) encoding(column uint64) encodingKind {
+	if column < uint64(len(s.encodings)) {
+		return s.encodings[column].kind
+	}
+	return encodingDirect
+}
+
+// readColumn decodes n values of a column, where absent values are nil.
+func (s *stripeReader) readColumn(id uint64, n int) ([]any, error) {
+	if id >= uint64(len(s.file.footer.types)) {
+		return nil, fmt.Errorf("column %v does not exist", id)
+	}
+	if n < 0 || n > maxColumnValues {
+		return nil, fmt.Errorf("column %v: number of values %v exceeds the maximum of %v", id, n, maxColumnValues)
+	}
+	t := s.file.footer.types[id]
+
+	present := make([]bool, n)
+	count := n
+	presentData, err := s.stream(id, streamPresent)
+	if err != nil {
+		return nil, err
+	}
+	if presentData != nil {
+		if present, err = decodeBooleanRLE(presentData, n); err != nil {
+			return nil, fmt.Errorf("column %v present stream: %w", id, err)
+		}
+		count = 0
+		for _, p := range present {
+			if p {
+				count++
+			}
+		}
+	} else {
+		for i := range present {
+			present[i] = true
+		}
+	}
+
+	values, err := s.readValues(id, t, count)
+	if err != nil {
+		return nil, fmt.Errorf("column %v (%v): %w", id, t.kind, err)
+	}
+	if len(values) != count {
+		return nil, fmt.Errorf("column %v (%v): expected %v values, got %v", id, t.kind, count, len(values))
+	}
+	if count == n {
+		return values, nil
+	}
+
+	out := make([]any, n)
+	j := 0
+	for i, p := range present {
+		if p {
+			out[i] = values[j]
+			j++
+		}
+	}
+	return out, nil
+}
+
+func (s *stripeReader) readValues(id uint64, t orcType, count int) ([]any, error) {
+	enc := s.encoding(id)
+	data, err := s.stream(id, streamData)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, count)
+	switch t.kind {
+	case kindBoolean:
+		bools, err := decodeBooleanRLE(data, count)
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range bools {
+			values[i] = b
+		}
+
+	case kindByte:
+		bytes, err := decodeByteRLE(data, count)
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range bytes {
+			values[i] = int64(int8(b))
+		}
+
+	case kindShort, kindInt, kindLong, kindDate:
+		ints, err := decodeIntRLE(enc, data, count, true)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range ints {
+			if t.kind == kindDate {
+				values[i] = time.Unix(v*86400, 0).UTC().Format(time.DateOnly)
+			} else {
+				values[i] = v
+			}
+		}
+
+	case kindFloat:
+		if len(data) < count*4 {
+			return nil, errRLETruncated
+		}
+		for i := range values {
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+		}
+
+	case kindDouble:
+		if len(data) < count*8 {
+			return nil, errRLETruncated
+		}
+		for i := range values {
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:]))
+		}
+
+	case kindString, kindVarchar, kindChar, kindBinary:
+		strs, err := s.readBytes(id, enc, data, count)
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range strs {
+			if t.kind == kindBinary {
+				values[i] = b
+			} else {
+				values[i] = string(b)
+			}
+		}
+
+	case kindTimestamp:
+		seconds, err := decodeIntRLE(enc, data, count, true)
+		if err != nil {
+			return nil, err
+		}
+		secondary, err := s.stream(id, streamSecondary)
+		if err != nil {
+			return nil, err
+		}
+		nanos, err := decodeIntRLE(enc, secondary, count, false)
+		if err != nil {
+			return nil, err
+		}
+		for i := range values {
+			ns := nanos[i] >> 3
+			if zeros := nanos[i] & 0x07; zeros != 0 {
+				for j := int64(0); j <= zeros; j++ {
+					ns *= 10
+				}
+			}
+			values[i] = time.Unix(orcTimestampBase+seconds[i], ns).UTC()
+		}
+
+	case kindStruct:
+		if len(t.subtypes) != len(t.fieldNames) {
+			return nil, errors.New("struct field names do not match subtypes")
+		}
+		for i := range values {
+			values[i] = make(map[string]any, len(t.subtypes))
+		}
+		for i, child := range t.subtypes {
+			childValues, err := s.readColumn(child, count)
+			if err != nil {
+				return nil, err
+			}
+			for j, v := range childValues {
+				values[j].(map[string]any)[t.fieldNames[i]] = v
+			}
+		}
+
+	case kindList, kindMap:
+		lengthData, err := s.stream(id, streamLength)
+		if err != nil {
+			return nil, err
+		}
+		lengths, err := decodeIntRLE(enc, lengthData, count, false)
+		if err != nil {
+			return nil, err
+		}
+		total := 0
+		for _, l := range lengths {
+			if l < 0 || l > maxColumnValues {
+				return nil, fmt.Errorf("invalid length %v", l)
+			}
+			if total += int(l); total > maxColumnValues {
+				return nil, fmt.Errorf("number of elements exceeds the maximum of %v", maxColumnValues)
+			}
+		}
+
+		if t.kind == kindList {
+			if len(t.subtypes) != 1 {
+				return nil, errors.New("list type must have exactly one subtype")
+			}
+			elements, err := s.readColumn(t.subtypes[0], total)
+			if err != nil {
+				return nil, err
+			}
+			for i, l := range lengths {
+				values[i], elements = elements[:l:l], elements[l:]
+			}
+			break
+		}
+
+		if len(t.subtypes) != 2 {
+			return nil, errors.New("map type must have exactly two subtypes")
+		}
+		keys, err := s.readColumn(t.subtypes[0], total)
+		if err != nil {
+			return nil, err
+		}
+		vals, err := s.readColumn(t.subtypes[1], total)
+		if err != nil {
+			return nil, err
+		}
+		for i, l := range lengths {
+			m := make(map[string]any, l)
+			for j := 0; j < int(l); j++ {
+				k := keys[j]
+				if ks, ok := k.(string); ok {
+					m[ks] = vals[j]
+				} else {
+					m[fmt.Sprintf("%v", k)] = vals[j]
+				}
+			}
+			keys, vals = keys[l:], vals[l:]
+			values[i] = m
+		}
+
+	default:
+		return nil, fmt.Errorf("reading type %v is not supported", t.kind)
+	}
+	return values, nil
+}
+
+func (s *stripeReader) readBytes(id uint64, enc encodingKind, data []byte, count int) ([][]byte, error) {
+	lengthData, err := s.stream(id, streamLength)
+	if err != nil {
+		return nil, err
+	}
+
+	switch enc {
+	case encodingDirect, encodingDirectV2:
+		lengths, err := decodeIntRLE(enc, lengthData, count, false)
+		if err != nil {
+			return nil, err
+		}
+		return splitByLengths(data, lengths)
+
+	case encodingDictionary, encodingDictionaryV2:
+		// The encoding can only be a dictionary when the column has one.
+		dictSize := s.encodings[id].dictionarySize
+		if dictSize > maxColumnValues {
+			return nil, fmt.Errorf("dictionary size %v exceeds the maximum of %v", dictSize, maxColumnValues)
+		}
+		lengths, err := decodeIntRLE(enc, lengthData, int(dictSize), false)
+		if err != nil {
+			return nil, err
+		}
+		dictData, err := s.stream(id, streamDictionaryData)
+		if err != nil {
+			return nil, err
+		}
+		dict, err := splitByLengths(dictData, lengths)
+		if err != nil {
+			return nil, err
+		}
+		indexes, err := decodeIntRLE(enc, data, count, false)
+		if err != nil {
+			return nil, err
+		}
+		out := make([][]byte, count)
+		for i, idx := range indexes {
+			if idx < 0 || idx >= int64(len(dict)) {
+				return nil, fmt.Errorf("dictionary index %v out of bounds", idx)
+			}
+			out[i] = dict[idx]
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("column encoding %d is not supported", uint64(enc))
+}
+
+func splitByLengths(data []byte, lengths []int64) ([][]byte, error) {
+	out := make([][]byte, len(lengths))
+	for i, l := range lengths {
+		if l < 0 || l > int64(len(data)) {
+			return nil, errRLETruncated
+		}
+		out[i], data = data[:l:l], data[l:]
+	}
+	return out, nil
+}
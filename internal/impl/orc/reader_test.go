@@ -0,0 +1,185 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testORCFile(t testing.TB, compression compressionKind) []byte {
+	t.Helper()
+
+	root := &schemaNode{kind: kindStruct, children: []*schemaNode{
+		{name: "id", kind: kindLong},
+		{name: "name", kind: kindString, optional: true},
+		{name: "score", kind: kindDouble},
+		{name: "tags", kind: kindList, children: []*schemaNode{
+			{kind: kindString},
+		}},
+		{name: "nested", kind: kindStruct, optional: true, children: []*schemaNode{
+			{name: "flag", kind: kindBoolean},
+			{name: "raw", kind: kindBinary},
+		}},
+	}}
+
+	var rows []any
+	for i := 0; i < 20; i++ {
+		row := map[string]any{
+			"id":    int64(i * 7),
+			"score": float64(i) / 3,
+			"tags":  []any{"a", "b"},
+		}
+		if i%3 != 0 {
+			row["name"] = "same"
+			row["nested"] = map[string]any{"flag": i%2 == 0, "raw": []byte("foo")}
+		}
+		rows = append(rows, row)
+	}
+
+	data, err := writeFile(root, rows, compression)
+	require.NoError(t, err)
+	return data
+}
+
+func TestORCFileReaderInvalid(t *testing.T) {
+	data := testORCFile(t, compressionNone)
+
+	r, err := newFileReader(data)
+	require.NoError(t, err)
+	rows, err := r.readRows()
+	require.NoError(t, err)
+	require.Len(t, rows, 20)
+
+	// Truncating the file at any point must result in an error rather than a
+	// panic.
+	for i := 0; i < len(data); i++ {
+		if r, err := newFileReader(data[i:]); err == nil {
+			_, _ = r.readRows()
+		}
+		if r, err := newFileReader(data[:i]); err == nil {
+			_, _ = r.readRows()
+		}
+	}
+}
+
+// rewriteORCTail modifies the footer and postscript of an uncompressed file.
+func rewriteORCTail(t testing.TB, data []byte, fn func(f *footer, ps *postScript)) []byte {
+	t.Helper()
+
+	r, err := newFileReader(data)
+	require.NoError(t, err)
+
+	psLen := int(data[len(data)-1])
+	ps, err := unmarshalPostScript(data[len(data)-1-psLen : len(data)-1])
+	require.NoError(t, err)
+	require.Equal(t, compressionNone, ps.compression)
+
+	f := r.footer
+	fn(&f, &ps)
+
+	footerBytes := f.marshal()
+	ps.footerLength = uint64(len(footerBytes))
+	psBytes := ps.marshal()
+
+	out := append([]byte{}, data[:len(data)-1-psLen-len(r.footer.marshal())]...)
+	out = append(out, footerBytes...)
+	out = append(out, psBytes...)
+	return append(out, byte(len(psBytes)))
+}
+
+func TestORCFileReaderLimits(t *testing.T) {
+	data := testORCFile(t, compressionNone)
+
+	// Sanity check that rewriting the tail is lossless.
+	r, err := newFileReader(rewriteORCTail(t, data, func(*footer, *postScript) {}))
+	require.NoError(t, err)
+	rows, err := r.readRows()
+	require.NoError(t, err)
+	assert.Len(t, rows, 20)
+
+	_, err = newFileReader(rewriteORCTail(t, data, func(f *footer, _ *postScript) {
+		f.types[5].subtypes = []uint64{0}
+	}))
+	require.ErrorContains(t, err, "invalid subtype")
+
+	_, err = newFileReader(rewriteORCTail(t, data, func(f *footer, _ *postScript) {
+		f.types[0].subtypes[0] = uint64(len(f.types))
+	}))
+	require.ErrorContains(t, err, "invalid subtype")
+
+	_, err = newFileReader(rewriteORCTail(t, data, func(_ *footer, ps *postScript) {
+		ps.compressionBlockSize = 1 << 40
+	}))
+	require.ErrorContains(t, err, "compression block size")
+
+	r, err = newFileReader(rewriteORCTail(t, data, func(f *footer, _ *postScript) {
+		f.stripes[0].numberOfRows = 1 << 62
+	}))
+	require.NoError(t, err)
+	_, err = r.readRows()
+	require.ErrorContains(t, err, "number of rows")
+}
+
+func TestORCReadInvalidListLengths(t *testing.T) {
+	sr := &stripeReader{
+		file: &fileReader{footer: footer{types: []orcType{
+			{kind: kindList, subtypes: []uint64{1}},
+			{kind: kindLong},
+		}}},
+		streams: map[streamKey][]byte{
+			{column: 0, kind: streamLength}: encodeIntRLEv1([]int64{1, -1}, false),
+			{column: 1, kind: streamData}:   encodeIntRLEv1([]int64{1}, true),
+		},
+	}
+	_, err := sr.readColumn(0, 2)
+	require.ErrorContains(t, err, "invalid length")
+
+	sr.streams[streamKey{column: 0, kind: streamLength}] = encodeIntRLEv1([]int64{maxColumnValues, 1}, false)
+	_, err = sr.readColumn(0, 2)
+	require.ErrorContains(t, err, "exceeds the maximum")
+}
+
+func TestORCDecompressLimits(t *testing.T) {
+	for _, c := range []compressionKind{compressionZlib, compressionSnappy, compressionLz4, compressionZstd} {
+		codec, err := newBlockCodec(c)
+		require.NoError(t, err)
+
+		compressed, err := compressStream(codec, 1<<20, make([]byte, 1<<20))
+		require.NoError(t, err)
+
+		_, err = decompressStream(codec, 1<<20, compressed)
+		require.NoError(t, err, c)
+
+		_, err = decompressStream(codec, 1024, compressed)
+		require.Error(t, err, c)
+	}
+}
+
+func FuzzFileReader(f *testing.F) {
+	for _, c := range []compressionKind{compressionNone, compressionZlib, compressionSnappy, compressionLz4, compressionZstd} {
+		f.Add(testORCFile(f, c))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := newFileReader(data)
+		if err != nil {
+			return
+		}
+		_, _ = r.readRows()
+	})
+}
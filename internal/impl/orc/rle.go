@@ -0,0 +1,519 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Run length encodings as described in the ORC specification:
+// https://orc.apache.org/specification/ORCv1/#run-length-encoding
+
+const (
+	rleMinRun         = 3
+	rleMaxRun         = 127 + rleMinRun
+	rleMaxLiterals    = 128
+	rleMaxDelta       = 127
+	rleMinDelta       = -128
+	rleV2ShortRepeat  = 0
+	rleV2Direct       = 1
+	rleV2PatchedBase  = 2
+	rleV2Delta        = 3
+	rleV2PatchGapSkip = 255
+)
+
+//------------------------------------------------------------------------------
+
+func encodeByteRLE(values []byte) []byte {
+	var out, literals []byte
+	flushLiterals := func() {
+		if len(literals) == 0 {
+			return
+		}
+		out = append(out, byte(-int8(len(literals))))
+		out = append(out, literals...)
+		literals = literals[:0]
+	}
+
+	for i := 0; i < len(values); {
+		runLen := 1
+		for i+runLen < len(values) && runLen < rleMaxRun && values[i+runLen] == values[i] {
+			runLen++
+		}
+		if runLen >= rleMinRun {
+			flushLiterals()
+			out = append(out, byte(runLen-rleMinRun), values[i])
+			i += runLen
+			continue
+		}
+		literals = append(literals, values[i])
+		if len(literals) == rleMaxLiterals {
+			flushLiterals()
+		}
+		i++
+	}
+	flushLiterals()
+	return out
+}
+
+func encodeBooleanRLE(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return encodeByteRLE(packed)
+}
+
+func appendIntVarint(b []byte, v int64, signed bool) []byte {
+	if signed {
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+	}
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// encodeIntRLEv1 encodes integers using version 1 of the integer run length
+// encoding, which is understood by all ORC readers.
+func encodeIntRLEv1(values []int64, signed bool) []byte {
+	var out []byte
+	var literals []int64
+	flushLiterals := func() {
+		if len(literals) == 0 {
+			return
+		}
+		out = append(out, byte(-int8(len(literals))))
+		for _, l := range literals {
+			out = appendIntVarint(out, l, signed)
+		}
+		literals = literals[:0]
+	}
+
+	for i := 0; i < len(values); {
+		runLen, delta := 1, int64(0)
+		if i+1 < len(values) {
+			if delta = values[i+1] - values[i]; delta >= rleMinDelta && delta <= rleMaxDelta {
+				runLen = 2
+				for i+runLen < len(values) && runLen < rleMaxRun && values[i+runLen]-values[i+runLen-1] == delta {
+					runLen++
+				}
+			}
+		}
+		if runLen >= rleMinRun {
+			flushLiterals()
+			out = append(out, byte(runLen-rleMinRun), byte(int8(delta)))
+			out = appendIntVarint(out, values[i], signed)
+			i += runLen
+			continue
+		}
+		literals = append(literals, values[i])
+		if len(literals) == rleMaxLiterals {
+			flushLiterals()
+		}
+		i++
+	}
+	flushLiterals()
+	return out
+}
+
+//------------------------------------------------------------------------------
+
+var errRLETruncated = errors.New("run length encoded stream ended unexpectedly")
+
+type rleReader struct {
+	data []byte
+	pos  int
+
+	bitsLeft int
+	current  byte
+}
+
+func (r *rleReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errRLETruncated
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *rleReader) readUvarint() (uint64, error) {
+	v, n := protowire.ConsumeVarint(r.data[r.pos:])
+	if n < 0 {
+		return 0, errRLETruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *rleReader) readVarint(signed bool) (int64, error) {
+	v, err := r.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if signed {
+		return protowire.DecodeZigZag(v), nil
+	}
+	return int64(v), nil
+}
+
+func (r *rleReader) readBigEndian(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		b, err := r.readByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// readBitPacked reads n big endian bit packed values of the given width. Any
+// remaining bits of the final byte are discarded.
+func (r *rleReader) readBitPacked(n, width int) ([]uint64, error) {
+	values := make([]uint64, n)
+	r.bitsLeft = 0
+	for i := range values {
+		var v uint64
+		for need := width; need > 0; {
+			if r.bitsLeft == 0 {
+				b, err := r.readByte()
+				if err != nil {
+					return nil, err
+				}
+				r.current, r.bitsLeft = b, 8
+			}
+			take := need
+			if take > r.bitsLeft {
+				take = r.bitsLeft
+			}
+			v = v<<take | uint64(r.current>>(r.bitsLeft-take))&(1<<take-1)
+			r.bitsLeft -= take
+			need -= take
+		}
+		values[i] = v
+	}
+	r.bitsLeft = 0
+	return values, nil
+}
+
+func decodeByteRLE(data []byte, n int) ([]byte, error) {
+	r := &rleReader{data: data}
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		control, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if control < 0x80 {
+			v, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < int(control)+rleMinRun; i++ {
+				out = append(out, v)
+			}
+			continue
+		}
+		for i := 0; i < 0x100-int(control); i++ {
+			v, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out[:n], nil
+}
+
+func decodeBooleanRLE(data []byte, n int) ([]bool, error) {
+	packed, err := decodeByteRLE(data, (n+7)/8)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]bool, n)
+	for i := range out {
+		out[i] = packed[i/8]&(0x80>>(i%8)) != 0
+	}
+	return out, nil
+}
+
+func decodeIntRLEv1(data []byte, n int, signed bool) ([]int64, error) {
+	r := &rleReader{data: data}
+	out := make([]int64, 0, n)
+	for len(out) < n {
+		control, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if control < 0x80 {
+			deltaB, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.readVarint(signed)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < int(control)+rleMinRun; i++ {
+				out = append(out, v)
+				v += int64(int8(deltaB))
+			}
+			continue
+		}
+		for i := 0; i < 0x100-int(control); i++ {
+			v, err := r.readVarint(signed)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out[:n], nil
+}
+
+//------------------------------------------------------------------------------
+
+func decodeBitWidth(code byte) int {
+	switch {
+	case code <= 23:
+		return int(code) + 1
+	case code == 24:
+		return 26
+	case code == 25:
+		return 28
+	case code == 26:
+		return 30
+	case code == 27:
+		return 32
+	case code == 28:
+		return 40
+	case code == 29:
+		return 48
+	case code == 30:
+		return 56
+	}
+	return 64
+}
+
+func closestFixedBits(n int) int {
+	switch {
+	case n == 0:
+		return 1
+	case n <= 24:
+		return n
+	case n <= 26:
+		return 26
+	case n <= 28:
+		return 28
+	case n <= 30:
+		return 30
+	case n <= 32:
+		return 32
+	case n <= 40:
+		return 40
+	case n <= 48:
+		return 48
+	case n <= 56:
+		return 56
+	}
+	return 64
+}
+
+func zigzagIfSigned(v uint64, signed bool) int64 {
+	if signed {
+		return protowire.DecodeZigZag(v)
+	}
+	return int64(v)
+}
+
+// decodeIntRLEv2 decodes integers written with version 2 of the integer run
+// length encoding, which is the default of most ORC writers.
+func decodeIntRLEv2(data []byte, n int, signed bool) ([]int64, error) {
+	r := &rleReader{data: data}
+	out := make([]int64, 0, n)
+	for len(out) < n {
+		first, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch first >> 6 {
+		case rleV2ShortRepeat:
+			width := int((first>>3)&0x07) + 1
+			count := int(first&0x07) + rleMinRun
+			raw, err := r.readBigEndian(width)
+			if err != nil {
+				return nil, err
+			}
+			v := zigzagIfSigned(raw, signed)
+			for i := 0; i < count; i++ {
+				out = append(out, v)
+			}
+
+		case rleV2Direct:
+			second, err := r.readByte()
+			if err != nil {
+				return nil, err
+			}
+			width := decodeBitWidth((first >> 1) & 0x1f)
+			length := (int(first&0x01)<<8 | int(second)) + 1
+			raw, err := r.readBitPacked(length, width)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range raw {
+				out = append(out, zigzagIfSigned(v, signed))
+			}
+
+		case rleV2PatchedBase:
+			if out, err = r.readPatchedBase(first, out); err != nil {
+				return nil, err
+			}
+
+		case rleV2Delta:
+			if out, err = r.readDelta(first, out, signed); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(out) > n {
+		return nil, fmt.Errorf("run length encoded stream contains %v values, expected %v", len(out), n)
+	}
+	return out, nil
+}
+
+func (r *rleReader) readPatchedBase(first byte, out []int64) ([]int64, error) {
+	header, err := r.readBigEndian(3)
+	if err != nil {
+		return nil, err
+	}
+	second, third, fourth := byte(header>>16), byte(header>>8), byte(header)
+
+	width := decodeBitWidth((first >> 1) & 0x1f)
+	length := (int(first&0x01)<<8 | int(second)) + 1
+	baseWidth := int((third>>5)&0x07) + 1
+	patchWidth := decodeBitWidth(third & 0x1f)
+	patchGapWidth := int((fourth>>5)&0x07) + 1
+	patchListLen := int(fourth & 0x1f)
+
+	rawBase, err := r.readBigEndian(baseWidth)
+	if err != nil {
+		return nil, err
+	}
+	base := int64(rawBase)
+	if signMask := uint64(1) << (baseWidth*8 - 1); rawBase&signMask != 0 {
+		base = -int64(rawBase &^ signMask)
+	}
+
+	values, err := r.readBitPacked(length, width)
+	if err != nil {
+		return nil, err
+	}
+	if patchWidth+patchGapWidth > 64 {
+		return nil, errors.New("invalid patched base run, patch and gap width exceed 64 bits")
+	}
+	patches, err := r.readBitPacked(patchListLen, closestFixedBits(patchWidth+patchGapWidth))
+	if err != nil {
+		return nil, err
+	}
+
+	patchMask := uint64(1)<<patchWidth - 1
+	idx := 0
+	for _, p := range patches {
+		idx += int(p >> patchWidth)
+		if patch := p & patchMask; patch != 0 || p>>patchWidth != rleV2PatchGapSkip {
+			if idx >= length {
+				return nil, io.ErrUnexpectedEOF
+			}
+			values[idx] |= patch << width
+		}
+	}
+
+	for _, v := range values {
+		out = append(out, base+int64(v))
+	}
+	return out, nil
+}
+
+func (r *rleReader) readDelta(first byte, out []int64, signed bool) ([]int64, error) {
+	second, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	width := 0
+	if code := (first >> 1) & 0x1f; code != 0 {
+		width = decodeBitWidth(code)
+	}
+	length := (int(first&0x01)<<8 | int(second)) + 1
+
+	v, err := r.readVarint(signed)
+	if err != nil {
+		return nil, err
+	}
+	deltaBase, err := r.readVarint(true)
+	if err != nil {
+		return nil, err
+	}
+
+	out = append(out, v)
+	if length == 1 {
+		return out, nil
+	}
+
+	v += deltaBase
+	out = append(out, v)
+	if width == 0 {
+		for i := 2; i < length; i++ {
+			v += deltaBase
+			out = append(out, v)
+		}
+		return out, nil
+	}
+
+	deltas, err := r.readBitPacked(length-2, width)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deltas {
+		if d > math.MaxInt64 {
+			return nil, errors.New("delta run value exceeds int64")
+		}
+		if deltaBase < 0 {
+			v -= int64(d)
+		} else {
+			v += int64(d)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func decodeIntRLE(enc encodingKind, data []byte, n int, signed bool) ([]int64, error) {
+	switch enc {
+	case encodingDirect, encodingDictionary:
+		return decodeIntRLEv1(data, n, signed)
+	case encodingDirectV2, encodingDictionaryV2:
+		return decodeIntRLEv2(data, n, signed)
+	}
+	return nil, fmt.Errorf("column encoding %d is not supported", uint64(enc))
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestByteRLERoundTrip(t *testing.T) {
+	input := []byte{1, 1, 1, 1, 2, 3, 4, 4, 4, 5}
+	for i := 0; i < 300; i++ {
+		input = append(input, byte(i%7))
+	}
+	for i := 0; i < 200; i++ {
+		input = append(input, 9)
+	}
+
+	output, err := decodeByteRLE(encodeByteRLE(input), len(input))
+	require.NoError(t, err)
+	assert.Equal(t, input, output)
+
+	// Examples from the ORC specification.
+	output, err = decodeByteRLE([]byte{0x61, 0x00}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, make([]byte, 100), output)
+
+	output, err = decodeByteRLE([]byte{0xfe, 0x44, 0x45}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x44, 0x45}, output)
+}
+
+func TestBooleanRLERoundTrip(t *testing.T) {
+	var input []bool
+	for i := 0; i < 123; i++ {
+		input = append(input, i%3 == 0 || i > 100)
+	}
+
+	output, err := decodeBooleanRLE(encodeBooleanRLE(input), len(input))
+	require.NoError(t, err)
+	assert.Equal(t, input, output)
+}
+
+func TestIntRLEv1RoundTrip(t *testing.T) {
+	input := []int64{0, 0, 0, 5, -5, math.MaxInt64, math.MinInt64, 1, 2, 3, 4, 5, 6, 100, 50, 0}
+	for i := 0; i < 400; i++ {
+		input = append(input, int64(i*3))
+	}
+	for i := 0; i < 200; i++ {
+		input = append(input, int64(i*i))
+	}
+
+	output, err := decodeIntRLEv1(encodeIntRLEv1(input, true), len(input), true)
+	require.NoError(t, err)
+	assert.Equal(t, input, output)
+
+	unsigned := []int64{0, 1, 2, 3, 1000, 7, 7, 7, 7}
+	output, err = decodeIntRLEv1(encodeIntRLEv1(unsigned, false), len(unsigned), false)
+	require.NoError(t, err)
+	assert.Equal(t, unsigned, output)
+
+	// Examples from the ORC specification.
+	output, err = decodeIntRLEv1([]byte{0x61, 0x00, 0x07}, 100, false)
+	require.NoError(t, err)
+	for _, v := range output {
+		require.Equal(t, int64(7), v)
+	}
+
+	output, err = decodeIntRLEv1([]byte{0xfb, 0x02, 0x03, 0x06, 0x07, 0xb}, 5, false)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 6, 7, 11}, output)
+}
+
+func TestIntRLEv2Decode(t *testing.T) {
+	// Examples from the ORC specification.
+	tests := []struct {
+		name     string
+		input    []byte
+		signed   bool
+		expected []int64
+	}{
+		{
+			name:     "short repeat",
+			input:    []byte{0x0a, 0x27, 0x10},
+			expected: []int64{10000, 10000, 10000, 10000, 10000},
+		},
+		{
+			name:     "direct",
+			input:    []byte{0x5e, 0x03, 0x5c, 0xa1, 0xab, 0x1e, 0xde, 0xad, 0xbe, 0xef},
+			expected: []int64{23713, 43806, 57005, 48879},
+		},
+		{
+			name: "patched base",
+			input: []byte{
+				0x8e, 0x13, 0x2b, 0x21, 0x07, 0xd0, 0x1e, 0x00, 0x14, 0x70, 0x28, 0x32, 0x3c, 0x46, 0x50,
+				0x5a, 0x64, 0x6e, 0x78, 0x82, 0x8c, 0x96, 0xa0, 0xaa, 0xb4, 0xbe, 0xfc, 0xe8,
+			},
+			expected: []int64{
+				2030, 2000, 2020, 1000000, 2040, 2050, 2060, 2070, 2080, 2090,
+				2100, 2110, 2120, 2130, 2140, 2150, 2160, 2170, 2180, 2190,
+			},
+		},
+		{
+			name:     "delta",
+			input:    []byte{0xc6, 0x09, 0x02, 0x02, 0x22, 0x42, 0x42, 0x46},
+			expected: []int64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29},
+		},
+		{
+			name:     "fixed delta signed",
+			input:    []byte{0xc0, 0x04, 0x01, 0x03},
+			signed:   true,
+			expected: []int64{-1, -3, -5, -7, -9},
+		},
+		{
+			name:     "short repeat signed",
+			input:    []byte{0x00, 0x03},
+			signed:   true,
+			expected: []int64{-2, -2, -2},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			output, err := decodeIntRLEv2(test.input, len(test.expected), test.signed)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, output)
+		})
+	}
+}
+
+func TestIntRLEv2Truncated(t *testing.T) {
+	_, err := decodeIntRLEv2([]byte{0x5e, 0x03, 0x5c}, 4, false)
+	require.Error(t, err)
+}
+
+func FuzzDecodeRLE(f *testing.F) {
+	f.Add(encodeByteRLE([]byte{1, 1, 1, 1, 2, 3}), uint16(6), uint8(0))
+	f.Add(encodeBooleanRLE([]bool{true, false, true}), uint16(3), uint8(0))
+	f.Add(encodeIntRLEv1([]int64{0, 0, 0, 5, -5, math.MaxInt64}, true), uint16(6), uint8(encodingDirect|4))
+	f.Add([]byte{0x0a, 0x27, 0x10}, uint16(5), uint8(encodingDirectV2))
+	f.Add([]byte{0x5e, 0x03, 0x5c, 0xa1, 0xab, 0x1e, 0xde, 0xad, 0xbe, 0xef}, uint16(4), uint8(encodingDirectV2))
+	f.Add([]byte{
+		0x8e, 0x13, 0x2b, 0x21, 0x07, 0xd0, 0x1e, 0x00, 0x14, 0x70, 0x28, 0x32, 0x3c, 0x46, 0x50, 0x5a,
+		0x64, 0x6e, 0x78, 0x82, 0x8c, 0x96, 0xa0, 0xaa, 0xb4, 0xbe, 0xfc, 0xe8,
+	}, uint16(20), uint8(encodingDirectV2|4))
+	f.Add([]byte{0xc6, 0x09, 0x02, 0x02, 0x22, 0x42, 0x42, 0x46}, uint16(10), uint8(encodingDirectV2))
+
+	f.Fuzz(func(t *testing.T, data []byte, n uint16, enc uint8) {
+		if b, err := decodeByteRLE(data, int(n)); err == nil && len(b) != int(n) {
+			t.Fatalf("byte RLE decoded %v values, expected %v", len(b), n)
+		}
+		if b, err := decodeBooleanRLE(data, int(n)); err == nil && len(b) != int(n) {
+			t.Fatalf("boolean RLE decoded %v values, expected %v", len(b), n)
+		}
+		if i, err := decodeIntRLE(encodingKind(enc&0x03), data, int(n), enc&0x04 != 0); err == nil && len(i) != int(n) {
+			t.Fatalf("integer RLE decoded %v values, expected %v", len(i), n)
+		}
+	})
+}
@@ -0,0 +1,379 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+const orcMagic = "ORC"
+
+// schemaNode describes a column of an ORC file to be written.
+type schemaNode struct {
+	name     string
+	kind     typeKind
+	optional bool
+	children []*schemaNode
+}
+
+// flatten returns the ORC type list of a schema tree in pre-order, which is
+// the order in which column IDs are assigned.
+func (s *schemaNode) flatten() []*schemaNode {
+	nodes := []*schemaNode{s}
+	for _, c := range s.children {
+		nodes = append(nodes, c.flatten()...)
+	}
+	return nodes
+}
+
+//------------------------------------------------------------------------------
+
+type columnWriter struct {
+	id     uint64
+	schema *schemaNode
+
+	present  []bool
+	hasNull  bool
+	nValues  uint64
+	bools    []bool
+	bytes    []byte
+	ints     []int64
+	data     []byte
+	lengths  []int64
+	children []*columnWriter
+}
+
+func newColumnWriter(s *schemaNode, nextID *uint64) *columnWriter {
+	w := &columnWriter{id: *nextID, schema: s}
+	*nextID++
+	for _, c := range s.children {
+		w.children = append(w.children, newColumnWriter(c, nextID))
+	}
+	return w
+}
+
+func (w *columnWriter) write(v any) error {
+	if v == nil {
+		if w.schema.kind == kindList && !w.schema.optional {
+			v = []any{}
+		} else {
+			if !w.schema.optional {
+				return fmt.Errorf("field %v is required", w.schema.name)
+			}
+			w.present = append(w.present, false)
+			w.hasNull = true
+			return nil
+		}
+	}
+	w.present = append(w.present, true)
+	w.nValues++
+
+	switch w.schema.kind {
+	case kindBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("field %v: expected boolean value, got %T", w.schema.name, v)
+		}
+		w.bools = append(w.bools, b)
+	case kindByte, kindShort, kindInt, kindLong:
+		i, err := toInt64(v)
+		if err != nil {
+			return fmt.Errorf("field %v: %w", w.schema.name, err)
+		}
+		if err := checkIntRange(w.schema.kind, i); err != nil {
+			return fmt.Errorf("field %v: %w", w.schema.name, err)
+		}
+		if w.schema.kind == kindByte {
+			w.bytes = append(w.bytes, byte(int8(i)))
+		} else {
+			w.ints = append(w.ints, i)
+		}
+	case kindFloat:
+		f, err := toFloat64(v)
+		if err != nil {
+			return fmt.Errorf("field %v: %w", w.schema.name, err)
+		}
+		w.data = binary.LittleEndian.AppendUint32(w.data, math.Float32bits(float32(f)))
+	case kindDouble:
+		f, err := toFloat64(v)
+		if err != nil {
+			return fmt.Errorf("field %v: %w", w.schema.name, err)
+		}
+		w.data = binary.LittleEndian.AppendUint64(w.data, math.Float64bits(f))
+	case kindString, kindBinary:
+		var b []byte
+		switch t := v.(type) {
+		case string:
+			b = []byte(t)
+		case []byte:
+			b = t
+		default:
+			return fmt.Errorf("field %v: expected string value, got %T", w.schema.name, v)
+		}
+		w.data = append(w.data, b...)
+		w.lengths = append(w.lengths, int64(len(b)))
+	case kindStruct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("field %v: expected object value, got %T", w.schema.name, v)
+		}
+		for _, c := range w.children {
+			if err := c.write(obj[c.schema.name]); err != nil {
+				return err
+			}
+		}
+	case kindList:
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("field %v: expected array value, got %T", w.schema.name, v)
+		}
+		w.lengths = append(w.lengths, int64(len(arr)))
+		for _, e := range arr {
+			if err := w.children[0].write(e); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("field %v: writing type %v is not supported", w.schema.name, w.schema.kind)
+	}
+	return nil
+}
+
+type encodedStream struct {
+	stream
+	data []byte
+}
+
+// streams returns the encoded streams of this column followed by those of its
+// children.
+func (w *columnWriter) streams() []encodedStream {
+	var streams []encodedStream
+	add := func(kind streamKind, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		streams = append(streams, encodedStream{
+			stream: stream{kind: kind, column: w.id, length: uint64(len(data))},
+			data:   data,
+		})
+	}
+
+	if w.hasNull {
+		add(streamPresent, encodeBooleanRLE(w.present))
+	}
+	switch w.schema.kind {
+	case kindBoolean:
+		add(streamData, encodeBooleanRLE(w.bools))
+	case kindByte:
+		add(streamData, encodeByteRLE(w.bytes))
+	case kindShort, kindInt, kindLong:
+		add(streamData, encodeIntRLEv1(w.ints, true))
+	case kindFloat, kindDouble:
+		add(streamData, w.data)
+	case kindString, kindBinary:
+		add(streamData, w.data)
+		add(streamLength, encodeIntRLEv1(w.lengths, false))
+	case kindList:
+		add(streamLength, encodeIntRLEv1(w.lengths, false))
+	}
+	for _, c := range w.children {
+		streams = append(streams, c.streams()...)
+	}
+	return streams
+}
+
+func (w *columnWriter) statistics() []columnStatistics {
+	stats := []columnStatistics{{numberOfValues: w.nValues, hasNull: w.hasNull}}
+	for _, c := range w.children {
+		stats = append(stats, c.statistics()...)
+	}
+	return stats
+}
+
+//------------------------------------------------------------------------------
+
+// writeFile encodes a slice of rows into an ORC file consisting of a single
+// stripe. All columns are written with the DIRECT encoding using version 1 of
+// the run length encodings.
+func writeFile(root *schemaNode, rows []any, compression compressionKind) ([]byte, error) {
+	codec, err := newBlockCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextID uint64
+	rootWriter := newColumnWriter(root, &nextID)
+	for i, r := range rows {
+		if _, isObj := r.(map[string]any); !isObj {
+			return nil, fmt.Errorf("unable to encode row %v of type %T as ORC struct", i, r)
+		}
+		if err := rootWriter.write(r); err != nil {
+			return nil, err
+		}
+	}
+
+	out := []byte(orcMagic)
+	stripe := stripeInformation{
+		offset:       uint64(len(out)),
+		numberOfRows: uint64(len(rows)),
+	}
+
+	var sFooter stripeFooter
+	for _, s := range rootWriter.streams() {
+		compressed, err := compressStream(codec, defaultCompressionBlockSize, s.data)
+		if err != nil {
+			return nil, err
+		}
+		s.length = uint64(len(compressed))
+		sFooter.streams = append(sFooter.streams, s.stream)
+		out = append(out, compressed...)
+		stripe.dataLength += s.length
+	}
+
+	var types []orcType
+	for i := uint64(0); i < nextID; i++ {
+		sFooter.columns = append(sFooter.columns, columnEncoding{kind: encodingDirect})
+	}
+	nodes := root.flatten()
+	ids := map[*schemaNode]uint64{}
+	for i, n := range nodes {
+		ids[n] = uint64(i)
+	}
+	for _, n := range nodes {
+		t := orcType{kind: n.kind}
+		for _, c := range n.children {
+			t.subtypes = append(t.subtypes, ids[c])
+			if n.kind == kindStruct {
+				t.fieldNames = append(t.fieldNames, c.name)
+			}
+		}
+		types = append(types, t)
+	}
+
+	sFooterBytes, err := compressStream(codec, defaultCompressionBlockSize, sFooter.marshal())
+	if err != nil {
+		return nil, err
+	}
+	stripe.footerLength = uint64(len(sFooterBytes))
+	out = append(out, sFooterBytes...)
+
+	f := footer{
+		headerLength:  uint64(len(orcMagic)),
+		contentLength: uint64(len(out) - len(orcMagic)),
+		stripes:       []stripeInformation{stripe},
+		types:         types,
+		numberOfRows:  uint64(len(rows)),
+		statistics:    rootWriter.statistics(),
+	}
+	footerBytes, err := compressStream(codec, defaultCompressionBlockSize, f.marshal())
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, footerBytes...)
+
+	ps := postScript{
+		footerLength:         uint64(len(footerBytes)),
+		compression:          compression,
+		compressionBlockSize: defaultCompressionBlockSize,
+		version:              []uint64{0, 11},
+		writerVersion:        1,
+		magic:                orcMagic,
+	}
+	psBytes := ps.marshal()
+	if len(psBytes) > math.MaxUint8 {
+		return nil, fmt.Errorf("postscript length %v exceeds limit", len(psBytes))
+	}
+	out = append(out, psBytes...)
+	out = append(out, byte(len(psBytes)))
+	return out, nil
+}
+
+//------------------------------------------------------------------------------
+
+func toInt64(v any) (int64, error) {
+	switch t := v.(type) {
+	case int:
+		return int64(t), nil
+	case int32:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case uint32:
+		return int64(t), nil
+	case uint64:
+		if t > math.MaxInt64 {
+			return 0, fmt.Errorf("value %v overflows int64", t)
+		}
+		return int64(t), nil
+	case float64:
+		if t != math.Trunc(t) {
+			return 0, fmt.Errorf("expected integer value, got %v", t)
+		}
+		return int64(t), nil
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return 0, err
+		}
+		return toInt64(f)
+	}
+	return 0, fmt.Errorf("expected integer value, got %T", v)
+}
+
+func toFloat64(v any) (float64, error) {
+	switch t := v.(type) {
+	case float32:
+		return float64(t), nil
+	case float64:
+		return t, nil
+	case int:
+		return float64(t), nil
+	case int32:
+		return float64(t), nil
+	case int64:
+		return float64(t), nil
+	case uint32:
+		return float64(t), nil
+	case uint64:
+		return float64(t), nil
+	case json.Number:
+		return t.Float64()
+	}
+	return 0, fmt.Errorf("expected number value, got %T", v)
+}
+
+func checkIntRange(kind typeKind, i int64) error {
+	var lo, hi int64
+	switch kind {
+	case kindByte:
+		lo, hi = math.MinInt8, math.MaxInt8
+	case kindShort:
+		lo, hi = math.MinInt16, math.MaxInt16
+	case kindInt:
+		lo, hi = math.MinInt32, math.MaxInt32
+	default:
+		return nil
+	}
+	if i < lo || i > hi {
+		return fmt.Errorf("value %v overflows %v", i, kind)
+	}
+	return nil
+}
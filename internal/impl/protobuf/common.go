@@ -17,9 +17,26 @@ package protobuf
 import (
 	"fmt"
 
+	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
+
+	// Ensure the well-known types are linked into the global registry so that
+	// descriptor sets omitting them can still be resolved.
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/apipb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/sourcecontextpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/typepb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // RegistriesFromMap attempts to parse a map of filenames (relative to import
@@ -27,6 +44,17 @@ import (
 // protobuf types. These registries can then be used as a mechanism for
 // dynamically (un)marshalling the definitions within.
 func RegistriesFromMap(filesMap map[string]string) (*protoregistry.Files, *protoregistry.Types, error) {
+	fdSet, err := FileDescriptorSetFromMap(filesMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	return RegistriesFromFileDescriptorSet(fdSet)
+}
+
+// FileDescriptorSetFromMap attempts to parse a map of filenames (relative to
+// import directories) and their contents out into a set of file descriptors,
+// including those of all imported files.
+func FileDescriptorSetFromMap(filesMap map[string]string) (*descriptorpb.FileDescriptorSet, error) {
 	var parser protoparse.Parser
 	parser.Accessor = protoparse.FileContentsFromMap(filesMap)
 
@@ -37,24 +65,147 @@ func RegistriesFromMap(filesMap map[string]string) (*protoregistry.Files, *proto
 
 	fds, err := parser.ParseFiles(names...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	files, types := &protoregistry.Files{}, &protoregistry.Types{}
-	for _, v := range fds {
-		if err := files.RegisterFile(v.UnwrapFile()); err != nil {
-			return nil, nil, fmt.Errorf("failed to register file '%v': %w", v.GetName(), err)
+	fdSet := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]struct{}{}
+
+	var addFile func(fd *desc.FileDescriptor)
+	addFile = func(fd *desc.FileDescriptor) {
+		if _, exists := seen[fd.GetName()]; exists {
+			return
+		}
+		seen[fd.GetName()] = struct{}{}
+		for _, dep := range fd.GetDependencies() {
+			addFile(dep)
 		}
-		for _, t := range v.GetMessageTypes() {
-			if err := types.RegisterMessage(dynamicpb.NewMessageType(t.UnwrapMessage())); err != nil {
-				return nil, nil, fmt.Errorf("failed to register type '%v': %w", t.GetName(), err)
+		fdSet.File = append(fdSet.File, fd.AsFileDescriptorProto())
+	}
+	for _, fd := range fds {
+		addFile(fd)
+	}
+	return fdSet, nil
+}
+
+var wellKnownFiles = []string{
+	"google/protobuf/any.proto",
+	"google/protobuf/api.proto",
+	"google/protobuf/duration.proto",
+	"google/protobuf/empty.proto",
+	"google/protobuf/field_mask.proto",
+	"google/protobuf/source_context.proto",
+	"google/protobuf/struct.proto",
+	"google/protobuf/timestamp.proto",
+	"google/protobuf/type.proto",
+	"google/protobuf/wrappers.proto",
+}
+
+// RegistriesFromFileDescriptorSet creates a registry of protobuf files and
+// protobuf types from a set of file descriptors, such as those produced by
+// `buf build` or `protoc --descriptor_set_out`. Dependencies missing from the
+// set are resolved from the well-known types where possible, and the
+// well-known types are always registered so that they can be resolved within
+// `google.protobuf.Any` fields.
+func RegistriesFromFileDescriptorSet(fdSet *descriptorpb.FileDescriptorSet) (*protoregistry.Files, *protoregistry.Types, error) {
+	protos := map[string]*descriptorpb.FileDescriptorProto{}
+	for _, fdp := range fdSet.GetFile() {
+		if _, exists := protos[fdp.GetName()]; !exists {
+			protos[fdp.GetName()] = fdp
+		}
+	}
+
+	files := &protoregistry.Files{}
+	visiting := map[string]struct{}{}
+
+	var registerFile func(name string) error
+	registerFile = func(name string) error {
+		if _, err := files.FindFileByPath(name); err == nil {
+			return nil
+		}
+		if _, exists := visiting[name]; exists {
+			return fmt.Errorf("import cycle detected at file '%v'", name)
+		}
+
+		fdp, exists := protos[name]
+		if !exists {
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(name)
+			if err != nil {
+				return fmt.Errorf("dependency '%v' not found", name)
 			}
-			for _, nt := range t.GetNestedMessageTypes() {
-				if err := types.RegisterMessage(dynamicpb.NewMessageType(nt.UnwrapMessage())); err != nil {
-					return nil, nil, fmt.Errorf("failed to register type '%v': %w", nt.GetFullyQualifiedName(), err)
-				}
+			return files.RegisterFile(fd)
+		}
+
+		visiting[name] = struct{}{}
+		for _, dep := range fdp.GetDependency() {
+			if err := registerFile(dep); err != nil {
+				return fmt.Errorf("file '%v': %w", name, err)
 			}
 		}
+		delete(visiting, name)
+
+		fd, err := protodesc.NewFile(fdp, files)
+		if err != nil {
+			return fmt.Errorf("failed to create file descriptor '%v': %w", name, err)
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			return fmt.Errorf("failed to register file '%v': %w", name, err)
+		}
+		return nil
+	}
+
+	for _, fdp := range fdSet.GetFile() {
+		if err := registerFile(fdp.GetName()); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, name := range wellKnownFiles {
+		if err := registerFile(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	types := &protoregistry.Types{}
+	var rErr error
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		rErr = registerTypes(types, fd)
+		return rErr == nil
+	})
+	if rErr != nil {
+		return nil, nil, rErr
 	}
 	return files, types, nil
 }
+
+type typeContainer interface {
+	Messages() protoreflect.MessageDescriptors
+	Enums() protoreflect.EnumDescriptors
+	Extensions() protoreflect.ExtensionDescriptors
+}
+
+// registerTypes adds dynamic types for all messages, enums and extensions
+// declared within a container (file or message), including nested ones.
+func registerTypes(types *protoregistry.Types, c typeContainer) error {
+	for i := 0; i < c.Enums().Len(); i++ {
+		ed := c.Enums().Get(i)
+		if err := types.RegisterEnum(dynamicpb.NewEnumType(ed)); err != nil {
+			return fmt.Errorf("failed to register type '%v': %w", ed.FullName(), err)
+		}
+	}
+	for i := 0; i < c.Messages().Len(); i++ {
+		md := c.Messages().Get(i)
+		if err := types.RegisterMessage(dynamicpb.NewMessageType(md)); err != nil {
+			return fmt.Errorf("failed to register type '%v': %w", md.FullName(), err)
+		}
+		if err := registerTypes(types, md); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < c.Extensions().Len(); i++ {
+		xd := c.Extensions().Get(i)
+		if err := types.RegisterExtension(dynamicpb.NewExtensionType(xd)); err != nil {
+			return fmt.Errorf("failed to register extension '%v': %w", xd.FullName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,425 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protobuf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	fieldDescriptorSetFile = "descriptor_set_file"
+
+	fieldSchemaRegistry        = "schema_registry"
+	fieldSchemaRegistryURL     = "url"
+	fieldSchemaRegistrySubject = "subject"
+	fieldSchemaRegistryVersion = "version"
+	fieldSchemaRegistryTLS     = "tls"
+	fieldSchemaRegistryTimeout = "timeout"
+
+	fieldBSR        = "bsr"
+	fieldBSRURL     = "url"
+	fieldBSRModule  = "module"
+	fieldBSRVersion = "version"
+	fieldBSRAPIKey  = "api_key"
+	fieldBSRTimeout = "timeout"
+)
+
+func importPathsField() *service.ConfigField {
+	return service.NewStringListField(fieldImportPaths).
+		Description("A list of directories containing .proto files, including all definitions required for parsing the target message. If left empty the current directory is used. Each directory listed will be walked with all found .proto files imported.").
+		Default([]string{})
+}
+
+// DescriptorFields returns the config fields used for obtaining protobuf
+// descriptors, including `import_paths`, for components outside of this
+// package that are configured with protobuf schemas.
+func DescriptorFields() []*service.ConfigField {
+	return append([]*service.ConfigField{importPathsField()}, descriptorSourceFields()...)
+}
+
+// descriptorSourceFields returns the config fields used for obtaining protobuf
+// descriptors from sources other than .proto files.
+func descriptorSourceFields() []*service.ConfigField {
+	srFields := []*service.ConfigField{
+		service.NewURLField(fieldSchemaRegistryURL).
+			Description("The base URL of the schema registry service."),
+		service.NewStringField(fieldSchemaRegistrySubject).
+			Description("The subject containing the protobuf schema."),
+		service.NewIntField(fieldSchemaRegistryVersion).
+			Description("The version of the subject to obtain, if omitted the latest version is used.").
+			Optional(),
+	}
+	srFields = append(srFields, service.NewHTTPRequestAuthSignerFields()...)
+	srFields = append(srFields,
+		service.NewTLSField(fieldSchemaRegistryTLS),
+		service.NewDurationField(fieldSchemaRegistryTimeout).
+			Description("The maximum period of time to wait for each request to the schema registry to complete.").
+			Version("4.31.0").
+			Default("10s"),
+	)
+
+	return []*service.ConfigField{
+		service.NewStringField(fieldDescriptorSetFile).
+			Description("The path of a binary encoded `FileDescriptorSet`, such as those produced with `buf build -o descriptors.binpb` or `protoc --include_imports --descriptor_set_out`. Well-known types missing from the set are resolved automatically.").
+			Example("./schemas/descriptors.binpb").
+			Version("4.31.0").
+			Default(""),
+		service.NewObjectField(fieldSchemaRegistry, srFields...).
+			Description("Obtain protobuf schemas from a subject of a Confluent Schema Registry service, including all schemas it references.").
+			Version("4.31.0").
+			Advanced().
+			Optional(),
+		service.NewObjectField(fieldBSR,
+			service.NewURLField(fieldBSRURL).
+				Description("The base URL of a service implementing the `buf.reflect.v1beta1.FileDescriptorSetService` API.").
+				Default("https://buf.build"),
+			service.NewStringField(fieldBSRModule).
+				Description("The name of the module to obtain descriptors for.").
+				Example("buf.build/exampleco/mymodule"),
+			service.NewStringField(fieldBSRVersion).
+				Description("The version of the module to obtain, which can be a commit, tag or branch. If empty the latest version is used.").
+				Default(""),
+			service.NewStringField(fieldBSRAPIKey).
+				Description("An optional API token used to authenticate with the registry.").
+				Secret().
+				Default(""),
+			service.NewDurationField(fieldBSRTimeout).
+				Description("The maximum period of time to wait for the request to the registry to complete.").
+				Version("4.31.0").
+				Default("10s"),
+		).
+			Description("Obtain protobuf descriptors from a https://buf.build/docs/bsr/reflection/overview[Buf Schema Registry reflection API^], or any service implementing the same API.").
+			Version("4.31.0").
+			Advanced().
+			Optional(),
+	}
+}
+
+// LoadDescriptors obtains protobuf descriptors from all sources configured with
+// the fields of DescriptorFields and merges them into registries of files and
+// types.
+func LoadDescriptors(ctx context.Context, conf *service.ParsedConfig, mgr *service.Resources) (*protoregistry.Files, *protoregistry.Types, error) {
+	fdSet := &descriptorpb.FileDescriptorSet{}
+
+	importPaths, err := conf.FieldStringList(fieldImportPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(importPaths) > 0 {
+		protoFiles, err := readProtoFiles(mgr.FS(), importPaths)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed, err := FileDescriptorSetFromMap(protoFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+		fdSet.File = append(fdSet.File, parsed.File...)
+	}
+
+	descSetPath, err := conf.FieldString(fieldDescriptorSetFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if descSetPath != "" {
+		fileBytes, err := service.ReadFile(mgr.FS(), descSetPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read descriptor set file: %w", err)
+		}
+		var fileSet descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(fileBytes, &fileSet); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse descriptor set file: %w", err)
+		}
+		fdSet.File = append(fdSet.File, fileSet.File...)
+	}
+
+	if conf.Contains(fieldSchemaRegistry) {
+		srFiles, err := schemaRegistryDescriptors(ctx, conf.Namespace(fieldSchemaRegistry), mgr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to obtain schemas from schema registry: %w", err)
+		}
+		fdSet.File = append(fdSet.File, srFiles.File...)
+	}
+
+	if conf.Contains(fieldBSR) {
+		bsrFiles, err := bsrDescriptors(ctx, conf.Namespace(fieldBSR))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to obtain descriptors from buf schema registry: %w", err)
+		}
+		fdSet.File = append(fdSet.File, bsrFiles.File...)
+	}
+
+	return RegistriesFromFileDescriptorSet(fdSet)
+}
+
+func readProtoFiles(f fs.FS, importPaths []string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, importPath := range importPaths {
+		if err := fs.WalkDir(f, importPath, func(path string, info fs.DirEntry, ferr error) error {
+			if ferr != nil || info.IsDir() {
+				return ferr
+			}
+			if filepath.Ext(info.Name()) == ".proto" {
+				rPath, ferr := filepath.Rel(importPath, path)
+				if ferr != nil {
+					return fmt.Errorf("failed to get relative path: %v", ferr)
+				}
+				content, ferr := os.ReadFile(path)
+				if ferr != nil {
+					return fmt.Errorf("failed to read import %v: %v", path, ferr)
+				}
+				files[rPath] = string(content)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+//------------------------------------------------------------------------------
+
+type registrySchema struct {
+	Type       string                    `json:"schemaType"`
+	Schema     string                    `json:"schema"`
+	References []registrySchemaReference `json:"references"`
+}
+
+type registrySchemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+func schemaRegistryDescriptors(ctx context.Context, conf *service.ParsedConfig, mgr *service.Resources) (*descriptorpb.FileDescriptorSet, error) {
+	urlStr, err := conf.FieldString(fieldSchemaRegistryURL)
+	if err != nil {
+		return nil, err
+	}
+	baseURL, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	subject, err := conf.FieldString(fieldSchemaRegistrySubject)
+	if err != nil {
+		return nil, err
+	}
+
+	version := "latest"
+	if conf.Contains(fieldSchemaRegistryVersion) {
+		v, err := conf.FieldInt(fieldSchemaRegistryVersion)
+		if err != nil {
+			return nil, err
+		}
+		version = fmt.Sprintf("%v", v)
+	}
+
+	tlsConf, err := conf.FieldTLS(fieldSchemaRegistryTLS)
+	if err != nil {
+		return nil, err
+	}
+	reqSigner, err := conf.HTTPRequestAuthSignerFromParsed()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := conf.FieldDuration(fieldSchemaRegistryTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	if tlsConf != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConf
+		client.Transport = transport
+	}
+
+	getSchema := func(subject, version string) (s registrySchema, err error) {
+		reqURL := *baseURL
+		if reqURL.Path, err = url.JoinPath(reqURL.Path, "subjects", url.PathEscape(subject), "versions", version); err != nil {
+			return
+		}
+
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), http.NoBody); err != nil {
+			return
+		}
+		req.Header.Add("Accept", "application/vnd.schemaregistry.v1+json")
+		if err = reqSigner(mgr.FS(), req); err != nil {
+			return
+		}
+
+		var resBody []byte
+		if resBody, err = doRequest(client, req); err != nil {
+			err = fmt.Errorf("request failed for subject '%v' version '%v': %w", subject, version, err)
+			return
+		}
+		if err = json.Unmarshal(resBody, &s); err != nil {
+			err = fmt.Errorf("failed to parse response for subject '%v': %w", subject, err)
+			return
+		}
+		if s.Type != "PROTOBUF" {
+			err = fmt.Errorf("subject '%v' has schema type '%v', expected PROTOBUF", subject, s.Type)
+		}
+		return
+	}
+
+	root, err := getSchema(subject, version)
+	if err != nil {
+		return nil, err
+	}
+
+	rootName := subject
+	if !strings.HasSuffix(rootName, ".proto") {
+		rootName += ".proto"
+	}
+	protoFiles := map[string]string{rootName: root.Schema}
+
+	seen := map[string]int{}
+	var walkRefs func(refs []registrySchemaReference) error
+	walkRefs = func(refs []registrySchemaReference) error {
+		for _, ref := range refs {
+			if v, exists := seen[ref.Name]; exists {
+				if v != ref.Version {
+					return fmt.Errorf("duplicate reference '%v' version mismatch of %v and %v", ref.Name, v, ref.Version)
+				}
+				continue
+			}
+			seen[ref.Name] = ref.Version
+
+			refSchema, err := getSchema(ref.Subject, fmt.Sprintf("%v", ref.Version))
+			if err != nil {
+				return err
+			}
+			protoFiles[ref.Name] = refSchema.Schema
+			if err := walkRefs(refSchema.References); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walkRefs(root.References); err != nil {
+		return nil, err
+	}
+
+	return FileDescriptorSetFromMap(protoFiles)
+}
+
+//------------------------------------------------------------------------------
+
+const bsrGetFileDescriptorSetPath = "/buf.reflect.v1beta1.FileDescriptorSetService/GetFileDescriptorSet"
+
+func bsrDescriptors(ctx context.Context, conf *service.ParsedConfig) (*descriptorpb.FileDescriptorSet, error) {
+	urlStr, err := conf.FieldString(fieldBSRURL)
+	if err != nil {
+		return nil, err
+	}
+	module, err := conf.FieldString(fieldBSRModule)
+	if err != nil {
+		return nil, err
+	}
+	version, err := conf.FieldString(fieldBSRVersion)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := conf.FieldString(fieldBSRAPIKey)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := conf.FieldDuration(fieldBSRTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody, err := json.Marshal(map[string]string{
+		"module":  module,
+		"version": version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(urlStr, "/")+bsrGetFileDescriptorSetPath, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resBody, err := doRequest(&http.Client{Timeout: timeout}, req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed for module '%v': %w", module, err)
+	}
+
+	var res struct {
+		FileDescriptorSet json.RawMessage `json:"fileDescriptorSet"`
+	}
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(res.FileDescriptorSet) == 0 {
+		return nil, errors.New("response did not contain a file descriptor set")
+	}
+
+	var fdSet descriptorpb.FileDescriptorSet
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(res.FileDescriptorSet, &fdSet); err != nil {
+		return nil, fmt.Errorf("failed to parse file descriptor set: %w", err)
+	}
+	return &fdSet, nil
+}
+
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		if len(resBody) > 0 {
+			return nil, fmt.Errorf("status code %v: %s", res.StatusCode, bytes.TrimSpace(resBody))
+		}
+		return nil, fmt.Errorf("status code %v", res.StatusCode)
+	}
+	return resBody, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protobuf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const testSchemaDir = "../../../config/test/protobuf/schema"
+
+func testFileDescriptorSet(t *testing.T, withWellKnown bool) *descriptorpb.FileDescriptorSet {
+	t.Helper()
+
+	protoFiles, err := readProtoFiles(service.MockResources().FS(), []string{testSchemaDir})
+	require.NoError(t, err)
+
+	fdSet, err := FileDescriptorSetFromMap(protoFiles)
+	require.NoError(t, err)
+
+	if !withWellKnown {
+		var filtered []*descriptorpb.FileDescriptorProto
+		for _, f := range fdSet.File {
+			if !strings.HasPrefix(f.GetName(), "google/protobuf/") {
+				filtered = append(filtered, f)
+			}
+		}
+		fdSet.File = filtered
+	}
+	return fdSet
+}
+
+func testProtobufRoundTrip(t *testing.T, confStr, message, input string) {
+	t.Helper()
+
+	fromConf, err := protobufProcessorSpec().ParseYAML(fmt.Sprintf(`
+operator: from_json
+message: %v
+%v
+`, message, confStr), nil)
+	require.NoError(t, err)
+
+	fromProc, err := newProtobuf(fromConf, service.MockResources())
+	require.NoError(t, err)
+
+	toConf, err := protobufProcessorSpec().ParseYAML(fmt.Sprintf(`
+operator: to_json
+message: %v
+%v
+`, message, confStr), nil)
+	require.NoError(t, err)
+
+	toProc, err := newProtobuf(toConf, service.MockResources())
+	require.NoError(t, err)
+
+	msgs, err := fromProc.Process(context.Background(), service.NewMessage([]byte(input)))
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	msgs, err = toProc.Process(context.Background(), msgs[0])
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	mBytes, err := msgs[0].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, input, string(mBytes))
+}
+
+func TestProtobufDescriptorSetFile(t *testing.T) {
+	for _, withWellKnown := range []bool{true, false} {
+		withWellKnown := withWellKnown
+		t.Run(fmt.Sprintf("well known %v", withWellKnown), func(t *testing.T) {
+			fdSetBytes, err := proto.Marshal(testFileDescriptorSet(t, withWellKnown))
+			require.NoError(t, err)
+
+			descPath := filepath.Join(t.TempDir(), "descriptors.binpb")
+			require.NoError(t, os.WriteFile(descPath, fdSetBytes, 0o644))
+
+			confStr := fmt.Sprintf(`descriptor_set_file: %v`, descPath)
+			testProtobufRoundTrip(t, confStr, "testing.Person", `{"firstName":"caleb","lastUpdated":"2024-01-02T03:04:05Z"}`)
+			testProtobufRoundTrip(t, confStr, "testing.House.Mailbox", `{"color":"red","identifier":"123"}`)
+			testProtobufRoundTrip(t, confStr, "testing.Envelope", `{"id":747,"content":{"@type":"type.googleapis.com/testing.House","address":"123","mailbox":{"color":"blue"}}}`)
+		})
+	}
+}
+
+func TestProtobufWellKnownAny(t *testing.T) {
+	confStr := fmt.Sprintf(`import_paths: [ %v ]`, testSchemaDir)
+
+	testProtobufRoundTrip(t, confStr, "testing.Envelope", `{"id":1,"content":{"@type":"type.googleapis.com/google.protobuf.Timestamp","value":"2024-01-02T03:04:05Z"}}`)
+	testProtobufRoundTrip(t, confStr, "testing.Envelope", `{"id":2,"content":{"@type":"type.googleapis.com/google.protobuf.Struct","value":{"foo":"bar","baz":[1,2]}}}`)
+	testProtobufRoundTrip(t, confStr, "testing.Envelope", `{"id":3,"content":{"@type":"type.googleapis.com/google.protobuf.Duration","value":"1.500s"}}`)
+	testProtobufRoundTrip(t, confStr, "testing.Envelope", `{"id":4,"content":{"@type":"type.googleapis.com/testing.House.Mailbox","color":"red"}}`)
+}
+
+func TestProtobufSchemaRegistry(t *testing.T) {
+	readSchema := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(testSchemaDir, name))
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	responses := map[string]any{
+		"/subjects/house/versions/latest": map[string]any{
+			"schemaType": "PROTOBUF",
+			"schema":     readSchema("house.proto"),
+			"references": []any{
+				map[string]any{"name": "person.proto", "subject": "person", "version": 3},
+			},
+		},
+		"/subjects/person/versions/3": map[string]any{
+			"schemaType": "PROTOBUF",
+			"schema":     readSchema("person.proto"),
+		},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, exists := responses[r.URL.Path]
+		if !exists {
+			http.Error(w, "nope", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(ts.Close)
+
+	confStr := fmt.Sprintf(`
+schema_registry:
+  url: %v
+  subject: house
+`, ts.URL)
+	testProtobufRoundTrip(t, confStr, "testing.House", `{"address":"123","people":[{"firstName":"bob","lastUpdated":"2024-01-02T03:04:05Z"}]}`)
+
+	conf, err := protobufProcessorSpec().ParseYAML(fmt.Sprintf(`
+operator: to_json
+message: testing.House
+schema_registry:
+  url: %v
+  subject: house
+  version: 7
+`, ts.URL), nil)
+	require.NoError(t, err)
+
+	_, err = newProtobuf(conf, service.MockResources())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status code 404")
+}
+
+func TestProtobufBSR(t *testing.T) {
+	fdSetJSON, err := protojson.Marshal(testFileDescriptorSet(t, true))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != bsrGetFileDescriptorSetPath || r.Method != http.MethodPost {
+			http.Error(w, "nope", http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer foobar" {
+			http.Error(w, "nope", http.StatusUnauthorized)
+			return
+		}
+
+		reqBytes, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"module":"buf.build/exampleco/testing","version":"main"}`, string(reqBytes))
+
+		_, _ = fmt.Fprintf(w, `{"fileDescriptorSet":%s,"version":"abcdef"}`, fdSetJSON)
+	}))
+	t.Cleanup(ts.Close)
+
+	confStr := fmt.Sprintf(`
+bsr:
+  url: %v
+  module: buf.build/exampleco/testing
+  version: main
+  api_key: foobar
+`, ts.URL)
+	testProtobufRoundTrip(t, confStr, "testing.Person", `{"firstName":"caleb","age":30}`)
+}
+
+func TestProtobufDescriptorSourceTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		ts.Close()
+	})
+
+	for _, source := range []string{
+		fmt.Sprintf(`
+schema_registry:
+  url: %v
+  subject: house
+  timeout: 50ms
+`, ts.URL),
+		fmt.Sprintf(`
+bsr:
+  url: %v
+  module: buf.build/exampleco/testing
+  timeout: 50ms
+`, ts.URL),
+	} {
+		conf, err := protobufProcessorSpec().ParseYAML(`
+operator: to_json
+message: testing.House
+`+source, nil)
+		require.NoError(t, err)
+
+		_, err = newProtobuf(conf, service.MockResources())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Timeout")
+	}
+}
@@ -0,0 +1,440 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protobuf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	fieldMutations       = "mutations"
+	fieldMutationPath    = "path"
+	fieldMutationMapping = "mapping"
+)
+
+func mutationsField() *service.ConfigField {
+	return service.NewObjectListField(fieldMutations,
+		service.NewStringField(fieldMutationPath).
+			Description("A dot separated path of the field to mutate, where each segment is either the name of the field as defined in the schema or its JSON name. All segments except the last must refer to singular message fields.").
+			Example("last_updated.seconds").
+			Example("email"),
+		service.NewBloblangField(fieldMutationMapping).
+			Description("A xref:guides:bloblang/about.adoc[Bloblang mapping] executed with the current value of the field as its input document, in its JSON form. The result of the mapping replaces the value of the field, string results are used as-is for string and enum fields, and a result of `deleted()` removes the field from the message. Singular bytes fields are provided to the mapping as their raw bytes rather than base64 encoded, which can be accessed with `content()`, and the raw bytes of the result are used as the new value. Setting a member of a oneof removes any other member of the oneof from the message. Metadata changes made by the mapping are applied to the message.").
+			Example(`root = this.uppercase()`).
+			Example(`meta email = this
+root = this`).
+			Example(`root = deleted()`),
+	).
+		Description("A list of field mutations to apply when the operator is `mutate`, executed in order.").
+		Version("4.31.0").
+		Default([]any{})
+}
+
+type fieldMutation struct {
+	path    []protoreflect.FieldDescriptor
+	mapping *bloblang.Executor
+
+	// A message containing only a copy of the target field, used for
+	// converting the field to and from JSON regardless of the JSON form of the
+	// message that actually contains it (e.g. google.protobuf.Timestamp).
+	leaf protoreflect.MessageDescriptor
+}
+
+func newProtobufMutateOperator(descriptors *protoregistry.Files, types *protoregistry.Types, msg string, mutationConfs []*service.ParsedConfig) (protobufOperator, error) {
+	if msg == "" {
+		return nil, errors.New("message field must not be empty")
+	}
+
+	d, err := descriptors.FindDescriptorByName(protoreflect.FullName(msg))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find message '%v' definition within the loaded schemas", msg)
+	}
+
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("message descriptor %v was unexpected type %T", msg, d)
+	}
+
+	if len(mutationConfs) == 0 {
+		return nil, errors.New("at least one mutation must be specified for the mutate operator")
+	}
+
+	mutations := make([]fieldMutation, 0, len(mutationConfs))
+	for i, mConf := range mutationConfs {
+		pathStr, err := mConf.FieldString(fieldMutationPath)
+		if err != nil {
+			return nil, err
+		}
+		path, err := resolveFieldPath(md, pathStr)
+		if err != nil {
+			return nil, fmt.Errorf("mutation %v: %w", i, err)
+		}
+		leaf, err := leafMessageDescriptor(descriptors, path[len(path)-1])
+		if err != nil {
+			return nil, fmt.Errorf("mutation %v: %w", i, err)
+		}
+		mapping, err := mConf.FieldBloblang(fieldMutationMapping)
+		if err != nil {
+			return nil, err
+		}
+		mutations = append(mutations, fieldMutation{path: path, mapping: mapping, leaf: leaf})
+	}
+
+	m := &fieldMutator{resolver: types}
+	return func(part *service.Message) error {
+		partBytes, err := part.AsBytes()
+		if err != nil {
+			return err
+		}
+		for _, mut := range mutations {
+			if partBytes, err = m.mutate(part, partBytes, mut); err != nil {
+				return fmt.Errorf("failed to mutate protobuf message '%v': %w", msg, err)
+			}
+		}
+		part.SetBytes(partBytes)
+		return nil
+	}, nil
+}
+
+func resolveFieldPath(md protoreflect.MessageDescriptor, pathStr string) ([]protoreflect.FieldDescriptor, error) {
+	if pathStr == "" {
+		return nil, errors.New("path must not be empty")
+	}
+
+	segments := strings.Split(pathStr, ".")
+	path := make([]protoreflect.FieldDescriptor, 0, len(segments))
+	for i, seg := range segments {
+		if md == nil {
+			return nil, fmt.Errorf("path segment '%v' cannot be resolved as field '%v' is not a message", seg, segments[i-1])
+		}
+
+		fd := md.Fields().ByName(protoreflect.Name(seg))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(seg)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("field '%v' not found within message '%v'", seg, md.FullName())
+		}
+
+		if i < len(segments)-1 && (fd.Message() == nil || fd.IsList() || fd.IsMap()) {
+			return nil, fmt.Errorf("field '%v' must be a singular message field in order to be traversed", seg)
+		}
+		path = append(path, fd)
+		md = fd.Message()
+	}
+	return path, nil
+}
+
+// leafMessageDescriptor creates a standalone message descriptor containing a
+// single field identical to the provided one, including its number and JSON
+// name, so that it can be decoded from the exact same bytes.
+func leafMessageDescriptor(files *protoregistry.Files, fd protoreflect.FieldDescriptor) (protoreflect.MessageDescriptor, error) {
+	const pkg, msgName = "benthos.protobuf.mutate", "Leaf"
+
+	parentFile := protodesc.ToFileDescriptorProto(fd.ParentFile())
+
+	msgProto := &descriptorpb.DescriptorProto{Name: proto.String(msgName)}
+	fieldProto := protodesc.ToFieldDescriptorProto(fd)
+	fieldProto.OneofIndex = nil
+	if fd.ContainingOneof() != nil {
+		fieldProto.OneofIndex = proto.Int32(0)
+		msgProto.OneofDecl = append(msgProto.OneofDecl, &descriptorpb.OneofDescriptorProto{
+			Name: proto.String("_" + string(fd.Name())),
+		})
+	}
+	msgProto.Field = append(msgProto.Field, fieldProto)
+
+	deps := map[string]struct{}{}
+	addDep := func(d protoreflect.Descriptor) {
+		if d != nil {
+			deps[d.ParentFile().Path()] = struct{}{}
+		}
+	}
+	if fd.IsMap() {
+		// Map entry messages are nested within the containing message and must
+		// therefore be copied into the leaf message.
+		entry := protodesc.ToDescriptorProto(fd.Message())
+		msgProto.NestedType = append(msgProto.NestedType, entry)
+		fieldProto.TypeName = proto.String("." + pkg + "." + msgName + "." + entry.GetName())
+		addDep(fd.MapValue().Message())
+		addDep(fd.MapValue().Enum())
+	} else {
+		addDep(fd.Message())
+		addDep(fd.Enum())
+	}
+
+	fileProto := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("benthos_protobuf_mutate_leaf.proto"),
+		Package:     proto.String(pkg),
+		Syntax:      parentFile.Syntax,
+		Edition:     parentFile.Edition,
+		Options:     parentFile.Options,
+		MessageType: []*descriptorpb.DescriptorProto{msgProto},
+	}
+	for dep := range deps {
+		fileProto.Dependency = append(fileProto.Dependency, dep)
+	}
+
+	leafFile, err := protodesc.NewFile(fileProto, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create descriptor for field '%v': %w", fd.FullName(), err)
+	}
+	return leafFile.Messages().Get(0), nil
+}
+
+//------------------------------------------------------------------------------
+
+type fieldMutator struct {
+	resolver *protoregistry.Types
+}
+
+type fieldSpan struct {
+	start, end int
+	// The payload of length delimited fields.
+	value []byte
+}
+
+// findFieldSpans locates all occurrences of a field number within the top level
+// of a serialized message.
+func findFieldSpans(b []byte, num protowire.Number) ([]fieldSpan, error) {
+	var spans []fieldSpan
+	for offset := 0; offset < len(b); {
+		fNum, fType, n := protowire.ConsumeTag(b[offset:])
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		vLen := protowire.ConsumeFieldValue(fNum, fType, b[offset+n:])
+		if vLen < 0 {
+			return nil, protowire.ParseError(vLen)
+		}
+		if fNum == num {
+			span := fieldSpan{start: offset, end: offset + n + vLen}
+			if fType == protowire.BytesType {
+				span.value, _ = protowire.ConsumeBytes(b[offset+n:])
+			}
+			spans = append(spans, span)
+		}
+		offset += n + vLen
+	}
+	return spans, nil
+}
+
+// spliceField replaces the occurrences of a field within b with the
+// replacement bytes. When the field is set and belongs to a oneof the other
+// members of the oneof are removed, as otherwise the member that appears last
+// would take precedence when the message is parsed.
+func spliceField(b []byte, fd protoreflect.FieldDescriptor, spans []fieldSpan, replacement []byte) ([]byte, error) {
+	if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && len(replacement) > 0 {
+		spans = append([]fieldSpan{}, spans...)
+		fields := oneof.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if sibling := fields.Get(i); sibling.Number() != fd.Number() {
+				siblingSpans, err := findFieldSpans(b, sibling.Number())
+				if err != nil {
+					return nil, err
+				}
+				spans = append(spans, siblingSpans...)
+			}
+		}
+		sort.Slice(spans, func(i, j int) bool {
+			return spans[i].start < spans[j].start
+		})
+	}
+	return splice(b, spans, replacement), nil
+}
+
+// splice replaces all spans within b with the replacement bytes, which are
+// placed at the location of the first span, or appended when there are none.
+func splice(b []byte, spans []fieldSpan, replacement []byte) []byte {
+	if len(spans) == 0 {
+		if len(replacement) == 0 {
+			return b
+		}
+		return append(b[:len(b):len(b)], replacement...)
+	}
+
+	out := make([]byte, 0, len(b)+len(replacement))
+	out = append(out, b[:spans[0].start]...)
+	out = append(out, replacement...)
+	for i, s := range spans {
+		end := len(b)
+		if i+1 < len(spans) {
+			end = spans[i+1].start
+		}
+		out = append(out, b[s.end:end]...)
+	}
+	return out
+}
+
+// mutate applies a mutation to a serialized message, only the bytes of the
+// targeted field (and the length prefixes of its parent messages) are
+// rewritten, all other fields are copied verbatim.
+func (f *fieldMutator) mutate(part *service.Message, b []byte, mut fieldMutation) ([]byte, error) {
+	fd := mut.path[0]
+	spans, err := findFieldSpans(b, fd.Number())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mut.path) > 1 {
+		// Multiple occurrences of a singular message field are merged, which
+		// is equivalent to concatenating their contents.
+		var sub []byte
+		for _, s := range spans {
+			sub = append(sub, s.value...)
+		}
+		newSub, err := f.mutate(part, sub, fieldMutation{path: mut.path[1:], mapping: mut.mapping, leaf: mut.leaf})
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", fd.Name(), err)
+		}
+		if len(spans) == 0 && len(newSub) == 0 {
+			return b, nil
+		}
+		replacement := protowire.AppendTag(nil, fd.Number(), protowire.BytesType)
+		replacement = protowire.AppendBytes(replacement, newSub)
+		return spliceField(b, fd, spans, replacement)
+	}
+
+	jsonName := fd.JSONName()
+	leafField := mut.leaf.Fields().Get(0)
+
+	// Bytes fields are mapped as raw bytes rather than in their base64
+	// encoded JSON form.
+	isBytes := !fd.IsList() && fd.Kind() == protoreflect.BytesKind
+
+	// Decode only the occurrences of the target field.
+	var fieldBytes []byte
+	for _, s := range spans {
+		fieldBytes = append(fieldBytes, b[s.start:s.end]...)
+	}
+	current := dynamicpb.NewMessage(mut.leaf)
+	if err := (proto.UnmarshalOptions{Resolver: f.resolver}).Unmarshal(fieldBytes, current); err != nil {
+		return nil, err
+	}
+
+	var currentValue []byte
+	if isBytes {
+		currentValue = current.Get(leafField).Bytes()
+	} else {
+		currentJSON, err := protojson.MarshalOptions{
+			Resolver:        f.resolver,
+			EmitUnpopulated: true,
+		}.Marshal(current)
+		if err != nil {
+			return nil, err
+		}
+
+		var currentObj map[string]json.RawMessage
+		if err := json.Unmarshal(currentJSON, &currentObj); err != nil {
+			return nil, err
+		}
+
+		var exists bool
+		if currentValue, exists = currentObj[jsonName]; !exists {
+			currentValue = json.RawMessage("null")
+		}
+	}
+
+	valueMsg := part.Copy()
+	valueMsg.SetBytes(currentValue)
+
+	resMsg, err := valueMsg.BloblangQuery(mut.mapping)
+	if err != nil {
+		return nil, fmt.Errorf("%v: mapping failed: %w", fd.Name(), err)
+	}
+	if resMsg == nil {
+		return splice(b, spans, nil), nil
+	}
+	copyMetadata(resMsg, part)
+
+	updated := dynamicpb.NewMessage(mut.leaf)
+	if isBytes {
+		resBytes, err := resMsg.AsBytes()
+		if err != nil {
+			return nil, err
+		}
+		updated.Set(leafField, protoreflect.ValueOfBytes(resBytes))
+	} else {
+		resValue, err := mappingResultValue(fd, resMsg)
+		if err != nil {
+			return nil, err
+		}
+		resJSON, err := json.Marshal(map[string]any{jsonName: resValue})
+		if err != nil {
+			return nil, err
+		}
+		if err := (protojson.UnmarshalOptions{Resolver: f.resolver}).Unmarshal(resJSON, updated); err != nil {
+			return nil, fmt.Errorf("%v: invalid mapping result: %w", fd.Name(), err)
+		}
+	}
+	replacement, err := proto.MarshalOptions{Deterministic: true}.Marshal(updated)
+	if err != nil {
+		return nil, err
+	}
+	return spliceField(b, fd, spans, replacement)
+}
+
+// mappingResultValue extracts the value of a mapping result. Mappings that
+// result in a string produce raw bytes, therefore the raw bytes are used as a
+// string when the field is a string or enum, or when the bytes are not
+// a valid JSON document (e.g. a timestamp assigned to a Timestamp field).
+func mappingResultValue(fd protoreflect.FieldDescriptor, resMsg *service.Message) (any, error) {
+	if !fd.IsList() && !fd.IsMap() {
+		switch fd.Kind() {
+		case protoreflect.StringKind, protoreflect.EnumKind:
+			if v, err := resMsg.AsStructured(); err == nil {
+				if _, isStr := v.(string); isStr {
+					return v, nil
+				}
+			}
+			b, err := resMsg.AsBytes()
+			return string(b), err
+		}
+	}
+	if v, err := resMsg.AsStructured(); err == nil {
+		return v, nil
+	}
+	b, err := resMsg.AsBytes()
+	return string(b), err
+}
+
+func copyMetadata(from, to *service.Message) {
+	_ = to.MetaWalkMut(func(k string, _ any) error {
+		if _, exists := from.MetaGetMut(k); !exists {
+			to.MetaDelete(k)
+		}
+		return nil
+	})
+	_ = from.MetaWalkMut(func(k string, v any) error {
+		to.MetaSetMut(k, v)
+		return nil
+	})
+}
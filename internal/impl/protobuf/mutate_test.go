@@ -0,0 +1,343 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protobuf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func testProtobufProc(t *testing.T, confStr string) *protobufProc {
+	t.Helper()
+
+	conf, err := protobufProcessorSpec().ParseYAML(confStr, nil)
+	require.NoError(t, err)
+
+	proc, err := newProtobuf(conf, service.MockResources())
+	require.NoError(t, err)
+	return proc
+}
+
+func TestProtobufMutate(t *testing.T) {
+	fromJSON := testProtobufProc(t, fmt.Sprintf(`
+operator: from_json
+message: testing.Person
+import_paths: [ %v ]
+`, testSchemaDir))
+
+	toJSON := testProtobufProc(t, fmt.Sprintf(`
+operator: to_json
+message: testing.Person
+import_paths: [ %v ]
+`, testSchemaDir))
+
+	tests := []struct {
+		name      string
+		mutations string
+		input     string
+		output    string
+		metadata  map[string]any
+	}{
+		{
+			name: "set string",
+			mutations: `
+  - path: first_name
+    mapping: root = this.uppercase()
+`,
+			input:  `{"firstName":"caleb","lastName":"quaye","age":30}`,
+			output: `{"firstName":"CALEB","lastName":"quaye","age":30}`,
+		},
+		{
+			name: "set absent field by json name",
+			mutations: `
+  - path: fullName
+    mapping: root = "caleb quaye"
+`,
+			input:  `{"firstName":"caleb","lastName":"quaye"}`,
+			output: `{"firstName":"caleb","lastName":"quaye","fullName":"caleb quaye"}`,
+		},
+		{
+			name: "delete field",
+			mutations: `
+  - path: last_name
+    mapping: root = deleted()
+`,
+			input:  `{"firstName":"caleb","lastName":"quaye","age":30}`,
+			output: `{"firstName":"caleb","age":30}`,
+		},
+		{
+			name: "set nested field",
+			mutations: `
+  - path: last_updated.seconds
+    mapping: root = this.number() + 60
+`,
+			input:  `{"firstName":"caleb","lastUpdated":"2024-01-02T03:04:05Z"}`,
+			output: `{"firstName":"caleb","lastUpdated":"2024-01-02T03:05:05Z"}`,
+		},
+		{
+			name: "set whole message field",
+			mutations: `
+  - path: last_updated
+    mapping: root = "2020-01-01T00:00:00Z"
+`,
+			input:  `{"firstName":"caleb"}`,
+			output: `{"firstName":"caleb","lastUpdated":"2020-01-01T00:00:00Z"}`,
+		},
+		{
+			name: "get into metadata",
+			mutations: `
+  - path: email
+    mapping: |
+      meta email = this
+      meta age = "unchanged"
+      root = this
+  - path: age
+    mapping: |
+      meta age = this
+      root = this + 1
+`,
+			input:  `{"firstName":"caleb","email":"caleb@myspace.com","age":30}`,
+			output: `{"firstName":"caleb","email":"caleb@myspace.com","age":31}`,
+			metadata: map[string]any{
+				"email": "caleb@myspace.com",
+				"age":   json.Number("30"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			mutate := testProtobufProc(t, fmt.Sprintf(`
+operator: mutate
+message: testing.Person
+import_paths: [ %v ]
+mutations: %v
+`, testSchemaDir, test.mutations))
+
+			msgs, err := fromJSON.Process(context.Background(), service.NewMessage([]byte(test.input)))
+			require.NoError(t, err)
+			require.Len(t, msgs, 1)
+
+			msgs, err = mutate.Process(context.Background(), msgs[0])
+			require.NoError(t, err)
+			require.Len(t, msgs, 1)
+
+			for k, v := range test.metadata {
+				actual, exists := msgs[0].MetaGetMut(k)
+				require.True(t, exists, k)
+				assert.Equal(t, v, actual, k)
+			}
+
+			msgs, err = toJSON.Process(context.Background(), msgs[0])
+			require.NoError(t, err)
+			require.Len(t, msgs, 1)
+
+			mBytes, err := msgs[0].AsBytes()
+			require.NoError(t, err)
+			assert.JSONEq(t, test.output, string(mBytes))
+		})
+	}
+}
+
+func TestProtobufMutatePreservesOtherBytes(t *testing.T) {
+	mutate := testProtobufProc(t, fmt.Sprintf(`
+operator: mutate
+message: testing.Person
+import_paths: [ %v ]
+mutations:
+  - path: age
+    mapping: root = 11
+`, testSchemaDir))
+
+	// first_name: "john", an unknown field 99, age: 10, last_name: "oates"
+	prefix := []byte{0x0a, 0x04, 0x6a, 0x6f, 0x68, 0x6e}
+	prefix = protowire.AppendTag(prefix, 99, protowire.BytesType)
+	prefix = protowire.AppendString(prefix, "unknown")
+	suffix := []byte{0x12, 0x05, 0x6f, 0x61, 0x74, 0x65, 0x73}
+
+	input := append(append(append([]byte{}, prefix...), 0x20, 0x0a), suffix...)
+
+	msgs, err := mutate.Process(context.Background(), service.NewMessage(input))
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	mBytes, err := msgs[0].AsBytes()
+	require.NoError(t, err)
+
+	expected := append(append(append([]byte{}, prefix...), 0x20, 0x0b), suffix...)
+	assert.True(t, bytes.Equal(expected, mBytes), "%x != %x", expected, mBytes)
+}
+
+func TestProtobufMutateErrors(t *testing.T) {
+	for _, test := range []struct {
+		path   string
+		errStr string
+	}{
+		{path: "nope", errStr: "field 'nope' not found"},
+		{path: "first_name.foo", errStr: "must be a singular message field"},
+		{path: "last_updated.nope", errStr: "field 'nope' not found within message 'google.protobuf.Timestamp'"},
+	} {
+		conf, err := protobufProcessorSpec().ParseYAML(fmt.Sprintf(`
+operator: mutate
+message: testing.Person
+import_paths: [ %v ]
+mutations:
+  - path: %v
+    mapping: root = this
+`, testSchemaDir, test.path), nil)
+		require.NoError(t, err)
+
+		_, err = newProtobuf(conf, service.MockResources())
+		require.Error(t, err, test.path)
+		assert.Contains(t, err.Error(), test.errStr, test.path)
+	}
+
+	mutate := testProtobufProc(t, fmt.Sprintf(`
+operator: mutate
+message: testing.Person
+import_paths: [ %v ]
+mutations:
+  - path: age
+    mapping: root = "not a number"
+`, testSchemaDir))
+
+	_, err := mutate.Process(context.Background(), service.NewMessage([]byte{0x20, 0x0a}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid mapping result")
+}
+
+func TestProtobufMutateBytesAndOneof(t *testing.T) {
+	schemaDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(schemaDir, "blob.proto"), []byte(`
+syntax = "proto3";
+package testing;
+
+message Blob {
+  bytes data = 1;
+  oneof source {
+    string path = 2;
+    int32 id = 3;
+    Origin origin = 4;
+  }
+}
+
+message Origin {
+  string host = 1;
+}
+`), 0o644))
+
+	fromJSON := testProtobufProc(t, fmt.Sprintf(`
+operator: from_json
+message: testing.Blob
+import_paths: [ %v ]
+`, schemaDir))
+
+	toJSON := testProtobufProc(t, fmt.Sprintf(`
+operator: to_json
+message: testing.Blob
+import_paths: [ %v ]
+`, schemaDir))
+
+	for _, test := range []struct {
+		name      string
+		mutations string
+		input     string
+		output    string
+	}{
+		{
+			name: "bytes are mapped raw",
+			mutations: `
+  - path: data
+    mapping: root = content().uppercase()
+`,
+			input:  `{"data":"aGVsbG8="}`,
+			output: `{"data":"SEVMTE8="}`,
+		},
+		{
+			name: "bytes string result",
+			mutations: `
+  - path: data
+    mapping: root = "not base64"
+`,
+			input:  `{}`,
+			output: `{"data":"bm90IGJhc2U2NA=="}`,
+		},
+		{
+			name: "set oneof member",
+			mutations: `
+  - path: path
+    mapping: root = "/foo"
+`,
+			input:  `{"data":"aGVsbG8=","id":10}`,
+			output: `{"data":"aGVsbG8=","path":"/foo"}`,
+		},
+		{
+			name: "set nested oneof member",
+			mutations: `
+  - path: origin.host
+    mapping: root = "example.com"
+`,
+			input:  `{"path":"/foo"}`,
+			output: `{"origin":{"host":"example.com"}}`,
+		},
+		{
+			name: "delete oneof member",
+			mutations: `
+  - path: path
+    mapping: root = deleted()
+`,
+			input:  `{"id":10}`,
+			output: `{"id":10}`,
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			mutate := testProtobufProc(t, fmt.Sprintf(`
+operator: mutate
+message: testing.Blob
+import_paths: [ %v ]
+mutations: %v
+`, schemaDir, test.mutations))
+
+			msgs, err := fromJSON.Process(context.Background(), service.NewMessage([]byte(test.input)))
+			require.NoError(t, err)
+			require.Len(t, msgs, 1)
+
+			msgs, err = mutate.Process(context.Background(), msgs[0])
+			require.NoError(t, err)
+			require.Len(t, msgs, 1)
+
+			msgs, err = toJSON.Process(context.Background(), msgs[0])
+			require.NoError(t, err)
+			require.Len(t, msgs, 1)
+
+			mBytes, err := msgs[0].AsBytes()
+			require.NoError(t, err)
+			assert.JSONEq(t, test.output, string(mBytes))
+		})
+	}
+}
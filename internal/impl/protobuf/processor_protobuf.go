@@ -18,9 +18,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
 
@@ -59,8 +56,25 @@ Converts protobuf messages into a generic JSON structure. This makes it easier t
 === `+"`from_json`"+`
 
 Attempts to create a target protobuf message from a generic JSON structure.
+
+=== `+"`mutate`"+`
+
+Applies the list of `+"<<mutations, `mutations`>>"+` to fields of protobuf messages without converting the entire message to and from JSON. Only the bytes of the targeted fields are decoded and re-serialized, all other fields of the message are copied verbatim, which makes this operator significantly cheaper than a `+"`to_json`"+`, `+"`mapping`"+`, `+"`from_json`"+` chain when only a few fields of a large message need to be read or changed.
+
+Each mutation executes a mapping with the current value of the field (in its JSON form) as the input document, allowing fields to be set, deleted, or read into metadata.
+
+== Schema sources
+
+Protobuf definitions can be obtained from any combination of the following sources, which are merged together:
+
+- `+"`import_paths`"+`: Directories of .proto files which are parsed at start up.
+- `+"`descriptor_set_file`"+`: A binary encoded `+"`FileDescriptorSet`"+` compiled ahead of time, for example with `+"`buf build`"+`.
+- `+"`schema_registry`"+`: A subject of a Confluent Schema Registry service, along with all schemas it references.
+- `+"`bsr`"+`: A module of a Buf Schema Registry, obtained via its reflection API.
+
+All messages, enums and extensions of the loaded definitions are available for the resolution of `+"`google.protobuf.Any`"+` fields, and the well-known types (`+"`google.protobuf.Timestamp`, `google.protobuf.Struct`"+`, etc) are always available, including within `+"`Any`"+` fields, and are mapped to and from their canonical JSON representation.
 `).Fields(
-		service.NewStringEnumField(fieldOperator, "to_json", "from_json").
+		service.NewStringEnumField(fieldOperator, "to_json", "from_json", "mutate").
 			Description("The <<operators, operator>> to execute"),
 		service.NewStringField(fieldMessage).
 			Description("The fully qualified name of the protobuf message to convert to/from."),
@@ -70,9 +84,9 @@ Attempts to create a target protobuf message from a generic JSON structure.
 		service.NewBoolField(fieldUseProtoNames).
 			Description("If `true`, the `to_json` operator deserializes fields exactly as named in schema file.").
 			Default(false),
-		service.NewStringListField(fieldImportPaths).
-			Description("A list of directories containing .proto files, including all definitions required for parsing the target message. If left empty the current directory is used. Each directory listed will be walked with all found .proto files imported.").
-			Default([]string{}),
+		importPathsField(),
+	).Fields(descriptorSourceFields()...).Fields(
+		mutationsField(),
 	).Example(
 		"JSON to Protobuf", `
 If we have the following protobuf definition within a directory called `+"`testing/schema`"+`:
@@ -166,19 +180,14 @@ func init() {
 
 type protobufOperator func(part *service.Message) error
 
-func newProtobufToJSONOperator(f fs.FS, msg string, importPaths []string, useProtoNames bool) (protobufOperator, error) {
+func newProtobufToJSONOperator(descriptors *protoregistry.Files, types *protoregistry.Types, msg string, useProtoNames bool) (protobufOperator, error) {
 	if msg == "" {
 		return nil, errors.New("message field must not be empty")
 	}
 
-	descriptors, types, err := loadDescriptors(f, importPaths)
-	if err != nil {
-		return nil, err
-	}
-
 	d, err := descriptors.FindDescriptorByName(protoreflect.FullName(msg))
 	if err != nil {
-		return nil, fmt.Errorf("unable to find message '%v' definition within '%v'", msg, importPaths)
+		return nil, fmt.Errorf("unable to find message '%v' definition within the loaded schemas", msg)
 	}
 
 	md, ok := d.(protoreflect.MessageDescriptor)
@@ -193,7 +202,7 @@ func newProtobufToJSONOperator(f fs.FS, msg string, importPaths []string, usePro
 		}
 
 		dynMsg := dynamicpb.NewMessage(md)
-		if err := proto.Unmarshal(partBytes, dynMsg); err != nil {
+		if err := (proto.UnmarshalOptions{Resolver: types}).Unmarshal(partBytes, dynMsg); err != nil {
 			return fmt.Errorf("failed to unmarshal protobuf message '%v': %w", msg, err)
 		}
 
@@ -211,23 +220,14 @@ func newProtobufToJSONOperator(f fs.FS, msg string, importPaths []string, usePro
 	}, nil
 }
 
-func newProtobufFromJSONOperator(f fs.FS, msg string, importPaths []string, discardUnknown bool) (protobufOperator, error) {
+func newProtobufFromJSONOperator(types *protoregistry.Types, msg string, discardUnknown bool) (protobufOperator, error) {
 	if msg == "" {
 		return nil, errors.New("message field must not be empty")
 	}
 
-	_, types, err := loadDescriptors(f, importPaths)
-	if err != nil {
-		return nil, err
-	}
-
-	types.RangeMessages(func(mt protoreflect.MessageType) bool {
-		return true
-	})
-
 	md, err := types.FindMessageByName(protoreflect.FullName(msg))
 	if err != nil {
-		return nil, fmt.Errorf("unable to find message '%v' definition within '%v'", msg, importPaths)
+		return nil, fmt.Errorf("unable to find message '%v' definition within the loaded schemas", msg)
 	}
 
 	return func(part *service.Message) error {
@@ -256,42 +256,16 @@ func newProtobufFromJSONOperator(f fs.FS, msg string, importPaths []string, disc
 	}, nil
 }
 
-func strToProtobufOperator(f fs.FS, opStr, message string, importPaths []string, discardUnknown, useProtoNames bool) (protobufOperator, error) {
+func strToProtobufOperator(descriptors *protoregistry.Files, types *protoregistry.Types, opStr, message string, discardUnknown, useProtoNames bool) (protobufOperator, error) {
 	switch opStr {
 	case "to_json":
-		return newProtobufToJSONOperator(f, message, importPaths, useProtoNames)
+		return newProtobufToJSONOperator(descriptors, types, message, useProtoNames)
 	case "from_json":
-		return newProtobufFromJSONOperator(f, message, importPaths, discardUnknown)
+		return newProtobufFromJSONOperator(types, message, discardUnknown)
 	}
 	return nil, fmt.Errorf("operator not recognised: %v", opStr)
 }
 
-func loadDescriptors(f fs.FS, importPaths []string) (*protoregistry.Files, *protoregistry.Types, error) {
-	files := map[string]string{}
-	for _, importPath := range importPaths {
-		if err := fs.WalkDir(f, importPath, func(path string, info fs.DirEntry, ferr error) error {
-			if ferr != nil || info.IsDir() {
-				return ferr
-			}
-			if filepath.Ext(info.Name()) == ".proto" {
-				rPath, ferr := filepath.Rel(importPath, path)
-				if ferr != nil {
-					return fmt.Errorf("failed to get relative path: %v", ferr)
-				}
-				content, ferr := os.ReadFile(path)
-				if ferr != nil {
-					return fmt.Errorf("failed to read import %v: %v", path, ferr)
-				}
-				files[rPath] = string(content)
-			}
-			return nil
-		}); err != nil {
-			return nil, nil, err
-		}
-	}
-	return RegistriesFromMap(files)
-}
-
 //------------------------------------------------------------------------------
 
 type protobufProc struct {
@@ -314,11 +288,6 @@ func newProtobuf(conf *service.ParsedConfig, mgr *service.Resources) (*protobufP
 		return nil, err
 	}
 
-	var importPaths []string
-	if importPaths, err = conf.FieldStringList(fieldImportPaths); err != nil {
-		return nil, err
-	}
-
 	var discardUnknown bool
 	if discardUnknown, err = conf.FieldBool(fieldDiscardUnknown); err != nil {
 		return nil, err
@@ -329,7 +298,23 @@ func newProtobuf(conf *service.ParsedConfig, mgr *service.Resources) (*protobufP
 		return nil, err
 	}
 
-	if p.operator, err = strToProtobufOperator(mgr.FS(), operatorStr, message, importPaths, discardUnknown, useProtoNames); err != nil {
+	descriptors, types, err := LoadDescriptors(context.Background(), conf, mgr)
+	if err != nil {
+		return nil, err
+	}
+
+	if operatorStr == "mutate" {
+		mutationConfs, err := conf.FieldObjectList(fieldMutations)
+		if err != nil {
+			return nil, err
+		}
+		if p.operator, err = newProtobufMutateOperator(descriptors, types, message, mutationConfs); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	if p.operator, err = strToProtobufOperator(descriptors, types, operatorStr, message, discardUnknown, useProtoNames); err != nil {
 		return nil, err
 	}
 	return p, nil
@@ -26,6 +26,8 @@ func ptrLen(contentPtr, contentLen uint64) uint64 {
 	return (contentPtr << uint64(32)) | contentLen
 }
 
+var errV0BatchMode = errors.New("v0 functions cannot be used when the processor mode is batch")
+
 var moduleRunnerFunctionCtors = map[string]func(r *moduleRunner) interface{}{}
 
 func registerModuleRunnerFunction(name string, ctor func(r *moduleRunner) interface{}) struct{} {
@@ -35,6 +37,10 @@ func registerModuleRunnerFunction(name string, ctor func(r *moduleRunner) interf
 
 var _ = registerModuleRunnerFunction("v0_msg_set_bytes", func(r *moduleRunner) interface{} {
 	return func(ctx context.Context, m api.Module, contentPtr, contentSize uint32) {
+		if r.batchMode {
+			r.funcErr(errV0BatchMode)
+			return
+		}
 		if r.targetMessage == nil {
 			r.funcErr(errors.New("attempted to set bytes of deleted message"))
 			return
@@ -51,6 +57,10 @@ var _ = registerModuleRunnerFunction("v0_msg_set_bytes", func(r *moduleRunner) i
 
 var _ = registerModuleRunnerFunction("v0_msg_as_bytes", func(r *moduleRunner) interface{} {
 	return func(ctx context.Context, m api.Module) (ptrSize uint64) {
+		if r.batchMode {
+			r.funcErr(errV0BatchMode)
+			return
+		}
 		if r.targetMessage == nil {
 			r.funcErr(errors.New("attempted to read bytes of deleted message"))
 			return
@@ -73,6 +83,10 @@ var _ = registerModuleRunnerFunction("v0_msg_as_bytes", func(r *moduleRunner) in
 
 var _ = registerModuleRunnerFunction("v0_msg_set_meta", func(r *moduleRunner) interface{} {
 	return func(ctx context.Context, m api.Module, keyPtr, keySize, contentPtr, contentSize uint32) {
+		if r.batchMode {
+			r.funcErr(errV0BatchMode)
+			return
+		}
 		if r.targetMessage == nil {
 			r.funcErr(errors.New("attempted to set metadata of deleted message"))
 			return
@@ -96,6 +110,10 @@ var _ = registerModuleRunnerFunction("v0_msg_set_meta", func(r *moduleRunner) in
 
 var _ = registerModuleRunnerFunction("v0_msg_get_meta", func(r *moduleRunner) interface{} {
 	return func(ctx context.Context, m api.Module, keyPtr, keySize uint32) (ptrSize uint64) {
+		if r.batchMode {
+			r.funcErr(errV0BatchMode)
+			return
+		}
 		if r.targetMessage == nil {
 			r.funcErr(errors.New("attempted to read meta of deleted message"))
 			return
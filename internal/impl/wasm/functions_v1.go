@@ -0,0 +1,458 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tetratelabs/wazero/api"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// The v1 ABI addresses messages with handles, where the messages of the batch
+// being processed are the handles 0 to v1_batch_len() - 1, and new messages
+// are allocated subsequent handles. Functions returning data return a pointer
+// and length packed into a 64 bit integer, or abiNotFound when the requested
+// data doesn't exist.
+
+const abiNotFound = ^uint64(0)
+
+var errNoResources = errors.New("resources are not available to bloblang plugins")
+
+const (
+	abiFormatJSON uint32 = iota
+	abiFormatMsgPack
+)
+
+const (
+	abiLogTrace uint32 = iota
+	abiLogDebug
+	abiLogInfo
+	abiLogWarn
+	abiLogError
+)
+
+func marshalStructured(format uint32, v any) ([]byte, error) {
+	switch format {
+	case abiFormatJSON:
+		return json.Marshal(v)
+	case abiFormatMsgPack:
+		return msgpack.Marshal(v)
+	}
+	return nil, fmt.Errorf("unknown structured format %v", format)
+}
+
+func unmarshalStructured(format uint32, b []byte) (v any, err error) {
+	switch format {
+	case abiFormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(&v)
+	case abiFormatMsgPack:
+		err = msgpack.Unmarshal(b, &v)
+	default:
+		err = fmt.Errorf("unknown structured format %v", format)
+	}
+	return
+}
+
+// returnBytes allocates data within the module and returns its pointer and
+// length.
+func (r *moduleRunner) returnBytes(ctx context.Context, data []byte) uint64 {
+	contentPtr, err := r.allocateBytesInbound(ctx, data)
+	if err != nil {
+		r.funcErr(fmt.Errorf("failed to allocate in-bound memory: %v", err))
+		return 0
+	}
+	return ptrLen(contentPtr, uint64(len(data)))
+}
+
+// readStrings reads multiple out-bound strings from pairs of pointers and
+// lengths.
+func (r *moduleRunner) readStrings(ctx context.Context, ptrLens ...uint32) ([]string, error) {
+	strs := make([]string, 0, len(ptrLens)/2)
+	for i := 0; i+1 < len(ptrLens); i += 2 {
+		b, err := r.readBytesOutbound(ctx, ptrLens[i], ptrLens[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read out-bound memory: %w", err)
+		}
+		strs = append(strs, string(b))
+	}
+	return strs, nil
+}
+
+var _ = registerModuleRunnerFunction("v1_batch_len", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module) uint32 {
+		if r.batchMode {
+			return uint32(len(r.runBatch))
+		}
+		return 1
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_new", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module) uint32 {
+		return r.newHandle(service.NewMessage(nil))
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_copy", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle uint32) uint32 {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return 0
+		}
+		return r.newHandle(msg.Copy())
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_emit", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle uint32) {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+		r.outBatch = append(r.outBatch, msg)
+		r.outSet = true
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_drop", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module) {
+		r.outSet = true
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_as_bytes", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle uint32) uint64 {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return 0
+		}
+
+		msgBytes, err := msg.AsBytes()
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to get message as bytes: %v", err))
+			return 0
+		}
+		return r.returnBytes(ctx, msgBytes)
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_set_bytes", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, contentPtr, contentSize uint32) {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+
+		contentBytes, err := r.readBytesOutbound(ctx, contentPtr, contentSize)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to read out-bound memory: %w", err))
+			return
+		}
+		msg.SetBytes(contentBytes)
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_as_structured", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, format uint32) uint64 {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return 0
+		}
+
+		v, err := msg.AsStructured()
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to get message as structured: %v", err))
+			return 0
+		}
+
+		structBytes, err := marshalStructured(format, v)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to marshal message: %v", err))
+			return 0
+		}
+		return r.returnBytes(ctx, structBytes)
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_set_structured", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, format, contentPtr, contentSize uint32) {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+
+		contentBytes, err := r.readBytesOutbound(ctx, contentPtr, contentSize)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to read out-bound memory: %w", err))
+			return
+		}
+
+		v, err := unmarshalStructured(format, contentBytes)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to unmarshal structured content: %v", err))
+			return
+		}
+		msg.SetStructuredMut(v)
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_get_meta", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, keyPtr, keySize uint32) uint64 {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return 0
+		}
+
+		keyBytes, err := r.readBytesOutbound(ctx, keyPtr, keySize)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to read out-bound meta key memory: %w", err))
+			return 0
+		}
+
+		metaValue, exists := msg.MetaGet(string(keyBytes))
+		if !exists {
+			return abiNotFound
+		}
+		return r.returnBytes(ctx, []byte(metaValue))
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_set_meta", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, keyPtr, keySize, contentPtr, contentSize uint32) {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+
+		strs, err := r.readStrings(ctx, keyPtr, keySize, contentPtr, contentSize)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+		msg.MetaSetMut(strs[0], strs[1])
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_delete_meta", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, keyPtr, keySize uint32) {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+
+		keyBytes, err := r.readBytesOutbound(ctx, keyPtr, keySize)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to read out-bound meta key memory: %w", err))
+			return
+		}
+		msg.MetaDelete(string(keyBytes))
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_meta_as_structured", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, format uint32) uint64 {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return 0
+		}
+
+		meta := map[string]any{}
+		_ = msg.MetaWalkMut(func(k string, v any) error {
+			meta[k] = v
+			return nil
+		})
+
+		metaBytes, err := marshalStructured(format, meta)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to marshal metadata: %v", err))
+			return 0
+		}
+		return r.returnBytes(ctx, metaBytes)
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_msg_set_error", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, handle, contentPtr, contentSize uint32) {
+		msg, err := r.handle(handle)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+
+		contentBytes, err := r.readBytesOutbound(ctx, contentPtr, contentSize)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to read out-bound memory: %w", err))
+			return
+		}
+		msg.SetError(errors.New(string(contentBytes)))
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_cache_get", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, resPtr, resSize, keyPtr, keySize uint32) uint64 {
+		strs, err := r.readStrings(ctx, resPtr, resSize, keyPtr, keySize)
+		if err != nil {
+			r.funcErr(err)
+			return 0
+		}
+
+		if r.mgr == nil {
+			r.funcErr(errNoResources)
+			return 0
+		}
+
+		var value []byte
+		var cacheErr error
+		if err := r.mgr.AccessCache(ctx, strs[0], func(c service.Cache) {
+			value, cacheErr = c.Get(ctx, strs[1])
+		}); err != nil {
+			r.funcErr(fmt.Errorf("cache resource '%v': %w", strs[0], err))
+			return 0
+		}
+		if errors.Is(cacheErr, service.ErrKeyNotFound) {
+			return abiNotFound
+		}
+		if cacheErr != nil {
+			r.funcErr(fmt.Errorf("cache resource '%v': %w", strs[0], cacheErr))
+			return 0
+		}
+		return r.returnBytes(ctx, value)
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_cache_set", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, resPtr, resSize, keyPtr, keySize, contentPtr, contentSize uint32, ttlMillis uint64) {
+		strs, err := r.readStrings(ctx, resPtr, resSize, keyPtr, keySize, contentPtr, contentSize)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+
+		var ttl *time.Duration
+		if ttlMillis > 0 {
+			d := time.Duration(ttlMillis) * time.Millisecond
+			ttl = &d
+		}
+
+		if r.mgr == nil {
+			r.funcErr(errNoResources)
+			return
+		}
+
+		var cacheErr error
+		if err := r.mgr.AccessCache(ctx, strs[0], func(c service.Cache) {
+			cacheErr = c.Set(ctx, strs[1], []byte(strs[2]), ttl)
+		}); err != nil {
+			cacheErr = err
+		}
+		if cacheErr != nil {
+			r.funcErr(fmt.Errorf("cache resource '%v': %w", strs[0], cacheErr))
+		}
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_cache_delete", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, resPtr, resSize, keyPtr, keySize uint32) {
+		strs, err := r.readStrings(ctx, resPtr, resSize, keyPtr, keySize)
+		if err != nil {
+			r.funcErr(err)
+			return
+		}
+
+		if r.mgr == nil {
+			r.funcErr(errNoResources)
+			return
+		}
+
+		var cacheErr error
+		if err := r.mgr.AccessCache(ctx, strs[0], func(c service.Cache) {
+			cacheErr = c.Delete(ctx, strs[1])
+		}); err != nil {
+			cacheErr = err
+		}
+		if cacheErr != nil && !errors.Is(cacheErr, service.ErrKeyNotFound) {
+			r.funcErr(fmt.Errorf("cache resource '%v': %w", strs[0], cacheErr))
+		}
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_log", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, level, contentPtr, contentSize uint32) {
+		contentBytes, err := r.readBytesOutbound(ctx, contentPtr, contentSize)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to read out-bound memory: %w", err))
+			return
+		}
+
+		switch level {
+		case abiLogTrace:
+			r.log.Trace(string(contentBytes))
+		case abiLogDebug:
+			r.log.Debug(string(contentBytes))
+		case abiLogInfo:
+			r.log.Info(string(contentBytes))
+		case abiLogWarn:
+			r.log.Warn(string(contentBytes))
+		default:
+			r.log.Error(string(contentBytes))
+		}
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_plugin_config", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, format uint32) uint64 {
+		if r.pluginConfig == nil {
+			return abiNotFound
+		}
+
+		confBytes, err := marshalStructured(format, r.pluginConfig)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to marshal plugin config: %v", err))
+			return 0
+		}
+		return r.returnBytes(ctx, confBytes)
+	}
+})
+
+var _ = registerModuleRunnerFunction("v1_fail", func(r *moduleRunner) interface{} {
+	return func(ctx context.Context, m api.Module, contentPtr, contentSize uint32) {
+		contentBytes, err := r.readBytesOutbound(ctx, contentPtr, contentSize)
+		if err != nil {
+			r.funcErr(fmt.Errorf("failed to read out-bound memory: %w", err))
+			return
+		}
+		r.funcErr(errors.New(string(contentBytes)))
+	}
+})
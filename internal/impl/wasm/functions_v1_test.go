@@ -0,0 +1,316 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func wasmULEB(v uint64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		if v >>= 7; v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func wasmSLEB(v int64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func wasmVec(items ...[]byte) []byte {
+	return append(wasmULEB(uint64(len(items))), bytes.Join(items, nil)...)
+}
+
+func wasmName(s string) []byte {
+	return append(wasmULEB(uint64(len(s))), s...)
+}
+
+func wasmSection(id byte, contents []byte) []byte {
+	return append(append([]byte{id}, wasmULEB(uint64(len(contents)))...), contents...)
+}
+
+func wasmFuncType(params, results []byte) []byte {
+	return append(append([]byte{0x60}, wasmVec(splitBytes(params)...)...), wasmVec(splitBytes(results)...)...)
+}
+
+func splitBytes(b []byte) [][]byte {
+	s := make([][]byte, len(b))
+	for i := range b {
+		s[i] = b[i : i+1]
+	}
+	return s
+}
+
+func wasmCode(locals []byte, body ...[]byte) []byte {
+	fn := append(locals, bytes.Join(body, nil)...)
+	return append(wasmULEB(uint64(len(fn))), fn...)
+}
+
+const (
+	i32 = 0x7f
+	i64 = 0x7e
+)
+
+func i32Const(v int64) []byte  { return append([]byte{0x41}, wasmSLEB(v)...) }
+func i64Const(v int64) []byte  { return append([]byte{0x42}, wasmSLEB(v)...) }
+func localGet(i uint64) []byte { return append([]byte{0x20}, wasmULEB(i)...) }
+func localSet(i uint64) []byte { return append([]byte{0x21}, wasmULEB(i)...) }
+func call(fn uint64) []byte    { return append([]byte{0x10}, wasmULEB(fn)...) }
+
+// wasmHeapReset resets the bump allocator of a module, which each exported
+// function calls before using the allocator.
+var wasmHeapReset = []byte{0x41, 0x80, 0x08, 0x24, 0x00}
+
+func unpackPtrLen(l uint64) []byte {
+	// Converts a packed i64 local into a pointer and length on the stack.
+	return bytes.Join([][]byte{
+		localGet(l), i64Const(32), {0x88, 0xa7},
+		localGet(l), {0xa7},
+	}, nil)
+}
+
+// wasmBumpMalloc is the code of a malloc function for a bump allocator with the
+// heap pointer held in global 0.
+func wasmBumpMalloc() []byte {
+	return wasmCode(wasmVec(),
+		[]byte{0x23, 0x00, 0x23, 0x00}, localGet(0), []byte{0x6a, 0x24, 0x00, 0x0b},
+	)
+}
+
+// buildWASMModule assembles a module from its sections, with a memory and a
+// heap pointer global starting at 1024 added, and the memory exported. The
+// data is written at offset 0.
+func buildWASMModule(types, imports, funcs []byte, exports [][]byte, code []byte, data string) []byte {
+	memory := wasmVec([]byte{0x00, 0x01})
+	globals := wasmVec(bytes.Join([][]byte{{i32, 0x01}, i32Const(1024), {0x0b}}, nil))
+	exports = append([][]byte{append(wasmName("memory"), 0x02, 0x00)}, exports...)
+	return bytes.Join([][]byte{
+		{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00},
+		wasmSection(1, types),
+		wasmSection(2, imports),
+		wasmSection(3, funcs),
+		wasmSection(5, memory),
+		wasmSection(6, globals),
+		wasmSection(7, wasmVec(exports...)),
+		wasmSection(10, code),
+		wasmSection(11, wasmVec(bytes.Join([][]byte{
+			{0x00}, i32Const(0), {0x0b}, wasmName(data),
+		}, nil))),
+	}, nil)
+}
+
+// testV1Module assembles a module that, for each processed message, emits two
+// copies of the message with their structured contents round tripped through
+// JSON and the metadata key `seen` set, and then emits a message containing
+// the value of the key `key` of the cache `cache` when it exists.
+func testV1Module() []byte {
+	const (
+		fBatchLen = iota
+		fMsgCopy
+		fEmit
+		fAsStructured
+		fSetStructured
+		fSetMeta
+		fLog
+		fCacheGet
+		fMsgNew
+		fSetBytes
+		fMalloc
+		fProcess
+	)
+
+	types := wasmVec(
+		wasmFuncType(nil, []byte{i32}),                        // 0
+		wasmFuncType([]byte{i32}, []byte{i32}),                // 1
+		wasmFuncType([]byte{i32}, nil),                        // 2
+		wasmFuncType([]byte{i32, i32}, []byte{i64}),           // 3
+		wasmFuncType([]byte{i32, i32, i32, i32}, nil),         // 4
+		wasmFuncType([]byte{i32, i32, i32, i32, i32}, nil),    // 5
+		wasmFuncType([]byte{i32, i32, i32}, nil),              // 6
+		wasmFuncType([]byte{i32, i32, i32, i32}, []byte{i64}), // 7
+		wasmFuncType(nil, nil),                                // 8
+	)
+
+	imp := func(name string, typeIdx byte) []byte {
+		return append(append(wasmName("benthos_wasm"), wasmName(name)...), 0x00, typeIdx)
+	}
+	imports := wasmVec(
+		imp("v1_batch_len", 0),
+		imp("v1_msg_copy", 1),
+		imp("v1_emit", 2),
+		imp("v1_msg_as_structured", 3),
+		imp("v1_msg_set_structured", 4),
+		imp("v1_msg_set_meta", 5),
+		imp("v1_log", 6),
+		imp("v1_cache_get", 7),
+		imp("v1_msg_new", 0),
+		imp("v1_msg_set_bytes", 6),
+	)
+
+	funcs := wasmVec([]byte{1}, []byte{8})
+	exports := [][]byte{
+		append(wasmName("malloc"), 0x00, fMalloc),
+		append(wasmName("process"), 0x00, fProcess),
+	}
+
+	const li, lh, ls = 0, 1, 2
+	process := wasmCode(wasmVec([]byte{0x02, i32}, []byte{0x01, i64}),
+		wasmHeapReset,
+		i32Const(2), i32Const(16), i32Const(16), call(fLog),
+
+		[]byte{0x02, 0x40, 0x03, 0x40},                          // block, loop
+		localGet(li), call(fBatchLen), []byte{0x4f, 0x0d, 0x01}, // i >= len: br_if 1
+		localGet(li), call(fMsgCopy), localSet(lh),
+		localGet(li), i32Const(0), call(fAsStructured), localSet(ls),
+		localGet(lh), i32Const(0), unpackPtrLen(ls), call(fSetStructured),
+		localGet(lh), i32Const(8), i32Const(4), i32Const(12), i32Const(3), call(fSetMeta),
+		localGet(lh), call(fEmit),
+		localGet(lh), call(fMsgCopy), call(fEmit),
+		localGet(li), i32Const(1), []byte{0x6a}, localSet(li),
+		[]byte{0x0c, 0x00, 0x0b, 0x0b}, // br 0, end loop, end block
+
+		i32Const(0), i32Const(5), i32Const(5), i32Const(3), call(fCacheGet), localSet(ls),
+		localGet(ls), i64Const(-1), []byte{0x52, 0x04, 0x40}, // if s != -1
+		call(fMsgNew), localSet(lh),
+		localGet(lh), unpackPtrLen(ls), call(fSetBytes),
+		localGet(lh), call(fEmit),
+		[]byte{0x0b, 0x0b},
+	)
+	return buildWASMModule(types, imports, funcs, exports,
+		wasmVec(wasmBumpMalloc(), process),
+		"cachekeyseenyes\x00processing batch")
+}
+
+func testV1Processor(t *testing.T, mode string, res *service.Resources) *wazeroAllocProcessor {
+	t.Helper()
+
+	modulePath := filepath.Join(t.TempDir(), "module.wasm")
+	require.NoError(t, os.WriteFile(modulePath, testV1Module(), 0o644))
+
+	conf, err := wazeroAllocProcessorConfig().ParseYAML(fmt.Sprintf(`
+module_path: %v
+mode: %v
+`, modulePath, mode), nil)
+	require.NoError(t, err)
+
+	proc, err := newWazeroAllocProcessorFromConfig(conf, res)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, proc.Close(context.Background()))
+	})
+	return proc
+}
+
+func testBatchContents(t *testing.T, batch service.MessageBatch) (contents, seen []string) {
+	t.Helper()
+	for _, m := range batch {
+		require.NoError(t, m.GetError())
+		b, err := m.AsBytes()
+		require.NoError(t, err)
+		contents = append(contents, string(b))
+		v, _ := m.MetaGet("seen")
+		seen = append(seen, v)
+	}
+	return
+}
+
+func TestWazeroV1BatchMode(t *testing.T) {
+	res := service.MockResources(service.MockResourcesOptAddCache("cache"))
+	proc := testV1Processor(t, "batch", res)
+
+	inBatch := service.MessageBatch{
+		service.NewMessage([]byte(`{"id":1}`)),
+		service.NewMessage([]byte(`{"id":2}`)),
+	}
+	outBatches, err := proc.ProcessBatch(context.Background(), inBatch)
+	require.NoError(t, err)
+	require.Len(t, outBatches, 1)
+
+	contents, seen := testBatchContents(t, outBatches[0])
+	assert.Equal(t, []string{`{"id":1}`, `{"id":1}`, `{"id":2}`, `{"id":2}`}, contents)
+	assert.Equal(t, []string{"yes", "yes", "yes", "yes"}, seen)
+
+	// The original messages are unchanged
+	_, exists := inBatch[0].MetaGet("seen")
+	assert.False(t, exists)
+
+	require.NoError(t, res.AccessCache(context.Background(), "cache", func(c service.Cache) {
+		require.NoError(t, c.Set(context.Background(), "key", []byte("cached"), nil))
+	}))
+
+	outBatches, err = proc.ProcessBatch(context.Background(), inBatch[:1])
+	require.NoError(t, err)
+
+	contents, seen = testBatchContents(t, outBatches[0])
+	assert.Equal(t, []string{`{"id":1}`, `{"id":1}`, `cached`}, contents)
+	assert.Equal(t, []string{"yes", "yes", ""}, seen)
+}
+
+func TestWazeroV1MessageMode(t *testing.T) {
+	res := service.MockResources(service.MockResourcesOptAddCache("cache"))
+	proc := testV1Processor(t, "message", res)
+
+	outBatches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`{"id":1}`)),
+		service.NewMessage([]byte(`{"id":2}`)),
+	})
+	require.NoError(t, err)
+	require.Len(t, outBatches, 1)
+
+	contents, _ := testBatchContents(t, outBatches[0])
+	assert.Equal(t, []string{`{"id":1}`, `{"id":1}`, `{"id":2}`, `{"id":2}`}, contents)
+}
+
+func TestWazeroV1Errors(t *testing.T) {
+	proc := testV1Processor(t, "batch", service.MockResources())
+
+	outBatches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte(`not structured`)),
+		service.NewMessage([]byte(`{"id":2}`)),
+	})
+	require.NoError(t, err)
+	require.Len(t, outBatches, 1)
+	require.Len(t, outBatches[0], 2)
+
+	for _, m := range outBatches[0] {
+		require.Error(t, m.GetError())
+	}
+	assert.Contains(t, outBatches[0][0].GetError().Error(), "cache resource 'cache'")
+}
@@ -0,0 +1,649 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	pmFieldName        = "name"
+	pmFieldType        = "type"
+	pmFieldModule      = "module"
+	pmFieldSummary     = "summary"
+	pmFieldDescription = "description"
+	pmFieldTimeout     = "timeout"
+	pmFieldFields      = "fields"
+	pmFieldFieldName   = "name"
+	pmFieldFieldType   = "type"
+	pmFieldFieldDesc   = "description"
+	pmFieldFieldDef    = "default"
+
+	pluginOutputBatchingField = "batching"
+)
+
+func pluginManifestSpec() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Fields(
+			service.NewStringField(pmFieldName).
+				Description("The name the plugin is registered as."),
+			service.NewStringEnumField(pmFieldType, "input", "output", "bloblang_function", "bloblang_method").
+				Description("The type of plugin."),
+			service.NewStringField(pmFieldModule).
+				Description("The path of the WASM module, relative to the manifest."),
+			service.NewStringField(pmFieldSummary).
+				Default(""),
+			service.NewStringField(pmFieldDescription).
+				Default(""),
+			service.NewDurationField(pmFieldTimeout).
+				Description("The maximum period of time that each call of a bloblang function or method plugin can run for before it is interrupted and fails, where `0s` disables the timeout.").
+				Default("5s"),
+			service.NewObjectListField(pmFieldFields,
+				service.NewStringField(pmFieldFieldName),
+				service.NewStringEnumField(pmFieldFieldType, "string", "int", "float", "bool", "string_list", "any").
+					Default("string"),
+				service.NewStringField(pmFieldFieldDesc).
+					Default(""),
+				service.NewAnyField(pmFieldFieldDef).
+					Optional(),
+			).
+				Description("The configuration fields of an input or output plugin, or the parameters of a bloblang plugin.").
+				Default([]any{}),
+		)
+}
+
+type pluginField struct {
+	name        string
+	typeStr     string
+	description string
+	def         any
+	hasDef      bool
+}
+
+type pluginManifest struct {
+	name        string
+	typeStr     string
+	wasmBinary  []byte
+	summary     string
+	description string
+	timeout     time.Duration
+	fields      []pluginField
+
+	// The logger of bloblang plugins, which unlike inputs and outputs are not
+	// provided with the resources of the pipeline executing them.
+	log *atomic.Pointer[service.Logger]
+}
+
+func readPluginManifest(path string) (*pluginManifest, error) {
+	manifestBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	conf, err := pluginManifestSpec().ParseYAML(string(manifestBytes), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &pluginManifest{}
+	if m.name, err = conf.FieldString(pmFieldName); err != nil {
+		return nil, err
+	}
+	if m.typeStr, err = conf.FieldString(pmFieldType); err != nil {
+		return nil, err
+	}
+	if m.summary, err = conf.FieldString(pmFieldSummary); err != nil {
+		return nil, err
+	}
+	if m.description, err = conf.FieldString(pmFieldDescription); err != nil {
+		return nil, err
+	}
+	if m.timeout, err = conf.FieldDuration(pmFieldTimeout); err != nil {
+		return nil, err
+	}
+
+	modulePath, err := conf.FieldString(pmFieldModule)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(modulePath) {
+		modulePath = filepath.Join(filepath.Dir(path), modulePath)
+	}
+	if m.wasmBinary, err = os.ReadFile(modulePath); err != nil {
+		return nil, err
+	}
+
+	fieldConfs, err := conf.FieldObjectList(pmFieldFields)
+	if err != nil {
+		return nil, err
+	}
+	for _, fc := range fieldConfs {
+		var f pluginField
+		if f.name, err = fc.FieldString(pmFieldFieldName); err != nil {
+			return nil, err
+		}
+		if m.typeStr == "output" && f.name == pluginOutputBatchingField {
+			return nil, fmt.Errorf("field name %v is reserved for output plugins", f.name)
+		}
+		if f.typeStr, err = fc.FieldString(pmFieldFieldType); err != nil {
+			return nil, err
+		}
+		if f.description, err = fc.FieldString(pmFieldFieldDesc); err != nil {
+			return nil, err
+		}
+		if fc.Contains(pmFieldFieldDef) {
+			f.hasDef = true
+			if f.def, err = fc.FieldAny(pmFieldFieldDef); err != nil {
+				return nil, err
+			}
+		}
+		m.fields = append(m.fields, f)
+	}
+	return m, nil
+}
+
+// Plugins is a set of registered WASM plugins.
+type Plugins struct {
+	log atomic.Pointer[service.Logger]
+}
+
+// SetLogger sets the logger of bloblang function and method plugins, which is
+// otherwise absent and their logs are dropped. Input and output plugins log
+// through the logger of the pipeline executing them.
+func (p *Plugins) SetLogger(l *service.Logger) {
+	if p != nil {
+		p.log.Store(l)
+	}
+}
+
+// RegisterPlugins registers the WASM plugins described by each YAML manifest
+// within a directory as inputs, outputs and bloblang functions and methods.
+func RegisterPlugins(env *service.Environment, bloblEnv *bloblang.Environment, dir string) (*Plugins, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	p := &Plugins{}
+	for _, path := range paths {
+		m, err := readPluginManifest(path)
+		if err != nil {
+			return nil, fmt.Errorf("plugin manifest %v: %w", path, err)
+		}
+		m.log = &p.log
+		if err := m.register(env, bloblEnv); err != nil {
+			return nil, fmt.Errorf("plugin manifest %v: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+func (m *pluginManifest) requiredExport() string {
+	switch m.typeStr {
+	case "input":
+		return "read"
+	case "output":
+		return "write"
+	}
+	return "call"
+}
+
+func (m *pluginManifest) register(env *service.Environment, bloblEnv *bloblang.Environment) error {
+	// Ensure that the module can be instantiated and exports the function
+	// required by its plugin type.
+	mod, err := newModuleRunner(m.wasmBinary, wazero.NewRuntimeConfig(), nil, nil)
+	if err != nil {
+		return err
+	}
+	fn := mod.mod.ExportedFunction(m.requiredExport())
+	_ = mod.Close(context.Background())
+	if fn == nil {
+		return fmt.Errorf("module does not export the function %v", m.requiredExport())
+	}
+
+	switch m.typeStr {
+	case "input":
+		return env.RegisterBatchInput(m.name, m.configSpec(),
+			func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+				return newPluginInput(m, conf, mgr)
+			})
+	case "output":
+		spec := m.configSpec().Field(service.NewBatchPolicyField(pluginOutputBatchingField))
+		return env.RegisterBatchOutput(m.name, spec,
+			func(conf *service.ParsedConfig, mgr *service.Resources) (out service.BatchOutput, batchPol service.BatchPolicy, maxInFlight int, err error) {
+				if batchPol, err = conf.FieldBatchPolicy(pluginOutputBatchingField); err != nil {
+					return
+				}
+				out, err = newPluginOutput(m, conf, mgr)
+				return out, batchPol, 1, err
+			})
+	case "bloblang_function":
+		return bloblEnv.RegisterFunctionV2(m.name, m.bloblangSpec(),
+			func(args *bloblang.ParsedParams) (bloblang.Function, error) {
+				pool, err := m.bloblangPool(args)
+				if err != nil {
+					return nil, err
+				}
+				return func() (any, error) {
+					return pool.call(nil)
+				}, nil
+			})
+	case "bloblang_method":
+		return bloblEnv.RegisterMethodV2(m.name, m.bloblangSpec(),
+			func(args *bloblang.ParsedParams) (bloblang.Method, error) {
+				pool, err := m.bloblangPool(args)
+				if err != nil {
+					return nil, err
+				}
+				return func(v any) (any, error) {
+					return pool.call(v)
+				}, nil
+			})
+	}
+	return fmt.Errorf("plugin type %v not recognised", m.typeStr)
+}
+
+func (m *pluginManifest) configSpec() *service.ConfigSpec {
+	spec := service.NewConfigSpec().
+		Summary(m.summary).
+		Description(m.description)
+	for _, f := range m.fields {
+		var field *service.ConfigField
+		switch f.typeStr {
+		case "int":
+			field = service.NewIntField(f.name)
+		case "float":
+			field = service.NewFloatField(f.name)
+		case "bool":
+			field = service.NewBoolField(f.name)
+		case "string_list":
+			field = service.NewStringListField(f.name)
+		case "any":
+			field = service.NewAnyField(f.name)
+		default:
+			field = service.NewStringField(f.name)
+		}
+		field = field.Description(f.description)
+		if f.hasDef {
+			field = field.Default(f.def)
+		}
+		spec = spec.Field(field)
+	}
+	return spec
+}
+
+func (m *pluginManifest) configMap(conf *service.ParsedConfig) (map[string]any, error) {
+	confMap := make(map[string]any, len(m.fields))
+	for _, f := range m.fields {
+		v, err := conf.FieldAny(f.name)
+		if err != nil {
+			return nil, err
+		}
+		confMap[f.name] = v
+	}
+	return confMap, nil
+}
+
+//------------------------------------------------------------------------------
+
+type pluginInput struct {
+	m     *pluginManifest
+	log   *service.Logger
+	mgr   *service.Resources
+	conf  map[string]any
+	mut   sync.Mutex
+	mod   *moduleRunner
+	read  api.Function
+	ack   api.Function
+	ended bool
+	id    uint64
+}
+
+func newPluginInput(m *pluginManifest, conf *service.ParsedConfig, mgr *service.Resources) (*pluginInput, error) {
+	confMap, err := m.configMap(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &pluginInput{
+		m:    m,
+		log:  mgr.Logger(),
+		mgr:  mgr,
+		conf: confMap,
+	}, nil
+}
+
+func (p *pluginInput) Connect(ctx context.Context) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if p.mod != nil {
+		return nil
+	}
+
+	mod, err := newModuleRunner(p.m.wasmBinary, wazero.NewRuntimeConfig(), p.log, p.mgr)
+	if err != nil {
+		return err
+	}
+	mod.pluginConfig = p.conf
+
+	if connect := mod.mod.ExportedFunction("connect"); connect != nil {
+		if _, _, err := mod.CallPlugin(ctx, connect, nil); err != nil {
+			_ = mod.Close(context.Background())
+			return err
+		}
+	}
+
+	p.mod = mod
+	p.read = mod.mod.ExportedFunction("read")
+	p.ack = mod.mod.ExportedFunction("ack")
+	return nil
+}
+
+func (p *pluginInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	for {
+		batch, ackFn, err := p.readBatch(ctx)
+		if err != nil || len(batch) > 0 {
+			return batch, ackFn, err
+		}
+
+		// Nothing was emitted, back off before reading again.
+		select {
+		case <-time.After(time.Millisecond * 100):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+func (p *pluginInput) readBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if p.mod == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+	if p.ended {
+		return nil, nil, service.ErrEndOfInput
+	}
+
+	p.id++
+	id := p.id
+
+	res, batch, err := p.mod.CallPlugin(ctx, p.read, nil, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(res) > 0 && uint32(res[0]) == 1 {
+		p.ended = true
+		if len(batch) == 0 {
+			return nil, nil, service.ErrEndOfInput
+		}
+	}
+	if len(batch) == 0 {
+		return nil, nil, nil
+	}
+
+	return batch, func(ctx context.Context, err error) error {
+		if p.ack == nil {
+			return nil
+		}
+
+		p.mut.Lock()
+		defer p.mut.Unlock()
+
+		if p.mod == nil {
+			return nil
+		}
+
+		var success uint64
+		if err == nil {
+			success = 1
+		}
+		_, _, ackErr := p.mod.CallPlugin(ctx, p.ack, nil, id, success)
+		return ackErr
+	}, nil
+}
+
+func (p *pluginInput) Close(ctx context.Context) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if p.mod == nil {
+		return nil
+	}
+
+	var closeErr error
+	if closeFn := p.mod.mod.ExportedFunction("close"); closeFn != nil {
+		_, _, closeErr = p.mod.CallPlugin(ctx, closeFn, nil)
+	}
+	if err := p.mod.Close(ctx); err != nil && closeErr == nil {
+		closeErr = err
+	}
+	p.mod = nil
+	return closeErr
+}
+
+//------------------------------------------------------------------------------
+
+type pluginOutput struct {
+	m     *pluginManifest
+	log   *service.Logger
+	mgr   *service.Resources
+	conf  map[string]any
+	mut   sync.Mutex
+	mod   *moduleRunner
+	write api.Function
+}
+
+func newPluginOutput(m *pluginManifest, conf *service.ParsedConfig, mgr *service.Resources) (*pluginOutput, error) {
+	confMap, err := m.configMap(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &pluginOutput{
+		m:    m,
+		log:  mgr.Logger(),
+		mgr:  mgr,
+		conf: confMap,
+	}, nil
+}
+
+func (p *pluginOutput) Connect(ctx context.Context) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if p.mod != nil {
+		return nil
+	}
+
+	mod, err := newModuleRunner(p.m.wasmBinary, wazero.NewRuntimeConfig(), p.log, p.mgr)
+	if err != nil {
+		return err
+	}
+	mod.pluginConfig = p.conf
+
+	if connect := mod.mod.ExportedFunction("connect"); connect != nil {
+		if _, _, err := mod.CallPlugin(ctx, connect, nil); err != nil {
+			_ = mod.Close(context.Background())
+			return err
+		}
+	}
+
+	p.mod = mod
+	p.write = mod.mod.ExportedFunction("write")
+	return nil
+}
+
+func (p *pluginOutput) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if p.mod == nil {
+		return service.ErrNotConnected
+	}
+	_, _, err := p.mod.CallPlugin(ctx, p.write, batch)
+	return err
+}
+
+func (p *pluginOutput) Close(ctx context.Context) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if p.mod == nil {
+		return nil
+	}
+
+	var closeErr error
+	if closeFn := p.mod.mod.ExportedFunction("close"); closeFn != nil {
+		_, _, closeErr = p.mod.CallPlugin(ctx, closeFn, nil)
+	}
+	if err := p.mod.Close(ctx); err != nil && closeErr == nil {
+		closeErr = err
+	}
+	p.mod = nil
+	return closeErr
+}
+
+//------------------------------------------------------------------------------
+
+func (m *pluginManifest) bloblangSpec() *bloblang.PluginSpec {
+	spec := bloblang.NewPluginSpec().Description(m.description)
+	if m.typeStr == "bloblang_function" {
+		spec = spec.Impure()
+	}
+	for _, f := range m.fields {
+		var param bloblang.ParamDefinition
+		switch f.typeStr {
+		case "int":
+			param = bloblang.NewInt64Param(f.name)
+		case "float":
+			param = bloblang.NewFloat64Param(f.name)
+		case "bool":
+			param = bloblang.NewBoolParam(f.name)
+		case "string":
+			param = bloblang.NewStringParam(f.name)
+		default:
+			param = bloblang.NewAnyParam(f.name)
+		}
+		param = param.Description(f.description)
+		if f.hasDef {
+			param = param.Default(f.def)
+		}
+		spec = spec.Param(param)
+	}
+	return spec
+}
+
+// bloblangPluginPool is a bounded pool of module runners for a bloblang
+// function or method, as a single module can't be called in parallel.
+type bloblangPluginPool struct {
+	m    *pluginManifest
+	conf any
+	pool chan *moduleRunner
+}
+
+func (m *pluginManifest) bloblangPool(args *bloblang.ParsedParams) (*bloblangPluginPool, error) {
+	p := &bloblangPluginPool{
+		m:    m,
+		pool: make(chan *moduleRunner, runtime.NumCPU()),
+	}
+	if len(m.fields) > 0 {
+		values := args.AsSlice()
+		confMap := make(map[string]any, len(m.fields))
+		for i, f := range m.fields {
+			confMap[f.name] = values[i]
+		}
+		p.conf = confMap
+	}
+
+	// Ensure we can create at least one module runner.
+	mod, err := p.newModule()
+	if err != nil {
+		return nil, err
+	}
+	p.pool <- mod
+	return p, nil
+}
+
+func (p *bloblangPluginPool) newModule() (*moduleRunner, error) {
+	rConf := wazero.NewRuntimeConfig()
+	if p.m.timeout > 0 {
+		rConf = rConf.WithCloseOnContextDone(true)
+	}
+	mod, err := newModuleRunner(p.m.wasmBinary, rConf, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	mod.pluginConfig = p.conf
+	mod.process = mod.mod.ExportedFunction("call")
+	mod.timeout = p.m.timeout
+	return mod, nil
+}
+
+func (p *bloblangPluginPool) call(v any) (any, error) {
+	var mod *moduleRunner
+	select {
+	case mod = <-p.pool:
+	default:
+		var err error
+		if mod, err = p.newModule(); err != nil {
+			return nil, err
+		}
+	}
+	if p.m.log != nil {
+		mod.log = p.m.log.Load()
+	}
+
+	msg := service.NewMessage(nil)
+	msg.SetStructured(v)
+
+	if _, _, err := mod.CallPlugin(context.Background(), mod.process, service.MessageBatch{msg}); err != nil {
+		// Modules that were interrupted or failed are discarded rather than
+		// reused.
+		_ = mod.Close(context.Background())
+		return nil, err
+	}
+
+	select {
+	case p.pool <- mod:
+	default:
+		_ = mod.Close(context.Background())
+	}
+
+	res, err := msg.AsStructured()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse plugin result: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,363 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// testPluginModule assembles a module implementing every plugin type:
+//
+// - read emits a message containing the plugin config as JSON and ends the
+// input.
+// - write sets the key `last` of the cache `cache` to each message written.
+// - call sets the message to the plugin config when it exists, and otherwise
+// leaves it unchanged.
+func testPluginModule() []byte {
+	const (
+		fPluginConfig = iota
+		fMsgNew
+		fSetBytes
+		fEmit
+		fBatchLen
+		fAsBytes
+		fCacheSet
+		fSetStructured
+		fMalloc
+		fRead
+		fWrite
+		fCall
+	)
+
+	types := wasmVec(
+		wasmFuncType(nil, []byte{i32}),                               // 0
+		wasmFuncType([]byte{i32}, []byte{i64}),                       // 1
+		wasmFuncType([]byte{i32, i32, i32}, nil),                     // 2
+		wasmFuncType([]byte{i32}, nil),                               // 3
+		wasmFuncType([]byte{i32, i32, i32, i32, i32, i32, i64}, nil), // 4
+		wasmFuncType([]byte{i32, i32, i32, i32}, nil),                // 5
+		wasmFuncType([]byte{i32}, []byte{i32}),                       // 6
+		wasmFuncType([]byte{i64}, []byte{i32}),                       // 7
+		wasmFuncType(nil, nil),                                       // 8
+	)
+
+	imp := func(name string, typeIdx byte) []byte {
+		return append(append(wasmName("benthos_wasm"), wasmName(name)...), 0x00, typeIdx)
+	}
+	imports := wasmVec(
+		imp("v1_plugin_config", 1),
+		imp("v1_msg_new", 0),
+		imp("v1_msg_set_bytes", 2),
+		imp("v1_emit", 3),
+		imp("v1_batch_len", 0),
+		imp("v1_msg_as_bytes", 1),
+		imp("v1_cache_set", 4),
+		imp("v1_msg_set_structured", 5),
+	)
+
+	funcs := wasmVec([]byte{6}, []byte{7}, []byte{8}, []byte{8})
+	exports := [][]byte{
+		append(wasmName("malloc"), 0x00, fMalloc),
+		append(wasmName("read"), 0x00, fRead),
+		append(wasmName("write"), 0x00, fWrite),
+		append(wasmName("call"), 0x00, fCall),
+	}
+
+	read := wasmCode(wasmVec([]byte{0x01, i32}, []byte{0x01, i64}),
+		wasmHeapReset,
+		i32Const(0), call(fPluginConfig), localSet(2),
+		call(fMsgNew), localSet(1),
+		localGet(1), unpackPtrLen(2), call(fSetBytes),
+		localGet(1), call(fEmit),
+		i32Const(1), []byte{0x0b},
+	)
+
+	write := wasmCode(wasmVec([]byte{0x01, i32}, []byte{0x01, i64}),
+		wasmHeapReset,
+		[]byte{0x02, 0x40, 0x03, 0x40},                         // block, loop
+		localGet(0), call(fBatchLen), []byte{0x4f, 0x0d, 0x01}, // i >= len: br_if 1
+		localGet(0), call(fAsBytes), localSet(1),
+		i32Const(0), i32Const(5), i32Const(5), i32Const(4), unpackPtrLen(1), i64Const(0), call(fCacheSet),
+		localGet(0), i32Const(1), []byte{0x6a}, localSet(0),
+		[]byte{0x0c, 0x00, 0x0b, 0x0b}, // br 0, end loop, end block
+		[]byte{0x0b},
+	)
+
+	callFn := wasmCode(wasmVec([]byte{0x01, i64}),
+		wasmHeapReset,
+		i32Const(0), call(fPluginConfig), localSet(0),
+		localGet(0), i64Const(-1), []byte{0x52, 0x04, 0x40}, // if config != -1
+		i32Const(0), i32Const(0), unpackPtrLen(0), call(fSetStructured),
+		[]byte{0x0b, 0x0b},
+	)
+
+	return buildWASMModule(types, imports, funcs, exports,
+		wasmVec(wasmBumpMalloc(), read, write, callFn),
+		"cachelast")
+}
+
+func testPluginsDir(t *testing.T, manifests map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plugin.wasm"), testPluginModule(), 0o644))
+	for name, content := range manifests {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestPluginsRegister(t *testing.T) {
+	dir := testPluginsDir(t, map[string]string{
+		"input.yaml": `
+name: wasm_in
+type: input
+module: ./plugin.wasm
+fields:
+  - name: foo
+    type: string
+`,
+		"output.yml": `
+name: wasm_out
+type: output
+module: plugin.wasm
+`,
+		"function.yaml": `
+name: wasm_fn
+type: bloblang_function
+module: plugin.wasm
+fields:
+  - name: value
+    type: any
+  - name: count
+    type: int
+    default: 3
+`,
+		"method.yaml": `
+name: wasm_method
+type: bloblang_method
+module: plugin.wasm
+`,
+		"ignored.txt": `not a manifest`,
+	})
+
+	env := service.NewEmptyEnvironment()
+	bloblEnv := bloblang.NewEmptyEnvironment()
+	_, err := RegisterPlugins(env, bloblEnv, dir)
+	require.NoError(t, err)
+
+	var inputs, outputs []string
+	env.WalkInputs(func(name string, _ *service.ConfigView) {
+		inputs = append(inputs, name)
+	})
+	env.WalkOutputs(func(name string, _ *service.ConfigView) {
+		outputs = append(outputs, name)
+	})
+	assert.Equal(t, []string{"wasm_in"}, inputs)
+	assert.Equal(t, []string{"wasm_out"}, outputs)
+
+	exe, err := bloblEnv.Parse(`root.fn = wasm_fn(value: "bar")
+root.method = this.wasm_method()`)
+	require.NoError(t, err)
+
+	res, err := exe.Query(map[string]any{"a": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"fn":     map[string]any{"value": "bar", "count": int64(3)},
+		"method": map[string]any{"a": "b"},
+	}, jsonRoundTrip(t, res))
+}
+
+// jsonRoundTrip normalises numbers of a structured value.
+func jsonRoundTrip(t *testing.T, v any) any {
+	t.Helper()
+	msg := service.NewMessage(nil)
+	msg.SetStructured(v)
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+
+	res, err := unmarshalStructured(abiFormatJSON, b)
+	require.NoError(t, err)
+	return normaliseNumbers(res)
+}
+
+func normaliseNumbers(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			t[k] = normaliseNumbers(e)
+		}
+	case interface{ Int64() (int64, error) }:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+	}
+	return v
+}
+
+func TestPluginsInputOutput(t *testing.T) {
+	dir := testPluginsDir(t, map[string]string{
+		"input.yaml": `
+name: wasm_in
+type: input
+module: plugin.wasm
+fields:
+  - name: foo
+    type: string
+  - name: bar
+    type: int
+    default: 10
+`,
+		"output.yaml": `
+name: wasm_out
+type: output
+module: plugin.wasm
+`,
+	})
+
+	ctx := context.Background()
+
+	inM, err := readPluginManifest(filepath.Join(dir, "input.yaml"))
+	require.NoError(t, err)
+
+	inConf, err := inM.configSpec().ParseYAML(`foo: hello`, nil)
+	require.NoError(t, err)
+
+	in, err := newPluginInput(inM, inConf, service.MockResources())
+	require.NoError(t, err)
+
+	_, _, err = in.ReadBatch(ctx)
+	require.ErrorIs(t, err, service.ErrNotConnected)
+
+	require.NoError(t, in.Connect(ctx))
+
+	batch, ackFn, err := in.ReadBatch(ctx)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	mBytes, err := batch[0].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"foo":"hello","bar":10}`, string(mBytes))
+	require.NoError(t, ackFn(ctx, nil))
+
+	_, _, err = in.ReadBatch(ctx)
+	require.ErrorIs(t, err, service.ErrEndOfInput)
+	require.NoError(t, in.Close(ctx))
+
+	outM, err := readPluginManifest(filepath.Join(dir, "output.yaml"))
+	require.NoError(t, err)
+
+	outConf, err := outM.configSpec().ParseYAML(``, nil)
+	require.NoError(t, err)
+
+	res := service.MockResources(service.MockResourcesOptAddCache("cache"))
+	out, err := newPluginOutput(outM, outConf, res)
+	require.NoError(t, err)
+	require.NoError(t, out.Connect(ctx))
+
+	require.NoError(t, out.WriteBatch(ctx, service.MessageBatch{
+		service.NewMessage([]byte("first")),
+		service.NewMessage([]byte("second")),
+	}))
+
+	require.NoError(t, res.AccessCache(ctx, "cache", func(c service.Cache) {
+		v, err := c.Get(ctx, "last")
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(v))
+	}))
+
+	// Errors within host functions are returned.
+	out.mgr = service.MockResources()
+	out.mod.mgr = out.mgr
+	require.Error(t, out.WriteBatch(ctx, service.MessageBatch{service.NewMessage([]byte("third"))}))
+	require.NoError(t, out.Close(ctx))
+}
+
+func TestPluginsErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		manifest string
+		errStr   string
+	}{
+		{
+			name:     "unknown type",
+			manifest: "name: foo\ntype: processor\nmodule: plugin.wasm",
+			errStr:   "processor",
+		},
+		{
+			name:     "missing module",
+			manifest: "name: foo\ntype: input\nmodule: nope.wasm",
+			errStr:   "nope.wasm",
+		},
+		{
+			name:     "reserved field",
+			manifest: "name: foo\ntype: output\nmodule: plugin.wasm\nfields: [ { name: batching } ]",
+			errStr:   "reserved",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := testPluginsDir(t, map[string]string{"plugin.yaml": test.manifest})
+			_, err := RegisterPlugins(service.NewEmptyEnvironment(), bloblang.NewEmptyEnvironment(), dir)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errStr)
+		})
+	}
+}
+
+func TestPluginsBloblangTimeout(t *testing.T) {
+	// A module with a call function that never returns.
+	types := wasmVec(
+		wasmFuncType(nil, nil),
+		wasmFuncType([]byte{i32}, []byte{i32}),
+	)
+	module := buildWASMModule(types, wasmVec(), wasmVec([]byte{1}, []byte{0}), [][]byte{
+		append(wasmName("malloc"), 0x00, 0),
+		append(wasmName("call"), 0x00, 1),
+	}, wasmVec(wasmBumpMalloc(), wasmCode(wasmVec(), []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b})), "")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "loop.wasm"), module, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "method.yaml"), []byte(`
+name: wasm_loop
+type: bloblang_method
+module: loop.wasm
+timeout: 50ms
+`), 0o644))
+
+	bloblEnv := bloblang.NewEmptyEnvironment()
+	plugins, err := RegisterPlugins(service.NewEmptyEnvironment(), bloblEnv, dir)
+	require.NoError(t, err)
+	plugins.SetLogger(service.MockResources().Logger())
+
+	exe, err := bloblEnv.Parse(`root = this.wasm_loop()`)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		tStarted := time.Now()
+		_, err = exe.Query("hello")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeded timeout")
+		assert.Less(t, time.Since(tStarted), time.Second*5)
+	}
+}
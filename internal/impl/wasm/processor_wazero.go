@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/Jeffail/shutdown"
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
@@ -32,7 +34,7 @@ func wazeroAllocProcessorConfig() *service.ConfigSpec {
 	return service.NewConfigSpec().
 		// Stable(). TODO
 		Categories("Utility").
-		Summary("Executes a function exported by a WASM module for each message.").
+		Summary("Executes a function exported by a WASM module for each message, or for each batch of messages.").
 		Description(`
 This processor uses https://github.com/tetratelabs/wazero[Wazero^] to execute a WASM module (with support for WASI), calling a specific function for each message being processed. From within the WASM module it is possible to query and mutate the message being processed via a suite of functions exported to the module.
 
@@ -40,6 +42,76 @@ This ecosystem is delicate as WASM doesn't have a single clearly defined way to
 
 These examples, as well as the processor itself, is a work in progress.
 
+== ABI
+
+Functions are exported to modules within the host module ` + "`benthos_wasm`" + `. The ` + "`v0`" + ` functions operate on the message being processed and can only be used when the ` + "`mode`" + ` is ` + "`message`" + `:
+
+- ` + "`v0_msg_as_bytes() i64`" + `
+- ` + "`v0_msg_set_bytes(ptr, len i32)`" + `
+- ` + "`v0_msg_get_meta(key_ptr, key_len i32) i64`" + `
+- ` + "`v0_msg_set_meta(key_ptr, key_len, value_ptr, value_len i32)`" + `
+
+The ` + "`v1`" + ` functions address messages with handles, where the messages being processed are the handles ` + "`0`" + ` to ` + "`v1_batch_len() - 1`" + ` (a single message with handle ` + "`0`" + ` when the ` + "`mode`" + ` is ` + "`message`" + `), and new messages are allocated subsequent handles:
+
+- ` + "`v1_batch_len() i32`" + `: The number of messages being processed.
+- ` + "`v1_msg_new() i32`" + `: Creates an empty message and returns its handle.
+- ` + "`v1_msg_copy(handle i32) i32`" + `: Creates a copy of a message and returns its handle.
+- ` + "`v1_emit(handle i32)`" + `: Adds a message to the output of the invocation.
+- ` + "`v1_drop()`" + `: Marks the output of the invocation as set, so that the processed messages are dropped unless messages are emitted.
+- ` + "`v1_msg_as_bytes(handle i32) i64`" + `
+- ` + "`v1_msg_set_bytes(handle, ptr, len i32)`" + `
+- ` + "`v1_msg_as_structured(handle, format i32) i64`" + `: Returns the message as a structured document, where the format is ` + "`0`" + ` for JSON and ` + "`1`" + ` for MessagePack.
+- ` + "`v1_msg_set_structured(handle, format, ptr, len i32)`" + `
+- ` + "`v1_msg_get_meta(handle, key_ptr, key_len i32) i64`" + `
+- ` + "`v1_msg_set_meta(handle, key_ptr, key_len, value_ptr, value_len i32)`" + `
+- ` + "`v1_msg_delete_meta(handle, key_ptr, key_len i32)`" + `
+- ` + "`v1_msg_meta_as_structured(handle, format i32) i64`" + `: Returns all metadata of a message as a structured object.
+- ` + "`v1_msg_set_error(handle, ptr, len i32)`" + `: Flags a message as having failed.
+- ` + "`v1_cache_get(resource_ptr, resource_len, key_ptr, key_len i32) i64`" + `
+- ` + "`v1_cache_set(resource_ptr, resource_len, key_ptr, key_len, value_ptr, value_len i32, ttl_ms i64)`" + `: Sets a key of a cache, where a TTL of zero uses the default TTL of the cache.
+- ` + "`v1_cache_delete(resource_ptr, resource_len, key_ptr, key_len i32)`" + `
+- ` + "`v1_log(level, ptr, len i32)`" + `: Writes a log, where the level is ` + "`0`" + ` (trace) to ` + "`4`" + ` (error).
+- ` + "`v1_plugin_config(format i32) i64`" + `: Returns the configuration of a plugin, see <<plugins, plugins>>.
+- ` + "`v1_fail(ptr, len i32)`" + `: Fails the current invocation with an error message.
+
+Data is returned to modules as a pointer and a length packed into a 64 bit integer, with the pointer in the upper 32 bits, and allocated within the module with an exported ` + "`malloc`" + ` or ` + "`allocate`" + ` function. Functions that return data return ` + "`-1`" + ` when the requested data doesn't exist, such as a missing metadata key or cache key.
+
+When a module emits messages with ` + "`v1_emit`" + `, or calls ` + "`v1_drop`" + `, the emitted messages replace the processed message or batch, which allows modules to filter, split and merge messages. Otherwise, the processed messages are kept, including any changes made to them.
+
+Errors that occur within functions are logged and flag the processed messages as having failed, which can be handled with xref:configuration:error_handling.adoc[error handling].
+
+== Plugins
+
+WASM modules can also implement inputs, outputs and bloblang functions and methods, which are registered at startup from the YAML manifests within the directory set by the environment variable ` + "`CONNECT_WASM_PLUGINS_PATH`" + `:
+
+` + "```yaml" + `
+name: my_input
+type: input # One of input, output, bloblang_function or bloblang_method
+module: ./my_input.wasm # Relative to the manifest
+summary: Reads things.
+fields:
+  - name: url
+    type: string # One of string, int, float, bool, string_list or any
+    description: The URL to read from.
+  - name: limit
+    type: int
+    default: 10
+` + "```" + `
+
+The fields of a manifest are the configuration fields of an input or output, and the parameters of a bloblang function or method, and their values are returned to the module as an object by ` + "`v1_plugin_config`" + `. Plugin modules use the ` + "`v1`" + ` functions and export functions depending on their type:
+
+- Inputs export ` + "`read(id i64) i32`" + `, which emits the messages of a batch with ` + "`v1_emit`" + ` and returns ` + "`1`" + ` once the input has ended, and optionally ` + "`ack(id i64, success i32)`" + `, which is called once the batch with the given ID has been delivered or has failed.
+- Outputs export ` + "`write()`" + `, where the messages of the batch being written are the handles ` + "`0`" + ` to ` + "`v1_batch_len() - 1`" + `, and outputs support a ` + "`batching`" + ` field.
+- Bloblang functions and methods export ` + "`call()`" + `, where the target value of a method is the structured contents of handle ` + "`0`" + `, and the result is the structured contents of handle ` + "`0`" + ` once the call returns.
+
+Inputs and outputs can optionally export ` + "`connect()`" + ` and ` + "`close()`" + `, and errors are reported with ` + "`v1_fail`" + `. Cache functions are not available to bloblang plugins, and each call of a bloblang plugin is interrupted once it exceeds the ` + "`timeout`" + ` of its manifest, which defaults to ` + "`5s`" + `.
+
+== Limits
+
+The memory of each instance of the module can be limited with the field ` + "`max_memory_pages`" + `, and each call of the function can be limited in duration with the field ` + "`timeout`" + `, which interrupts modules that fail to return, such as those stuck in an infinite loop. Instruction counting (fuel) is not supported by the runtime, and therefore a timeout is the only way to bound the execution of a module. Instances of the module that are interrupted or that fail are discarded rather than reused.
+
+When ` + "`hot_reload`" + ` is enabled the file at ` + "`module_path`" + ` is checked for changes periodically, and when it changes the new module is loaded and validated, and then replaces the previous module for all subsequent invocations. If the new module fails to load then an error is logged and the previous module continues to be used.
+
 == Parallelism
 
 It's not currently possible to execute a single WASM runtime across parallel threads with this processor. Therefore, in order to support parallel processing this processor implements pooling of module runtimes. Ideally your WASM module shouldn't depend on any global state, but if it does then you need to ensure the processor xref:configuration:processing_pipelines.adoc[is only run on a single thread].
@@ -48,7 +120,34 @@ It's not currently possible to execute a single WASM runtime across parallel thr
 			Description("The path of the target WASM module to execute.")).
 		Field(service.NewStringField("function").
 			Default("process").
-			Description("The name of the function exported by the target WASM module to run for each message.")).
+			Description("The name of the function exported by the target WASM module to run for each message, or for each batch when the `mode` is `batch`.")).
+		Field(service.NewStringAnnotatedEnumField("mode", map[string]string{
+			"message": "The function is called once for each message of a batch.",
+			"batch":   "The function is called once for each batch, and the messages of the batch are accessed with the `v1` functions.",
+		}).
+			Description("Whether the function is called for each message or for each batch.").
+			Default("message").
+			Version("4.31.0")).
+		Field(service.NewIntField("max_memory_pages").
+			Description("The maximum number of 64KiB pages of memory that each instance of the module can use, where `0` applies the WASM limit of 65536 pages (4GiB). Modules that declare more initial memory than this limit fail to load, and attempts to grow memory beyond it fail within the module.").
+			Advanced().
+			Default(0).
+			Version("4.31.0")).
+		Field(service.NewDurationField("timeout").
+			Description("The maximum period of time that each call of the function can run for before it is interrupted and fails, where `0s` disables the timeout.").
+			Example("100ms").
+			Default("0s").
+			Version("4.31.0")).
+		Field(service.NewBoolField("hot_reload").
+			Description("Whether to reload the module when the file at `module_path` changes, without restarting the stream. Invocations that are in progress complete with the previous module.").
+			Advanced().
+			Default(false).
+			Version("4.31.0")).
+		Field(service.NewDurationField("hot_reload_interval").
+			Description("The period of time between checks of the file at `module_path` for changes when `hot_reload` is enabled.").
+			Advanced().
+			Default("5s").
+			Version("4.31.0")).
 		Version("4.11.0")
 }
 
@@ -67,9 +166,22 @@ func init() {
 
 type wazeroAllocProcessor struct {
 	log          *service.Logger
+	mgr          *service.Resources
 	functionName string
-	wasmBinary   []byte
-	modulePool   sync.Pool
+	batchMode    bool
+	runtimeConf  wazero.RuntimeConfig
+	timeout      time.Duration
+
+	modulePath string
+	modTime    time.Time
+
+	// Protects the module binary and the pool of its runtimes, which are
+	// replaced when the module is reloaded.
+	binMut     sync.RWMutex
+	wasmBinary []byte
+	modulePool *sync.Pool
+
+	shutSig *shutdown.Signaller
 }
 
 func newWazeroAllocProcessorFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*wazeroAllocProcessor, error) {
@@ -83,25 +195,92 @@ func newWazeroAllocProcessorFromConfig(conf *service.ParsedConfig, mgr *service.
 		return nil, err
 	}
 
+	mode, err := conf.FieldString("mode")
+	if err != nil {
+		return nil, err
+	}
+
+	maxPages, err := conf.FieldInt("max_memory_pages")
+	if err != nil {
+		return nil, err
+	}
+	if maxPages < 0 || maxPages > 65536 {
+		return nil, fmt.Errorf("max_memory_pages must be between 0 and 65536, got %v", maxPages)
+	}
+
+	timeout, err := conf.FieldDuration("timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	hotReload, err := conf.FieldBool("hot_reload")
+	if err != nil {
+		return nil, err
+	}
+
+	reloadInterval, err := conf.FieldDuration("hot_reload_interval")
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(pathStr)
+	if err != nil {
+		return nil, err
+	}
+
 	fileBytes, err := os.ReadFile(pathStr)
 	if err != nil {
 		return nil, err
 	}
 
-	return newWazeroAllocProcessor(function, fileBytes, mgr)
+	rConf := wazero.NewRuntimeConfig()
+	if maxPages > 0 {
+		rConf = rConf.WithMemoryLimitPages(uint32(maxPages))
+	}
+	if timeout > 0 {
+		rConf = rConf.WithCloseOnContextDone(true)
+	}
+
+	proc, err := newWazeroAllocProcessorWithRuntime(function, fileBytes, rConf, timeout, mgr)
+	if err != nil {
+		return nil, err
+	}
+	proc.batchMode = mode == "batch"
+	proc.modulePath = pathStr
+	proc.modTime = info.ModTime()
+
+	if hotReload {
+		go proc.watchModule(reloadInterval)
+	} else {
+		proc.shutSig.TriggerHasStopped()
+	}
+	return proc, nil
 }
 
 func newWazeroAllocProcessor(functionName string, wasmBinary []byte, mgr *service.Resources) (*wazeroAllocProcessor, error) {
+	proc, err := newWazeroAllocProcessorWithRuntime(functionName, wasmBinary, wazero.NewRuntimeConfig(), 0, mgr)
+	if err != nil {
+		return nil, err
+	}
+	proc.shutSig.TriggerHasStopped()
+	return proc, nil
+}
+
+func newWazeroAllocProcessorWithRuntime(functionName string, wasmBinary []byte, rConf wazero.RuntimeConfig, timeout time.Duration, mgr *service.Resources) (*wazeroAllocProcessor, error) {
 	proc := &wazeroAllocProcessor{
-		log:        mgr.Logger(),
-		modulePool: sync.Pool{},
+		log:         mgr.Logger(),
+		mgr:         mgr,
+		runtimeConf: rConf,
+		timeout:     timeout,
+		modulePool:  &sync.Pool{},
+		shutSig:     shutdown.NewSignaller(),
 
 		functionName: functionName,
 		wasmBinary:   wasmBinary,
 	}
 
 	// Ensure we can create at least one module runner.
-	modRunner, err := proc.newModule()
+	modRunner, err := proc.newModule(wasmBinary)
 	if err != nil {
 		return nil, err
 	}
@@ -110,12 +289,122 @@ func newWazeroAllocProcessor(functionName string, wasmBinary []byte, mgr *servic
 	return proc, nil
 }
 
-func (p *wazeroAllocProcessor) newModule() (mod *moduleRunner, err error) {
+func (p *wazeroAllocProcessor) newModule(wasmBinary []byte) (*moduleRunner, error) {
+	mod, err := newModuleRunner(wasmBinary, p.runtimeConf, p.log, p.mgr)
+	if err != nil {
+		return nil, err
+	}
+	if mod.process = mod.mod.ExportedFunction(p.functionName); mod.process == nil {
+		_ = mod.Close(context.Background())
+		return nil, fmt.Errorf("module does not export the function %v", p.functionName)
+	}
+	mod.timeout = p.timeout
+	return mod, nil
+}
+
+// getModule returns a module runner along with the pool it must be returned
+// to.
+func (p *wazeroAllocProcessor) getModule() (*moduleRunner, *sync.Pool, error) {
+	p.binMut.RLock()
+	wasmBinary, pool := p.wasmBinary, p.modulePool
+	p.binMut.RUnlock()
+
+	if modRunnerPtr := pool.Get(); modRunnerPtr != nil {
+		return modRunnerPtr.(*moduleRunner), pool, nil
+	}
+	modRunner, err := p.newModule(wasmBinary)
+	return modRunner, pool, err
+}
+
+// putModule returns a module runner to its pool, or closes it when the module
+// has since been reloaded.
+func (p *wazeroAllocProcessor) putModule(modRunner *moduleRunner, pool *sync.Pool) {
+	p.binMut.RLock()
+	defer p.binMut.RUnlock()
+
+	if pool != p.modulePool {
+		_ = modRunner.Close(context.Background())
+		return
+	}
+	pool.Put(modRunner)
+}
+
+func (p *wazeroAllocProcessor) watchModule(interval time.Duration) {
+	defer p.shutSig.TriggerHasStopped()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.reloadModule(); err != nil {
+				p.log.Errorf("Failed to reload WASM module: %v", err)
+			}
+		case <-p.shutSig.SoftStopChan():
+			return
+		}
+	}
+}
+
+// reloadModule replaces the module and drains the pool of runtimes of the
+// previous module if the module file has changed.
+func (p *wazeroAllocProcessor) reloadModule() error {
+	info, err := os.Stat(p.modulePath)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(p.modTime) {
+		return nil
+	}
+
+	wasmBinary, err := os.ReadFile(p.modulePath)
+	if err != nil {
+		return err
+	}
+
+	modRunner, err := p.newModule(wasmBinary)
+	if err != nil {
+		return err
+	}
+
+	newPool := &sync.Pool{}
+	newPool.Put(modRunner)
+
+	// The modification time is only recorded once the module has loaded, so
+	// that a failed reload is retried on the next interval.
+	p.modTime = info.ModTime()
+
+	p.binMut.Lock()
+	oldPool := p.modulePool
+	p.wasmBinary, p.modulePool = wasmBinary, newPool
+	p.binMut.Unlock()
+
+	p.log.Infof("Reloaded WASM module %v", p.modulePath)
+	return closePool(context.Background(), oldPool)
+}
+
+func closePool(ctx context.Context, pool *sync.Pool) error {
+	for {
+		mr := pool.Get()
+		if mr == nil {
+			return nil
+		}
+		if err := mr.(*moduleRunner).Close(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// newModuleRunner instantiates a WASM module within a new runtime that exports
+// the host functions of the ABI.
+func newModuleRunner(wasmBinary []byte, rConf wazero.RuntimeConfig, log *service.Logger, mgr *service.Resources) (mod *moduleRunner, err error) {
 	ctx := context.Background()
 
-	r := wazero.NewRuntime(ctx)
+	r := wazero.NewRuntimeWithConfig(ctx, rConf)
 	mod = &moduleRunner{
-		log:     p.log,
+		log:     log,
+		mgr:     mgr,
 		runtime: r,
 	}
 	defer func() {
@@ -136,11 +425,10 @@ func (p *wazeroAllocProcessor) newModule() (mod *moduleRunner, err error) {
 		return
 	}
 
-	if mod.mod, err = r.Instantiate(ctx, p.wasmBinary); err != nil {
+	if mod.mod, err = r.Instantiate(ctx, wasmBinary); err != nil {
 		return
 	}
 
-	mod.process = mod.mod.ExportedFunction(p.functionName)
 	mod.goMalloc = mod.mod.ExportedFunction("malloc")
 	mod.goFree = mod.mod.ExportedFunction("free")
 	mod.rustAlloc = mod.mod.ExportedFunction("allocate")
@@ -150,49 +438,59 @@ func (p *wazeroAllocProcessor) newModule() (mod *moduleRunner, err error) {
 }
 
 func (p *wazeroAllocProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
-	var modRunner *moduleRunner
-	var err error
-	if modRunnerPtr := p.modulePool.Get(); modRunnerPtr != nil {
-		modRunner = modRunnerPtr.(*moduleRunner)
-	} else {
-		if modRunner, err = p.newModule(); err != nil {
-			return nil, err
-		}
+	modRunner, pool, err := p.getModule()
+	if err != nil {
+		return nil, err
 	}
-	defer func() {
-		p.modulePool.Put(modRunner)
-	}()
 
-	res, err := modRunner.Run(ctx, batch)
+	var res service.MessageBatch
+	if p.batchMode {
+		res, err = modRunner.RunBatch(ctx, batch)
+	} else {
+		res, err = modRunner.Run(ctx, batch)
+	}
 	if err != nil {
+		// The state of a module that failed or was interrupted can't be
+		// trusted, and therefore it isn't reused.
+		_ = modRunner.Close(context.Background())
 		return nil, err
 	}
+
+	p.putModule(modRunner, pool)
 	return []service.MessageBatch{res}, nil
 }
 
 func (p *wazeroAllocProcessor) Close(ctx context.Context) error {
-	for {
-		mr := p.modulePool.Get()
-		if mr == nil {
-			return nil
-		}
-		if err := mr.(*moduleRunner).Close(ctx); err != nil {
-			return err
-		}
+	p.shutSig.TriggerSoftStop()
+	select {
+	case <-p.shutSig.HasStoppedChan():
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+
+	p.binMut.Lock()
+	defer p.binMut.Unlock()
+	return closePool(ctx, p.modulePool)
 }
 
 //------------------------------------------------------------------------------
 
 type moduleRunner struct {
-	log *service.Logger
+	log     *service.Logger
+	mgr     *service.Resources
+	timeout time.Duration
 
 	runtime wazero.Runtime
 	mod     api.Module
 
+	batchMode       bool
 	runBatch        service.MessageBatch
 	targetMessage   *service.Message
 	targetIndex     int
+	handles         []*service.Message
+	pluginConfig    any
+	outBatch        service.MessageBatch
+	outSet          bool
 	afterProcessing []func()
 	procErr         error
 
@@ -207,10 +505,25 @@ func (r *moduleRunner) reset() {
 	r.runBatch = nil
 	r.targetMessage = nil
 	r.targetIndex = 0
+	r.handles = nil
+	r.outBatch = nil
+	r.outSet = false
 	r.procErr = nil
 	r.afterProcessing = nil
 }
 
+func (r *moduleRunner) handle(h uint32) (*service.Message, error) {
+	if int(h) >= len(r.handles) {
+		return nil, fmt.Errorf("message handle %v does not exist", h)
+	}
+	return r.handles[h], nil
+}
+
+func (r *moduleRunner) newHandle(msg *service.Message) uint32 {
+	r.handles = append(r.handles, msg)
+	return uint32(len(r.handles) - 1)
+}
+
 func (r *moduleRunner) funcErr(err error) {
 	r.procErr = err
 	r.log.Error(err.Error())
@@ -270,6 +583,76 @@ func (r *moduleRunner) readBytesOutbound(ctx context.Context, contentPtr, conten
 	return dataCopy, nil
 }
 
+func (r *moduleRunner) call(ctx context.Context) error {
+	_, err := r.callFn(ctx, r.process)
+	return err
+}
+
+func (r *moduleRunner) callFn(ctx context.Context, fn api.Function, params ...uint64) ([]uint64, error) {
+	if r.timeout > 0 {
+		var done func()
+		ctx, done = context.WithTimeout(ctx, r.timeout)
+		defer done()
+	}
+
+	res, err := fn.Call(ctx, params...)
+	for _, fn := range r.afterProcessing {
+		fn()
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && r.timeout > 0 {
+		return nil, fmt.Errorf("call exceeded timeout of %v: %w", r.timeout, err)
+	}
+	return res, err
+}
+
+// RunBatch calls the process function once for the whole batch.
+func (r *moduleRunner) RunBatch(ctx context.Context, batch service.MessageBatch) (service.MessageBatch, error) {
+	defer r.reset()
+
+	r.reset()
+	r.batchMode = true
+	r.runBatch = batch
+	r.handles = append(r.handles, batch...)
+
+	if err := r.call(ctx); err != nil {
+		return nil, err
+	}
+	if r.procErr != nil {
+		newBatch := make(service.MessageBatch, len(batch))
+		for i, m := range batch {
+			newBatch[i] = m.Copy()
+			newBatch[i].SetError(r.procErr)
+		}
+		return newBatch, nil
+	}
+	if r.outSet {
+		return r.outBatch, nil
+	}
+	return batch, nil
+}
+
+// CallPlugin calls a function exported by a plugin module, where the messages
+// of the batch are the initial handles, and returns the results of the
+// function along with any emitted messages. Errors reported by the module are
+// returned rather than being attached to messages.
+func (r *moduleRunner) CallPlugin(ctx context.Context, fn api.Function, batch service.MessageBatch, params ...uint64) ([]uint64, service.MessageBatch, error) {
+	defer r.reset()
+
+	r.reset()
+	r.batchMode = true
+	r.runBatch = batch
+	r.handles = append(r.handles, batch...)
+
+	res, err := r.callFn(ctx, fn, params...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.procErr != nil {
+		return nil, nil, r.procErr
+	}
+	return res, r.outBatch, nil
+}
+
 func (r *moduleRunner) Run(ctx context.Context, batch service.MessageBatch) (service.MessageBatch, error) {
 	defer r.reset()
 
@@ -277,19 +660,20 @@ func (r *moduleRunner) Run(ctx context.Context, batch service.MessageBatch) (ser
 	for i := range batch {
 		r.reset()
 		r.runBatch = batch
+		r.batchMode = false
 		r.targetIndex = i
 		r.targetMessage = batch[i]
-		_, err := r.process.Call(ctx)
-		for _, fn := range r.afterProcessing {
-			fn()
-		}
-		if err != nil {
+		r.handles = append(r.handles, batch[i])
+		if err := r.call(ctx); err != nil {
 			return nil, err
 		}
 		newMsg := r.targetMessage
 		if r.procErr != nil {
 			newMsg = batch[i].Copy()
 			newMsg.SetError(r.procErr)
+		} else if r.outSet {
+			newBatch = append(newBatch, r.outBatch...)
+			continue
 		}
 		if newMsg != nil {
 			newBatch = append(newBatch, newMsg)
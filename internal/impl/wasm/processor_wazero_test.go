@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -123,6 +124,122 @@ func TestWazeroWASIRustProcessor(t *testing.T) {
 	}
 }
 
+// testProcessModule assembles a module that exports a process function with the
+// given body, which can call v1_drop as function 0.
+func testProcessModule(body ...[]byte) []byte {
+	types := wasmVec(
+		wasmFuncType(nil, nil),
+		wasmFuncType([]byte{i32}, []byte{i32}),
+	)
+	imports := wasmVec(append(append(wasmName("benthos_wasm"), wasmName("v1_drop")...), 0x00, 0x00))
+	funcs := wasmVec([]byte{1}, []byte{0})
+	exports := [][]byte{
+		append(wasmName("malloc"), 0x00, 1),
+		append(wasmName("process"), 0x00, 2),
+	}
+	return buildWASMModule(types, imports, funcs, exports,
+		wasmVec(wasmBumpMalloc(), wasmCode(wasmVec(), body...)), "")
+}
+
+func testLimitsProcessor(t *testing.T, module []byte, extraConf string) *wazeroAllocProcessor {
+	t.Helper()
+
+	modulePath := filepath.Join(t.TempDir(), "module.wasm")
+	require.NoError(t, os.WriteFile(modulePath, module, 0o644))
+
+	conf, err := wazeroAllocProcessorConfig().ParseYAML(fmt.Sprintf(`
+module_path: %v
+%v
+`, modulePath, extraConf), nil)
+	require.NoError(t, err)
+
+	proc, err := newWazeroAllocProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, proc.Close(context.Background()))
+	})
+	return proc
+}
+
+func TestWazeroTimeout(t *testing.T) {
+	// An infinite loop.
+	proc := testLimitsProcessor(t, testProcessModule([]byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b}), `timeout: 50ms`)
+
+	for i := 0; i < 2; i++ {
+		tStarted := time.Now()
+		_, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+			service.NewMessage([]byte("hello world")),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeded timeout")
+		assert.Less(t, time.Since(tStarted), time.Second*5)
+	}
+}
+
+func TestWazeroMemoryLimit(t *testing.T) {
+	// Grows memory by 16 pages, and traps if that fails.
+	module := testProcessModule(
+		i32Const(16), []byte{0x40, 0x00},
+		i32Const(-1), []byte{0x46, 0x04, 0x40, 0x00, 0x0b},
+		[]byte{0x0b},
+	)
+
+	proc := testLimitsProcessor(t, module, ``)
+	_, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello world")),
+	})
+	require.NoError(t, err)
+
+	proc = testLimitsProcessor(t, module, `max_memory_pages: 8`)
+	_, err = proc.ProcessBatch(context.Background(), service.MessageBatch{
+		service.NewMessage([]byte("hello world")),
+	})
+	require.Error(t, err)
+}
+
+func TestWazeroHotReload(t *testing.T) {
+	modulePath := filepath.Join(t.TempDir(), "module.wasm")
+	require.NoError(t, os.WriteFile(modulePath, testProcessModule([]byte{0x0b}), 0o644))
+
+	conf, err := wazeroAllocProcessorConfig().ParseYAML(fmt.Sprintf(`
+module_path: %v
+hot_reload: true
+hot_reload_interval: 10ms
+`, modulePath), nil)
+	require.NoError(t, err)
+
+	proc, err := newWazeroAllocProcessorFromConfig(conf, service.MockResources())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, proc.Close(context.Background()))
+	})
+
+	process := func() int {
+		outBatches, err := proc.ProcessBatch(context.Background(), service.MessageBatch{
+			service.NewMessage([]byte("hello world")),
+		})
+		require.NoError(t, err)
+		require.Len(t, outBatches, 1)
+		return len(outBatches[0])
+	}
+	assert.Equal(t, 1, process())
+
+	// A module that fails to load is ignored.
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(modulePath, []byte("not a module"), 0o644))
+	require.NoError(t, os.Chtimes(modulePath, time.Now(), modTime))
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, 1, process())
+
+	// Drops all messages, and is loaded even though the modification time
+	// matches that of the failed reload.
+	require.NoError(t, os.WriteFile(modulePath, testProcessModule(call(0), []byte{0x0b}), 0o644))
+	require.NoError(t, os.Chtimes(modulePath, time.Now(), modTime))
+	assert.Eventually(t, func() bool {
+		return process() == 0
+	}, time.Second*5, time.Millisecond*10)
+}
+
 func BenchmarkWazeroWASIGoCalls(b *testing.B) {
 	wasm, err := os.ReadFile("./uppercase.wasm")
 	if os.IsNotExist(err) {
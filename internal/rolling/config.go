@@ -0,0 +1,152 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rolling
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// FieldRolling is the name of the object field that contains the rolling
+	// file config.
+	FieldRolling = "rolling"
+
+	rfFieldEnabled      = "enabled"
+	rfFieldCodec        = "codec"
+	rfFieldPartitionBy  = "partition_by"
+	rfFieldMaxSize      = "max_size"
+	rfFieldMaxCount     = "max_count"
+	rfFieldMaxPeriod    = "max_period"
+	rfFieldMaxOpenFiles = "max_open_files"
+)
+
+// Config describes how messages are written into rolling files.
+type Config struct {
+	Enabled      bool
+	PartitionBy  *service.InterpolatedString
+	MaxSize      int
+	MaxCount     int
+	MaxPeriod    time.Duration
+	MaxOpenFiles int
+
+	suffixFn func(data []byte) []byte
+}
+
+// ConfigField returns the rolling file config field of object store outputs.
+func ConfigField() *service.ConfigField {
+	return service.NewObjectField(FieldRolling,
+		service.NewBoolField(rfFieldEnabled).
+			Description("Whether to write messages into rolling files rather than uploading an object per message.").
+			Default(false),
+		service.NewStringField(rfFieldCodec).
+			Description("The way in which the bytes of messages are written into a file. The `lines` codec follows each message with a line break, `append` writes messages without a delimiter, and `delim:x` follows each message with the custom delimiter x.").
+			Examples("lines", "append", "delim:\t", "delim:foobar").
+			Default("lines"),
+		service.NewInterpolatedStringField(rfFieldPartitionBy).
+			Description("An optional key that determines which file each message is written to, where messages with different keys are written to separate files that are rolled independently. The path of each file is usually derived from the same values.").
+			Example(`${! meta("kafka_topic") }`).
+			Example(`${! timestamp_unix().ts_format("2006-01-02") }`).
+			Default(""),
+		service.NewIntField(rfFieldMaxSize).
+			Description("The maximum size of a file in bytes before it is committed and a new file is started. Set to zero to disable size based rolling.").
+			Default(64*1024*1024),
+		service.NewIntField(rfFieldMaxCount).
+			Description("The maximum number of messages written to a file before it is committed and a new file is started. Set to zero to disable count based rolling.").
+			Default(0),
+		service.NewDurationField(rfFieldMaxPeriod).
+			Description("The maximum period a file is kept open for before it is committed and a new file is started.").
+			Default("1m"),
+		service.NewIntField(rfFieldMaxOpenFiles).
+			Description("The maximum number of files that can be open at the same time across all partitions. When exceeded the oldest file is committed.").
+			Default(16).
+			Advanced(),
+	).
+		Description("Write messages into rolling files that are streamed to storage as multipart uploads. Files are committed once they reach a size, count or age limit, and messages are only acknowledged once the file they were written to has been committed. Since writes are held until their file is committed, all open files are also committed whenever the number of pending writes reaches the `max_in_flight` of the output, which should therefore be increased in proportion to the expected number of batches written to each file. Object attributes such as the path are resolved from the first message of each file.").
+		Optional()
+}
+
+// ConfigFromParsed extracts the rolling file config from a parsed config.
+func ConfigFromParsed(pConf *service.ParsedConfig) (conf Config, err error) {
+	if !pConf.Contains(FieldRolling) {
+		return
+	}
+	pConf = pConf.Namespace(FieldRolling)
+
+	if conf.Enabled, err = pConf.FieldBool(rfFieldEnabled); err != nil {
+		return
+	}
+
+	var codec string
+	if codec, err = pConf.FieldString(rfFieldCodec); err != nil {
+		return
+	}
+	if conf.suffixFn, err = getSuffixFn(codec); err != nil {
+		return
+	}
+
+	if conf.PartitionBy, err = pConf.FieldInterpolatedString(rfFieldPartitionBy); err != nil {
+		return
+	}
+	if conf.MaxSize, err = pConf.FieldInt(rfFieldMaxSize); err != nil {
+		return
+	}
+	if conf.MaxCount, err = pConf.FieldInt(rfFieldMaxCount); err != nil {
+		return
+	}
+	if conf.MaxPeriod, err = pConf.FieldDuration(rfFieldMaxPeriod); err != nil {
+		return
+	}
+	if conf.MaxOpenFiles, err = pConf.FieldInt(rfFieldMaxOpenFiles); err != nil {
+		return
+	}
+
+	if conf.Enabled && conf.MaxSize <= 0 && conf.MaxCount <= 0 && conf.MaxPeriod <= 0 {
+		err = errors.New("at least one of max_size, max_count or max_period must be set for rolling files")
+	}
+	return
+}
+
+func getSuffixFn(codec string) (func(data []byte) []byte, error) {
+	switch codec {
+	case "append":
+		return customDelimSuffixFn(""), nil
+	case "lines":
+		return customDelimSuffixFn("\n"), nil
+	}
+	if strings.HasPrefix(codec, "delim:") {
+		by := strings.TrimPrefix(codec, "delim:")
+		if by == "" {
+			return nil, errors.New("custom delimiter codec requires a non-empty delimiter")
+		}
+		return customDelimSuffixFn(by), nil
+	}
+	return nil, fmt.Errorf("codec was not recognised: %v", codec)
+}
+
+func customDelimSuffixFn(suffix string) func(data []byte) []byte {
+	suffixB := []byte(suffix)
+	return func(data []byte) []byte {
+		if len(suffixB) == 0 || bytes.HasSuffix(data, suffixB) {
+			return nil
+		}
+		return suffixB
+	}
+}
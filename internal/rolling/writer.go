@@ -0,0 +1,350 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rolling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// ObjectWriter streams the contents of a single object to storage.
+type ObjectWriter interface {
+	io.Writer
+
+	// Commit completes the object, after which it is visible in storage.
+	Commit(ctx context.Context) error
+
+	// Abort discards the object and anything written to it so far.
+	Abort(ctx context.Context) error
+}
+
+// OpenFn opens a new object. The message at the given index of the batch is
+// the first message written to the object, and can be used in order to resolve
+// attributes of the object such as its path. The provided context is valid for
+// the lifetime of the object rather than the write call that opened it.
+type OpenFn func(ctx context.Context, batch service.MessageBatch, index int) (ObjectWriter, error)
+
+type rollingFile struct {
+	key    string
+	w      ObjectWriter
+	opened time.Time
+	timer  *time.Timer
+
+	// Writes to the underlying object can block, and are therefore guarded by
+	// a mutex of the file rather than the writer. A file is closed once it has
+	// been released from the writer and is being committed or aborted.
+	mut    sync.Mutex
+	size   int
+	count  int
+	closed bool
+
+	// Closed once the file has been committed or aborted, at which point err
+	// holds the outcome.
+	done chan struct{}
+	err  error
+}
+
+// Writer writes batches of messages into rolling files, where the write of a
+// batch only returns once each file its messages were written to has either
+// been committed or has failed.
+type Writer struct {
+	conf        Config
+	open        OpenFn
+	maxInFlight int
+	log         *service.Logger
+
+	mut     sync.Mutex
+	files   map[string]*rollingFile
+	pending int
+	wg      sync.WaitGroup
+
+	ctx  context.Context
+	done func()
+}
+
+// NewWriter creates a rolling file writer that opens objects with the provided
+// function. As writes block until their files are committed the number of
+// writes that can be in flight is required, and all open files are committed
+// whenever this limit is reached.
+func NewWriter(conf Config, maxInFlight int, open OpenFn, log *service.Logger) *Writer {
+	w := &Writer{
+		conf:        conf,
+		open:        open,
+		maxInFlight: maxInFlight,
+		log:         log,
+		files:       map[string]*rollingFile{},
+	}
+	w.ctx, w.done = context.WithCancel(context.Background())
+	return w
+}
+
+// WriteBatch writes the messages of a batch to their files and waits for
+// those files to be committed.
+func (w *Writer) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
+	var batchErr *service.BatchError
+	setErr := func(i int, err error) {
+		if batchErr == nil {
+			batchErr = service.NewBatchError(batch, err)
+		}
+		batchErr.Failed(i, err)
+	}
+
+	waits := map[*rollingFile][]int{}
+
+	for i, m := range batch {
+		key, err := batch.TryInterpolatedString(i, w.conf.PartitionBy)
+		if err != nil {
+			setErr(i, fmt.Errorf("partition interpolation: %w", err))
+			continue
+		}
+
+		mBytes, err := m.AsBytes()
+		if err != nil {
+			setErr(i, err)
+			continue
+		}
+
+		f, full, err := w.writeMessage(key, batch, i, mBytes)
+		if err != nil {
+			setErr(i, err)
+			continue
+		}
+		waits[f] = append(waits[f], i)
+
+		if full {
+			w.mut.Lock()
+			w.commitFile(f)
+			w.mut.Unlock()
+		}
+	}
+
+	w.mut.Lock()
+	w.pending++
+	if w.maxInFlight > 0 && w.pending >= w.maxInFlight {
+		for _, f := range w.files {
+			w.commitFile(f)
+		}
+	}
+	w.mut.Unlock()
+
+	defer func() {
+		w.mut.Lock()
+		w.pending--
+		w.mut.Unlock()
+	}()
+
+	for f, indexes := range waits {
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if f.err == nil {
+			continue
+		}
+		for _, i := range indexes {
+			setErr(i, f.err)
+		}
+	}
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+// writeMessage writes a message to the open file of a partition, opening a new
+// file if necessary, and returns the file written to along with whether it has
+// reached its size or count limit. The writer mutex is only held in order to
+// obtain the file, so that a blocked write doesn't stall other partitions.
+func (w *Writer) writeMessage(key string, batch service.MessageBatch, index int, data []byte) (*rollingFile, bool, error) {
+	for {
+		w.mut.Lock()
+		f, exists := w.files[key]
+		if !exists {
+			var err error
+			if f, err = w.openFile(key, batch, index); err != nil {
+				w.mut.Unlock()
+				return nil, false, err
+			}
+		}
+		w.mut.Unlock()
+
+		f.mut.Lock()
+		if f.closed {
+			// The file was committed after we obtained it, and has therefore
+			// been replaced or removed.
+			f.mut.Unlock()
+			continue
+		}
+		err := f.write(data, w.conf.suffixFn(data))
+		full := (w.conf.MaxSize > 0 && f.size >= w.conf.MaxSize) ||
+			(w.conf.MaxCount > 0 && f.count >= w.conf.MaxCount)
+		f.mut.Unlock()
+
+		if err != nil {
+			w.mut.Lock()
+			w.abortFile(f, err)
+			w.mut.Unlock()
+			return nil, false, err
+		}
+		return f, full, nil
+	}
+}
+
+// write writes a message to the file. Must be called with the file mutex held.
+func (f *rollingFile) write(data, suffix []byte) error {
+	n, err := f.w.Write(data)
+	f.size += n
+	if err != nil {
+		return err
+	}
+	if len(suffix) > 0 {
+		n, err = f.w.Write(suffix)
+		f.size += n
+		if err != nil {
+			return err
+		}
+	}
+	f.count++
+	return nil
+}
+
+func (w *Writer) openFile(key string, batch service.MessageBatch, index int) (*rollingFile, error) {
+	if w.ctx.Err() != nil {
+		return nil, service.ErrNotConnected
+	}
+
+	if w.conf.MaxOpenFiles > 0 && len(w.files) >= w.conf.MaxOpenFiles {
+		var oldest *rollingFile
+		for _, f := range w.files {
+			if oldest == nil || f.opened.Before(oldest.opened) {
+				oldest = f
+			}
+		}
+		w.commitFile(oldest)
+	}
+
+	ow, err := w.open(w.ctx, batch, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	f := &rollingFile{
+		key:    key,
+		w:      ow,
+		opened: time.Now(),
+		done:   make(chan struct{}),
+	}
+	if w.conf.MaxPeriod > 0 {
+		f.timer = time.AfterFunc(w.conf.MaxPeriod, func() {
+			w.mut.Lock()
+			w.commitFile(f)
+			w.mut.Unlock()
+		})
+	}
+	w.files[key] = f
+	return f, nil
+}
+
+// release removes a file from the set of open files, and returns false if the
+// file has already been released. Must be called with the mutex held.
+func (w *Writer) release(f *rollingFile) bool {
+	if current, exists := w.files[f.key]; !exists || current != f {
+		return false
+	}
+	delete(w.files, f.key)
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	return true
+}
+
+// commitFile commits a file in the background. Must be called with the mutex
+// held.
+func (w *Writer) commitFile(f *rollingFile) {
+	if !w.release(f) {
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		// Wait for any write in progress to complete before committing.
+		f.mut.Lock()
+		f.closed = true
+		f.mut.Unlock()
+
+		if f.err = f.w.Commit(w.ctx); f.err != nil {
+			w.log.Errorf("Failed to commit file: %v", f.err)
+			f.err = fmt.Errorf("failed to commit file: %w", f.err)
+			if err := f.w.Abort(w.ctx); err != nil {
+				w.log.Debugf("Failed to abort file: %v", err)
+			}
+		}
+		close(f.done)
+	}()
+}
+
+// abortFile aborts a file in the background after a failed write. Must be
+// called with the mutex held.
+func (w *Writer) abortFile(f *rollingFile, err error) {
+	if !w.release(f) {
+		return
+	}
+	f.err = fmt.Errorf("file aborted after failed write: %w", err)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		// Aborting unblocks any write in progress, which then fails.
+		if err := f.w.Abort(w.ctx); err != nil {
+			w.log.Debugf("Failed to abort file: %v", err)
+		}
+		f.mut.Lock()
+		f.closed = true
+		f.mut.Unlock()
+		close(f.done)
+	}()
+}
+
+// Close commits all open files and waits for them to complete.
+func (w *Writer) Close(ctx context.Context) error {
+	w.mut.Lock()
+	for _, f := range w.files {
+		w.commitFile(f)
+	}
+	w.mut.Unlock()
+
+	committed := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(committed)
+	}()
+
+	var err error
+	select {
+	case <-committed:
+	case <-ctx.Done():
+		err = errors.New("timed out waiting for files to be committed")
+	}
+	w.done()
+	return err
+}
@@ -0,0 +1,412 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rolling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+type mockStore struct {
+	mut        sync.Mutex
+	opened     int
+	committed  map[string]string
+	aborted    []string
+	failWrite  string
+	failCommit bool
+
+	// Writes of blockWrite wait until unblock is closed.
+	blockWrite string
+	unblock    chan struct{}
+}
+
+type mockObject struct {
+	store *mockStore
+	path  string
+	buf   bytes.Buffer
+}
+
+func (o *mockObject) Write(p []byte) (int, error) {
+	if o.store.failWrite != "" && bytes.Equal(p, []byte(o.store.failWrite)) {
+		return 0, errors.New("write failed")
+	}
+	if o.store.blockWrite != "" && bytes.Equal(p, []byte(o.store.blockWrite)) {
+		<-o.store.unblock
+	}
+	return o.buf.Write(p)
+}
+
+func (o *mockObject) Commit(ctx context.Context) error {
+	o.store.mut.Lock()
+	defer o.store.mut.Unlock()
+	if o.store.failCommit {
+		return errors.New("commit failed")
+	}
+	o.store.committed[o.path] = o.buf.String()
+	return nil
+}
+
+func (o *mockObject) Abort(ctx context.Context) error {
+	o.store.mut.Lock()
+	defer o.store.mut.Unlock()
+	o.store.aborted = append(o.store.aborted, o.path)
+	return nil
+}
+
+func (s *mockStore) open(ctx context.Context, batch service.MessageBatch, index int) (ObjectWriter, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	p, _ := batch[index].MetaGet("p")
+	s.opened++
+	return &mockObject{store: s, path: fmt.Sprintf("%v%v", p, s.opened)}, nil
+}
+
+func (s *mockStore) files() map[string]string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	files := map[string]string{}
+	for k, v := range s.committed {
+		files[k] = v
+	}
+	return files
+}
+
+func testConfig(t testing.TB, yamlStr string) Config {
+	t.Helper()
+
+	pConf, err := service.NewConfigSpec().Field(ConfigField()).ParseYAML(yamlStr, nil)
+	require.NoError(t, err)
+
+	conf, err := ConfigFromParsed(pConf)
+	require.NoError(t, err)
+	return conf
+}
+
+func testBatch(parts ...string) service.MessageBatch {
+	var batch service.MessageBatch
+	for _, p := range parts {
+		batch = append(batch, service.NewMessage([]byte(p)))
+	}
+	return batch
+}
+
+func TestRollingConfig(t *testing.T) {
+	pConf, err := service.NewConfigSpec().Field(ConfigField()).ParseYAML(`{}`, nil)
+	require.NoError(t, err)
+
+	conf, err := ConfigFromParsed(pConf)
+	require.NoError(t, err)
+	assert.False(t, conf.Enabled)
+
+	conf = testConfig(t, `
+rolling:
+  enabled: true
+  codec: delim:|
+  max_size: 0
+  max_count: 10
+  max_period: 5s
+`)
+	assert.True(t, conf.Enabled)
+	assert.Equal(t, 0, conf.MaxSize)
+	assert.Equal(t, 10, conf.MaxCount)
+	assert.Equal(t, 5*time.Second, conf.MaxPeriod)
+	assert.Equal(t, 16, conf.MaxOpenFiles)
+	assert.Equal(t, []byte("|"), conf.suffixFn([]byte("foo")))
+	assert.Nil(t, conf.suffixFn([]byte("foo|")))
+
+	for _, yamlStr := range []string{
+		`rolling: { enabled: true, codec: nope }`,
+		`rolling: { enabled: true, codec: "delim:" }`,
+		`rolling: { enabled: true, max_size: 0, max_count: 0, max_period: 0s }`,
+	} {
+		pConf, err := service.NewConfigSpec().Field(ConfigField()).ParseYAML(yamlStr, nil)
+		require.NoError(t, err)
+
+		_, err = ConfigFromParsed(pConf)
+		assert.Error(t, err, yamlStr)
+	}
+}
+
+func TestRollingWriterCount(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  max_count: 2
+  max_period: 0s
+`)
+
+	w := NewWriter(conf, 1, store.open, nil)
+	require.NoError(t, w.WriteBatch(context.Background(), testBatch("a", "b", "c", "d", "e")))
+	require.NoError(t, w.Close(context.Background()))
+
+	assert.Equal(t, map[string]string{
+		"1": "a\nb\n",
+		"2": "c\nd\n",
+		"3": "e\n",
+	}, store.files())
+}
+
+func TestRollingWriterSize(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  codec: append
+  max_size: 5
+  max_period: 0s
+`)
+
+	w := NewWriter(conf, 1, store.open, nil)
+	require.NoError(t, w.WriteBatch(context.Background(), testBatch("abc", "de", "fghij", "k")))
+	require.NoError(t, w.Close(context.Background()))
+
+	assert.Equal(t, map[string]string{
+		"1": "abcde",
+		"2": "fghij",
+		"3": "k",
+	}, store.files())
+}
+
+func TestRollingWriterPartitions(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  partition_by: '${! meta("p") }'
+  max_count: 2
+  max_period: 0s
+`)
+
+	batch := testBatch("a", "b", "c", "d")
+	for i, p := range []string{"x", "y", "x", "y"} {
+		batch[i].MetaSetMut("p", p)
+	}
+
+	w := NewWriter(conf, 1, store.open, nil)
+	require.NoError(t, w.WriteBatch(context.Background(), batch))
+	require.NoError(t, w.Close(context.Background()))
+
+	assert.Equal(t, map[string]string{
+		"x1": "a\nc\n",
+		"y2": "b\nd\n",
+	}, store.files())
+}
+
+func TestRollingWriterBlockedPartition(t *testing.T) {
+	store := &mockStore{
+		committed:  map[string]string{},
+		blockWrite: "slow",
+		unblock:    make(chan struct{}),
+	}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  partition_by: '${! meta("p") }'
+  max_count: 1
+  max_period: 0s
+`)
+
+	w := NewWriter(conf, 10, store.open, nil)
+
+	slowBatch := testBatch("slow")
+	slowBatch[0].MetaSetMut("p", "x")
+	slowResult := make(chan error, 1)
+	go func() {
+		slowResult <- w.WriteBatch(context.Background(), slowBatch)
+	}()
+
+	// A write to another partition completes whilst the first is blocked.
+	fastBatch := testBatch("fast")
+	fastBatch[0].MetaSetMut("p", "y")
+	require.Eventually(t, func() bool {
+		store.mut.Lock()
+		defer store.mut.Unlock()
+		return store.opened == 1
+	}, time.Second, time.Millisecond)
+	require.NoError(t, w.WriteBatch(context.Background(), fastBatch))
+	assert.Equal(t, map[string]string{"y2": "fast\n"}, store.files())
+
+	select {
+	case err := <-slowResult:
+		t.Fatalf("blocked write returned: %v", err)
+	default:
+	}
+
+	close(store.unblock)
+	require.NoError(t, <-slowResult)
+	require.NoError(t, w.Close(context.Background()))
+	assert.Equal(t, map[string]string{"x1": "slow\n", "y2": "fast\n"}, store.files())
+}
+
+func TestRollingWriterMaxOpenFiles(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  partition_by: '${! meta("p") }'
+  max_period: 0s
+  max_open_files: 1
+`)
+
+	batch := testBatch("a", "b", "c")
+	for i, p := range []string{"x", "y", "x"} {
+		batch[i].MetaSetMut("p", p)
+	}
+
+	w := NewWriter(conf, 1, store.open, nil)
+	require.NoError(t, w.WriteBatch(context.Background(), batch))
+	require.NoError(t, w.Close(context.Background()))
+
+	assert.Equal(t, map[string]string{
+		"x1": "a\n",
+		"y2": "b\n",
+		"x3": "c\n",
+	}, store.files())
+}
+
+func TestRollingWriterAcksOnCommit(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  max_count: 3
+  max_period: 0s
+`)
+
+	w := NewWriter(conf, 10, store.open, nil)
+
+	results := make(chan error, 3)
+	go func() {
+		results <- w.WriteBatch(context.Background(), testBatch("a"))
+	}()
+
+	select {
+	case err := <-results:
+		t.Fatalf("write returned before the file was committed: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+	assert.Empty(t, store.files())
+
+	go func() {
+		results <- w.WriteBatch(context.Background(), testBatch("b", "c"))
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-results:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("timed out")
+		}
+	}
+	assert.Equal(t, map[string]string{"1": "a\nb\nc\n"}, store.files())
+	require.NoError(t, w.Close(context.Background()))
+}
+
+func TestRollingWriterPeriod(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  max_period: 10ms
+`)
+
+	w := NewWriter(conf, 10, store.open, nil)
+	require.NoError(t, w.WriteBatch(context.Background(), testBatch("a", "b")))
+	assert.Equal(t, map[string]string{"1": "a\nb\n"}, store.files())
+	require.NoError(t, w.Close(context.Background()))
+}
+
+func TestRollingWriterClose(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  max_period: 0s
+`)
+
+	w := NewWriter(conf, 10, store.open, nil)
+
+	results := make(chan error, 1)
+	go func() {
+		results <- w.WriteBatch(context.Background(), testBatch("a"))
+	}()
+
+	select {
+	case err := <-results:
+		t.Fatalf("write returned before the file was committed: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	require.NoError(t, w.Close(context.Background()))
+	require.NoError(t, <-results)
+	assert.Equal(t, map[string]string{"1": "a\n"}, store.files())
+
+	require.ErrorIs(t, w.WriteBatch(context.Background(), testBatch("b")), service.ErrNotConnected)
+}
+
+func TestRollingWriterWriteFailure(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}, failWrite: "c"}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  max_period: 0s
+`)
+
+	w := NewWriter(conf, 1, store.open, nil)
+	err := w.WriteBatch(context.Background(), testBatch("a", "b", "c", "d"))
+	require.NoError(t, w.Close(context.Background()))
+
+	var bErr *service.BatchError
+	require.ErrorAs(t, err, &bErr)
+
+	var failed []int
+	bErr.WalkMessages(func(i int, _ *service.Message, err error) bool {
+		if err != nil {
+			failed = append(failed, i)
+		}
+		return true
+	})
+	assert.Equal(t, []int{0, 1, 2}, failed)
+	assert.Equal(t, []string{"1"}, store.aborted)
+	assert.Equal(t, map[string]string{"2": "d\n"}, store.files())
+}
+
+func TestRollingWriterCommitFailure(t *testing.T) {
+	store := &mockStore{committed: map[string]string{}, failCommit: true}
+	conf := testConfig(t, `
+rolling:
+  enabled: true
+  max_period: 0s
+`)
+
+	w := NewWriter(conf, 1, store.open, nil)
+	require.Error(t, w.WriteBatch(context.Background(), testBatch("a", "b")))
+	require.NoError(t, w.Close(context.Background()))
+
+	assert.Equal(t, []string{"1"}, store.aborted)
+	assert.Empty(t, store.files())
+}
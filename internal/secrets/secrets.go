@@ -0,0 +1,162 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets resolves references of the form
+// ${secret:<provider>:<reference>} within the values of environment variables.
+// Configs obtain the resolved values with regular environment variable
+// interpolations, and therefore secrets are inserted into configs by the config
+// parser in the same way as any other environment variable.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ResolveFunc returns the value of a secret from a reference, which excludes
+// the provider prefix.
+type ResolveFunc func(ctx context.Context, ref string) (string, error)
+
+var (
+	providersMut sync.RWMutex
+	providers    = map[string]ResolveFunc{}
+)
+
+// RegisterProvider registers a func that resolves references of the form
+// ${secret:<name>:<reference>}. Providers should only contact external
+// services once a reference is resolved.
+func RegisterProvider(name string, fn ResolveFunc) {
+	providersMut.Lock()
+	providers[name] = fn
+	providersMut.Unlock()
+}
+
+// Matches references such as ${secret:aws_sm:name#field}.
+var refRegex = regexp.MustCompile(`\${secret:([^}]+)}`)
+
+// ErrConfigReferences is returned when a config contains secret references
+// directly, which would otherwise be interpolated as an environment variable
+// named secret with the reference as its default value.
+var ErrConfigReferences = errors.New("secret references are only resolved within the values of environment variables, set the reference as the value of a variable and interpolate it within the config with ${NAME}")
+
+// HasReferences returns whether a string contains secret references.
+func HasReferences(s string) bool {
+	return refRegex.MatchString(s)
+}
+
+func resolve(ctx context.Context, ref string) (string, error) {
+	name, target, ok := strings.Cut(ref, ":")
+	if !ok || target == "" {
+		return "", fmt.Errorf("secret reference %v must be of the form <provider>:<reference>", ref)
+	}
+
+	providersMut.RLock()
+	fn, exists := providers[name]
+	providersMut.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("secret reference %v has an unknown provider %v", ref, name)
+	}
+	return fn(ctx, target)
+}
+
+// replace resolves all references within a string, where each distinct
+// reference is resolved once per call.
+func replace(ctx context.Context, str string, resolved map[string]string) (string, error) {
+	var errs []error
+	res := refRegex.ReplaceAllStringFunc(str, func(match string) string {
+		ref := refRegex.FindStringSubmatch(match)[1]
+		value, exists := resolved[ref]
+		if !exists {
+			var err error
+			if value, err = resolve(ctx, ref); err != nil {
+				errs = append(errs, err)
+			}
+			resolved[ref] = value
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	return res, nil
+}
+
+// resolveEnv returns the environment variables that contain secret references
+// mapped to their resolved values.
+func resolveEnv(ctx context.Context) (map[string]string, error) {
+	var names []string
+	for _, kv := range os.Environ() {
+		if k, v, _ := strings.Cut(kv, "="); HasReferences(v) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	env := map[string]string{}
+	resolved := map[string]string{}
+
+	var errs []error
+	for _, k := range names {
+		value, err := replace(ctx, os.Getenv(k), resolved)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("environment variable %v: %w", k, err))
+			continue
+		}
+		env[k] = value
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", errors.Join(errs...))
+	}
+	return env, nil
+}
+
+// EnvLookup resolves the secret references within the values of environment
+// variables, and returns a func that looks up environment variables with their
+// resolved values, which is intended for StreamBuilder.SetEnvVarLookupFunc.
+func EnvLookup(ctx context.Context) (func(name string) (string, bool), error) {
+	env, err := resolveEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(name string) (string, bool) {
+		if v, exists := env[name]; exists {
+			return v, true
+		}
+		return os.LookupEnv(name)
+	}, nil
+}
+
+// ResolveEnv replaces the values of environment variables containing secret
+// references with their resolved values, which is intended for the CLI where
+// configs are interpolated from the environment of the process. Secrets are
+// resolved once, and therefore rotated secrets are obtained by restarting the
+// process.
+func ResolveEnv(ctx context.Context) error {
+	env, err := resolveEnv(ctx)
+	if err != nil {
+		return err
+	}
+	for k, v := range env {
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func registerTestProvider(t *testing.T, values map[string]string) *int {
+	t.Helper()
+
+	var calls int
+	RegisterProvider("test", func(ctx context.Context, ref string) (string, error) {
+		calls++
+		v, exists := values[ref]
+		if !exists {
+			return "", errors.New("secret not found")
+		}
+		return v, nil
+	})
+	t.Cleanup(func() {
+		providersMut.Lock()
+		delete(providers, "test")
+		providersMut.Unlock()
+	})
+	return &calls
+}
+
+func TestEnvLookup(t *testing.T) {
+	calls := registerTestProvider(t, map[string]string{
+		"user":     "foo",
+		"password": `b"a: #r`,
+	})
+
+	t.Setenv("SECRETS_TEST_DSN", "postgres://${secret:test:user}:${secret:test:password}@localhost")
+	t.Setenv("SECRETS_TEST_USER", "${secret:test:user}")
+	t.Setenv("SECRETS_TEST_PLAIN", "nothing to see here")
+
+	lookup, err := EnvLookup(context.Background())
+	require.NoError(t, err)
+
+	for k, exp := range map[string]string{
+		"SECRETS_TEST_DSN":   `postgres://foo:b"a: #r@localhost`,
+		"SECRETS_TEST_USER":  "foo",
+		"SECRETS_TEST_PLAIN": "nothing to see here",
+	} {
+		v, exists := lookup(k)
+		assert.True(t, exists, k)
+		assert.Equal(t, exp, v, k)
+	}
+	_, exists := lookup("SECRETS_TEST_NOPE")
+	assert.False(t, exists)
+
+	// Each distinct reference is resolved once, and the environment of the
+	// process is left untouched.
+	assert.Equal(t, 2, *calls)
+	assert.Equal(t, "${secret:test:user}", os.Getenv("SECRETS_TEST_USER"))
+}
+
+func TestEnvLookupErrors(t *testing.T) {
+	registerTestProvider(t, map[string]string{})
+
+	for _, ref := range []string{
+		"${secret:test:nope}",
+		"${secret:vault:foo}",
+		"${secret:test}",
+	} {
+		t.Setenv("SECRETS_TEST_REF", ref)
+		_, err := EnvLookup(context.Background())
+		require.Error(t, err, ref)
+		assert.Contains(t, err.Error(), "SECRETS_TEST_REF", ref)
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	registerTestProvider(t, map[string]string{
+		"key": "line one\nline two",
+	})
+
+	t.Setenv("SECRETS_TEST_KEY", "${secret:test:key}")
+	t.Setenv("SECRETS_TEST_PLAIN", "nothing to see here")
+
+	require.NoError(t, ResolveEnv(context.Background()))
+	assert.Equal(t, "line one\nline two", os.Getenv("SECRETS_TEST_KEY"))
+	assert.Equal(t, "nothing to see here", os.Getenv("SECRETS_TEST_PLAIN"))
+}
+
+func TestHasReferences(t *testing.T) {
+	assert.True(t, HasReferences("dsn: ${secret:aws_sm:db#dsn}"))
+	assert.False(t, HasReferences("dsn: ${DSN}"))
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// HTTPResponse is the response of an invocation from an API Gateway REST API,
+// HTTP API or Application Load Balancer.
+type HTTPResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	StatusDescription string              `json:"statusDescription,omitempty"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+type httpEventKind int
+
+const (
+	httpEventAPIGatewayV1 httpEventKind = iota
+	httpEventAPIGatewayV2
+	httpEventALB
+)
+
+// httpEvent is a request parsed from an API Gateway or Application Load
+// Balancer event.
+type httpEvent struct {
+	kind              httpEventKind
+	multiValueHeaders bool
+	req               *httpRequest
+}
+
+func getStringMap(obj map[string]any, key string) map[string]string {
+	m, _ := obj[key].(map[string]any)
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		if s, ok := v.(string); ok {
+			res[k] = s
+		}
+	}
+	return res
+}
+
+func getMultiValueMap(obj map[string]any, key string) map[string][]string {
+	m, _ := obj[key].(map[string]any)
+	res := make(map[string][]string, len(m))
+	for k, v := range m {
+		arr, _ := v.([]any)
+		for _, e := range arr {
+			if s, ok := e.(string); ok {
+				res[k] = append(res[k], s)
+			}
+		}
+	}
+	return res
+}
+
+// parseHTTPEvent attempts to parse an invocation payload as an HTTP request
+// from an API Gateway REST API (payload format 1.0), HTTP API (payload format
+// 2.0) or Application Load Balancer. Returns nil when the payload is not such
+// an event.
+func parseHTTPEvent(v any) (*httpEvent, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	reqCtx, ok := obj["requestContext"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	event := &httpEvent{
+		req: &httpRequest{
+			header: http.Header{},
+			query:  url.Values{},
+		},
+	}
+	req := event.req
+
+	if _, isV2 := reqCtx["http"].(map[string]any); isV2 && getString(obj, "version") == "2.0" {
+		event.kind = httpEventAPIGatewayV2
+		req.method = getString(reqCtx, "http", "method")
+		req.path = getString(obj, "rawPath")
+		req.remoteIP = getString(reqCtx, "http", "sourceIp")
+		for k, v := range getStringMap(obj, "headers") {
+			req.header.Set(k, v)
+		}
+		if cookies, ok := obj["cookies"].([]any); ok {
+			for _, c := range cookies {
+				if s, ok := c.(string); ok {
+					req.header.Add("Cookie", s)
+				}
+			}
+		}
+		var err error
+		if req.query, err = url.ParseQuery(getString(obj, "rawQueryString")); err != nil {
+			return nil, fmt.Errorf("failed to parse query string: %w", err)
+		}
+		req.pathParams = getStringMap(obj, "pathParameters")
+	} else if method := getString(obj, "httpMethod"); method != "" {
+		event.kind = httpEventAPIGatewayV1
+		if _, isALB := reqCtx["elb"]; isALB {
+			event.kind = httpEventALB
+		}
+		req.method = method
+		req.path = getString(obj, "path")
+		req.remoteIP = getString(reqCtx, "identity", "sourceIp")
+
+		if mvHeaders := getMultiValueMap(obj, "multiValueHeaders"); len(mvHeaders) > 0 {
+			event.multiValueHeaders = true
+			for k, v := range mvHeaders {
+				for _, e := range v {
+					req.header.Add(k, e)
+				}
+			}
+		} else {
+			for k, v := range getStringMap(obj, "headers") {
+				req.header.Set(k, v)
+			}
+		}
+
+		query := getMultiValueMap(obj, "multiValueQueryStringParameters")
+		if len(query) == 0 {
+			for k, v := range getStringMap(obj, "queryStringParameters") {
+				query[k] = []string{v}
+			}
+		}
+		for k, vs := range query {
+			for _, v := range vs {
+				// Query parameters are forwarded by load balancers exactly as
+				// they were received.
+				if event.kind == httpEventALB {
+					if uk, err := url.QueryUnescape(k); err == nil {
+						k = uk
+					}
+					if uv, err := url.QueryUnescape(v); err == nil {
+						v = uv
+					}
+				}
+				req.query.Add(k, v)
+			}
+		}
+		req.pathParams = getStringMap(obj, "pathParameters")
+	} else {
+		return nil, nil
+	}
+	if req.remoteIP == "" {
+		if fwd := req.header.Get("X-Forwarded-For"); fwd != "" {
+			ip, _, _ := strings.Cut(fwd, ",")
+			req.remoteIP = strings.TrimSpace(ip)
+		}
+	}
+
+	body := getString(obj, "body")
+	if isB64, _ := obj["isBase64Encoded"].(bool); isB64 {
+		b, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode body: %w", err)
+		}
+		req.body = b
+	} else {
+		req.body = []byte(body)
+	}
+	return event, nil
+}
+
+// toHTTPResponse converts a response into the format expected by the source of
+// the event, where bodies that aren't valid UTF-8 are base64 encoded.
+func (e *httpEvent) toHTTPResponse(res *httpResponse) HTTPResponse {
+	hRes := HTTPResponse{StatusCode: res.statusCode}
+	if utf8.Valid(res.body) {
+		hRes.Body = string(res.body)
+	} else {
+		hRes.Body = base64.StdEncoding.EncodeToString(res.body)
+		hRes.IsBase64Encoded = true
+	}
+
+	if e.multiValueHeaders {
+		hRes.MultiValueHeaders = map[string][]string(res.header)
+	} else if len(res.header) > 0 {
+		hRes.Headers = make(map[string]string, len(res.header))
+		for k := range res.header {
+			hRes.Headers[k] = strings.Join(res.header.Values(k), ",")
+		}
+	}
+
+	if e.kind == httpEventALB {
+		hRes.StatusDescription = fmt.Sprintf("%d %s", res.statusCode, http.StatusText(res.statusCode))
+	}
+	return hRes
+}
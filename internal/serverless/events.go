@@ -0,0 +1,299 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// The event sources of Lambda event source mappings that invoke a function
+// with a list of records.
+const (
+	eventSourceSQS              = "aws:sqs"
+	eventSourceKinesis          = "aws:kinesis"
+	eventSourceDynamoDB         = "aws:dynamodb"
+	eventSourceMSK              = "aws:kafka"
+	eventSourceSelfManagedKafka = "SelfManagedKafka"
+)
+
+// BatchItemFailure identifies a record of an invocation that failed to be
+// processed.
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// BatchResponse is the response of an invocation from an event source mapping
+// that supports partial batch failures, where only the records listed are
+// retried.
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+// recordEvent is an invocation that has been expanded into a batch of
+// messages, one for each record.
+type recordEvent struct {
+	source string
+	batch  service.MessageBatch
+
+	// itemIDs contains the identifier of each record reported when it fails,
+	// and is nil for event sources that do not support partial batch failures.
+	itemIDs []string
+}
+
+// parseRecordEvent attempts to expand an invocation payload into a batch of
+// records. Returns nil when the payload is not an event of a supported event
+// source mapping.
+func parseRecordEvent(v any) (*recordEvent, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	if src, _ := obj["eventSource"].(string); src == eventSourceMSK || src == eventSourceSelfManagedKafka {
+		records, ok := obj["records"].(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		return parseKafkaEvent(src, records)
+	}
+
+	records, ok := obj["Records"].([]any)
+	if !ok || len(records) == 0 {
+		return nil, nil
+	}
+	first, ok := records[0].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	var parseFn func(map[string]any) (*service.Message, string, error)
+	src, _ := first["eventSource"].(string)
+	switch src {
+	case eventSourceSQS:
+		parseFn = parseSQSRecord
+	case eventSourceKinesis:
+		parseFn = parseKinesisRecord
+	case eventSourceDynamoDB:
+		parseFn = parseDynamoDBRecord
+	default:
+		return nil, nil
+	}
+
+	event := &recordEvent{
+		source:  src,
+		batch:   make(service.MessageBatch, 0, len(records)),
+		itemIDs: make([]string, 0, len(records)),
+	}
+	for i, r := range records {
+		rObj, ok := r.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("record %v: expected object, got %T", i, r)
+		}
+		msg, id, err := parseFn(rObj)
+		if err != nil {
+			return nil, fmt.Errorf("record %v: %w", i, err)
+		}
+		msg.MetaSetMut("lambda_event_source", src)
+		event.batch = append(event.batch, msg)
+		event.itemIDs = append(event.itemIDs, id)
+	}
+	return event, nil
+}
+
+func getString(obj map[string]any, path ...string) string {
+	for i, k := range path {
+		if i == len(path)-1 {
+			s, _ := obj[k].(string)
+			return s
+		}
+		if obj, _ = obj[k].(map[string]any); obj == nil {
+			return ""
+		}
+	}
+	return ""
+}
+
+func getInt(obj map[string]any, key string) int64 {
+	switch t := obj[key].(type) {
+	case float64:
+		return int64(t)
+	case int64:
+		return t
+	case int:
+		return int64(t)
+	case string:
+		i, _ := strconv.ParseInt(t, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func decodeBase64(obj map[string]any, key string) ([]byte, error) {
+	s, _ := obj[key].(string)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %w", key, err)
+	}
+	return b, nil
+}
+
+func parseSQSRecord(r map[string]any) (*service.Message, string, error) {
+	id := getString(r, "messageId")
+	if id == "" {
+		return nil, "", errors.New("missing messageId")
+	}
+
+	msg := service.NewMessage([]byte(getString(r, "body")))
+	msg.MetaSetMut("sqs_message_id", id)
+	msg.MetaSetMut("sqs_receipt_handle", getString(r, "receiptHandle"))
+	if rCount := getString(r, "attributes", "ApproximateReceiveCount"); rCount != "" {
+		msg.MetaSetMut("sqs_approximate_receive_count", rCount)
+	}
+	if arn := getString(r, "eventSourceARN"); arn != "" {
+		msg.MetaSetMut("sqs_queue_arn", arn)
+	}
+	if attrs, ok := r["messageAttributes"].(map[string]any); ok {
+		for k, v := range attrs {
+			if attr, ok := v.(map[string]any); ok {
+				if s := getString(attr, "stringValue"); s != "" {
+					msg.MetaSetMut(k, s)
+				}
+			}
+		}
+	}
+	return msg, id, nil
+}
+
+func parseKinesisRecord(r map[string]any) (*service.Message, string, error) {
+	kRecord, _ := r["kinesis"].(map[string]any)
+	seq := getString(kRecord, "sequenceNumber")
+	if seq == "" {
+		return nil, "", errors.New("missing kinesis.sequenceNumber")
+	}
+
+	data, err := decodeBase64(kRecord, "data")
+	if err != nil {
+		return nil, "", err
+	}
+
+	msg := service.NewMessage(data)
+	if arn := getString(r, "eventSourceARN"); arn != "" {
+		msg.MetaSetMut("kinesis_stream", arn[strings.LastIndex(arn, "/")+1:])
+	}
+	if eventID := getString(r, "eventID"); eventID != "" {
+		shard, _, _ := strings.Cut(eventID, ":")
+		msg.MetaSetMut("kinesis_shard", shard)
+	}
+	msg.MetaSetMut("kinesis_partition_key", getString(kRecord, "partitionKey"))
+	msg.MetaSetMut("kinesis_sequence_number", seq)
+	return msg, seq, nil
+}
+
+func parseDynamoDBRecord(r map[string]any) (*service.Message, string, error) {
+	seq := getString(r, "dynamodb", "SequenceNumber")
+	if seq == "" {
+		return nil, "", errors.New("missing dynamodb.SequenceNumber")
+	}
+
+	msg := service.NewMessage(nil)
+	msg.SetStructuredMut(r)
+	if arn := getString(r, "eventSourceARN"); arn != "" {
+		table, _, _ := strings.Cut(arn[strings.Index(arn, "/")+1:], "/")
+		msg.MetaSetMut("dynamodb_table", table)
+	}
+	msg.MetaSetMut("dynamodb_event_name", getString(r, "eventName"))
+	msg.MetaSetMut("dynamodb_sequence_number", seq)
+	return msg, seq, nil
+}
+
+// parseKafkaEvent expands an event from an Amazon MSK or self-managed Kafka
+// event source mapping, where records are grouped by topic partition. These
+// event sources do not support partial batch failures.
+func parseKafkaEvent(src string, records map[string]any) (*recordEvent, error) {
+	event := &recordEvent{source: src}
+
+	topicPartitions := make([]string, 0, len(records))
+	for k := range records {
+		topicPartitions = append(topicPartitions, k)
+	}
+	sort.Strings(topicPartitions)
+
+	for _, tp := range topicPartitions {
+		tpRecords, ok := records[tp].([]any)
+		if !ok {
+			return nil, fmt.Errorf("records of %v: expected array, got %T", tp, records[tp])
+		}
+		for i, r := range tpRecords {
+			rObj, ok := r.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("record %v of %v: expected object, got %T", i, tp, r)
+			}
+			msg, err := parseKafkaRecord(rObj)
+			if err != nil {
+				return nil, fmt.Errorf("record %v of %v: %w", i, tp, err)
+			}
+			msg.MetaSetMut("lambda_event_source", src)
+			event.batch = append(event.batch, msg)
+		}
+	}
+	return event, nil
+}
+
+func parseKafkaRecord(r map[string]any) (*service.Message, error) {
+	var value []byte
+	if _, exists := r["value"]; exists {
+		var err error
+		if value, err = decodeBase64(r, "value"); err != nil {
+			return nil, err
+		}
+	}
+	key, err := decodeBase64(r, "key")
+	if err != nil {
+		return nil, err
+	}
+
+	msg := service.NewMessage(value)
+	msg.MetaSetMut("kafka_key", string(key))
+	msg.MetaSetMut("kafka_topic", getString(r, "topic"))
+	msg.MetaSetMut("kafka_partition", int(getInt(r, "partition")))
+	msg.MetaSetMut("kafka_offset", int(getInt(r, "offset")))
+	msg.MetaSetMut("kafka_timestamp_unix", getInt(r, "timestamp")/1000)
+	msg.MetaSetMut("kafka_tombstone_message", value == nil)
+
+	// Headers are a list of objects, each containing a single key with a value
+	// of an array of bytes.
+	headers, _ := r["headers"].([]any)
+	for _, h := range headers {
+		hObj, _ := h.(map[string]any)
+		for k, v := range hObj {
+			bytesArr, _ := v.([]any)
+			hValue := make([]byte, 0, len(bytesArr))
+			for _, b := range bytesArr {
+				if f, ok := b.(float64); ok {
+					hValue = append(hValue, byte(f))
+				}
+			}
+			msg.MetaSetMut(k, string(hValue))
+		}
+	}
+	return msg, nil
+}
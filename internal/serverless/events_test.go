@@ -0,0 +1,183 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func parseTestEvent(t *testing.T, event string) *recordEvent {
+	t.Helper()
+	var v any
+	require.NoError(t, json.Unmarshal([]byte(event), &v))
+	e, err := parseRecordEvent(v)
+	require.NoError(t, err)
+	return e
+}
+
+func messageMeta(t *testing.T, msg *service.Message) map[string]any {
+	t.Helper()
+	meta := map[string]any{}
+	require.NoError(t, msg.MetaWalkMut(func(k string, v any) error {
+		meta[k] = v
+		return nil
+	}))
+	return meta
+}
+
+func TestParseSQSEvent(t *testing.T) {
+	e := parseTestEvent(t, `{"Records":[{
+  "messageId": "059f36b4-87a3-44ab-83d2-661975830a7d",
+  "receiptHandle": "AQEBwJnKyrHigUMZj6rYigCgxlaS3SLy0a",
+  "body": "hello world",
+  "attributes": {"ApproximateReceiveCount": "2"},
+  "messageAttributes": {"foo": {"stringValue": "bar", "dataType": "String"}},
+  "eventSource": "aws:sqs",
+  "eventSourceARN": "arn:aws:sqs:us-east-2:123456789012:my-queue"
+}]}`)
+	require.NotNil(t, e)
+	assert.Equal(t, "aws:sqs", e.source)
+	assert.Equal(t, []string{"059f36b4-87a3-44ab-83d2-661975830a7d"}, e.itemIDs)
+	require.Len(t, e.batch, 1)
+
+	b, err := e.batch[0].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(b))
+	assert.Equal(t, map[string]any{
+		"lambda_event_source":           "aws:sqs",
+		"sqs_message_id":                "059f36b4-87a3-44ab-83d2-661975830a7d",
+		"sqs_receipt_handle":            "AQEBwJnKyrHigUMZj6rYigCgxlaS3SLy0a",
+		"sqs_approximate_receive_count": "2",
+		"sqs_queue_arn":                 "arn:aws:sqs:us-east-2:123456789012:my-queue",
+		"foo":                           "bar",
+	}, messageMeta(t, e.batch[0]))
+}
+
+func TestParseKinesisEvent(t *testing.T) {
+	e := parseTestEvent(t, `{"Records":[{
+  "kinesis": {
+    "partitionKey": "1",
+    "sequenceNumber": "49590338271490256608559692538361571095921575989136588898",
+    "data": "SGVsbG8sIHRoaXMgaXMgYSB0ZXN0Lg=="
+  },
+  "eventSource": "aws:kinesis",
+  "eventID": "shardId-000000000006:49590338271490256608559692538361571095921575989136588898",
+  "eventSourceARN": "arn:aws:kinesis:us-east-1:123456789012:stream/lambda-stream"
+}]}`)
+	require.NotNil(t, e)
+	assert.Equal(t, []string{"49590338271490256608559692538361571095921575989136588898"}, e.itemIDs)
+	require.Len(t, e.batch, 1)
+
+	b, err := e.batch[0].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, this is a test.", string(b))
+	assert.Equal(t, map[string]any{
+		"lambda_event_source":     "aws:kinesis",
+		"kinesis_stream":          "lambda-stream",
+		"kinesis_shard":           "shardId-000000000006",
+		"kinesis_partition_key":   "1",
+		"kinesis_sequence_number": "49590338271490256608559692538361571095921575989136588898",
+	}, messageMeta(t, e.batch[0]))
+}
+
+func TestParseDynamoDBEvent(t *testing.T) {
+	e := parseTestEvent(t, `{"Records":[{
+  "eventID": "1",
+  "eventName": "INSERT",
+  "eventSource": "aws:dynamodb",
+  "eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/ExampleTable/stream/2015-06-27T00:48:05.899",
+  "dynamodb": {
+    "Keys": {"Id": {"N": "101"}},
+    "NewImage": {"Message": {"S": "New item!"}, "Id": {"N": "101"}},
+    "SequenceNumber": "111",
+    "StreamViewType": "NEW_AND_OLD_IMAGES"
+  }
+}]}`)
+	require.NotNil(t, e)
+	assert.Equal(t, []string{"111"}, e.itemIDs)
+	require.Len(t, e.batch, 1)
+
+	v, err := e.batch[0].AsStructured()
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT", v.(map[string]any)["eventName"])
+	assert.Equal(t, map[string]any{
+		"lambda_event_source":      "aws:dynamodb",
+		"dynamodb_table":           "ExampleTable",
+		"dynamodb_event_name":      "INSERT",
+		"dynamodb_sequence_number": "111",
+	}, messageMeta(t, e.batch[0]))
+}
+
+func TestParseKafkaEvent(t *testing.T) {
+	e := parseTestEvent(t, `{
+  "eventSource": "SelfManagedKafka",
+  "records": {
+    "mytopic-1": [{"topic": "mytopic", "partition": 1, "offset": 20, "timestamp": 1545084650987, "key": "YmFy", "value": "d29ybGQ="}],
+    "mytopic-0": [{
+      "topic": "mytopic",
+      "partition": 0,
+      "offset": 15,
+      "timestamp": 1545084650987,
+      "key": "Zm9v",
+      "value": "aGVsbG8=",
+      "headers": [{"headerKey": [104, 101, 97, 100, 101, 114, 86, 97, 108, 117, 101]}]
+    }]
+  }
+}`)
+	require.NotNil(t, e)
+	assert.Nil(t, e.itemIDs)
+	require.Len(t, e.batch, 2)
+
+	b, err := e.batch[0].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, map[string]any{
+		"lambda_event_source":     "SelfManagedKafka",
+		"kafka_key":               "foo",
+		"kafka_topic":             "mytopic",
+		"kafka_partition":         0,
+		"kafka_offset":            15,
+		"kafka_timestamp_unix":    int64(1545084650),
+		"kafka_tombstone_message": false,
+		"headerKey":               "headerValue",
+	}, messageMeta(t, e.batch[0]))
+
+	b, err = e.batch[1].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(b))
+}
+
+func TestParseNonRecordEvents(t *testing.T) {
+	for _, event := range []string{
+		`"hello world"`,
+		`{"foo":"bar"}`,
+		`{"Records":[]}`,
+		`{"Records":[{"eventSource":"aws:s3"}]}`,
+		`{"eventSource":"aws:kafka"}`,
+	} {
+		assert.Nil(t, parseTestEvent(t, event), event)
+	}
+
+	var v any
+	require.NoError(t, json.Unmarshal([]byte(`{"Records":[{"eventSource":"aws:sqs","body":"foo"}]}`), &v))
+	_, err := parseRecordEvent(v)
+	require.Error(t, err)
+}
@@ -16,6 +16,7 @@ package serverless
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
@@ -24,14 +25,58 @@ import (
 // Handler provides a mechanism for controlling the lifetime of a serverless
 // handler runtime of Redpanda Connect.
 type Handler struct {
-	prodFn service.MessageHandlerFunc
-	strm   *service.Stream
+	reqChan       chan handlerRequest
+	strm          *service.Stream
+	expandRecords bool
+	httpEvents    bool
+	envVarLookup  func(string) (string, bool)
+}
+
+// HandlerOpt configures a serverless stream handler.
+type HandlerOpt func(h *Handler)
+
+// OptExpandEventRecords sets whether the records of events from SQS, Kinesis,
+// DynamoDB Streams and Kafka event source mappings are expanded into batches
+// by Handle, which is disabled by default.
+func OptExpandEventRecords(enabled bool) HandlerOpt {
+	return func(h *Handler) {
+		h.expandRecords = enabled
+	}
+}
+
+// OptHTTPEvents sets whether requests from API Gateway REST and HTTP APIs, and
+// from Application Load Balancers, are processed by Handle as HTTP requests
+// with their responses adapted to the format expected by the source, which is
+// disabled by default.
+func OptHTTPEvents(enabled bool) HandlerOpt {
+	return func(h *Handler) {
+		h.httpEvents = enabled
+	}
+}
+
+// OptEnvVarLookupFunc sets the func used to obtain the values of environment
+// variable interpolations within the config, which defaults to os.LookupEnv.
+func OptEnvVarLookupFunc(fn func(string) (string, bool)) HandlerOpt {
+	return func(h *Handler) {
+		h.envVarLookup = fn
+	}
 }
 
 // NewHandler creates a new serverless stream handler, where the provided config
 // is used in order to determine the behaviour of the pipeline.
-func NewHandler(confYAML string) (*Handler, error) {
-	env := service.GlobalEnvironment()
+func NewHandler(confYAML string, opts ...HandlerOpt) (*Handler, error) {
+	h := &Handler{
+		reqChan: make(chan handlerRequest),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	env := service.GlobalEnvironment().Clone()
+	if err := registerHandlerInput(env, h.reqChan); err != nil {
+		return nil, err
+	}
+
 	schema := env.FullConfigSchema("", "")
 	schema.SetFieldDefault(map[string]any{
 		"none": map[string]any{},
@@ -61,29 +106,27 @@ func NewHandler(confYAML string) (*Handler, error) {
 
 	strmBuilder := env.NewStreamBuilder()
 	strmBuilder.SetSchema(schema)
+	if h.envVarLookup != nil {
+		strmBuilder.SetEnvVarLookupFunc(h.envVarLookup)
+	}
 
 	if err := strmBuilder.SetYAML(confYAML); err != nil {
 		return nil, err
 	}
 
-	prod, err := strmBuilder.AddProducerFunc()
-	if err != nil {
+	if err := strmBuilder.AddInputYAML(handlerInputName + ": {}"); err != nil {
 		return nil, err
 	}
 
-	strm, err := strmBuilder.Build()
-	if err != nil {
+	var err error
+	if h.strm, err = strmBuilder.Build(); err != nil {
 		return nil, err
 	}
 
 	go func() {
-		_ = strm.Run(context.Background())
+		_ = h.strm.Run(context.Background())
 	}()
-
-	return &Handler{
-		prodFn: prod,
-		strm:   strm,
-	}, nil
+	return h, nil
 }
 
 // Close shuts down the underlying pipeline.
@@ -91,15 +134,68 @@ func (h *Handler) Close(ctx context.Context) error {
 	return h.strm.Stop(ctx)
 }
 
+// process writes a batch into the underlying pipeline and blocks until it has
+// been acknowledged, returning the acknowledgement error.
+func (h *Handler) process(ctx context.Context, batch service.MessageBatch) error {
+	resChan := make(chan error, 1)
+	select {
+	case h.reqChan <- handlerRequest{batch: batch, resChan: resChan}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-resChan:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Handle is a request/response func that injects a payload into the underlying
 // Benthos pipeline and returns a result.
+//
+// When expanding event records is enabled with OptExpandEventRecords and the
+// payload is an event from an SQS, Kinesis, DynamoDB Streams or Kafka event
+// source mapping, each record is expanded into a message of a single batch,
+// with metadata describing its source. For SQS, Kinesis and DynamoDB Streams a
+// BatchResponse is returned listing the records that failed, which requires
+// the event source mapping to be configured with ReportBatchItemFailures in
+// order for only those records to be retried. Kafka event sources do not
+// support partial batch failures and an error is returned when any record
+// fails. Otherwise these events are processed as a single message.
+//
+// When HTTP events are enabled with OptHTTPEvents and the payload is a request
+// from an API Gateway REST or HTTP API, or from an Application Load Balancer,
+// the request is processed in the same way as requests of ServeHTTP and an
+// HTTPResponse is returned. Otherwise these events are processed as a single
+// message.
 func (h *Handler) Handle(ctx context.Context, v any) (any, error) {
+	if h.expandRecords {
+		event, err := parseRecordEvent(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse event records: %w", err)
+		}
+		if event != nil {
+			return h.handleRecords(ctx, event)
+		}
+	}
+
+	if h.httpEvents {
+		hEvent, err := parseHTTPEvent(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HTTP event: %w", err)
+		}
+		if hEvent != nil {
+			return hEvent.toHTTPResponse(h.handleHTTP(ctx, hEvent.req)), nil
+		}
+	}
+
 	msg := service.NewMessage(nil)
 	msg.SetStructured(v)
 
 	msg, store := msg.WithSyncResponseStore()
 
-	if err := h.prodFn(ctx, msg); err != nil {
+	if err := h.process(ctx, service.MessageBatch{msg}); err != nil {
 		return nil, err
 	}
 
@@ -130,3 +226,66 @@ func (h *Handler) Handle(ctx context.Context, v any) (any, error) {
 	}
 	return genBatchOfBatches, nil
 }
+
+func (h *Handler) handleRecords(ctx context.Context, event *recordEvent) (any, error) {
+	// Sync responses of records are discarded, but a store is required by the
+	// sync_response output of the default config.
+	batch := event.batch
+	if len(batch) == 0 {
+		return BatchResponse{BatchItemFailures: []BatchItemFailure{}}, nil
+	}
+
+	var first *service.Message
+	first, _ = batch[0].WithSyncResponseStore()
+	batch[0] = first
+	for i := 1; i < len(batch); i++ {
+		batch[i] = batch[i].WithContext(first.Context())
+	}
+
+	indexer := batch.Index()
+	ackErr := h.process(ctx, batch)
+	if ackErr != nil && ctx.Err() != nil {
+		return nil, ackErr
+	}
+
+	res := BatchResponse{BatchItemFailures: []BatchItemFailure{}}
+	if ackErr == nil {
+		return res, nil
+	}
+	if event.itemIDs == nil {
+		return nil, ackErr
+	}
+
+	failed := make([]bool, len(batch))
+	var bErr *service.BatchError
+	if errors.As(ackErr, &bErr) && bErr.IndexedErrors() > 0 {
+		bErr.WalkMessagesIndexedBy(indexer, func(i int, _ *service.Message, err error) bool {
+			if err == nil {
+				return true
+			}
+			if i < 0 || i >= len(failed) {
+				// A failed message that cannot be associated with a record
+				// results in every record being retried.
+				for j := range failed {
+					failed[j] = true
+				}
+				return false
+			}
+			failed[i] = true
+			return true
+		})
+	} else {
+		for i := range failed {
+			failed[i] = true
+		}
+	}
+
+	for i, f := range failed {
+		if f {
+			res.BatchItemFailures = append(res.BatchItemFailures, BatchItemFailure{
+				ItemIdentifier: event.itemIDs[i],
+			})
+		}
+	}
+	return res, nil
+}
@@ -16,6 +16,7 @@ package serverless_test
 
 import (
 	"context"
+	"encoding/base64"
 	"testing"
 	"time"
 
@@ -47,3 +48,172 @@ logger:
 
 	require.NoError(t, h.Close(ctx))
 }
+
+func TestServerlessHandlerEnvVarLookup(t *testing.T) {
+	h, err := serverless.NewHandler(`
+pipeline:
+  processors:
+    - mapping: 'root.greeting = this + " ${SERVERLESS_TEST_SUFFIX}"'
+logger:
+  level: NONE
+`, serverless.OptEnvVarLookupFunc(func(name string) (string, bool) {
+		if name == "SERVERLESS_TEST_SUFFIX" {
+			return "world", true
+		}
+		return "", false
+	}))
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	res, err := h.Handle(ctx, "hello")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"greeting": "hello world"}, res)
+
+	require.NoError(t, h.Close(ctx))
+}
+
+func TestServerlessHandlerEventRecordsDisabled(t *testing.T) {
+	h, err := serverless.NewHandler(`
+pipeline:
+  processors:
+    - mapping: 'root.count = this.Records.length()'
+logger:
+  level: NONE
+`)
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	res, err := h.Handle(ctx, map[string]any{
+		"Records": []any{
+			map[string]any{"messageId": "a", "body": "foo", "eventSource": "aws:sqs"},
+			map[string]any{"messageId": "b", "body": "bar", "eventSource": "aws:sqs"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"count": int64(2)}, res)
+
+	require.NoError(t, h.Close(ctx))
+}
+
+func TestServerlessHandlerSQSPartialFailures(t *testing.T) {
+	h, err := serverless.NewHandler(`
+pipeline:
+  processors:
+    - mapping: |
+        root = if content() == "bad" { throw("nope") } else { content().uppercase() }
+logger:
+  level: NONE
+`, serverless.OptExpandEventRecords(true))
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	record := func(id, body string) any {
+		return map[string]any{
+			"messageId":     id,
+			"receiptHandle": "handle-" + id,
+			"body":          body,
+			"eventSource":   "aws:sqs",
+		}
+	}
+
+	res, err := h.Handle(ctx, map[string]any{
+		"Records": []any{record("a", "good"), record("b", "bad"), record("c", "good"), record("d", "bad")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, serverless.BatchResponse{
+		BatchItemFailures: []serverless.BatchItemFailure{{ItemIdentifier: "b"}, {ItemIdentifier: "d"}},
+	}, res)
+
+	res, err = h.Handle(ctx, map[string]any{
+		"Records": []any{record("a", "good"), record("c", "good")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, serverless.BatchResponse{BatchItemFailures: []serverless.BatchItemFailure{}}, res)
+
+	require.NoError(t, h.Close(ctx))
+}
+
+func TestServerlessHandlerKinesisFilteredRecords(t *testing.T) {
+	h, err := serverless.NewHandler(`
+pipeline:
+  processors:
+    - mapping: |
+        root = if content() == "drop" { deleted() } else if content() == "bad" { throw("nope") } else { content() }
+logger:
+  level: NONE
+`, serverless.OptExpandEventRecords(true))
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	record := func(seq, data string) any {
+		return map[string]any{
+			"eventSource": "aws:kinesis",
+			"eventID":     "shardId-000000000000:" + seq,
+			"kinesis": map[string]any{
+				"sequenceNumber": seq,
+				"partitionKey":   "foo",
+				"data":           base64.StdEncoding.EncodeToString([]byte(data)),
+			},
+		}
+	}
+
+	res, err := h.Handle(ctx, map[string]any{
+		"Records": []any{record("1", "drop"), record("2", "good"), record("3", "bad")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, serverless.BatchResponse{
+		BatchItemFailures: []serverless.BatchItemFailure{{ItemIdentifier: "3"}},
+	}, res)
+
+	require.NoError(t, h.Close(ctx))
+}
+
+func TestServerlessHandlerKafkaFailure(t *testing.T) {
+	h, err := serverless.NewHandler(`
+pipeline:
+  processors:
+    - mapping: |
+        root = if content() == "bad" { throw("nope") } else { content() }
+logger:
+  level: NONE
+`, serverless.OptExpandEventRecords(true))
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	event := func(values ...string) any {
+		var records []any
+		for i, v := range values {
+			records = append(records, map[string]any{
+				"topic":     "foo",
+				"partition": 0.0,
+				"offset":    float64(i),
+				"key":       base64.StdEncoding.EncodeToString([]byte("key")),
+				"value":     base64.StdEncoding.EncodeToString([]byte(v)),
+			})
+		}
+		return map[string]any{
+			"eventSource": "aws:kafka",
+			"records":     map[string]any{"foo-0": records},
+		}
+	}
+
+	res, err := h.Handle(ctx, event("good", "good"))
+	require.NoError(t, err)
+	assert.Equal(t, serverless.BatchResponse{BatchItemFailures: []serverless.BatchItemFailure{}}, res)
+
+	_, err = h.Handle(ctx, event("good", "bad"))
+	require.Error(t, err)
+
+	require.NoError(t, h.Close(ctx))
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// httpStatusCodeMeta is the metadata key of a response message that
+	// determines the status code of an HTTP response, matching the key set by
+	// the http processor.
+	httpStatusCodeMeta = "http_status_code"
+
+	// httpResponseHeaderPrefix is the prefix of metadata keys of a response
+	// message that are set as headers of an HTTP response.
+	httpResponseHeaderPrefix = "http_response_header_"
+)
+
+// httpRequest is an HTTP request received either directly or from an API
+// Gateway or Application Load Balancer event.
+type httpRequest struct {
+	method     string
+	path       string
+	header     http.Header
+	query      url.Values
+	pathParams map[string]string
+	remoteIP   string
+	body       []byte
+}
+
+// httpResponse is the HTTP response derived from the sync response of a
+// request.
+type httpResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// newHTTPRequestMessage creates a message from a request with the same
+// metadata as the http_server input, which allows pipelines to be moved
+// between the two.
+func newHTTPRequestMessage(req *httpRequest) *service.Message {
+	msg := service.NewMessage(req.body)
+	msg.MetaSetMut("http_server_user_agent", req.header.Get("User-Agent"))
+	msg.MetaSetMut("http_server_request_path", req.path)
+	msg.MetaSetMut("http_server_verb", req.method)
+	if req.remoteIP != "" {
+		msg.MetaSetMut("http_server_remote_ip", req.remoteIP)
+	}
+	for k, v := range req.header {
+		if len(v) > 0 {
+			msg.MetaSetMut(k, v[0])
+		}
+	}
+	for k, v := range req.query {
+		if len(v) > 0 {
+			msg.MetaSetMut(k, v[0])
+		}
+	}
+	for k, v := range req.pathParams {
+		msg.MetaSetMut(k, v)
+	}
+	for _, c := range (&http.Request{Header: req.header}).Cookies() {
+		msg.MetaSetMut(c.Name, c.Value)
+	}
+	return msg
+}
+
+// handleHTTP processes a request and derives a response from its sync
+// response. The status code is taken from the metadata key `http_status_code`
+// of the first response message, and headers from metadata keys prefixed with
+// `http_response_header_`. When more than one response message exists their
+// contents are joined with newlines.
+func (h *Handler) handleHTTP(ctx context.Context, req *httpRequest) *httpResponse {
+	msg, store := newHTTPRequestMessage(req).WithSyncResponseStore()
+	if err := h.process(ctx, service.MessageBatch{msg}); err != nil {
+		return &httpResponse{
+			statusCode: http.StatusBadGateway,
+			header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+			body:       []byte(err.Error()),
+		}
+	}
+
+	res := &httpResponse{
+		statusCode: http.StatusOK,
+		header:     http.Header{},
+	}
+
+	var first *service.Message
+	var bodies [][]byte
+	for _, b := range store.Read() {
+		for _, m := range b {
+			mBytes, err := m.AsBytes()
+			if err != nil {
+				continue
+			}
+			if first == nil {
+				first = m
+			}
+			bodies = append(bodies, mBytes)
+		}
+	}
+	if first != nil {
+		_ = first.MetaWalkMut(func(k string, v any) error {
+			if name, ok := strings.CutPrefix(k, httpResponseHeaderPrefix); ok {
+				res.header.Set(name, toString(v))
+			} else if k == httpStatusCodeMeta {
+				if code, err := strconv.Atoi(toString(v)); err == nil {
+					res.statusCode = code
+				}
+			}
+			return nil
+		})
+	}
+	res.body = bytes.Join(bodies, []byte("\n"))
+
+	if res.header.Get("Content-Type") == "" && len(res.body) > 0 {
+		if json.Valid(res.body) {
+			res.header.Set("Content-Type", "application/json")
+		} else {
+			res.header.Set("Content-Type", http.DetectContentType(res.body))
+		}
+	}
+	return res
+}
+
+func toString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// ServeHTTP implements http.Handler, which allows the pipeline to be run by
+// serverless platforms that forward HTTP requests, such as Cloud Run, Knative
+// or Azure Functions custom handlers with request forwarding enabled.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	req := &httpRequest{
+		method: r.Method,
+		path:   r.URL.Path,
+		header: r.Header,
+		query:  r.URL.Query(),
+		body:   body,
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.remoteIP = host
+	}
+
+	res := h.handleHTTP(r.Context(), req)
+	for k, v := range res.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.statusCode)
+	_, _ = w.Write(res.body)
+}
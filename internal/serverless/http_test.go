@@ -0,0 +1,256 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/serverless"
+)
+
+const testHTTPConfig = `
+pipeline:
+  processors:
+    - mapping: |
+        root = if content() == "bad" { throw("nope") }
+        root.verb = @http_server_verb
+        root.path = @http_server_request_path
+        root.name = @name
+        root.agent = @http_server_user_agent
+        root.body = content().string()
+        meta http_status_code = if @name == "teapot" { 418 }
+        meta "http_response_header_X-Name" = @name
+logger:
+  level: NONE
+`
+
+func TestServerlessHandlerHTTP(t *testing.T) {
+	h, err := serverless.NewHandler(testHTTPConfig)
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequest("POST", srv.URL+"/foo?name=teapot", strings.NewReader("hello world"))
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "test-client")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, 418, res.StatusCode)
+	assert.Equal(t, "teapot", res.Header.Get("X-Name"))
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"verb":"POST","path":"/foo","name":"teapot","agent":"test-client","body":"hello world"}`, string(body))
+
+	res, err = http.Post(srv.URL+"/foo", "text/plain", strings.NewReader("bad"))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadGateway, res.StatusCode)
+	assert.Contains(t, string(body), "nope")
+
+	require.NoError(t, h.Close(ctx))
+}
+
+func TestServerlessHandlerAPIGateway(t *testing.T) {
+	h, err := serverless.NewHandler(testHTTPConfig, serverless.OptHTTPEvents(true))
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	for _, test := range []struct {
+		name     string
+		event    string
+		response serverless.HTTPResponse
+	}{
+		{
+			name: "rest api",
+			event: `{
+  "resource": "/{proxy+}",
+  "path": "/foo",
+  "httpMethod": "PUT",
+  "headers": {"User-Agent": "test-client"},
+  "multiValueHeaders": {"User-Agent": ["test-client"]},
+  "queryStringParameters": {"name": "teapot"},
+  "multiValueQueryStringParameters": {"name": ["teapot"]},
+  "requestContext": {"identity": {"sourceIp": "10.0.0.1"}},
+  "body": "aGVsbG8gd29ybGQ=",
+  "isBase64Encoded": true
+}`,
+			response: serverless.HTTPResponse{
+				StatusCode: 418,
+				MultiValueHeaders: map[string][]string{
+					"X-Name":       {"teapot"},
+					"Content-Type": {"application/json"},
+				},
+				Body: `{"agent":"test-client","body":"hello world","name":"teapot","path":"/foo","verb":"PUT"}`,
+			},
+		},
+		{
+			name: "http api",
+			event: `{
+  "version": "2.0",
+  "rawPath": "/bar",
+  "rawQueryString": "name=alice",
+  "headers": {"user-agent": "test-client"},
+  "requestContext": {"http": {"method": "POST", "sourceIp": "10.0.0.1"}},
+  "body": "hello world",
+  "isBase64Encoded": false
+}`,
+			response: serverless.HTTPResponse{
+				StatusCode: 200,
+				Headers: map[string]string{
+					"X-Name":       "alice",
+					"Content-Type": "application/json",
+				},
+				Body: `{"agent":"test-client","body":"hello world","name":"alice","path":"/bar","verb":"POST"}`,
+			},
+		},
+		{
+			name: "alb",
+			event: `{
+  "requestContext": {"elb": {"targetGroupArn": "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/lambda/abc"}},
+  "httpMethod": "GET",
+  "path": "/baz",
+  "queryStringParameters": {"name": "bob%20smith"},
+  "headers": {"user-agent": "test-client"},
+  "body": "",
+  "isBase64Encoded": false
+}`,
+			response: serverless.HTTPResponse{
+				StatusCode:        200,
+				StatusDescription: "200 OK",
+				Headers: map[string]string{
+					"X-Name":       "bob smith",
+					"Content-Type": "application/json",
+				},
+				Body: `{"agent":"test-client","body":"","name":"bob smith","path":"/baz","verb":"GET"}`,
+			},
+		},
+		{
+			name: "error",
+			event: `{
+  "version": "2.0",
+  "rawPath": "/bar",
+  "requestContext": {"http": {"method": "POST"}},
+  "body": "bad"
+}`,
+			response: serverless.HTTPResponse{
+				StatusCode: http.StatusBadGateway,
+				Headers: map[string]string{
+					"Content-Type": "text/plain; charset=utf-8",
+				},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var event any
+			require.NoError(t, json.Unmarshal([]byte(test.event), &event))
+
+			res, err := h.Handle(ctx, event)
+			require.NoError(t, err)
+
+			hRes, ok := res.(serverless.HTTPResponse)
+			require.True(t, ok, "%T", res)
+			if test.response.StatusCode == http.StatusBadGateway {
+				assert.Contains(t, hRes.Body, "nope")
+				hRes.Body = ""
+			}
+			assert.Equal(t, test.response, hRes)
+		})
+	}
+
+	require.NoError(t, h.Close(ctx))
+}
+
+func TestServerlessHandlerAPIGatewayBinaryResponse(t *testing.T) {
+	h, err := serverless.NewHandler(`
+pipeline:
+  processors:
+    - mapping: 'root = content().decode("hex")'
+logger:
+  level: NONE
+`, serverless.OptHTTPEvents(true))
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	res, err := h.Handle(ctx, map[string]any{
+		"version":        "2.0",
+		"rawPath":        "/",
+		"requestContext": map[string]any{"http": map[string]any{"method": "POST"}},
+		"body":           "ff00fe",
+	})
+	require.NoError(t, err)
+
+	hRes := res.(serverless.HTTPResponse)
+	assert.True(t, hRes.IsBase64Encoded)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte{0xff, 0x00, 0xfe}), hRes.Body)
+
+	require.NoError(t, h.Close(ctx))
+}
+
+func TestServerlessHandlerHTTPEventsDisabled(t *testing.T) {
+	h, err := serverless.NewHandler(`
+pipeline:
+  processors:
+    - mapping: |
+        root.statusCode = 201
+        root.body = this.body.uppercase()
+logger:
+  level: NONE
+`)
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*5)
+	defer done()
+
+	// By default HTTP events are processed as they are, and the result is
+	// returned unchanged.
+	res, err := h.Handle(ctx, map[string]any{
+		"version":        "2.0",
+		"rawPath":        "/",
+		"requestContext": map[string]any{"http": map[string]any{"method": "POST"}},
+		"body":           "hello world",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"statusCode": int64(201), "body": "HELLO WORLD"}, res)
+
+	require.NoError(t, h.Close(ctx))
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless
+
+import (
+	"context"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// handlerInputName is the name of the input registered within the environment
+// of each handler, which reads the batches of invocations.
+const handlerInputName = "serverless_handler"
+
+type handlerRequest struct {
+	batch   service.MessageBatch
+	resChan chan<- error
+}
+
+// handlerInput is used in place of a producer func as the acknowledgement
+// errors received by inputs can be walked as batch errors, which allows us to
+// determine which messages of an invocation failed.
+type handlerInput struct {
+	reqChan <-chan handlerRequest
+}
+
+func registerHandlerInput(env *service.Environment, reqChan <-chan handlerRequest) error {
+	return env.RegisterBatchInput(handlerInputName, service.NewConfigSpec(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+			return &handlerInput{reqChan: reqChan}, nil
+		})
+}
+
+func (h *handlerInput) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (h *handlerInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	select {
+	case req := <-h.reqChan:
+		return req.batch, func(ctx context.Context, err error) error {
+			req.resChan <- err
+			return nil
+		}, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (h *handlerInput) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// listenAddress returns the address to serve HTTP requests on, where the port
+// is taken from the environment variable set by the serverless platform.
+func listenAddress() string {
+	for _, env := range []string{
+		"FUNCTIONS_CUSTOMHANDLER_PORT", // Azure Functions custom handlers
+		"PORT",                         // Cloud Run and Knative
+	} {
+		if port := os.Getenv(env); port != "" {
+			return net.JoinHostPort("", port)
+		}
+	}
+	return ":8080"
+}
+
+// RunHTTP executes Redpanda Connect as an HTTP server for serverless platforms
+// that forward HTTP requests, such as Cloud Run, Knative or Azure Functions
+// custom handlers with request forwarding enabled.
+func RunHTTP(confYAML string, opts ...HandlerOpt) {
+	handler, err := NewHandler(confYAML, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Initialisation error: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{
+		Addr:              listenAddress(),
+		Handler:           handler,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-sigCtx.Done()
+		ctx, done := context.WithTimeout(context.Background(), time.Second*10)
+		defer done()
+		_ = srv.Shutdown(ctx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+		os.Exit(1)
+	}
+	<-shutdownDone
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second*30)
+	defer done()
+
+	if err = handler.Close(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Shut down error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -35,6 +35,7 @@ import (
 	_ "github.com/redpanda-data/connect/v4/public/components/discord"
 	_ "github.com/redpanda-data/connect/v4/public/components/elasticsearch"
 	_ "github.com/redpanda-data/connect/v4/public/components/gcp"
+	_ "github.com/redpanda-data/connect/v4/public/components/grpc"
 	_ "github.com/redpanda-data/connect/v4/public/components/hdfs"
 	_ "github.com/redpanda-data/connect/v4/public/components/influxdb"
 	_ "github.com/redpanda-data/connect/v4/public/components/io"
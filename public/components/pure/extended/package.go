@@ -27,10 +27,12 @@ import (
 	_ "github.com/redpanda-data/benthos/v4/public/components/pure/extended"
 
 	_ "github.com/redpanda-data/connect/v4/internal/impl/awk"
+	_ "github.com/redpanda-data/connect/v4/internal/impl/csv"
 	_ "github.com/redpanda-data/connect/v4/internal/impl/html"
 	_ "github.com/redpanda-data/connect/v4/internal/impl/jsonpath"
 	_ "github.com/redpanda-data/connect/v4/internal/impl/lang"
 	_ "github.com/redpanda-data/connect/v4/internal/impl/msgpack"
+	_ "github.com/redpanda-data/connect/v4/internal/impl/orc"
 	_ "github.com/redpanda-data/connect/v4/internal/impl/parquet"
 	_ "github.com/redpanda-data/connect/v4/internal/impl/protobuf"
 	_ "github.com/redpanda-data/connect/v4/internal/impl/xml"